@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/boot"
+	"github.com/mohammedhassan/etl-pipeline/internal/config"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/storage"
+	"github.com/mohammedhassan/etl-pipeline/internal/tracing"
+)
+
+// app is what the commands running pipelines share: the configuration, logging,
+// tracing and metrics, the database and the assembled pipelines
+type app struct {
+	cfg     *config.Config
+	logger  *logging.Logger
+	metrics *metrics.Metrics
+	db      *database.PostgresDB
+	// pusher pushes the metrics after every cycle, if configured
+	pusher           *metrics.Pusher
+	partitionManager *database.PartitionManager
+	// maintainer vacuums or analyzes the tables every DB_MAINTENANCE_INTERVAL
+	maintainer *database.Maintainer
+	pipelines  []*pipeline
+	// archiveStorage stores the rows archived by retention
+	archiveStorage  *storage.FileStorage
+	shutdownTracing func(context.Context) error
+	shutdownMetrics func(context.Context) error
+	// closers release the pipelines, their logs and the database, in order
+	closers []func() error
+	// logRemotes receive the messages of every log, closed after them
+	logRemotes []*logging.Remote
+}
+
+// newApp loads the configuration and assembles the pipeline of the environment
+// configuration, or each pipeline of PIPELINES_FILE. Invalid settings stop the
+// process. The pipelines are not started.
+func newApp(ctx context.Context) *app {
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	a := &app{cfg: cfg}
+
+	// Initialize logger, with the remote outputs shared by the logs of all pipelines
+	if cfg.LogSyslogAddress != "" {
+		remote, err := logging.NewSyslog(cfg.LogSyslogAddress, cfg.TracingServiceName)
+		if err != nil {
+			log.Fatalf("Invalid LOG_SYSLOG_ADDRESS: %v", err)
+		}
+		a.logRemotes = append(a.logRemotes, remote)
+	}
+	if cfg.LogShipAddress != "" {
+		remote, err := logging.NewShipper(cfg.LogShipAddress, cfg.TracingServiceName)
+		if err != nil {
+			log.Fatalf("Invalid LOG_SHIP_ADDRESS: %v", err)
+		}
+		a.logRemotes = append(a.logRemotes, remote)
+	}
+	logger, err := a.openLog("logs/etl.log", cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	a.logger = logger
+
+	// Initialize tracing; spans are exported only when a collector is configured
+	a.shutdownTracing, err = tracing.Setup(context.Background(), tracing.Config{
+		Endpoint:    cfg.TracingEndpoint,
+		ServiceName: cfg.TracingServiceName,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		log.Fatalf("Invalid tracing settings: %v", err)
+	}
+
+	logger.Info(fmt.Sprintf("Configuration loaded: Source=%s, Interval=%ds", cfg.SourceEnv, cfg.FetchInterval))
+
+	// Initialize metrics; with several pipelines each one's metrics carry its name
+	metricsCollector := metrics.NewMetrics()
+	if cfg.PipelinesFile != "" {
+		metricsCollector = metrics.NewPipelineMetrics()
+	}
+	a.metrics = metricsCollector
+	a.shutdownMetrics = func(context.Context) error { return nil }
+	switch cfg.MetricsExporter {
+	case metrics.ExporterPrometheus:
+	case metrics.ExporterOTLP:
+		a.shutdownMetrics, err = metricsCollector.ExportOTLP(context.Background(), metrics.OTLPConfig{
+			Endpoint:    cfg.TracingEndpoint,
+			ServiceName: cfg.TracingServiceName,
+			Interval:    cfg.MetricsExportInterval,
+		})
+		if err != nil {
+			log.Fatalf("Invalid OTLP metrics settings: %v", err)
+		}
+		logger.Info(fmt.Sprintf("Exporting metrics to %s every %v", cfg.TracingEndpoint, cfg.MetricsExportInterval))
+	default:
+		log.Fatalf("Invalid METRICS_EXPORTER %q: must be prometheus or otlp", cfg.MetricsExporter)
+	}
+	if cfg.MetricsPushgatewayURL != "" || cfg.MetricsStatsDAddr != "" {
+		a.pusher, err = metricsCollector.NewPusher(metrics.PushConfig{
+			PushgatewayURL: cfg.MetricsPushgatewayURL,
+			Job:            cfg.MetricsPushJob,
+			Instance:       cfg.InstanceID,
+			StatsDAddr:     cfg.MetricsStatsDAddr,
+			StatsDPrefix:   cfg.MetricsStatsDPrefix,
+			Timeout:        10 * time.Second,
+		})
+		if err != nil {
+			log.Fatalf("Invalid metrics push settings: %v", err)
+		}
+		logger.Info("Pushing metrics after every cycle")
+	}
+
+	// Initialize database, waiting for it to accept connections; the pipelines'
+	// other dependencies are waited for within the same BOOT_WAIT_TIMEOUT
+	waiter := boot.NewWaiter(boot.Config{
+		Timeout:    cfg.BootWaitTimeout,
+		Backoff:    cfg.BootWaitBackoff,
+		MaxBackoff: cfg.BootWaitMaxBackoff,
+	}, logger)
+	var db *database.PostgresDB
+	err = waiter.Wait(ctx, boot.Dependency{Name: "database", Check: func(context.Context) (err error) {
+		db, err = database.NewPostgresDB(cfg.DatabaseURL)
+		return err
+	}})
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to connect to database: %v", err))
+		log.Fatalf("Database connection failed: %v", err)
+	}
+	a.db = db
+	db.SetRetryPolicy(cfg.DBRetry, metricsCollector)
+	if err := db.SetLoadStrategy(cfg.LoadStrategy); err != nil {
+		log.Fatalf("Invalid LOAD_STRATEGY: %v", err)
+	}
+	db.SetPool(poolConfig(cfg.DBPool))
+	db.SetStatementTracing(cfg.DBSlowQueryThreshold, metricsCollector, logger)
+	logger.Info("Connected to PostgreSQL database")
+	if cfg.DatabaseReadURL != "" {
+		err = waiter.Wait(ctx, boot.Dependency{Name: "database replica", Check: func(context.Context) error {
+			return db.SetReplica(cfg.DatabaseReadURL, poolConfig(cfg.DBReadPool))
+		}})
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to connect to read replica: %v", err))
+			log.Fatalf("Read replica connection failed: %v", err)
+		}
+		logger.Info("Connected to PostgreSQL read replica, serving the query API")
+	}
+
+	if cfg.DBAutoMigrate {
+		applied, err := db.Migrate(context.Background())
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to migrate database schema: %v", err))
+			log.Fatalf("Database migration failed: %v", err)
+		}
+		if len(applied) > 0 {
+			logger.Info(fmt.Sprintf("Applied schema migrations: %v", applied))
+		}
+	}
+
+	// Create ingestion partitions ahead of time
+	if cfg.PartitionInterval != "" {
+		a.partitionManager, err = database.NewPartitionManager(db, cfg.PartitionInterval, cfg.PartitionPremake, logger, metricsCollector)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize partition maintenance: %v", err))
+			log.Fatalf("Partition maintenance initialization failed: %v", err)
+		}
+		if err := a.partitionManager.Run(context.Background()); err != nil {
+			logger.Error(fmt.Sprintf("Partition maintenance failed: %v", err))
+		}
+		logger.Info(fmt.Sprintf("Partition maintenance enabled: %s partitions, %d ahead", cfg.PartitionInterval, cfg.PartitionPremake))
+	}
+	if cfg.DBMaintenanceInterval > 0 {
+		a.maintainer, err = database.NewMaintainer(db, cfg.DBMaintenanceCommand, cfg.DBMaintenanceTables, logger, metricsCollector)
+		if err != nil {
+			log.Fatalf("Invalid table maintenance settings: %v", err)
+		}
+		logger.Info(fmt.Sprintf("Table maintenance enabled: %s every %v", cfg.DBMaintenanceCommand, cfg.DBMaintenanceInterval))
+	}
+
+	keyring, err := loadKeyring(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Invalid encryption keys: %v", err)
+	}
+	if keyring != nil {
+		logger.Info(fmt.Sprintf("File encryption enabled with key %s (%d keys loaded)", keyring.Primary(), len(keyring.KeyIDs())))
+	}
+
+	// Assemble the pipeline of the environment configuration, or each pipeline of PIPELINES_FILE
+	var closers []func() error
+	if cfg.PipelinesFile == "" {
+		a.pipelines = append(a.pipelines, newPipeline(ctx, "", cfg, "data", keyring, db, logger, metricsCollector))
+		a.archiveStorage = a.pipelines[0].storage
+	} else {
+		definitions, err := config.LoadPipelines(cfg.PipelinesFile)
+		if err != nil {
+			log.Fatalf("Invalid PIPELINES_FILE: %v", err)
+		}
+		for _, def := range definitions {
+			pipelineCfg := cfg.ForPipeline(def)
+			pipelineLog, err := a.openLog(def.LogFile(), pipelineCfg.LogLevel)
+			if err != nil {
+				log.Fatalf("Failed to initialize logger of pipeline %s: %v", def.Name, err)
+			}
+			closers = append(closers, pipelineLog.Close)
+			pipelineLog.SetStdout(def.Log.Stdout == nil || *def.Log.Stdout)
+			pipelineLogger := pipelineLog.WithPrefix(fmt.Sprintf("[%s]", def.Name))
+
+			p := newPipeline(ctx, def.Name, pipelineCfg, def.DataDir(), keyring, db, pipelineLogger, metricsCollector.ForPipeline(def.Name))
+			p.logFile = def.LogFile()
+			a.pipelines = append(a.pipelines, p)
+			logger.Info(fmt.Sprintf("Pipeline %s configured: files in %s, running %v", def.Name, def.DataDir(), p.schedule))
+		}
+		// Rows archived from the shared tables are written under data/archive
+		a.archiveStorage = newFileStorage(cfg, "data", keyring, logger)
+	}
+	for _, p := range a.pipelines {
+		a.closers = append(a.closers, func() error { p.Close(); return nil })
+		if a.pusher != nil {
+			p.service.SetMetricsPusher(a.pusher)
+		}
+	}
+	a.closers = append(a.closers, closers...)
+	a.closers = append(a.closers, db.Close)
+
+	// Start nothing until the source API and the storage of every pipeline answer
+	for _, p := range a.pipelines {
+		if err := waiter.Wait(ctx, p.dependencies()...); err != nil {
+			logger.Error(fmt.Sprintf("Pipeline dependency unavailable: %v", err))
+			log.Fatalf("Pipeline %s cannot start: %v", displayName(p.name), err)
+		}
+	}
+	return a
+}
+
+// pipelinesNamed returns the pipeline of the given name, as named by the pipeline
+// control API, or every pipeline when name is empty
+func (a *app) pipelinesNamed(name string) ([]*pipeline, error) {
+	if name == "" {
+		return a.pipelines, nil
+	}
+	for _, p := range a.pipelines {
+		if displayName(p.name) == name {
+			return []*pipeline{p}, nil
+		}
+	}
+	return nil, fmt.Errorf("pipeline %s is not configured", name)
+}
+
+// Close flushes the traces and metrics, releases the pipelines and the database
+// and closes the logs
+func (a *app) Close(ctx context.Context) {
+	if err := a.shutdownTracing(ctx); err != nil {
+		a.logger.Error(fmt.Sprintf("Failed to flush traces: %v", err))
+	}
+	if err := a.shutdownMetrics(ctx); err != nil {
+		a.logger.Error(fmt.Sprintf("Failed to export metrics: %v", err))
+	}
+	if a.pusher != nil {
+		if err := a.pusher.Push(ctx); err != nil {
+			a.logger.Error(fmt.Sprintf("Failed to push metrics: %v", err))
+		}
+	}
+	for _, close := range a.closers {
+		close()
+	}
+	a.logger.Close()
+	// Last, to send every message logged while closing
+	for _, remote := range a.logRemotes {
+		remote.Close()
+	}
+}
+
+// poolConfig returns the database connection pool configured by pool
+func poolConfig(pool config.PoolConfig) database.PoolConfig {
+	return database.PoolConfig{MaxOpenConns: pool.MaxOpen, MaxIdleConns: pool.MaxIdle, ConnMaxLifetime: pool.MaxLifetime}
+}
+
+// openLog returns a logger writing to the file at path, unless LOG_FILE_ENABLED is
+// off, and to the remote outputs, dropping messages less severe than level
+func (a *app) openLog(path, level string) (*logging.Logger, error) {
+	logger := logging.NewStdoutLogger()
+	if a.cfg.LogFileEnabled {
+		var err error
+		if logger, err = logging.NewRotatingLogger(path, logRotation(a.cfg)); err != nil {
+			return nil, err
+		}
+	}
+	if err := logger.SetLevel(level); err != nil {
+		logger.Close()
+		return nil, err
+	}
+	for _, remote := range a.logRemotes {
+		logger.AddRemote(remote)
+	}
+	return logger, nil
+}
+
+// shutdown closes the app, giving the traces and metrics 10 seconds to flush
+func (a *app) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	a.Close(ctx)
+}
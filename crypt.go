@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/config"
+	"github.com/mohammedhassan/etl-pipeline/internal/encryption"
+	"github.com/mohammedhassan/etl-pipeline/internal/storage"
+)
+
+const cryptUsage = `Usage: etl-pipeline crypt <command>
+
+Commands:
+  decrypt [-o FILE] FILE   decrypt and decompress a data file to stdout or FILE
+  keys [DIR]               count the files under DIR (default data) per encryption key
+`
+
+// loadKeyring builds the keyring of ENCRYPTION_KEYS and ENCRYPTION_KMS_KEYS; it
+// returns nil when no keys are configured
+func loadKeyring(ctx context.Context, cfg *config.Config) (*encryption.Keyring, error) {
+	if len(cfg.EncryptionKeys) == 0 && len(cfg.EncryptionKMSKeys) == 0 {
+		return nil, nil
+	}
+	keys, err := encryption.DecodeKeys(cfg.EncryptionKeys)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.EncryptionKMSKeys) > 0 {
+		kms := encryption.NewKMSClient(encryption.KMSConfig{
+			Region:   cfg.AWSRegion,
+			Endpoint: cfg.KMSEndpoint,
+			Credentials: awsauth.Credentials{
+				AccessKeyID:     cfg.AWSAccessKeyID,
+				SecretAccessKey: cfg.AWSSecretAccessKey,
+				SessionToken:    cfg.AWSSessionToken,
+			},
+		})
+		unwrapped, err := kms.DecryptKeys(ctx, cfg.EncryptionKMSKeys)
+		if err != nil {
+			return nil, err
+		}
+		for id, key := range unwrapped {
+			if _, ok := keys[id]; ok {
+				return nil, fmt.Errorf("encryption key %s is configured twice", id)
+			}
+			keys[id] = key
+		}
+	}
+
+	primary := cfg.EncryptionKeyID
+	if primary == "" && len(keys) == 1 {
+		for id := range keys {
+			primary = id
+		}
+	}
+	if primary == "" {
+		return nil, fmt.Errorf("ENCRYPTION_KEY_ID must name the primary of the %d configured keys", len(keys))
+	}
+	return encryption.NewKeyring(keys, primary)
+}
+
+// runCrypt implements the crypt command and returns the process exit code
+func runCrypt(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cryptUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("crypt "+args[0], flag.ContinueOnError)
+	output := flags.String("o", "", "write the decrypted content to this file instead of stdout")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return 1
+	}
+	keyring, err := loadKeyring(context.Background(), cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load encryption keys: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "decrypt":
+		if flags.NArg() != 1 {
+			fmt.Fprint(os.Stderr, cryptUsage)
+			return 2
+		}
+		if err := decryptFile(keyring, flags.Arg(0), *output); err != nil {
+			fmt.Fprintf(os.Stderr, "Decryption failed: %v\n", err)
+			return 1
+		}
+	case "keys":
+		dir := "data"
+		if flags.NArg() > 0 {
+			dir = flags.Arg(0)
+		}
+		counts, err := countKeys(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to scan %s: %v\n", dir, err)
+			return 1
+		}
+		ids := make([]string, 0, len(counts))
+		for id := range counts {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			note := ""
+			if keyring != nil && id == keyring.Primary() {
+				note = "  (primary)"
+			}
+			fmt.Printf("%-20s %d files%s\n", id, counts[id], note)
+		}
+	default:
+		fmt.Fprint(os.Stderr, cryptUsage)
+		return 2
+	}
+	return 0
+}
+
+// decryptFile decrypts a data file and decompresses it according to its extension
+func decryptFile(keyring *encryption.Keyring, filename, output string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if encryption.IsEncrypted(data) {
+		if keyring == nil {
+			return errors.New("file is encrypted and no keys are configured, set ENCRYPTION_KEYS or ENCRYPTION_KMS_KEYS")
+		}
+		if data, err = keyring.Decrypt(data); err != nil {
+			return err
+		}
+	}
+
+	compression := codec.ForFile(storage.TrimEncryptedExtension(filename))
+	reader, err := compression.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to open %s content: %w", compression.Name(), err)
+	}
+	defer reader.Close()
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	_, err = io.Copy(out, reader)
+	return err
+}
+
+// countKeys counts the encrypted files under dir by the ID of their key;
+// unencrypted files are counted as "none"
+func countKeys(dir string) (map[string]int, error) {
+	counts := make(map[string]int)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		// The header holds the magic, the key ID length and up to 255 bytes of key ID
+		header := make([]byte, 263)
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		n, _ := io.ReadFull(file, header)
+		file.Close()
+
+		id, err := encryption.KeyID(header[:n])
+		if err != nil {
+			id = "none"
+		}
+		counts[id]++
+		return nil
+	})
+	return counts, err
+}
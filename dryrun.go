@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/api"
+	"github.com/mohammedhassan/etl-pipeline/internal/config"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/etl"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+const dryRunUsage = `Usage: etl-pipeline dry-run [-pipeline NAME] [-json]
+
+Extracts and transforms one batch with the current configuration, or the named
+pipeline of PIPELINES_FILE, and prints what a cycle would write without writing it.
+`
+
+// runDryRun implements the dry-run command and returns the process exit code
+func runDryRun(args []string) int {
+	flags := flag.NewFlagSet("dry-run", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, dryRunUsage) }
+	name := flags.String("pipeline", "", "pipeline of PIPELINES_FILE to run")
+	asJSON := flags.Bool("json", false, "print the summary as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return 2
+	}
+	if *name != "" {
+		if cfg.PipelinesFile == "" {
+			fmt.Fprintln(os.Stderr, "-pipeline requires PIPELINES_FILE")
+			return 2
+		}
+		definitions, err := config.LoadPipelines(cfg.PipelinesFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid PIPELINES_FILE: %v\n", err)
+			return 1
+		}
+		found := false
+		for _, def := range definitions {
+			if def.Name == *name {
+				cfg, found = cfg.ForPipeline(def), true
+			}
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "Pipeline %s is not defined in %s\n", *name, cfg.PipelinesFile)
+			return 1
+		}
+	}
+
+	logger, err := logging.NewRotatingLogger("logs/dry-run.log", logRotation(cfg))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
+		return 1
+	}
+	defer logger.Close()
+	metricsCollector := metrics.NewMetrics()
+
+	source, _ := cfg.Sources()
+	if source.URL == "" {
+		fmt.Fprintf(os.Stderr, "No API URL configured for source environment %s\n", source.Name)
+		return 1
+	}
+	apiClient := api.NewClient(source.URL, source.Token, logger, metricsCollector)
+	apiClient.SetRequestTimeout(cfg.ExtractTimeout)
+	requestBody, err := apiRequestBody(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid API_REQUEST_BODY: %v\n", err)
+		return 2
+	}
+	apiClient.SetRequest(cfg.APIMethod, requestBody)
+	// A dry run writes nothing, not even dumps of failed requests
+	transport := apiTransport(cfg, "")
+	apiClient.SetTransport(transport)
+	var extractor api.Extractor = apiClient
+	if cfg.IDRangeShards > 0 {
+		// Shards resume from their committed watermarks, which are read but never saved
+		db, err := database.NewPostgresDB(cfg.DatabaseURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Database connection failed: %v\n", err)
+			return 1
+		}
+		defer db.Close()
+		if extractor, err = api.NewShardedExtractor(apiClient, api.ShardConfig{
+			IDField:   cfg.IDRangeField,
+			MinID:     cfg.IDRangeMin,
+			MaxID:     cfg.IDRangeMax,
+			Shards:    cfg.IDRangeShards,
+			PageSize:  cfg.IDRangePageSize,
+			FromParam: cfg.IDRangeFromParam,
+			ToParam:   cfg.IDRangeToParam,
+		}, db, logger, metricsCollector); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid sharded extraction: %v\n", err)
+			return 1
+		}
+	}
+	transformer, err := newTransformer(cfg, logger, metricsCollector)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid transform settings: %v\n", err)
+		return 2
+	}
+
+	rawTargets := []string{"raw_data table", "raw snapshot"}
+	var summary *etl.DryRunSummary
+	if len(cfg.PipelineSteps) > 0 {
+		dag, dagErr := newDAG(cfg.PipelineSteps, cfg.ExtractTimeout, transport, logger, metricsCollector)
+		if dagErr != nil {
+			fmt.Fprintf(os.Stderr, "Invalid steps of pipeline %s: %v\n", *name, dagErr)
+			return 1
+		}
+		summary, err = etl.DryRunDAG(context.Background(), dag, extractor, transformer, rawTargets, processedTargets(cfg))
+	} else {
+		summary, err = etl.DryRun(context.Background(), extractor, transformer, rawTargets, processedTargets(cfg))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Dry run failed: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(summary)
+		return 0
+	}
+	fmt.Println(summary)
+	if len(summary.Sample) > 0 {
+		fmt.Println("Sample of processed records:")
+		for _, record := range summary.Sample {
+			line, _ := json.Marshal(record)
+			fmt.Printf("  %s\n", line)
+		}
+	}
+	return 0
+}
+
+// processedTargets lists the destinations of processed records enabled by cfg, in
+// the order the pipeline writes them
+func processedTargets(cfg *config.Config) []string {
+	var targets []string
+	switch {
+	case cfg.TransactionalWrites:
+		targets = append(targets, "processed_data table")
+	case cfg.PostgresSinkEnabled:
+		targets = append(targets, "postgres sink")
+	}
+	if cfg.KafkaTopic != "" {
+		targets = append(targets, "kafka sink")
+	}
+	if cfg.BigQueryTable != "" {
+		targets = append(targets, "bigquery sink")
+	}
+	if cfg.S3SinkBucket != "" {
+		targets = append(targets, "s3 sink")
+	}
+	return append(targets, "processed snapshot")
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrBatchSettled is returned when a batch is acked or nacked a second time
+var ErrBatchSettled = errors.New("batch already settled")
+
+// Batch is a page of extracted records whose source must hear whether they were
+// loaded, e.g. to commit a consumer offset, delete queue messages or move a file
+// aside only once the records can no longer be lost
+type Batch struct {
+	Records []map[string]interface{}
+	// Payloads hold the JSON each record was received as, if known. Raw
+	// passthrough encodes the records of batches without them.
+	Payloads []json.RawMessage
+
+	ack     func() error
+	nack    func(reason error) error
+	settled atomic.Bool
+}
+
+// NewBatch creates a batch of records calling ack once they are durable, and nack
+// when they were not loaded and should be delivered again. Either may be nil.
+func NewBatch(records []map[string]interface{}, payloads []json.RawMessage, ack func() error, nack func(reason error) error) *Batch {
+	return &Batch{Records: records, Payloads: payloads, ack: ack, nack: nack}
+}
+
+// Ack reports the records durable: stored in the database, loaded into the sinks
+// or kept in a checkpoint or pending batch
+func (b *Batch) Ack() error {
+	if !b.settled.CompareAndSwap(false, true) {
+		return ErrBatchSettled
+	}
+	if b.ack == nil {
+		return nil
+	}
+	return b.ack()
+}
+
+// Nack reports the records not loaded, for reason
+func (b *Batch) Nack(reason error) error {
+	if !b.settled.CompareAndSwap(false, true) {
+		return ErrBatchSettled
+	}
+	if b.nack == nil {
+		return nil
+	}
+	return b.nack(reason)
+}
+
+// BatchExtractor hands out the records of a cycle in batches the pipeline acks
+// once their records are durable and nacks otherwise, so records are only let go
+// of at the source once they cannot be lost. Every batch is settled by the end of
+// the cycle that fetched it. FetchData, used by DAG extract steps, dry runs and
+// previews, is expected to leave the records at the source.
+type BatchExtractor interface {
+	// FetchBatches calls emit with each batch, possibly concurrently, and returns
+	// the error FetchData would; extraction stops when emit fails
+	FetchBatches(ctx context.Context, emit func(batch *Batch) error) error
+}
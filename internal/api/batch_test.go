@@ -0,0 +1,33 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBatchSettlesOnce(t *testing.T) {
+	var acked, nacked int
+	var reason error
+	batch := NewBatch(make([]map[string]interface{}, 2), nil,
+		func() error { acked++; return nil },
+		func(err error) error { nacked++; reason = err; return nil })
+
+	notLoaded := errors.New("not loaded")
+	if err := batch.Nack(notLoaded); err != nil {
+		t.Fatalf("Nack: %v", err)
+	}
+	if err := batch.Ack(); !errors.Is(err, ErrBatchSettled) {
+		t.Errorf("Expected acking a nacked batch to fail with ErrBatchSettled, got %v", err)
+	}
+	if err := batch.Nack(notLoaded); !errors.Is(err, ErrBatchSettled) {
+		t.Errorf("Expected a second nack to fail with ErrBatchSettled, got %v", err)
+	}
+	if acked != 0 || nacked != 1 || reason != notLoaded {
+		t.Errorf("Expected a single nack for the reason given, got %d acks, %d nacks, reason %v", acked, nacked, reason)
+	}
+
+	// Sources without anything to do on either outcome pass nil
+	if err := NewBatch(nil, nil, nil, nil).Ack(); err != nil {
+		t.Errorf("Ack without a callback: %v", err)
+	}
+}
@@ -1,28 +1,58 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"sync"
+	"text/template"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/mohammedhassan/etl-pipeline/internal/logging"
 	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+	"github.com/mohammedhassan/etl-pipeline/internal/tracing"
 )
 
 // Client represents an API client for data extraction
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
-	logger     *logging.Logger
-	metrics    *metrics.Metrics
+	baseURL string
+	// tokenMu guards authToken, which is replaced when the token is rotated
+	tokenMu     sync.RWMutex
+	authToken   string
+	httpClient  *http.Client
+	logger      *logging.Logger
+	metrics     *metrics.Metrics
+	rangeParams RangeParams
+	// quarantine keeps bodies that cannot be decoded, up to quarantineMax bytes
+	quarantine    QuarantineStore
+	quarantineMax int
+	// method and body are the HTTP method of requests and the template of their body
+	method string
+	body   *template.Template
+}
+
+// RangeParams describes the query parameters selecting the records of a date range
+type RangeParams struct {
+	// From and To name the parameters of the first and the last instant of the range,
+	// both inclusive
+	From string
+	To   string
+	// Layout formats the instants, e.g. 2006-01-02 for dates or time.RFC3339
+	Layout string
 }
 
-// NewClient creates a new API client
-func NewClient(baseURL string, logger *logging.Logger, metrics *metrics.Metrics) *Client {
+// NewClient creates a new API client. authToken is sent as a bearer token when set.
+func NewClient(baseURL, authToken string, logger *logging.Logger, metrics *metrics.Metrics) *Client {
 	return &Client{
-		baseURL: baseURL,
+		baseURL:   baseURL,
+		authToken: authToken,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -31,44 +61,282 @@ func NewClient(baseURL string, logger *logging.Logger, metrics *metrics.Metrics)
 	}
 }
 
+// SetToken replaces the bearer token of subsequent requests, e.g. after it was rotated
+func (c *Client) SetToken(authToken string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.authToken = authToken
+}
+
+func (c *Client) token() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+	return c.authToken
+}
+
+// ErrPartial is returned with the records fetched so far when the context ran out
+// before the extraction finished. The remainder is picked up by the next fetch.
+var ErrPartial = errors.New("extraction incomplete")
+
+// Extractor fetches one cycle's worth of raw records from a source
+type Extractor interface {
+	FetchData(ctx context.Context) ([]map[string]interface{}, error)
+}
+
+// RangeExtractor fetches the records of a date range, e.g. for backfills
+type RangeExtractor interface {
+	FetchRange(ctx context.Context, from, to time.Time) ([]map[string]interface{}, error)
+}
+
+// StreamExtractor hands out records page by page as they are fetched, so they can be
+// processed while the extraction goes on
+type StreamExtractor interface {
+	// FetchStream calls emit with each page, possibly concurrently, and returns the
+	// error FetchData would; extraction stops when emit fails
+	FetchStream(ctx context.Context, emit func(page []map[string]interface{}) error) error
+}
+
+// PayloadExtractor hands out pages of records together with the JSON each record
+// was received as, so it can be stored without encoding the record again
+type PayloadExtractor interface {
+	// FetchPayloads works like FetchStream, passing emit the payload of each record
+	// of the page at the same index
+	FetchPayloads(ctx context.Context, emit func(page []map[string]interface{}, payloads []json.RawMessage) error) error
+}
+
 // FetchData fetches data from the API
-func (c *Client) FetchData() ([]map[string]interface{}, error) {
+func (c *Client) FetchData(ctx context.Context) ([]map[string]interface{}, error) {
+	return c.fetch(ctx, c.baseURL, RequestVars{})
+}
+
+// SetRequestTimeout bounds each request to the API, 30s by default
+func (c *Client) SetRequestTimeout(timeout time.Duration) {
+	c.httpClient.Timeout = timeout
+}
+
+// SetRangeParams sets the query parameters FetchRange selects a date range with
+func (c *Client) SetRangeParams(params RangeParams) {
+	c.rangeParams = params
+}
+
+// FetchRange fetches the records of [from, to). The last instant sent is just
+// before to, so ranges ending at midnight end on the previous day with date layouts.
+func (c *Client) FetchRange(ctx context.Context, from, to time.Time) ([]map[string]interface{}, error) {
+	vars := RequestVars{From: from.Format(c.rangeParams.Layout), To: to.Add(-time.Nanosecond).Format(c.rangeParams.Layout)}
+	if c.rangeParams.From == "" || c.rangeParams.To == "" {
+		if c.body == nil {
+			return nil, errors.New("no date range query parameters configured")
+		}
+		// The request body template selects the range
+		return c.fetch(ctx, c.baseURL, vars)
+	}
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API URL: %w", err)
+	}
+	q := u.Query()
+	q.Set(c.rangeParams.From, vars.From)
+	q.Set(c.rangeParams.To, vars.To)
+	u.RawQuery = q.Encode()
+	return c.fetch(ctx, u.String(), vars)
+}
+
+// streamPageSize is the number of records FetchStream decodes before handing them out
+const streamPageSize = 500
+
+// FetchStream fetches the records like FetchData, decoding the response as it is
+// read and calling emit with every streamPageSize records. While emit blocks the
+// rest of the response is left unread, so slow consumers throttle the download.
+func (c *Client) FetchStream(ctx context.Context, emit func(page []map[string]interface{}) error) error {
+	_, err := c.fetchPages(ctx, c.baseURL, RequestVars{}, false, func(page []map[string]interface{}, _ []json.RawMessage) error {
+		return emit(page)
+	})
+	return err
+}
+
+// FetchPayloads fetches the records like FetchStream, keeping the bytes of each
+// record as the API sent them
+func (c *Client) FetchPayloads(ctx context.Context, emit func(page []map[string]interface{}, payloads []json.RawMessage) error) error {
+	_, err := c.fetchPages(ctx, c.baseURL, RequestVars{}, true, emit)
+	return err
+}
+
+// fetch performs a request against url and decodes the JSON array response
+func (c *Client) fetch(ctx context.Context, url string, vars RequestVars) ([]map[string]interface{}, error) {
+	var data []map[string]interface{}
+	if _, err := c.fetchPages(ctx, url, vars, false, func(page []map[string]interface{}, _ []json.RawMessage) error {
+		data = append(data, page...)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// fetchPages performs a request against url, with a body rendered from vars if
+// templated, and decodes the JSON array response page by page, returning the
+// number of records emitted. The payload of each record is passed to emit too when
+// keepPayloads is set. Errors of emit are returned as is and not counted as failed
+// requests.
+func (c *Client) fetchPages(ctx context.Context, url string, vars RequestVars, keepPayloads bool, emit func(page []map[string]interface{}, payloads []json.RawMessage) error) (records int, err error) {
+	ctx, span := tracing.Start(ctx, "api.fetch", attribute.String("http.url", url))
+	defer func() {
+		span.SetAttributes(attribute.Int("etl.records", records))
+		tracing.End(span, err)
+	}()
+	logger := c.logger.ForContext(ctx)
 	start := time.Now()
 	c.metrics.APIRequestsTotal.Inc()
 
-	c.logger.Info(fmt.Sprintf("Fetching data from API: %s", c.baseURL))
+	logger.Info(fmt.Sprintf("Fetching data from API: %s", url))
+
+	req, err := c.newRequest(ctx, url, vars)
+	if err != nil {
+		c.metrics.APIRequestsFailedTotal.WithLabelValues(ReasonRequest).Inc()
+		return 0, err
+	}
+	if token := c.token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if id := runid.FromContext(ctx); id != "" {
+		req.Header.Set(runid.HTTPHeader, id)
+	}
+	tracing.Inject(ctx, req.Header)
 
-	resp, err := c.httpClient.Get(c.baseURL)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		c.metrics.APIRequestsFailedTotal.Inc()
-		c.logger.Error(fmt.Sprintf("API request failed: %v", err))
-		return nil, fmt.Errorf("failed to fetch data: %w", err)
+		c.metrics.APIRequestsFailedTotal.WithLabelValues(transportReason(err)).Inc()
+		logger.Error(fmt.Sprintf("API request failed: %v", err))
+		return 0, fmt.Errorf("failed to fetch data: %w", err)
 	}
 	defer resp.Body.Close()
 
 	duration := time.Since(start).Seconds()
-	c.metrics.APIRequestDuration.Observe(duration)
+	metrics.ObserveWithTrace(ctx, c.metrics.APIRequestDuration, duration)
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 
 	if resp.StatusCode != http.StatusOK {
-		c.metrics.APIRequestsFailedTotal.Inc()
-		c.logger.Error(fmt.Sprintf("API returned non-200 status: %d", resp.StatusCode))
-		return nil, fmt.Errorf("API returned status code: %d", resp.StatusCode)
+		c.metrics.APIRequestsFailedTotal.WithLabelValues(statusReason(resp.StatusCode)).Inc()
+		logger.Error(fmt.Sprintf("API returned non-200 status: %d", resp.StatusCode))
+		return 0, fmt.Errorf("API returned status code: %d", resp.StatusCode)
+	}
+
+	body := &bodyReader{r: resp.Body}
+	var captured *cappedBuffer
+	if c.quarantine != nil {
+		captured = &cappedBuffer{max: c.quarantineMax}
+		body.r = io.TeeReader(resp.Body, captured)
 	}
+	records, emitErr, err := decodePages(json.NewDecoder(body), keepPayloads, emit)
+	switch {
+	case emitErr != nil:
+		return records, emitErr
+	case body.err != nil:
+		c.metrics.APIRequestsFailedTotal.WithLabelValues(transportReason(body.err)).Inc()
+		logger.Error(fmt.Sprintf("Failed to read response body: %v", body.err))
+		return records, fmt.Errorf("failed to read response: %w", body.err)
+	case err != nil:
+		c.metrics.APIRequestsFailedTotal.WithLabelValues(ReasonDecode).Inc()
+		logger.Error(fmt.Sprintf("Failed to parse JSON response: %v", err))
+		if captured != nil {
+			location, saveErr := c.saveQuarantine(ctx, url, resp, captured, records, err)
+			if saveErr == nil {
+				c.metrics.QuarantinedPayloadsTotal.WithLabelValues(quarantineReason(err)).Inc()
+				logger.Warn(fmt.Sprintf("Quarantined the response to %s after %d records: %s", url, records, location))
+				return records, nil
+			}
+			logger.Error(fmt.Sprintf("Failed to quarantine the response: %v", saveErr))
+		}
+		return records, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	logger.Info(fmt.Sprintf("API request successful: fetched %d records in %.2fs", records, time.Since(start).Seconds()))
+	return records, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// decodePages decodes a JSON array of records, calling emit with every
+// streamPageSize records, and their payloads when keepPayloads is set. A null body
+// holds no records.
+func decodePages(dec *json.Decoder, keepPayloads bool, emit func(page []map[string]interface{}, payloads []json.RawMessage) error) (records int, emitErr, err error) {
+	tok, err := dec.Token()
 	if err != nil {
-		c.metrics.APIRequestsFailedTotal.Inc()
-		c.logger.Error(fmt.Sprintf("Failed to read response body: %v", err))
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return 0, nil, err
+	}
+	if tok == nil {
+		return 0, nil, nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return 0, nil, fmt.Errorf("expected a JSON array, got %v", tok)
 	}
 
-	var data []map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		c.metrics.APIRequestsFailedTotal.Inc()
-		c.logger.Error(fmt.Sprintf("Failed to parse JSON response: %v", err))
-		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	page := make([]map[string]interface{}, 0, streamPageSize)
+	var payloads []json.RawMessage
+	for dec.More() {
+		var record map[string]interface{}
+		if keepPayloads {
+			var payload json.RawMessage
+			if err := dec.Decode(&payload); err != nil {
+				return records, nil, err
+			}
+			if err := json.Unmarshal(payload, &record); err != nil {
+				return records, nil, err
+			}
+			payloads = append(payloads, payload)
+		} else if err := dec.Decode(&record); err != nil {
+			return records, nil, err
+		}
+		page = append(page, record)
+		if len(page) == streamPageSize {
+			if err := emit(page, payloads); err != nil {
+				return records, err, nil
+			}
+			records += len(page)
+			page, payloads = make([]map[string]interface{}, 0, streamPageSize), nil
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return records, nil, err
+	}
+	if len(page) > 0 {
+		if err := emit(page, payloads); err != nil {
+			return records, err, nil
+		}
+		records += len(page)
 	}
+	return records, nil, nil
+}
 
-	c.logger.Info(fmt.Sprintf("API request successful: fetched %d records in %.2fs", len(data), duration))
-	return data, nil
+// bodyReader keeps the error reading a response body, telling a lost connection
+// apart from a malformed body when decoding fails
+type bodyReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// Ping checks that the API answers requests, sending a HEAD request to its URL.
+// Any response but a server error counts, as the API need not support HEAD, and
+// failed pings are not dumped.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.baseURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	client := &http.Client{Timeout: c.httpClient.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("API unreachable: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+	return nil
 }
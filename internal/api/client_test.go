@@ -0,0 +1,287 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+)
+
+func TestFetchRange(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte(`[{"id": 1}]`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/posts?status=published", "", logger, metrics.NewMetrics())
+	if _, err := client.FetchRange(context.Background(), time.Time{}, time.Time{}); err == nil {
+		t.Error("Expected an error without range parameters")
+	}
+
+	// A daily chunk ending at midnight asks for a single day, keeping the URL's own parameters
+	client.SetRangeParams(RangeParams{From: "since", To: "until", Layout: "2006-01-02"})
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	records, err := client.FetchRange(context.Background(), from, from.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("Expected 1 record, got %d", len(records))
+	}
+	if want := "since=2023-01-01&status=published&until=2023-01-01"; query != want {
+		t.Errorf("Expected query %s, got %s", want, query)
+	}
+}
+
+func TestFetchDataCorrelationID(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(runid.HTTPHeader)
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", logger, metrics.NewMetrics())
+	if _, err := client.FetchData(runid.WithID(context.Background(), "3f2a9c0e7b1d4e6f")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if header != "3f2a9c0e7b1d4e6f" {
+		t.Errorf("Expected the run ID in the %s header, got %q", runid.HTTPHeader, header)
+	}
+
+	// Requests outside of a run carry no correlation ID
+	if _, err := client.FetchData(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if header != "" {
+		t.Errorf("Expected no %s header outside of a run, got %q", runid.HTTPHeader, header)
+	}
+}
+
+// failures returns the failed requests counted with reason
+func failures(m *metrics.Metrics, reason string) float64 {
+	var metric dto.Metric
+	m.APIRequestsFailedTotal.WithLabelValues(reason).Write(&metric)
+	return metric.GetCounter().GetValue()
+}
+
+func TestFetchDataFailureReasons(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	var status int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	m := metrics.NewMetrics()
+	client := NewClient(server.URL, "", logger, m)
+	tests := []struct {
+		status int
+		body   string
+		reason string
+	}{
+		{http.StatusTooManyRequests, "", ReasonRateLimited},
+		{http.StatusNotFound, "", ReasonClientError},
+		{http.StatusBadGateway, "", ReasonServerError},
+		{http.StatusNoContent, "", ReasonUnexpectedStatus},
+		{http.StatusOK, `{"error": "not a list"}`, ReasonDecode},
+	}
+	for _, tt := range tests {
+		status, body = tt.status, tt.body
+		if _, err := client.FetchData(context.Background()); err == nil {
+			t.Fatalf("Expected an error for status %d", tt.status)
+		}
+		if got := failures(m, tt.reason); got != 1 {
+			t.Errorf("Expected 1 failure with reason %s, got %v", tt.reason, got)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	client.FetchData(ctx)
+	if got := failures(m, ReasonTimeout); got != 1 {
+		t.Errorf("Expected 1 timed out request, got %v", got)
+	}
+}
+
+func TestFetchStreamPages(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	records := make([]string, streamPageSize+1)
+	for i := range records {
+		records[i] = fmt.Sprintf(`{"id": %d}`, i+1)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[" + strings.Join(records, ",") + "]"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", logger, metrics.NewMetrics())
+	var pages []int
+	if err := client.FetchStream(context.Background(), func(page []map[string]interface{}) error {
+		pages = append(pages, len(page))
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(pages) != 2 || pages[0] != streamPageSize || pages[1] != 1 {
+		t.Errorf("Expected a full page and a page of 1 record, got %v", pages)
+	}
+
+	// A failing consumer stops the extraction with its own error
+	stopped := errors.New("stopped")
+	calls := 0
+	err := client.FetchStream(context.Background(), func(page []map[string]interface{}) error {
+		calls++
+		return stopped
+	})
+	if !errors.Is(err, stopped) || calls != 1 {
+		t.Errorf("Expected the consumer's error after 1 page, got %v after %d", err, calls)
+	}
+}
+
+func TestFetchPayloadsKeepsRecordBytes(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"title": "a", "id": 12345678901234567890}, {"id": 2}]`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", logger, metrics.NewMetrics())
+	var records []map[string]interface{}
+	var payloads []string
+	if err := client.FetchPayloads(context.Background(), func(page []map[string]interface{}, pagePayloads []json.RawMessage) error {
+		records = append(records, page...)
+		for _, payload := range pagePayloads {
+			payloads = append(payloads, string(payload))
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 2 || records[1]["id"] != float64(2) {
+		t.Errorf("Expected the decoded records, got %v", records)
+	}
+	if len(payloads) != 2 || payloads[0] != `{"title": "a", "id": 12345678901234567890}` || payloads[1] != `{"id": 2}` {
+		t.Errorf("Expected the records as sent, got %q", payloads)
+	}
+}
+
+// memoryQuarantine keeps quarantined bodies in memory
+type memoryQuarantine struct {
+	bodies   []string
+	metadata []map[string]string
+}
+
+func (q *memoryQuarantine) SaveQuarantine(ctx context.Context, body []byte, metadata map[string]string) (string, error) {
+	q.bodies = append(q.bodies, string(body))
+	q.metadata = append(q.metadata, metadata)
+	return fmt.Sprintf("quarantine/%d", len(q.bodies)), nil
+}
+
+func TestFetchDataQuarantinesMalformedBody(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	m := metrics.NewMetrics()
+	store := &memoryQuarantine{}
+	client := NewClient(server.URL, "", logger, m)
+	client.SetQuarantine(store, 16)
+
+	body = `[{"id": 1}, {"id": 2}, {"id": oops}]`
+	data, err := client.FetchData(context.Background())
+	if err != nil {
+		t.Fatalf("Expected a quarantined body not to fail the request, got %v", err)
+	}
+	if len(data) != 0 {
+		t.Errorf("Expected the records of the unfinished page to be skipped, got %v", data)
+	}
+	if len(store.bodies) != 1 || store.bodies[0] != body[:16] {
+		t.Fatalf("Expected the first 16 bytes of the body quarantined, got %q", store.bodies)
+	}
+	metadata := store.metadata[0]
+	if metadata["url"] != server.URL || metadata["status"] != "200" || metadata["reason"] != QuarantineMalformed || metadata["truncated"] != "true" || metadata["fetched_at"] == "" {
+		t.Errorf("Unexpected quarantine metadata: %v", metadata)
+	}
+
+	client.SetQuarantine(store, 1<<10)
+	body = `{"error": "not a list"}`
+	if _, err := client.FetchData(context.Background()); err != nil {
+		t.Fatalf("Expected a quarantined body not to fail the request, got %v", err)
+	}
+	if len(store.bodies) != 2 || store.bodies[1] != body || store.metadata[1]["truncated"] != "false" {
+		t.Errorf("Expected the whole body quarantined, got %q", store.bodies)
+	}
+
+	for reason, want := range map[string]float64{QuarantineMalformed: 1, QuarantineShape: 1} {
+		var metric dto.Metric
+		m.QuarantinedPayloadsTotal.WithLabelValues(reason).Write(&metric)
+		if got := metric.GetCounter().GetValue(); got != want {
+			t.Errorf("Expected %v payloads quarantined as %s, got %v", want, reason, got)
+		}
+	}
+	if got := failures(m, ReasonDecode); got != 2 {
+		t.Errorf("Expected quarantined bodies counted as decode failures, got %v", got)
+	}
+}
+
+func TestPing(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	// An API rejecting HEAD requests still answers
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	client := NewClient(server.URL+"/posts", "", logger, metrics.NewMetrics())
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("Expected the API to be reachable, got %v", err)
+	}
+	server.Close()
+	if err := client.Ping(context.Background()); err == nil {
+		t.Error("Expected an error once the API is down")
+	}
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	client = NewClient(unavailable.URL, "", logger, metrics.NewMetrics())
+	if err := client.Ping(context.Background()); err == nil {
+		t.Error("Expected an error while the API is unavailable")
+	}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// maxDiffExamples bounds the keys listed per category when logging a diff
+const maxDiffExamples = 5
+
+// SourceDiff is the difference between the records of two environments of a source
+type SourceDiff struct {
+	PrimaryCount int
+	ShadowCount  int
+	// Missing keys are in the primary results but not the shadow ones
+	Missing []string
+	// Extra keys are in the shadow results but not the primary ones
+	Extra []string
+	// Changed keys are in both with different content
+	Changed []string
+	// Unkeyed counts records without the key field, which cannot be compared
+	Unkeyed int
+}
+
+// Equal reports whether both environments returned the same records
+func (d SourceDiff) Equal() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Changed) == 0 && d.PrimaryCount == d.ShadowCount
+}
+
+// DiffRecords compares two result sets, matching records by keyField
+func DiffRecords(primary, shadow []map[string]interface{}, keyField string) SourceDiff {
+	diff := SourceDiff{PrimaryCount: len(primary), ShadowCount: len(shadow)}
+
+	index := func(records []map[string]interface{}) map[string]map[string]interface{} {
+		byKey := make(map[string]map[string]interface{}, len(records))
+		for _, record := range records {
+			key, ok := record[keyField]
+			if !ok || key == nil {
+				diff.Unkeyed++
+				continue
+			}
+			byKey[fmt.Sprint(key)] = record
+		}
+		return byKey
+	}
+	primaryByKey := index(primary)
+	shadowByKey := index(shadow)
+
+	for key, record := range primaryByKey {
+		other, ok := shadowByKey[key]
+		switch {
+		case !ok:
+			diff.Missing = append(diff.Missing, key)
+		case !reflect.DeepEqual(record, other):
+			diff.Changed = append(diff.Changed, key)
+		}
+	}
+	for key := range shadowByKey {
+		if _, ok := primaryByKey[key]; !ok {
+			diff.Extra = append(diff.Extra, key)
+		}
+	}
+
+	sort.Strings(diff.Missing)
+	sort.Strings(diff.Extra)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// CompareExtractor fetches the same source from two environments, returning the
+// primary results and logging how the shadow environment differs from them
+type CompareExtractor struct {
+	primary     Extractor
+	shadow      Extractor
+	primaryName string
+	shadowName  string
+	keyField    string
+	logger      *logging.Logger
+	metrics     *metrics.Metrics
+}
+
+// NewCompareExtractor creates an extractor that diffs shadow against primary on every fetch
+func NewCompareExtractor(primaryName string, primary Extractor, shadowName string, shadow Extractor, keyField string, logger *logging.Logger, metrics *metrics.Metrics) *CompareExtractor {
+	return &CompareExtractor{
+		primary:     primary,
+		shadow:      shadow,
+		primaryName: primaryName,
+		shadowName:  shadowName,
+		keyField:    keyField,
+		logger:      logger,
+		metrics:     metrics,
+	}
+}
+
+// FetchData fetches both environments concurrently and returns the primary results.
+// A failing shadow environment never fails the fetch.
+func (c *CompareExtractor) FetchData(ctx context.Context) ([]map[string]interface{}, error) {
+	logger := c.logger.ForContext(ctx)
+	var shadowData []map[string]interface{}
+	var shadowErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		shadowData, shadowErr = c.shadow.FetchData(ctx)
+	}()
+
+	primaryData, err := c.primary.FetchData(ctx)
+	wg.Wait()
+	if err != nil {
+		return primaryData, err
+	}
+
+	if shadowErr != nil {
+		c.metrics.SourceComparisonsTotal.WithLabelValues("error").Inc()
+		logger.Warn(fmt.Sprintf("Source comparison skipped, %s fetch failed: %v", c.shadowName, shadowErr))
+		return primaryData, nil
+	}
+
+	diff := DiffRecords(primaryData, shadowData, c.keyField)
+	c.metrics.SourceComparisonDifferences.WithLabelValues("missing").Add(float64(len(diff.Missing)))
+	c.metrics.SourceComparisonDifferences.WithLabelValues("extra").Add(float64(len(diff.Extra)))
+	c.metrics.SourceComparisonDifferences.WithLabelValues("changed").Add(float64(len(diff.Changed)))
+
+	if diff.Equal() {
+		c.metrics.SourceComparisonsTotal.WithLabelValues("match").Inc()
+		logger.Info(fmt.Sprintf("Source comparison: %s and %s match (%d records)", c.primaryName, c.shadowName, diff.PrimaryCount))
+		return primaryData, nil
+	}
+
+	c.metrics.SourceComparisonsTotal.WithLabelValues("mismatch").Inc()
+	logger.Warn(fmt.Sprintf("Source comparison: %s returned %d records, %s returned %d; %d missing %s, %d extra %s, %d changed %s, %d unkeyed",
+		c.primaryName, diff.PrimaryCount, c.shadowName, diff.ShadowCount,
+		len(diff.Missing), examples(diff.Missing), len(diff.Extra), examples(diff.Extra), len(diff.Changed), examples(diff.Changed),
+		diff.Unkeyed))
+	return primaryData, nil
+}
+
+// Commit commits the primary extractor's progress, if it tracks any
+func (c *CompareExtractor) Commit() error {
+	if committer, ok := c.primary.(Committer); ok {
+		return committer.Commit()
+	}
+	return nil
+}
+
+// examples formats the first few keys of a diff category
+func examples(keys []string) string {
+	if len(keys) == 0 {
+		return "[]"
+	}
+	if len(keys) > maxDiffExamples {
+		return "[" + strings.Join(keys[:maxDiffExamples], ", ") + ", ...]"
+	}
+	return "[" + strings.Join(keys, ", ") + "]"
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRecords(t *testing.T) {
+	primary := []map[string]interface{}{
+		{"id": float64(1), "title": "a"},
+		{"id": float64(2), "title": "b"},
+		{"id": float64(3), "title": "c"},
+		{"title": "no id"},
+	}
+	shadow := []map[string]interface{}{
+		{"id": float64(1), "title": "a"},
+		{"id": float64(2), "title": "B"},
+		{"id": float64(4), "title": "d"},
+	}
+
+	diff := DiffRecords(primary, shadow, "id")
+
+	if diff.Equal() {
+		t.Fatal("Expected differences")
+	}
+	if !reflect.DeepEqual(diff.Missing, []string{"3"}) {
+		t.Errorf("Expected missing [3], got %v", diff.Missing)
+	}
+	if !reflect.DeepEqual(diff.Extra, []string{"4"}) {
+		t.Errorf("Expected extra [4], got %v", diff.Extra)
+	}
+	if !reflect.DeepEqual(diff.Changed, []string{"2"}) {
+		t.Errorf("Expected changed [2], got %v", diff.Changed)
+	}
+	if diff.Unkeyed != 1 {
+		t.Errorf("Expected 1 unkeyed record, got %d", diff.Unkeyed)
+	}
+
+	if !DiffRecords(shadow, shadow, "id").Equal() {
+		t.Error("Expected identical results to be equal")
+	}
+}
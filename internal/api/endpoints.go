@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// Outcomes of fetching an endpoint, the status label of etl_endpoint_fetches_total
+const (
+	EndpointSuccess    = "success"
+	EndpointFailed     = "failed"
+	EndpointUnfinished = "unfinished"
+)
+
+// Endpoint is a named source endpoint of a MultiExtractor
+type Endpoint struct {
+	Name      string
+	Extractor Extractor
+}
+
+// EndpointResult is the outcome of fetching an endpoint
+type EndpointResult struct {
+	Name    string
+	Status  string
+	Records int
+	Err     error
+}
+
+// MultiExtractor fetches several endpoints concurrently, at most parallelism at a
+// time. An endpoint that fails is logged and fetched again next cycle without
+// failing the others; an error is returned only when every endpoint failed.
+type MultiExtractor struct {
+	endpoints   []Endpoint
+	parallelism int
+	logger      *logging.Logger
+	metrics     *metrics.Metrics
+
+	mu      sync.Mutex
+	results []EndpointResult
+}
+
+// NewMultiExtractor creates an extractor of endpoints, fetching at most parallelism
+// of them at once; zero or less fetches them all at once
+func NewMultiExtractor(endpoints []Endpoint, parallelism int, logger *logging.Logger, metrics *metrics.Metrics) *MultiExtractor {
+	if parallelism <= 0 {
+		parallelism = len(endpoints)
+	}
+	return &MultiExtractor{endpoints: endpoints, parallelism: parallelism, logger: logger, metrics: metrics}
+}
+
+// Results returns the outcome of each endpoint in the last fetch, in endpoint order
+func (m *MultiExtractor) Results() []EndpointResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]EndpointResult(nil), m.results...)
+}
+
+// FetchData fetches every endpoint, returning their records in endpoint order.
+// When ctx expires, ErrPartial is returned with the records of the endpoints that
+// finished.
+func (m *MultiExtractor) FetchData(ctx context.Context) ([]map[string]interface{}, error) {
+	byEndpoint := make([][]map[string]interface{}, len(m.endpoints))
+	err := m.fetchEndpoints(ctx, func(ctx context.Context, i int, endpoint Endpoint) (int, error) {
+		data, err := endpoint.Extractor.FetchData(ctx)
+		byEndpoint[i] = data
+		return len(data), err
+	})
+	if err != nil && !errors.Is(err, ErrPartial) {
+		return nil, err
+	}
+	var merged []map[string]interface{}
+	for _, data := range byEndpoint {
+		merged = append(merged, data...)
+	}
+	return merged, err
+}
+
+// FetchStream fetches the endpoints like FetchData, calling emit with each page as
+// soon as it is fetched, concurrently from the endpoints. Endpoints that cannot
+// stream emit all their records at once.
+func (m *MultiExtractor) FetchStream(ctx context.Context, emit func(page []map[string]interface{}) error) error {
+	return m.fetchEndpoints(ctx, func(ctx context.Context, _ int, endpoint Endpoint) (int, error) {
+		if streamer, ok := endpoint.Extractor.(StreamExtractor); ok {
+			var mu sync.Mutex
+			records := 0
+			err := streamer.FetchStream(ctx, func(page []map[string]interface{}) error {
+				if err := emit(page); err != nil {
+					return err
+				}
+				mu.Lock()
+				records += len(page)
+				mu.Unlock()
+				return nil
+			})
+			return records, err
+		}
+		data, err := endpoint.Extractor.FetchData(ctx)
+		if len(data) > 0 {
+			if emitErr := emit(data); emitErr != nil {
+				return 0, emitErr
+			}
+		}
+		return len(data), err
+	})
+}
+
+// FetchRange fetches the records of [from, to) from every endpoint, failing when
+// one of them cannot select a date range
+func (m *MultiExtractor) FetchRange(ctx context.Context, from, to time.Time) ([]map[string]interface{}, error) {
+	for _, endpoint := range m.endpoints {
+		if _, ok := endpoint.Extractor.(RangeExtractor); !ok {
+			return nil, fmt.Errorf("endpoint %s cannot fetch date ranges", endpoint.Name)
+		}
+	}
+	byEndpoint := make([][]map[string]interface{}, len(m.endpoints))
+	err := m.fetchEndpoints(ctx, func(ctx context.Context, i int, endpoint Endpoint) (int, error) {
+		data, err := endpoint.Extractor.(RangeExtractor).FetchRange(ctx, from, to)
+		byEndpoint[i] = data
+		return len(data), err
+	})
+	if err != nil && !errors.Is(err, ErrPartial) {
+		return nil, err
+	}
+	var merged []map[string]interface{}
+	for _, data := range byEndpoint {
+		merged = append(merged, data...)
+	}
+	return merged, err
+}
+
+// fetchEndpoints runs fetch for every endpoint, at most parallelism at a time, and
+// records the outcome of each. fetch returns the number of records it fetched.
+// Endpoints still waiting for a turn when ctx expires are not fetched.
+func (m *MultiExtractor) fetchEndpoints(ctx context.Context, fetch func(ctx context.Context, i int, endpoint Endpoint) (int, error)) error {
+	logger := m.logger.ForContext(ctx)
+	results := make([]EndpointResult, len(m.endpoints))
+	// A failed endpoint does not stop the others, so the group is not cancelled by
+	// errors and its goroutines return none
+	var g errgroup.Group
+	g.SetLimit(m.parallelism)
+	for i, endpoint := range m.endpoints {
+		g.Go(func() error {
+			result := EndpointResult{Name: endpoint.Name}
+			if result.Err = ctx.Err(); result.Err == nil {
+				result.Records, result.Err = fetch(ctx, i, endpoint)
+			}
+			switch {
+			case result.Err != nil && (ctx.Err() != nil || errors.Is(result.Err, ErrPartial) || errors.Is(result.Err, context.Canceled)):
+				result.Status = EndpointUnfinished
+				logger.Warn(fmt.Sprintf("Endpoint %s stopped after %d records: %v", result.Name, result.Records, result.Err))
+			case result.Err != nil:
+				result.Status = EndpointFailed
+				logger.Error(fmt.Sprintf("Endpoint %s failed after %d records: %v", result.Name, result.Records, result.Err))
+			default:
+				result.Status = EndpointSuccess
+			}
+			m.metrics.EndpointFetchesTotal.WithLabelValues(result.Name, result.Status).Inc()
+			m.metrics.EndpointRecords.WithLabelValues(result.Name).Set(float64(result.Records))
+			results[i] = result
+			return nil
+		})
+	}
+	g.Wait()
+
+	total, failed, unfinished := 0, 0, 0
+	for _, result := range results {
+		switch result.Status {
+		case EndpointFailed:
+			failed++
+		case EndpointUnfinished:
+			unfinished++
+		}
+		total += result.Records
+	}
+	m.mu.Lock()
+	m.results = results
+	m.mu.Unlock()
+
+	if failed > 0 && failed == len(results) {
+		return fmt.Errorf("all %d endpoints failed, first: %w", failed, results[0].Err)
+	}
+
+	logger.Info(fmt.Sprintf("Fetched %d records from %d endpoints (%d failed, %d unfinished)", total, len(results), failed, unfinished))
+	if unfinished > 0 {
+		return fmt.Errorf("%w: %d of %d endpoints unfinished", ErrPartial, unfinished, len(results))
+	}
+	return nil
+}
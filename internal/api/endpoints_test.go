@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// fakeEndpoint returns records or an error, tracking how many fetches run at once
+type fakeEndpoint struct {
+	records []map[string]interface{}
+	err     error
+	running *concurrency
+}
+
+type concurrency struct {
+	mu      sync.Mutex
+	current int
+	peak    int
+}
+
+func (f *fakeEndpoint) FetchData(ctx context.Context) ([]map[string]interface{}, error) {
+	f.running.mu.Lock()
+	f.running.current++
+	f.running.peak = max(f.running.peak, f.running.current)
+	f.running.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	f.running.mu.Lock()
+	f.running.current--
+	f.running.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.records, nil
+}
+
+func TestMultiExtractorAggregatesEndpoints(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	running := &concurrency{}
+	record := func(id float64) []map[string]interface{} { return []map[string]interface{}{{"id": id}} }
+	extractor := NewMultiExtractor([]Endpoint{
+		{Name: "posts", Extractor: &fakeEndpoint{records: record(1), running: running}},
+		{Name: "comments", Extractor: &fakeEndpoint{err: errors.New("API returned status code: 503"), running: running}},
+		{Name: "users", Extractor: &fakeEndpoint{records: record(3), running: running}},
+		{Name: "todos", Extractor: &fakeEndpoint{records: record(4), running: running}},
+	}, 2, logger, metrics.NewMetrics())
+
+	// A failed endpoint does not fail the others
+	records, err := extractor.FetchData(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 3 || records[0]["id"] != float64(1) || records[2]["id"] != float64(4) {
+		t.Errorf("Expected the records of the healthy endpoints in order, got %v", records)
+	}
+	if running.peak > 2 {
+		t.Errorf("Expected at most 2 endpoints fetched at once, got %d", running.peak)
+	}
+
+	results := extractor.Results()
+	want := []string{EndpointSuccess, EndpointFailed, EndpointSuccess, EndpointSuccess}
+	for i, result := range results {
+		if result.Status != want[i] {
+			t.Errorf("Expected endpoint %s to be %s, got %s", result.Name, want[i], result.Status)
+		}
+	}
+	if results[1].Err == nil {
+		t.Error("Expected the failed endpoint's error in its result")
+	}
+}
+
+func TestMultiExtractorFailsWhenEveryEndpointFails(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	running := &concurrency{}
+	extractor := NewMultiExtractor([]Endpoint{
+		{Name: "posts", Extractor: &fakeEndpoint{err: errors.New("connection refused"), running: running}},
+		{Name: "users", Extractor: &fakeEndpoint{err: errors.New("connection refused"), running: running}},
+	}, 0, logger, metrics.NewMetrics())
+
+	if _, err := extractor.FetchData(context.Background()); err == nil || errors.Is(err, ErrPartial) {
+		t.Errorf("Expected the cycle to fail, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Reasons an API request fails, the reason label of etl_api_requests_failed_total
+const (
+	// ReasonRequest is a request that could not be built, e.g. from a bad URL
+	ReasonRequest = "request"
+	// ReasonTimeout is a request or response that ran out of time
+	ReasonTimeout = "timeout"
+	// ReasonCancelled is a request cancelled by its cycle, e.g. on shutdown
+	ReasonCancelled = "cancelled"
+	// ReasonConnection is a request or response lost on the network
+	ReasonConnection = "connection"
+	// ReasonRateLimited is a 429 response
+	ReasonRateLimited = "rate_limited"
+	// ReasonClientError is any other 4xx response
+	ReasonClientError = "client_error"
+	// ReasonServerError is a 5xx response
+	ReasonServerError = "server_error"
+	// ReasonUnexpectedStatus is any other response but 200
+	ReasonUnexpectedStatus = "unexpected_status"
+	// ReasonDecode is a response body that is not a JSON array of records
+	ReasonDecode = "decode"
+)
+
+// transportReason classifies an error sending a request or reading its response
+func transportReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ReasonTimeout
+	case errors.Is(err, context.Canceled):
+		return ReasonCancelled
+	}
+	return ReasonConnection
+}
+
+// statusReason classifies a response status other than 200
+func statusReason(code int) string {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return ReasonRateLimited
+	case code >= 400 && code < 500:
+		return ReasonClientError
+	case code >= 500:
+		return ReasonServerError
+	}
+	return ReasonUnexpectedStatus
+}
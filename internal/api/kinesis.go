@@ -0,0 +1,464 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// Positions a stream is first read from, the values of KinesisConfig.StartPosition
+const (
+	KinesisTrimHorizon = "trim_horizon"
+	KinesisLatest      = "latest"
+)
+
+// maxKinesisRecords is the most records GetRecords returns per call
+const maxKinesisRecords = 10000
+
+// kinesisPollInterval spaces the GetRecords calls on a shard, which allows five
+// per second
+const kinesisPollInterval = 200 * time.Millisecond
+
+// kinesisThrottleRetries is how often a throttled GetRecords call is retried
+const kinesisThrottleRetries = 3
+
+// kinesisCheckpointTimeout bounds the checkpoints saved when batches are acked,
+// which outlive the extraction
+const kinesisCheckpointTimeout = 30 * time.Second
+
+// KinesisCheckpointStore persists the sequence number the pipeline loaded each
+// shard of a stream up to. A shard read to its end after resharding is
+// checkpointed at its ending sequence number.
+type KinesisCheckpointStore interface {
+	LoadKinesisCheckpoints(ctx context.Context, stream string) (map[string]string, error)
+	SaveKinesisCheckpoint(ctx context.Context, stream, shardID, sequenceNumber string) error
+}
+
+// KinesisConfig configures the extraction of records from a Kinesis data stream
+type KinesisConfig struct {
+	Stream string
+	// Endpoint defaults to the Kinesis endpoint of Region
+	Endpoint    string
+	Region      string
+	Credentials awsauth.Credentials
+	// StartPosition is where shards are read from before the stream has any
+	// checkpoint: trim_horizon, the oldest record, or latest, the records arriving
+	// after the extractor was created
+	StartPosition string
+	// MaxRecords bounds the records read per cycle
+	MaxRecords int
+	// BatchSize is the most records read per GetRecords call
+	BatchSize int
+}
+
+// KinesisExtractor reads the records of a cycle from the shards of a Kinesis data
+// stream. Each record holds a JSON record or an array of them. The position in
+// each shard is checkpointed once the records read are durable. After resharding,
+// a shard is only read once its parents were read to their end, so the records of
+// a partition key are loaded in order.
+type KinesisExtractor struct {
+	cfg         KinesisConfig
+	checkpoints KinesisCheckpointStore
+	// started is the position of latest
+	started    time.Time
+	httpClient *http.Client
+	logger     *logging.Logger
+	metrics    *metrics.Metrics
+}
+
+// NewKinesisExtractor creates an extractor reading the stream of cfg and keeping
+// its checkpoints in checkpoints
+func NewKinesisExtractor(cfg KinesisConfig, checkpoints KinesisCheckpointStore, logger *logging.Logger, metrics *metrics.Metrics) (*KinesisExtractor, error) {
+	if cfg.Stream == "" {
+		return nil, fmt.Errorf("kinesis stream name is required")
+	}
+	if cfg.Credentials.AccessKeyID == "" || cfg.Credentials.SecretAccessKey == "" {
+		return nil, fmt.Errorf("kinesis credentials are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://kinesis." + cfg.Region + ".amazonaws.com"
+	}
+	if endpoint, err := url.Parse(cfg.Endpoint); err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid kinesis endpoint %q", cfg.Endpoint)
+	}
+	switch cfg.StartPosition {
+	case "":
+		cfg.StartPosition = KinesisTrimHorizon
+	case KinesisTrimHorizon, KinesisLatest:
+	default:
+		return nil, fmt.Errorf("invalid kinesis start position %q, expected %s or %s", cfg.StartPosition, KinesisTrimHorizon, KinesisLatest)
+	}
+	if cfg.MaxRecords <= 0 {
+		return nil, fmt.Errorf("kinesis max records must be positive")
+	}
+	if cfg.BatchSize <= 0 || cfg.BatchSize > maxKinesisRecords {
+		return nil, fmt.Errorf("kinesis batch size must be between 1 and %d", maxKinesisRecords)
+	}
+	return &KinesisExtractor{
+		cfg:         cfg,
+		checkpoints: checkpoints,
+		started:     time.Now(),
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		logger:      logger,
+		metrics:     metrics,
+	}, nil
+}
+
+// kinesisShard is a shard of the stream as listed by ListShards
+type kinesisShard struct {
+	ShardID               string `json:"ShardId"`
+	ParentShardID         string `json:"ParentShardId"`
+	AdjacentParentShardID string `json:"AdjacentParentShardId"`
+	SequenceNumberRange   struct {
+		StartingSequenceNumber string `json:"StartingSequenceNumber"`
+		// EndingSequenceNumber is set once the shard is closed by resharding
+		EndingSequenceNumber string `json:"EndingSequenceNumber"`
+	} `json:"SequenceNumberRange"`
+}
+
+// kinesisRecord is a record returned by GetRecords; Data is base64 in JSON
+type kinesisRecord struct {
+	SequenceNumber string `json:"SequenceNumber"`
+	PartitionKey   string `json:"PartitionKey"`
+	Data           []byte `json:"Data"`
+}
+
+// FetchBatches reads up to MaxRecords records and hands out the records of each
+// GetRecords call as a batch. Acking a batch checkpoints its shard once every
+// earlier batch of the shard was acked; a nacked batch keeps the checkpoint where
+// it is, so the next cycle reads the shard again from there. A shard is read until
+// it is caught up or closed.
+func (k *KinesisExtractor) FetchBatches(ctx context.Context, emit func(batch *Batch) error) error {
+	logger := k.logger.ForContext(ctx)
+	start := time.Now()
+	checkpoints, err := k.checkpoints.LoadKinesisCheckpoints(ctx, k.cfg.Stream)
+	if err != nil {
+		return fmt.Errorf("failed to load kinesis checkpoints: %w", err)
+	}
+	shards, err := k.listShards(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Kinesis ListShards failed: %v", err))
+		return err
+	}
+
+	// Shards no longer listed expired with the retention period of the stream
+	listed := make(map[string]bool, len(shards))
+	finished := make(map[string]bool)
+	for _, shard := range shards {
+		listed[shard.ShardID] = true
+		if ending := shard.SequenceNumberRange.EndingSequenceNumber; ending != "" && checkpoints[shard.ShardID] == ending {
+			finished[shard.ShardID] = true
+		}
+	}
+	parentsFinished := func(shard kinesisShard) bool {
+		for _, parent := range []string{shard.ParentShardID, shard.AdjacentParentShardID} {
+			if parent != "" && listed[parent] && !finished[parent] {
+				return false
+			}
+		}
+		return true
+	}
+
+	var pending []kinesisShard
+	for _, shard := range shards {
+		if !finished[shard.ShardID] {
+			pending = append(pending, shard)
+		}
+	}
+	read := 0
+	// Reading a parent to its end makes its children readable in the same cycle
+	for progress := true; progress && len(pending) > 0 && read < k.cfg.MaxRecords; {
+		progress = false
+		var waiting []kinesisShard
+		for _, shard := range pending {
+			if !parentsFinished(shard) || read >= k.cfg.MaxRecords {
+				waiting = append(waiting, shard)
+				continue
+			}
+			progress = true
+			records, closed, err := k.readShard(ctx, logger, shard, checkpoints, k.cfg.MaxRecords-read, emit)
+			read += records
+			if err != nil {
+				if read > 0 && ctx.Err() != nil {
+					return fmt.Errorf("%w: %v", ErrPartial, err)
+				}
+				logger.Error(fmt.Sprintf("Kinesis read of shard %s failed: %v", shard.ShardID, err))
+				return err
+			}
+			if closed {
+				finished[shard.ShardID] = true
+			}
+		}
+		pending = waiting
+	}
+	logger.Info(fmt.Sprintf("Kinesis read successful: %d records from %d shards of %s in %.2fs", read, len(shards), k.cfg.Stream, time.Since(start).Seconds()))
+	return nil
+}
+
+// readShard reads up to limit records of a shard from its checkpoint, handing out
+// a batch per GetRecords call, and reports whether the shard was read to its end
+func (k *KinesisExtractor) readShard(ctx context.Context, logger *logging.Logger, shard kinesisShard, checkpoints map[string]string, limit int, emit func(batch *Batch) error) (int, bool, error) {
+	iterator, err := k.shardIterator(ctx, shard, checkpoints)
+	if err != nil {
+		return 0, false, err
+	}
+	progress := &kinesisProgress{stream: k.cfg.Stream, shardID: shard.ShardID, store: k.checkpoints}
+	read := 0
+	for {
+		response, err := k.getRecords(ctx, iterator, min(k.cfg.BatchSize, limit-read))
+		if err != nil {
+			return read, false, err
+		}
+		k.metrics.KinesisMillisBehind.WithLabelValues(shard.ShardID).Set(float64(response.MillisBehindLatest))
+		read += len(response.Records)
+		k.metrics.KinesisRecordsTotal.WithLabelValues("received").Add(float64(len(response.Records)))
+
+		// A closed shard hands out no iterator past its last records
+		closed := response.NextShardIterator == ""
+		if len(response.Records) > 0 || closed {
+			sequence := shard.SequenceNumberRange.EndingSequenceNumber
+			if !closed {
+				sequence = response.Records[len(response.Records)-1].SequenceNumber
+			}
+			if err := emit(k.batch(logger, shard.ShardID, response.Records, progress, sequence)); err != nil {
+				return read, false, err
+			}
+		}
+		if closed {
+			k.metrics.KinesisMillisBehind.DeleteLabelValues(shard.ShardID)
+			logger.Info(fmt.Sprintf("Kinesis shard %s was read to its end", shard.ShardID))
+			return read, true, nil
+		}
+		if (len(response.Records) == 0 && response.MillisBehindLatest == 0) || read >= limit {
+			return read, false, nil
+		}
+		iterator = response.NextShardIterator
+		select {
+		case <-ctx.Done():
+			return read, false, ctx.Err()
+		case <-time.After(kinesisPollInterval):
+		}
+	}
+}
+
+// shardIterator returns the iterator reading a shard after its checkpoint. Shards
+// without one are read from StartPosition before the stream has any checkpoint,
+// and from their oldest record once it has, e.g. the children of a resharding.
+func (k *KinesisExtractor) shardIterator(ctx context.Context, shard kinesisShard, checkpoints map[string]string) (string, error) {
+	request := map[string]interface{}{"StreamName": k.cfg.Stream, "ShardId": shard.ShardID}
+	switch sequence := checkpoints[shard.ShardID]; {
+	case sequence != "":
+		request["ShardIteratorType"] = "AFTER_SEQUENCE_NUMBER"
+		request["StartingSequenceNumber"] = sequence
+	case len(checkpoints) == 0 && k.cfg.StartPosition == KinesisLatest:
+		// Until the first checkpoint, latest stays at the time the extractor was
+		// created so records arriving between cycles are not skipped
+		request["ShardIteratorType"] = "AT_TIMESTAMP"
+		request["Timestamp"] = float64(k.started.UnixMilli()) / 1000
+	default:
+		request["ShardIteratorType"] = "TRIM_HORIZON"
+	}
+	var response struct {
+		ShardIterator string `json:"ShardIterator"`
+	}
+	if err := k.call(ctx, "GetShardIterator", request, &response); err != nil {
+		return "", err
+	}
+	return response.ShardIterator, nil
+}
+
+// kinesisRecordsResponse is the response of GetRecords
+type kinesisRecordsResponse struct {
+	Records []kinesisRecord `json:"Records"`
+	// NextShardIterator is empty once a closed shard was read to its end
+	NextShardIterator  string `json:"NextShardIterator"`
+	MillisBehindLatest int64  `json:"MillisBehindLatest"`
+}
+
+// getRecords reads up to limit records at iterator, waiting for throttled calls
+func (k *KinesisExtractor) getRecords(ctx context.Context, iterator string, limit int) (*kinesisRecordsResponse, error) {
+	var response kinesisRecordsResponse
+	for attempt := 0; ; attempt++ {
+		err := k.call(ctx, "GetRecords", map[string]interface{}{"ShardIterator": iterator, "Limit": limit}, &response)
+		var failure *kinesisError
+		if err == nil || attempt == kinesisThrottleRetries || !errors.As(err, &failure) || failure.Type != "ProvisionedThroughputExceededException" {
+			return &response, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(time.Duration(attempt+1) * time.Second):
+		}
+	}
+}
+
+// batch creates the batch of the records of a GetRecords call, checkpointing the
+// shard at sequence once it and the batches before it are acked. Records that are
+// not JSON records are logged and skipped.
+func (k *KinesisExtractor) batch(logger *logging.Logger, shardID string, received []kinesisRecord, progress *kinesisProgress, sequence string) *Batch {
+	var records []map[string]interface{}
+	var payloads []json.RawMessage
+	for _, record := range received {
+		recordRecords, recordPayloads, err := decodeJSONRecords(string(record.Data))
+		if err != nil {
+			k.metrics.KinesisRecordsTotal.WithLabelValues("skipped").Inc()
+			logger.Warn(fmt.Sprintf("Skipped Kinesis record %s of shard %s: %v", record.SequenceNumber, shardID, err))
+			continue
+		}
+		records = append(records, recordRecords...)
+		payloads = append(payloads, recordPayloads...)
+	}
+	index := progress.add(sequence)
+	// Nacked batches are never acked, which holds the checkpoint before them
+	return NewBatch(records, payloads, func() error {
+		return progress.ack(index)
+	}, nil)
+}
+
+// kinesisProgress checkpoints a shard as the batches read from it are acked, in
+// the order they were read: the checkpoint only moves past a batch once it and
+// every batch before it were acked
+type kinesisProgress struct {
+	stream  string
+	shardID string
+	store   KinesisCheckpointStore
+
+	mu        sync.Mutex
+	sequences []string
+	acked     []bool
+	committed int
+}
+
+// add tracks a batch reading the shard up to sequence and returns its index
+func (p *kinesisProgress) add(sequence string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sequences = append(p.sequences, sequence)
+	p.acked = append(p.acked, false)
+	return len(p.sequences) - 1
+}
+
+// ack marks a batch durable and saves the checkpoint of the batches acked in order
+func (p *kinesisProgress) ack(index int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.acked[index] = true
+	committed := p.committed
+	for committed < len(p.acked) && p.acked[committed] {
+		committed++
+	}
+	if committed == p.committed {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kinesisCheckpointTimeout)
+	defer cancel()
+	if err := p.store.SaveKinesisCheckpoint(ctx, p.stream, p.shardID, p.sequences[committed-1]); err != nil {
+		return fmt.Errorf("failed to checkpoint kinesis shard %s: %w", p.shardID, err)
+	}
+	p.committed = committed
+	return nil
+}
+
+// listShards lists the shards of the stream, open and closed
+func (k *KinesisExtractor) listShards(ctx context.Context) ([]kinesisShard, error) {
+	var shards []kinesisShard
+	request := map[string]interface{}{"StreamName": k.cfg.Stream}
+	for {
+		var response struct {
+			Shards    []kinesisShard `json:"Shards"`
+			NextToken string         `json:"NextToken"`
+		}
+		if err := k.call(ctx, "ListShards", request, &response); err != nil {
+			return nil, err
+		}
+		shards = append(shards, response.Shards...)
+		if response.NextToken == "" {
+			return shards, nil
+		}
+		// Later pages are selected by the token alone
+		request = map[string]interface{}{"NextToken": response.NextToken}
+	}
+}
+
+// FetchData reads the records of a cycle without checkpointing them, e.g. for
+// previews: the next cycle reads them again
+func (k *KinesisExtractor) FetchData(ctx context.Context) ([]map[string]interface{}, error) {
+	var records []map[string]interface{}
+	err := k.FetchBatches(ctx, func(batch *Batch) error {
+		records = append(records, batch.Records...)
+		return nil
+	})
+	return records, err
+}
+
+// Ping checks that the stream exists and can be read with the credentials
+func (k *KinesisExtractor) Ping(ctx context.Context) error {
+	return k.call(ctx, "DescribeStreamSummary", map[string]interface{}{"StreamName": k.cfg.Stream}, nil)
+}
+
+// kinesisError is an error response of Kinesis
+type kinesisError struct {
+	Action  string
+	Status  int
+	Type    string
+	Message string
+}
+
+func (e *kinesisError) Error() string {
+	return fmt.Sprintf("kinesis %s returned status %d: %s: %s", e.Action, e.Status, e.Type, e.Message)
+}
+
+// call sends a signed request of the Kinesis JSON protocol and decodes its
+// response into response, if given
+func (k *KinesisExtractor) call(ctx context.Context, action string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode kinesis %s request: %w", action, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create kinesis request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "Kinesis_20131202."+action)
+	awsauth.Sign(req, k.cfg.Credentials, k.cfg.Region, "kinesis", awsauth.PayloadHash(body), time.Now())
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("kinesis %s request failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		content, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(content, &failure) == nil && failure.Type != "" {
+			return &kinesisError{Action: action, Status: resp.StatusCode, Type: failure.Type[strings.LastIndex(failure.Type, "#")+1:], Message: failure.Message}
+		}
+		return fmt.Errorf("kinesis %s returned status %d: %s", action, resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+	if response == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode kinesis %s response: %w", action, err)
+	}
+	return nil
+}
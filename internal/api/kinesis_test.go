@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// fakeKinesis serves the Kinesis JSON protocol for a stream of shards, whose
+// records are read through iterators of the form shard/index
+type fakeKinesis struct {
+	shards  []kinesisShard
+	records map[string][]kinesisRecord
+}
+
+func (f *fakeKinesis) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var request struct {
+		ShardID                string `json:"ShardId"`
+		ShardIteratorType      string
+		StartingSequenceNumber string
+		ShardIterator          string
+		Limit                  int
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "Kinesis_20131202.") {
+	case "ListShards":
+		json.NewEncoder(w).Encode(map[string]interface{}{"Shards": f.shards})
+	case "GetShardIterator":
+		index := 0
+		if request.ShardIteratorType == "AFTER_SEQUENCE_NUMBER" {
+			for i, record := range f.records[request.ShardID] {
+				if record.SequenceNumber == request.StartingSequenceNumber {
+					index = i + 1
+				}
+			}
+			if index == 0 {
+				index = len(f.records[request.ShardID])
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]string{"ShardIterator": fmt.Sprintf("%s/%d", request.ShardID, index)})
+	case "GetRecords":
+		shardID, position, _ := strings.Cut(request.ShardIterator, "/")
+		index, _ := strconv.Atoi(position)
+		records := f.records[shardID][index:]
+		if len(records) > request.Limit {
+			records = records[:request.Limit]
+		}
+		next := fmt.Sprintf("%s/%d", shardID, index+len(records))
+		for _, shard := range f.shards {
+			if shard.ShardID == shardID && shard.SequenceNumberRange.EndingSequenceNumber != "" && index+len(records) == len(f.records[shardID]) {
+				next = ""
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Records": records, "NextShardIterator": next, "MillisBehindLatest": 0})
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// memoryCheckpoints keeps Kinesis checkpoints in memory
+type memoryCheckpoints struct {
+	mu          sync.Mutex
+	checkpoints map[string]string
+}
+
+func (m *memoryCheckpoints) LoadKinesisCheckpoints(context.Context, string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	checkpoints := make(map[string]string, len(m.checkpoints))
+	for shardID, sequence := range m.checkpoints {
+		checkpoints[shardID] = sequence
+	}
+	return checkpoints, nil
+}
+
+func (m *memoryCheckpoints) SaveKinesisCheckpoint(_ context.Context, _, shardID, sequenceNumber string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpoints[shardID] = sequenceNumber
+	return nil
+}
+
+func kinesisShardOf(id, parent, ending string) kinesisShard {
+	shard := kinesisShard{ShardID: id, ParentShardID: parent}
+	shard.SequenceNumberRange.EndingSequenceNumber = ending
+	return shard
+}
+
+func TestKinesisExtractorReadsParentsFirst(t *testing.T) {
+	stream := &fakeKinesis{
+		// The child is listed first; it must still wait for its closed parent
+		shards: []kinesisShard{kinesisShardOf("child", "parent", ""), kinesisShardOf("parent", "", "199")},
+		records: map[string][]kinesisRecord{
+			"parent": {{SequenceNumber: "101", Data: []byte(`{"id": 1}`)}, {SequenceNumber: "102", Data: []byte(`[{"id": 2}, {"id": 3}]`)}},
+			"child":  {{SequenceNumber: "201", Data: []byte(`not json`)}, {SequenceNumber: "202", Data: []byte(`{"id": 4}`)}},
+		},
+	}
+	server := httptest.NewServer(stream)
+	defer server.Close()
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+	checkpoints := &memoryCheckpoints{checkpoints: map[string]string{}}
+
+	extractor, err := NewKinesisExtractor(KinesisConfig{
+		Stream:      "events",
+		Endpoint:    server.URL,
+		Credentials: awsauth.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"},
+		MaxRecords:  100,
+		BatchSize:   100,
+	}, checkpoints, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewKinesisExtractor: %v", err)
+	}
+
+	var ids []float64
+	var batches []*Batch
+	if err := extractor.FetchBatches(context.Background(), func(batch *Batch) error {
+		batches = append(batches, batch)
+		for _, record := range batch.Records {
+			ids = append(ids, record["id"].(float64))
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("FetchBatches: %v", err)
+	}
+	if fmt.Sprint(ids) != "[1 2 3 4]" {
+		t.Fatalf("Expected the parent's records before the child's, got %v", ids)
+	}
+	if len(checkpoints.checkpoints) != 0 {
+		t.Fatalf("Expected no checkpoint before the batches are acked, got %v", checkpoints.checkpoints)
+	}
+	for _, batch := range batches {
+		if err := batch.Ack(); err != nil {
+			t.Fatalf("Ack: %v", err)
+		}
+	}
+	// The closed parent is checkpointed at its end, the child after the last record
+	if checkpoints.checkpoints["parent"] != "199" || checkpoints.checkpoints["child"] != "202" {
+		t.Fatalf("Expected both shards checkpointed, got %v", checkpoints.checkpoints)
+	}
+
+	records, err := extractor.FetchData(context.Background())
+	if err != nil || len(records) != 0 {
+		t.Errorf("Expected nothing new after the checkpoints, got %v: %v", records, err)
+	}
+}
+
+func TestKinesisProgressCheckpointsInOrder(t *testing.T) {
+	checkpoints := &memoryCheckpoints{checkpoints: map[string]string{}}
+	progress := &kinesisProgress{stream: "events", shardID: "shard", store: checkpoints}
+	first, second, third, fourth := progress.add("1"), progress.add("2"), progress.add("3"), progress.add("4")
+
+	if err := progress.ack(second); err != nil || len(checkpoints.checkpoints) != 0 {
+		t.Fatalf("Expected no checkpoint past a batch not acked, got %v: %v", checkpoints.checkpoints, err)
+	}
+	if err := progress.ack(first); err != nil || checkpoints.checkpoints["shard"] != "2" {
+		t.Fatalf("Expected the checkpoint at the second batch, got %v: %v", checkpoints.checkpoints, err)
+	}
+	// The third batch is nacked, i.e. never acked, so the shard is read again from
+	// there next cycle
+	if err := progress.ack(fourth); err != nil || checkpoints.checkpoints["shard"] != "2" {
+		t.Errorf("Expected the checkpoint to stay before batch %d, got %v: %v", third, checkpoints.checkpoints, err)
+	}
+}
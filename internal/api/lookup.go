@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+	"github.com/mohammedhassan/etl-pipeline/internal/tracing"
+)
+
+// Lookup performs a GET request against url and decodes the JSON object of the
+// response, e.g. the reference record enriching extracted ones. found is false
+// when the API answers 404 Not Found.
+func (c *Client) Lookup(ctx context.Context, url string) (record map[string]interface{}, found bool, err error) {
+	ctx, span := tracing.Start(ctx, "api.lookup", attribute.String("http.url", url))
+	defer func() { tracing.End(span, err) }()
+	start := time.Now()
+	c.metrics.APIRequestsTotal.Inc()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		c.metrics.APIRequestsFailedTotal.WithLabelValues(ReasonRequest).Inc()
+		return nil, false, fmt.Errorf("failed to create request: %w", err)
+	}
+	if token := c.token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if id := runid.FromContext(ctx); id != "" {
+		req.Header.Set(runid.HTTPHeader, id)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.metrics.APIRequestsFailedTotal.WithLabelValues(transportReason(err)).Inc()
+		return nil, false, fmt.Errorf("failed to look up %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	c.metrics.APIRequestDuration.Observe(time.Since(start).Seconds())
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, false, nil
+	default:
+		c.metrics.APIRequestsFailedTotal.WithLabelValues(statusReason(resp.StatusCode)).Inc()
+		return nil, false, fmt.Errorf("lookup of %s returned status code: %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		c.metrics.APIRequestsFailedTotal.WithLabelValues(ReasonDecode).Inc()
+		return nil, false, fmt.Errorf("failed to unmarshal lookup of %s: %w", url, err)
+	}
+	return record, true, nil
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestLookup(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/users/1":
+			w.Write([]byte(`{"id": 1, "name": "Leanne Graham"}`))
+		case "/users/2":
+			http.NotFound(w, r)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL+"/posts", "secret", logger, metrics.NewMetrics())
+
+	record, found, err := client.Lookup(context.Background(), server.URL+"/users/1")
+	if err != nil || !found || record["name"] != "Leanne Graham" {
+		t.Errorf("Expected the reference record, got %v, %v, %v", record, found, err)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("Expected the API token to be sent, got %q", auth)
+	}
+	if record, found, err := client.Lookup(context.Background(), server.URL+"/users/2"); err != nil || found || record != nil {
+		t.Errorf("Expected a missing record not to be found, got %v, %v, %v", record, found, err)
+	}
+	if _, _, err := client.Lookup(context.Background(), server.URL+"/users/3"); err == nil {
+		t.Error("Expected an error status to fail the lookup")
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+)
+
+// Reasons a response body is quarantined, the reason label of
+// etl_quarantined_payloads_total
+const (
+	// QuarantineMalformed is a body that is not valid JSON, or cut short
+	QuarantineMalformed = "malformed"
+	// QuarantineShape is valid JSON that is not an array of record objects
+	QuarantineShape = "shape"
+)
+
+// QuarantineStore keeps response bodies that could not be parsed, with metadata
+// describing the request, returning where the body was stored
+type QuarantineStore interface {
+	SaveQuarantine(ctx context.Context, body []byte, metadata map[string]string) (string, error)
+}
+
+// SetQuarantine saves response bodies that cannot be decoded to store, up to
+// maxBytes of each, instead of failing the request. The pages emitted before the
+// body went wrong are kept and the records of the rest of the body are skipped.
+func (c *Client) SetQuarantine(store QuarantineStore, maxBytes int) {
+	c.quarantine = store
+	c.quarantineMax = maxBytes
+}
+
+// quarantineReason classifies an error decoding a response body
+func quarantineReason(err error) string {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return QuarantineMalformed
+	}
+	return QuarantineShape
+}
+
+// saveQuarantine reads the rest of a body that failed to decode into captured and
+// saves it with the request it answered
+func (c *Client) saveQuarantine(ctx context.Context, url string, resp *http.Response, captured *cappedBuffer, records int, decodeErr error) (string, error) {
+	captured.fill(resp.Body)
+	metadata := map[string]string{
+		"url":             url,
+		"status":          strconv.Itoa(resp.StatusCode),
+		"content_type":    resp.Header.Get("Content-Type"),
+		"error":           decodeErr.Error(),
+		"reason":          quarantineReason(decodeErr),
+		"fetched_at":      time.Now().UTC().Format(time.RFC3339Nano),
+		"records_decoded": strconv.Itoa(records),
+		"truncated":       strconv.FormatBool(captured.truncated),
+	}
+	if id := runid.FromContext(ctx); id != "" {
+		metadata["run_id"] = id
+	}
+	return c.quarantine.SaveQuarantine(ctx, captured.buf.Bytes(), metadata)
+}
+
+// cappedBuffer keeps the first max bytes written to it, discarding the rest
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// fill reads the rest of r until the buffer is full, noting whether more was left
+func (b *cappedBuffer) fill(r io.Reader) {
+	if b.truncated {
+		return
+	}
+	io.CopyN(b, r, int64(b.max-b.buf.Len())+1)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// RequestVars are the variables a request body template is rendered with
+type RequestVars struct {
+	// From and To are the first and last instant of a backfilled date range,
+	// formatted with the layout of RangeParams, or empty outside of backfills
+	From string
+	To   string
+	// FromID and ToID are the inclusive id range of a sharded extraction page, or
+	// zero outside of sharded extraction
+	FromID int64
+	ToID   int64
+	// Now is the time the request is made, in UTC
+	Now time.Time
+}
+
+// requestFuncs are the functions of request body templates
+var requestFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. {{json .From}} for a quoted string
+	"json": func(v interface{}) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+}
+
+// ParseRequestBody parses a text/template rendering the JSON body of requests from
+// RequestVars, e.g. {"filter": {"since": {{json .From}}}}
+func ParseRequestBody(text string) (*template.Template, error) {
+	tmpl, err := template.New("request body").Funcs(requestFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request body template: %w", err)
+	}
+	// Unknown variables only show when the template is rendered
+	if err := tmpl.Execute(io.Discard, RequestVars{}); err != nil {
+		return nil, fmt.Errorf("invalid request body template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// SetRequest sends requests with method, GET by default, and a JSON body rendered
+// from body, if set, for every request
+func (c *Client) SetRequest(method string, body *template.Template) {
+	c.method = strings.ToUpper(method)
+	c.body = body
+}
+
+// newRequest creates the request of url, rendering its body from vars
+func (c *Client) newRequest(ctx context.Context, url string, vars RequestVars) (*http.Request, error) {
+	method := c.method
+	if method == "" {
+		method = http.MethodGet
+	}
+	if c.body == nil {
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		return req, nil
+	}
+
+	vars.Now = time.Now().UTC()
+	var body bytes.Buffer
+	if err := c.body.Execute(&body, vars); err != nil {
+		return nil, fmt.Errorf("failed to render request body: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
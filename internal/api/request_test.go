@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestRequestBody(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	var method, contentType, query string
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, contentType, query = r.Method, r.Header.Get("Content-Type"), r.URL.RawQuery
+		content, _ := io.ReadAll(r.Body)
+		body = nil
+		json.Unmarshal(content, &body)
+		w.Write([]byte(`[{"id": 1}]`))
+	}))
+	defer server.Close()
+
+	if _, err := ParseRequestBody(`{"since": {{json .Since}}}`); err == nil {
+		t.Error("Expected an unknown variable refused")
+	}
+	tmpl, err := ParseRequestBody(`{"filter": {"from": {{json .From}}, "to": {{json .To}}, "ids": [{{.FromID}}, {{.ToID}}]}}`)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	client := NewClient(server.URL, "", logger, metrics.NewMetrics())
+	client.SetRequest("post", tmpl)
+	client.SetRangeParams(RangeParams{Layout: "2006-01-02"})
+
+	// Backfills select the range through the body alone without range parameters
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := client.FetchRange(context.Background(), from, from.AddDate(0, 0, 1)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if method != http.MethodPost || contentType != "application/json" || query != "" {
+		t.Errorf("Expected a JSON POST without query, got %s %q %q", method, contentType, query)
+	}
+	filter, _ := body["filter"].(map[string]interface{})
+	if filter["from"] != "2023-01-01" || filter["to"] != "2023-01-01" {
+		t.Errorf("Expected the backfill range in the body, got %v", body)
+	}
+
+	if _, err := client.fetch(context.Background(), server.URL, RequestVars{FromID: 101, ToID: 200}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	filter, _ = body["filter"].(map[string]interface{})
+	if ids, _ := filter["ids"].([]interface{}); len(ids) != 2 || ids[0] != 101.0 || ids[1] != 200.0 {
+		t.Errorf("Expected the shard range in the body, got %v", body)
+	}
+}
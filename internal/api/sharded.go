@@ -0,0 +1,403 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// ShardConfig describes how an id keyspace is split into concurrently fetched shards
+type ShardConfig struct {
+	// IDField is the record field holding the numeric id
+	IDField string
+	// MinID and MaxID bound the keyspace that is split into Shards ranges.
+	// The last shard is open-ended so ids created after MaxID are still picked up.
+	MinID  int64
+	MaxID  int64
+	Shards int
+	// PageSize is the width of the id window requested per call
+	PageSize int64
+	// FromParam and ToParam are the inclusive range query parameters
+	FromParam string
+	ToParam   string
+}
+
+// WatermarkStore persists the highest id loaded per shard
+type WatermarkStore interface {
+	LoadWatermarks(ctx context.Context, source string) (map[int64]int64, error)
+	SaveWatermark(ctx context.Context, source string, shardStart, watermark int64) error
+}
+
+// ShardCoordinator hands out disjoint shards of a source to the instances
+// extracting it, through leases expiring after ttl
+type ShardCoordinator interface {
+	ClaimShards(ctx context.Context, source, owner string, shardStarts []int64, ttl time.Duration) ([]int64, error)
+	// HeldShards returns the starts of the shards owner holds an unexpired lease on
+	HeldShards(ctx context.Context, source, owner string) ([]int64, error)
+	ReleaseShards(source, owner string) error
+}
+
+// Committer is implemented by extractors that track progress which should only be
+// persisted once the extracted records have been stored
+type Committer interface {
+	Commit() error
+}
+
+// Shard is one contiguous range of the keyspace. End is 0 for the open-ended last shard.
+type Shard struct {
+	Start int64
+	End   int64
+}
+
+// ShardedExtractor fetches an id-range API as concurrent shards and merges the results
+type ShardedExtractor struct {
+	client  *Client
+	cfg     ShardConfig
+	shards  []Shard
+	store   WatermarkStore
+	logger  *logging.Logger
+	metrics *metrics.Metrics
+
+	// coordinator, if set, limits each cycle to the shards owner holds a lease on
+	coordinator ShardCoordinator
+	owner       string
+	leaseTTL    time.Duration
+
+	mu      sync.Mutex
+	pending map[int64]int64
+}
+
+// NewShardedExtractor creates a sharded extractor on top of an API client
+func NewShardedExtractor(client *Client, cfg ShardConfig, store WatermarkStore, logger *logging.Logger, metrics *metrics.Metrics) (*ShardedExtractor, error) {
+	if cfg.Shards < 1 {
+		return nil, fmt.Errorf("shard count must be at least 1")
+	}
+	if cfg.MaxID < cfg.MinID {
+		return nil, fmt.Errorf("max id %d is below min id %d", cfg.MaxID, cfg.MinID)
+	}
+	if cfg.PageSize < 1 {
+		return nil, fmt.Errorf("page size must be at least 1")
+	}
+
+	return &ShardedExtractor{
+		client:  client,
+		cfg:     cfg,
+		shards:  SplitKeyspace(cfg.MinID, cfg.MaxID, cfg.Shards),
+		store:   store,
+		logger:  logger,
+		metrics: metrics,
+		pending: make(map[int64]int64),
+	}, nil
+}
+
+// SetCoordinator shares the shards with other instances: each cycle only fetches the
+// shards owner claimed through coordinator, holding them for ttl
+func (s *ShardedExtractor) SetCoordinator(coordinator ShardCoordinator, owner string, ttl time.Duration) {
+	s.coordinator = coordinator
+	s.owner = owner
+	s.leaseTTL = ttl
+}
+
+// Release gives up the shards claimed by this instance
+func (s *ShardedExtractor) Release() error {
+	if s.coordinator == nil {
+		return nil
+	}
+	return s.coordinator.ReleaseShards(s.client.baseURL, s.owner)
+}
+
+// claimedShards returns the shards to fetch this cycle: all of them, or those
+// claimed through the coordinator
+func (s *ShardedExtractor) claimedShards(ctx context.Context) ([]Shard, error) {
+	if s.coordinator == nil {
+		return s.shards, nil
+	}
+	starts := make([]int64, len(s.shards))
+	for i, shard := range s.shards {
+		starts[i] = shard.Start
+	}
+	claimed, err := s.coordinator.ClaimShards(ctx, s.client.baseURL, s.owner, starts, s.leaseTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim shards: %w", err)
+	}
+	held := make(map[int64]bool, len(claimed))
+	for _, start := range claimed {
+		held[start] = true
+	}
+	var shards []Shard
+	for _, shard := range s.shards {
+		if held[shard.Start] {
+			shards = append(shards, shard)
+		}
+	}
+	s.metrics.ShardsClaimed.Set(float64(len(shards)))
+	return shards, nil
+}
+
+// SplitKeyspace divides [minID, maxID] into n contiguous shards, leaving the last one open-ended.
+// The shards are ranges rather than hash partitions of the ids because the source
+// only serves ranges: a hash shard would have to page through the whole keyspace.
+func SplitKeyspace(minID, maxID int64, n int) []Shard {
+	size := (maxID - minID + 1) / int64(n)
+	if size < 1 {
+		size = 1
+	}
+
+	shards := make([]Shard, 0, n)
+	start := minID
+	for i := 0; i < n; i++ {
+		end := start + size - 1
+		if i == n-1 || end >= maxID {
+			shards = append(shards, Shard{Start: start, End: 0})
+			break
+		}
+		shards = append(shards, Shard{Start: start, End: end})
+		start = end + 1
+	}
+	return shards
+}
+
+// FetchData fetches every shard concurrently, or the shards claimed through the
+// coordinator, resuming each one from its watermark.
+// Shards that fail are logged and retried on the next cycle; an error is returned
+// only when no shard succeeded. When ctx expires, shards stop at the last complete
+// page and ErrPartial is returned with the records fetched so far.
+func (s *ShardedExtractor) FetchData(ctx context.Context) ([]map[string]interface{}, error) {
+	var mu sync.Mutex
+	byShard := make(map[int][]map[string]interface{})
+	shards, err := s.fetchShards(ctx, func(shard int, page []map[string]interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		byShard[shard] = append(byShard[shard], page...)
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrPartial) {
+		return nil, err
+	}
+	var merged []map[string]interface{}
+	for i := 0; i < shards; i++ {
+		merged = append(merged, byShard[i]...)
+	}
+	return merged, err
+}
+
+// FetchStream fetches the shards like FetchData, calling emit with each page as
+// soon as it is fetched, concurrently from the shards. A shard stops when emit
+// fails and its watermark only covers the pages emitted.
+func (s *ShardedExtractor) FetchStream(ctx context.Context, emit func(page []map[string]interface{}) error) error {
+	_, err := s.fetchShards(ctx, func(_ int, page []map[string]interface{}) error {
+		return emit(page)
+	})
+	return err
+}
+
+// fetchShards fetches the claimed shards concurrently, calling emit with each page
+// and the index of its shard, and returns the number of shards
+func (s *ShardedExtractor) fetchShards(ctx context.Context, emit func(shard int, page []map[string]interface{}) error) (int, error) {
+	logger := s.logger.ForContext(ctx)
+	// Watermarks of an earlier cycle that were never committed belong to a load
+	// that failed; the shards are fetched again from their stored watermarks
+	s.mu.Lock()
+	clear(s.pending)
+	s.mu.Unlock()
+	shards, err := s.claimedShards(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(shards) == 0 {
+		logger.Info("No shards claimed, other instances hold all of them")
+		return 0, nil
+	}
+	watermarks, err := s.store.LoadWatermarks(ctx, s.client.baseURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load shard watermarks: %w", err)
+	}
+
+	type shardResult struct {
+		records   int
+		watermark int64
+		err       error
+	}
+
+	results := make([]shardResult, len(shards))
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		watermark, ok := watermarks[shard.Start]
+		if !ok {
+			watermark = shard.Start - 1
+		}
+
+		wg.Add(1)
+		go func(i int, shard Shard, watermark int64) {
+			defer wg.Done()
+			records, newWatermark, err := s.fetchShard(ctx, shard, watermark, func(page []map[string]interface{}) error {
+				return emit(i, page)
+			})
+			results[i] = shardResult{records: records, watermark: newWatermark, err: err}
+		}(i, shard, watermark)
+	}
+	wg.Wait()
+
+	total, failed, unfinished := 0, 0, 0
+	s.mu.Lock()
+	for i, result := range results {
+		shard := shards[i]
+		switch {
+		case result.err != nil && (ctx.Err() != nil || errors.Is(result.err, context.Canceled)):
+			unfinished++
+			logger.Warn(fmt.Sprintf("Shard starting at id %d stopped at id %d after %d records: %v", shard.Start, result.watermark, result.records, result.err))
+		case result.err != nil:
+			failed++
+			logger.Error(fmt.Sprintf("Shard starting at id %d failed after %d records: %v", shard.Start, result.records, result.err))
+		}
+		total += result.records
+		s.pending[shard.Start] = result.watermark
+	}
+	s.mu.Unlock()
+
+	if failed == len(shards) {
+		return len(shards), fmt.Errorf("all %d shards failed", failed)
+	}
+
+	logger.Info(fmt.Sprintf("Sharded extraction fetched %d records from %d shards (%d failed, %d unfinished)", total, len(shards), failed, unfinished))
+	if unfinished > 0 {
+		return len(shards), fmt.Errorf("%w: %d of %d shards unfinished", ErrPartial, unfinished, len(shards))
+	}
+	return len(shards), nil
+}
+
+// Commit persists the watermarks reached by the last FetchData call. It should be
+// called once the fetched records have been stored, so a failed load is refetched.
+// With a coordinator, shards whose lease passed to another instance are skipped,
+// as their watermark belongs to the new owner now.
+func (s *ShardedExtractor) Commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.coordinator != nil && len(s.pending) > 0 {
+		held, err := s.coordinator.HeldShards(context.Background(), s.client.baseURL, s.owner)
+		if err != nil {
+			return fmt.Errorf("failed to check shard leases: %w", err)
+		}
+		holding := make(map[int64]bool, len(held))
+		for _, start := range held {
+			holding[start] = true
+		}
+		for shardStart, watermark := range s.pending {
+			if !holding[shardStart] {
+				s.logger.Warn(fmt.Sprintf("Lease on shard starting at id %d was lost, not saving its watermark %d", shardStart, watermark))
+				delete(s.pending, shardStart)
+			}
+		}
+	}
+	for shardStart, watermark := range s.pending {
+		if err := s.store.SaveWatermark(context.Background(), s.client.baseURL, shardStart, watermark); err != nil {
+			return fmt.Errorf("failed to save watermark for shard %d: %w", shardStart, err)
+		}
+		s.metrics.ShardWatermark.WithLabelValues(strconv.FormatInt(shardStart, 10)).Set(float64(watermark))
+		delete(s.pending, shardStart)
+	}
+	return nil
+}
+
+// fetchShard walks a shard in PageSize windows starting after watermark, calling
+// emit with each page. It returns the number of records emitted and the watermark
+// they cover, even on error.
+func (s *ShardedExtractor) fetchShard(ctx context.Context, shard Shard, watermark int64, emit func(page []map[string]interface{}) error) (int, int64, error) {
+	records := 0
+
+	for shard.End == 0 || watermark < shard.End {
+		from := watermark + 1
+		to := watermark + s.cfg.PageSize
+		if shard.End != 0 && to > shard.End {
+			to = shard.End
+		}
+
+		if err := ctx.Err(); err != nil {
+			return records, watermark, err
+		}
+		page, err := s.client.fetch(ctx, s.rangeURL(from, to), RequestVars{FromID: from, ToID: to})
+		if err != nil {
+			return records, watermark, err
+		}
+		if len(page) > 0 {
+			if err := emit(page); err != nil {
+				return records, watermark, err
+			}
+			records += len(page)
+		}
+
+		if shard.End != 0 {
+			watermark = to
+			continue
+		}
+
+		// The open-ended shard only advances to ids it has actually seen, since
+		// ids inside the window may not have been created yet
+		if len(page) == 0 {
+			// An empty window is either the end of the ids or a gap in them
+			next, err := s.nextID(ctx, to+1)
+			if err != nil {
+				return records, watermark, err
+			}
+			if next == 0 {
+				break
+			}
+			watermark = next - 1
+			continue
+		}
+		for _, record := range page {
+			if id, ok := record[s.cfg.IDField].(float64); ok && int64(id) > watermark {
+				watermark = int64(id)
+			}
+		}
+		if watermark < to {
+			break
+		}
+	}
+
+	return records, watermark, nil
+}
+
+// nextID returns the lowest id of the records from id from on, or 0 when there are
+// none, so the open-ended shard looks past a gap of a window or more in the ids.
+// The records themselves are fetched again in windows.
+func (s *ShardedExtractor) nextID(ctx context.Context, from int64) (int64, error) {
+	page, err := s.client.fetch(ctx, s.rangeURL(from, math.MaxInt64), RequestVars{FromID: from, ToID: math.MaxInt64})
+	if err != nil {
+		return 0, err
+	}
+	var next int64
+	for _, record := range page {
+		if id, ok := record[s.cfg.IDField].(float64); ok && int64(id) >= from && (next == 0 || int64(id) < next) {
+			next = int64(id)
+		}
+	}
+	return next, nil
+}
+
+// rangeURL builds the request URL for the inclusive id range [from, to]
+func (s *ShardedExtractor) rangeURL(from, to int64) string {
+	u, err := url.Parse(s.client.baseURL)
+	if err != nil {
+		return s.client.baseURL
+	}
+	// Without parameters the range is selected by the request body template
+	query := u.Query()
+	if s.cfg.FromParam != "" {
+		query.Set(s.cfg.FromParam, strconv.FormatInt(from, 10))
+	}
+	if s.cfg.ToParam != "" {
+		query.Set(s.cfg.ToParam, strconv.FormatInt(to, 10))
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
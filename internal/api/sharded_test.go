@@ -0,0 +1,414 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+type memoryWatermarks map[int64]int64
+
+func (m memoryWatermarks) LoadWatermarks(ctx context.Context, source string) (map[int64]int64, error) {
+	copied := make(map[int64]int64, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied, nil
+}
+
+func (m memoryWatermarks) SaveWatermark(ctx context.Context, source string, shardStart, watermark int64) error {
+	m[shardStart] = watermark
+	return nil
+}
+
+func TestSplitKeyspace(t *testing.T) {
+	shards := SplitKeyspace(1, 100, 4)
+
+	expected := []Shard{{1, 25}, {26, 50}, {51, 75}, {76, 0}}
+	if len(shards) != len(expected) {
+		t.Fatalf("Expected %d shards, got %d", len(expected), len(shards))
+	}
+	for i := range expected {
+		if shards[i] != expected[i] {
+			t.Errorf("Shard %d: expected %+v, got %+v", i, expected[i], shards[i])
+		}
+	}
+}
+
+func TestShardedExtractorResumesFromWatermarks(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	// Source holds ids 1..30
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from, _ := strconv.Atoi(r.URL.Query().Get("id_gte"))
+		to, _ := strconv.Atoi(r.URL.Query().Get("id_lte"))
+		records := []map[string]interface{}{}
+		for id := from; id <= to && id <= 30; id++ {
+			records = append(records, map[string]interface{}{"id": id})
+		}
+		json.NewEncoder(w).Encode(records)
+	}))
+	defer server.Close()
+
+	metricsCollector := metrics.NewMetrics()
+	client := NewClient(server.URL, "", logger, metricsCollector)
+	store := memoryWatermarks{}
+	extractor, err := NewShardedExtractor(client, ShardConfig{
+		IDField:   "id",
+		MinID:     1,
+		MaxID:     20,
+		Shards:    2,
+		PageSize:  4,
+		FromParam: "id_gte",
+		ToParam:   "id_lte",
+	}, store, logger, metricsCollector)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	records, err := extractor.FetchData(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 30 {
+		t.Errorf("Expected 30 records on first sync, got %d", len(records))
+	}
+
+	if err := extractor.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if store[1] != 10 || store[11] != 30 {
+		t.Errorf("Unexpected watermarks after commit: %v", store)
+	}
+
+	records, err = extractor.FetchData(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("Expected no records after watermarks were committed, got %d", len(records))
+	}
+}
+
+func TestShardedExtractorSkipsIDGaps(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	// Source holds ids 1..5 and 40..45, a gap of several windows
+	var exists func(id int) bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from, _ := strconv.Atoi(r.URL.Query().Get("id_gte"))
+		to, _ := strconv.Atoi(r.URL.Query().Get("id_lte"))
+		records := []map[string]interface{}{}
+		for id := from; id <= to && id <= 100; id++ {
+			if exists(id) {
+				records = append(records, map[string]interface{}{"id": id})
+			}
+		}
+		json.NewEncoder(w).Encode(records)
+	}))
+	defer server.Close()
+
+	metricsCollector := metrics.NewMetrics()
+	store := memoryWatermarks{}
+	extractor, err := NewShardedExtractor(NewClient(server.URL, "", logger, metricsCollector), ShardConfig{
+		IDField:   "id",
+		MinID:     1,
+		MaxID:     5,
+		Shards:    1,
+		PageSize:  5,
+		FromParam: "id_gte",
+		ToParam:   "id_lte",
+	}, store, logger, metricsCollector)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	exists = func(id int) bool { return id <= 5 || (id >= 40 && id <= 45) }
+	records, err := extractor.FetchData(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 11 {
+		t.Errorf("Expected the records on both sides of the gap, got %d", len(records))
+	}
+	if err := extractor.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if store[1] != 45 {
+		t.Errorf("Expected the watermark past the gap, got %v", store)
+	}
+
+	// A gap opening after the committed watermark is skipped as well
+	exists = func(id int) bool { return id <= 5 || (id >= 40 && id <= 45) || id == 90 }
+	records, err = extractor.FetchData(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("Expected the record after the new gap, got %d", len(records))
+	}
+}
+
+func TestShardedExtractorStopsAtDeadline(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	// Source holds ids 1..30 and is slow for every window above id 4
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from, _ := strconv.Atoi(r.URL.Query().Get("id_gte"))
+		to, _ := strconv.Atoi(r.URL.Query().Get("id_lte"))
+		if from > 4 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		records := []map[string]interface{}{}
+		for id := from; id <= to && id <= 30; id++ {
+			records = append(records, map[string]interface{}{"id": id})
+		}
+		json.NewEncoder(w).Encode(records)
+	}))
+	defer server.Close()
+
+	metricsCollector := metrics.NewMetrics()
+	store := memoryWatermarks{}
+	extractor, err := NewShardedExtractor(NewClient(server.URL, "", logger, metricsCollector), ShardConfig{
+		IDField:   "id",
+		MinID:     1,
+		MaxID:     20,
+		Shards:    2,
+		PageSize:  4,
+		FromParam: "id_gte",
+		ToParam:   "id_lte",
+	}, store, logger, metricsCollector)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	records, err := extractor.FetchData(ctx)
+	if !errors.Is(err, ErrPartial) {
+		t.Fatalf("Expected ErrPartial, got %v", err)
+	}
+	if len(records) != 4 {
+		t.Errorf("Expected the 4 records fetched before the deadline, got %d", len(records))
+	}
+
+	if err := extractor.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if store[1] != 4 || store[11] != 10 {
+		t.Errorf("Expected shards to resume after their last complete page, got %v", store)
+	}
+}
+
+// fixedCoordinator grants each owner the shards listed for it
+type fixedCoordinator map[string][]int64
+
+func (f fixedCoordinator) ClaimShards(ctx context.Context, source, owner string, shardStarts []int64, ttl time.Duration) ([]int64, error) {
+	return f[owner], nil
+}
+
+func (f fixedCoordinator) HeldShards(ctx context.Context, source, owner string) ([]int64, error) {
+	return f[owner], nil
+}
+
+func (f fixedCoordinator) ReleaseShards(source, owner string) error {
+	delete(f, owner)
+	return nil
+}
+
+func TestShardedExtractorFetchesClaimedShards(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from, _ := strconv.Atoi(r.URL.Query().Get("id_gte"))
+		to, _ := strconv.Atoi(r.URL.Query().Get("id_lte"))
+		records := []map[string]interface{}{}
+		for id := from; id <= to && id <= 30; id++ {
+			records = append(records, map[string]interface{}{"id": id})
+		}
+		json.NewEncoder(w).Encode(records)
+	}))
+	defer server.Close()
+
+	metricsCollector := metrics.NewMetrics()
+	coordinator := fixedCoordinator{"a": {1, 21}, "b": {11}}
+	fetched := make(map[string]int)
+	for _, owner := range []string{"a", "b", "c"} {
+		extractor, err := NewShardedExtractor(NewClient(server.URL, "", logger, metricsCollector), ShardConfig{
+			IDField:   "id",
+			MinID:     1,
+			MaxID:     30,
+			Shards:    3,
+			PageSize:  10,
+			FromParam: "id_gte",
+			ToParam:   "id_lte",
+		}, memoryWatermarks{}, logger, metricsCollector)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		extractor.SetCoordinator(coordinator, owner, time.Minute)
+
+		records, err := extractor.FetchData(context.Background())
+		if err != nil {
+			t.Fatalf("Instance %s: unexpected error: %v", owner, err)
+		}
+		fetched[owner] = len(records)
+		if err := extractor.Release(); err != nil {
+			t.Errorf("Instance %s: unexpected release error: %v", owner, err)
+		}
+	}
+
+	if fetched["a"] != 20 || fetched["b"] != 10 || fetched["c"] != 0 {
+		t.Errorf("Expected instances to fetch only their shards, got %v", fetched)
+	}
+	if len(coordinator) != 0 {
+		t.Errorf("Expected every instance to release its shards, got %v", coordinator)
+	}
+}
+
+func TestShardedExtractorSkipsLostShardsOnCommit(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from, _ := strconv.Atoi(r.URL.Query().Get("id_gte"))
+		to, _ := strconv.Atoi(r.URL.Query().Get("id_lte"))
+		records := []map[string]interface{}{}
+		for id := from; id <= to && id <= 20; id++ {
+			records = append(records, map[string]interface{}{"id": id})
+		}
+		json.NewEncoder(w).Encode(records)
+	}))
+	defer server.Close()
+
+	metricsCollector := metrics.NewMetrics()
+	store := memoryWatermarks{}
+	extractor, err := NewShardedExtractor(NewClient(server.URL, "", logger, metricsCollector), ShardConfig{
+		IDField:   "id",
+		MinID:     1,
+		MaxID:     20,
+		Shards:    2,
+		PageSize:  10,
+		FromParam: "id_gte",
+		ToParam:   "id_lte",
+	}, store, logger, metricsCollector)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	coordinator := fixedCoordinator{"a": {1, 11}}
+	extractor.SetCoordinator(coordinator, "a", time.Minute)
+
+	// The load of the first cycle fails, so nothing is committed, and the next
+	// cycle only holds the first shard. The second shard is not committed even
+	// when its lease is back by then.
+	if _, err := extractor.FetchData(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	coordinator["a"] = []int64{1}
+	if _, err := extractor.FetchData(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	coordinator["a"] = []int64{1, 11}
+	if err := extractor.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := store[11]; ok || store[1] != 10 {
+		t.Errorf("Expected only the watermark of the shard fetched last cycle, got %v", store)
+	}
+
+	// The lease of a fetched shard passes to another instance before the commit
+	coordinator["a"] = []int64{1, 11}
+	if _, err := extractor.FetchData(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	coordinator["a"] = []int64{1}
+	if err := extractor.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := store[11]; ok {
+		t.Errorf("Expected the watermark of the lost shard not to be saved, got %v", store)
+	}
+}
+
+func TestShardedExtractorStreamsPages(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	// Source holds ids 1..20
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from, _ := strconv.Atoi(r.URL.Query().Get("id_gte"))
+		to, _ := strconv.Atoi(r.URL.Query().Get("id_lte"))
+		records := []map[string]interface{}{}
+		for id := from; id <= to && id <= 20; id++ {
+			records = append(records, map[string]interface{}{"id": id})
+		}
+		json.NewEncoder(w).Encode(records)
+	}))
+	defer server.Close()
+
+	metricsCollector := metrics.NewMetrics()
+	store := memoryWatermarks{}
+	extractor, err := NewShardedExtractor(NewClient(server.URL, "", logger, metricsCollector), ShardConfig{
+		IDField:   "id",
+		MinID:     1,
+		MaxID:     20,
+		Shards:    1,
+		PageSize:  5,
+		FromParam: "id_gte",
+		ToParam:   "id_lte",
+	}, store, logger, metricsCollector)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The consumer stops after two pages, so the watermark covers only those
+	stopped := errors.New("consumer stopped")
+	var pages []int
+	err = extractor.FetchStream(context.Background(), func(page []map[string]interface{}) error {
+		if len(pages) == 2 {
+			return stopped
+		}
+		pages = append(pages, len(page))
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Expected an error when every shard stopped")
+	}
+	if len(pages) != 2 || pages[0] != 5 || pages[1] != 5 {
+		t.Errorf("Expected two pages of 5 records, got %v", pages)
+	}
+	if err := extractor.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if store[1] != 10 {
+		t.Errorf("Expected the watermark at id 10, got %v", store)
+	}
+
+	// The next extraction resumes after the pages emitted
+	pages = nil
+	if err := extractor.FetchStream(context.Background(), func(page []map[string]interface{}) error {
+		pages = append(pages, len(page))
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(pages) != 2 {
+		t.Errorf("Expected the two remaining pages, got %v", pages)
+	}
+}
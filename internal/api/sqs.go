@@ -0,0 +1,404 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// maxSQSMessages is the most messages SQS hands out or settles per request
+const maxSQSMessages = 10
+
+// sqsSettleTimeout bounds the requests deleting or releasing messages, which
+// outlive the extraction
+const sqsSettleTimeout = 30 * time.Second
+
+// SQSConfig configures the extraction of records from an SQS queue
+type SQSConfig struct {
+	QueueURL string
+	// DeadLetterQueueURL receives the messages that cannot be decoded or were
+	// received MaxReceives times; without it they are left to the redrive policy
+	// of the queue
+	DeadLetterQueueURL string
+	Region             string
+	Credentials        awsauth.Credentials
+	// MaxMessages bounds the messages received per cycle
+	MaxMessages int
+	// WaitTime is how long the first receive of a cycle waits for messages
+	WaitTime time.Duration
+	// VisibilityTimeout hides received messages from other consumers; it is
+	// extended while their batch is loaded
+	VisibilityTimeout time.Duration
+	// MaxReceives is how often a message is received before it is moved to the
+	// dead-letter queue; zero disables the check
+	MaxReceives int
+}
+
+// SQSExtractor receives the records of a cycle from an SQS queue. Each message
+// holds a JSON record or an array of them. Messages are deleted once their records
+// are durable and released to be received again otherwise.
+type SQSExtractor struct {
+	cfg        SQSConfig
+	endpoint   string
+	httpClient *http.Client
+	logger     *logging.Logger
+	metrics    *metrics.Metrics
+}
+
+// NewSQSExtractor creates an extractor receiving from the queue of cfg
+func NewSQSExtractor(cfg SQSConfig, logger *logging.Logger, metrics *metrics.Metrics) (*SQSExtractor, error) {
+	queue, err := url.Parse(cfg.QueueURL)
+	if err != nil || queue.Scheme == "" || queue.Host == "" {
+		return nil, fmt.Errorf("invalid SQS queue URL %q", cfg.QueueURL)
+	}
+	if cfg.Credentials.AccessKeyID == "" || cfg.Credentials.SecretAccessKey == "" {
+		return nil, fmt.Errorf("SQS credentials are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.MaxMessages <= 0 {
+		return nil, fmt.Errorf("SQS max messages must be positive")
+	}
+	if cfg.WaitTime < 0 || cfg.WaitTime > 20*time.Second {
+		return nil, fmt.Errorf("SQS wait time must be between 0 and 20s")
+	}
+	if cfg.VisibilityTimeout < 2*time.Second || cfg.VisibilityTimeout > 12*time.Hour {
+		return nil, fmt.Errorf("SQS visibility timeout must be between 2s and 12h")
+	}
+	return &SQSExtractor{
+		cfg: cfg,
+		// The JSON protocol addresses the queue in the body, on the host of its URL
+		endpoint: queue.Scheme + "://" + queue.Host + "/",
+		httpClient: &http.Client{
+			Timeout: 30*time.Second + cfg.WaitTime,
+		},
+		logger:  logger,
+		metrics: metrics,
+	}, nil
+}
+
+// sqsMessage is a message received from SQS
+type sqsMessage struct {
+	MessageID     string            `json:"MessageId"`
+	ReceiptHandle string            `json:"ReceiptHandle"`
+	Body          string            `json:"Body"`
+	Attributes    map[string]string `json:"Attributes"`
+}
+
+// FetchBatches receives up to MaxMessages messages and hands out the records of
+// each receive as a batch, deleting its messages when acked and releasing them when
+// nacked. Until then their visibility timeout is extended. Receiving stops once the
+// queue is drained: only the first receive waits WaitTime for messages.
+func (s *SQSExtractor) FetchBatches(ctx context.Context, emit func(batch *Batch) error) error {
+	logger := s.logger.ForContext(ctx)
+	start := time.Now()
+	received, records := 0, 0
+	wait := s.cfg.WaitTime
+	for received < s.cfg.MaxMessages {
+		messages, err := s.receive(ctx, min(maxSQSMessages, s.cfg.MaxMessages-received), wait)
+		if err != nil {
+			if received > 0 && ctx.Err() != nil {
+				return fmt.Errorf("%w: %v", ErrPartial, err)
+			}
+			logger.Error(fmt.Sprintf("SQS receive failed: %v", err))
+			return err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		received += len(messages)
+		s.metrics.SQSMessagesTotal.WithLabelValues("received").Add(float64(len(messages)))
+		wait = time.Second
+
+		batch := s.batch(ctx, logger, messages)
+		if batch == nil {
+			continue
+		}
+		records += len(batch.Records)
+		if err := emit(batch); err != nil {
+			return err
+		}
+	}
+	logger.Info(fmt.Sprintf("SQS receive successful: %d records from %d messages in %.2fs", records, received, time.Since(start).Seconds()))
+	return nil
+}
+
+// FetchData receives the records of a cycle and releases their messages right
+// away, leaving them in the queue, e.g. for dry runs and previews. Each receive
+// still counts towards MaxReceives.
+func (s *SQSExtractor) FetchData(ctx context.Context) ([]map[string]interface{}, error) {
+	var batches []*Batch
+	var records []map[string]interface{}
+	err := s.FetchBatches(ctx, func(batch *Batch) error {
+		batches = append(batches, batch)
+		records = append(records, batch.Records...)
+		return nil
+	})
+	for _, batch := range batches {
+		if nackErr := batch.Nack(errors.New("records were only previewed")); nackErr != nil {
+			s.logger.ForContext(ctx).Warn(fmt.Sprintf("Failed to release previewed SQS messages: %v", nackErr))
+		}
+	}
+	return records, err
+}
+
+// batch decodes the records of messages, moving those that cannot be loaded to the
+// dead-letter queue, and returns a batch settling the others, or nil if none are left
+func (s *SQSExtractor) batch(ctx context.Context, logger *logging.Logger, messages []sqsMessage) *Batch {
+	var kept []sqsMessage
+	var records []map[string]interface{}
+	var payloads []json.RawMessage
+	var poison []sqsMessage
+	var reasons []string
+	for _, message := range messages {
+		receives, _ := strconv.Atoi(message.Attributes["ApproximateReceiveCount"])
+		if s.cfg.MaxReceives > 0 && receives > s.cfg.MaxReceives {
+			poison = append(poison, message)
+			reasons = append(reasons, fmt.Sprintf("received %d times", receives))
+			continue
+		}
+		messageRecords, messagePayloads, err := decodeJSONRecords(message.Body)
+		if err != nil {
+			poison = append(poison, message)
+			reasons = append(reasons, err.Error())
+			continue
+		}
+		kept = append(kept, message)
+		records = append(records, messageRecords...)
+		payloads = append(payloads, messagePayloads...)
+	}
+	if len(poison) > 0 {
+		s.deadLetter(ctx, logger, poison, reasons)
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+
+	stop := s.keepInvisible(logger, kept)
+	return NewBatch(records, payloads, func() error {
+		stop()
+		ctx, cancel := context.WithTimeout(context.Background(), sqsSettleTimeout)
+		defer cancel()
+		if err := s.deleteMessages(ctx, kept); err != nil {
+			return err
+		}
+		s.metrics.SQSMessagesTotal.WithLabelValues("deleted").Add(float64(len(kept)))
+		return nil
+	}, func(error) error {
+		stop()
+		ctx, cancel := context.WithTimeout(context.Background(), sqsSettleTimeout)
+		defer cancel()
+		// A visibility timeout of zero makes the messages receivable right away
+		if err := s.changeVisibility(ctx, kept, 0); err != nil {
+			return err
+		}
+		s.metrics.SQSMessagesTotal.WithLabelValues("released").Add(float64(len(kept)))
+		return nil
+	})
+}
+
+// decodeJSONRecords decodes the JSON record or array of records of a message body,
+// with the payload of each record
+func decodeJSONRecords(body string) ([]map[string]interface{}, []json.RawMessage, error) {
+	trimmed := strings.TrimSpace(body)
+	if !strings.HasPrefix(trimmed, "[") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(trimmed), &record); err != nil || record == nil {
+			return nil, nil, fmt.Errorf("body is not a JSON object or array of objects")
+		}
+		return []map[string]interface{}{record}, []json.RawMessage{json.RawMessage(trimmed)}, nil
+	}
+	var payloads []json.RawMessage
+	if err := json.Unmarshal([]byte(trimmed), &payloads); err != nil {
+		return nil, nil, fmt.Errorf("body is not a JSON object or array of objects")
+	}
+	records := make([]map[string]interface{}, len(payloads))
+	for i, payload := range payloads {
+		if err := json.Unmarshal(payload, &records[i]); err != nil || records[i] == nil {
+			return nil, nil, fmt.Errorf("element %d of the body is not a JSON object", i)
+		}
+	}
+	return records, payloads, nil
+}
+
+// deadLetter moves messages to the dead-letter queue, tagged with the reason,
+// or leaves them to the redrive policy of the queue when there is none
+func (s *SQSExtractor) deadLetter(ctx context.Context, logger *logging.Logger, messages []sqsMessage, reasons []string) {
+	if s.cfg.DeadLetterQueueURL == "" {
+		for i, message := range messages {
+			logger.Warn(fmt.Sprintf("Leaving SQS message %s to the redrive policy of the queue: %s", message.MessageID, reasons[i]))
+		}
+		return
+	}
+	var moved []sqsMessage
+	for i, message := range messages {
+		err := s.call(ctx, "SendMessage", map[string]interface{}{
+			"QueueUrl":    s.cfg.DeadLetterQueueURL,
+			"MessageBody": message.Body,
+			"MessageAttributes": map[string]interface{}{
+				"etl-error":        map[string]string{"DataType": "String", "StringValue": reasons[i]},
+				"etl-source-queue": map[string]string{"DataType": "String", "StringValue": s.cfg.QueueURL},
+			},
+		}, nil)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to move SQS message %s to the dead-letter queue: %v", message.MessageID, err))
+			continue
+		}
+		logger.Warn(fmt.Sprintf("Moved SQS message %s to the dead-letter queue: %s", message.MessageID, reasons[i]))
+		moved = append(moved, message)
+	}
+	if len(moved) == 0 {
+		return
+	}
+	s.metrics.SQSMessagesTotal.WithLabelValues("dead_lettered").Add(float64(len(moved)))
+	if err := s.deleteMessages(ctx, moved); err != nil {
+		// They are moved again when received next
+		logger.Error(fmt.Sprintf("Failed to delete SQS messages moved to the dead-letter queue: %v", err))
+	}
+}
+
+// keepInvisible extends the visibility timeout of messages every half timeout
+// until the returned function is called
+func (s *SQSExtractor) keepInvisible(logger *logging.Logger, messages []sqsMessage) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(s.cfg.VisibilityTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.changeVisibility(ctx, messages, s.cfg.VisibilityTimeout); err != nil {
+					if ctx.Err() == nil {
+						logger.Warn(fmt.Sprintf("Failed to extend the visibility timeout of %d SQS messages: %v", len(messages), err))
+					}
+					continue
+				}
+				s.metrics.SQSMessagesTotal.WithLabelValues("extended").Add(float64(len(messages)))
+			}
+		}
+	}()
+	return cancel
+}
+
+// receive receives up to n messages, waiting up to wait for the first one
+func (s *SQSExtractor) receive(ctx context.Context, n int, wait time.Duration) ([]sqsMessage, error) {
+	var response struct {
+		Messages []sqsMessage `json:"Messages"`
+	}
+	err := s.call(ctx, "ReceiveMessage", map[string]interface{}{
+		"QueueUrl":            s.cfg.QueueURL,
+		"MaxNumberOfMessages": n,
+		"WaitTimeSeconds":     int(wait.Seconds()),
+		"VisibilityTimeout":   int(s.cfg.VisibilityTimeout.Seconds()),
+		// AttributeNames is deprecated, but still the only name some emulators know
+		"MessageSystemAttributeNames": []string{"ApproximateReceiveCount"},
+		"AttributeNames":              []string{"ApproximateReceiveCount"},
+	}, &response)
+	return response.Messages, err
+}
+
+// deleteMessages deletes messages from the queue
+func (s *SQSExtractor) deleteMessages(ctx context.Context, messages []sqsMessage) error {
+	return s.callBatches(ctx, "DeleteMessageBatch", messages, func(message sqsMessage) map[string]interface{} {
+		return map[string]interface{}{"ReceiptHandle": message.ReceiptHandle}
+	})
+}
+
+// changeVisibility sets the visibility timeout of messages to timeout from now
+func (s *SQSExtractor) changeVisibility(ctx context.Context, messages []sqsMessage, timeout time.Duration) error {
+	return s.callBatches(ctx, "ChangeMessageVisibilityBatch", messages, func(message sqsMessage) map[string]interface{} {
+		return map[string]interface{}{"ReceiptHandle": message.ReceiptHandle, "VisibilityTimeout": int(timeout.Seconds())}
+	})
+}
+
+// callBatches calls a batch action on messages, up to ten at a time, failing when
+// any entry failed
+func (s *SQSExtractor) callBatches(ctx context.Context, action string, messages []sqsMessage, entry func(sqsMessage) map[string]interface{}) error {
+	for start := 0; start < len(messages); start += maxSQSMessages {
+		chunk := messages[start:min(start+maxSQSMessages, len(messages))]
+		entries := make([]map[string]interface{}, len(chunk))
+		for i, message := range chunk {
+			entries[i] = entry(message)
+			entries[i]["Id"] = strconv.Itoa(i)
+		}
+		var response struct {
+			Failed []struct {
+				ID      string `json:"Id"`
+				Code    string `json:"Code"`
+				Message string `json:"Message"`
+			} `json:"Failed"`
+		}
+		if err := s.call(ctx, action, map[string]interface{}{"QueueUrl": s.cfg.QueueURL, "Entries": entries}, &response); err != nil {
+			return err
+		}
+		if len(response.Failed) > 0 {
+			failed := response.Failed[0]
+			return fmt.Errorf("sqs %s failed for %d of %d messages: %s: %s", action, len(response.Failed), len(chunk), failed.Code, failed.Message)
+		}
+	}
+	return nil
+}
+
+// Ping checks that the queue exists and can be read with the credentials
+func (s *SQSExtractor) Ping(ctx context.Context) error {
+	return s.call(ctx, "GetQueueAttributes", map[string]interface{}{
+		"QueueUrl":       s.cfg.QueueURL,
+		"AttributeNames": []string{"QueueArn"},
+	}, nil)
+}
+
+// call sends a signed request of the SQS JSON protocol and decodes its response
+// into response, if given
+func (s *SQSExtractor) call(ctx context.Context, action string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode sqs %s request: %w", action, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create sqs request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	awsauth.Sign(req, s.cfg.Credentials, s.cfg.Region, "sqs", awsauth.PayloadHash(body), time.Now())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sqs %s request failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		content, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(content, &failure) == nil && failure.Type != "" {
+			// Types are namespaced, e.g. com.amazonaws.sqs#QueueDoesNotExist
+			return fmt.Errorf("sqs %s returned status %d: %s: %s", action, resp.StatusCode, failure.Type[strings.LastIndex(failure.Type, "#")+1:], failure.Message)
+		}
+		return fmt.Errorf("sqs %s returned status %d: %s", action, resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+	if response == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode sqs %s response: %w", action, err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// fakeSQS serves the SQS JSON protocol for a queue holding messages, recording the
+// messages deleted, released and sent to the dead-letter queue
+type fakeSQS struct {
+	mu           sync.Mutex
+	messages     []sqsMessage
+	deleted      []string
+	released     []string
+	deadLettered []string
+}
+
+func (f *fakeSQS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.sqs#MissingAuthenticationToken", "message": "unsigned"})
+		return
+	}
+	var request struct {
+		QueueURL    string `json:"QueueUrl"`
+		MessageBody string
+		Entries     []struct {
+			ID                string `json:"Id"`
+			ReceiptHandle     string
+			VisibilityTimeout *int
+		}
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.") {
+	case "ReceiveMessage":
+		messages := f.messages
+		f.messages = nil
+		json.NewEncoder(w).Encode(map[string]interface{}{"Messages": messages})
+	case "SendMessage":
+		if request.QueueURL != "https://sqs.example.com/1/dlq" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.sqs#QueueDoesNotExist", "message": "no such queue"})
+			return
+		}
+		f.deadLettered = append(f.deadLettered, request.MessageBody)
+		json.NewEncoder(w).Encode(map[string]string{"MessageId": "dlq-1"})
+	case "DeleteMessageBatch", "ChangeMessageVisibilityBatch":
+		var successful []map[string]string
+		for _, entry := range request.Entries {
+			if entry.VisibilityTimeout == nil {
+				f.deleted = append(f.deleted, entry.ReceiptHandle)
+			} else if *entry.VisibilityTimeout == 0 {
+				f.released = append(f.released, entry.ReceiptHandle)
+			}
+			successful = append(successful, map[string]string{"Id": entry.ID})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Successful": successful})
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func newTestSQSExtractor(t *testing.T, queue *fakeSQS, dlq string) *SQSExtractor {
+	server := httptest.NewServer(queue)
+	t.Cleanup(server.Close)
+	logger, _ := logging.NewLogger("test.log")
+	t.Cleanup(func() { logger.Close() })
+
+	extractor, err := NewSQSExtractor(SQSConfig{
+		QueueURL:           server.URL + "/1/queue",
+		DeadLetterQueueURL: dlq,
+		Credentials:        awsauth.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"},
+		MaxMessages:        100,
+		VisibilityTimeout:  30 * time.Second,
+		MaxReceives:        3,
+	}, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewSQSExtractor: %v", err)
+	}
+	return extractor
+}
+
+func TestSQSExtractorSettlesMessages(t *testing.T) {
+	queue := &fakeSQS{messages: []sqsMessage{
+		{MessageID: "1", ReceiptHandle: "r1", Body: `{"id": 1}`, Attributes: map[string]string{"ApproximateReceiveCount": "1"}},
+		{MessageID: "2", ReceiptHandle: "r2", Body: `[{"id": 2}, {"id": 3}]`, Attributes: map[string]string{"ApproximateReceiveCount": "2"}},
+		{MessageID: "3", ReceiptHandle: "r3", Body: `not json`, Attributes: map[string]string{"ApproximateReceiveCount": "1"}},
+		{MessageID: "4", ReceiptHandle: "r4", Body: `{"id": 4}`, Attributes: map[string]string{"ApproximateReceiveCount": "4"}},
+	}}
+	extractor := newTestSQSExtractor(t, queue, "https://sqs.example.com/1/dlq")
+
+	var batches []*Batch
+	if err := extractor.FetchBatches(context.Background(), func(batch *Batch) error {
+		batches = append(batches, batch)
+		return nil
+	}); err != nil {
+		t.Fatalf("FetchBatches: %v", err)
+	}
+	if len(batches) != 1 || len(batches[0].Records) != 3 || string(batches[0].Payloads[2]) != `{"id": 3}` {
+		t.Fatalf("Expected one batch of the three decodable records, got %+v", batches)
+	}
+	// The undecodable message and the one received too often are moved aside
+	if len(queue.deadLettered) != 2 || len(queue.deleted) != 2 {
+		t.Fatalf("Expected two messages moved to the dead-letter queue, got %v moved and %v deleted", queue.deadLettered, queue.deleted)
+	}
+
+	if err := batches[0].Ack(); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if len(queue.deleted) != 4 || queue.deleted[2] != "r1" || queue.deleted[3] != "r2" {
+		t.Errorf("Expected the acked messages to be deleted, got %v", queue.deleted)
+	}
+}
+
+func TestSQSExtractorReleasesNackedMessages(t *testing.T) {
+	queue := &fakeSQS{messages: []sqsMessage{
+		{MessageID: "1", ReceiptHandle: "r1", Body: `{"id": 1}`},
+		{MessageID: "2", ReceiptHandle: "r2", Body: `42`},
+	}}
+	// Without a dead-letter queue, poison messages are left to the queue's redrive policy
+	extractor := newTestSQSExtractor(t, queue, "")
+
+	var batch *Batch
+	extractor.FetchBatches(context.Background(), func(b *Batch) error {
+		batch = b
+		return nil
+	})
+	if batch == nil {
+		t.Fatal("Expected a batch")
+	}
+	if err := batch.Nack(errors.New("database unavailable")); err != nil {
+		t.Fatalf("Nack: %v", err)
+	}
+	if len(queue.released) != 1 || queue.released[0] != "r1" || len(queue.deleted) != 0 || len(queue.deadLettered) != 0 {
+		t.Errorf("Expected only the nacked message to be released, got %v released, %v deleted", queue.released, queue.deleted)
+	}
+}
+
+func TestSQSExtractorReportsErrors(t *testing.T) {
+	queue := &fakeSQS{messages: []sqsMessage{{MessageID: "1", ReceiptHandle: "r1", Body: `[1]`}}}
+	extractor := newTestSQSExtractor(t, queue, "https://sqs.example.com/1/missing")
+
+	var batches int
+	extractor.FetchBatches(context.Background(), func(*Batch) error {
+		batches++
+		return nil
+	})
+	// A message that cannot be moved stays in the queue
+	if batches != 0 || len(queue.deleted) != 0 {
+		t.Errorf("Expected the poison message to stay in the queue, got %d batches and %v deleted", batches, queue.deleted)
+	}
+
+	err := extractor.call(context.Background(), "SendMessage", map[string]string{"QueueUrl": "https://sqs.example.com/1/missing"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "QueueDoesNotExist: no such queue") {
+		t.Errorf("Expected the error type and message of SQS, got %v", err)
+	}
+}
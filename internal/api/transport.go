@@ -0,0 +1,198 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+)
+
+// dumpMaxBody is the most bytes of a request or response body kept in a dump
+const dumpMaxBody = 64 << 10
+
+// redacted replaces credentials in dumps
+const redacted = "[REDACTED]"
+
+// TransportConfig holds the settings of the transport of API requests
+type TransportConfig struct {
+	// UserAgent identifies the pipeline to the API, if set
+	UserAgent string
+	// RequestIDHeader carries a new random ID with every request, if set, so that a
+	// request can be found in the API's logs
+	RequestIDHeader string
+	// DumpDir receives a sanitized dump of every failed request and its response,
+	// if set
+	DumpDir string
+}
+
+// SetTransport sends the requests of the client through a transport setting the
+// User-Agent and request ID headers of cfg, recording request and response sizes
+// and dumping failed requests
+func (c *Client) SetTransport(cfg TransportConfig) {
+	c.httpClient.Transport = &transport{
+		base:    http.DefaultTransport,
+		cfg:     cfg,
+		logger:  c.logger,
+		metrics: c.metrics,
+	}
+}
+
+// transport wraps an http.RoundTripper as configured by TransportConfig
+type transport struct {
+	base    http.RoundTripper
+	cfg     TransportConfig
+	logger  *logging.Logger
+	metrics *metrics.Metrics
+	// dirOnce creates DumpDir before the first dump
+	dirOnce sync.Once
+	dirErr  error
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	if t.cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", t.cfg.UserAgent)
+	}
+	requestID := ""
+	if t.cfg.RequestIDHeader != "" {
+		requestID = req.Header.Get(t.cfg.RequestIDHeader)
+		if requestID == "" {
+			requestID = runid.New()
+			req.Header.Set(t.cfg.RequestIDHeader, requestID)
+		}
+		trace.SpanFromContext(req.Context()).SetAttributes(attribute.String("http.request_id", requestID))
+	}
+	if req.ContentLength >= 0 {
+		t.metrics.APIRequestSize.Observe(float64(req.ContentLength))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode >= http.StatusBadRequest {
+		t.dump(req, requestID, resp, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, observe: t.metrics.APIResponseSize.Observe}
+	return resp, nil
+}
+
+// dump writes req and its response, or the error that ended it, to DumpDir
+// without credentials. The body of resp stays readable.
+func (t *transport) dump(req *http.Request, requestID string, resp *http.Response, reqErr error) {
+	if t.cfg.DumpDir == "" {
+		return
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s\n", req.Method, sanitizeURL(req.URL))
+	sanitizeHeader(req.Header).Write(&buf)
+	buf.WriteString("\n")
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			io.Copy(&buf, io.LimitReader(body, dumpMaxBody))
+			buf.WriteString("\n\n")
+		}
+	}
+	if reqErr != nil {
+		fmt.Fprintf(&buf, "error: %v\n", reqErr)
+	} else {
+		fmt.Fprintf(&buf, "%s %s\n", resp.Proto, resp.Status)
+		sanitizeHeader(resp.Header).Write(&buf)
+		buf.WriteString("\n")
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, dumpMaxBody))
+		buf.Write(body)
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	}
+
+	t.dirOnce.Do(func() { t.dirErr = os.MkdirAll(t.cfg.DumpDir, 0o700) })
+	if t.dirErr != nil {
+		t.logger.Warn(fmt.Sprintf("Failed to create API dump directory: %v", t.dirErr))
+		return
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000Z")
+	if requestID != "" {
+		name += "-" + requestID
+	}
+	path := filepath.Join(t.cfg.DumpDir, name+".http")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.logger.Warn(fmt.Sprintf("Failed to dump failed API request: %v", err))
+		return
+	}
+	t.logger.ForContext(req.Context()).Info(fmt.Sprintf("Dumped failed API request to %s", path))
+}
+
+// sensitive reports whether a header or query parameter named name may hold a credential
+func sensitive(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "authorization", "proxy-authorization", "cookie", "set-cookie":
+		return true
+	}
+	for _, part := range []string{"token", "key", "secret", "password", "signature", "auth"} {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeHeader returns a copy of header with the values of credentials redacted
+func sanitizeHeader(header http.Header) http.Header {
+	sanitized := header.Clone()
+	for name := range sanitized {
+		if sensitive(name) {
+			sanitized[name] = []string{redacted}
+		}
+	}
+	return sanitized
+}
+
+// sanitizeURL returns u with its password and the values of credential query
+// parameters redacted
+func sanitizeURL(u *url.URL) string {
+	sanitized := *u
+	query := sanitized.Query()
+	for name := range query {
+		if sensitive(name) {
+			query[name] = []string{redacted}
+		}
+	}
+	sanitized.RawQuery = query.Encode()
+	return sanitized.Redacted()
+}
+
+// countingBody observes the number of bytes read from a response body once it is closed
+type countingBody struct {
+	io.ReadCloser
+	observe func(float64)
+	read    int64
+	once    sync.Once
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.once.Do(func() { b.observe(float64(b.read)) })
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestTransport(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	fail := false
+	var userAgent, requestID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent, requestID = r.UserAgent(), r.Header.Get("X-Request-ID")
+		w.Header().Set("Set-Cookie", "session=abc")
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("upstream down"))
+			return
+		}
+		w.Write([]byte(`[{"id": 1}]`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	m := metrics.NewMetrics()
+	client := NewClient(server.URL+"?api_key=hunter2&page=1", "secret-token", logger, m)
+	client.SetTransport(TransportConfig{UserAgent: "etl-pipeline/test", RequestIDHeader: "X-Request-ID", DumpDir: dir})
+
+	if _, err := client.FetchData(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if userAgent != "etl-pipeline/test" || len(requestID) != 16 {
+		t.Errorf("Expected the user agent and a request ID, got %q and %q", userAgent, requestID)
+	}
+	var metric dto.Metric
+	m.APIResponseSize.Write(&metric)
+	if got := metric.GetHistogram().GetSampleSum(); got != float64(len(`[{"id": 1}]`)) {
+		t.Errorf("Expected the response size observed, got %v", got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no dump of a successful request, got %d", len(entries))
+	}
+
+	first := requestID
+	fail = true
+	if _, err := client.FetchData(context.Background()); err == nil {
+		t.Fatal("Expected an error for a failed request")
+	}
+	if requestID == first {
+		t.Error("Expected a new request ID per request")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), requestID+".http") {
+		t.Fatalf("Expected a dump named by the request ID, got %v", entries)
+	}
+	dump, _ := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	for _, secret := range []string{"secret-token", "hunter2", "session=abc"} {
+		if strings.Contains(string(dump), secret) {
+			t.Errorf("Expected %s redacted from the dump:\n%s", secret, dump)
+		}
+	}
+	for _, want := range []string{"page=1", "502 Bad Gateway", "upstream down"} {
+		if !strings.Contains(string(dump), want) {
+			t.Errorf("Expected %q in the dump:\n%s", want, dump)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// Namespace of the generated record schemas
+const Namespace = "com.mohammedhassan.etl"
+
+// Schema returns the Avro record schema for the given processed fields.
+// Optional fields are encoded as a union with null and default to null.
+func Schema(name string, fields []transform.Field) ([]byte, error) {
+	type avroField struct {
+		Name    string      `json:"name"`
+		Type    interface{} `json:"type"`
+		Doc     string      `json:"doc,omitempty"`
+		Default interface{} `json:"default,omitempty"`
+	}
+
+	avroFields := make([]avroField, 0, len(fields))
+	for _, field := range fields {
+		f := avroField{Name: field.Name, Type: primitiveType(field.Type), Doc: field.Description}
+		if !field.Required {
+			f.Type = []interface{}{"null", primitiveType(field.Type)}
+			f.Default = json.RawMessage("null")
+		}
+		avroFields = append(avroFields, f)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"type":      "record",
+		"name":      name,
+		"namespace": Namespace,
+		"fields":    avroFields,
+	})
+}
+
+// Encode serializes a row in Avro binary encoding following the field order of the schema
+func Encode(fields []transform.Field, row map[string]interface{}) ([]byte, error) {
+	var buf []byte
+	for _, field := range fields {
+		value, present := row[field.Name]
+		if !field.Required {
+			// Union branch: 0 is null, 1 is the value type
+			if !present || value == nil {
+				buf = appendLong(buf, 0)
+				continue
+			}
+			buf = appendLong(buf, 1)
+		} else if !present || value == nil {
+			return nil, fmt.Errorf("required field %s is missing", field.Name)
+		}
+
+		encoded, err := appendValue(buf, field, value)
+		if err != nil {
+			return nil, err
+		}
+		buf = encoded
+	}
+	return buf, nil
+}
+
+func appendValue(buf []byte, field transform.Field, value interface{}) ([]byte, error) {
+	switch field.Type {
+	case transform.FieldTypeInteger:
+		switch v := value.(type) {
+		case int:
+			return appendLong(buf, int64(v)), nil
+		case int64:
+			return appendLong(buf, v), nil
+		case float64:
+			return appendLong(buf, int64(v)), nil
+		}
+	case transform.FieldTypeString:
+		if v, ok := value.(string); ok {
+			buf = appendLong(buf, int64(len(v)))
+			return append(buf, v...), nil
+		}
+	}
+	return nil, fmt.Errorf("field %s: cannot encode %T as %s", field.Name, value, field.Type)
+}
+
+// appendLong appends a zig-zag varint as used for Avro int and long values
+func appendLong(buf []byte, v int64) []byte {
+	return binary.AppendVarint(buf, v)
+}
+
+func primitiveType(fieldType string) string {
+	switch fieldType {
+	case transform.FieldTypeInteger:
+		return "long"
+	default:
+		return "string"
+	}
+}
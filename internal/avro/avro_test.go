@@ -0,0 +1,136 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+func TestEncode(t *testing.T) {
+	fields := []transform.Field{
+		{Name: "user_id", Type: transform.FieldTypeInteger, Required: true},
+		{Name: "title", Type: transform.FieldTypeString, Required: true},
+		{Name: "body", Type: transform.FieldTypeString},
+	}
+
+	tests := []struct {
+		name     string
+		row      map[string]interface{}
+		expected []byte
+	}{
+		{
+			name:     "Optional field present",
+			row:      map[string]interface{}{"user_id": 1, "title": "ab", "body": "c"},
+			expected: []byte{0x02, 0x04, 'a', 'b', 0x02, 0x02, 'c'},
+		},
+		{
+			name:     "Optional field null",
+			row:      map[string]interface{}{"user_id": -1, "title": ""},
+			expected: []byte{0x01, 0x00, 0x00},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := Encode(fields, tt.row)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !bytes.Equal(encoded, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, encoded)
+			}
+		})
+	}
+
+	if _, err := Encode(fields, map[string]interface{}{"title": "x"}); err == nil {
+		t.Errorf("Expected error for missing required field")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema, err := Schema("ProcessedRecord", transform.Fields)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var parsed struct {
+		Name   string `json:"name"`
+		Fields []struct {
+			Name string      `json:"name"`
+			Type interface{} `json:"type"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal(schema, &parsed); err != nil {
+		t.Fatalf("Schema is not valid JSON: %v", err)
+	}
+	if len(parsed.Fields) != len(transform.Fields) {
+		t.Fatalf("Expected %d fields, got %d", len(transform.Fields), len(parsed.Fields))
+	}
+	if _, ok := parsed.Fields[2].Type.([]interface{}); !ok {
+		t.Errorf("Expected optional field to be a union, got %v", parsed.Fields[2].Type)
+	}
+}
+
+func TestWriteContainer(t *testing.T) {
+	fields := []transform.Field{{Name: "title", Type: transform.FieldTypeString, Required: true}}
+	schema, _ := Schema("Row", fields)
+	rows := make([][]byte, BlockRecords+1)
+	for i := range rows {
+		rows[i], _ = Encode(fields, map[string]interface{}{"title": "ab"})
+	}
+
+	for _, codec := range []string{CodecNull, CodecDeflate, CodecSnappy, CodecZstandard} {
+		t.Run(codec, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteContainer(&buf, schema, codec, rows); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			data := buf.Bytes()
+			if !bytes.HasPrefix(data, []byte("Obj\x01")) {
+				t.Fatalf("Missing container magic: %q", data[:4])
+			}
+			if !bytes.Contains(data, schema) || !bytes.Contains(data, []byte(codec)) {
+				t.Errorf("Expected schema and codec in the header")
+			}
+			// Header sync marker ends every block, two for BlockRecords+1 rows
+			sync := data[bytes.Index(data, schema)+len(schema)+len("avro.codec")+len(codec)+3:][:16]
+			if n := bytes.Count(data, sync); n != 3 {
+				t.Errorf("Expected 3 sync markers, got %d", n)
+			}
+		})
+	}
+
+	if _, err := ContainerCodec("lz4"); err == nil {
+		t.Errorf("Expected lz4 to be rejected")
+	}
+}
+
+func TestCheckEvolution(t *testing.T) {
+	base := []transform.Field{
+		{Name: "user_id", Type: transform.FieldTypeInteger, Required: true},
+		{Name: "title", Type: transform.FieldTypeString, Required: true},
+	}
+	writer, _ := Schema("ProcessedRecord", base)
+
+	tests := []struct {
+		name    string
+		fields  []transform.Field
+		wantErr bool
+	}{
+		{name: "Optional field added", fields: append(base[:2:2], transform.Field{Name: "tags", Type: transform.FieldTypeString})},
+		{name: "Field removed", fields: base[:1]},
+		{name: "Required field added", fields: append(base[:2:2], transform.Field{Name: "tags", Type: transform.FieldTypeString, Required: true}), wantErr: true},
+		{name: "Field type changed", fields: []transform.Field{{Name: "user_id", Type: transform.FieldTypeString, Required: true}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, _ := Schema("ProcessedRecord", tt.fields)
+			if err := CheckEvolution(writer, reader); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
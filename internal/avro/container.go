@@ -0,0 +1,125 @@
+package avro
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Block codecs of object container files, as named in their avro.codec metadata
+const (
+	CodecNull      = "null"
+	CodecDeflate   = "deflate"
+	CodecSnappy    = "snappy"
+	CodecZstandard = "zstandard"
+)
+
+// BlockRecords is the maximum number of rows written per container block
+const BlockRecords = 1000
+
+var magic = []byte{'O', 'b', 'j', 1}
+
+// ContainerCodec returns the block codec matching a compression codec name of
+// the codec package: none, gzip (as deflate), snappy or zstd
+func ContainerCodec(name string) (string, error) {
+	switch name {
+	case "", "none":
+		return CodecNull, nil
+	case "gzip":
+		return CodecDeflate, nil
+	case "snappy":
+		return CodecSnappy, nil
+	case "zstd":
+		return CodecZstandard, nil
+	}
+	return "", fmt.Errorf("compression codec %s is not supported in Avro files, use none, gzip, snappy or zstd", name)
+}
+
+// WriteContainer writes rows encoded with Encode as an object container file,
+// embedding schema in its header and compressing blocks with codec
+func WriteContainer(w io.Writer, schema []byte, codec string, rows [][]byte) error {
+	var sync [16]byte
+	if _, err := rand.Read(sync[:]); err != nil {
+		return fmt.Errorf("failed to generate sync marker: %w", err)
+	}
+
+	header := append([]byte{}, magic...)
+	header = appendLong(header, 2)
+	header = appendBytes(header, []byte("avro.schema"))
+	header = appendBytes(header, schema)
+	header = appendBytes(header, []byte("avro.codec"))
+	header = appendBytes(header, []byte(codec))
+	header = appendLong(header, 0)
+	header = append(header, sync[:]...)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(rows); start += BlockRecords {
+		end := min(start+BlockRecords, len(rows))
+		var block []byte
+		for _, row := range rows[start:end] {
+			block = append(block, row...)
+		}
+		compressed, err := compressBlock(codec, block)
+		if err != nil {
+			return err
+		}
+
+		buf := appendLong(nil, int64(end-start))
+		buf = appendLong(buf, int64(len(compressed)))
+		buf = append(buf, compressed...)
+		buf = append(buf, sync[:]...)
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compressBlock compresses the serialized rows of a block as the Avro
+// specification defines for each codec
+func compressBlock(codec string, block []byte) ([]byte, error) {
+	switch codec {
+	case CodecNull:
+		return block, nil
+	case CodecDeflate:
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(block); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CodecSnappy:
+		// Snappy blocks are followed by the big-endian CRC32 of the uncompressed data
+		compressed := snappy.Encode(nil, block)
+		return binary.BigEndian.AppendUint32(compressed, crc32.ChecksumIEEE(block)), nil
+	case CodecZstandard:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer encoder.Close()
+		return encoder.EncodeAll(block, nil), nil
+	}
+	return nil, fmt.Errorf("unknown Avro codec %q", codec)
+}
+
+// appendBytes appends a length-prefixed Avro bytes or string value
+func appendBytes(buf, v []byte) []byte {
+	buf = appendLong(buf, int64(len(v)))
+	return append(buf, v...)
+}
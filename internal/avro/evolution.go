@@ -0,0 +1,44 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+type schemaFields struct {
+	Name   string `json:"name"`
+	Fields []struct {
+		Name    string          `json:"name"`
+		Type    interface{}     `json:"type"`
+		Default json.RawMessage `json:"default"`
+	} `json:"fields"`
+}
+
+// CheckEvolution reports whether files written with the writer schema can be read
+// with the reader schema. Fields may be removed, and added only with a default, so
+// that readers fill them in for older files; the type of a kept field may not change.
+func CheckEvolution(writer, reader []byte) error {
+	var w, r schemaFields
+	if err := json.Unmarshal(writer, &w); err != nil {
+		return fmt.Errorf("invalid writer schema: %w", err)
+	}
+	if err := json.Unmarshal(reader, &r); err != nil {
+		return fmt.Errorf("invalid reader schema: %w", err)
+	}
+
+	written := make(map[string]interface{}, len(w.Fields))
+	for _, field := range w.Fields {
+		written[field.Name] = field.Type
+	}
+	for _, field := range r.Fields {
+		previous, ok := written[field.Name]
+		switch {
+		case !ok && len(field.Default) == 0:
+			return fmt.Errorf("field %s of %s was added without a default", field.Name, r.Name)
+		case ok && !reflect.DeepEqual(previous, field.Type):
+			return fmt.Errorf("field %s of %s changed type from %v to %v", field.Name, r.Name, previous, field.Type)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package awsauth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSign uses the example request from the AWS Signature Version 4 documentation
+func TestSign(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	creds := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	Sign(req, creds, "us-east-1", "iam", EmptyPayloadHash, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	authorization := req.Header.Get("Authorization")
+	if !strings.Contains(authorization, "SignedHeaders=content-type;host;x-amz-date") {
+		t.Errorf("Unexpected signed headers: %s", authorization)
+	}
+	if !strings.HasSuffix(authorization, "Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7") {
+		t.Errorf("Unexpected signature: %s", authorization)
+	}
+}
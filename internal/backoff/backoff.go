@@ -0,0 +1,56 @@
+// Package backoff holds the retry policy of sink writes, database transactions,
+// cycles and webhook deliveries: a number of attempts with exponentially growing
+// delays between them
+package backoff
+
+import (
+	"context"
+	"time"
+)
+
+// Policy controls how a failed operation is retried
+type Policy struct {
+	// Attempts is the total number of attempts, including the first one
+	Attempts int
+	// Backoff is the delay before the first retry; it doubles on each further retry
+	// up to MaxBackoff, which zero leaves unbounded
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// MaxAttempts returns the number of attempts, at least one
+func (p Policy) MaxAttempts() int {
+	return max(p.Attempts, 1)
+}
+
+// Delay returns the delay before retry number retry, counting from 1
+func (p Policy) Delay(retry int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < retry; i++ {
+		if delay > time.Duration(1<<62) {
+			// Doubling again would overflow
+			break
+		}
+		delay *= 2
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return delay
+}
+
+// Wait sleeps for the delay before retry number retry, returning the error of ctx
+// if it is done first
+func (p Policy) Wait(ctx context.Context, retry int) error {
+	timer := time.NewTimer(p.Delay(retry))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,43 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	policy := Policy{Attempts: 5, Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for retry, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := policy.Delay(retry); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", retry, got, want)
+		}
+	}
+	if got := (Policy{Backoff: 10 * time.Second, MaxBackoff: time.Second}).Delay(1); got != time.Second {
+		t.Errorf("Expected the first delay capped too, got %v", got)
+	}
+	if got := (Policy{Backoff: time.Second}).Delay(100); got <= 0 {
+		t.Errorf("Expected an unbounded delay not to overflow, got %v", got)
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	if got := (Policy{}).MaxAttempts(); got != 1 {
+		t.Errorf("Expected a single attempt by default, got %d", got)
+	}
+	if got := (Policy{Attempts: 3}).MaxAttempts(); got != 3 {
+		t.Errorf("MaxAttempts() = %d, want 3", got)
+	}
+}
+
+func TestWait(t *testing.T) {
+	if err := (Policy{Backoff: time.Millisecond}).Wait(context.Background(), 1); err != nil {
+		t.Errorf("Wait: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := (Policy{Backoff: time.Hour}).Wait(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Wait to return once ctx is done, got %v", err)
+	}
+}
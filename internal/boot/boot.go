@@ -0,0 +1,84 @@
+// Package boot waits for the dependencies of the pipelines, such as the database,
+// the source API and the storage, to become available before they start
+package boot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+// checkTimeout bounds a single check of a dependency
+const checkTimeout = 10 * time.Second
+
+// Config holds how long dependencies are waited for
+type Config struct {
+	// Timeout is the longest the checks of all dependencies may take together;
+	// zero checks each dependency once
+	Timeout time.Duration
+	// Backoff is the delay before a dependency is checked again, doubling with each
+	// failed check up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Dependency is a service the pipelines need at startup
+type Dependency struct {
+	// Name describes the dependency in logs and errors, e.g. database
+	Name string
+	// Check returns an error while the dependency is unavailable
+	Check func(ctx context.Context) error
+}
+
+// Waiter checks dependencies until they are available or the timeout, which all
+// waits share, has passed
+type Waiter struct {
+	cfg      Config
+	deadline time.Time
+	logger   *logging.Logger
+}
+
+// NewWaiter creates a waiter whose timeout starts now
+func NewWaiter(cfg Config, logger *logging.Logger) *Waiter {
+	return &Waiter{cfg: cfg, deadline: time.Now().Add(cfg.Timeout), logger: logger}
+}
+
+// Wait checks each dependency in turn until it is available, returning the last
+// error of the first one that is still unavailable once the timeout has passed
+func (w *Waiter) Wait(ctx context.Context, dependencies ...Dependency) error {
+	for _, dependency := range dependencies {
+		if err := w.wait(ctx, dependency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Waiter) wait(ctx context.Context, dependency Dependency) error {
+	start := time.Now()
+	backoff := w.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		err := dependency.Check(checkCtx)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				w.logger.Info(fmt.Sprintf("%s available after %v", dependency.Name, time.Since(start).Round(time.Millisecond)))
+			}
+			return nil
+		}
+
+		if time.Now().Add(backoff).After(w.deadline) {
+			return fmt.Errorf("%s unavailable after %d attempts: %w", dependency.Name, attempt, err)
+		}
+		w.logger.Warn(fmt.Sprintf("Waiting for %s: %v, checking again in %v", dependency.Name, err, backoff))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s unavailable: %w", dependency.Name, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, w.cfg.MaxBackoff)
+	}
+}
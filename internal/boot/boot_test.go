@@ -0,0 +1,78 @@
+package boot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+func newTestWaiter(t *testing.T, timeout time.Duration) *Waiter {
+	logger, err := logging.NewLogger("test.log")
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	return NewWaiter(Config{Timeout: timeout, Backoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond}, logger)
+}
+
+func TestWaitRetriesUntilAvailable(t *testing.T) {
+	waiter := newTestWaiter(t, time.Second)
+	checks := 0
+	err := waiter.Wait(context.Background(), Dependency{Name: "database", Check: func(context.Context) error {
+		checks++
+		if checks < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}})
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if checks != 3 {
+		t.Errorf("checks = %d, want 3", checks)
+	}
+}
+
+func TestWaitGivesUpAfterTimeout(t *testing.T) {
+	waiter := newTestWaiter(t, 20*time.Millisecond)
+	checked := false
+	err := waiter.Wait(context.Background(),
+		Dependency{Name: "source", Check: func(context.Context) error { return errors.New("no such host") }},
+		Dependency{Name: "storage", Check: func(context.Context) error { checked = true; return nil }},
+	)
+	if err == nil || !strings.Contains(err.Error(), "source unavailable") || !strings.Contains(err.Error(), "no such host") {
+		t.Fatalf("Wait = %v, want source unavailable", err)
+	}
+	if checked {
+		t.Error("storage checked after the source was given up on")
+	}
+}
+
+func TestWaitWithoutTimeoutChecksOnce(t *testing.T) {
+	waiter := newTestWaiter(t, 0)
+	checks := 0
+	err := waiter.Wait(context.Background(), Dependency{Name: "database", Check: func(context.Context) error {
+		checks++
+		return errors.New("connection refused")
+	}})
+	if err == nil {
+		t.Fatal("Wait succeeded with an unavailable dependency")
+	}
+	if checks != 1 {
+		t.Errorf("checks = %d, want 1", checks)
+	}
+}
+
+func TestWaitStopsWhenCancelled(t *testing.T) {
+	waiter := NewWaiter(Config{Timeout: time.Hour, Backoff: time.Minute, MaxBackoff: time.Minute}, newTestWaiter(t, 0).logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := waiter.Wait(ctx, Dependency{Name: "database", Check: func(context.Context) error { return errors.New("connection refused") }})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Package cache keeps short-lived lookup values, such as the enrichment lookups and
+// the dedup key set of the pipelines, in process memory or in Redis so that large
+// sets can be shared by instances instead of living in each process
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache holds string values by key until their TTL passes
+type Cache interface {
+	// Get returns the values of the keys found; missing and expired keys are left out
+	Get(ctx context.Context, keys ...string) (map[string]string, error)
+	// Set stores entries that expire after ttl; zero keeps them until deleted
+	Set(ctx context.Context, entries map[string]string, ttl time.Duration) error
+	// Delete removes keys, ignoring those not found
+	Delete(ctx context.Context, keys ...string) error
+	// Ping returns an error while the cache is unavailable
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Prefixed returns a view of c whose keys all start with prefix, so that several
+// sets share one cache, e.g. one Redis connection, without colliding. Closing the
+// view closes c.
+func Prefixed(c Cache, prefix string) Cache {
+	return &prefixed{Cache: c, prefix: prefix}
+}
+
+type prefixed struct {
+	Cache
+	prefix string
+}
+
+func (p *prefixed) Get(ctx context.Context, keys ...string) (map[string]string, error) {
+	found, err := p.Cache.Get(ctx, p.keys(keys)...)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(found))
+	for key, value := range found {
+		values[key[len(p.prefix):]] = value
+	}
+	return values, nil
+}
+
+func (p *prefixed) Set(ctx context.Context, entries map[string]string, ttl time.Duration) error {
+	prefixed := make(map[string]string, len(entries))
+	for key, value := range entries {
+		prefixed[p.prefix+key] = value
+	}
+	return p.Cache.Set(ctx, prefixed, ttl)
+}
+
+func (p *prefixed) Delete(ctx context.Context, keys ...string) error {
+	return p.Cache.Delete(ctx, p.keys(keys)...)
+}
+
+func (p *prefixed) keys(keys []string) []string {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = p.prefix + key
+	}
+	return prefixed
+}
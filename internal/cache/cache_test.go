@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testCache stores, expires and deletes entries of cache. expire moves the
+// cache's clock past ttl.
+func testCache(t *testing.T, cache Cache, expire func(ttl time.Duration)) {
+	ctx := context.Background()
+	if err := cache.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if err := cache.Set(ctx, map[string]string{"a": "1", "b": "2"}, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := cache.Set(ctx, map[string]string{"kept": "3"}, 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	values, err := cache.Get(ctx, "a", "b", "missing", "kept")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(values) != 3 || values["a"] != "1" || values["b"] != "2" || values["kept"] != "3" {
+		t.Errorf("Expected the values set, got %v", values)
+	}
+
+	if err := cache.Delete(ctx, "a", "missing"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if values, _ := cache.Get(ctx, "a", "b"); len(values) != 1 || values["b"] != "2" {
+		t.Errorf("Expected the deleted key to be gone, got %v", values)
+	}
+
+	expire(time.Minute)
+	if values, _ := cache.Get(ctx, "b", "kept"); len(values) != 1 || values["kept"] != "3" {
+		t.Errorf("Expected only the key without a TTL after it passed, got %v", values)
+	}
+	if values, err := cache.Get(ctx); err != nil || len(values) != 0 {
+		t.Errorf("Expected no values without keys, got %v, %v", values, err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	cache := NewMemory()
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	testCache(t, cache, func(ttl time.Duration) { now = now.Add(ttl) })
+
+	// The next Set sweeps the expired entries
+	now = now.Add(sweepInterval)
+	cache.Set(context.Background(), map[string]string{"c": "4"}, time.Minute)
+	if len(cache.entries) != 2 {
+		t.Errorf("Expected expired entries to be swept, got %v", cache.entries)
+	}
+}
+
+func TestPrefixed(t *testing.T) {
+	memory := NewMemory()
+	now := time.Now()
+	memory.now = func() time.Time { return now }
+	testCache(t, Prefixed(memory, "dedup:"), func(ttl time.Duration) { now = now.Add(ttl) })
+
+	if _, ok := memory.entries["dedup:kept"]; !ok {
+		t.Errorf("Expected the keys to be prefixed, got %v", memory.entries)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+	cache, err := NewRedis(RedisConfig{URL: "redis://" + server.Addr() + "/0", Prefix: "etl:default:", Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewRedis: %v", err)
+	}
+	defer cache.Close()
+	testCache(t, cache, server.FastForward)
+
+	if !server.Exists("etl:default:kept") || server.Exists("kept") {
+		t.Errorf("Expected the keys to be prefixed, got %v", server.Keys())
+	}
+
+	server.Close()
+	if err := cache.Ping(context.Background()); err == nil {
+		t.Error("Expected Ping to fail once the server is gone")
+	}
+	if _, err := cache.Get(context.Background(), "kept"); err == nil {
+		t.Error("Expected Get to fail once the server is gone")
+	}
+}
+
+func TestNewRedisRejectsInvalidURLs(t *testing.T) {
+	for _, url := range []string{"http://cache:6379", "redis://:secret@cache:6379/db"} {
+		if _, err := NewRedis(RedisConfig{URL: url}); err == nil {
+			t.Errorf("%s: expected the URL to be rejected", url)
+		}
+	}
+}
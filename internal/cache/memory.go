@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often Set removes the expired entries of a memory cache
+const sweepInterval = time.Minute
+
+// Memory is a cache in process memory, for a single instance
+type Memory struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+type memoryEntry struct {
+	value string
+	// expires is zero for entries kept until deleted
+	expires time.Time
+}
+
+// NewMemory creates an empty memory cache
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+// Get returns the values of the keys found and not expired
+func (m *Memory) Get(ctx context.Context, keys ...string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if entry, ok := m.entries[key]; ok && !entry.expired(now) {
+			values[key] = entry.value
+		}
+	}
+	return values, nil
+}
+
+// Set stores entries expiring after ttl, removing expired entries at most once
+// per sweep interval so they do not pile up
+func (m *Memory) Set(ctx context.Context, entries map[string]string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if now.After(m.nextSweep) {
+		for key, entry := range m.entries {
+			if entry.expired(now) {
+				delete(m.entries, key)
+			}
+		}
+		m.nextSweep = now.Add(sweepInterval)
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = now.Add(ttl)
+	}
+	for key, value := range entries {
+		m.entries[key] = memoryEntry{value: value, expires: expires}
+	}
+	return nil
+}
+
+// Delete removes keys
+func (m *Memory) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+// Ping always succeeds
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close drops the entries
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]memoryEntry)
+	return nil
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
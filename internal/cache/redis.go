@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisConfig holds the connection settings of a Redis cache
+type RedisConfig struct {
+	// URL is the server, e.g. redis://:password@cache:6379/0, or rediss:// for TLS
+	URL string
+	// Prefix namespaces the keys, e.g. etl:default:
+	Prefix string
+	// Timeout bounds connecting and each command; zero keeps the client defaults
+	Timeout time.Duration
+}
+
+// Redis is a cache in a Redis server, shared by the instances using it
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis creates a Redis cache. It does not connect until first used; Ping
+// checks the server is reachable.
+func NewRedis(cfg RedisConfig) (*Redis, error) {
+	if !strings.HasPrefix(cfg.URL, "redis://") && !strings.HasPrefix(cfg.URL, "rediss://") {
+		return nil, fmt.Errorf("invalid Redis URL: expected redis:// or rediss://")
+	}
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		// The error may quote the URL, password included
+		return nil, fmt.Errorf("invalid Redis URL")
+	}
+	if cfg.Timeout > 0 {
+		opts.DialTimeout = cfg.Timeout
+		opts.ReadTimeout = cfg.Timeout
+		opts.WriteTimeout = cfg.Timeout
+	}
+	return &Redis{client: redis.NewClient(opts), prefix: cfg.Prefix}, nil
+}
+
+// Get returns the values of the keys found with one MGET
+func (c *Redis) Get(ctx context.Context, keys ...string) (map[string]string, error) {
+	values := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+	results, err := c.client.MGet(ctx, c.keys(keys)...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis MGET failed: %w", err)
+	}
+	for i, result := range results {
+		if value, ok := result.(string); ok {
+			values[keys[i]] = value
+		}
+	}
+	return values, nil
+}
+
+// Set stores entries with one pipeline of SET commands
+func (c *Redis) Set(ctx context.Context, entries map[string]string, ttl time.Duration) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, value := range entries {
+			pipe.Set(ctx, c.prefix+key, value, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redis SET failed: %w", err)
+	}
+	return nil
+}
+
+// Delete removes keys with one DEL
+func (c *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := c.client.Del(ctx, c.keys(keys)...).Err(); err != nil {
+		return fmt.Errorf("redis DEL failed: %w", err)
+	}
+	return nil
+}
+
+// Ping checks the server answers
+func (c *Redis) Ping(ctx context.Context) error {
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("redis PING failed: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connections to the server
+func (c *Redis) Close() error {
+	return c.client.Close()
+}
+
+// keys returns keys with the prefix
+func (c *Redis) keys(keys []string) []string {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.prefix + key
+	}
+	return prefixed
+}
@@ -0,0 +1,181 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Codec names
+const (
+	None   = "none"
+	Gzip   = "gzip"
+	Zstd   = "zstd"
+	Snappy = "snappy"
+	LZ4    = "lz4"
+)
+
+// Codec compresses and decompresses streams in one format
+type Codec interface {
+	Name() string
+	// Extension is appended to the names of files and objects written with the codec
+	Extension() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var codecs = map[string]Codec{
+	None:   noneCodec{},
+	Gzip:   gzipCodec{},
+	Zstd:   zstdCodec{},
+	Snappy: snappyCodec{},
+	LZ4:    lz4Codec{},
+}
+
+// Get returns the codec with the given name; an empty name means no compression
+func Get(name string) (Codec, error) {
+	if name == "" {
+		return codecs[None], nil
+	}
+	c, ok := codecs[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression codec %q, expected one of %s", name, strings.Join(Names(), ", "))
+	}
+	return c, nil
+}
+
+// WithLevel returns the codec compressing at the given level, 1-9 for gzip and
+// 1-22 for zstd; zero keeps the codec's default level
+func WithLevel(c Codec, level int) (Codec, error) {
+	if level == 0 {
+		return c, nil
+	}
+	switch c.(type) {
+	case gzipCodec:
+		if level < gzip.BestSpeed || level > gzip.BestCompression {
+			return nil, fmt.Errorf("invalid gzip level %d, expected %d-%d", level, gzip.BestSpeed, gzip.BestCompression)
+		}
+		return gzipCodec{level: level}, nil
+	case zstdCodec:
+		if level < 1 || level > 22 {
+			return nil, fmt.Errorf("invalid zstd level %d, expected 1-22", level)
+		}
+		return zstdCodec{level: level}, nil
+	}
+	return nil, fmt.Errorf("compression level is not supported by %s", c.Name())
+}
+
+// Names returns the names of the supported codecs
+func Names() []string {
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForFile returns the codec a file was written with, detected from its extension
+func ForFile(filename string) Codec {
+	for _, c := range codecs {
+		if ext := c.Extension(); ext != "" && strings.HasSuffix(filename, ext) {
+			return c
+		}
+	}
+	return codecs[None]
+}
+
+// Compress compresses data in memory
+func Compress(c Codec, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := c.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to compress with %s: %w", c.Name(), err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress with %s: %w", c.Name(), err)
+	}
+	return buf.Bytes(), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+type noneCodec struct{}
+
+func (noneCodec) Name() string                                  { return None }
+func (noneCodec) Extension() string                             { return "" }
+func (noneCodec) NewWriter(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil }
+func (noneCodec) NewReader(r io.Reader) (io.ReadCloser, error)  { return io.NopCloser(r), nil }
+
+// gzipCodec compresses at level, or the default level when zero
+type gzipCodec struct {
+	level int
+}
+
+func (gzipCodec) Name() string      { return Gzip }
+func (gzipCodec) Extension() string { return ".gz" }
+func (c gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if c.level == 0 {
+		return gzip.NewWriter(w), nil
+	}
+	return gzip.NewWriterLevel(w, c.level)
+}
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }
+
+// zstdCodec compresses at the zstd level, or the default level when zero
+type zstdCodec struct {
+	level int
+}
+
+func (zstdCodec) Name() string      { return Zstd }
+func (zstdCodec) Extension() string { return ".zst" }
+func (c zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if c.level == 0 {
+		return zstd.NewWriter(w)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.level)))
+}
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+// snappyCodec uses the snappy framing format, since raw snappy blocks cannot be streamed
+type snappyCodec struct{}
+
+func (snappyCodec) Name() string      { return Snappy }
+func (snappyCodec) Extension() string { return ".sz" }
+func (snappyCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+func (snappyCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(snappy.NewReader(r)), nil
+}
+
+// lz4Codec uses the LZ4 frame format
+type lz4Codec struct{}
+
+func (lz4Codec) Name() string                                  { return LZ4 }
+func (lz4Codec) Extension() string                             { return ".lz4" }
+func (lz4Codec) NewWriter(w io.Writer) (io.WriteCloser, error) { return lz4.NewWriter(w), nil }
+func (lz4Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(r)), nil
+}
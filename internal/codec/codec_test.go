@@ -0,0 +1,98 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat(`{"user_id":1,"title":"Title","body":"Body"}`+"\n", 100))
+
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			c, err := Get(name)
+			if err != nil {
+				t.Fatalf("Get(%q) failed: %v", name, err)
+			}
+
+			compressed, err := Compress(c, data)
+			if err != nil {
+				t.Fatalf("Compress failed: %v", err)
+			}
+			if name != None && len(compressed) >= len(data) {
+				t.Errorf("Expected %s to shrink %d bytes, got %d", name, len(data), len(compressed))
+			}
+
+			reader, err := c.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("NewReader failed: %v", err)
+			}
+			defer reader.Close()
+			decompressed, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("Decompress failed: %v", err)
+			}
+			if !bytes.Equal(decompressed, data) {
+				t.Errorf("Round trip changed the data")
+			}
+
+			if got := ForFile("batch.json" + c.Extension()).Name(); got != name {
+				t.Errorf("ForFile detected %s, expected %s", got, name)
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	if c, err := Get(""); err != nil || c.Name() != None {
+		t.Errorf("Expected empty name to mean no compression, got %v, %v", c, err)
+	}
+	if c, err := Get("ZSTD"); err != nil || c.Name() != Zstd {
+		t.Errorf("Expected codec names to be case-insensitive, got %v, %v", c, err)
+	}
+	if _, err := Get("brotli"); err == nil {
+		t.Error("Expected an error for an unknown codec")
+	}
+}
+
+func TestWithLevel(t *testing.T) {
+	data := []byte(strings.Repeat(`{"user_id":1,"title":"Title","body":"Body"}`+"\n", 100))
+
+	for _, tt := range []struct {
+		name  string
+		level int
+	}{{Gzip, 9}, {Zstd, 19}} {
+		c, _ := Get(tt.name)
+		leveled, err := WithLevel(c, tt.level)
+		if err != nil {
+			t.Fatalf("WithLevel(%s, %d) failed: %v", tt.name, tt.level, err)
+		}
+		compressed, err := Compress(leveled, data)
+		if err != nil {
+			t.Fatalf("Compress failed: %v", err)
+		}
+		reader, err := c.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("NewReader failed: %v", err)
+		}
+		decompressed, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil || !bytes.Equal(decompressed, data) {
+			t.Errorf("Round trip at %s level %d changed the data: %v", tt.name, tt.level, err)
+		}
+	}
+
+	gz, _ := Get(Gzip)
+	if _, err := WithLevel(gz, 12); err == nil {
+		t.Error("Expected an error for an out of range gzip level")
+	}
+	sz, _ := Get(Snappy)
+	if _, err := WithLevel(sz, 3); err == nil {
+		t.Error("Expected an error for a codec without levels")
+	}
+	if c, err := WithLevel(sz, 0); err != nil || c.Name() != Snappy {
+		t.Errorf("Expected level 0 to keep the codec, got %v, %v", c, err)
+	}
+}
@@ -0,0 +1,825 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// fileSettings holds the settings of CONFIG_FILE by the environment variable they
+// stand for; environment variables that are set override them
+var fileSettings map[string]string
+
+// fileConfig is the structure of a CONFIG_FILE. Each setting stands for an
+// environment variable, named in its comment where it is not obvious.
+type fileConfig struct {
+	Server struct {
+		Port *int `yaml:"port" toml:"port"`
+		// Auth holds the HTTP_AUTH_ settings
+		Auth struct {
+			ReadTokens    []string          `yaml:"read_tokens" toml:"read_tokens"`
+			ControlTokens []string          `yaml:"control_tokens" toml:"control_tokens"`
+			ReadUsers     map[string]string `yaml:"read_users" toml:"read_users"`
+			ControlUsers  map[string]string `yaml:"control_users" toml:"control_users"`
+			PublicProbes  *bool             `yaml:"public_probes" toml:"public_probes"`
+			OIDC          struct {
+				Issuer      string `yaml:"issuer" toml:"issuer"`
+				Audience    string `yaml:"audience" toml:"audience"`
+				RolesClaim  string `yaml:"roles_claim" toml:"roles_claim"`
+				ReadRole    string `yaml:"read_role" toml:"read_role"`
+				ControlRole string `yaml:"control_role" toml:"control_role"`
+			} `yaml:"oidc" toml:"oidc"`
+		} `yaml:"auth" toml:"auth"`
+		AccessLog *bool `yaml:"access_log" toml:"access_log"`
+		// RateLimit is HTTP_RATE_LIMIT and HTTP_RATE_LIMIT_BURST
+		RateLimit struct {
+			RequestsPerSecond *float64 `yaml:"requests_per_second" toml:"requests_per_second"`
+			Burst             *int     `yaml:"burst" toml:"burst"`
+		} `yaml:"rate_limit" toml:"rate_limit"`
+		ClientIPHeader string   `yaml:"client_ip_header" toml:"client_ip_header"`
+		CORSOrigins    []string `yaml:"cors_origins" toml:"cors_origins"`
+	} `yaml:"server" toml:"server"`
+	// PipelinesFile is PIPELINES_FILE, defining several pipelines
+	PipelinesFile string `yaml:"pipelines_file" toml:"pipelines_file"`
+
+	Source struct {
+		URL     string `yaml:"url" toml:"url"`
+		Token   string `yaml:"token" toml:"token"`
+		Sandbox struct {
+			URL   string `yaml:"url" toml:"url"`
+			Token string `yaml:"token" toml:"token"`
+		} `yaml:"sandbox" toml:"sandbox"`
+		Env        string `yaml:"env" toml:"env"`
+		Compare    *bool  `yaml:"compare" toml:"compare"`
+		CompareKey string `yaml:"compare_key" toml:"compare_key"`
+		// Endpoints are API_ENDPOINTS by name
+		Endpoints           map[string]string `yaml:"endpoints" toml:"endpoints"`
+		EndpointParallelism *int              `yaml:"endpoint_parallelism" toml:"endpoint_parallelism"`
+		// Timeout is EXTRACT_TIMEOUT
+		Timeout string `yaml:"timeout" toml:"timeout"`
+		// Quarantine is QUARANTINE_ENABLED
+		Quarantine         *bool `yaml:"quarantine" toml:"quarantine"`
+		QuarantineMaxBytes *int  `yaml:"quarantine_max_bytes" toml:"quarantine_max_bytes"`
+		// Method and RequestBody are API_METHOD and API_REQUEST_BODY
+		Method          string `yaml:"method" toml:"method"`
+		RequestBody     string `yaml:"request_body" toml:"request_body"`
+		UserAgent       string `yaml:"user_agent" toml:"user_agent"`
+		RequestIDHeader string `yaml:"request_id_header" toml:"request_id_header"`
+		// DumpFailures is API_DUMP_FAILURES
+		DumpFailures *bool `yaml:"dump_failures" toml:"dump_failures"`
+		// Type is SOURCE_TYPE
+		Type string `yaml:"type" toml:"type"`
+		// SQS holds the SQS_ settings
+		SQS struct {
+			QueueURL          string `yaml:"queue_url" toml:"queue_url"`
+			DLQURL            string `yaml:"dlq_url" toml:"dlq_url"`
+			MaxMessages       *int   `yaml:"max_messages" toml:"max_messages"`
+			WaitTime          string `yaml:"wait_time" toml:"wait_time"`
+			VisibilityTimeout string `yaml:"visibility_timeout" toml:"visibility_timeout"`
+			MaxReceives       *int   `yaml:"max_receives" toml:"max_receives"`
+		} `yaml:"sqs" toml:"sqs"`
+		// Kinesis holds the KINESIS_ settings
+		Kinesis struct {
+			Stream        string `yaml:"stream" toml:"stream"`
+			Endpoint      string `yaml:"endpoint" toml:"endpoint"`
+			StartPosition string `yaml:"start_position" toml:"start_position"`
+			MaxRecords    *int   `yaml:"max_records" toml:"max_records"`
+			BatchSize     *int   `yaml:"batch_size" toml:"batch_size"`
+		} `yaml:"kinesis" toml:"kinesis"`
+	} `yaml:"source" toml:"source"`
+
+	Schedule struct {
+		// Interval is FETCH_INTERVAL as a duration, Cron is SCHEDULE
+		Interval string    `yaml:"interval" toml:"interval"`
+		Cron     string    `yaml:"cron" toml:"cron"`
+		Timezone string    `yaml:"timezone" toml:"timezone"`
+		Overlap  string    `yaml:"overlap" toml:"overlap"`
+		Budget   string    `yaml:"budget" toml:"budget"`
+		Timeout  string    `yaml:"timeout" toml:"timeout"`
+		Retry    fileRetry `yaml:"retry" toml:"retry"`
+		DryRun   *bool     `yaml:"dry_run" toml:"dry_run"`
+		RunOnce  *bool     `yaml:"run_once" toml:"run_once"`
+		// DrainTimeout is SHUTDOWN_DRAIN_TIMEOUT
+		DrainTimeout string `yaml:"drain_timeout" toml:"drain_timeout"`
+		// PersistState is SCHEDULER_STATE_ENABLED
+		PersistState *bool `yaml:"persist_state" toml:"persist_state"`
+	} `yaml:"schedule" toml:"schedule"`
+
+	// Boot holds the BOOT_WAIT_ settings
+	Boot struct {
+		WaitTimeout string `yaml:"wait_timeout" toml:"wait_timeout"`
+		Backoff     string `yaml:"backoff" toml:"backoff"`
+		MaxBackoff  string `yaml:"max_backoff" toml:"max_backoff"`
+	} `yaml:"boot" toml:"boot"`
+
+	Database struct {
+		URL         string    `yaml:"url" toml:"url"`
+		AutoMigrate *bool     `yaml:"auto_migrate" toml:"auto_migrate"`
+		Retry       fileRetry `yaml:"retry" toml:"retry"`
+		Pool        filePool  `yaml:"pool" toml:"pool"`
+		ReadURL     string    `yaml:"read_url" toml:"read_url"`
+		ReadPool    filePool  `yaml:"read_pool" toml:"read_pool"`
+		SlowQuery   string    `yaml:"slow_query_threshold" toml:"slow_query_threshold"`
+		Maintenance struct {
+			Interval string   `yaml:"interval" toml:"interval"`
+			Command  string   `yaml:"command" toml:"command"`
+			Tables   []string `yaml:"tables" toml:"tables"`
+		} `yaml:"maintenance" toml:"maintenance"`
+		FileFallback   *bool    `yaml:"file_fallback" toml:"file_fallback"`
+		Transactional  *bool    `yaml:"transactional_writes" toml:"transactional_writes"`
+		RawPassthrough *bool    `yaml:"raw_passthrough" toml:"raw_passthrough"`
+		RawBlobs       *bool    `yaml:"raw_blobs" toml:"raw_blobs"`
+		RawStorage     string   `yaml:"raw_storage" toml:"raw_storage"`
+		RawSampleRate  *float64 `yaml:"raw_sample_rate" toml:"raw_sample_rate"`
+		Checkpoints    *bool    `yaml:"checkpoints" toml:"checkpoints"`
+		LoadStrategy   string   `yaml:"load_strategy" toml:"load_strategy"`
+		StoreTimeout   string   `yaml:"store_timeout" toml:"store_timeout"`
+	} `yaml:"database" toml:"database"`
+
+	// Stream holds the STREAM_ settings of the streaming pipeline core
+	Stream struct {
+		Workers       *int   `yaml:"workers" toml:"workers"`
+		Buffer        *int   `yaml:"buffer" toml:"buffer"`
+		BatchSize     *int   `yaml:"batch_size" toml:"batch_size"`
+		FlushInterval string `yaml:"flush_interval" toml:"flush_interval"`
+		MaxInFlight   *int   `yaml:"max_in_flight" toml:"max_in_flight"`
+		MaxBatchBytes *int   `yaml:"max_batch_bytes" toml:"max_batch_bytes"`
+	} `yaml:"stream" toml:"stream"`
+
+	Transform struct {
+		AuditSampleRate *float64          `yaml:"audit_sample_rate" toml:"audit_sample_rate"`
+		FieldSources    map[string]string `yaml:"field_sources" toml:"field_sources"`
+		DeleteRule      string            `yaml:"delete_rule" toml:"delete_rule"`
+		DeleteMode      string            `yaml:"delete_mode" toml:"delete_mode"`
+		// Timestamp holds the TRANSFORM_TIMESTAMP_ settings
+		Timestamp struct {
+			Field    string   `yaml:"field" toml:"field"`
+			Formats  []string `yaml:"formats" toml:"formats"`
+			SourceTZ string   `yaml:"source_tz" toml:"source_tz"`
+			TargetTZ string   `yaml:"target_tz" toml:"target_tz"`
+			Type     string   `yaml:"type" toml:"type"`
+		} `yaml:"timestamp" toml:"timestamp"`
+	} `yaml:"transform" toml:"transform"`
+
+	Enrich struct {
+		URL    string            `yaml:"url" toml:"url"`
+		Key    string            `yaml:"key" toml:"key"`
+		Fields map[string]string `yaml:"fields" toml:"fields"`
+		TTL    string            `yaml:"ttl" toml:"ttl"`
+	} `yaml:"enrich" toml:"enrich"`
+
+	Dedup struct {
+		TTL string `yaml:"ttl" toml:"ttl"`
+	} `yaml:"dedup" toml:"dedup"`
+
+	// Redis caches the enrichment lookups and the dedup key set
+	Redis struct {
+		URL       string `yaml:"url" toml:"url"`
+		KeyPrefix string `yaml:"key_prefix" toml:"key_prefix"`
+		Timeout   string `yaml:"timeout" toml:"timeout"`
+	} `yaml:"redis" toml:"redis"`
+
+	Sinks struct {
+		Postgres             *bool     `yaml:"postgres" toml:"postgres"`
+		PostgresWorkers      *int      `yaml:"postgres_workers" toml:"postgres_workers"`
+		PostgresPartitionKey string    `yaml:"postgres_partition_key" toml:"postgres_partition_key"`
+		Retry                fileRetry `yaml:"retry" toml:"retry"`
+		LoadTimeout          string    `yaml:"load_timeout" toml:"load_timeout"`
+		Kafka                struct {
+			Brokers       []string `yaml:"brokers" toml:"brokers"`
+			Topic         string   `yaml:"topic" toml:"topic"`
+			KeyField      string   `yaml:"key_field" toml:"key_field"`
+			Serialization string   `yaml:"serialization" toml:"serialization"`
+			RequiredAcks  string   `yaml:"required_acks" toml:"required_acks"`
+		} `yaml:"kafka" toml:"kafka"`
+		// Changes holds the CHANGE_EVENTS_ settings
+		Changes struct {
+			Target string `yaml:"target" toml:"target"`
+			Topic  string `yaml:"topic" toml:"topic"`
+		} `yaml:"changes" toml:"changes"`
+		// SchemaRegistry holds the SCHEMA_REGISTRY_ settings
+		SchemaRegistry struct {
+			URL         string `yaml:"url" toml:"url"`
+			Username    string `yaml:"username" toml:"username"`
+			Password    string `yaml:"password" toml:"password"`
+			FileSubject string `yaml:"file_subject" toml:"file_subject"`
+		} `yaml:"schema_registry" toml:"schema_registry"`
+		S3 struct {
+			Bucket    string `yaml:"bucket" toml:"bucket"`
+			Prefix    string `yaml:"prefix" toml:"prefix"`
+			Endpoint  string `yaml:"endpoint" toml:"endpoint"`
+			PathStyle *bool  `yaml:"path_style" toml:"path_style"`
+		} `yaml:"s3" toml:"s3"`
+		BigQuery struct {
+			Project         string `yaml:"project" toml:"project"`
+			Dataset         string `yaml:"dataset" toml:"dataset"`
+			Table           string `yaml:"table" toml:"table"`
+			CredentialsFile string `yaml:"credentials_file" toml:"credentials_file"`
+		} `yaml:"bigquery" toml:"bigquery"`
+		// RemoteWrite holds the PROMETHEUS_REMOTE_WRITE_ settings
+		RemoteWrite struct {
+			URL      string            `yaml:"url" toml:"url"`
+			Metrics  map[string]string `yaml:"metrics" toml:"metrics"`
+			Labels   map[string]string `yaml:"labels" toml:"labels"`
+			Token    string            `yaml:"token" toml:"token"`
+			Username string            `yaml:"username" toml:"username"`
+			Password string            `yaml:"password" toml:"password"`
+			Timeout  string            `yaml:"timeout" toml:"timeout"`
+		} `yaml:"remote_write" toml:"remote_write"`
+		// Snowflake holds the SNOWFLAKE_ settings
+		Snowflake struct {
+			Account        string   `yaml:"account" toml:"account"`
+			Endpoint       string   `yaml:"endpoint" toml:"endpoint"`
+			User           string   `yaml:"user" toml:"user"`
+			Role           string   `yaml:"role" toml:"role"`
+			Warehouse      string   `yaml:"warehouse" toml:"warehouse"`
+			Database       string   `yaml:"database" toml:"database"`
+			Schema         string   `yaml:"schema" toml:"schema"`
+			Table          string   `yaml:"table" toml:"table"`
+			PrivateKeyFile string   `yaml:"private_key_file" toml:"private_key_file"`
+			Token          string   `yaml:"token" toml:"token"`
+			Stage          string   `yaml:"stage" toml:"stage"`
+			StageBucket    string   `yaml:"stage_bucket" toml:"stage_bucket"`
+			StagePrefix    string   `yaml:"stage_prefix" toml:"stage_prefix"`
+			MergeKeys      []string `yaml:"merge_keys" toml:"merge_keys"`
+		} `yaml:"snowflake" toml:"snowflake"`
+		// Redshift holds the REDSHIFT_ settings
+		Redshift struct {
+			Cluster     string `yaml:"cluster" toml:"cluster"`
+			Workgroup   string `yaml:"workgroup" toml:"workgroup"`
+			Database    string `yaml:"database" toml:"database"`
+			DBUser      string `yaml:"db_user" toml:"db_user"`
+			SecretARN   string `yaml:"secret_arn" toml:"secret_arn"`
+			Schema      string `yaml:"schema" toml:"schema"`
+			Table       string `yaml:"table" toml:"table"`
+			IAMRole     string `yaml:"iam_role" toml:"iam_role"`
+			StageBucket string `yaml:"stage_bucket" toml:"stage_bucket"`
+			StagePrefix string `yaml:"stage_prefix" toml:"stage_prefix"`
+			Endpoint    string `yaml:"endpoint" toml:"endpoint"`
+		} `yaml:"redshift" toml:"redshift"`
+		// MongoDB holds the MONGODB_ settings
+		MongoDB struct {
+			URI          string   `yaml:"uri" toml:"uri"`
+			Database     string   `yaml:"database" toml:"database"`
+			Collection   string   `yaml:"collection" toml:"collection"`
+			Keys         []string `yaml:"keys" toml:"keys"`
+			WriteConcern string   `yaml:"write_concern" toml:"write_concern"`
+			Journal      *bool    `yaml:"journal" toml:"journal"`
+			WriteTimeout string   `yaml:"write_timeout" toml:"write_timeout"`
+			Timeout      string   `yaml:"timeout" toml:"timeout"`
+		} `yaml:"mongodb" toml:"mongodb"`
+	} `yaml:"sinks" toml:"sinks"`
+
+	Observability struct {
+		Log struct {
+			MaxSizeMB  *int   `yaml:"max_size_mb" toml:"max_size_mb"`
+			MaxAge     string `yaml:"max_age" toml:"max_age"`
+			MaxBackups *int   `yaml:"max_backups" toml:"max_backups"`
+			Compress   *bool  `yaml:"compress" toml:"compress"`
+			Level      string `yaml:"level" toml:"level"`
+			File       *bool  `yaml:"file" toml:"file"`
+			Syslog     string `yaml:"syslog" toml:"syslog"`
+			Ship       string `yaml:"ship" toml:"ship"`
+		} `yaml:"log" toml:"log"`
+		Tracing struct {
+			// Endpoint is OTEL_EXPORTER_OTLP_ENDPOINT
+			Endpoint    string   `yaml:"endpoint" toml:"endpoint"`
+			ServiceName string   `yaml:"service_name" toml:"service_name"`
+			SampleRatio *float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+		} `yaml:"tracing" toml:"tracing"`
+		Metrics struct {
+			Exporter       string `yaml:"exporter" toml:"exporter"`
+			ExportInterval string `yaml:"export_interval" toml:"export_interval"`
+			PushgatewayURL string `yaml:"pushgateway_url" toml:"pushgateway_url"`
+			PushJob        string `yaml:"push_job" toml:"push_job"`
+			StatsDAddr     string `yaml:"statsd_addr" toml:"statsd_addr"`
+			StatsDPrefix   string `yaml:"statsd_prefix" toml:"statsd_prefix"`
+		} `yaml:"metrics" toml:"metrics"`
+		// FreshnessSLO is FRESHNESS_SLO
+		FreshnessSLO string `yaml:"freshness_slo" toml:"freshness_slo"`
+		Alerts       struct {
+			SlackWebhookURL string   `yaml:"slack_webhook_url" toml:"slack_webhook_url"`
+			EmailTo         []string `yaml:"email_to" toml:"email_to"`
+			EmailFrom       string   `yaml:"email_from" toml:"email_from"`
+			SMTPHost        string   `yaml:"smtp_host" toml:"smtp_host"`
+			SMTPPort        *int     `yaml:"smtp_port" toml:"smtp_port"`
+			ErrorRate       *float64 `yaml:"error_rate" toml:"error_rate"`
+			SLA             string   `yaml:"sla" toml:"sla"`
+			RepeatInterval  string   `yaml:"repeat_interval" toml:"repeat_interval"`
+		} `yaml:"alerts" toml:"alerts"`
+	} `yaml:"observability" toml:"observability"`
+
+	Secrets struct {
+		VaultAddr              string `yaml:"vault_addr" toml:"vault_addr"`
+		VaultNamespace         string `yaml:"vault_namespace" toml:"vault_namespace"`
+		SecretsManagerEndpoint string `yaml:"secrets_manager_endpoint" toml:"secrets_manager_endpoint"`
+		SOPSBinary             string `yaml:"sops_binary" toml:"sops_binary"`
+		RefreshInterval        string `yaml:"refresh_interval" toml:"refresh_interval"`
+	} `yaml:"secrets" toml:"secrets"`
+}
+
+// filePool is a database connection pool of a CONFIG_FILE
+type filePool struct {
+	MaxOpen     *int   `yaml:"max_open" toml:"max_open"`
+	MaxIdle     *int   `yaml:"max_idle" toml:"max_idle"`
+	MaxLifetime string `yaml:"max_lifetime" toml:"max_lifetime"`
+}
+
+// fileRetry is a retry policy of a CONFIG_FILE
+type fileRetry struct {
+	Attempts   *int   `yaml:"attempts" toml:"attempts"`
+	Backoff    string `yaml:"backoff" toml:"backoff"`
+	MaxBackoff string `yaml:"max_backoff" toml:"max_backoff"`
+}
+
+// loadFile reads a CONFIG_FILE in YAML or TOML, by its extension, expanding
+// ${VAR} references to environment variables. It returns the settings of the
+// file by the environment variable they stand for.
+func loadFile(filename string) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	data = []byte(os.ExpandEnv(string(data)))
+
+	var file fileConfig
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file %s: %s", filename, yamlErrors(err))
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), &file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", filename, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return nil, fmt.Errorf("failed to parse config file %s: unknown keys %s", filename, strings.Join(keys, ", "))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file %s, expected .yaml, .yml or .toml", filename)
+	}
+
+	s := fileSettingsOf(&file)
+	if len(s.problems) > 0 {
+		return nil, fmt.Errorf("invalid config file %s: %s", filename, strings.Join(s.problems, "; "))
+	}
+	return s.values, nil
+}
+
+// yamlErrors rewords the errors of decoding into fileConfig, whose anonymous
+// struct types would otherwise be spelled out in full
+func yamlErrors(err error) string {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err.Error()
+	}
+	messages := make([]string, len(typeErr.Errors))
+	for i, message := range typeErr.Errors {
+		if before, _, found := strings.Cut(message, " not found in type "); found {
+			message = strings.Replace(before, "field ", "unknown field ", 1)
+		}
+		messages[i] = message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// fileSettingsOf validates the settings of a config file and converts them to
+// environment variable values
+func fileSettingsOf(file *fileConfig) *settings {
+	s := &settings{values: make(map[string]string)}
+
+	s.port("SERVER_PORT", "server.port", file.Server.Port)
+	auth := file.Server.Auth
+	s.list("HTTP_AUTH_READ_TOKENS", auth.ReadTokens)
+	s.list("HTTP_AUTH_CONTROL_TOKENS", auth.ControlTokens)
+	s.pairs("HTTP_AUTH_READ_USERS", "server.auth.read_users", auth.ReadUsers)
+	s.pairs("HTTP_AUTH_CONTROL_USERS", "server.auth.control_users", auth.ControlUsers)
+	s.boolean("HTTP_AUTH_PUBLIC_PROBES", auth.PublicProbes)
+	s.url("HTTP_AUTH_OIDC_ISSUER", "server.auth.oidc.issuer", auth.OIDC.Issuer)
+	s.str("HTTP_AUTH_OIDC_AUDIENCE", "server.auth.oidc.audience", auth.OIDC.Audience)
+	s.str("HTTP_AUTH_OIDC_ROLES_CLAIM", "server.auth.oidc.roles_claim", auth.OIDC.RolesClaim)
+	s.str("HTTP_AUTH_OIDC_READ_ROLE", "server.auth.oidc.read_role", auth.OIDC.ReadRole)
+	s.str("HTTP_AUTH_OIDC_CONTROL_ROLE", "server.auth.oidc.control_role", auth.OIDC.ControlRole)
+	s.boolean("HTTP_ACCESS_LOG", file.Server.AccessLog)
+	s.float("HTTP_RATE_LIMIT", file.Server.RateLimit.RequestsPerSecond)
+	s.integer("HTTP_RATE_LIMIT_BURST", "server.rate_limit.burst", file.Server.RateLimit.Burst, 1)
+	s.str("HTTP_CLIENT_IP_HEADER", "server.client_ip_header", file.Server.ClientIPHeader)
+	s.list("HTTP_CORS_ALLOWED_ORIGINS", file.Server.CORSOrigins)
+	s.str("PIPELINES_FILE", "pipelines_file", file.PipelinesFile)
+
+	s.url("API_URL", "source.url", file.Source.URL)
+	s.str("API_TOKEN", "source.token", file.Source.Token)
+	s.url("SANDBOX_API_URL", "source.sandbox.url", file.Source.Sandbox.URL)
+	s.str("SANDBOX_API_TOKEN", "source.sandbox.token", file.Source.Sandbox.Token)
+	s.oneOf("SOURCE_ENV", "source.env", file.Source.Env, SourceEnvProduction, SourceEnvSandbox)
+	s.boolean("SOURCE_COMPARE", file.Source.Compare)
+	s.str("SOURCE_COMPARE_KEY", "source.compare_key", file.Source.CompareKey)
+	s.pairs("API_ENDPOINTS", "source.endpoints", file.Source.Endpoints)
+	s.integer("API_ENDPOINT_PARALLELISM", "source.endpoint_parallelism", file.Source.EndpointParallelism, 1)
+	s.duration("EXTRACT_TIMEOUT", "source.timeout", file.Source.Timeout)
+	s.boolean("QUARANTINE_ENABLED", file.Source.Quarantine)
+	s.integer("QUARANTINE_MAX_BYTES", "source.quarantine_max_bytes", file.Source.QuarantineMaxBytes, 1)
+	s.oneOf("API_METHOD", "source.method", file.Source.Method, "GET", "POST")
+	s.str("API_REQUEST_BODY", "source.request_body", file.Source.RequestBody)
+	s.str("API_USER_AGENT", "source.user_agent", file.Source.UserAgent)
+	s.str("API_REQUEST_ID_HEADER", "source.request_id_header", file.Source.RequestIDHeader)
+	s.boolean("API_DUMP_FAILURES", file.Source.DumpFailures)
+	s.oneOf("SOURCE_TYPE", "source.type", file.Source.Type, SourceTypeAPI, SourceTypeSQS, SourceTypeKinesis)
+	s.url("SQS_QUEUE_URL", "source.sqs.queue_url", file.Source.SQS.QueueURL)
+	s.url("SQS_DLQ_URL", "source.sqs.dlq_url", file.Source.SQS.DLQURL)
+	s.integer("SQS_MAX_MESSAGES", "source.sqs.max_messages", file.Source.SQS.MaxMessages, 1)
+	s.duration("SQS_WAIT_TIME", "source.sqs.wait_time", file.Source.SQS.WaitTime)
+	s.duration("SQS_VISIBILITY_TIMEOUT", "source.sqs.visibility_timeout", file.Source.SQS.VisibilityTimeout)
+	s.integer("SQS_MAX_RECEIVES", "source.sqs.max_receives", file.Source.SQS.MaxReceives, 0)
+	s.str("KINESIS_STREAM", "source.kinesis.stream", file.Source.Kinesis.Stream)
+	s.url("KINESIS_ENDPOINT", "source.kinesis.endpoint", file.Source.Kinesis.Endpoint)
+	s.oneOf("KINESIS_START_POSITION", "source.kinesis.start_position", file.Source.Kinesis.StartPosition, "trim_horizon", "latest")
+	s.integer("KINESIS_MAX_RECORDS", "source.kinesis.max_records", file.Source.Kinesis.MaxRecords, 1)
+	s.integer("KINESIS_BATCH_SIZE", "source.kinesis.batch_size", file.Source.Kinesis.BatchSize, 1)
+
+	if file.Schedule.Interval != "" {
+		// FETCH_INTERVAL is in whole seconds
+		interval, err := time.ParseDuration(file.Schedule.Interval)
+		if err != nil || interval < time.Second || interval%time.Second != 0 {
+			s.invalid("schedule.interval", file.Schedule.Interval, "expected a whole number of seconds of at least 1s, e.g. 5m")
+		} else {
+			s.values["FETCH_INTERVAL"] = strconv.Itoa(int(interval / time.Second))
+		}
+	}
+	if file.Schedule.Cron != "" {
+		if _, err := cron.ParseStandard(file.Schedule.Cron); err != nil {
+			s.invalid("schedule.cron", file.Schedule.Cron, err.Error())
+		} else {
+			s.values["SCHEDULE"] = file.Schedule.Cron
+		}
+	}
+	if file.Schedule.Timezone != "" {
+		if _, err := time.LoadLocation(file.Schedule.Timezone); err != nil {
+			s.invalid("schedule.timezone", file.Schedule.Timezone, "expected an IANA time zone such as Europe/Berlin")
+		} else {
+			s.values["SCHEDULE_TIMEZONE"] = file.Schedule.Timezone
+		}
+	}
+	s.oneOf("CYCLE_OVERLAP", "schedule.overlap", file.Schedule.Overlap, "skip", "queue", "cancel-previous")
+	s.duration("CYCLE_BUDGET", "schedule.budget", file.Schedule.Budget)
+	s.duration("CYCLE_TIMEOUT", "schedule.timeout", file.Schedule.Timeout)
+	s.retry("CYCLE_RETRY", "schedule.retry", file.Schedule.Retry)
+	s.boolean("DRY_RUN", file.Schedule.DryRun)
+	s.boolean("RUN_ONCE", file.Schedule.RunOnce)
+	s.duration("SHUTDOWN_DRAIN_TIMEOUT", "schedule.drain_timeout", file.Schedule.DrainTimeout)
+	s.boolean("SCHEDULER_STATE_ENABLED", file.Schedule.PersistState)
+
+	s.str("DATABASE_URL", "database.url", file.Database.URL)
+	s.duration("BOOT_WAIT_TIMEOUT", "boot.wait_timeout", file.Boot.WaitTimeout)
+	s.duration("BOOT_WAIT_BACKOFF", "boot.backoff", file.Boot.Backoff)
+	s.duration("BOOT_WAIT_MAX_BACKOFF", "boot.max_backoff", file.Boot.MaxBackoff)
+	s.boolean("DB_AUTO_MIGRATE", file.Database.AutoMigrate)
+	s.retry("DB_RETRY", "database.retry", file.Database.Retry)
+	s.pool("DB_POOL", "database.pool", file.Database.Pool)
+	s.str("DATABASE_READ_URL", "database.read_url", file.Database.ReadURL)
+	s.pool("DB_READ_POOL", "database.read_pool", file.Database.ReadPool)
+	s.duration("DB_SLOW_QUERY_THRESHOLD", "database.slow_query_threshold", file.Database.SlowQuery)
+	s.duration("DB_MAINTENANCE_INTERVAL", "database.maintenance.interval", file.Database.Maintenance.Interval)
+	s.oneOf("DB_MAINTENANCE_COMMAND", "database.maintenance.command", file.Database.Maintenance.Command, "analyze", "vacuum", "repack")
+	s.list("DB_MAINTENANCE_TABLES", file.Database.Maintenance.Tables)
+	s.boolean("FILE_FALLBACK_ENABLED", file.Database.FileFallback)
+	s.boolean("TRANSACTIONAL_WRITES", file.Database.Transactional)
+	s.boolean("RAW_PASSTHROUGH", file.Database.RawPassthrough)
+	s.boolean("RAW_BLOBS_ENABLED", file.Database.RawBlobs)
+	s.oneOf("RAW_STORAGE", "database.raw_storage", file.Database.RawStorage, "all", "sample", "errors", "none")
+	if rate := file.Database.RawSampleRate; rate != nil && (*rate < 0 || *rate > 1) {
+		s.invalid("database.raw_sample_rate", *rate, "expected a fraction between 0 and 1")
+	} else {
+		s.float("RAW_STORAGE_SAMPLE_RATE", rate)
+	}
+	s.boolean("CHECKPOINTS_ENABLED", file.Database.Checkpoints)
+	s.oneOf("LOAD_STRATEGY", "database.load_strategy", file.Database.LoadStrategy, "direct", "staged")
+	s.duration("STORE_TIMEOUT", "database.store_timeout", file.Database.StoreTimeout)
+
+	s.integer("STREAM_WORKERS", "stream.workers", file.Stream.Workers, 0)
+	s.integer("STREAM_BUFFER", "stream.buffer", file.Stream.Buffer, 1)
+	s.integer("STREAM_BATCH_SIZE", "stream.batch_size", file.Stream.BatchSize, 1)
+	s.duration("STREAM_FLUSH_INTERVAL", "stream.flush_interval", file.Stream.FlushInterval)
+	s.integer("STREAM_MAX_IN_FLIGHT", "stream.max_in_flight", file.Stream.MaxInFlight, 0)
+	s.integer("STREAM_MAX_BATCH_BYTES", "stream.max_batch_bytes", file.Stream.MaxBatchBytes, 0)
+
+	if rate := file.Transform.AuditSampleRate; rate != nil && (*rate < 0 || *rate > 1) {
+		s.invalid("transform.audit_sample_rate", *rate, "expected a fraction between 0 and 1")
+	} else {
+		s.float("TRANSFORM_AUDIT_SAMPLE_RATE", rate)
+	}
+	s.pairs("TRANSFORM_FIELD_SOURCES", "transform.field_sources", file.Transform.FieldSources)
+	s.str("TRANSFORM_DELETE_RULE", "transform.delete_rule", file.Transform.DeleteRule)
+	s.oneOf("TRANSFORM_DELETE_MODE", "transform.delete_mode", file.Transform.DeleteMode, deleteModes...)
+	s.str("TRANSFORM_TIMESTAMP_FIELD", "transform.timestamp.field", file.Transform.Timestamp.Field)
+	s.list("TRANSFORM_TIMESTAMP_FORMATS", file.Transform.Timestamp.Formats)
+	s.timezone("TRANSFORM_TIMESTAMP_SOURCE_TZ", "transform.timestamp.source_tz", file.Transform.Timestamp.SourceTZ)
+	s.timezone("TRANSFORM_TIMESTAMP_TARGET_TZ", "transform.timestamp.target_tz", file.Transform.Timestamp.TargetTZ)
+	s.oneOf("TRANSFORM_TIMESTAMP_TYPE", "transform.timestamp.type", file.Transform.Timestamp.Type, "timestamptz", "date")
+
+	s.url("ENRICH_URL", "enrich.url", file.Enrich.URL)
+	s.str("ENRICH_KEY", "enrich.key", file.Enrich.Key)
+	s.pairs("ENRICH_FIELDS", "enrich.fields", file.Enrich.Fields)
+	s.duration("ENRICH_TTL", "enrich.ttl", file.Enrich.TTL)
+	s.duration("DEDUP_TTL", "dedup.ttl", file.Dedup.TTL)
+	s.url("REDIS_URL", "redis.url", file.Redis.URL)
+	s.str("REDIS_KEY_PREFIX", "redis.key_prefix", file.Redis.KeyPrefix)
+	s.duration("REDIS_TIMEOUT", "redis.timeout", file.Redis.Timeout)
+
+	s.boolean("POSTGRES_SINK_ENABLED", file.Sinks.Postgres)
+	s.integer("POSTGRES_SINK_WORKERS", "sinks.postgres_workers", file.Sinks.PostgresWorkers, 1)
+	s.str("POSTGRES_SINK_PARTITION_KEY", "sinks.postgres_partition_key", file.Sinks.PostgresPartitionKey)
+	s.retry("SINK_RETRY", "sinks.retry", file.Sinks.Retry)
+	s.duration("LOAD_TIMEOUT", "sinks.load_timeout", file.Sinks.LoadTimeout)
+	s.list("KAFKA_BROKERS", file.Sinks.Kafka.Brokers)
+	s.str("KAFKA_TOPIC", "sinks.kafka.topic", file.Sinks.Kafka.Topic)
+	s.str("KAFKA_KEY_FIELD", "sinks.kafka.key_field", file.Sinks.Kafka.KeyField)
+	s.oneOf("KAFKA_SERIALIZATION", "sinks.kafka.serialization", file.Sinks.Kafka.Serialization, "json", "avro")
+	s.oneOf("KAFKA_REQUIRED_ACKS", "sinks.kafka.required_acks", file.Sinks.Kafka.RequiredAcks, "all", "one", "none")
+	if file.Sinks.Kafka.Topic != "" && len(file.Sinks.Kafka.Brokers) == 0 {
+		s.problems = append(s.problems, "sinks.kafka: a topic requires brokers")
+	}
+	s.oneOf("CHANGE_EVENTS_TARGET", "sinks.changes.target", file.Sinks.Changes.Target, "table", "kafka")
+	s.str("CHANGE_EVENTS_TOPIC", "sinks.changes.topic", file.Sinks.Changes.Topic)
+	s.url("SCHEMA_REGISTRY_URL", "sinks.schema_registry.url", file.Sinks.SchemaRegistry.URL)
+	s.str("SCHEMA_REGISTRY_USERNAME", "sinks.schema_registry.username", file.Sinks.SchemaRegistry.Username)
+	s.str("SCHEMA_REGISTRY_PASSWORD", "sinks.schema_registry.password", file.Sinks.SchemaRegistry.Password)
+	s.str("SCHEMA_REGISTRY_FILE_SUBJECT", "sinks.schema_registry.file_subject", file.Sinks.SchemaRegistry.FileSubject)
+	s.str("S3_SINK_BUCKET", "sinks.s3.bucket", file.Sinks.S3.Bucket)
+	s.str("S3_SINK_PREFIX", "sinks.s3.prefix", file.Sinks.S3.Prefix)
+	s.url("S3_ENDPOINT", "sinks.s3.endpoint", file.Sinks.S3.Endpoint)
+	s.boolean("S3_PATH_STYLE", file.Sinks.S3.PathStyle)
+	s.str("BIGQUERY_PROJECT", "sinks.bigquery.project", file.Sinks.BigQuery.Project)
+	s.str("BIGQUERY_DATASET", "sinks.bigquery.dataset", file.Sinks.BigQuery.Dataset)
+	s.str("BIGQUERY_TABLE", "sinks.bigquery.table", file.Sinks.BigQuery.Table)
+	s.str("BIGQUERY_CREDENTIALS_FILE", "sinks.bigquery.credentials_file", file.Sinks.BigQuery.CredentialsFile)
+	if bq := file.Sinks.BigQuery; bq.Table != "" && (bq.Project == "" || bq.Dataset == "") {
+		s.problems = append(s.problems, "sinks.bigquery: a table requires a project and a dataset")
+	}
+	remoteWrite := file.Sinks.RemoteWrite
+	s.url("PROMETHEUS_REMOTE_WRITE_URL", "sinks.remote_write.url", remoteWrite.URL)
+	s.pairs("PROMETHEUS_REMOTE_WRITE_METRICS", "sinks.remote_write.metrics", remoteWrite.Metrics)
+	s.pairs("PROMETHEUS_REMOTE_WRITE_LABELS", "sinks.remote_write.labels", remoteWrite.Labels)
+	s.str("PROMETHEUS_REMOTE_WRITE_TOKEN", "sinks.remote_write.token", remoteWrite.Token)
+	s.str("PROMETHEUS_REMOTE_WRITE_USERNAME", "sinks.remote_write.username", remoteWrite.Username)
+	s.str("PROMETHEUS_REMOTE_WRITE_PASSWORD", "sinks.remote_write.password", remoteWrite.Password)
+	s.duration("PROMETHEUS_REMOTE_WRITE_TIMEOUT", "sinks.remote_write.timeout", remoteWrite.Timeout)
+	snowflake := file.Sinks.Snowflake
+	s.str("SNOWFLAKE_ACCOUNT", "sinks.snowflake.account", snowflake.Account)
+	s.url("SNOWFLAKE_ENDPOINT", "sinks.snowflake.endpoint", snowflake.Endpoint)
+	s.str("SNOWFLAKE_USER", "sinks.snowflake.user", snowflake.User)
+	s.str("SNOWFLAKE_ROLE", "sinks.snowflake.role", snowflake.Role)
+	s.str("SNOWFLAKE_WAREHOUSE", "sinks.snowflake.warehouse", snowflake.Warehouse)
+	s.str("SNOWFLAKE_DATABASE", "sinks.snowflake.database", snowflake.Database)
+	s.str("SNOWFLAKE_SCHEMA", "sinks.snowflake.schema", snowflake.Schema)
+	s.str("SNOWFLAKE_TABLE", "sinks.snowflake.table", snowflake.Table)
+	s.str("SNOWFLAKE_PRIVATE_KEY_FILE", "sinks.snowflake.private_key_file", snowflake.PrivateKeyFile)
+	s.str("SNOWFLAKE_TOKEN", "sinks.snowflake.token", snowflake.Token)
+	s.str("SNOWFLAKE_STAGE", "sinks.snowflake.stage", snowflake.Stage)
+	s.str("SNOWFLAKE_STAGE_BUCKET", "sinks.snowflake.stage_bucket", snowflake.StageBucket)
+	s.str("SNOWFLAKE_STAGE_PREFIX", "sinks.snowflake.stage_prefix", snowflake.StagePrefix)
+	s.list("SNOWFLAKE_MERGE_KEYS", snowflake.MergeKeys)
+	redshift := file.Sinks.Redshift
+	s.str("REDSHIFT_CLUSTER", "sinks.redshift.cluster", redshift.Cluster)
+	s.str("REDSHIFT_WORKGROUP", "sinks.redshift.workgroup", redshift.Workgroup)
+	s.str("REDSHIFT_DATABASE", "sinks.redshift.database", redshift.Database)
+	s.str("REDSHIFT_DB_USER", "sinks.redshift.db_user", redshift.DBUser)
+	s.str("REDSHIFT_SECRET_ARN", "sinks.redshift.secret_arn", redshift.SecretARN)
+	s.str("REDSHIFT_SCHEMA", "sinks.redshift.schema", redshift.Schema)
+	s.str("REDSHIFT_TABLE", "sinks.redshift.table", redshift.Table)
+	s.str("REDSHIFT_IAM_ROLE", "sinks.redshift.iam_role", redshift.IAMRole)
+	s.str("REDSHIFT_STAGE_BUCKET", "sinks.redshift.stage_bucket", redshift.StageBucket)
+	s.str("REDSHIFT_STAGE_PREFIX", "sinks.redshift.stage_prefix", redshift.StagePrefix)
+	s.url("REDSHIFT_ENDPOINT", "sinks.redshift.endpoint", redshift.Endpoint)
+	mongoDB := file.Sinks.MongoDB
+	s.str("MONGODB_URI", "sinks.mongodb.uri", mongoDB.URI)
+	s.str("MONGODB_DATABASE", "sinks.mongodb.database", mongoDB.Database)
+	s.str("MONGODB_COLLECTION", "sinks.mongodb.collection", mongoDB.Collection)
+	s.list("MONGODB_KEYS", mongoDB.Keys)
+	s.str("MONGODB_WRITE_CONCERN", "sinks.mongodb.write_concern", mongoDB.WriteConcern)
+	s.boolean("MONGODB_JOURNAL", mongoDB.Journal)
+	s.duration("MONGODB_WRITE_TIMEOUT", "sinks.mongodb.write_timeout", mongoDB.WriteTimeout)
+	s.duration("MONGODB_TIMEOUT", "sinks.mongodb.timeout", mongoDB.Timeout)
+
+	log := file.Observability.Log
+	s.integer("LOG_MAX_SIZE_MB", "observability.log.max_size_mb", log.MaxSizeMB, 1)
+	s.duration("LOG_MAX_AGE", "observability.log.max_age", log.MaxAge)
+	s.integer("LOG_MAX_BACKUPS", "observability.log.max_backups", log.MaxBackups, 0)
+	s.boolean("LOG_COMPRESS", log.Compress)
+	s.oneOf("LOG_LEVEL", "observability.log.level", log.Level, logLevels...)
+	s.boolean("LOG_FILE_ENABLED", log.File)
+	s.logAddress("LOG_SYSLOG_ADDRESS", "observability.log.syslog", log.Syslog)
+	s.logAddress("LOG_SHIP_ADDRESS", "observability.log.ship", log.Ship)
+
+	tracing := file.Observability.Tracing
+	s.url("OTEL_EXPORTER_OTLP_ENDPOINT", "observability.tracing.endpoint", tracing.Endpoint)
+	s.str("OTEL_SERVICE_NAME", "observability.tracing.service_name", tracing.ServiceName)
+	if ratio := tracing.SampleRatio; ratio != nil && (*ratio < 0 || *ratio > 1) {
+		s.invalid("observability.tracing.sample_ratio", *ratio, "expected a fraction between 0 and 1")
+	} else {
+		s.float("TRACING_SAMPLE_RATIO", ratio)
+	}
+
+	m := file.Observability.Metrics
+	s.oneOf("METRICS_EXPORTER", "observability.metrics.exporter", m.Exporter, "prometheus", "otlp")
+	s.duration("METRICS_EXPORT_INTERVAL", "observability.metrics.export_interval", m.ExportInterval)
+	s.url("METRICS_PUSHGATEWAY_URL", "observability.metrics.pushgateway_url", m.PushgatewayURL)
+	s.str("METRICS_PUSH_JOB", "observability.metrics.push_job", m.PushJob)
+	s.str("METRICS_STATSD_ADDR", "observability.metrics.statsd_addr", m.StatsDAddr)
+	s.str("METRICS_STATSD_PREFIX", "observability.metrics.statsd_prefix", m.StatsDPrefix)
+	if m.StatsDAddr != "" {
+		if _, _, err := net.SplitHostPort(m.StatsDAddr); err != nil {
+			s.invalid("observability.metrics.statsd_addr", m.StatsDAddr, "expected host:port")
+		}
+	}
+	s.duration("FRESHNESS_SLO", "observability.freshness_slo", file.Observability.FreshnessSLO)
+
+	secrets := file.Secrets
+	s.url("VAULT_ADDR", "secrets.vault_addr", secrets.VaultAddr)
+	s.str("VAULT_NAMESPACE", "secrets.vault_namespace", secrets.VaultNamespace)
+	s.url("SECRETS_MANAGER_ENDPOINT", "secrets.secrets_manager_endpoint", secrets.SecretsManagerEndpoint)
+	s.str("SOPS_BINARY", "secrets.sops_binary", secrets.SOPSBinary)
+	s.duration("SECRETS_REFRESH_INTERVAL", "secrets.refresh_interval", secrets.RefreshInterval)
+
+	alerts := file.Observability.Alerts
+	s.url("ALERT_SLACK_WEBHOOK_URL", "observability.alerts.slack_webhook_url", alerts.SlackWebhookURL)
+	s.list("ALERT_EMAIL_TO", alerts.EmailTo)
+	s.str("ALERT_EMAIL_FROM", "observability.alerts.email_from", alerts.EmailFrom)
+	s.str("ALERT_SMTP_HOST", "observability.alerts.smtp_host", alerts.SMTPHost)
+	s.integer("ALERT_SMTP_PORT", "observability.alerts.smtp_port", alerts.SMTPPort, 1)
+	if rate := alerts.ErrorRate; rate != nil && (*rate < 0 || *rate > 1) {
+		s.invalid("observability.alerts.error_rate", *rate, "expected a fraction between 0 and 1")
+	} else {
+		s.float("ALERT_ERROR_RATE", rate)
+	}
+	s.duration("ALERT_SLA", "observability.alerts.sla", alerts.SLA)
+	s.duration("ALERT_REPEAT_INTERVAL", "observability.alerts.repeat_interval", alerts.RepeatInterval)
+	return s
+}
+
+// settings collects the environment variable values of a config file and the
+// problems found validating it, each naming the offending key
+type settings struct {
+	values   map[string]string
+	problems []string
+}
+
+func (s *settings) invalid(key string, value interface{}, hint string) {
+	s.problems = append(s.problems, fmt.Sprintf("%s: invalid value %q, %s", key, fmt.Sprint(value), hint))
+}
+
+func (s *settings) str(env, key, value string) {
+	if value != "" {
+		s.values[env] = value
+	}
+}
+
+func (s *settings) oneOf(env, key, value string, allowed ...string) {
+	if value == "" {
+		return
+	}
+	if !slices.Contains(allowed, value) {
+		s.invalid(key, value, "expected one of "+strings.Join(allowed, ", "))
+		return
+	}
+	s.values[env] = value
+}
+
+func (s *settings) duration(env, key, value string) {
+	if value == "" {
+		return
+	}
+	if d, err := time.ParseDuration(value); err != nil || d < 0 {
+		s.invalid(key, value, "expected a duration such as 30s or 5m")
+		return
+	}
+	s.values[env] = value
+}
+
+func (s *settings) timezone(env, key, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := time.LoadLocation(value); err != nil {
+		s.invalid(key, value, "expected an IANA time zone such as Europe/Berlin")
+		return
+	}
+	s.values[env] = value
+}
+
+func (s *settings) logAddress(env, key, value string) {
+	if value == "" {
+		return
+	}
+	if !validLogAddress(value) {
+		s.invalid(key, value, "expected tcp://host:port or udp://host:port")
+		return
+	}
+	s.values[env] = value
+}
+
+func (s *settings) url(env, key, value string) {
+	if value == "" {
+		return
+	}
+	if _, ok, _ := ParseSecretRef(value); ok {
+		// Resolved when LoadConfig reads the setting
+		s.values[env] = value
+		return
+	}
+	if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+		s.invalid(key, value, "expected an absolute URL such as https://example.com")
+		return
+	}
+	s.values[env] = value
+}
+
+func (s *settings) port(env, key string, value *int) {
+	if value == nil {
+		return
+	}
+	if *value < 1 || *value > 65535 {
+		s.invalid(key, *value, "expected a port between 1 and 65535")
+		return
+	}
+	s.values[env] = strconv.Itoa(*value)
+}
+
+func (s *settings) integer(env, key string, value *int, min int) {
+	if value == nil {
+		return
+	}
+	if *value < min {
+		s.invalid(key, *value, fmt.Sprintf("expected at least %d", min))
+		return
+	}
+	s.values[env] = strconv.Itoa(*value)
+}
+
+func (s *settings) float(env string, value *float64) {
+	if value != nil {
+		s.values[env] = strconv.FormatFloat(*value, 'f', -1, 64)
+	}
+}
+
+func (s *settings) boolean(env string, value *bool) {
+	if value != nil {
+		s.values[env] = strconv.FormatBool(*value)
+	}
+}
+
+func (s *settings) list(env string, values []string) {
+	if len(values) > 0 {
+		s.values[env] = strings.Join(values, ",")
+	}
+}
+
+// pairs sets a comma-separated list of key=value pairs, sorted by key
+func (s *settings) pairs(env, key string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	pairs := make([]string, 0, len(values))
+	for k, v := range values {
+		if k == "" || v == "" || strings.ContainsAny(k+v, ",=") {
+			s.invalid(key+"."+k, v, "expected non-empty keys and values without , or =")
+			return
+		}
+		pairs = append(pairs, k+"="+v)
+	}
+	slices.Sort(pairs)
+	s.values[env] = strings.Join(pairs, ",")
+}
+
+// pool sets the _MAX_OPEN, _MAX_IDLE and _MAX_LIFETIME variables of a connection pool
+func (s *settings) pool(prefix, key string, pool filePool) {
+	s.integer(prefix+"_MAX_OPEN", key+".max_open", pool.MaxOpen, 1)
+	s.integer(prefix+"_MAX_IDLE", key+".max_idle", pool.MaxIdle, 0)
+	s.duration(prefix+"_MAX_LIFETIME", key+".max_lifetime", pool.MaxLifetime)
+}
+
+// retry sets the _ATTEMPTS, _BACKOFF and _MAX_BACKOFF variables of a retry policy
+func (s *settings) retry(prefix, key string, policy fileRetry) {
+	s.integer(prefix+"_ATTEMPTS", key+".attempts", policy.Attempts, 1)
+	s.duration(prefix+"_BACKOFF", key+".backoff", policy.Backoff)
+	s.duration(prefix+"_MAX_BACKOFF", key+".max_backoff", policy.MaxBackoff)
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	files := map[string]string{
+		"etl.yaml": `
+server:
+  port: 9090
+source:
+  url: https://api.example.com/data
+  token: ${FILE_TOKEN}
+schedule:
+  interval: 5m
+  overlap: queue
+  retry: {attempts: 3, backoff: 10s}
+transform:
+  field_sources: {title: headline, user_id: authorId}
+sinks:
+  kafka:
+    brokers: [kafka-1:9092, kafka-2:9092]
+    topic: posts
+observability:
+  tracing: {sample_ratio: 0.5}
+`,
+		"etl.toml": `
+[server]
+port = 9090
+
+[source]
+url = "https://api.example.com/data"
+token = "${FILE_TOKEN}"
+
+[schedule]
+interval = "5m"
+overlap = "queue"
+retry = { attempts = 3, backoff = "10s" }
+
+[transform.field_sources]
+title = "headline"
+user_id = "authorId"
+
+[sinks.kafka]
+brokers = ["kafka-1:9092", "kafka-2:9092"]
+topic = "posts"
+
+[observability.tracing]
+sample_ratio = 0.5
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("FILE_TOKEN", "secret")
+			t.Setenv("CONFIG_FILE", writePipelines(t, name, content))
+			// Environment variables that are set override the file
+			t.Setenv("KAFKA_TOPIC", "orders")
+
+			cfg, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cfg.ServerPort != "9090" || cfg.FetchInterval != 300 || cfg.CycleOverlap != "queue" {
+				t.Errorf("Unexpected port, interval or overlap: %s %d %s", cfg.ServerPort, cfg.FetchInterval, cfg.CycleOverlap)
+			}
+			if cfg.APIURL != "https://api.example.com/data" || cfg.APIToken != "secret" {
+				t.Errorf("Unexpected source %s with token %q", cfg.APIURL, cfg.APIToken)
+			}
+			if cfg.CycleRetry.Attempts != 3 || cfg.CycleRetry.Backoff != 10*time.Second || cfg.CycleRetry.MaxBackoff != 5*time.Minute {
+				t.Errorf("Unexpected cycle retry %+v", cfg.CycleRetry)
+			}
+			if len(cfg.KafkaBrokers) != 2 || cfg.KafkaTopic != "orders" {
+				t.Errorf("Unexpected Kafka brokers %v or topic %s", cfg.KafkaBrokers, cfg.KafkaTopic)
+			}
+			if cfg.TransformFieldSources["title"] != "headline" || cfg.TransformFieldSources["user_id"] != "authorId" {
+				t.Errorf("Unexpected field sources %v", cfg.TransformFieldSources)
+			}
+			if cfg.TracingSampleRatio != 0.5 {
+				t.Errorf("Expected a sample ratio of 0.5, got %v", cfg.TracingSampleRatio)
+			}
+		})
+	}
+
+	// Without CONFIG_FILE the settings of a previous file no longer apply
+	t.Setenv("CONFIG_FILE", "")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.FetchInterval != 30 {
+		t.Errorf("Expected the default interval, got %d", cfg.FetchInterval)
+	}
+}
+
+func TestLoadConfigFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []string
+	}{
+		{"unknown yaml key", "c.yaml", "schedule:\n  intervall: 5m\n", []string{"line 2: unknown field intervall"}},
+		{"unknown toml key", "c.toml", "[schedule]\nintervall = \"5m\"\n", []string{"unknown keys schedule.intervall"}},
+		{"wrong type", "c.yaml", "server:\n  port: http\n", []string{"line 2"}},
+		{"values", "c.yaml", `
+source:
+  url: api.example.com
+schedule:
+  interval: 10ms
+  cron: "every day"
+  overlap: later
+  retry: {attempts: 0}
+observability:
+  tracing: {sample_ratio: 2}
+`, []string{
+			`source.url: invalid value "api.example.com"`,
+			`schedule.interval: invalid value "10ms"`,
+			"schedule.cron:",
+			`schedule.overlap: invalid value "later", expected one of skip, queue, cancel-previous`,
+			"schedule.retry.attempts:",
+			"observability.tracing.sample_ratio:",
+		}},
+		{"kafka without brokers", "c.toml", "[sinks.kafka]\ntopic = \"posts\"\n", []string{"sinks.kafka: a topic requires brokers"}},
+		{"extension", "c.json", `{}`, []string{"unsupported config file"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", writePipelines(t, tt.file, tt.content))
+			_, err := LoadConfig()
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected error containing %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
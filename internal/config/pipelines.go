@@ -0,0 +1,257 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pipelineNamePattern restricts pipeline names, which appear in paths, log file
+// names and metric labels
+var pipelineNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// PipelineDefinition describes one pipeline of a PIPELINES_FILE. Unset fields
+// keep the value of the environment configuration.
+type PipelineDefinition struct {
+	Name   string `json:"name" yaml:"name"`
+	Source struct {
+		URL   string `json:"url" yaml:"url"`
+		Token string `json:"token" yaml:"token"`
+	} `json:"source" yaml:"source"`
+	// Interval is a duration such as 5m; Schedule a cron expression replacing it
+	Interval string `json:"interval" yaml:"interval"`
+	Schedule string `json:"schedule" yaml:"schedule"`
+	Timezone string `json:"timezone" yaml:"timezone"`
+	// FreshnessSLO is the maximum age of the processed data, e.g. 15m
+	FreshnessSLO string `json:"freshness_slo" yaml:"freshness_slo"`
+	// DryRun runs the pipeline without writing, e.g. to try a new transform
+	DryRun    *bool `json:"dry_run" yaml:"dry_run"`
+	Transform struct {
+		AuditSampleRate *float64 `json:"audit_sample_rate" yaml:"audit_sample_rate"`
+		// FieldSources reads fields from other raw keys, e.g. title: headline
+		FieldSources map[string]string `json:"field_sources" yaml:"field_sources"`
+		// DeleteRule and DeleteMode are TRANSFORM_DELETE_RULE and TRANSFORM_DELETE_MODE
+		DeleteRule string `json:"delete_rule" yaml:"delete_rule"`
+		DeleteMode string `json:"delete_mode" yaml:"delete_mode"`
+		// TimestampField and TimestampFormats are TRANSFORM_TIMESTAMP_FIELD and
+		// TRANSFORM_TIMESTAMP_FORMATS, as sources name their timestamps differently
+		TimestampField   string   `json:"timestamp_field" yaml:"timestamp_field"`
+		TimestampFormats []string `json:"timestamp_formats" yaml:"timestamp_formats"`
+	} `json:"transform" yaml:"transform"`
+	Sinks struct {
+		Postgres      *bool  `json:"postgres" yaml:"postgres"`
+		KafkaTopic    string `json:"kafka_topic" yaml:"kafka_topic"`
+		S3Bucket      string `json:"s3_bucket" yaml:"s3_bucket"`
+		S3Prefix      string `json:"s3_prefix" yaml:"s3_prefix"`
+		BigQueryTable string `json:"bigquery_table" yaml:"bigquery_table"`
+	} `json:"sinks" yaml:"sinks"`
+	Storage struct {
+		// Dir holds the pipeline's batch files, pending batches and checkpoints;
+		// it defaults to data/<name>
+		Dir    string `json:"dir" yaml:"dir"`
+		Format string `json:"format" yaml:"format"`
+		Codec  string `json:"codec" yaml:"codec"`
+		// Prefix is the key prefix of snapshots in an object store
+		Prefix string `json:"prefix" yaml:"prefix"`
+	} `json:"storage" yaml:"storage"`
+	// Log routes the pipeline's messages: to File, logs/<name>.log by default, at
+	// Level, LOG_LEVEL by default, and to stdout unless Stdout is false
+	Log struct {
+		File   string `json:"file" yaml:"file"`
+		Level  string `json:"level" yaml:"level"`
+		Stdout *bool  `json:"stdout" yaml:"stdout"`
+	} `json:"log" yaml:"log"`
+	// Steps define the pipeline as a DAG of named steps instead of the fixed
+	// extract, transform and load sequence
+	Steps []StepDefinition `json:"steps" yaml:"steps"`
+}
+
+// StepDefinition describes a step of a pipeline defined as a DAG
+type StepDefinition struct {
+	Name string `json:"name" yaml:"name"`
+	// Type is extract, join, transform or load
+	Type      string   `json:"type" yaml:"type"`
+	DependsOn []string `json:"depends_on" yaml:"depends_on"`
+	// Source is fetched by an extract step; without a URL the step reads from the
+	// pipeline's source
+	Source struct {
+		URL   string `json:"url" yaml:"url"`
+		Token string `json:"token" yaml:"token"`
+	} `json:"source" yaml:"source"`
+	// Key and Join configure a join step: the field matching records and inner or left
+	Key  string `json:"key" yaml:"key"`
+	Join string `json:"join" yaml:"join"`
+}
+
+// DataDir returns the directory of the pipeline's files
+func (d PipelineDefinition) DataDir() string {
+	if d.Storage.Dir != "" {
+		return d.Storage.Dir
+	}
+	return filepath.Join("data", d.Name)
+}
+
+// LogFile returns the file of the pipeline's log
+func (d PipelineDefinition) LogFile() string {
+	if d.Log.File != "" {
+		return d.Log.File
+	}
+	return filepath.Join("logs", d.Name+".log")
+}
+
+// LoadPipelines reads pipeline definitions from a YAML or JSON file, by its
+// extension, expanding ${VAR} references to environment variables
+func LoadPipelines(filename string) ([]PipelineDefinition, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipelines file: %w", err)
+	}
+	data = []byte(os.ExpandEnv(string(data)))
+
+	var file struct {
+		Pipelines []PipelineDefinition `json:"pipelines" yaml:"pipelines"`
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&file)
+	case ".json":
+		decoder := json.NewDecoder(strings.NewReader(string(data)))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&file)
+	default:
+		return nil, fmt.Errorf("unsupported pipelines file %s, expected .yaml, .yml or .json", filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pipelines file: %w", err)
+	}
+
+	if len(file.Pipelines) == 0 {
+		return nil, fmt.Errorf("pipelines file %s defines no pipelines", filename)
+	}
+	names := make(map[string]bool)
+	dirs := make(map[string]string)
+	// The log of the process is written by every pipeline
+	logs := map[string]string{filepath.Clean("logs/etl.log"): "the process"}
+	for _, def := range file.Pipelines {
+		if !pipelineNamePattern.MatchString(def.Name) {
+			return nil, fmt.Errorf("invalid pipeline name %q, use lowercase letters, digits, - and _", def.Name)
+		}
+		if names[def.Name] {
+			return nil, fmt.Errorf("pipeline %s is defined twice", def.Name)
+		}
+		names[def.Name] = true
+		if other, ok := dirs[def.DataDir()]; ok {
+			return nil, fmt.Errorf("pipelines %s and %s share the storage directory %s", other, def.Name, def.DataDir())
+		}
+		dirs[def.DataDir()] = def.Name
+		logFile := filepath.Clean(def.LogFile())
+		if other, ok := logs[logFile]; ok {
+			return nil, fmt.Errorf("pipeline %s shares the log file %s with %s", def.Name, logFile, other)
+		}
+		logs[logFile] = "pipeline " + def.Name
+		if def.Log.Level != "" && !slices.Contains(logLevels, def.Log.Level) {
+			return nil, fmt.Errorf("pipeline %s: invalid log level %q, expected one of %s", def.Name, def.Log.Level, strings.Join(logLevels, ", "))
+		}
+		if def.Interval != "" {
+			if interval, err := time.ParseDuration(def.Interval); err != nil || interval < time.Second {
+				return nil, fmt.Errorf("pipeline %s: invalid interval %q, expected a duration of at least 1s", def.Name, def.Interval)
+			}
+		}
+		if def.FreshnessSLO != "" {
+			if objective, err := time.ParseDuration(def.FreshnessSLO); err != nil || objective <= 0 {
+				return nil, fmt.Errorf("pipeline %s: invalid freshness_slo %q, expected a positive duration", def.Name, def.FreshnessSLO)
+			}
+		}
+	}
+	return file.Pipelines, nil
+}
+
+// ForPipeline returns a copy of the configuration with the settings of a pipeline definition applied
+func (c *Config) ForPipeline(def PipelineDefinition) *Config {
+	cfg := *c
+	if def.Source.URL != "" {
+		// A pipeline reads from its own source, not the production/sandbox pair
+		cfg.APIURL, cfg.APIToken = def.Source.URL, def.Source.Token
+		cfg.SourceEnv = SourceEnvProduction
+		cfg.SourceCompare = false
+		cfg.APIEndpoints = nil
+	}
+	if def.Interval != "" {
+		interval, _ := time.ParseDuration(def.Interval)
+		cfg.FetchInterval = int(interval / time.Second)
+		cfg.Schedule = ""
+	}
+	if def.Schedule != "" {
+		cfg.Schedule = def.Schedule
+	}
+	if def.Timezone != "" {
+		cfg.ScheduleTimezone = def.Timezone
+	}
+	if def.FreshnessSLO != "" {
+		cfg.FreshnessSLO, _ = time.ParseDuration(def.FreshnessSLO)
+	}
+	if def.DryRun != nil {
+		cfg.DryRun = *def.DryRun
+	}
+	if def.Log.Level != "" {
+		cfg.LogLevel = def.Log.Level
+	}
+	if def.Transform.AuditSampleRate != nil {
+		cfg.TransformAuditSampleRate = *def.Transform.AuditSampleRate
+	}
+	if len(def.Transform.FieldSources) > 0 {
+		cfg.TransformFieldSources = def.Transform.FieldSources
+	}
+	if def.Transform.DeleteRule != "" {
+		cfg.TransformDeleteRule = def.Transform.DeleteRule
+	}
+	if def.Transform.DeleteMode != "" {
+		cfg.TransformDeleteMode = def.Transform.DeleteMode
+	}
+	if def.Transform.TimestampField != "" {
+		cfg.TransformTimestampField = def.Transform.TimestampField
+	}
+	if len(def.Transform.TimestampFormats) > 0 {
+		cfg.TransformTimestampFormats = def.Transform.TimestampFormats
+	}
+	if def.Sinks.Postgres != nil {
+		cfg.PostgresSinkEnabled = *def.Sinks.Postgres
+	}
+	if def.Sinks.KafkaTopic != "" {
+		cfg.KafkaTopic = def.Sinks.KafkaTopic
+	}
+	if def.Sinks.S3Bucket != "" {
+		cfg.S3SinkBucket = def.Sinks.S3Bucket
+	}
+	if def.Sinks.S3Prefix != "" {
+		cfg.S3SinkPrefix = def.Sinks.S3Prefix
+	}
+	if def.Sinks.BigQueryTable != "" {
+		cfg.BigQueryTable = def.Sinks.BigQueryTable
+	}
+	if len(def.Steps) > 0 {
+		cfg.PipelineSteps = def.Steps
+	}
+	if def.Storage.Format != "" {
+		cfg.StorageFormat = def.Storage.Format
+	}
+	if def.Storage.Codec != "" {
+		cfg.StorageCodec = def.Storage.Codec
+	}
+	if def.Storage.Prefix != "" {
+		cfg.StoragePrefix = def.Storage.Prefix
+	} else {
+		cfg.StoragePrefix = path.Join(cfg.StoragePrefix, def.Name)
+	}
+	return &cfg
+}
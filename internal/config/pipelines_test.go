@@ -0,0 +1,123 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writePipelines(t *testing.T, name, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write pipelines file: %v", err)
+	}
+	return filename
+}
+
+func TestLoadPipelines(t *testing.T) {
+	t.Setenv("ORDERS_TOKEN", "secret")
+	filename := writePipelines(t, "pipelines.yaml", `
+pipelines:
+  - name: orders
+    source:
+      url: https://orders.example.com/api
+      token: ${ORDERS_TOKEN}
+    interval: 10m
+    freshness_slo: 15m
+    sinks:
+      postgres: false
+      kafka_topic: orders
+  - name: customers
+    source:
+      url: https://crm.example.com/api
+    schedule: "0 2 * * *"
+    timezone: Europe/Berlin
+    storage:
+      dir: /var/lib/etl/customers
+    steps:
+      - name: customers
+        type: extract
+      - name: accounts
+        type: extract
+        source:
+          url: https://billing.example.com/accounts
+      - name: joined
+        type: join
+        depends_on: [customers, accounts]
+        key: customer_id
+        join: left
+      - name: transform
+        type: transform
+        depends_on: [joined]
+      - name: load
+        type: load
+        depends_on: [transform]
+`)
+	definitions, err := LoadPipelines(filename)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(definitions) != 2 {
+		t.Fatalf("Expected 2 pipelines, got %d", len(definitions))
+	}
+	if definitions[0].Source.Token != "secret" {
+		t.Errorf("Expected the token to be expanded from the environment, got %q", definitions[0].Source.Token)
+	}
+	if dir := definitions[0].DataDir(); dir != filepath.Join("data", "orders") {
+		t.Errorf("Expected default data dir data/orders, got %s", dir)
+	}
+
+	base := &Config{FetchInterval: 300, Schedule: "@hourly", PostgresSinkEnabled: true, StoragePrefix: "etl"}
+	orders := base.ForPipeline(definitions[0])
+	if orders.FetchInterval != 600 || orders.Schedule != "" {
+		t.Errorf("Expected a 600s interval replacing the base schedule, got %ds %q", orders.FetchInterval, orders.Schedule)
+	}
+	if orders.FreshnessSLO != 15*time.Minute {
+		t.Errorf("Expected a 15m freshness objective, got %v", orders.FreshnessSLO)
+	}
+	if orders.PostgresSinkEnabled || orders.KafkaTopic != "orders" || orders.StoragePrefix != "etl/orders" {
+		t.Errorf("Unexpected sinks or prefix: %+v", orders)
+	}
+	if orders.APIURL != "https://orders.example.com/api" || orders.APIToken != "secret" {
+		t.Errorf("Unexpected source %s", orders.APIURL)
+	}
+	customers := base.ForPipeline(definitions[1])
+	if steps := customers.PipelineSteps; len(steps) != 5 || steps[2].Join != "left" || len(steps[2].DependsOn) != 2 || steps[1].Source.URL == "" {
+		t.Errorf("Unexpected steps: %+v", steps)
+	}
+	if len(orders.PipelineSteps) != 0 {
+		t.Error("Expected a pipeline without steps to run the fixed sequence")
+	}
+	if !base.PostgresSinkEnabled || base.KafkaTopic != "" {
+		t.Error("Expected the base configuration to be left unchanged")
+	}
+}
+
+func TestLoadPipelinesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"bad name", "p.json", `{"pipelines": [{"name": "Orders"}]}`, "invalid pipeline name"},
+		{"duplicate", "p.json", `{"pipelines": [{"name": "a"}, {"name": "a"}]}`, "defined twice"},
+		{"shared dir", "p.json", `{"pipelines": [{"name": "a", "storage": {"dir": "x"}}, {"name": "b", "storage": {"dir": "x"}}]}`, "share the storage directory"},
+		{"interval", "p.yml", "pipelines:\n  - name: a\n    interval: 10ms\n", "invalid interval"},
+		{"freshness", "p.yml", "pipelines:\n  - name: a\n    freshness_slo: soon\n", "invalid freshness_slo"},
+		{"unknown field", "p.yml", "pipelines:\n  - name: a\n    intervall: 5m\n", "failed to parse"},
+		{"empty", "p.json", `{"pipelines": []}`, "defines no pipelines"},
+		{"extension", "p.toml", ``, "unsupported pipelines file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadPipelines(writePipelines(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+)
+
+// Schemes of secret references, which a setting can hold instead of its value
+const (
+	// SecretVault reads a key of a HashiCorp Vault KV v2 secret, vault:<mount>/<path>#<key>
+	SecretVault = "vault"
+	// SecretAWS reads an AWS Secrets Manager secret, awssm:<secret-id>, or a key of
+	// its JSON value, awssm:<secret-id>#<key>
+	SecretAWS = "awssm"
+	// SecretSOPS reads a key of a SOPS encrypted file, sops:<file>#<key>, with
+	// nested keys separated by dots
+	SecretSOPS = "sops"
+)
+
+// secrets resolves the secret references of settings while LoadConfig reads them
+var secrets *secretResolver
+
+// secretTimeout bounds the resolution of all secrets of a configuration
+const secretTimeout = 30 * time.Second
+
+// SecretRef is a reference to a secret held by a secrets backend
+type SecretRef struct {
+	Scheme string
+	// Path is the Vault secret path, the AWS secret id or the SOPS file
+	Path string
+	// Key selects a key of the secret, if any
+	Key string
+}
+
+func (r SecretRef) String() string {
+	if r.Key == "" {
+		return r.Scheme + ":" + r.Path
+	}
+	return r.Scheme + ":" + r.Path + "#" + r.Key
+}
+
+// ParseSecretRef parses a secret reference, reporting whether value is one
+func ParseSecretRef(value string) (SecretRef, bool, error) {
+	scheme, rest, found := strings.Cut(value, ":")
+	if !found || (scheme != SecretVault && scheme != SecretAWS && scheme != SecretSOPS) {
+		return SecretRef{}, false, nil
+	}
+	ref := SecretRef{Scheme: scheme}
+	ref.Path, ref.Key, _ = strings.Cut(rest, "#")
+	if ref.Path == "" {
+		return ref, true, fmt.Errorf("secret reference %q has no path", value)
+	}
+	if ref.Key == "" && scheme != SecretAWS {
+		return ref, true, fmt.Errorf("secret reference %q has no #key", value)
+	}
+	if scheme == SecretVault && !strings.Contains(ref.Path, "/") {
+		return ref, true, fmt.Errorf("secret reference %q must be vault:<mount>/<path>#<key>", value)
+	}
+	return ref, true, nil
+}
+
+// secretResolver resolves secret references, reading each secret once
+type secretResolver struct {
+	ctx        context.Context
+	httpClient *http.Client
+	// secrets caches the secrets read, by scheme and path
+	secrets map[string]map[string]interface{}
+	// awsStrings caches the values of AWS secrets as they are
+	awsStrings map[string]string
+	// refs and values hold the references of settings and their values, and errs
+	// the references that failed, by environment variable
+	refs   map[string]string
+	values map[string]string
+	errs   map[string]error
+}
+
+func newSecretResolver(ctx context.Context) *secretResolver {
+	return &secretResolver{
+		ctx:        ctx,
+		httpClient: &http.Client{Timeout: secretTimeout},
+		secrets:    make(map[string]map[string]interface{}),
+		awsStrings: make(map[string]string),
+		refs:       make(map[string]string),
+		values:     make(map[string]string),
+		errs:       make(map[string]error),
+	}
+}
+
+// setting returns the value of a setting, resolving it if it is a secret reference
+func (r *secretResolver) setting(key, value string) string {
+	if resolved, ok := r.values[key]; ok {
+		return resolved
+	}
+	ref, ok, err := ParseSecretRef(value)
+	if !ok {
+		return value
+	}
+	if err == nil {
+		if r.values[key], err = r.resolve(r.ctx, ref); err != nil {
+			err = fmt.Errorf("failed to resolve secret %s: %w", ref, err)
+		}
+	}
+	if err != nil {
+		r.errs[key] = fmt.Errorf("%s: %w", key, err)
+		r.values[key] = ""
+	}
+	r.refs[key] = value
+	return r.values[key]
+}
+
+// err returns the errors of the references that failed, sorted by setting
+func (r *secretResolver) err() error {
+	keys := make([]string, 0, len(r.errs))
+	for key := range r.errs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		errs[i] = r.errs[key]
+	}
+	return errors.Join(errs...)
+}
+
+// ResolveSecrets resolves secret references anew, e.g. to notice rotated secrets,
+// and returns their values by reference
+func ResolveSecrets(ctx context.Context, refs []string) (map[string]string, error) {
+	resolver := newSecretResolver(ctx)
+	values := make(map[string]string, len(refs))
+	for _, raw := range refs {
+		ref, ok, err := ParseSecretRef(raw)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid secret reference %q", raw)
+		}
+		if values[raw], err = resolver.resolve(ctx, ref); err != nil {
+			return nil, fmt.Errorf("failed to resolve secret %s: %w", ref, err)
+		}
+	}
+	return values, nil
+}
+
+// resolve returns the value of a secret reference
+func (r *secretResolver) resolve(ctx context.Context, ref SecretRef) (string, error) {
+	cacheKey := ref.Scheme + ":" + ref.Path
+	secret, ok := r.secrets[cacheKey]
+	if !ok {
+		var err error
+		switch ref.Scheme {
+		case SecretVault:
+			secret, err = r.readVault(ctx, ref.Path)
+		case SecretAWS:
+			secret, err = r.readAWS(ctx, ref.Path)
+		case SecretSOPS:
+			secret, err = r.readSOPS(ctx, ref.Path)
+		}
+		if err != nil {
+			return "", err
+		}
+		r.secrets[cacheKey] = secret
+	}
+	if ref.Key == "" {
+		// Only AWS secrets are referenced as a whole
+		return r.awsStrings[ref.Path], nil
+	}
+
+	var value interface{} = secret
+	for _, part := range strings.Split(ref.Key, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("key %s not found", ref.Key)
+		}
+		if value, ok = object[part]; !ok {
+			return "", fmt.Errorf("key %s not found", ref.Key)
+		}
+	}
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case nil:
+		return "", fmt.Errorf("key %s is null", ref.Key)
+	default:
+		data, err := json.Marshal(value)
+		return string(data), err
+	}
+}
+
+// readVault reads a KV v2 secret from VAULT_ADDR with VAULT_TOKEN
+func (r *secretResolver) readVault(ctx context.Context, secretPath string) (map[string]interface{}, error) {
+	addr := getEnv("VAULT_ADDR", "")
+	token := getEnv("VAULT_TOKEN", "")
+	if addr == "" || token == "" {
+		return nil, fmt.Errorf("VAULT_ADDR and VAULT_TOKEN are required")
+	}
+	mount, rest, _ := strings.Cut(secretPath, "/")
+	endpoint := strings.TrimRight(addr, "/") + "/v1/" + escapePath(mount) + "/data/" + escapePath(rest)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := getEnv("VAULT_NAMESPACE", ""); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	var result struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := r.do(req, "vault", &result); err != nil {
+		return nil, err
+	}
+	if result.Data.Data == nil {
+		return nil, fmt.Errorf("vault secret %s has no data", secretPath)
+	}
+	return result.Data.Data, nil
+}
+
+// readAWS reads the current value of a secret from AWS Secrets Manager in
+// AWS_REGION, with the AWS credentials of the configuration
+func (r *secretResolver) readAWS(ctx context.Context, secretID string) (map[string]interface{}, error) {
+	region := getEnv("AWS_REGION", "us-east-1")
+	endpoint := getEnv("SECRETS_MANAGER_ENDPOINT", fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", region))
+	body, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secrets manager request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	awsauth.Sign(req, awsauth.Credentials{
+		AccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
+		SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		SessionToken:    getEnv("AWS_SESSION_TOKEN", ""),
+	}, region, "secretsmanager", awsauth.PayloadHash(body), time.Now())
+
+	var result struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := r.do(req, "secrets manager", &result); err != nil {
+		return nil, err
+	}
+	if result.SecretString == nil {
+		return nil, fmt.Errorf("secret %s has no string value", secretID)
+	}
+	r.awsStrings[secretID] = *result.SecretString
+	// Keys can be referenced in secrets holding a JSON object
+	secret := make(map[string]interface{})
+	json.Unmarshal([]byte(*result.SecretString), &secret)
+	return secret, nil
+}
+
+// readSOPS decrypts a SOPS encrypted file with the sops binary, SOPS_BINARY, which
+// finds the keys it was encrypted with as usual, e.g. through SOPS_AGE_KEY_FILE
+func (r *secretResolver) readSOPS(ctx context.Context, file string) (map[string]interface{}, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, getEnv("SOPS_BINARY", "sops"), "--decrypt", "--output-type", "json", file)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("sops failed to decrypt %s: %w: %s", file, err, strings.TrimSpace(stderr.String()))
+	}
+	var secret map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &secret); err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted %s: %w", file, err)
+	}
+	return secret, nil
+}
+
+// do sends a request to a secrets backend and decodes its JSON response into result
+func (r *secretResolver) do(req *http.Request, backend string, result interface{}) error {
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", backend, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", backend, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d: %s", backend, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("failed to parse %s response: %w", backend, err)
+	}
+	return nil
+}
+
+// escapePath escapes the segments of a secret path for a URL
+func escapePath(secretPath string) string {
+	segments := strings.Split(secretPath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSecretRef(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    SecretRef
+		isRef   bool
+		wantErr bool
+	}{
+		{value: "postgres://localhost/etl"},
+		{value: "vault:kv/etl#db_url", want: SecretRef{Scheme: SecretVault, Path: "kv/etl", Key: "db_url"}, isRef: true},
+		{value: "awssm:prod/etl", want: SecretRef{Scheme: SecretAWS, Path: "prod/etl"}, isRef: true},
+		{value: "sops:secrets.enc.yaml#api.token", want: SecretRef{Scheme: SecretSOPS, Path: "secrets.enc.yaml", Key: "api.token"}, isRef: true},
+		{value: "vault:etl#db_url", isRef: true, wantErr: true},
+		{value: "vault:kv/etl", isRef: true, wantErr: true},
+		{value: "sops:#token", isRef: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		ref, isRef, err := ParseSecretRef(tt.value)
+		if isRef != tt.isRef || (err != nil) != tt.wantErr {
+			t.Errorf("ParseSecretRef(%q) = %v, %v, want reference %v, error %v", tt.value, isRef, err, tt.isRef, tt.wantErr)
+			continue
+		}
+		if err == nil && ref != tt.want {
+			t.Errorf("ParseSecretRef(%q) = %+v, want %+v", tt.value, ref, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigResolvesSecrets(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/data/etl" || r.Header.Get("X-Vault-Token") != "root" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": map[string]interface{}{"db_url": "postgres://vault/etl"}},
+		})
+	}))
+	defer vault.Close()
+
+	secretsManager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || req.SecretId != "prod/etl" {
+			http.Error(w, `{"__type":"ResourceNotFoundException"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"token":"aws-token"}`})
+	}))
+	defer secretsManager.Close()
+
+	// A stand-in for sops printing the decrypted file
+	dir := t.TempDir()
+	sops := filepath.Join(dir, "sops")
+	script := "#!/bin/sh\necho '{\"alerts\": {\"webhook\": \"https://hooks.example.com/sops\"}}'\n"
+	if err := os.WriteFile(sops, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+	t.Setenv("SECRETS_MANAGER_ENDPOINT", secretsManager.URL)
+	t.Setenv("SOPS_BINARY", sops)
+	t.Setenv("DATABASE_URL", "vault:kv/etl#db_url")
+	t.Setenv("API_TOKEN", "awssm:prod/etl#token")
+	t.Setenv("ALERT_SLACK_WEBHOOK_URL", "sops:secrets.enc.json#alerts.webhook")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.DatabaseURL != "postgres://vault/etl" {
+		t.Errorf("DatabaseURL = %q, want the vault secret", cfg.DatabaseURL)
+	}
+	if cfg.APIToken != "aws-token" {
+		t.Errorf("APIToken = %q, want the key of the AWS secret", cfg.APIToken)
+	}
+	if cfg.AlertSlackWebhookURL != "https://hooks.example.com/sops" {
+		t.Errorf("AlertSlackWebhookURL = %q, want the key of the SOPS file", cfg.AlertSlackWebhookURL)
+	}
+	if len(cfg.SecretRefs) != 3 || cfg.SecretRefs["DATABASE_URL"] != "vault:kv/etl#db_url" {
+		t.Errorf("SecretRefs = %v, want the three references", cfg.SecretRefs)
+	}
+
+	values, err := ResolveSecrets(context.Background(), []string{"awssm:prod/etl"})
+	if err != nil {
+		t.Fatalf("ResolveSecrets() error = %v", err)
+	}
+	if values["awssm:prod/etl"] != `{"token":"aws-token"}` {
+		t.Errorf("ResolveSecrets() = %v, want the whole AWS secret", values)
+	}
+
+	// Settings read without secret references are resolved no more
+	if value := getEnv("DATABASE_URL", ""); value != "vault:kv/etl#db_url" {
+		t.Errorf("getEnv() outside LoadConfig = %q, want the reference", value)
+	}
+}
+
+func TestLoadConfigSecretErrors(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+	}))
+	defer vault.Close()
+
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "expired")
+	t.Setenv("DATABASE_URL", "vault:kv/etl#db_url")
+	t.Setenv("API_TOKEN", "vault:etl")
+
+	_, err := LoadConfig()
+	if err == nil {
+		t.Fatal("LoadConfig() error = nil, want the failed references")
+	}
+	for _, want := range []string{"API_TOKEN", "DATABASE_URL", "status 403"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadConfig() error = %v, want it to mention %s", err, want)
+		}
+	}
+}
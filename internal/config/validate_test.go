@@ -0,0 +1,73 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	t.Setenv("API_TOKEN", "token")
+	t.Setenv("DATABASE_URL", "postgres://etl:password@db:5432/etl")
+	t.Setenv("SCHEDULE_TIMEZONE", "Europe/Berlin")
+	t.Setenv("REDIS_URL", "redis://:secret@cache:6379/0")
+	t.Setenv("DEDUP_TTL", "24h")
+
+	cfg, settings, problems := Validate()
+	if cfg == nil || len(problems) != 0 {
+		t.Fatalf("Validate() problems = %v, want none", problems)
+	}
+	values := make(map[string]Setting)
+	for _, setting := range settings {
+		values[setting.Name] = setting
+	}
+	tests := []Setting{
+		{Name: "API_TOKEN", Value: "[REDACTED]", Origin: OriginEnv},
+		{Name: "DATABASE_URL", Value: "postgres://etl:xxxxx@db:5432/etl", Origin: OriginEnv},
+		{Name: "SCHEDULE_TIMEZONE", Value: "Europe/Berlin", Origin: OriginEnv},
+		{Name: "REDIS_URL", Value: "redis://:xxxxx@cache:6379/0", Origin: OriginEnv},
+		{Name: "FETCH_INTERVAL", Value: "30", Origin: OriginDefault},
+		{Name: "SOURCE_COMPARE_KEY", Value: "id", Origin: OriginDefault},
+	}
+	for _, want := range tests {
+		if got := values[want.Name]; got != want {
+			t.Errorf("setting %s = %+v, want %+v", want.Name, got, want)
+		}
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	t.Setenv("FETCH_INTERVAL", "often")
+	t.Setenv("SOURCE_ENV", "staging")
+	t.Setenv("DATABASE_URL", "postgres://etl:hunter2@db:port/etl")
+	t.Setenv("SCHEDULE", "every monday")
+	t.Setenv("TRACING_SAMPLE_RATIO", "2")
+	t.Setenv("KAFKA_TOPIC", "posts")
+	t.Setenv("DB_READ_POOL_MAX_IDLE", "20")
+	t.Setenv("REDIS_URL", "cache:6379")
+	t.Setenv("ENRICH_URL", "https://api.example.com/users")
+	t.Setenv("ID_RANGE_SHARDS", "4")
+
+	_, _, problems := Validate()
+	want := []string{
+		`FETCH_INTERVAL: invalid value "often", expected an integer`,
+		`SOURCE_ENV: invalid value "staging"`,
+		"DATABASE_URL: invalid connection string",
+		`SCHEDULE: invalid value "every monday"`,
+		`TRACING_SAMPLE_RATIO: invalid value "2"`,
+		"KAFKA_TOPIC requires KAFKA_BROKERS",
+		`DB_READ_POOL_MAX_IDLE: invalid value "20", expected between 0 and DB_READ_POOL_MAX_OPEN`,
+		"REDIS_URL must start with redis:// or rediss://",
+		"ENRICH_URL must contain {key}",
+		"ENRICH_URL requires ENRICH_KEY and ENRICH_FIELDS",
+		"ID_RANGE_SHARDS requires ID_RANGE_MAX",
+	}
+	joined := strings.Join(problems, "\n")
+	for _, w := range want {
+		if !strings.Contains(joined, w) {
+			t.Errorf("Validate() problems = %v, want one containing %s", problems, w)
+		}
+	}
+	if strings.Contains(joined, "hunter2") {
+		t.Errorf("Validate() problems = %v, leaked the database password", problems)
+	}
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// FieldChange records one transformation stage modifying a field
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Stage  string      `json:"stage"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// RecordAudit lists the field changes made while transforming one source record
+type RecordAudit struct {
+	// SourceID is the id of the source record, if it has one
+	SourceID string        `json:"source_id"`
+	Changes  []FieldChange `json:"changes"`
+	// RunID is the run that transformed the record
+	RunID     string    `json:"run_id,omitempty"`
+	AuditedAt time.Time `json:"audited_at"`
+}
+
+// InsertTransformAudits stores sampled transformation audit records of a run
+func (p *PostgresDB) InsertTransformAudits(ctx context.Context, runID string, audits []RecordAudit) error {
+	return p.InsertBatch(ctx, runID, nil, nil, audits)
+}
+
+func insertTransformAudits(ctx context.Context, tx pgx.Tx, runID string, audits []RecordAudit) error {
+	rows := make([][]any, len(audits))
+	for i, audit := range audits {
+		changes, err := json.Marshal(audit.Changes)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit: %w", err)
+		}
+		rows[i] = []any{audit.SourceID, changes, nullIfEmpty(runID)}
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"transform_audit"}, []string{"source_id", "changes", "run_id"}, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("failed to insert audits: %w", err)
+	}
+	return nil
+}
+
+// TransformAudits returns the audit records of a source record, newest first
+func (p *PostgresDB) TransformAudits(ctx context.Context, sourceID string, limit int) ([]RecordAudit, error) {
+	rows, err := p.reader().QueryContext(ctx,
+		"SELECT source_id, changes, COALESCE(run_id, ''), audited_at FROM transform_audit WHERE source_id = $1 ORDER BY audited_at DESC LIMIT $2",
+		sourceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transform audits: %w", err)
+	}
+	defer rows.Close()
+
+	var audits []RecordAudit
+	for rows.Next() {
+		var audit RecordAudit
+		var changes []byte
+		if err := rows.Scan(&audit.SourceID, &changes, &audit.RunID, &audit.AuditedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan transform audit: %w", err)
+		}
+		if err := json.Unmarshal(changes, &audit.Changes); err != nil {
+			return nil, fmt.Errorf("failed to decode transform audit: %w", err)
+		}
+		audits = append(audits, audit)
+	}
+	return audits, rows.Err()
+}
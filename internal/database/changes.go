@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Operations of change events
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// ChangeEvent is a change a run made to the processed record of a source record:
+// its first load, a load with different fields, or its deletion by the source
+type ChangeEvent struct {
+	SourceID string `json:"source_id"`
+	Op       string `json:"op"`
+	// Before is the processed record before the change, nil for inserts
+	Before *ProcessedRecord `json:"before"`
+	// After is the processed record after the change, nil for deletes
+	After     *ProcessedRecord `json:"after"`
+	RunID     string           `json:"run_id,omitempty"`
+	ChangedAt time.Time        `json:"changed_at"`
+}
+
+// LatestProcessed returns the fields of the latest processed row of each of the
+// source records, by source id. Records whose latest row is deleted or a tombstone
+// are left out, as are records without rows.
+func (p *PostgresDB) LatestProcessed(ctx context.Context, sourceIDs []string) (map[string]ProcessedRecord, error) {
+	latest := make(map[string]ProcessedRecord, len(sourceIDs))
+	if len(sourceIDs) == 0 {
+		return latest, nil
+	}
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT source_id, user_id, title, body, source_time FROM (
+			SELECT DISTINCT ON (source_id) source_id, user_id, title, body, source_time, deleted_at
+			FROM processed_data
+			WHERE source_id = ANY($1)
+			ORDER BY source_id, processed_at DESC, id DESC
+		) latest
+		WHERE deleted_at IS NULL`, sourceIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latest processed records: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sourceID string
+		var record ProcessedRecord
+		var sourceTime sql.NullTime
+		if err := rows.Scan(&sourceID, &record.UserID, &record.Title, &record.Body, &sourceTime); err != nil {
+			return nil, fmt.Errorf("failed to scan processed record: %w", err)
+		}
+		if sourceTime.Valid {
+			record.SourceTime = &sourceTime.Time
+		}
+		latest[sourceID] = record
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read latest processed records: %w", err)
+	}
+	return latest, nil
+}
+
+// InsertChanges appends change events to the changes table in one transaction
+func (p *PostgresDB) InsertChanges(ctx context.Context, events []ChangeEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO changes (source_id, op, before, after, run_id, changed_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, event := range events {
+		before, err := changeImage(event.Before)
+		if err != nil {
+			return err
+		}
+		after, err := changeImage(event.After)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, event.SourceID, event.Op, before, after, event.RunID, event.ChangedAt); err != nil {
+			return fmt.Errorf("failed to insert change event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return commitError(err)
+	}
+	return nil
+}
+
+// changeImage encodes the record before or after a change as JSON, NULL when there is none
+func changeImage(record *ProcessedRecord) ([]byte, error) {
+	if record == nil {
+		return nil, nil
+	}
+	image, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode change event: %w", err)
+	}
+	return image, nil
+}
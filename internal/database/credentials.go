@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// rotatingConnector opens connections with the current connection string, so
+// rotated credentials are used by the connections opened after the rotation
+type rotatingConnector struct {
+	config atomic.Pointer[pgx.ConnConfig]
+	// tracer, when set, observes the statements of the connections opened from then on
+	tracer atomic.Pointer[statementTracer]
+}
+
+func newRotatingConnector(connectionString string) (*rotatingConnector, error) {
+	c := &rotatingConnector{}
+	if err := c.set(connectionString); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *rotatingConnector) set(connectionString string) error {
+	config, err := pgx.ParseConfig(connectionString)
+	if err != nil {
+		return fmt.Errorf("invalid connection string: %w", err)
+	}
+	c.config.Store(config)
+	return nil
+}
+
+func (c *rotatingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	config := c.config.Load()
+	if tracer := c.tracer.Load(); tracer != nil {
+		config = config.Copy()
+		config.Tracer = tracer
+	}
+	return stdlib.GetConnector(*config).Connect(ctx)
+}
+
+func (c *rotatingConnector) Driver() driver.Driver {
+	return stdlib.GetDefaultDriver()
+}
+
+// SetConnectionString replaces the connection string, e.g. after its credentials
+// were rotated. Idle connections are closed; connections in use keep the previous
+// credentials until they are returned to the pool.
+func (p *PostgresDB) SetConnectionString(connectionString string) error {
+	if err := p.connector.set(connectionString); err != nil {
+		return err
+	}
+	closeIdle(p.db, p.pool)
+	return nil
+}
+
+// SetReplicaConnectionString replaces the connection string of the read replica
+// like SetConnectionString does for the primary
+func (p *PostgresDB) SetReplicaConnectionString(connectionString string) error {
+	if p.replica == nil {
+		return fmt.Errorf("no read replica is set")
+	}
+	if err := p.replicaConnector.set(connectionString); err != nil {
+		return err
+	}
+	closeIdle(p.replica, p.replicaPool)
+	return nil
+}
+
+// closeIdle closes the idle connections of db; the limit of pool is restored as
+// soon as they are gone
+func closeIdle(db *sql.DB, pool PoolConfig) {
+	db.SetMaxIdleConns(0)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+}
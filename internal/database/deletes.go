@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// How processed records are removed when the source marks them as deleted
+const (
+	// DeleteModeDelete deletes the processed rows of the source record
+	DeleteModeDelete = "delete"
+	// DeleteModeSoft sets deleted_at on the processed rows of the source record
+	DeleteModeSoft = "soft-delete"
+	// DeleteModeTombstone keeps the processed rows and inserts a tombstone row of
+	// the source record, without fields and with deleted_at set
+	DeleteModeTombstone = "tombstone"
+)
+
+// DeleteModes lists the supported delete modes
+var DeleteModes = []string{DeleteModeDelete, DeleteModeSoft, DeleteModeTombstone}
+
+// DeleteProcessed removes the processed rows of the source records with the given
+// ids as mode says, returning the number of rows deleted, soft-deleted or inserted
+// as tombstones. Records already deleted are left alone, so repeated deletions of
+// the same record change nothing.
+func (p *PostgresDB) DeleteProcessed(ctx context.Context, runID, mode string, sourceIDs []string) (int64, error) {
+	if len(sourceIDs) == 0 {
+		return 0, nil
+	}
+	var query string
+	args := []interface{}{sourceIDs}
+	switch mode {
+	case DeleteModeDelete:
+		query = "DELETE FROM processed_data WHERE source_id = ANY($1)"
+	case DeleteModeSoft:
+		query = "UPDATE processed_data SET deleted_at = CURRENT_TIMESTAMP WHERE source_id = ANY($1) AND deleted_at IS NULL"
+	case DeleteModeTombstone:
+		// Unless the latest row of the record is a tombstone already
+		query = `
+			INSERT INTO processed_data (source_id, run_id, deleted_at)
+			SELECT ids.id, NULLIF($2, ''), CURRENT_TIMESTAMP
+			FROM unnest($1::text[]) AS ids(id)
+			WHERE NOT EXISTS (
+				SELECT 1 FROM (
+					SELECT deleted_at FROM processed_data p
+					WHERE p.source_id = ids.id
+					ORDER BY p.processed_at DESC, p.id DESC
+					LIMIT 1
+				) latest
+				WHERE latest.deleted_at IS NOT NULL
+			)`
+		args = append(args, runID)
+	default:
+		return 0, fmt.Errorf("unknown delete mode %q", mode)
+	}
+	result, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to %s processed records: %w", mode, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to %s processed records: %w", mode, err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// LoadKinesisCheckpoints returns the checkpointed sequence number of each shard of
+// a Kinesis stream, keyed by shard id
+func (p *PostgresDB) LoadKinesisCheckpoints(ctx context.Context, stream string) (map[string]string, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT shard_id, sequence_number FROM kinesis_checkpoints WHERE stream = $1", stream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query kinesis checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	checkpoints := make(map[string]string)
+	for rows.Next() {
+		var shardID, sequenceNumber string
+		if err := rows.Scan(&shardID, &sequenceNumber); err != nil {
+			return nil, fmt.Errorf("failed to scan kinesis checkpoint: %w", err)
+		}
+		checkpoints[shardID] = sequenceNumber
+	}
+	return checkpoints, rows.Err()
+}
+
+// SaveKinesisCheckpoint upserts the checkpoint of one shard of a Kinesis stream
+func (p *PostgresDB) SaveKinesisCheckpoint(ctx context.Context, stream, shardID, sequenceNumber string) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO kinesis_checkpoints (stream, shard_id, sequence_number, updated_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (stream, shard_id)
+		DO UPDATE SET sequence_number = EXCLUDED.sequence_number, updated_at = EXCLUDED.updated_at`,
+		stream, shardID, sequenceNumber)
+	if err != nil {
+		return fmt.Errorf("failed to save kinesis checkpoint: %w", err)
+	}
+	return nil
+}
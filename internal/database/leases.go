@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ClaimShards renews the shard leases of owner and claims free or expired shards of
+// a source, up to an even share among the instances with a live heartbeat. Leases
+// beyond that share are released so instances joining later get shards. It returns
+// the starts of the shards owner holds for ttl.
+func (p *PostgresDB) ClaimShards(ctx context.Context, source, owner string, shardStarts []int64, ttl time.Duration) ([]int64, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seconds := ttl.Seconds()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO shard_instances (source, owner, heartbeat_at) VALUES ($1, $2, NOW())
+		ON CONFLICT (source, owner) DO UPDATE SET heartbeat_at = EXCLUDED.heartbeat_at`,
+		source, owner); err != nil {
+		return nil, fmt.Errorf("failed to record heartbeat: %w", err)
+	}
+	var instances int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM shard_instances
+		WHERE source = $1 AND heartbeat_at > NOW() - make_interval(secs => $2)`,
+		source, seconds).Scan(&instances); err != nil {
+		return nil, fmt.Errorf("failed to count instances: %w", err)
+	}
+	share := fairShare(len(shardStarts), instances)
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT shard_start FROM shard_leases
+		WHERE source = $1 AND owner = $2 AND expires_at > NOW()
+		ORDER BY shard_start`,
+		source, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shard leases: %w", err)
+	}
+	var held []int64
+	for rows.Next() {
+		var start int64
+		if err := rows.Scan(&start); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan shard lease: %w", err)
+		}
+		held = append(held, start)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query shard leases: %w", err)
+	}
+
+	// Give up the shards beyond the share and renew the rest
+	if len(held) > share {
+		for _, start := range held[share:] {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM shard_leases WHERE source = $1 AND shard_start = $2 AND owner = $3", source, start, owner); err != nil {
+				return nil, fmt.Errorf("failed to release shard %d: %w", start, err)
+			}
+		}
+		held = held[:share]
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE shard_leases SET expires_at = NOW() + make_interval(secs => $3)
+		WHERE source = $1 AND owner = $2`,
+		source, owner, seconds); err != nil {
+		return nil, fmt.Errorf("failed to renew shard leases: %w", err)
+	}
+
+	// Claim free shards; a lease held by a live instance is left alone
+	holding := make(map[int64]bool, len(held))
+	for _, start := range held {
+		holding[start] = true
+	}
+	for _, start := range shardStarts {
+		if len(held) >= share {
+			break
+		}
+		if holding[start] {
+			continue
+		}
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO shard_leases (source, shard_start, owner, expires_at)
+			VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))
+			ON CONFLICT (source, shard_start) DO UPDATE
+			SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at
+			WHERE shard_leases.expires_at <= NOW()`,
+			source, start, owner, seconds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim shard %d: %w", start, err)
+		}
+		if claimed, _ := result.RowsAffected(); claimed > 0 {
+			held = append(held, start)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit shard leases: %w", err)
+	}
+	return held, nil
+}
+
+// HeldShards returns the starts of the shards of a source owner holds an
+// unexpired lease on, without renewing them
+func (p *PostgresDB) HeldShards(ctx context.Context, source, owner string) ([]int64, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT shard_start FROM shard_leases
+		WHERE source = $1 AND owner = $2 AND expires_at > NOW()
+		ORDER BY shard_start`,
+		source, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shard leases: %w", err)
+	}
+	defer rows.Close()
+	var held []int64
+	for rows.Next() {
+		var start int64
+		if err := rows.Scan(&start); err != nil {
+			return nil, fmt.Errorf("failed to scan shard lease: %w", err)
+		}
+		held = append(held, start)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query shard leases: %w", err)
+	}
+	return held, nil
+}
+
+// ReleaseShards gives up the shard leases and heartbeat of owner, e.g. on
+// shutdown, so other instances take over its shards without waiting for expiry
+func (p *PostgresDB) ReleaseShards(source, owner string) error {
+	if _, err := p.db.Exec("DELETE FROM shard_leases WHERE source = $1 AND owner = $2", source, owner); err != nil {
+		return fmt.Errorf("failed to release shard leases: %w", err)
+	}
+	if _, err := p.db.Exec("DELETE FROM shard_instances WHERE source = $1 AND owner = $2", source, owner); err != nil {
+		return fmt.Errorf("failed to remove instance heartbeat: %w", err)
+	}
+	return nil
+}
+
+// fairShare returns how many of shards each of instances claims, rounding up so
+// every shard has an owner
+func fairShare(shards, instances int) int {
+	if instances < 1 {
+		instances = 1
+	}
+	return (shards + instances - 1) / instances
+}
@@ -0,0 +1,20 @@
+package database
+
+import "testing"
+
+func TestFairShare(t *testing.T) {
+	tests := []struct {
+		shards, instances, want int
+	}{
+		{8, 1, 8},
+		{8, 2, 4},
+		{8, 3, 3},
+		{2, 4, 1},
+		{4, 0, 4},
+	}
+	for _, tt := range tests {
+		if got := fairShare(tt.shards, tt.instances); got != tt.want {
+			t.Errorf("fairShare(%d, %d): expected %d, got %d", tt.shards, tt.instances, tt.want, got)
+		}
+	}
+}
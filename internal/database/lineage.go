@@ -0,0 +1,72 @@
+package database
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Lineage traces a processed record back to the raw record it was transformed from
+// and the transform that produced it
+type Lineage struct {
+	// Source names the source the raw record was extracted from
+	Source string `json:"source,omitempty"`
+	// SourceHash is the PayloadHash of the raw record
+	SourceHash string `json:"source_hash,omitempty"`
+	// SourceID is the id the source gave the raw record, if any, which deletions
+	// marked by the source are matched by
+	SourceID string `json:"source_id,omitempty"`
+	// RawDataID is the raw_data row of the raw record, once it is stored
+	RawDataID int64 `json:"raw_data_id,omitempty"`
+	// TransformVersion identifies the field mapping the record was transformed with
+	TransformVersion string `json:"transform_version,omitempty"`
+	// Line is the position of the raw record in the batch it was transformed from,
+	// resolving RawDataID when the batch is inserted
+	Line int `json:"line,omitempty"`
+}
+
+// PayloadHash returns the hex SHA-256 digest of a raw record's JSON, compacted so
+// whitespace does not change it
+func PayloadHash(payload []byte) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, payload); err == nil {
+		payload = compact.Bytes()
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// resolveLineage sets the raw_data row of processed records transformed from a
+// batch inserted with the ids
+func resolveLineage(records []ProcessedRecord, ids []int64) {
+	for _, record := range records {
+		if record.Lineage != nil && record.Lineage.Line < len(ids) {
+			record.Lineage.RawDataID = ids[record.Lineage.Line]
+		}
+	}
+}
+
+// lineageColumns returns the values of the lineage columns of a processed record,
+// NULL when it has no lineage
+func lineageColumns(record ProcessedRecord) (source, sourceHash sql.NullString, rawDataID sql.NullInt64, transformVersion sql.NullString) {
+	lineage := record.Lineage
+	if lineage == nil {
+		return
+	}
+	source = sql.NullString{String: lineage.Source, Valid: lineage.Source != ""}
+	sourceHash = sql.NullString{String: lineage.SourceHash, Valid: lineage.SourceHash != ""}
+	rawDataID = sql.NullInt64{Int64: lineage.RawDataID, Valid: lineage.RawDataID != 0}
+	transformVersion = sql.NullString{String: lineage.TransformVersion, Valid: lineage.TransformVersion != ""}
+	return
+}
+
+// sourceIDColumn returns the value of the source_id column of a processed record,
+// NULL when its source id is unknown
+func sourceIDColumn(record ProcessedRecord) sql.NullString {
+	if record.Lineage == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: record.Lineage.SourceID, Valid: record.Lineage.SourceID != ""}
+}
@@ -0,0 +1,41 @@
+package database
+
+import "testing"
+
+func TestPayloadHashIgnoresWhitespace(t *testing.T) {
+	compact := PayloadHash([]byte(`{"id":1,"title":"a b"}`))
+	if spaced := PayloadHash([]byte("{ \"id\": 1,\n  \"title\": \"a b\" }")); spaced != compact {
+		t.Errorf("Expected whitespace not to change the hash, got %s and %s", spaced, compact)
+	}
+	if reordered := PayloadHash([]byte(`{"title":"a b","id":1}`)); reordered == compact {
+		t.Error("Expected the payload as received to be hashed, keys in order")
+	}
+	if len(compact) != 64 {
+		t.Errorf("Expected a hex SHA-256 digest, got %q", compact)
+	}
+}
+
+func TestResolveLineage(t *testing.T) {
+	records := []ProcessedRecord{
+		{UserID: 1, Lineage: &Lineage{Line: 0}},
+		{UserID: 2},
+		{UserID: 3, Lineage: &Lineage{Line: 2}},
+		{UserID: 4, Lineage: &Lineage{Line: 5}},
+	}
+	resolveLineage(records, []int64{10, 11, 12})
+	if records[0].Lineage.RawDataID != 10 || records[2].Lineage.RawDataID != 12 {
+		t.Errorf("Expected records linked to the raw rows at their lines, got %d and %d", records[0].Lineage.RawDataID, records[2].Lineage.RawDataID)
+	}
+	if records[3].Lineage.RawDataID != 0 {
+		t.Errorf("Expected a line outside the batch to stay unlinked, got %d", records[3].Lineage.RawDataID)
+	}
+
+	source, hash, rawDataID, version := lineageColumns(records[1])
+	if source.Valid || hash.Valid || rawDataID.Valid || version.Valid {
+		t.Error("Expected a record without lineage to have NULL lineage columns")
+	}
+	records[0].Lineage.Source = "production"
+	if source, _, rawDataID, _ = lineageColumns(records[0]); source.String != "production" || rawDataID.Int64 != 10 {
+		t.Errorf("Unexpected lineage columns: %v, %v", source, rawDataID)
+	}
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// Maintenance commands run on the managed tables
+const (
+	MaintenanceAnalyze = "analyze"
+	MaintenanceVacuum  = "vacuum"
+	MaintenanceRepack  = "repack"
+)
+
+// maintenanceLockID is the advisory lock key letting one replica at a time
+// maintain the tables
+const maintenanceLockID = 7263540092
+
+// MaintainedTables are the tables maintained when none are configured: those every
+// cycle inserts into and retention deletes from
+var MaintainedTables = []string{"raw_data", "processed_data", "processed_data_staging", "transform_audit", "pipeline_runs"}
+
+// maintainedTable matches a table name, optionally qualified by its schema
+var maintainedTable = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// Maintainer vacuums and analyzes the managed tables, which high-churn ingestion
+// bloats, skipping each table while a load is writing to it
+type Maintainer struct {
+	db      *PostgresDB
+	command string
+	tables  []string
+	logger  *logging.Logger
+	metrics *metrics.Metrics
+}
+
+// NewMaintainer creates a maintainer running command on tables, or on
+// MaintainedTables when tables is empty
+func NewMaintainer(db *PostgresDB, command string, tables []string, logger *logging.Logger, metrics *metrics.Metrics) (*Maintainer, error) {
+	switch command {
+	case MaintenanceAnalyze, MaintenanceVacuum, MaintenanceRepack:
+	default:
+		return nil, fmt.Errorf("unknown maintenance command %q, expected %s, %s or %s", command, MaintenanceAnalyze, MaintenanceVacuum, MaintenanceRepack)
+	}
+	if len(tables) == 0 {
+		tables = MaintainedTables
+	}
+	for _, table := range tables {
+		if !maintainedTable.MatchString(table) {
+			return nil, fmt.Errorf("invalid table name %q", table)
+		}
+	}
+	if command == MaintenanceRepack {
+		if _, err := exec.LookPath("pg_repack"); err != nil {
+			return nil, fmt.Errorf("pg_repack is not installed: %w", err)
+		}
+	}
+	return &Maintainer{db: db, command: command, tables: tables, logger: logger, metrics: metrics}, nil
+}
+
+// Run maintains each table no load is writing to. Nothing is done while another
+// replica is maintaining the tables.
+func (m *Maintainer) Run(ctx context.Context) error {
+	conn, err := m.db.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", maintenanceLockID).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to acquire maintenance lock: %w", err)
+	}
+	if !locked {
+		m.logger.Info("Skipping table maintenance: another instance is maintaining the tables")
+		return nil
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", maintenanceLockID)
+
+	var failed []string
+	for _, table := range m.tables {
+		busy, err := tableBusy(ctx, conn, table)
+		if err == nil && busy {
+			m.metrics.TableMaintenanceTotal.WithLabelValues(table, "skipped").Inc()
+			m.logger.Info(fmt.Sprintf("Skipping %s of %s: a load is writing to it", m.command, table))
+			continue
+		}
+		start := time.Now()
+		if err == nil {
+			err = m.maintain(ctx, conn, table)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			m.metrics.TableMaintenanceTotal.WithLabelValues(table, "failed").Inc()
+			m.logger.Error(fmt.Sprintf("Failed to %s %s: %v", m.command, table, err))
+			failed = append(failed, table)
+			continue
+		}
+		m.metrics.TableMaintenanceTotal.WithLabelValues(table, "done").Inc()
+		m.logger.Info(fmt.Sprintf("Ran %s on %s in %v", m.command, table, time.Since(start).Round(time.Millisecond)))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s failed on %s", m.command, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Start maintains the tables every interval until ctx is cancelled
+func (m *Maintainer) Start(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Run(ctx); err != nil && ctx.Err() == nil {
+				m.logger.Error(fmt.Sprintf("Table maintenance failed: %v", err))
+			}
+		}
+	}
+}
+
+// tableBusy reports whether another session holds the lock an INSERT, UPDATE,
+// DELETE or COPY takes on table, which it keeps until its transaction ends
+func tableBusy(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	var busy bool
+	err := conn.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM pg_locks
+			WHERE relation = $1::text::regclass AND mode = 'RowExclusiveLock' AND granted AND pid <> pg_backend_pid()
+		)`, table).Scan(&busy)
+	if err != nil {
+		return false, fmt.Errorf("failed to check locks of %s: %w", table, err)
+	}
+	return busy, nil
+}
+
+// maintain runs the command of m on table. Partitioned tables are maintained with
+// all their partitions.
+func (m *Maintainer) maintain(ctx context.Context, conn *sql.Conn, table string) error {
+	name := pgx.Identifier(strings.Split(table, ".")).Sanitize()
+	switch m.command {
+	case MaintenanceAnalyze:
+		_, err := conn.ExecContext(ctx, "ANALYZE "+name)
+		return err
+	case MaintenanceVacuum:
+		_, err := conn.ExecContext(ctx, "VACUUM (ANALYZE) "+name)
+		return err
+	}
+
+	var kind string
+	if err := conn.QueryRowContext(ctx, "SELECT relkind FROM pg_class WHERE oid = $1::text::regclass", table).Scan(&kind); err != nil {
+		return fmt.Errorf("failed to look up table: %w", err)
+	}
+	option := "--table=" + table
+	if kind == "p" {
+		// pg_repack rebuilds the partitions of a partitioned table, which has no
+		// storage of its own
+		option = "--parent-table=" + table
+	}
+	cmd := exec.CommandContext(ctx, "pg_repack", "--no-order", option)
+	cmd.Env = append(os.Environ(), m.db.libpqEnv()...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("pg_repack: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// libpqEnv returns the environment variables connecting libpq clients such as
+// pg_repack to the primary. The TLS settings are reduced to an sslmode, so
+// certificates are not verified.
+func (p *PostgresDB) libpqEnv() []string {
+	config := p.connector.config.Load()
+	sslMode := "disable"
+	if config.TLSConfig != nil {
+		sslMode = "require"
+		for _, fallback := range config.Fallbacks {
+			if fallback.TLSConfig == nil {
+				sslMode = "prefer"
+			}
+		}
+	}
+	return []string{
+		"PGHOST=" + config.Host,
+		"PGPORT=" + strconv.Itoa(int(config.Port)),
+		"PGUSER=" + config.User,
+		"PGPASSWORD=" + config.Password,
+		"PGDATABASE=" + config.Database,
+		"PGSSLMODE=" + sslMode,
+	}
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestNewMaintainer(t *testing.T) {
+	logger, err := logging.NewLogger("test.log")
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	defer logger.Close()
+
+	m, err := NewMaintainer(nil, MaintenanceVacuum, nil, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewMaintainer: %v", err)
+	}
+	if !slices.Equal(m.tables, MaintainedTables) {
+		t.Errorf("tables = %v, want %v", m.tables, MaintainedTables)
+	}
+
+	for _, tt := range []struct {
+		command string
+		tables  []string
+	}{
+		{"cluster", nil},
+		{MaintenanceAnalyze, []string{"raw_data; DROP TABLE raw_data"}},
+		{MaintenanceAnalyze, []string{"Raw_Data"}},
+	} {
+		if _, err := NewMaintainer(nil, tt.command, tt.tables, logger, metrics.NewMetrics()); err == nil {
+			t.Errorf("NewMaintainer(%q, %v) succeeded", tt.command, tt.tables)
+		}
+	}
+	if _, err := NewMaintainer(nil, MaintenanceAnalyze, []string{"public.raw_data"}, logger, metrics.NewMetrics()); err != nil {
+		t.Errorf("NewMaintainer with a schema-qualified table: %v", err)
+	}
+}
+
+func TestLibpqEnv(t *testing.T) {
+	tests := []struct {
+		connectionString string
+		sslMode          string
+	}{
+		{"postgres://etl:secret@db:5433/etl_db?sslmode=disable", "disable"},
+		{"postgres://etl:secret@db:5433/etl_db?sslmode=prefer", "prefer"},
+		{"postgres://etl:secret@db:5433/etl_db?sslmode=require", "require"},
+	}
+
+	for _, tt := range tests {
+		connector, err := newRotatingConnector(tt.connectionString)
+		if err != nil {
+			t.Fatalf("newRotatingConnector: %v", err)
+		}
+		env := (&PostgresDB{connector: connector}).libpqEnv()
+		for _, want := range []string{"PGHOST=db", "PGPORT=5433", "PGUSER=etl", "PGPASSWORD=secret", "PGDATABASE=etl_db", "PGSSLMODE=" + tt.sslMode} {
+			if !slices.Contains(env, want) {
+				t.Errorf("%s: env %v lacks %s", tt.connectionString, env, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrationsAreComplete(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("Expected migration %d to have version %d, got %d", i, i+1, migration.Version)
+		}
+		if migration.Down == "" {
+			t.Errorf("Migration %d (%s) has no down script", migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestParseMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_add_index.up.sql": {Data: []byte("CREATE INDEX")},
+		"m/0001_init.up.sql":      {Data: []byte("CREATE TABLE")},
+		"m/0001_init.down.sql":    {Data: []byte("DROP TABLE")},
+		"m/README.md":             {Data: []byte("ignored")},
+		"m/0003_orphan.down.sql":  {Data: []byte("DROP")},
+	}
+
+	if _, err := parseMigrations(fsys, "m"); err == nil {
+		t.Error("Expected error for migration without up script")
+	}
+
+	delete(fsys, "m/0003_orphan.down.sql")
+	migrations, err := parseMigrations(fsys, "m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("Expected 2 migrations, got %d", len(migrations))
+	}
+	if migrations[0].Name != "init" || migrations[0].Down != "DROP TABLE" {
+		t.Errorf("Unexpected first migration: %+v", migrations[0])
+	}
+	if migrations[1].Version != 2 || migrations[1].Down != "" {
+		t.Errorf("Unexpected second migration: %+v", migrations[1])
+	}
+}
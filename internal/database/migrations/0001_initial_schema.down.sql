@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS processed_data;
+DROP TABLE IF EXISTS raw_data;
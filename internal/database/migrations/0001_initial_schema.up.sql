@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS raw_data (
+	id SERIAL PRIMARY KEY,
+	data JSONB NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS processed_data (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER,
+	title TEXT,
+	body TEXT,
+	processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_raw_data_created_at ON raw_data(created_at);
+CREATE INDEX IF NOT EXISTS idx_processed_data_processed_at ON processed_data(processed_at);
+CREATE INDEX IF NOT EXISTS idx_processed_data_user_id ON processed_data(user_id);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS extraction_watermarks (
+	source TEXT NOT NULL,
+	shard_start BIGINT NOT NULL,
+	watermark BIGINT NOT NULL,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (source, shard_start)
+);
@@ -0,0 +1,35 @@
+-- Fold all partitions back into plain tables
+
+ALTER TABLE raw_data RENAME TO raw_data_partitioned;
+ALTER TABLE raw_data_partitioned RENAME CONSTRAINT raw_data_pkey TO raw_data_partitioned_pkey;
+ALTER SEQUENCE raw_data_id_seq OWNED BY NONE;
+DROP INDEX IF EXISTS idx_raw_data_created_at;
+
+CREATE TABLE raw_data (
+	id INTEGER PRIMARY KEY DEFAULT nextval('raw_data_id_seq'),
+	data JSONB NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO raw_data (id, data, created_at) SELECT id, data, created_at FROM raw_data_partitioned;
+DROP TABLE raw_data_partitioned;
+ALTER SEQUENCE raw_data_id_seq OWNED BY raw_data.id;
+CREATE INDEX idx_raw_data_created_at ON raw_data(created_at);
+
+ALTER TABLE processed_data RENAME TO processed_data_partitioned;
+ALTER TABLE processed_data_partitioned RENAME CONSTRAINT processed_data_pkey TO processed_data_partitioned_pkey;
+ALTER SEQUENCE processed_data_id_seq OWNED BY NONE;
+DROP INDEX IF EXISTS idx_processed_data_processed_at;
+DROP INDEX IF EXISTS idx_processed_data_user_id;
+
+CREATE TABLE processed_data (
+	id INTEGER PRIMARY KEY DEFAULT nextval('processed_data_id_seq'),
+	user_id INTEGER,
+	title TEXT,
+	body TEXT,
+	processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO processed_data (id, user_id, title, body, processed_at) SELECT id, user_id, title, body, processed_at FROM processed_data_partitioned;
+DROP TABLE processed_data_partitioned;
+ALTER SEQUENCE processed_data_id_seq OWNED BY processed_data.id;
+CREATE INDEX idx_processed_data_processed_at ON processed_data(processed_at);
+CREATE INDEX idx_processed_data_user_id ON processed_data(user_id);
@@ -0,0 +1,45 @@
+-- Convert raw_data and processed_data into tables range-partitioned by ingestion
+-- time. Existing rows land in the default partition; dated partitions are created
+-- ahead of time by the partition manager.
+
+ALTER TABLE raw_data RENAME TO raw_data_unpartitioned;
+ALTER TABLE raw_data_unpartitioned RENAME CONSTRAINT raw_data_pkey TO raw_data_unpartitioned_pkey;
+ALTER SEQUENCE raw_data_id_seq OWNED BY NONE;
+DROP INDEX IF EXISTS idx_raw_data_created_at;
+
+CREATE TABLE raw_data (
+	id INTEGER NOT NULL DEFAULT nextval('raw_data_id_seq'),
+	data JSONB NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+CREATE TABLE raw_data_default PARTITION OF raw_data DEFAULT;
+
+INSERT INTO raw_data (id, data, created_at)
+SELECT id, data, COALESCE(created_at, CURRENT_TIMESTAMP) FROM raw_data_unpartitioned;
+DROP TABLE raw_data_unpartitioned;
+ALTER SEQUENCE raw_data_id_seq OWNED BY raw_data.id;
+CREATE INDEX idx_raw_data_created_at ON raw_data(created_at);
+
+ALTER TABLE processed_data RENAME TO processed_data_unpartitioned;
+ALTER TABLE processed_data_unpartitioned RENAME CONSTRAINT processed_data_pkey TO processed_data_unpartitioned_pkey;
+ALTER SEQUENCE processed_data_id_seq OWNED BY NONE;
+DROP INDEX IF EXISTS idx_processed_data_processed_at;
+DROP INDEX IF EXISTS idx_processed_data_user_id;
+
+CREATE TABLE processed_data (
+	id INTEGER NOT NULL DEFAULT nextval('processed_data_id_seq'),
+	user_id INTEGER,
+	title TEXT,
+	body TEXT,
+	processed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id, processed_at)
+) PARTITION BY RANGE (processed_at);
+CREATE TABLE processed_data_default PARTITION OF processed_data DEFAULT;
+
+INSERT INTO processed_data (id, user_id, title, body, processed_at)
+SELECT id, user_id, title, body, COALESCE(processed_at, CURRENT_TIMESTAMP) FROM processed_data_unpartitioned;
+DROP TABLE processed_data_unpartitioned;
+ALTER SEQUENCE processed_data_id_seq OWNED BY processed_data.id;
+CREATE INDEX idx_processed_data_processed_at ON processed_data(processed_at);
+CREATE INDEX idx_processed_data_user_id ON processed_data(user_id);
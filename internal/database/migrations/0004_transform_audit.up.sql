@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS transform_audit (
+	id BIGSERIAL PRIMARY KEY,
+	source_id TEXT,
+	changes JSONB NOT NULL,
+	audited_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_transform_audit_source_id ON transform_audit(source_id);
+CREATE INDEX IF NOT EXISTS idx_transform_audit_audited_at ON transform_audit(audited_at);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_processed_data_run_id;
+DROP INDEX IF EXISTS idx_raw_data_run_id;
+
+ALTER TABLE transform_audit DROP COLUMN IF EXISTS run_id;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS run_id;
+ALTER TABLE raw_data DROP COLUMN IF EXISTS run_id;
+
+DROP TABLE IF EXISTS pipeline_runs;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS pipeline_runs (
+	run_id TEXT PRIMARY KEY,
+	trigger TEXT NOT NULL,
+	status TEXT NOT NULL,
+	started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	finished_at TIMESTAMP,
+	records_extracted INTEGER NOT NULL DEFAULT 0,
+	records_transformed INTEGER NOT NULL DEFAULT 0,
+	records_rejected INTEGER NOT NULL DEFAULT 0,
+	records_loaded INTEGER NOT NULL DEFAULT 0,
+	error_count INTEGER NOT NULL DEFAULT 0,
+	error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_pipeline_runs_started_at ON pipeline_runs(started_at);
+
+-- Rows written before this migration have no run
+ALTER TABLE raw_data ADD COLUMN run_id TEXT;
+ALTER TABLE processed_data ADD COLUMN run_id TEXT;
+ALTER TABLE transform_audit ADD COLUMN run_id TEXT;
+
+CREATE INDEX idx_raw_data_run_id ON raw_data(run_id);
+CREATE INDEX idx_processed_data_run_id ON processed_data(run_id);
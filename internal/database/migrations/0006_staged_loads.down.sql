@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS processed_loads;
+DROP TABLE IF EXISTS processed_data_staging;
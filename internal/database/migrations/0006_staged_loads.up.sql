@@ -0,0 +1,18 @@
+-- Processed records of a run are staged here, then promoted into processed_data
+-- by a transaction that records the run in processed_loads, so a run is never
+-- loaded twice
+CREATE TABLE IF NOT EXISTS processed_data_staging (
+	run_id TEXT NOT NULL,
+	user_id INTEGER,
+	title TEXT,
+	body TEXT,
+	staged_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_data_staging_run_id ON processed_data_staging(run_id);
+
+CREATE TABLE IF NOT EXISTS processed_loads (
+	run_id TEXT PRIMARY KEY,
+	records INTEGER NOT NULL,
+	loaded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_pipeline_runs_backfill_id;
+
+ALTER TABLE pipeline_runs DROP COLUMN IF EXISTS range_to;
+ALTER TABLE pipeline_runs DROP COLUMN IF EXISTS range_from;
+ALTER TABLE pipeline_runs DROP COLUMN IF EXISTS backfill_id;
@@ -0,0 +1,7 @@
+-- Backfill runs record the backfill they belong to and the date range they
+-- extracted, so an interrupted backfill resumes with its missing chunks
+ALTER TABLE pipeline_runs ADD COLUMN backfill_id TEXT;
+ALTER TABLE pipeline_runs ADD COLUMN range_from TIMESTAMP;
+ALTER TABLE pipeline_runs ADD COLUMN range_to TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_pipeline_runs_backfill_id ON pipeline_runs(backfill_id);
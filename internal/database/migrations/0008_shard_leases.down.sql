@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS shard_leases;
+DROP TABLE IF EXISTS shard_instances;
@@ -0,0 +1,16 @@
+-- Instances extracting the same sharded source claim disjoint shards through
+-- expiring leases; each instance keeps a heartbeat so the shards are spread evenly
+CREATE TABLE IF NOT EXISTS shard_instances (
+	source TEXT NOT NULL,
+	owner TEXT NOT NULL,
+	heartbeat_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (source, owner)
+);
+
+CREATE TABLE IF NOT EXISTS shard_leases (
+	source TEXT NOT NULL,
+	shard_start BIGINT NOT NULL,
+	owner TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (source, shard_start)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_pipeline_runs_pipeline_started_at;
+
+ALTER TABLE pipeline_runs DROP COLUMN IF EXISTS pipeline;
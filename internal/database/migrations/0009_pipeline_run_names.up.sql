@@ -0,0 +1,6 @@
+-- Runs record the pipeline they belong to, so the runs of each pipeline of a
+-- PIPELINES_FILE sharing the database can be listed; earlier runs were made by the
+-- pipeline of the environment configuration
+ALTER TABLE pipeline_runs ADD COLUMN pipeline TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_pipeline_runs_pipeline_started_at ON pipeline_runs(pipeline, started_at DESC);
@@ -0,0 +1,13 @@
+-- The scheduler state of each pipeline, saved as cycles start and finish, so a
+-- restarted instance resumes its schedule, pending retry and paused flag instead
+-- of running a cycle right away
+CREATE TABLE IF NOT EXISTS scheduler_state (
+	pipeline TEXT PRIMARY KEY,
+	last_tick_at TIMESTAMP,
+	running BOOLEAN NOT NULL DEFAULT FALSE,
+	continuation BOOLEAN NOT NULL DEFAULT FALSE,
+	paused BOOLEAN NOT NULL DEFAULT FALSE,
+	retry_at TIMESTAMP,
+	retries INTEGER NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+DELETE FROM raw_data WHERE data IS NULL;
+ALTER TABLE raw_data DROP COLUMN IF EXISTS blob_line;
+ALTER TABLE raw_data DROP COLUMN IF EXISTS blob;
+ALTER TABLE raw_data ALTER COLUMN data SET NOT NULL;
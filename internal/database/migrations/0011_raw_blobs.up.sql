@@ -0,0 +1,5 @@
+-- Raw records may be kept in a content-addressed blob instead of the data column;
+-- such rows reference the blob and their line in it
+ALTER TABLE raw_data ALTER COLUMN data DROP NOT NULL;
+ALTER TABLE raw_data ADD COLUMN blob TEXT;
+ALTER TABLE raw_data ADD COLUMN blob_line INTEGER;
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_processed_data_source_hash;
+DROP INDEX IF EXISTS idx_processed_data_raw_data_id;
+ALTER TABLE processed_data_staging DROP COLUMN IF EXISTS transform_version;
+ALTER TABLE processed_data_staging DROP COLUMN IF EXISTS raw_data_id;
+ALTER TABLE processed_data_staging DROP COLUMN IF EXISTS source_hash;
+ALTER TABLE processed_data_staging DROP COLUMN IF EXISTS source;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS transform_version;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS raw_data_id;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS source_hash;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS source;
+ALTER TABLE raw_data DROP COLUMN IF EXISTS source_hash;
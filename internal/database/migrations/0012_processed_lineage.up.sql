@@ -0,0 +1,14 @@
+-- Processed records are traced back to the raw record they were transformed from
+-- and the transform that produced them; raw records keep the digest of their payload
+ALTER TABLE raw_data ADD COLUMN source_hash TEXT;
+ALTER TABLE processed_data ADD COLUMN source TEXT;
+ALTER TABLE processed_data ADD COLUMN source_hash TEXT;
+ALTER TABLE processed_data ADD COLUMN raw_data_id INTEGER;
+ALTER TABLE processed_data ADD COLUMN transform_version TEXT;
+ALTER TABLE processed_data_staging ADD COLUMN source TEXT;
+ALTER TABLE processed_data_staging ADD COLUMN source_hash TEXT;
+ALTER TABLE processed_data_staging ADD COLUMN raw_data_id INTEGER;
+ALTER TABLE processed_data_staging ADD COLUMN transform_version TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_processed_data_raw_data_id ON processed_data(raw_data_id);
+CREATE INDEX IF NOT EXISTS idx_processed_data_source_hash ON processed_data(source_hash);
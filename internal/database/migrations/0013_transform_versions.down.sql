@@ -0,0 +1,3 @@
+DROP VIEW IF EXISTS processed_data_current;
+DROP INDEX IF EXISTS idx_processed_data_transform_version;
+DROP TABLE IF EXISTS transform_versions;
@@ -0,0 +1,17 @@
+-- Transform versions seen by each pipeline, with the field mapping they stand for,
+-- so processed rows of older versions stay interpretable after a reprocess
+CREATE TABLE IF NOT EXISTS transform_versions (
+	pipeline TEXT NOT NULL,
+	version TEXT NOT NULL,
+	fields JSONB NOT NULL,
+	first_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (pipeline, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_data_transform_version ON processed_data(transform_version);
+
+-- The latest processed row of each raw record; rows without a raw record are all kept
+CREATE OR REPLACE VIEW processed_data_current AS
+SELECT DISTINCT ON (COALESCE(raw_data_id, -id)) *
+FROM processed_data
+ORDER BY COALESCE(raw_data_id, -id), processed_at DESC, id DESC;
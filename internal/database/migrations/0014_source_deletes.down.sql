@@ -0,0 +1,10 @@
+DROP VIEW IF EXISTS processed_data_current;
+DROP INDEX IF EXISTS idx_processed_data_source_id;
+ALTER TABLE processed_data_staging DROP COLUMN IF EXISTS source_id;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS source_id;
+
+CREATE OR REPLACE VIEW processed_data_current AS
+SELECT DISTINCT ON (COALESCE(raw_data_id, -id)) *
+FROM processed_data
+ORDER BY COALESCE(raw_data_id, -id), processed_at DESC, id DESC;
@@ -0,0 +1,18 @@
+-- Processed records keep the id of their source record, so that records the source
+-- marks as deleted can be deleted, soft-deleted or followed by a tombstone row
+ALTER TABLE processed_data ADD COLUMN source_id TEXT;
+ALTER TABLE processed_data ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE processed_data_staging ADD COLUMN source_id TEXT;
+
+UPDATE processed_data p SET source_id = r.data->>'id'
+FROM raw_data r
+WHERE r.id = p.raw_data_id AND p.source_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_processed_data_source_id ON processed_data(source_id);
+
+-- The latest processed row of each raw record that is not deleted
+CREATE OR REPLACE VIEW processed_data_current AS
+SELECT DISTINCT ON (COALESCE(raw_data_id, -id)) *
+FROM processed_data
+WHERE deleted_at IS NULL
+ORDER BY COALESCE(raw_data_id, -id), processed_at DESC, id DESC;
@@ -0,0 +1,14 @@
+-- Change events of processed records: inserts, updates and deletes of the processed
+-- record of each source record, for consumers keeping copies up to date
+CREATE TABLE IF NOT EXISTS changes (
+	id BIGSERIAL PRIMARY KEY,
+	source_id TEXT NOT NULL,
+	op TEXT NOT NULL,
+	before JSONB,
+	after JSONB,
+	run_id TEXT,
+	changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_changes_changed_at ON changes(changed_at);
+CREATE INDEX IF NOT EXISTS idx_changes_source_id ON changes(source_id);
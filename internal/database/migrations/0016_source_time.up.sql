@@ -0,0 +1,13 @@
+-- Processed records keep the normalized timestamp of their source record, if the
+-- transformer is configured to read one
+ALTER TABLE processed_data ADD COLUMN source_time TIMESTAMPTZ;
+ALTER TABLE processed_data_staging ADD COLUMN source_time TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_processed_data_source_time ON processed_data(source_time);
+
+-- A view keeps the columns * stood for when it was created, so it is recreated
+CREATE OR REPLACE VIEW processed_data_current AS
+SELECT DISTINCT ON (COALESCE(raw_data_id, -id)) *
+FROM processed_data
+WHERE deleted_at IS NULL
+ORDER BY COALESCE(raw_data_id, -id), processed_at DESC, id DESC;
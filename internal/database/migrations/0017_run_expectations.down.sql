@@ -0,0 +1 @@
+ALTER TABLE pipeline_runs DROP COLUMN IF EXISTS expectations;
@@ -0,0 +1,3 @@
+-- Runs record the results of the data-quality expectation suite over their records,
+-- in the format of a Great Expectations validation result
+ALTER TABLE pipeline_runs ADD COLUMN expectations JSONB;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_raw_data_data;
@@ -0,0 +1,3 @@
+-- Index the raw payloads for the JSON path searches of GET /data/raw.
+-- jsonb_path_ops serves @> and @@, and is smaller than the default operator class.
+CREATE INDEX IF NOT EXISTS idx_raw_data_data ON raw_data USING GIN (data jsonb_path_ops);
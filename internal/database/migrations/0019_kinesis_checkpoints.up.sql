@@ -0,0 +1,9 @@
+-- The sequence number each shard of a Kinesis stream was loaded up to; shards
+-- read to their end after resharding keep their ending sequence number
+CREATE TABLE IF NOT EXISTS kinesis_checkpoints (
+	stream TEXT NOT NULL,
+	shard_id TEXT NOT NULL,
+	sequence_number TEXT NOT NULL,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (stream, shard_id)
+);
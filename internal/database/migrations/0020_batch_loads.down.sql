@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_processed_data_staging_run_id_batch;
+CREATE INDEX IF NOT EXISTS idx_processed_data_staging_run_id ON processed_data_staging(run_id);
+ALTER TABLE processed_data_staging DROP COLUMN IF EXISTS batch;
+
+-- A run is recorded once again, keeping its first batch
+DELETE FROM processed_loads l WHERE batch > (SELECT MIN(batch) FROM processed_loads WHERE run_id = l.run_id);
+ALTER TABLE processed_loads DROP CONSTRAINT processed_loads_pkey;
+ALTER TABLE processed_loads ADD PRIMARY KEY (run_id);
+ALTER TABLE processed_loads DROP COLUMN IF EXISTS batch;
@@ -0,0 +1,9 @@
+-- Runs loading several batches, e.g. streaming cycles and replays, claim each
+-- batch on its own; records loaded outside of a numbered batch use batch 0
+ALTER TABLE processed_loads ADD COLUMN batch INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE processed_loads DROP CONSTRAINT processed_loads_pkey;
+ALTER TABLE processed_loads ADD PRIMARY KEY (run_id, batch);
+
+ALTER TABLE processed_data_staging ADD COLUMN batch INTEGER NOT NULL DEFAULT 0;
+DROP INDEX IF EXISTS idx_processed_data_staging_run_id;
+CREATE INDEX IF NOT EXISTS idx_processed_data_staging_run_id_batch ON processed_data_staging(run_id, batch);
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// withConn runs fn on a connection of the pool as the pgx connection it is, for
+// COPY and batched statements, which database/sql has no API for. Everything else
+// goes through database/sql, so only these writes are tied to the driver.
+func (p *PostgresDB) withConn(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		native, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("database driver %T does not support native writes", driverConn)
+		}
+		return fn(native.Conn())
+	})
+}
+
+// inTx runs fn in a transaction on a pgx connection, committing it when fn succeeds
+func (p *PostgresDB) inTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	return p.withConn(ctx, func(conn *pgx.Conn) error {
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback(context.Background())
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return commitError(err)
+		}
+		return nil
+	})
+}
+
+// processedColumns are the columns of processedRows, shared by processed_data and
+// processed_data_staging
+var processedColumns = []string{"run_id", "user_id", "title", "body", "source", "source_hash", "raw_data_id", "transform_version", "source_id", "source_time"}
+
+// processedRows returns the processedColumns of records for COPY
+func processedRows(runID string, records []ProcessedRecord) [][]any {
+	rows := make([][]any, len(records))
+	for i, record := range records {
+		source, sourceHash, rawDataID, transformVersion := lineageColumns(record)
+		rows[i] = []any{nullIfEmpty(runID), record.UserID, record.Title, record.Body, source, sourceHash, rawDataID, transformVersion, sourceIDColumn(record), record.SourceTime}
+	}
+	return rows
+}
+
+// nullIfEmpty returns NULL for an empty string, as NULLIF did in the INSERT statements
+func nullIfEmpty(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
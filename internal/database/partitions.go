@@ -0,0 +1,233 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// Partition intervals
+const (
+	PartitionDaily   = "daily"
+	PartitionMonthly = "monthly"
+)
+
+// PartitionedTables maps each table partitioned by ingestion time to its partition key
+var PartitionedTables = map[string]string{
+	"raw_data":       "created_at",
+	"processed_data": "processed_at",
+}
+
+// partitionPeriod returns the start of the period containing t and the start of the next one
+func partitionPeriod(interval string, t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	if interval == PartitionMonthly {
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// partitionName returns the name of the partition of table starting at start,
+// e.g. raw_data_p20251001 for daily or raw_data_p202510 for monthly partitions
+func partitionName(table, interval string, start time.Time) string {
+	if interval == PartitionMonthly {
+		return table + "_p" + start.Format("200601")
+	}
+	return table + "_p" + start.Format("20060102")
+}
+
+// parsePartitionName returns the bounds of a partition named by partitionName
+func parsePartitionName(table, name string) (time.Time, time.Time, bool) {
+	suffix, ok := strings.CutPrefix(name, table+"_p")
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	switch len(suffix) {
+	case 8:
+		start, err := time.Parse("20060102", suffix)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		return start, start.AddDate(0, 0, 1), true
+	case 6:
+		start, err := time.Parse("200601", suffix)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		return start, start.AddDate(0, 1, 0), true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// EnsurePartitions creates the partitions of every partitioned table from the
+// period containing now through ahead periods later, returning the ones created
+func (p *PostgresDB) EnsurePartitions(ctx context.Context, interval string, ahead int, now time.Time) ([]string, error) {
+	var created []string
+	for table, column := range PartitionedTables {
+		start, _ := partitionPeriod(interval, now)
+		for i := 0; i <= ahead; i++ {
+			periodStart, periodEnd := partitionPeriod(interval, start)
+			name := partitionName(table, interval, periodStart)
+
+			ok, err := p.createPartition(ctx, table, column, name, periodStart, periodEnd)
+			if err != nil {
+				return created, fmt.Errorf("failed to create partition %s: %w", name, err)
+			}
+			if ok {
+				created = append(created, name)
+			}
+			start = periodEnd
+		}
+	}
+	return created, nil
+}
+
+// createPartition creates and attaches a partition unless it exists. Rows of the
+// range already in the default partition are moved into it first, since attaching
+// fails while the default partition holds rows of the new range.
+func (p *PostgresDB) createPartition(ctx context.Context, table, column, name string, start, end time.Time) (bool, error) {
+	var exists bool
+	if err := p.db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	from, to := start.Format("2006-01-02"), end.Format("2006-01-02")
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS)", name, table),
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s_default WHERE %s >= '%s' AND %s < '%s'", name, table, column, from, column, to),
+		fmt.Sprintf("DELETE FROM %s_default WHERE %s >= '%s' AND %s < '%s'", table, column, from, column, to),
+		fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')", table, name, from, to),
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// DropPartitionsBefore detaches and drops the dated partitions of table that only
+// hold rows older than cutoff. It returns the partitions dropped and their row count.
+func (p *PostgresDB) DropPartitionsBefore(ctx context.Context, table string, cutoff time.Time) ([]string, int64, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = to_regclass($1)
+		ORDER BY c.relname`, table)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list partitions of %s: %w", table, err)
+	}
+	var expired []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, 0, fmt.Errorf("failed to list partitions of %s: %w", table, err)
+		}
+		if _, end, ok := parsePartitionName(table, name); ok && !end.After(cutoff) {
+			expired = append(expired, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list partitions of %s: %w", table, err)
+	}
+
+	var dropped []string
+	var total int64
+	for _, name := range expired {
+		count, err := p.dropPartition(ctx, table, name)
+		if err != nil {
+			return dropped, total, fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+		dropped = append(dropped, name)
+		total += count
+	}
+	return dropped, total, nil
+}
+
+func (p *PostgresDB) dropPartition(ctx context.Context, table, name string) (int64, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var count int64
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", name)).Scan(&count); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", table, name)); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", name)); err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+// PartitionManager keeps partitions of the ingestion tables created ahead of time
+type PartitionManager struct {
+	db       *PostgresDB
+	interval string
+	ahead    int
+	logger   *logging.Logger
+	metrics  *metrics.Metrics
+}
+
+// NewPartitionManager creates a manager keeping ahead future partitions per table
+func NewPartitionManager(db *PostgresDB, interval string, ahead int, logger *logging.Logger, metrics *metrics.Metrics) (*PartitionManager, error) {
+	if interval != PartitionDaily && interval != PartitionMonthly {
+		return nil, fmt.Errorf("unknown partition interval %q, expected %s or %s", interval, PartitionDaily, PartitionMonthly)
+	}
+	if ahead < 0 {
+		return nil, fmt.Errorf("partitions ahead must not be negative")
+	}
+	return &PartitionManager{db: db, interval: interval, ahead: ahead, logger: logger, metrics: metrics}, nil
+}
+
+// Run creates any missing partitions
+func (m *PartitionManager) Run(ctx context.Context) error {
+	created, err := m.db.EnsurePartitions(ctx, m.interval, m.ahead, time.Now())
+	for _, name := range created {
+		table := name[:strings.LastIndex(name, "_p")]
+		m.metrics.PartitionsCreatedTotal.WithLabelValues(table).Inc()
+		m.logger.Info(fmt.Sprintf("Created partition %s", name))
+	}
+	return err
+}
+
+// Start checks the partitions every interval until ctx is cancelled
+func (m *PartitionManager) Start(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Run(ctx); err != nil {
+				m.logger.Error(fmt.Sprintf("Partition maintenance failed: %v", err))
+			}
+		}
+	}
+}
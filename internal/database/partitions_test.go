@@ -0,0 +1,40 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPartitionNaming(t *testing.T) {
+	now := time.Date(2025, 12, 31, 18, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		interval string
+		name     string
+		end      time.Time
+	}{
+		{PartitionDaily, "raw_data_p20251231", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{PartitionMonthly, "raw_data_p202512", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		start, end := partitionPeriod(tt.interval, now)
+		if name := partitionName("raw_data", tt.interval, start); name != tt.name {
+			t.Errorf("%s: expected name %s, got %s", tt.interval, tt.name, name)
+		}
+		if !end.Equal(tt.end) {
+			t.Errorf("%s: expected end %v, got %v", tt.interval, tt.end, end)
+		}
+
+		parsedStart, parsedEnd, ok := parsePartitionName("raw_data", tt.name)
+		if !ok || !parsedStart.Equal(start) || !parsedEnd.Equal(end) {
+			t.Errorf("%s: parsing %s gave %v-%v (%v)", tt.interval, tt.name, parsedStart, parsedEnd, ok)
+		}
+	}
+
+	for _, name := range []string{"raw_data_default", "processed_data_p20251231", "raw_data_p2025"} {
+		if _, _, ok := parsePartitionName("raw_data", name); ok {
+			t.Errorf("Expected %s not to be a dated raw_data partition", name)
+		}
+	}
+}
@@ -5,14 +5,28 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/backoff"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
 )
 
 // PostgresDB represents a PostgreSQL database connection
 type PostgresDB struct {
-	db *sql.DB
+	db        *sql.DB
+	connector *rotatingConnector
+	pool      PoolConfig
+	// replica serves the reads of the query API when a read replica is set
+	replica          *sql.DB
+	replicaConnector *rotatingConnector
+	replicaPool      PoolConfig
+	tracer           *statementTracer
+	retry            backoff.Policy
+	metrics          *metrics.Metrics
+	loadStrategy     string
 }
 
 // Record represents a raw data record stored in the database
@@ -22,116 +36,286 @@ type Record struct {
 	Timestamp time.Time
 }
 
+// PoolConfig holds the connection pool settings of a database connection
+type PoolConfig struct {
+	// MaxOpenConns is the most connections open at once, in use or idle
+	MaxOpenConns int
+	// MaxIdleConns is the most idle connections kept for reuse
+	MaxIdleConns int
+	// ConnMaxLifetime is how long a connection is reused; zero reuses it forever
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultPool is the pool of a connection until SetPool is called
+var DefaultPool = PoolConfig{MaxOpenConns: 25, MaxIdleConns: 5, ConnMaxLifetime: 5 * time.Minute}
+
 // NewPostgresDB creates a new PostgreSQL database connection
 func NewPostgresDB(connectionString string) (*PostgresDB, error) {
-	db, err := sql.Open("postgres", connectionString)
+	db, connector, err := openPool(connectionString, DefaultPool)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresDB{db: db, connector: connector, pool: DefaultPool, loadStrategy: LoadDirect}, nil
+}
+
+// openPool opens a connection pool and tests that the database answers
+func openPool(connectionString string, pool PoolConfig) (*sql.DB, *rotatingConnector, error) {
+	connector, err := newRotatingConnector(connectionString)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	db := sql.OpenDB(connector)
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	pool.apply(db)
+	return db, connector, nil
+}
 
-	pgDB := &PostgresDB{db: db}
+func (c PoolConfig) apply(db *sql.DB) {
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+}
 
-	// Initialize schema
-	if err := pgDB.initSchema(); err != nil {
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+// SetPool replaces the pool settings of the primary connection
+func (p *PostgresDB) SetPool(pool PoolConfig) {
+	p.pool = pool
+	pool.apply(p.db)
+}
+
+// SetReplica connects to a read replica with its own pool. The reads of the query
+// API, run history, audit trail and expectation results, go to it from then on;
+// everything the pipelines read, which must not lag behind their writes, stays on
+// the primary.
+func (p *PostgresDB) SetReplica(connectionString string, pool PoolConfig) error {
+	replica, connector, err := openPool(connectionString, pool)
+	if err != nil {
+		return fmt.Errorf("replica: %w", err)
+	}
+	if p.replica != nil {
+		p.replica.Close()
 	}
+	p.replica, p.replicaConnector, p.replicaPool = replica, connector, pool
+	if p.tracer != nil {
+		connector.tracer.Store(p.tracer)
+		closeIdle(replica, pool)
+	}
+	return nil
+}
 
-	return pgDB, nil
+// HasReplica reports whether a read replica is set
+func (p *PostgresDB) HasReplica() bool {
+	return p.replica != nil
 }
 
-// initSchema creates the necessary database tables
-func (p *PostgresDB) initSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS raw_data (
-		id SERIAL PRIMARY KEY,
-		data JSONB NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
+// reader returns the connection of the query API: the replica if one is set,
+// otherwise the primary
+func (p *PostgresDB) reader() *sql.DB {
+	if p.replica != nil {
+		return p.replica
+	}
+	return p.db
+}
 
-	CREATE TABLE IF NOT EXISTS processed_data (
-		id SERIAL PRIMARY KEY,
-		user_id INTEGER,
-		title TEXT,
-		body TEXT,
-		processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
+// InsertRawData inserts raw data written by a run into the database, returning the
+// raw_data id of each record
+func (p *PostgresDB) InsertRawData(ctx context.Context, runID string, data []map[string]interface{}) ([]int64, error) {
+	payloads, err := marshalRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	return p.InsertRawPayloads(ctx, runID, payloads)
+}
 
-	CREATE INDEX IF NOT EXISTS idx_raw_data_created_at ON raw_data(created_at);
-	CREATE INDEX IF NOT EXISTS idx_processed_data_processed_at ON processed_data(processed_at);
-	CREATE INDEX IF NOT EXISTS idx_processed_data_user_id ON processed_data(user_id);
-	`
+// InsertRawPayloads inserts raw records written by a run as the JSON they were
+// received as, without decoding and encoding them again, returning the raw_data id
+// of each record
+func (p *PostgresDB) InsertRawPayloads(ctx context.Context, runID string, payloads []json.RawMessage) ([]int64, error) {
+	var ids []int64
+	err := p.withRetry(ctx, func() (err error) {
+		ids, err = p.insertBatch(ctx, runID, payloads, nil, nil, nil)
+		return err
+	})
+	return ids, err
+}
 
-	_, err := p.db.Exec(schema)
-	return err
+// RawBlob references a batch of raw records kept in a content-addressed blob, one
+// record per line, instead of in the data column of raw_data
+type RawBlob struct {
+	// Name is the blob name, starting with the SHA-256 digest of its content
+	Name    string
+	Records int
+	// Hashes are the PayloadHash of each record, if known
+	Hashes []string
 }
 
-// InsertRawData inserts raw data into the database
-func (p *PostgresDB) InsertRawData(data []map[string]interface{}) error {
-	tx, err := p.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+// InsertRawBlob inserts a row per raw record of a blob written by a run, referencing
+// the blob and the record's line in it, and returns the raw_data id of each record
+func (p *PostgresDB) InsertRawBlob(ctx context.Context, runID string, blob RawBlob) ([]int64, error) {
+	var ids []int64
+	err := p.withRetry(ctx, func() (err error) {
+		ids, err = p.insertBatch(ctx, runID, nil, &blob, nil, nil)
+		return err
+	})
+	return ids, err
+}
+
+// InsertProcessedData inserts processed data written by a run into the database.
+// With the staged load strategy each batch of a run is loaded at most once.
+func (p *PostgresDB) InsertProcessedData(ctx context.Context, runID string, records []ProcessedRecord) error {
+	if p.loadStrategy == LoadStaged && runID != "" && len(records) > 0 {
+		return p.loadStaged(ctx, runID, records)
 	}
-	defer tx.Rollback()
+	return p.InsertBatch(ctx, runID, nil, records, nil)
+}
 
-	stmt, err := tx.Prepare("INSERT INTO raw_data (data) VALUES ($1)")
+// InsertBatch inserts raw records, their processed records and transformation
+// audits in a single transaction, so either all of them are stored or none. The
+// transaction is retried on transient errors according to the retry policy. Rows
+// are tagged with runID, which may be empty for rows written outside of a run.
+// With the staged load strategy a batch already loaded by the run is skipped,
+// batches being told apart by the number WithLoadBatch gives them.
+// Cancelling ctx rolls the transaction back and stops retrying. Processed records
+// with lineage are linked to the raw_data row of the raw record at their Line.
+func (p *PostgresDB) InsertBatch(ctx context.Context, runID string, raw []map[string]interface{}, processed []ProcessedRecord, audits []RecordAudit) error {
+	payloads, err := marshalRecords(raw)
 	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %w", err)
+		return err
 	}
-	defer stmt.Close()
+	return p.InsertBatchPayloads(ctx, runID, payloads, processed, audits)
+}
+
+// InsertBatchPayloads works like InsertBatch with raw records given as the JSON
+// they were received as
+func (p *PostgresDB) InsertBatchPayloads(ctx context.Context, runID string, raw []json.RawMessage, processed []ProcessedRecord, audits []RecordAudit) error {
+	return p.withRetry(ctx, func() error {
+		_, err := p.insertBatch(ctx, runID, raw, nil, processed, audits)
+		return err
+	})
+}
 
-	for _, record := range data {
-		jsonData, err := json.Marshal(record)
+// InsertBatchBlob works like InsertBatch with raw records kept in a blob
+func (p *PostgresDB) InsertBatchBlob(ctx context.Context, runID string, blob RawBlob, processed []ProcessedRecord, audits []RecordAudit) error {
+	return p.withRetry(ctx, func() error {
+		_, err := p.insertBatch(ctx, runID, nil, &blob, processed, audits)
+		return err
+	})
+}
+
+// marshalRecords encodes raw records as JSON
+func marshalRecords(raw []map[string]interface{}) ([]json.RawMessage, error) {
+	payloads := make([]json.RawMessage, len(raw))
+	for i, record := range raw {
+		data, err := json.Marshal(record)
 		if err != nil {
-			return fmt.Errorf("failed to marshal record: %w", err)
+			return nil, fmt.Errorf("failed to marshal record: %w", err)
+		}
+		payloads[i] = data
+	}
+	return payloads, nil
+}
+
+// insertBatch inserts a batch in one transaction, returning the raw_data ids of its
+// raw records. Raw records are inserted in one round trip and processed records
+// and audits are copied with COPY.
+func (p *PostgresDB) insertBatch(ctx context.Context, runID string, raw []json.RawMessage, blob *RawBlob, processed []ProcessedRecord, audits []RecordAudit) ([]int64, error) {
+	var ids []int64
+	err := p.inTx(ctx, func(tx pgx.Tx) (err error) {
+		ids = nil
+		if p.loadStrategy == LoadStaged && runID != "" && len(processed) > 0 {
+			claimed, err := claimLoad(ctx, tx, runID, LoadBatch(ctx), len(processed))
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				if p.metrics != nil {
+					p.metrics.DuplicateLoadsSkippedTotal.Inc()
+				}
+				return nil
+			}
 		}
 
-		if _, err := stmt.Exec(jsonData); err != nil {
-			return fmt.Errorf("failed to insert record: %w", err)
+		if len(raw) > 0 {
+			if ids, err = insertRawData(ctx, tx, runID, raw); err != nil {
+				return err
+			}
+		}
+		if blob != nil && blob.Records > 0 {
+			if ids, err = insertRawBlob(ctx, tx, runID, *blob); err != nil {
+				return err
+			}
 		}
+		if len(processed) > 0 {
+			if ids != nil {
+				resolveLineage(processed, ids)
+			}
+			if _, err := tx.CopyFrom(ctx, pgx.Identifier{"processed_data"}, processedColumns, pgx.CopyFromRows(processedRows(runID, processed))); err != nil {
+				return fmt.Errorf("failed to insert processed records: %w", err)
+			}
+		}
+		if len(audits) > 0 {
+			if err := insertTransformAudits(ctx, tx, runID, audits); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return ids, nil
+}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+// insertReturningIDs runs the INSERT ... RETURNING id statement once for each of
+// args in a single batch, returning the ids in order
+func insertReturningIDs(ctx context.Context, tx pgx.Tx, query string, args [][]any) ([]int64, error) {
+	batch := &pgx.Batch{}
+	for _, row := range args {
+		batch.Queue(query, row...)
 	}
+	results := tx.SendBatch(ctx, batch)
+	defer results.Close()
 
-	return nil
+	ids := make([]int64, len(args))
+	for i := range ids {
+		if err := results.QueryRow().Scan(&ids[i]); err != nil {
+			return nil, err
+		}
+	}
+	return ids, results.Close()
 }
 
-// InsertProcessedData inserts processed data into the database
-func (p *PostgresDB) InsertProcessedData(records []ProcessedRecord) error {
-	tx, err := p.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+func insertRawData(ctx context.Context, tx pgx.Tx, runID string, payloads []json.RawMessage) ([]int64, error) {
+	args := make([][]any, len(payloads))
+	for i, payload := range payloads {
+		args[i] = []any{[]byte(payload), PayloadHash(payload), nullIfEmpty(runID)}
 	}
-	defer tx.Rollback()
-
-	stmt, err := tx.Prepare("INSERT INTO processed_data (user_id, title, body) VALUES ($1, $2, $3)")
+	ids, err := insertReturningIDs(ctx, tx, "INSERT INTO raw_data (data, source_hash, run_id) VALUES ($1, $2, $3) RETURNING id", args)
 	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %w", err)
+		return nil, fmt.Errorf("failed to insert record: %w", err)
 	}
-	defer stmt.Close()
+	return ids, nil
+}
 
-	for _, record := range records {
-		if _, err := stmt.Exec(record.UserID, record.Title, record.Body); err != nil {
-			return fmt.Errorf("failed to insert processed record: %w", err)
+func insertRawBlob(ctx context.Context, tx pgx.Tx, runID string, blob RawBlob) ([]int64, error) {
+	args := make([][]any, blob.Records)
+	for line := range args {
+		var hash string
+		if line < len(blob.Hashes) {
+			hash = blob.Hashes[line]
 		}
+		args[line] = []any{blob.Name, line, nullIfEmpty(hash), nullIfEmpty(runID)}
 	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	ids, err := insertReturningIDs(ctx, tx, "INSERT INTO raw_data (blob, blob_line, source_hash, run_id) VALUES ($1, $2, $3, $4) RETURNING id", args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert record reference: %w", err)
 	}
-
-	return nil
+	return ids, nil
 }
 
 // ProcessedRecord represents a processed data record
@@ -139,16 +323,173 @@ type ProcessedRecord struct {
 	UserID int    `json:"user_id"`
 	Title  string `json:"title"`
 	Body   string `json:"body"`
+	// SourceTime is the normalized timestamp of the source record, if configured
+	SourceTime *time.Time `json:"source_time,omitempty"`
+	// Lineage traces the record to its source payload, if known
+	Lineage *Lineage `json:"lineage,omitempty"`
+}
+
+// LoadWatermarks returns the committed watermark of each shard of a source, keyed by shard start
+func (p *PostgresDB) LoadWatermarks(ctx context.Context, source string) (map[int64]int64, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT shard_start, watermark FROM extraction_watermarks WHERE source = $1", source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query watermarks: %w", err)
+	}
+	defer rows.Close()
+
+	watermarks := make(map[int64]int64)
+	for rows.Next() {
+		var shardStart, watermark int64
+		if err := rows.Scan(&shardStart, &watermark); err != nil {
+			return nil, fmt.Errorf("failed to scan watermark: %w", err)
+		}
+		watermarks[shardStart] = watermark
+	}
+	return watermarks, rows.Err()
+}
+
+// SaveWatermark upserts the watermark of one shard of a source
+func (p *PostgresDB) SaveWatermark(ctx context.Context, source string, shardStart, watermark int64) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO extraction_watermarks (source, shard_start, watermark, updated_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (source, shard_start)
+		DO UPDATE SET watermark = EXCLUDED.watermark, updated_at = EXCLUDED.updated_at`,
+		source, shardStart, watermark)
+	if err != nil {
+		return fmt.Errorf("failed to save watermark: %w", err)
+	}
+	return nil
+}
+
+// ExpiryFilter selects rows of a table for retention. Table, TimeColumn and
+// TenantExpr are trusted identifiers supplied by code, never user input.
+type ExpiryFilter struct {
+	Table      string
+	TimeColumn string
+	// TenantExpr is an SQL expression yielding the row's tenant, e.g. data->>'tenant'
+	TenantExpr string
+	Tenant     string
+	// ExceptTenants are tenants whose rows are kept, e.g. those under a legal hold;
+	// rows without a tenant still match
+	ExceptTenants []string
+}
+
+func (f ExpiryFilter) where(cutoff time.Time) (string, []interface{}) {
+	clause := fmt.Sprintf("%s < $1", f.TimeColumn)
+	args := []interface{}{cutoff}
+	if f.Tenant != "" {
+		args = append(args, f.Tenant)
+		clause += fmt.Sprintf(" AND %s = $%d", f.TenantExpr, len(args))
+	}
+	if len(f.ExceptTenants) > 0 {
+		placeholders := make([]string, len(f.ExceptTenants))
+		for i, tenant := range f.ExceptTenants {
+			args = append(args, tenant)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		clause += fmt.Sprintf(" AND (%[1]s IS NULL OR %[1]s NOT IN (%[2]s))", f.TenantExpr, strings.Join(placeholders, ", "))
+	}
+	return clause, args
+}
+
+// CountExpired counts the rows matched by the filter that are older than cutoff
+func (p *PostgresDB) CountExpired(ctx context.Context, filter ExpiryFilter, cutoff time.Time) (int64, error) {
+	where, args := filter.where(cutoff)
+	var count int64
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", filter.Table, where)
+	if err := p.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count expired rows in %s: %w", filter.Table, err)
+	}
+	return count, nil
+}
+
+// expiryBatchSize bounds the rows deleted per transaction by DeleteExpired
+const expiryBatchSize = 5000
+
+// DeleteExpired deletes the rows matched by the filter that are older than cutoff,
+// in batches. When archive is set it receives each batch as JSON rows before the
+// batch is committed, so rows are only deleted once archived.
+func (p *PostgresDB) DeleteExpired(ctx context.Context, filter ExpiryFilter, cutoff time.Time, archive func(rows []json.RawMessage) error) (int64, error) {
+	where, args := filter.where(cutoff)
+	// ctid is only unique within a partition, so rows are identified with tableoid too
+	query := fmt.Sprintf(
+		"DELETE FROM %[1]s WHERE (tableoid, ctid) IN (SELECT tableoid, ctid FROM %[1]s WHERE %[2]s LIMIT %[3]d) RETURNING to_jsonb(%[1]s.*)",
+		filter.Table, where, expiryBatchSize)
+
+	var total int64
+	for {
+		deleted, err := p.deleteExpiredBatch(ctx, query, args, archive)
+		total += deleted
+		if err != nil {
+			return total, fmt.Errorf("failed to delete expired rows from %s: %w", filter.Table, err)
+		}
+		if deleted < expiryBatchSize {
+			return total, nil
+		}
+	}
+}
+
+func (p *PostgresDB) deleteExpiredBatch(ctx context.Context, query string, args []interface{}, archive func(rows []json.RawMessage) error) (int64, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	var deleted []json.RawMessage
+	for rows.Next() {
+		var row []byte
+		if err := rows.Scan(&row); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		deleted = append(deleted, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if archive != nil && len(deleted) > 0 {
+		if err := archive(deleted); err != nil {
+			return 0, fmt.Errorf("failed to archive rows: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int64(len(deleted)), nil
 }
 
 // HealthCheck checks if the database connection is healthy
 func (p *PostgresDB) HealthCheck() error {
+	return ping(p.db)
+}
+
+// ReplicaHealthCheck checks if the connection to the read replica is healthy. It
+// returns nil when no replica is set.
+func (p *PostgresDB) ReplicaHealthCheck() error {
+	if p.replica == nil {
+		return nil
+	}
+	return ping(p.replica)
+}
+
+func ping(db *sql.DB) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	return p.db.PingContext(ctx)
+	return db.PingContext(ctx)
 }
 
-// Close closes the database connection
+// Close closes the database connections
 func (p *PostgresDB) Close() error {
+	if p.replica != nil {
+		p.replica.Close()
+	}
 	return p.db.Close()
 }
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiryFilterWhere(t *testing.T) {
+	cutoff := time.Now()
+	filter := ExpiryFilter{Table: "raw_data", TimeColumn: "created_at", TenantExpr: "data->>'tenant'", ExceptTenants: []string{"acme", "initech"}}
+
+	where, args := filter.where(cutoff)
+	want := "created_at < $1 AND (data->>'tenant' IS NULL OR data->>'tenant' NOT IN ($2, $3))"
+	if where != want || len(args) != 3 || args[1] != "acme" || args[2] != "initech" {
+		t.Errorf("Expected %q with the kept tenants as arguments, got %q %v", want, where, args)
+	}
+
+	filter.Tenant, filter.ExceptTenants = "globex", nil
+	if where, args := filter.where(cutoff); where != "created_at < $1 AND data->>'tenant' = $2" || args[1] != "globex" {
+		t.Errorf("Expected a filter on the tenant, got %q %v", where, args)
+	}
+}
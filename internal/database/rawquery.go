@@ -0,0 +1,273 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRawQueryLength bounds the length of a raw data query
+const maxRawQueryLength = 1000
+
+// rawQueryNumber matches a JSON number
+var rawQueryNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// rawQueryOperators maps the comparison operators of raw data queries to those of
+// JSON path
+var rawQueryOperators = map[string]string{"=": "==", "!=": "!=", "<>": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">="}
+
+// ParseRawQuery translates a raw data query into a JSON path predicate matching the
+// data of raw_data rows, which the GIN index on raw_data.data serves. A query is a
+// comparison of a path into data with a JSON value, e.g. data->>'userId' = 1 or
+// data->'tags'->0 = 'urgent', and comparisons can be combined with AND, OR and
+// parentheses. Values are compared as JSON, so 1 and '1' differ, and a path
+// reaching an array matches any of its elements.
+func ParseRawQuery(query string) (string, error) {
+	if len(query) > maxRawQueryLength {
+		return "", fmt.Errorf("query is longer than %d characters", maxRawQueryLength)
+	}
+	tokens, err := rawQueryTokens(query)
+	if err != nil {
+		return "", err
+	}
+	p := &rawQueryParser{tokens: tokens}
+	path, err := p.or()
+	if err != nil {
+		return "", err
+	}
+	if token := p.peek(); token != "" {
+		return "", fmt.Errorf("unexpected %s", token)
+	}
+	return path, nil
+}
+
+// rawQueryTokens splits a raw data query into words, numbers, quoted strings with
+// their quotes, arrows, operators and parentheses
+func rawQueryTokens(query string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'':
+			end := i + 1
+			for {
+				next := strings.IndexByte(query[end:], '\'')
+				if next < 0 {
+					return nil, fmt.Errorf("unterminated string at %d", i)
+				}
+				end += next + 1
+				// '' is a quote inside the string, as in SQL
+				if end < len(query) && query[end] == '\'' {
+					end++
+					continue
+				}
+				break
+			}
+			tokens = append(tokens, query[i:end])
+			i = end
+		case strings.HasPrefix(query[i:], "->>"):
+			tokens = append(tokens, "->>")
+			i += 3
+		case strings.HasPrefix(query[i:], "->"), strings.HasPrefix(query[i:], "<="), strings.HasPrefix(query[i:], ">="),
+			strings.HasPrefix(query[i:], "!="), strings.HasPrefix(query[i:], "<>"):
+			tokens = append(tokens, query[i:i+2])
+			i += 2
+		case strings.IndexByte("=<>()", c) >= 0:
+			tokens = append(tokens, query[i:i+1])
+			i++
+		case c == '-' || c == '.' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			end := i + 1
+			for end < len(query) {
+				c := query[end]
+				if c == '+' || c == '-' {
+					// Only the sign of an exponent continues a number
+					if e := query[end-1]; e != 'e' && e != 'E' || !rawQueryNumber.MatchString(query[i:end-1]) {
+						break
+					}
+				} else if !(c == '.' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+					break
+				}
+				end++
+			}
+			tokens = append(tokens, query[i:end])
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+// rawQueryParser parses the tokens of a raw data query by recursive descent
+type rawQueryParser struct {
+	tokens []string
+	next   int
+}
+
+func (p *rawQueryParser) peek() string {
+	if p.next < len(p.tokens) {
+		return p.tokens[p.next]
+	}
+	return ""
+}
+
+func (p *rawQueryParser) take() string {
+	token := p.peek()
+	if token != "" {
+		p.next++
+	}
+	return token
+}
+
+// or parses comparisons combined with OR, which binds looser than AND
+func (p *rawQueryParser) or() (string, error) {
+	path, err := p.and()
+	for err == nil && strings.EqualFold(p.peek(), "OR") {
+		p.take()
+		var right string
+		if right, err = p.and(); err == nil {
+			path = "(" + path + " || " + right + ")"
+		}
+	}
+	return path, err
+}
+
+func (p *rawQueryParser) and() (string, error) {
+	path, err := p.term()
+	for err == nil && strings.EqualFold(p.peek(), "AND") {
+		p.take()
+		var right string
+		if right, err = p.term(); err == nil {
+			path = "(" + path + " && " + right + ")"
+		}
+	}
+	return path, err
+}
+
+// term parses a comparison or a parenthesized query
+func (p *rawQueryParser) term() (string, error) {
+	if p.peek() == "(" {
+		p.take()
+		path, err := p.or()
+		if err != nil {
+			return "", err
+		}
+		if token := p.take(); token != ")" {
+			return "", fmt.Errorf("expected ) instead of %s", describeToken(token))
+		}
+		return path, nil
+	}
+
+	if token := p.take(); token != "data" {
+		return "", fmt.Errorf("expected a path starting with data instead of %s", describeToken(token))
+	}
+	path := "$"
+	for p.peek() == "->" || p.peek() == "->>" {
+		p.take()
+		step := p.take()
+		if key, ok := unquoteRawQuery(step); ok {
+			path += "." + jsonPathString(key)
+		} else if index, err := strconv.Atoi(step); err == nil && index >= 0 {
+			path += "[" + strconv.Itoa(index) + "]"
+		} else {
+			return "", fmt.Errorf("expected a quoted key or an array index instead of %s", describeToken(step))
+		}
+	}
+	if path == "$" {
+		return "", fmt.Errorf("expected -> or ->> after data")
+	}
+
+	token := p.take()
+	operator, ok := rawQueryOperators[token]
+	if !ok {
+		return "", fmt.Errorf("expected a comparison operator instead of %s", describeToken(token))
+	}
+	value, err := rawQueryValue(p.take())
+	if err != nil {
+		return "", err
+	}
+	return path + " " + operator + " " + value, nil
+}
+
+// rawQueryValue translates a value of a raw data query into a JSON path literal
+func rawQueryValue(token string) (string, error) {
+	if s, ok := unquoteRawQuery(token); ok {
+		return jsonPathString(s), nil
+	}
+	switch {
+	case token == "true", token == "false", token == "null", rawQueryNumber.MatchString(token):
+		return token, nil
+	}
+	return "", fmt.Errorf("expected a quoted string, number, true, false or null instead of %s", describeToken(token))
+}
+
+// unquoteRawQuery returns the content of a single-quoted token
+func unquoteRawQuery(token string) (string, bool) {
+	if len(token) < 2 || token[0] != '\'' || token[len(token)-1] != '\'' {
+		return "", false
+	}
+	return strings.ReplaceAll(token[1:len(token)-1], "''", "'"), true
+}
+
+// jsonPathString quotes s as a JSON path string, whose escapes are those of JSON
+func jsonPathString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func describeToken(token string) string {
+	if token == "" {
+		return "the end of the query"
+	}
+	return token
+}
+
+// RawDataMatch is a raw_data row found by SearchRawData
+type RawDataMatch struct {
+	ID        int64           `json:"id"`
+	Data      json.RawMessage `json:"data"`
+	RunID     string          `json:"run_id,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// SearchRawData returns up to limit raw records whose data matches the JSON path
+// predicate path, as returned by ParseRawQuery, and filter, with an ID below
+// beforeID unless it is zero, newest first. Records kept in blobs have no data
+// column and never match.
+func (p *PostgresDB) SearchRawData(ctx context.Context, path string, filter RawDataFilter, beforeID int64, limit int) ([]RawDataMatch, error) {
+	rows, err := p.reader().QueryContext(ctx, `
+		SELECT id, data, COALESCE(run_id, ''), created_at FROM raw_data
+		WHERE `+rawDataWhere+` AND data @@ $8::jsonpath AND ($9 = 0 OR id < $9)
+		ORDER BY id DESC
+		LIMIT $10`,
+		append(filter.args(), path, beforeID, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search raw data: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []RawDataMatch
+	for rows.Next() {
+		var match RawDataMatch
+		var data []byte
+		if err := rows.Scan(&match.ID, &data, &match.RunID, &match.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan raw data: %w", err)
+		}
+		match.Data = data
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search raw data: %w", err)
+	}
+	return matches, nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import "testing"
+
+func TestParseRawQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		path  string
+	}{
+		{"data->>'userId'=1", `$."userId" == 1`},
+		{"data->'user'->>'name' = 'O''Brien'", `$."user"."name" == "O'Brien"`},
+		{"data->'tags'->0 <> 'urgent'", `$."tags"[0] != "urgent"`},
+		{"data->>'score' >= -1.5e+2", `$."score" >= -1.5e+2`},
+		{`data->>'say "hi"' = true`, `$."say \"hi\"" == true`},
+		{"data->>'a' = 1 and data->>'b' = null or data->>'c' < 3", `(($."a" == 1 && $."b" == null) || $."c" < 3)`},
+		{"data->>'a' = 1 AND (data->>'b' = 2 OR data->>'c' = 3)", `($."a" == 1 && ($."b" == 2 || $."c" == 3))`},
+	}
+	for _, tt := range tests {
+		path, err := ParseRawQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseRawQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if path != tt.path {
+			t.Errorf("ParseRawQuery(%q) = %s, want %s", tt.query, path, tt.path)
+		}
+	}
+
+	for _, query := range []string{
+		"",
+		"id = 1",
+		"data = 1",
+		"data->>'a'",
+		"data->>'a' = ",
+		"data->>'a' = abc",
+		"data->>'a' = '1",
+		"data->>'a' = 01",
+		"data->-1 = 1",
+		"data->>'a' = 1; DROP TABLE raw_data",
+		"data->>'a' = 1 AND",
+		"(data->>'a' = 1",
+		"data->>'a' = 1)",
+		"data->>'a' LIKE '%x'",
+	} {
+		if path, err := ParseRawQuery(query); err == nil {
+			t.Errorf("ParseRawQuery(%q) = %s, expected an error", query, path)
+		}
+	}
+}
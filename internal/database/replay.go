@@ -0,0 +1,166 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RawDataFilter selects stored raw records to replay. Zero fields do not filter.
+type RawDataFilter struct {
+	// FromID and ToID bound the row IDs, inclusive
+	FromID int64
+	ToID   int64
+	// From and To bound the ingestion time, To exclusive
+	From time.Time
+	To   time.Time
+	// RunID selects the records stored by one run
+	RunID string
+	// StaleFor selects the records with processed rows of other transform versions
+	// only, which a reprocess transforms again with version StaleFor
+	StaleFor string
+	// FromVersion narrows StaleFor to records with processed rows of that version
+	FromVersion string
+}
+
+// rawDataWhere is the condition on raw_data rows selected by a filter, with the
+// filter's args as $1 to $7
+const rawDataWhere = `($1 = 0 OR id >= $1)
+	AND ($2 = 0 OR id <= $2)
+	AND ($3::timestamp IS NULL OR created_at >= $3)
+	AND ($4::timestamp IS NULL OR created_at < $4)
+	AND ($5 = '' OR run_id = $5)
+	AND ($6 = '' OR (
+		NOT EXISTS (SELECT 1 FROM processed_data p WHERE p.raw_data_id = raw_data.id AND p.transform_version = $6)
+		AND EXISTS (SELECT 1 FROM processed_data p WHERE p.raw_data_id = raw_data.id AND ($7 = '' OR p.transform_version = $7))))`
+
+// args returns the values of the filter's placeholders in rawDataWhere
+func (f RawDataFilter) args() []interface{} {
+	from := sql.NullTime{Time: f.From, Valid: !f.From.IsZero()}
+	to := sql.NullTime{Time: f.To, Valid: !f.To.IsZero()}
+	return []interface{}{f.FromID, f.ToID, from, to, f.RunID, f.StaleFor, f.FromVersion}
+}
+
+// CountRawData counts the raw records matching filter
+func (p *PostgresDB) CountRawData(ctx context.Context, filter RawDataFilter) (int64, error) {
+	var count int64
+	if err := p.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM raw_data WHERE "+rawDataWhere, filter.args()...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count raw data: %w", err)
+	}
+	return count, nil
+}
+
+// BlobReader reads the content-addressed blobs raw_data rows reference
+type BlobReader interface {
+	LoadBlob(name string) ([]byte, error)
+}
+
+// RawRecord is a raw record read back from raw_data
+type RawRecord struct {
+	ID   int64
+	Data map[string]interface{}
+	// SourceHash is the PayloadHash of the record, empty for rows stored without one
+	SourceHash string
+}
+
+// RawData returns up to limit raw records matching filter with an ID above
+// afterID, ordered by ID, and the ID of the last one, for paging through them.
+// Records kept in blobs are read from them with blobs, exactly as stored.
+func (p *PostgresDB) RawData(ctx context.Context, filter RawDataFilter, afterID int64, limit int, blobs BlobReader) ([]RawRecord, int64, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT id, data, blob, blob_line, source_hash FROM raw_data
+		WHERE `+rawDataWhere+` AND id > $8
+		ORDER BY id
+		LIMIT $9`,
+		append(filter.args(), afterID, limit)...)
+	if err != nil {
+		return nil, afterID, fmt.Errorf("failed to query raw data: %w", err)
+	}
+	defer rows.Close()
+
+	var records []RawRecord
+	lastID := afterID
+	// Consecutive rows mostly reference the same blob
+	var blobName string
+	var blobLines [][]byte
+	for rows.Next() {
+		var data []byte
+		var blob sql.NullString
+		var line sql.NullInt64
+		var hash sql.NullString
+		if err := rows.Scan(&lastID, &data, &blob, &line, &hash); err != nil {
+			return nil, afterID, fmt.Errorf("failed to scan raw data: %w", err)
+		}
+		if data == nil && blob.Valid {
+			if blob.String != blobName {
+				if blobLines, err = readBlobLines(blobs, blob.String); err != nil {
+					return nil, afterID, fmt.Errorf("failed to read raw record %d: %w", lastID, err)
+				}
+				blobName = blob.String
+			}
+			if line.Int64 < 0 || line.Int64 >= int64(len(blobLines)) {
+				return nil, afterID, fmt.Errorf("raw record %d references line %d of blob %s holding %d records", lastID, line.Int64, blob.String, len(blobLines))
+			}
+			data = blobLines[line.Int64]
+			if !hash.Valid {
+				// Blob lines are the payloads as hashed
+				hash = sql.NullString{String: PayloadHash(data), Valid: true}
+			}
+		}
+		record := RawRecord{ID: lastID, SourceHash: hash.String}
+		if err := json.Unmarshal(data, &record.Data); err != nil {
+			return nil, afterID, fmt.Errorf("failed to decode raw record %d: %w", lastID, err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, afterID, fmt.Errorf("failed to query raw data: %w", err)
+	}
+	return records, lastID, nil
+}
+
+// readBlobLines reads a blob and splits it into its records, one per line
+func readBlobLines(blobs BlobReader, name string) ([][]byte, error) {
+	if blobs == nil {
+		return nil, fmt.Errorf("record kept in blob %s, but no blob store is configured", name)
+	}
+	content, err := blobs.LoadBlob(name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Split(bytes.TrimSuffix(content, []byte("\n")), []byte("\n")), nil
+}
+
+// String describes the filter in log messages, e.g. "ids 100-200, run 3f2a9c0e"
+func (f RawDataFilter) String() string {
+	var parts []string
+	if f.FromID != 0 || f.ToID != 0 {
+		to := "end"
+		if f.ToID != 0 {
+			to = strconv.FormatInt(f.ToID, 10)
+		}
+		parts = append(parts, fmt.Sprintf("ids %d-%s", f.FromID, to))
+	}
+	if !f.From.IsZero() {
+		parts = append(parts, "from "+f.From.Format(time.RFC3339))
+	}
+	if !f.To.IsZero() {
+		parts = append(parts, "until "+f.To.Format(time.RFC3339))
+	}
+	if f.RunID != "" {
+		parts = append(parts, "run "+f.RunID)
+	}
+	if f.StaleFor != "" {
+		stale := "transformed before version " + f.StaleFor
+		if f.FromVersion != "" {
+			stale = fmt.Sprintf("transformed with version %s instead of %s", f.FromVersion, f.StaleFor)
+		}
+		parts = append(parts, stale)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mohammedhassan/etl-pipeline/internal/backoff"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// errCommit marks a failed commit, whose outcome is unknown unless the server
+// reported that it rolled the transaction back
+var errCommit = errors.New("failed to commit transaction")
+
+// SetRetryPolicy makes write transactions retry transient errors such as
+// deadlocks, serialization failures and lost connections
+func (p *PostgresDB) SetRetryPolicy(policy backoff.Policy, metrics *metrics.Metrics) {
+	p.retry = policy
+	p.metrics = metrics
+}
+
+// withRetry runs a transaction, retrying it while it fails with a retryable error
+// and ctx is not done
+func (p *PostgresDB) withRetry(ctx context.Context, txn func() error) error {
+	attempts := p.retry.MaxAttempts()
+	for attempt := 1; ; attempt++ {
+		err := txn()
+		if err == nil || attempt == attempts {
+			return err
+		}
+		reason, ok := retryReason(err)
+		if !ok {
+			return err
+		}
+
+		if p.metrics != nil {
+			p.metrics.DatabaseRetriesTotal.WithLabelValues(reason).Inc()
+		}
+		if p.retry.Wait(ctx, attempt) != nil {
+			return err
+		}
+	}
+}
+
+// retryReason reports whether err is transient and labels it with its SQLSTATE,
+// or "connection" for lost connections. A failed commit is only retried when the
+// server reported a rollback, since the transaction may have been committed otherwise.
+func retryReason(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", "40P01": // serialization_failure, deadlock_detected
+			return pgErr.Code, true
+		case "57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+			return pgErr.Code, !errors.Is(err, errCommit)
+		}
+		// Class 08 is connection exceptions
+		if errorClass(pgErr) == "08" {
+			return pgErr.Code, !errors.Is(err, errCommit)
+		}
+		return "", false
+	}
+
+	if errors.Is(err, errCommit) {
+		return "", false
+	}
+	if connectionError(err) {
+		return "connection", true
+	}
+	return "", false
+}
+
+// errorClass returns the class of the SQLSTATE of err, its first two characters
+func errorClass(err *pgconn.PgError) string {
+	if len(err.Code) < 2 {
+		return ""
+	}
+	return err.Code[:2]
+}
+
+// connectionError reports whether err is a lost or refused connection, or one the
+// driver found closed before sending anything
+func connectionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.As(err, &netErr) ||
+		pgconn.SafeToRetry(err)
+}
+
+// Reasons a database write fails, the reason label of etl_database_write_errors_total
+const (
+	ReasonConnection = "connection"
+	ReasonTimeout    = "timeout"
+	ReasonCancelled  = "cancelled"
+	// ReasonConflict is a serialization failure or deadlock
+	ReasonConflict = "conflict"
+	// ReasonConstraint is an integrity constraint violation, SQLSTATE class 23
+	ReasonConstraint = "constraint"
+	// ReasonData is a value the column does not accept, SQLSTATE class 22
+	ReasonData  = "data"
+	ReasonOther = "other"
+)
+
+// ErrorReason classifies an error of a database write
+func ErrorReason(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "40001" || pgErr.Code == "40P01":
+			return ReasonConflict
+		case pgErr.Code == "57014": // query_canceled, e.g. by statement_timeout
+			return ReasonTimeout
+		case errorClass(pgErr) == "08" || errorClass(pgErr) == "57":
+			return ReasonConnection
+		case errorClass(pgErr) == "23":
+			return ReasonConstraint
+		case errorClass(pgErr) == "22":
+			return ReasonData
+		}
+		return ReasonOther
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ReasonTimeout
+	case errors.Is(err, context.Canceled):
+		return ReasonCancelled
+	}
+	if connectionError(err) {
+		return ReasonConnection
+	}
+	return ReasonOther
+}
+
+// commitError wraps a commit failure so it is not retried blindly
+func commitError(err error) error {
+	return fmt.Errorf("%w: %w", errCommit, err)
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mohammedhassan/etl-pipeline/internal/backoff"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestRetryReason(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		reason    string
+		retryable bool
+	}{
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, "40P01", true},
+		{"serialization failure", fmt.Errorf("failed to insert record: %w", &pgconn.PgError{Code: "40001"}), "40001", true},
+		{"serialization failure on commit", commitError(&pgconn.PgError{Code: "40001"}), "40001", true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, "08006", true},
+		{"connection failure on commit", commitError(&pgconn.PgError{Code: "08006"}), "08006", false},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, "57P01", true},
+		{"bad connection", driver.ErrBadConn, "connection", true},
+		{"bad connection on commit", commitError(driver.ErrBadConn), "", false},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, "", false},
+		{"other error", errors.New("boom"), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, retryable := retryReason(tt.err)
+			if reason != tt.reason || retryable != tt.retryable {
+				t.Errorf("retryReason() = %q, %v; want %q, %v", reason, retryable, tt.reason, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestErrorReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		reason string
+	}{
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, ReasonConflict},
+		{"statement timeout", fmt.Errorf("failed to insert record: %w", &pgconn.PgError{Code: "57014"}), ReasonTimeout},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, ReasonConnection},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, ReasonConnection},
+		{"bad connection on commit", commitError(driver.ErrBadConn), ReasonConnection},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, ReasonConstraint},
+		{"invalid text", &pgconn.PgError{Code: "22021"}, ReasonData},
+		{"undefined table", &pgconn.PgError{Code: "42P01"}, ReasonOther},
+		{"context deadline", fmt.Errorf("failed to begin transaction: %w", context.DeadlineExceeded), ReasonTimeout},
+		{"context cancelled", context.Canceled, ReasonCancelled},
+		{"other error", errors.New("boom"), ReasonOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := ErrorReason(tt.err); reason != tt.reason {
+				t.Errorf("ErrorReason() = %q; want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	p := &PostgresDB{}
+	p.SetRetryPolicy(backoff.Policy{Attempts: 3, Backoff: time.Millisecond}, metrics.NewMetrics())
+
+	calls := 0
+	err := p.withRetry(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return &pgconn.PgError{Code: "40P01"}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Expected success after 3 attempts, got %v after %d", err, calls)
+	}
+
+	calls = 0
+	err = p.withRetry(context.Background(), func() error {
+		calls++
+		return &pgconn.PgError{Code: "23505"}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected non-retryable error after 1 attempt, got %v after %d", err, calls)
+	}
+
+	calls = 0
+	err = p.withRetry(context.Background(), func() error {
+		calls++
+		return &pgconn.PgError{Code: "40001"}
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("Expected error after 3 attempts, got %v after %d", err, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	err = p.withRetry(ctx, func() error {
+		calls++
+		return &pgconn.PgError{Code: "40001"}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected no retry once the context is done, got %v after %d", err, calls)
+	}
+}
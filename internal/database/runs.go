@@ -0,0 +1,238 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Pipeline run statuses
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	// RunPartial runs loaded their batch but some stages or sinks failed
+	RunPartial = "partial"
+	RunFailed  = "failed"
+)
+
+// PipelineRun is one pass of the pipeline over a batch, recorded in pipeline_runs.
+// Raw, processed and audit rows written by the run carry its RunID.
+type PipelineRun struct {
+	RunID string `json:"run_id"`
+	// Pipeline is the name of the pipeline that made the run
+	Pipeline string `json:"pipeline"`
+	// Trigger is what started the run, e.g. schedule or ingest
+	Trigger            string     `json:"trigger"`
+	Status             string     `json:"status"`
+	StartedAt          time.Time  `json:"started_at"`
+	FinishedAt         *time.Time `json:"finished_at,omitempty"`
+	RecordsExtracted   int        `json:"records_extracted"`
+	RecordsTransformed int        `json:"records_transformed"`
+	RecordsRejected    int        `json:"records_rejected"`
+	RecordsLoaded      int        `json:"records_loaded"`
+	ErrorCount         int        `json:"error_count"`
+	Error              string     `json:"error,omitempty"`
+	// BackfillID, RangeFrom and RangeTo are set on the runs of a backfill, each
+	// extracting the records of [RangeFrom, RangeTo)
+	BackfillID string     `json:"backfill_id,omitempty"`
+	RangeFrom  *time.Time `json:"range_from,omitempty"`
+	RangeTo    *time.Time `json:"range_to,omitempty"`
+	// Expectations holds the data-quality validation result of the run's records,
+	// if it transformed any, served on its own by RunExpectations
+	Expectations json.RawMessage `json:"-"`
+}
+
+// StartRun records the start of a run, or its restart when it is resumed
+func (p *PostgresDB) StartRun(run PipelineRun) error {
+	_, err := p.db.Exec(`
+		INSERT INTO pipeline_runs (run_id, pipeline, trigger, status, started_at, backfill_id, range_from, range_to)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8)
+		ON CONFLICT (run_id) DO UPDATE SET status = EXCLUDED.status, finished_at = NULL, error = NULL`,
+		run.RunID, run.Pipeline, run.Trigger, run.Status, run.StartedAt, run.BackfillID, run.RangeFrom, run.RangeTo)
+	if err != nil {
+		return fmt.Errorf("failed to record run start: %w", err)
+	}
+	return nil
+}
+
+// FinishRun records the outcome of a run. Runs whose start was not recorded,
+// e.g. during a database outage, are inserted.
+func (p *PostgresDB) FinishRun(run PipelineRun) error {
+	_, err := p.db.Exec(`
+		INSERT INTO pipeline_runs (run_id, pipeline, trigger, status, started_at, finished_at, records_extracted,
+			records_transformed, records_rejected, records_loaded, error_count, error, backfill_id, range_from, range_to, expectations)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), NULLIF($13, ''), $14, $15, $16)
+		ON CONFLICT (run_id) DO UPDATE SET
+			status = EXCLUDED.status,
+			finished_at = EXCLUDED.finished_at,
+			records_extracted = EXCLUDED.records_extracted,
+			records_transformed = EXCLUDED.records_transformed,
+			records_rejected = EXCLUDED.records_rejected,
+			records_loaded = EXCLUDED.records_loaded,
+			error_count = EXCLUDED.error_count,
+			error = EXCLUDED.error,
+			expectations = EXCLUDED.expectations`,
+		run.RunID, run.Pipeline, run.Trigger, run.Status, run.StartedAt, run.FinishedAt, run.RecordsExtracted,
+		run.RecordsTransformed, run.RecordsRejected, run.RecordsLoaded, run.ErrorCount, run.Error,
+		run.BackfillID, run.RangeFrom, run.RangeTo, []byte(run.Expectations))
+	if err != nil {
+		return fmt.Errorf("failed to record run outcome: %w", err)
+	}
+	return nil
+}
+
+// RunExpectations returns the data-quality validation result of a run. found is
+// false when there is no such run; a run that transformed no records has no result.
+func (p *PostgresDB) RunExpectations(ctx context.Context, runID string) (result json.RawMessage, found bool, err error) {
+	err = p.reader().QueryRowContext(ctx, "SELECT expectations FROM pipeline_runs WHERE run_id = $1", runID).Scan(&result)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query expectations of run %s: %w", runID, err)
+	}
+	return result, true, nil
+}
+
+// runColumns are the pipeline_runs columns scanned by scanRuns
+const runColumns = `run_id, pipeline, trigger, status, started_at, finished_at, records_extracted, records_transformed,
+	records_rejected, records_loaded, error_count, COALESCE(error, ''), COALESCE(backfill_id, ''), range_from, range_to`
+
+// PipelineRuns returns the most recent runs, newest first. With runID set only that run is returned.
+func (p *PostgresDB) PipelineRuns(ctx context.Context, runID string, limit int) ([]PipelineRun, error) {
+	rows, err := p.reader().QueryContext(ctx, `
+		SELECT `+runColumns+`
+		FROM pipeline_runs
+		WHERE $1 = '' OR run_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2`, runID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pipeline runs: %w", err)
+	}
+	return scanRuns(rows)
+}
+
+// PipelineRunsOf returns the most recent runs of a pipeline, newest first. With
+// status set only the runs of that status are returned.
+func (p *PostgresDB) PipelineRunsOf(ctx context.Context, pipeline, status string, limit int) ([]PipelineRun, error) {
+	rows, err := p.reader().QueryContext(ctx, `
+		SELECT `+runColumns+`
+		FROM pipeline_runs
+		WHERE pipeline = $1 AND ($2 = '' OR status = $2)
+		ORDER BY started_at DESC
+		LIMIT $3`, pipeline, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query runs of pipeline %s: %w", pipeline, err)
+	}
+	return scanRuns(rows)
+}
+
+// RunSummary sums up the recent runs of a pipeline
+type RunSummary struct {
+	// Runs counts the runs started since the time asked for, by status
+	Runs map[string]int `json:"runs"`
+	// LastRun is the most recent run and LastFailure the most recent failed one,
+	// of all time
+	LastRun     *PipelineRun `json:"last_run,omitempty"`
+	LastFailure *PipelineRun `json:"last_failure,omitempty"`
+}
+
+// RunSummaries sums up the runs of each pipeline, counting the runs started since
+// the given time
+func (p *PostgresDB) RunSummaries(ctx context.Context, since time.Time) (map[string]*RunSummary, error) {
+	summaries := make(map[string]*RunSummary)
+	summary := func(pipeline string) *RunSummary {
+		if summaries[pipeline] == nil {
+			summaries[pipeline] = &RunSummary{Runs: make(map[string]int)}
+		}
+		return summaries[pipeline]
+	}
+
+	rows, err := p.reader().QueryContext(ctx, `
+		SELECT pipeline, status, COUNT(*)
+		FROM pipeline_runs
+		WHERE started_at >= $1
+		GROUP BY pipeline, status`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pipeline runs: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pipeline, status string
+		var count int
+		if err := rows.Scan(&pipeline, &status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan run count: %w", err)
+		}
+		summary(pipeline).Runs[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count pipeline runs: %w", err)
+	}
+
+	// The last run and the last failure of each pipeline
+	for _, failed := range []bool{false, true} {
+		rows, err := p.reader().QueryContext(ctx, `
+			SELECT DISTINCT ON (pipeline) `+runColumns+`
+			FROM pipeline_runs
+			WHERE NOT $1 OR status = $2
+			ORDER BY pipeline, started_at DESC`, failed, RunFailed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query last pipeline runs: %w", err)
+		}
+		runs, err := scanRuns(rows)
+		if err != nil {
+			return nil, err
+		}
+		for i := range runs {
+			if failed {
+				summary(runs[i].Pipeline).LastFailure = &runs[i]
+			} else {
+				summary(runs[i].Pipeline).LastRun = &runs[i]
+			}
+		}
+	}
+	return summaries, nil
+}
+
+// BackfillRuns returns the runs of a backfill ordered by the start of their range,
+// retries of a range by their start time
+func (p *PostgresDB) BackfillRuns(ctx context.Context, backfillID string) ([]PipelineRun, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT `+runColumns+`
+		FROM pipeline_runs
+		WHERE backfill_id = $1
+		ORDER BY range_from, started_at`, backfillID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query backfill runs: %w", err)
+	}
+	return scanRuns(rows)
+}
+
+func scanRuns(rows *sql.Rows) ([]PipelineRun, error) {
+	defer rows.Close()
+
+	var runs []PipelineRun
+	for rows.Next() {
+		var run PipelineRun
+		var finishedAt, rangeFrom, rangeTo sql.NullTime
+		if err := rows.Scan(&run.RunID, &run.Pipeline, &run.Trigger, &run.Status, &run.StartedAt, &finishedAt, &run.RecordsExtracted,
+			&run.RecordsTransformed, &run.RecordsRejected, &run.RecordsLoaded, &run.ErrorCount, &run.Error,
+			&run.BackfillID, &rangeFrom, &rangeTo); err != nil {
+			return nil, fmt.Errorf("failed to scan pipeline run: %w", err)
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		if rangeFrom.Valid {
+			run.RangeFrom = &rangeFrom.Time
+		}
+		if rangeTo.Valid {
+			run.RangeTo = &rangeTo.Time
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SchedulerState is where the scheduler of a pipeline stood, saved in
+// scheduler_state so a restarted instance resumes from it
+type SchedulerState struct {
+	Pipeline string
+	// LastTick is when the last scheduled cycle started
+	LastTick time.Time
+	// Running is set while a cycle runs; a state saved with it set was left by a
+	// cycle interrupted by the restart
+	Running bool
+	// Continuation is set when the last cycle was cut short by its budget and the
+	// remainder is due right away
+	Continuation bool
+	Paused       bool
+	// RetryAt is when the last, failed cycle is retried, zero if it is not, and
+	// Retries the retries made since the last scheduled cycle
+	RetryAt time.Time
+	Retries int
+}
+
+// LoadSchedulerState returns the saved scheduler state of a pipeline, or nil if
+// none was saved
+func (p *PostgresDB) LoadSchedulerState(ctx context.Context, pipeline string) (*SchedulerState, error) {
+	state := SchedulerState{Pipeline: pipeline}
+	var lastTick, retryAt sql.NullTime
+	err := p.db.QueryRowContext(ctx, `
+		SELECT last_tick_at, running, continuation, paused, retry_at, retries
+		FROM scheduler_state
+		WHERE pipeline = $1`, pipeline).Scan(&lastTick, &state.Running, &state.Continuation, &state.Paused, &retryAt, &state.Retries)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scheduler state of pipeline %s: %w", pipeline, err)
+	}
+	if lastTick.Valid {
+		state.LastTick = lastTick.Time.UTC()
+	}
+	if retryAt.Valid {
+		state.RetryAt = retryAt.Time.UTC()
+	}
+	return &state, nil
+}
+
+// SaveSchedulerState upserts the scheduler state of a pipeline
+func (p *PostgresDB) SaveSchedulerState(ctx context.Context, state SchedulerState) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO scheduler_state (pipeline, last_tick_at, running, continuation, paused, retry_at, retries, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)
+		ON CONFLICT (pipeline) DO UPDATE SET
+			last_tick_at = EXCLUDED.last_tick_at,
+			running = EXCLUDED.running,
+			continuation = EXCLUDED.continuation,
+			paused = EXCLUDED.paused,
+			retry_at = EXCLUDED.retry_at,
+			retries = EXCLUDED.retries,
+			updated_at = EXCLUDED.updated_at`,
+		state.Pipeline, nullTime(state.LastTick), state.Running, state.Continuation, state.Paused, nullTime(state.RetryAt), state.Retries)
+	if err != nil {
+		return fmt.Errorf("failed to save scheduler state of pipeline %s: %w", state.Pipeline, err)
+	}
+	return nil
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
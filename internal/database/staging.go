@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Load strategies for processed records
+const (
+	// LoadDirect inserts processed records straight into processed_data
+	LoadDirect = "direct"
+	// LoadStaged stages the processed records of a run and promotes them at most
+	// once, so retries and resumed runs never duplicate a batch
+	LoadStaged = "staged"
+)
+
+// stagingColumns are processedColumns followed by the batch of staged records
+var stagingColumns = append(append([]string(nil), processedColumns...), "batch")
+
+type loadBatchKey struct{}
+
+// WithLoadBatch returns a context loading the numbered batch of a run, so the
+// staged load strategy claims each batch of a run that loads several on its own
+func WithLoadBatch(ctx context.Context, batch int) context.Context {
+	return context.WithValue(ctx, loadBatchKey{}, batch)
+}
+
+// LoadBatch returns the batch number carried by ctx, or 0 outside of a numbered batch
+func LoadBatch(ctx context.Context) int {
+	batch, _ := ctx.Value(loadBatchKey{}).(int)
+	return batch
+}
+
+// SetLoadStrategy selects how processed records written by a run are loaded
+func (p *PostgresDB) SetLoadStrategy(strategy string) error {
+	switch strategy {
+	case LoadDirect, LoadStaged:
+		p.loadStrategy = strategy
+		return nil
+	}
+	return fmt.Errorf("unknown load strategy %q, expected %s or %s", strategy, LoadDirect, LoadStaged)
+}
+
+// loadStaged replaces the staged records of a batch of a run, then promotes them
+func (p *PostgresDB) loadStaged(ctx context.Context, runID string, records []ProcessedRecord) error {
+	batch := LoadBatch(ctx)
+	if err := p.withRetry(ctx, func() error { return p.stage(ctx, runID, batch, records) }); err != nil {
+		return err
+	}
+	return p.withRetry(ctx, func() error { return p.promote(ctx, runID, batch, len(records)) })
+}
+
+// stage replaces the staged records of a batch, discarding any left by an earlier attempt
+func (p *PostgresDB) stage(ctx context.Context, runID string, batch int, records []ProcessedRecord) error {
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "DELETE FROM processed_data_staging WHERE run_id = $1 AND batch = $2", runID, batch); err != nil {
+			return fmt.Errorf("failed to clear staged records: %w", err)
+		}
+		rows := processedRows(runID, records)
+		for i := range rows {
+			rows[i] = append(rows[i], batch)
+		}
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"processed_data_staging"}, stagingColumns, pgx.CopyFromRows(rows)); err != nil {
+			return fmt.Errorf("failed to stage processed records: %w", err)
+		}
+		return nil
+	})
+}
+
+// promote moves the staged records of a batch into processed_data unless the
+// batch was already loaded, recording the load in the same transaction
+func (p *PostgresDB) promote(ctx context.Context, runID string, batch, count int) error {
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		loaded, err := claimLoad(ctx, tx, runID, batch, count)
+		if err != nil {
+			return err
+		}
+		if loaded {
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO processed_data (user_id, title, body, run_id, source, source_hash, raw_data_id, transform_version, source_id, source_time)
+				SELECT user_id, title, body, run_id, source, source_hash, raw_data_id, transform_version, source_id, source_time
+				FROM processed_data_staging WHERE run_id = $1 AND batch = $2`, runID, batch); err != nil {
+				return fmt.Errorf("failed to promote staged records: %w", err)
+			}
+		} else if p.metrics != nil {
+			p.metrics.DuplicateLoadsSkippedTotal.Inc()
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM processed_data_staging WHERE run_id = $1 AND batch = $2", runID, batch); err != nil {
+			return fmt.Errorf("failed to clear staged records: %w", err)
+		}
+		return nil
+	})
+}
+
+// claimLoad records that the processed records of a batch of a run are loaded,
+// reporting false when the batch was loaded before
+func claimLoad(ctx context.Context, tx pgx.Tx, runID string, batch, count int) (bool, error) {
+	tag, err := tx.Exec(ctx, "INSERT INTO processed_loads (run_id, batch, records) VALUES ($1, $2, $3) ON CONFLICT (run_id, batch) DO NOTHING", runID, batch, count)
+	if err != nil {
+		return false, fmt.Errorf("failed to record load: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetLoadStrategy(t *testing.T) {
+	db := &PostgresDB{loadStrategy: LoadDirect}
+
+	if err := db.SetLoadStrategy(LoadStaged); err != nil {
+		t.Fatalf("Expected staged strategy to be accepted, got %v", err)
+	}
+	if db.loadStrategy != LoadStaged {
+		t.Errorf("Expected load strategy %q, got %q", LoadStaged, db.loadStrategy)
+	}
+
+	if err := db.SetLoadStrategy("swap"); err == nil {
+		t.Error("Expected unknown strategy to be rejected")
+	}
+	if db.loadStrategy != LoadStaged {
+		t.Errorf("Expected rejected strategy to keep %q, got %q", LoadStaged, db.loadStrategy)
+	}
+}
+
+func TestLoadBatch(t *testing.T) {
+	if batch := LoadBatch(context.Background()); batch != 0 {
+		t.Errorf("Expected batch 0 outside of a numbered batch, got %d", batch)
+	}
+	if batch := LoadBatch(WithLoadBatch(context.Background(), 3)); batch != 3 {
+		t.Errorf("Expected batch 3 from context, got %d", batch)
+	}
+	if len(stagingColumns) != len(processedColumns)+1 || stagingColumns[len(processedColumns)] != "batch" {
+		t.Errorf("Expected staged records to end with their batch, got %v", stagingColumns)
+	}
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// maxLoggedStatement is the most characters of a slow statement that are logged
+const maxLoggedStatement = 1000
+
+// statementTracer observes the duration of every statement run on the connections
+// of a pool, including COPY and batches, and logs the statements slower than
+// threshold. Arguments are never logged, since they hold the records.
+type statementTracer struct {
+	threshold time.Duration
+	metrics   *metrics.Metrics
+	logger    *logging.Logger
+}
+
+// statementKey is the context key of the statement a tracer is timing
+type statementKey struct{}
+
+// tracedStatement is a statement being timed; a batch is timed as a whole and
+// named after its first statement
+type tracedStatement struct {
+	sql        string
+	statements int
+	start      time.Time
+}
+
+// SetStatementTracing observes the duration of every statement on the primary and
+// the replica in metrics and logs the statements slower than threshold, unless it
+// is zero. Idle connections are closed, so the pools only keep traced connections.
+func (p *PostgresDB) SetStatementTracing(threshold time.Duration, metrics *metrics.Metrics, logger *logging.Logger) {
+	p.tracer = &statementTracer{threshold: threshold, metrics: metrics, logger: logger}
+	p.connector.tracer.Store(p.tracer)
+	closeIdle(p.db, p.pool)
+	if p.replica != nil {
+		p.replicaConnector.tracer.Store(p.tracer)
+		closeIdle(p.replica, p.replicaPool)
+	}
+}
+
+func (t *statementTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, statementKey{}, &tracedStatement{sql: data.SQL, start: time.Now()})
+}
+
+func (t *statementTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.observe(ctx, data.CommandTag)
+}
+
+func (t *statementTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchStartData) context.Context {
+	return context.WithValue(ctx, statementKey{}, &tracedStatement{start: time.Now()})
+}
+
+func (t *statementTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	if statement, ok := ctx.Value(statementKey{}).(*tracedStatement); ok {
+		if statement.sql == "" {
+			statement.sql = data.SQL
+		}
+		statement.statements++
+	}
+}
+
+func (t *statementTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchEndData) {
+	t.observe(ctx, pgconn.CommandTag{})
+}
+
+func (t *statementTracer) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	sql := fmt.Sprintf("COPY %s (%s) FROM STDIN", data.TableName.Sanitize(), strings.Join(data.ColumnNames, ", "))
+	return context.WithValue(ctx, statementKey{}, &tracedStatement{sql: sql, start: time.Now()})
+}
+
+func (t *statementTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	t.observe(ctx, data.CommandTag)
+}
+
+// observe records the duration of the statement of ctx, logging it when it was slow
+func (t *statementTracer) observe(ctx context.Context, tag pgconn.CommandTag) {
+	statement, ok := ctx.Value(statementKey{}).(*tracedStatement)
+	if !ok || statement.sql == "" {
+		return
+	}
+	elapsed := time.Since(statement.start)
+	name := statementName(statement.sql)
+	t.metrics.DatabaseStatementDuration.WithLabelValues(name).Observe(elapsed.Seconds())
+	if t.threshold <= 0 || elapsed < t.threshold {
+		return
+	}
+
+	t.metrics.DatabaseSlowStatementsTotal.WithLabelValues(name).Inc()
+	detail := fmt.Sprintf("%d rows", tag.RowsAffected())
+	if statement.statements > 0 {
+		detail = fmt.Sprintf("batch of %d statements", statement.statements)
+	}
+	t.logger.ForContext(ctx).Warn(fmt.Sprintf("Slow database statement %s took %v (%s): %s",
+		name, elapsed.Round(time.Millisecond), detail, loggedStatement(statement.sql)))
+}
+
+// partitionSuffix is the suffix of the dated partitions of a table, which are
+// observed under the name of the table
+var partitionSuffix = regexp.MustCompile(`_p[0-9]+$`)
+
+// identifier matches a possibly schema-qualified, possibly quoted table name
+var identifier = regexp.MustCompile(`^"?[A-Za-z_][A-Za-z0-9_]*"?(\."?[A-Za-z_][A-Za-z0-9_]*"?)?$`)
+
+// statementName names sql by its command and the table it reads or writes, e.g.
+// INSERT raw_data or SELECT pipeline_runs, keeping the label values of the
+// statement metrics few. Statements without a table, such as BEGIN or DDL, are
+// named by their command alone.
+func statementName(sql string) string {
+	words := strings.Fields(sql)
+	// Skip leading comments such as those of migrations
+	for len(words) > 0 && strings.HasPrefix(words[0], "--") {
+		line := strings.IndexByte(sql, '\n')
+		if line < 0 {
+			return "OTHER"
+		}
+		sql = sql[line+1:]
+		words = strings.Fields(sql)
+	}
+	if len(words) == 0 {
+		return "OTHER"
+	}
+
+	command := strings.ToUpper(strings.TrimRight(words[0], ";"))
+	var after string
+	switch command {
+	case "SELECT", "DELETE":
+		after = "FROM"
+	case "INSERT":
+		after = "INTO"
+	case "UPDATE", "COPY":
+		return tableName(command, words[1:])
+	default:
+		return command
+	}
+	for i, word := range words[1:] {
+		if strings.EqualFold(word, after) {
+			if name := tableName(command, words[i+2:]); name != command {
+				return name
+			}
+		}
+	}
+	return command
+}
+
+// tableName names a statement by command and the table starting words, or by
+// command alone when words do not start with a table, e.g. with a subquery
+func tableName(command string, words []string) string {
+	if len(words) == 0 {
+		return command
+	}
+	table := strings.TrimRight(words[0], ",;)")
+	if i := strings.IndexByte(table, '('); i > 0 {
+		table = table[:i]
+	}
+	if !identifier.MatchString(table) {
+		return command
+	}
+	table = strings.ToLower(strings.ReplaceAll(table, `"`, ""))
+	return command + " " + partitionSuffix.ReplaceAllString(table, "")
+}
+
+// loggedStatement returns sql on one line, cut at maxLoggedStatement characters
+func loggedStatement(sql string) string {
+	sql = strings.Join(strings.Fields(sql), " ")
+	if len(sql) > maxLoggedStatement {
+		return sql[:maxLoggedStatement] + "..."
+	}
+	return sql
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStatementName(t *testing.T) {
+	tests := []struct {
+		sql  string
+		name string
+	}{
+		{"INSERT INTO raw_data (data, run_id) VALUES ($1, $2) RETURNING id", "INSERT raw_data"},
+		{"\n\t\tSELECT id, status FROM pipeline_runs WHERE id = $1", "SELECT pipeline_runs"},
+		{`
+		SELECT source_id, user_id FROM (
+			SELECT DISTINCT ON (source_id) source_id, user_id
+			FROM processed_data
+		) latest`, "SELECT processed_data"},
+		{"UPDATE processed_data SET deleted_at = CURRENT_TIMESTAMP WHERE source_id = ANY($1)", "UPDATE processed_data"},
+		{"delete from raw_data_p20251001 where created_at < $1", "DELETE raw_data"},
+		{"SELECT COUNT(*) FROM raw_data_default", "SELECT raw_data_default"},
+		{`COPY "processed_data" (run_id, user_id) FROM STDIN`, "COPY processed_data"},
+		{"SELECT pg_advisory_lock($1)", "SELECT"},
+		{"begin", "BEGIN"},
+		{"-- 0003_lineage\nALTER TABLE processed_data ADD COLUMN run_id TEXT;", "ALTER"},
+		{"", "OTHER"},
+	}
+
+	for _, tt := range tests {
+		if name := statementName(tt.sql); name != tt.name {
+			t.Errorf("statementName(%q) = %q, want %q", tt.sql, name, tt.name)
+		}
+	}
+}
+
+func TestLoggedStatement(t *testing.T) {
+	if got := loggedStatement("\n\t\tSELECT id\n\t\tFROM raw_data\n"); got != "SELECT id FROM raw_data" {
+		t.Errorf("loggedStatement() = %q", got)
+	}
+	long := loggedStatement("SELECT " + strings.Repeat("x, ", maxLoggedStatement))
+	if len(long) != maxLoggedStatement+3 || !strings.HasSuffix(long, "...") {
+		t.Errorf("loggedStatement() of a long statement has %d characters", len(long))
+	}
+}
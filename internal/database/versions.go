@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TransformVersion is a version of a pipeline's field mapping and the processed
+// rows transformed with it
+type TransformVersion struct {
+	Version     string          `json:"version"`
+	Fields      json.RawMessage `json:"fields"`
+	FirstSeenAt time.Time       `json:"first_seen_at"`
+	// Rows is the number of processed rows of the version
+	Rows int64 `json:"rows"`
+}
+
+// RecordTransformVersion records a transform version of a pipeline with the fields
+// it maps, reporting whether the version is new
+func (p *PostgresDB) RecordTransformVersion(ctx context.Context, pipeline, version string, fields json.RawMessage) (bool, error) {
+	result, err := p.db.ExecContext(ctx, `
+		INSERT INTO transform_versions (pipeline, version, fields)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (pipeline, version) DO NOTHING`,
+		pipeline, version, []byte(fields))
+	if err != nil {
+		return false, fmt.Errorf("failed to record transform version: %w", err)
+	}
+	added, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record transform version: %w", err)
+	}
+	return added == 1, nil
+}
+
+// TransformVersions returns the transform versions of a pipeline, oldest first,
+// with the number of processed rows of each
+func (p *PostgresDB) TransformVersions(ctx context.Context, pipeline string) ([]TransformVersion, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT v.version, v.fields, v.first_seen_at,
+			(SELECT COUNT(*) FROM processed_data p WHERE p.transform_version = v.version)
+		FROM transform_versions v
+		WHERE v.pipeline = $1
+		ORDER BY v.first_seen_at, v.version`, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transform versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []TransformVersion
+	for rows.Next() {
+		var v TransformVersion
+		var fields []byte
+		if err := rows.Scan(&v.Version, &fields, &v.FirstSeenAt, &v.Rows); err != nil {
+			return nil, fmt.Errorf("failed to scan transform version: %w", err)
+		}
+		v.Fields = fields
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
@@ -0,0 +1,138 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// KeySize is the size of AES-256 keys
+const KeySize = 32
+
+// magic starts every encrypted file, followed by a format version
+var magic = []byte("ETLENC\x01")
+
+// ErrUnknownKey is returned when a file was encrypted with a key missing from the keyring
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Keyring encrypts with its primary key and decrypts with any of its keys, so the
+// primary key can be rotated while files written with older keys stay readable
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring of AES-256 keys by ID, encrypting with primary
+func NewKeyring(keys map[string][]byte, primary string) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary encryption key %q is not configured", primary)
+	}
+	k := &Keyring{primary: primary, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("invalid encryption key ID %q", id)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("encryption key %s must be %d bytes, got %d", id, KeySize, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if k.keys[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// DecodeKeys decodes base64 encoded keys by ID
+func DecodeKeys(encoded map[string]string) (map[string][]byte, error) {
+	keys := make(map[string][]byte, len(encoded))
+	for id, value := range encoded {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s is not valid base64: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// Primary returns the ID of the key new files are encrypted with
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// KeyIDs returns the IDs of the keys in the keyring, sorted
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Encrypt seals plaintext with the primary key. The result starts with a header
+// naming the key, which is authenticated along with the content.
+func (k *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	aead := k.keys[k.primary]
+	header := append(append([]byte{}, magic...), byte(len(k.primary)))
+	header = append(header, k.primary...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := append(header, nonce...)
+	return aead.Seal(sealed, nonce, plaintext, header), nil
+}
+
+// Decrypt opens data sealed by Encrypt with any key of the keyring
+func (k *Keyring) Decrypt(data []byte) ([]byte, error) {
+	id, header, rest, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("encrypted data is truncated")
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with key %s: %w", id, err)
+	}
+	return plaintext, nil
+}
+
+// KeyID returns the ID of the key data was encrypted with
+func KeyID(data []byte) (string, error) {
+	id, _, _, err := parseHeader(data)
+	return id, err
+}
+
+// IsEncrypted reports whether data starts with the header written by Encrypt
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+func parseHeader(data []byte) (id string, header, rest []byte, err error) {
+	if !IsEncrypted(data) || len(data) < len(magic)+1 {
+		return "", nil, nil, errors.New("data is not encrypted")
+	}
+	end := len(magic) + 1 + int(data[len(magic)])
+	if len(data) < end {
+		return "", nil, nil, errors.New("encrypted data is truncated")
+	}
+	return string(data[len(magic)+1 : end]), data[:end], data[end:], nil
+}
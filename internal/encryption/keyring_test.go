@@ -0,0 +1,92 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, KeySize)
+	newKey := bytes.Repeat([]byte{2}, KeySize)
+
+	before, err := NewKeyring(map[string][]byte{"2024": oldKey}, "2024")
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	sealed, err := before.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if !IsEncrypted(sealed) || bytes.Contains(sealed, []byte("secret")) {
+		t.Fatalf("Expected sealed content, got %q", sealed)
+	}
+
+	// After rotation new files use the new key and old files stay readable
+	after, _ := NewKeyring(map[string][]byte{"2024": oldKey, "2025": newKey}, "2025")
+	if plaintext, err := after.Decrypt(sealed); err != nil || string(plaintext) != "secret" {
+		t.Errorf("Expected old file to decrypt, got %q (%v)", plaintext, err)
+	}
+	resealed, _ := after.Encrypt([]byte("secret"))
+	if id, _ := KeyID(resealed); id != "2025" {
+		t.Errorf("Expected new files to use key 2025, got %s", id)
+	}
+
+	retired, _ := NewKeyring(map[string][]byte{"2025": newKey}, "2025")
+	if _, err := retired.Decrypt(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey for a retired key, got %v", err)
+	}
+
+	// The key ID is authenticated along with the content
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := before.Decrypt(tampered); err == nil {
+		t.Error("Expected tampered content to be rejected")
+	}
+}
+
+func TestNewKeyringValidation(t *testing.T) {
+	if _, err := NewKeyring(map[string][]byte{"a": make([]byte, 16)}, "a"); err == nil {
+		t.Error("Expected short key to be rejected")
+	}
+	if _, err := NewKeyring(map[string][]byte{"a": make([]byte, KeySize)}, "b"); err == nil {
+		t.Error("Expected missing primary key to be rejected")
+	}
+}
+
+func TestKMSDecryptKeys(t *testing.T) {
+	key := bytes.Repeat([]byte{3}, KeySize)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "TrentService.Decrypt" || !strings.Contains(r.Header.Get("Authorization"), "/kms/aws4_request") {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		var req struct{ CiphertextBlob string }
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.CiphertextBlob != base64.StdEncoding.EncodeToString([]byte("wrapped")) {
+			http.Error(w, `{"__type":"InvalidCiphertextException"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"Plaintext": base64.StdEncoding.EncodeToString(key)})
+	}))
+	defer server.Close()
+
+	client := NewKMSClient(KMSConfig{Region: "eu-west-1", Endpoint: server.URL})
+	keys, err := client.DecryptKeys(context.Background(), map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte("wrapped"))})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(keys["k1"], key) {
+		t.Errorf("Expected unwrapped key, got %v", keys["k1"])
+	}
+
+	if _, err := client.DecryptKeys(context.Background(), map[string]string{"k2": base64.StdEncoding.EncodeToString([]byte("other"))}); err == nil {
+		t.Error("Expected KMS error to be returned")
+	}
+}
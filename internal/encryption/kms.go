@@ -0,0 +1,91 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+)
+
+// KMSConfig configures the AWS KMS client unwrapping data keys
+type KMSConfig struct {
+	Region string
+	// Endpoint overrides the regional KMS endpoint, e.g. for VPC endpoints or LocalStack
+	Endpoint    string
+	Credentials awsauth.Credentials
+}
+
+// KMSClient decrypts data keys wrapped with AWS KMS, so only ciphertext keys
+// need to be configured
+type KMSClient struct {
+	cfg        KMSConfig
+	httpClient *http.Client
+}
+
+// NewKMSClient creates a KMS client
+func NewKMSClient(cfg KMSConfig) *KMSClient {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com", cfg.Region)
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	return &KMSClient{cfg: cfg, httpClient: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Decrypt returns the plaintext of a data key encrypted by KMS, e.g. with
+// aws kms generate-data-key --key-spec AES_256
+func (c *KMSClient) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	body, err := json.Marshal(map[string]string{"CiphertextBlob": base64.StdEncoding.EncodeToString(ciphertext)})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.Endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kms request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+	awsauth.Sign(req, c.cfg.Credentials, c.cfg.Region, "kms", awsauth.PayloadHash(body), time.Now())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kms request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kms response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kms Decrypt returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var result struct {
+		Plaintext string `json:"Plaintext"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse kms response: %w", err)
+	}
+	return base64.StdEncoding.DecodeString(result.Plaintext)
+}
+
+// DecryptKeys unwraps KMS encrypted data keys, given base64 encoded by ID
+func (c *KMSClient) DecryptKeys(ctx context.Context, wrapped map[string]string) (map[string][]byte, error) {
+	ciphertexts, err := DecodeKeys(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string][]byte, len(ciphertexts))
+	for id, ciphertext := range ciphertexts {
+		if keys[id], err = c.Decrypt(ctx, ciphertext); err != nil {
+			return nil, fmt.Errorf("failed to unwrap encryption key %s: %w", id, err)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,159 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// Version is the envelope format version written by this build. Decode accepts
+// any version up to it.
+const Version = 1
+
+// Batch kinds
+const (
+	// KindRaw batches hold records as returned by the source
+	KindRaw = "raw"
+	// KindProcessed batches hold records in the processed schema
+	KindProcessed = "processed"
+)
+
+// Envelope is the self-describing format batches are exchanged in: files written
+// by storage, batches posted to /ingest and batches read by replay tooling
+type Envelope struct {
+	Version     int       `json:"version"`
+	Kind        string    `json:"kind"`
+	BatchID     string    `json:"batch_id"`
+	Producer    string    `json:"producer"`
+	CreatedAt   time.Time `json:"created_at"`
+	RecordCount int       `json:"record_count"`
+	// Checksum is the hex SHA-256 of Records with insignificant whitespace removed,
+	// used to detect truncated or altered batches
+	Checksum string `json:"checksum"`
+	// Schema describes the records of processed batches
+	Schema  []transform.Field `json:"schema,omitempty"`
+	Records json.RawMessage   `json:"records"`
+}
+
+// NewRaw wraps raw source records in an envelope
+func NewRaw(records []map[string]interface{}) (*Envelope, error) {
+	return newEnvelope(KindRaw, nil, len(records), records)
+}
+
+// NewRawPayloads wraps raw source records in an envelope as the JSON they were
+// received as, without decoding them
+func NewRawPayloads(payloads []json.RawMessage) (*Envelope, error) {
+	return newEnvelope(KindRaw, nil, len(payloads), payloads)
+}
+
+// NewProcessed wraps processed records in an envelope carrying the processed schema
+func NewProcessed(records []database.ProcessedRecord) (*Envelope, error) {
+	return newEnvelope(KindProcessed, transform.Fields, len(records), records)
+}
+
+func newEnvelope(kind string, schema []transform.Field, count int, records interface{}) (*Envelope, error) {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal records: %w", err)
+	}
+	if count == 0 {
+		data = json.RawMessage("[]")
+	}
+
+	return &Envelope{
+		Version:     Version,
+		Kind:        kind,
+		BatchID:     newBatchID(),
+		Producer:    producer(),
+		CreatedAt:   time.Now().UTC(),
+		RecordCount: count,
+		Checksum:    checksum(data),
+		Schema:      schema,
+		Records:     data,
+	}, nil
+}
+
+// Decode reads an envelope and verifies its version, kind, checksum and record count
+func Decode(r io.Reader) (*Envelope, error) {
+	var env Envelope
+	if err := json.NewDecoder(r).Decode(&env); err != nil {
+		return nil, fmt.Errorf("failed to decode batch envelope: %w", err)
+	}
+
+	switch {
+	case env.Version < 1 || env.Version > Version:
+		return nil, fmt.Errorf("unsupported envelope version %d, this build reads up to %d", env.Version, Version)
+	case env.Kind != KindRaw && env.Kind != KindProcessed:
+		return nil, fmt.Errorf("unknown batch kind %q", env.Kind)
+	case env.Checksum != checksum(env.Records):
+		return nil, fmt.Errorf("batch %s checksum mismatch", env.BatchID)
+	}
+
+	var records []json.RawMessage
+	if err := json.Unmarshal(env.Records, &records); err != nil {
+		return nil, fmt.Errorf("batch %s records are not a JSON array: %w", env.BatchID, err)
+	}
+	if len(records) != env.RecordCount {
+		return nil, fmt.Errorf("batch %s declares %d records but holds %d", env.BatchID, env.RecordCount, len(records))
+	}
+	return &env, nil
+}
+
+// RawRecords returns the records of a raw batch
+func (e *Envelope) RawRecords() ([]map[string]interface{}, error) {
+	if e.Kind != KindRaw {
+		return nil, fmt.Errorf("batch %s is %s, not %s", e.BatchID, e.Kind, KindRaw)
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal(e.Records, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode raw records: %w", err)
+	}
+	return records, nil
+}
+
+// ProcessedRecords returns the records of a processed batch
+func (e *Envelope) ProcessedRecords() ([]database.ProcessedRecord, error) {
+	if e.Kind != KindProcessed {
+		return nil, fmt.Errorf("batch %s is %s, not %s", e.BatchID, e.Kind, KindProcessed)
+	}
+	var records []database.ProcessedRecord
+	if err := json.Unmarshal(e.Records, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode processed records: %w", err)
+	}
+	return records, nil
+}
+
+// checksum hashes compacted JSON so indenting a batch does not change its checksum
+func checksum(data []byte) string {
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, data); err != nil {
+		compacted.Reset()
+		compacted.Write(data)
+	}
+	sum := sha256.Sum256(compacted.Bytes())
+	return hex.EncodeToString(sum[:])
+}
+
+func newBatchID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// producer identifies the instance writing a batch
+func producer() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return "etl-pipeline@" + host
+}
@@ -0,0 +1,56 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+func TestRoundTrip(t *testing.T) {
+	env, err := NewProcessed([]database.ProcessedRecord{{UserID: 1, Title: "Title", Body: "Body"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Indenting the envelope, as file storage does, must not break the checksum
+	data, _ := json.MarshalIndent(env, "", "  ")
+	decoded, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode envelope: %v", err)
+	}
+	if decoded.BatchID != env.BatchID || len(decoded.Schema) == 0 {
+		t.Errorf("Unexpected decoded envelope: %+v", decoded)
+	}
+
+	records, err := decoded.ProcessedRecords()
+	if err != nil || len(records) != 1 || records[0].Title != "Title" {
+		t.Errorf("Unexpected records %+v (%v)", records, err)
+	}
+	if _, err := decoded.RawRecords(); err == nil {
+		t.Error("Expected error reading a processed batch as raw")
+	}
+}
+
+func TestDecodeRejectsInvalidBatches(t *testing.T) {
+	env, _ := NewRaw([]map[string]interface{}{{"id": 1}, {"id": 2}})
+	valid, _ := json.Marshal(env)
+
+	tests := map[string]string{
+		"future version": strings.Replace(string(valid), `"version":1`, `"version":99`, 1),
+		"unknown kind":   strings.Replace(string(valid), `"kind":"raw"`, `"kind":"mystery"`, 1),
+		"altered":        strings.Replace(string(valid), `{"id":2}`, `{"id":3}`, 1),
+		"wrong count":    strings.Replace(string(valid), `"record_count":2`, `"record_count":3`, 1),
+	}
+	for name, data := range tests {
+		if _, err := Decode(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	if _, err := Decode(bytes.NewReader(valid)); err != nil {
+		t.Errorf("Expected valid envelope to decode, got %v", err)
+	}
+}
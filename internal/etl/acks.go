@@ -0,0 +1,144 @@
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/api"
+)
+
+// errNotDurable is the reason batches whose records were neither stored nor kept
+// are nacked with
+var errNotDurable = errors.New("records were neither loaded nor kept for replay")
+
+// batchExtractor returns the extractor handing out batches to acknowledge, if the
+// pipeline's extractor is one
+func (e *ETLService) batchExtractor() (api.BatchExtractor, bool) {
+	extractor, ok := e.apiClient.(api.BatchExtractor)
+	return extractor, ok
+}
+
+// fetchBatches fetches the batches of a whole cycle and returns their records,
+// with their payloads when raw passthrough keeps them
+func fetchBatches(ctx context.Context, extractor api.BatchExtractor, keepPayloads bool) ([]map[string]interface{}, []json.RawMessage, []*api.Batch, error) {
+	var extracted extractedBatches
+	var mu sync.Mutex
+	var data []map[string]interface{}
+	var payloads []json.RawMessage
+	err := extractor.FetchBatches(ctx, func(batch *api.Batch) error {
+		extracted.add(batch)
+		batchPayloads, err := payloadsOf(batch, keepPayloads)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		data = append(data, batch.Records...)
+		payloads = append(payloads, batchPayloads...)
+		return nil
+	})
+	return data, payloads, extracted.all(), err
+}
+
+// payloadsOf returns the payloads of the records of a batch if keep is set,
+// encoding the records of batches without them
+func payloadsOf(batch *api.Batch, keep bool) ([]json.RawMessage, error) {
+	switch {
+	case !keep:
+		return nil, nil
+	case batch.Payloads == nil:
+		payloads := make([]json.RawMessage, len(batch.Records))
+		for i, record := range batch.Records {
+			payload, err := json.Marshal(record)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode extracted record: %w", err)
+			}
+			payloads[i] = payload
+		}
+		return payloads, nil
+	case len(batch.Payloads) != len(batch.Records):
+		return nil, fmt.Errorf("extracted batch has %d payloads for %d records", len(batch.Payloads), len(batch.Records))
+	}
+	return batch.Payloads, nil
+}
+
+// extractedBatches collects the batches a cycle extracted, possibly concurrently
+type extractedBatches struct {
+	mu      sync.Mutex
+	batches []*api.Batch
+}
+
+func (b *extractedBatches) add(batch *api.Batch) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = append(b.batches, batch)
+}
+
+func (b *extractedBatches) all() []*api.Batch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.batches
+}
+
+// batchAck acks an extracted batch once every chunk it was split into is durable
+type batchAck struct {
+	batch  *api.Batch
+	chunks atomic.Int32
+}
+
+// chunkDurable acks the batch of ack once its last chunk is durable
+func (e *ETLService) chunkDurable(r *run, ack *batchAck) {
+	if ack.chunks.Add(-1) == 0 {
+		e.ackBatches(r, []*api.Batch{ack.batch})
+	}
+}
+
+// ackBatches acks the batches, whose records are durable
+func (e *ETLService) ackBatches(r *run, batches []*api.Batch) {
+	for _, batch := range batches {
+		err := batch.Ack()
+		switch {
+		case errors.Is(err, api.ErrBatchSettled):
+		case err != nil:
+			e.metrics.SourceBatchesTotal.WithLabelValues("failed").Inc()
+			r.logger.Error(fmt.Sprintf("Failed to acknowledge %d extracted records, the source will deliver them again: %v", len(batch.Records), err))
+		default:
+			e.metrics.SourceBatchesTotal.WithLabelValues("acked").Inc()
+		}
+	}
+}
+
+// nackBatches nacks the batches not acked yet, for reason, or errNotDurable when
+// the cycle did not fail. Batches without records have nothing to lose and are
+// acked.
+func (e *ETLService) nackBatches(r *run, batches []*api.Batch, reason error) {
+	if reason == nil {
+		reason = errNotDurable
+	}
+	nacked, records := 0, 0
+	for _, batch := range batches {
+		if len(batch.Records) == 0 {
+			e.ackBatches(r, []*api.Batch{batch})
+			continue
+		}
+		err := batch.Nack(reason)
+		switch {
+		case errors.Is(err, api.ErrBatchSettled):
+			continue
+		case err != nil:
+			e.metrics.SourceBatchesTotal.WithLabelValues("failed").Inc()
+			r.logger.Error(fmt.Sprintf("Failed to release %d extracted records: %v", len(batch.Records), err))
+		default:
+			e.metrics.SourceBatchesTotal.WithLabelValues("nacked").Inc()
+		}
+		nacked++
+		records += len(batch.Records)
+	}
+	if nacked > 0 {
+		r.logger.Warn(fmt.Sprintf("Released %d extracted batches (%d records) to the source for delivery again: %v", nacked, records, reason))
+	}
+}
@@ -0,0 +1,85 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/api"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// queueExtractor hands out batches of one record, then an empty one, then fails
+// if err is set, recording how each batch was settled
+type queueExtractor struct {
+	batches int
+	err     error
+	acked   int
+	nacked  []error
+}
+
+func (q *queueExtractor) FetchData(ctx context.Context) ([]map[string]interface{}, error) {
+	return nil, errors.New("not batched")
+}
+
+func (q *queueExtractor) FetchBatches(ctx context.Context, emit func(batch *api.Batch) error) error {
+	for i := 0; i <= q.batches; i++ {
+		var records []map[string]interface{}
+		if i < q.batches {
+			records = []map[string]interface{}{{"userId": float64(i + 1), "title": "Title", "body": "Body"}}
+		}
+		batch := api.NewBatch(records, nil,
+			func() error { q.acked++; return nil },
+			func(reason error) error { q.nacked = append(q.nacked, reason); return nil })
+		if err := emit(batch); err != nil {
+			return err
+		}
+	}
+	return q.err
+}
+
+func TestStreamNacksBatchesNotLoaded(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	metricsCollector := metrics.NewMetrics()
+	extractor := &queueExtractor{batches: 5, err: errors.New("queue unavailable")}
+	e := NewETLService(extractor, nil, nil, nil, transform.NewTransformer(logger, metricsCollector), logger, metricsCollector, nil)
+	// Batches are never full nor due, so nothing is loaded before the failure
+	e.SetStreaming(StreamConfig{Workers: 2, Buffer: 2, BatchSize: 1000, FlushInterval: time.Hour})
+
+	if _, err := e.runStream(context.Background(), context.Background(), &run{logger: logger}); err == nil {
+		t.Fatal("Expected the extraction error")
+	}
+	if len(extractor.nacked) != 5 {
+		t.Fatalf("Expected every batch with records to be nacked, got %d nacks", len(extractor.nacked))
+	}
+	for _, reason := range extractor.nacked {
+		if reason != extractor.err {
+			t.Errorf("Expected batches to be nacked with the extraction error, got %v", reason)
+		}
+	}
+	// The empty batch has nothing to deliver again
+	if extractor.acked != 1 {
+		t.Errorf("Expected the empty batch to be acked, got %d acks", extractor.acked)
+	}
+}
+
+func TestChunkDurable(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	e := NewETLService(nil, nil, nil, nil, nil, logger, metrics.NewMetrics(), nil)
+	r := &run{logger: logger}
+
+	acked := 0
+	ack := &batchAck{batch: api.NewBatch(make([]map[string]interface{}, 3), nil, func() error { acked++; return nil }, nil)}
+	ack.chunks.Store(2)
+	e.chunkDurable(r, ack)
+	if acked != 0 {
+		t.Fatal("Expected the batch to wait for its last chunk")
+	}
+	e.chunkDurable(r, ack)
+	if acked != 1 {
+		t.Errorf("Expected the batch to be acked once all its chunks are durable, got %d acks", acked)
+	}
+}
@@ -0,0 +1,248 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/api"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+	"github.com/mohammedhassan/etl-pipeline/internal/tracing"
+)
+
+// triggerBackfill marks the runs extracting the chunks of a backfill
+const triggerBackfill = "backfill"
+
+// Limits of a backfill: the chunks extracted at once and the chunks of its range
+const (
+	maxBackfillParallelism = 32
+	maxBackfillChunks      = 10000
+)
+
+// dateLayout is the layout of date-only range bounds
+const dateLayout = "2006-01-02"
+
+// BackfillRequest asks for the records of a historical date range
+type BackfillRequest struct {
+	// ID resumes an earlier backfill, skipping the chunks it completed; a new
+	// backfill is started when empty
+	ID       string
+	From, To time.Time
+	// Chunk is the width of the range extracted per run and Parallelism the number
+	// of chunks extracted at once; zero values use the service defaults
+	Chunk       time.Duration
+	Parallelism int
+}
+
+// BackfillChunk is the range [From, To) extracted by one run of a backfill
+type BackfillChunk struct {
+	From time.Time
+	To   time.Time
+}
+
+// Backfill is a planned backfill and the chunks it still has to extract
+type Backfill struct {
+	ID          string
+	From        time.Time
+	To          time.Time
+	Chunks      int
+	Pending     []BackfillChunk
+	Parallelism int
+}
+
+// SetBackfillDefaults sets the chunk width and parallelism of backfills that do not
+// specify them
+func (e *ETLService) SetBackfillDefaults(chunk time.Duration, parallelism int) {
+	e.backfillChunk = chunk
+	e.backfillParallelism = parallelism
+}
+
+// PlanBackfill validates a backfill request and splits its range into chunks. The
+// chunks an earlier backfill of the same ID loaded are left out.
+func (e *ETLService) PlanBackfill(ctx context.Context, req BackfillRequest) (*Backfill, error) {
+	if e.dryRun {
+		return nil, ErrDryRun
+	}
+	if _, ok := e.apiClient.(api.RangeExtractor); !ok {
+		return nil, errors.New("the source extractor cannot fetch date ranges, backfills need a plain API source")
+	}
+	if req.Chunk == 0 {
+		req.Chunk = e.backfillChunk
+	}
+	if req.Parallelism == 0 {
+		req.Parallelism = e.backfillParallelism
+	}
+	switch {
+	case !req.From.Before(req.To):
+		return nil, fmt.Errorf("backfill range is empty: from %s is not before to %s", req.From.Format(time.RFC3339), req.To.Format(time.RFC3339))
+	case req.Chunk <= 0:
+		return nil, fmt.Errorf("invalid backfill chunk %v", req.Chunk)
+	case req.Parallelism < 1 || req.Parallelism > maxBackfillParallelism:
+		return nil, fmt.Errorf("backfill parallelism must be between 1 and %d", maxBackfillParallelism)
+	case req.To.Sub(req.From)/req.Chunk >= maxBackfillChunks:
+		return nil, fmt.Errorf("backfill range splits into more than %d chunks, use a wider chunk", maxBackfillChunks)
+	}
+
+	chunks := splitRange(req.From.UTC(), req.To.UTC(), req.Chunk)
+	b := &Backfill{ID: req.ID, From: req.From.UTC(), To: req.To.UTC(), Chunks: len(chunks), Parallelism: req.Parallelism}
+	if b.ID == "" {
+		b.ID = runid.New()
+		b.Pending = chunks
+	} else {
+		runs, err := e.db.BackfillRuns(ctx, b.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load backfill progress: %w", err)
+		}
+		b.Pending = pendingChunks(chunks, runs)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.backfills[b.ID] {
+		return nil, fmt.Errorf("backfill %s is already running", b.ID)
+	}
+	e.backfills[b.ID] = true
+	return b, nil
+}
+
+// RunBackfill extracts and loads the pending chunks of a planned backfill, each in
+// its own run recorded in the run history. Failed chunks do not stop the others;
+// resuming the backfill retries them.
+func (e *ETLService) RunBackfill(ctx context.Context, b *Backfill) error {
+	defer func() {
+		e.mu.Lock()
+		delete(e.backfills, b.ID)
+		e.mu.Unlock()
+	}()
+	logger := e.logger.WithPrefix("[backfill " + b.ID + "]")
+	logger.Info(fmt.Sprintf("Backfilling %s to %s: %d of %d chunks, %d at a time",
+		b.From.Format(time.RFC3339), b.To.Format(time.RFC3339), len(b.Pending), b.Chunks, b.Parallelism))
+
+	var mu sync.Mutex
+	done, failed := b.Chunks-len(b.Pending), 0
+	chunks := make(chan BackfillChunk)
+	var wg sync.WaitGroup
+	for i := 0; i < min(b.Parallelism, len(b.Pending)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				err := e.runBackfillChunk(ctx, b.ID, chunk)
+				mu.Lock()
+				if err != nil {
+					failed++
+					e.metrics.BackfillChunksTotal.WithLabelValues("failed").Inc()
+				} else {
+					done++
+					e.metrics.BackfillChunksTotal.WithLabelValues("succeeded").Inc()
+				}
+				logger.Info(fmt.Sprintf("Progress: %d/%d chunks loaded, %d failed", done, b.Chunks, failed))
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, chunk := range b.Pending {
+		if ctx.Err() != nil {
+			break
+		}
+		chunks <- chunk
+	}
+	close(chunks)
+	wg.Wait()
+
+	switch {
+	case ctx.Err() != nil:
+		logger.Warn(fmt.Sprintf("Backfill interrupted after %d/%d chunks, resume it with its ID", done, b.Chunks))
+		return ctx.Err()
+	case failed > 0:
+		logger.Warn(fmt.Sprintf("Backfill finished with %d failed chunks, resume it with its ID to retry them", failed))
+		return fmt.Errorf("%d of %d backfill chunks failed", failed, b.Chunks)
+	}
+	logger.Info(fmt.Sprintf("Backfill completed: %d chunks", b.Chunks))
+	return nil
+}
+
+// runBackfillChunk extracts the records of one chunk and runs them through the pipeline
+func (e *ETLService) runBackfillChunk(ctx context.Context, backfillID string, chunk BackfillChunk) error {
+	ctx, r := e.beginRun(ctx, database.PipelineRun{
+		RunID:      runid.New(),
+		Trigger:    triggerBackfill,
+		StartedAt:  time.Now().UTC(),
+		BackfillID: backfillID,
+		RangeFrom:  &chunk.From,
+		RangeTo:    &chunk.To,
+	})
+	r.logger.Info(fmt.Sprintf("Extracting %s to %s", chunk.From.Format(time.RFC3339), chunk.To.Format(time.RFC3339)))
+
+	extractCtx, span := tracing.Start(ctx, "etl.extract")
+	records, err := e.apiClient.(api.RangeExtractor).FetchRange(extractCtx, chunk.From, chunk.To)
+	span.SetAttributes(attribute.Int("etl.records", len(records)))
+	tracing.End(span, err)
+	if err != nil {
+		r.logger.Error(fmt.Sprintf("Extraction failed: %v", err))
+		e.finishRun(r, err)
+		return err
+	}
+	r.RecordsExtracted = len(records)
+
+	err = e.processBatch(ctx, r, records, nil, nil)
+	e.finishRun(r, err)
+	return err
+}
+
+// splitRange divides [from, to) into consecutive chunks of width chunk, the last
+// one ending at to
+func splitRange(from, to time.Time, chunk time.Duration) []BackfillChunk {
+	var chunks []BackfillChunk
+	for start := from; start.Before(to); start = start.Add(chunk) {
+		end := start.Add(chunk)
+		if end.After(to) {
+			end = to
+		}
+		chunks = append(chunks, BackfillChunk{From: start, To: end})
+	}
+	return chunks
+}
+
+// pendingChunks returns the chunks no run of the backfill loaded
+func pendingChunks(chunks []BackfillChunk, runs []database.PipelineRun) []BackfillChunk {
+	// Ranges are compared by instant, the database does not keep time zones
+	type key struct{ from, to int64 }
+	loaded := make(map[key]bool)
+	for _, r := range runs {
+		if r.RangeFrom == nil || r.RangeTo == nil {
+			continue
+		}
+		if r.Status == database.RunSucceeded || r.Status == database.RunPartial {
+			loaded[key{r.RangeFrom.UnixNano(), r.RangeTo.UnixNano()}] = true
+		}
+	}
+
+	var pending []BackfillChunk
+	for _, chunk := range chunks {
+		if !loaded[key{chunk.From.UnixNano(), chunk.To.UnixNano()}] {
+			pending = append(pending, chunk)
+		}
+	}
+	return pending
+}
+
+// ParseBound parses a bound of a backfill or replay range, a date or an RFC 3339
+// time. A date given as the end of a range includes that day.
+func ParseBound(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("missing, expected a date such as 2023-01-31 or an RFC 3339 time")
+	}
+	if t, err := time.Parse(dateLayout, value); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
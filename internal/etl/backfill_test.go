@@ -0,0 +1,46 @@
+package etl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+func TestSplitRange(t *testing.T) {
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	chunks := splitRange(from, from.AddDate(0, 0, 17), 7*24*time.Hour)
+
+	if len(chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", len(chunks))
+	}
+	if !chunks[1].From.Equal(from.AddDate(0, 0, 7)) || !chunks[1].To.Equal(from.AddDate(0, 0, 14)) {
+		t.Errorf("Unexpected second chunk: %+v", chunks[1])
+	}
+	// The last chunk is cut short at the end of the range
+	if !chunks[2].To.Equal(from.AddDate(0, 0, 17)) {
+		t.Errorf("Expected the last chunk to end on day 17, got %v", chunks[2].To)
+	}
+}
+
+func TestPendingChunks(t *testing.T) {
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	chunks := splitRange(from, from.AddDate(0, 0, 3), 24*time.Hour)
+
+	// The database returns ranges in another location; they still match by instant
+	local := time.FixedZone("", 0)
+	day := func(n int) *time.Time {
+		t := from.AddDate(0, 0, n).In(local)
+		return &t
+	}
+	runs := []database.PipelineRun{
+		{Status: database.RunSucceeded, RangeFrom: day(0), RangeTo: day(1)},
+		{Status: database.RunFailed, RangeFrom: day(1), RangeTo: day(2)},
+		{Status: database.RunPartial, RangeFrom: day(2), RangeTo: day(3)},
+	}
+
+	pending := pendingChunks(chunks, runs)
+	if len(pending) != 1 || !pending[0].From.Equal(*day(1)) {
+		t.Errorf("Expected only the failed second day to be pending, got %+v", pending)
+	}
+}
@@ -0,0 +1,32 @@
+package etl
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+// SetRawBlobs keeps the raw records of each batch in a content-addressed blob under
+// data/blobs, referenced from raw_data, instead of in both raw_data and a raw
+// snapshot. Batches kept during a database outage are inserted with their records
+// once it recovers.
+func (e *ETLService) SetRawBlobs(enabled bool) {
+	e.rawBlobs = enabled
+}
+
+// saveRawBlob stores a batch of raw records in a blob, as received when their
+// payloads were kept, and adds it to the run as its raw snapshot. It returns nil
+// when raw blobs are disabled.
+func (e *ETLService) saveRawBlob(r *run, rawData []map[string]interface{}, payloads []json.RawMessage) (*database.RawBlob, error) {
+	if !e.rawBlobs || len(rawData) == 0 {
+		return nil, nil
+	}
+	snapshot, err := e.storage.SaveRawBlob(rawData, payloads)
+	if err != nil {
+		return nil, err
+	}
+	r.snapshots = append(r.snapshots, snapshot)
+	e.metrics.DataSavedTotal.Inc()
+	return &database.RawBlob{Name: filepath.Base(snapshot.Path), Records: snapshot.Records, Hashes: rawHashes(rawData, payloads)}, nil
+}
@@ -0,0 +1,133 @@
+package etl
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// inFlightBudget bounds the records a streaming cycle holds between extraction and
+// loading. Extraction waits for the loader to release records once it is spent.
+type inFlightBudget struct {
+	maxRecords int
+	metrics    *metrics.Metrics
+	// starved is signalled when extraction starts waiting, so the loader flushes
+	// the batch it holds instead of waiting for more records
+	starved chan struct{}
+
+	mu      sync.Mutex
+	records int
+	bytes   int64
+	waiting int
+	// released is closed and replaced whenever records are released
+	released chan struct{}
+}
+
+// newInFlightBudget creates a budget of maxRecords records; zero is unbounded
+func newInFlightBudget(maxRecords int, metrics *metrics.Metrics) *inFlightBudget {
+	return &inFlightBudget{
+		maxRecords: maxRecords,
+		metrics:    metrics,
+		starved:    make(chan struct{}, 1),
+		released:   make(chan struct{}),
+	}
+}
+
+// acquire waits until records more fit the budget or ctx is done. A page larger
+// than the whole budget is let through once nothing else is in flight.
+func (b *inFlightBudget) acquire(ctx context.Context, records int, bytes int64) error {
+	var waited time.Time
+	for {
+		b.mu.Lock()
+		if b.maxRecords == 0 || b.records == 0 || b.records+records <= b.maxRecords {
+			b.records += records
+			b.bytes += bytes
+			b.report()
+			b.mu.Unlock()
+			if !waited.IsZero() {
+				b.metrics.StreamThrottledSeconds.Add(time.Since(waited).Seconds())
+			}
+			return nil
+		}
+		released := b.released
+		b.waiting++
+		b.mu.Unlock()
+
+		if waited.IsZero() {
+			waited = time.Now()
+		}
+		select {
+		case b.starved <- struct{}{}:
+		default:
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+		}
+		b.mu.Lock()
+		b.waiting--
+		b.mu.Unlock()
+		if ctx.Err() != nil {
+			b.metrics.StreamThrottledSeconds.Add(time.Since(waited).Seconds())
+			return ctx.Err()
+		}
+	}
+}
+
+// isStarved reports whether extraction waits for records to be released
+func (b *inFlightBudget) isStarved() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.waiting > 0
+}
+
+// release returns records to the budget once they are loaded
+func (b *inFlightBudget) release(records int, bytes int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.records -= records
+	b.bytes -= bytes
+	b.report()
+	close(b.released)
+	b.released = make(chan struct{})
+}
+
+// report updates the in-flight gauges, with b.mu held
+func (b *inFlightBudget) report() {
+	b.metrics.StreamInFlightRecords.Set(float64(b.records))
+	b.metrics.StreamInFlightBytes.Set(float64(b.bytes))
+}
+
+// approxSize estimates the size in bytes of the JSON encoding of a decoded value
+func approxSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		size := int64(2)
+		for key, item := range v {
+			size += int64(len(key)) + 4 + approxSize(item)
+		}
+		return size
+	case []map[string]interface{}:
+		size := int64(2)
+		for _, item := range v {
+			size += approxSize(item) + 1
+		}
+		return size
+	case []interface{}:
+		size := int64(2)
+		for _, item := range v {
+			size += approxSize(item) + 1
+		}
+		return size
+	case string:
+		return int64(len(v)) + 2
+	case nil:
+		return 4
+	case bool:
+		return 5
+	}
+	// Numbers and anything else
+	return 8
+}
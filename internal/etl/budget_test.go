@@ -0,0 +1,57 @@
+package etl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestInFlightBudgetThrottles(t *testing.T) {
+	budget := newInFlightBudget(10, metrics.NewMetrics())
+	ctx := context.Background()
+
+	// A page larger than the budget passes while nothing else is in flight
+	if err := budget.acquire(ctx, 25, 100); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- budget.acquire(ctx, 5, 20) }()
+	select {
+	case err := <-acquired:
+		t.Fatalf("Expected extraction to wait for the loader, got %v", err)
+	case <-budget.starved:
+	}
+	if !budget.isStarved() {
+		t.Error("Expected the budget to report extraction waiting")
+	}
+
+	budget.release(25, 100)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected extraction to resume once records were released")
+	}
+
+	// Extraction waiting for the budget stops with the cycle
+	cancelled, cancel := context.WithCancel(ctx)
+	go func() { acquired <- budget.acquire(cancelled, 10, 40) }()
+	<-budget.starved
+	cancel()
+	if err := <-acquired; err != context.Canceled {
+		t.Errorf("Expected the cancellation, got %v", err)
+	}
+}
+
+func TestApproxSize(t *testing.T) {
+	record := map[string]interface{}{"id": float64(1), "title": "abc", "tags": []interface{}{"x"}, "draft": false, "body": nil}
+	// {"id":1,"title":"abc","tags":["x"],"draft":false,"body":null} is 61 bytes
+	if size := approxSize(record); size < 50 || size > 80 {
+		t.Errorf("Expected an estimate close to 61 bytes, got %d", size)
+	}
+}
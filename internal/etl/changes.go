@@ -0,0 +1,131 @@
+package etl
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// ChangePublisher receives the change events of loaded batches
+type ChangePublisher interface {
+	PublishChanges(ctx context.Context, events []database.ChangeEvent) error
+}
+
+// SetChangePublisher publishes a change event for every processed record a batch
+// inserts or changes and every record the source deletes, found by comparing the
+// batch with the latest processed row of each source record
+func (e *ETLService) SetChangePublisher(publisher ChangePublisher) {
+	e.changes = publisher
+}
+
+// detectChanges returns the change events of a transformed batch before it is
+// stored, or nil without a change publisher. Records without a source id cannot
+// be compared and are left out. A failed lookup is counted and the batch loaded
+// without events.
+func (e *ETLService) detectChanges(ctx context.Context, r *run, transformedData *transform.TransformedData) []database.ChangeEvent {
+	if e.changes == nil {
+		return nil
+	}
+	sourceIDs := append([]string(nil), transformedData.Deleted...)
+	for _, record := range transformedData.Records {
+		if id := recordSourceID(record); id != "" {
+			sourceIDs = append(sourceIDs, id)
+		}
+	}
+	if len(sourceIDs) == 0 {
+		return nil
+	}
+	latest, err := e.db.LatestProcessed(ctx, sourceIDs)
+	if err != nil {
+		r.logger.Warn(fmt.Sprintf("Failed to look up processed records, publishing no change events for the batch: %v", err))
+		r.ErrorCount++
+		return nil
+	}
+	return diffChanges(latest, transformedData.Records, transformedData.Deleted, r.RunID, time.Now().UTC())
+}
+
+// diffChanges compares records and the source ids of deleted records with the
+// latest processed record of each source id, returning an insert for every record
+// without one, an update for every record with different fields and a delete for
+// every deleted record with one. Records repeated within the batch are compared
+// with their previous occurrence.
+func diffChanges(latest map[string]database.ProcessedRecord, records []database.ProcessedRecord, deleted []string, runID string, now time.Time) []database.ChangeEvent {
+	var events []database.ChangeEvent
+	for _, record := range records {
+		id := recordSourceID(record)
+		if id == "" {
+			continue
+		}
+		after := changeImage(record)
+		event := database.ChangeEvent{SourceID: id, Op: database.ChangeInsert, After: &after, RunID: runID, ChangedAt: now}
+		if before, ok := latest[id]; ok {
+			if sameFields(before, after) {
+				continue
+			}
+			before = changeImage(before)
+			event.Op = database.ChangeUpdate
+			event.Before = &before
+		}
+		latest[id] = after
+		events = append(events, event)
+	}
+	for _, id := range deleted {
+		before, ok := latest[id]
+		if !ok {
+			continue
+		}
+		before = changeImage(before)
+		events = append(events, database.ChangeEvent{SourceID: id, Op: database.ChangeDelete, Before: &before, RunID: runID, ChangedAt: now})
+		delete(latest, id)
+	}
+	return events
+}
+
+// changeImage returns the fields of a processed record without its lineage
+func changeImage(record database.ProcessedRecord) database.ProcessedRecord {
+	return database.ProcessedRecord{UserID: record.UserID, Title: record.Title, Body: record.Body, SourceTime: record.SourceTime}
+}
+
+// sameFields reports whether two processed records have the same fields
+func sameFields(a, b database.ProcessedRecord) bool {
+	if a.UserID != b.UserID || a.Title != b.Title || a.Body != b.Body {
+		return false
+	}
+	if a.SourceTime == nil || b.SourceTime == nil {
+		return a.SourceTime == b.SourceTime
+	}
+	return a.SourceTime.Equal(*b.SourceTime)
+}
+
+// publishChanges publishes the change events of a loaded batch. Inserts and
+// updates are dropped unless the processed records reached the database, and
+// deletes unless the deletions did. A failure is counted, not fatal.
+func (e *ETLService) publishChanges(ctx context.Context, r *run, events []database.ChangeEvent, loaded, deleted bool) {
+	if len(events) == 0 {
+		return
+	}
+	published := events[:0]
+	for _, event := range events {
+		if event.Op == database.ChangeDelete && deleted || event.Op != database.ChangeDelete && loaded {
+			published = append(published, event)
+		}
+	}
+	if len(published) < len(events) {
+		r.logger.Warn(fmt.Sprintf("Dropped %d change events of changes that did not reach the database", len(events)-len(published)))
+	}
+	if len(published) == 0 {
+		return
+	}
+	if err := e.changes.PublishChanges(ctx, published); err != nil {
+		r.logger.Error(fmt.Sprintf("Failed to publish %d change events: %v", len(published), err))
+		r.ErrorCount++
+		return
+	}
+	for _, event := range published {
+		e.metrics.ChangeEventsTotal.WithLabelValues(event.Op).Inc()
+	}
+	r.logger.Info(fmt.Sprintf("Published %d change events", len(published)))
+}
@@ -0,0 +1,58 @@
+package etl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+func TestDiffChanges(t *testing.T) {
+	record := func(id, title string) database.ProcessedRecord {
+		return database.ProcessedRecord{UserID: 1, Title: title, Lineage: &database.Lineage{SourceID: id, Line: 3}}
+	}
+	latest := map[string]database.ProcessedRecord{
+		"1": {UserID: 1, Title: "same"},
+		"2": {UserID: 1, Title: "old"},
+		"4": {UserID: 1, Title: "gone"},
+	}
+	records := []database.ProcessedRecord{
+		record("1", "same"),
+		record("2", "new"),
+		record("3", "first"),
+		record("3", "second"),
+		{UserID: 1, Title: "no source id"},
+	}
+	now := time.Date(2025, 10, 1, 13, 0, 0, 0, time.UTC)
+	events := diffChanges(latest, records, []string{"4", "5"}, "run", now)
+
+	want := []struct {
+		id, op, before, after string
+	}{
+		{"2", database.ChangeUpdate, "old", "new"},
+		{"3", database.ChangeInsert, "", "first"},
+		{"3", database.ChangeUpdate, "first", "second"},
+		{"4", database.ChangeDelete, "gone", ""},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %+v", len(want), events)
+	}
+	title := func(record *database.ProcessedRecord) string {
+		if record == nil {
+			return ""
+		}
+		if record.Lineage != nil {
+			t.Errorf("Expected change images without lineage, got %+v", record.Lineage)
+		}
+		return record.Title
+	}
+	for i, w := range want {
+		event := events[i]
+		if event.SourceID != w.id || event.Op != w.op || title(event.Before) != w.before || title(event.After) != w.after {
+			t.Errorf("Event %d: expected %+v, got %s %s %+v %+v", i, w, event.SourceID, event.Op, event.Before, event.After)
+		}
+		if event.RunID != "run" || !event.ChangedAt.Equal(now) {
+			t.Errorf("Event %d: unexpected run %q or time %v", i, event.RunID, event.ChangedAt)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package etl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/storage"
+)
+
+// beginCheckpoint saves the extracted batch of a run so a crash does not lose it,
+// reporting whether it was saved
+func (e *ETLService) beginCheckpoint(r *run, rawData []map[string]interface{}) bool {
+	checkpoint := storage.Checkpoint{
+		RunID:     r.RunID,
+		Trigger:   r.Trigger,
+		StartedAt: r.StartedAt,
+		Stage:     storage.StageExtracted,
+		Raw:       rawData,
+	}
+	if err := e.storage.SaveCheckpoint(checkpoint); err != nil {
+		r.logger.Error(fmt.Sprintf("Failed to save checkpoint, the run cannot be resumed: %v", err))
+		return false
+	}
+	r.checkpoint = &checkpoint
+	return true
+}
+
+// advanceCheckpoint records that a run reached stage, or loaded its batch into
+// more sinks. Runs without a checkpoint are left alone.
+func (e *ETLService) advanceCheckpoint(r *run, stage string, loadedSinks ...string) {
+	if r.checkpoint == nil {
+		return
+	}
+	checkpoint := *r.checkpoint
+	checkpoint.Stage = stage
+	checkpoint.LoadedSinks = append(slices.Clone(checkpoint.LoadedSinks), loadedSinks...)
+	if err := e.storage.SaveCheckpoint(checkpoint); err != nil {
+		// The older checkpoint stays, so a resume redoes this step
+		r.logger.Warn(fmt.Sprintf("Failed to update checkpoint: %v", err))
+		return
+	}
+	r.checkpoint = &checkpoint
+}
+
+// endCheckpoint removes the checkpoint of a completed run
+func (e *ETLService) endCheckpoint(r *run) {
+	if r.checkpoint == nil {
+		return
+	}
+	if err := e.storage.RemoveCheckpoint(r.RunID); err != nil {
+		r.logger.Error(err.Error())
+	}
+}
+
+// loadedSinks returns the sinks that already hold the processed records of a run
+func (r *run) loadedSinks() []string {
+	if r.checkpoint == nil {
+		return nil
+	}
+	return r.checkpoint.LoadedSinks
+}
+
+// resumeRuns completes the runs left incomplete by a crash or a failed cycle,
+// oldest first, continuing from their last checkpoint
+func (e *ETLService) resumeRuns(ctx context.Context) {
+	checkpoints, err := e.storage.Checkpoints()
+	if err != nil {
+		e.logger.Error(fmt.Sprintf("Failed to list checkpoints: %v", err))
+		return
+	}
+
+	for _, checkpoint := range checkpoints {
+		runCtx, r := e.resumeRun(ctx, checkpoint)
+		r.logger.Info(fmt.Sprintf("Resuming interrupted run from stage %s: %d records", checkpoint.Stage, len(checkpoint.Raw)))
+		r.RecordsExtracted = len(checkpoint.Raw)
+
+		err := e.processBatch(runCtx, r, checkpoint.Raw, nil, nil)
+		e.finishRun(r, err)
+		if err != nil {
+			// Keep later runs waiting so batches are loaded in order
+			r.logger.Warn(fmt.Sprintf("Resumed run failed, it will be resumed again next cycle: %v", err))
+			return
+		}
+		e.endCheckpoint(r)
+	}
+}
@@ -0,0 +1,402 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/api"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/storage"
+	"github.com/mohammedhassan/etl-pipeline/internal/tracing"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// Step types of a DAG pipeline
+const (
+	StepExtract   = "extract"
+	StepJoin      = "join"
+	StepTransform = "transform"
+	StepLoad      = "load"
+)
+
+// Join types
+const (
+	JoinInner = "inner"
+	JoinLeft  = "left"
+)
+
+// Step is a named step of a DAG pipeline
+type Step struct {
+	Name      string
+	Type      string
+	DependsOn []string
+	// Extractor fetches the records of an extract step; nil reads from the
+	// pipeline's own extractor
+	Extractor api.Extractor
+	// JoinKey and JoinType configure a join step, which merges the records of its
+	// dependencies, in order, into those of the first
+	JoinKey  string
+	JoinType string
+}
+
+// Batch is the output of a DAG step
+type Batch struct {
+	Records []map[string]interface{}
+	// Transformed is set by the transform step; Records then holds its input
+	Transformed *transform.TransformedData
+	// Partial marks batches built from an extraction cut short by the cycle budget
+	Partial bool
+}
+
+// size returns the number of records a step produced
+func (b *Batch) size() int {
+	if b.Transformed != nil {
+		return len(b.Transformed.Records)
+	}
+	return len(b.Records)
+}
+
+// DAG is a pipeline of named steps run in dependency order. Extract steps fetch
+// records, join steps combine them, and a transform step followed by a load step
+// ends the pipeline.
+type DAG struct {
+	steps []*Step
+	// levels groups steps by depth; the steps of a level only depend on earlier
+	// levels and run concurrently
+	levels [][]*Step
+	load   *Step
+}
+
+// stepFunc runs a step on the outputs of its dependencies, in DependsOn order
+type stepFunc func(ctx context.Context, step *Step, inputs []*Batch) (*Batch, error)
+
+// stepObserver is told about each finished step
+type stepObserver func(step *Step, output *Batch, duration time.Duration, err error)
+
+// NewDAG validates the steps of a pipeline and orders them by their dependencies
+func NewDAG(steps []Step) (*DAG, error) {
+	d := &DAG{}
+	byName := make(map[string]*Step, len(steps))
+	sourceSteps := 0
+	for i := range steps {
+		step := &steps[i]
+		if step.Name == "" {
+			return nil, fmt.Errorf("step %d has no name", i+1)
+		}
+		if byName[step.Name] != nil {
+			return nil, fmt.Errorf("step %s is defined twice", step.Name)
+		}
+		byName[step.Name] = step
+		d.steps = append(d.steps, step)
+
+		switch step.Type {
+		case StepExtract:
+			if len(step.DependsOn) > 0 {
+				return nil, fmt.Errorf("extract step %s cannot depend on other steps", step.Name)
+			}
+			if step.Extractor == nil {
+				sourceSteps++
+			}
+		case StepJoin:
+			if len(step.DependsOn) < 2 {
+				return nil, fmt.Errorf("join step %s needs at least two dependencies", step.Name)
+			}
+			if step.JoinKey == "" {
+				return nil, fmt.Errorf("join step %s has no key", step.Name)
+			}
+			if step.JoinType == "" {
+				step.JoinType = JoinInner
+			}
+			if step.JoinType != JoinInner && step.JoinType != JoinLeft {
+				return nil, fmt.Errorf("join step %s: unknown join %q, expected %s or %s", step.Name, step.JoinType, JoinInner, JoinLeft)
+			}
+		case StepTransform, StepLoad:
+			if len(step.DependsOn) != 1 {
+				return nil, fmt.Errorf("%s step %s needs exactly one dependency", step.Type, step.Name)
+			}
+			if step.Type == StepLoad {
+				if d.load != nil {
+					return nil, fmt.Errorf("steps %s and %s both load, a pipeline has one load step", d.load.Name, step.Name)
+				}
+				d.load = step
+			}
+		default:
+			return nil, fmt.Errorf("step %s: unknown type %q, expected %s, %s, %s or %s", step.Name, step.Type, StepExtract, StepJoin, StepTransform, StepLoad)
+		}
+	}
+	if sourceSteps > 1 {
+		return nil, fmt.Errorf("%d extract steps read from the pipeline source, at most one may", sourceSteps)
+	}
+	if d.load == nil {
+		return nil, fmt.Errorf("no load step")
+	}
+
+	// Check the edges: only the load step consumes transformed records, and it
+	// consumes nothing else; every other step feeds a later one
+	used := make(map[string]bool, len(steps))
+	for _, step := range d.steps {
+		for _, name := range step.DependsOn {
+			dep := byName[name]
+			switch {
+			case dep == nil:
+				return nil, fmt.Errorf("step %s depends on unknown step %s", step.Name, name)
+			case dep == step:
+				return nil, fmt.Errorf("step %s depends on itself", step.Name)
+			case dep.Type == StepLoad:
+				return nil, fmt.Errorf("step %s depends on the load step %s", step.Name, name)
+			case (dep.Type == StepTransform) != (step.Type == StepLoad):
+				return nil, fmt.Errorf("step %s cannot depend on %s step %s, the load step reads the transform step", step.Name, dep.Type, name)
+			}
+			used[name] = true
+		}
+	}
+	for _, step := range d.steps {
+		if step != d.load && !used[step.Name] {
+			return nil, fmt.Errorf("the output of step %s is not used by any step", step.Name)
+		}
+	}
+
+	// Group steps into levels; steps left over are part of a cycle
+	placed := make(map[string]bool, len(steps))
+	for len(placed) < len(d.steps) {
+		var level []*Step
+		for _, step := range d.steps {
+			if placed[step.Name] {
+				continue
+			}
+			ready := true
+			for _, name := range step.DependsOn {
+				ready = ready && placed[name]
+			}
+			if ready {
+				level = append(level, step)
+			}
+		}
+		if len(level) == 0 {
+			var cycle []string
+			for _, step := range d.steps {
+				if !placed[step.Name] {
+					cycle = append(cycle, step.Name)
+				}
+			}
+			return nil, fmt.Errorf("steps %s depend on each other in a cycle", strings.Join(cycle, ", "))
+		}
+		for _, step := range level {
+			placed[step.Name] = true
+		}
+		d.levels = append(d.levels, level)
+	}
+	return d, nil
+}
+
+// String lists the steps level by level, e.g. "orders, customers -> joined -> transform -> load"
+func (d *DAG) String() string {
+	levels := make([]string, len(d.levels))
+	for i, level := range d.levels {
+		names := make([]string, len(level))
+		for j, step := range level {
+			names[j] = step.Name
+		}
+		levels[i] = strings.Join(names, ", ")
+	}
+	return strings.Join(levels, " -> ")
+}
+
+// run runs the steps level by level and returns the batch of the load step. The
+// first failing level stops the run; steps running alongside the failed one finish.
+func (d *DAG) run(ctx context.Context, exec stepFunc, observe stepObserver) (*Batch, error) {
+	outputs := make(map[string]*Batch, len(d.steps))
+	for _, level := range d.levels {
+		results := make([]*Batch, len(level))
+		errs := make([]error, len(level))
+		var wg sync.WaitGroup
+		for i, step := range level {
+			inputs := make([]*Batch, len(step.DependsOn))
+			for j, name := range step.DependsOn {
+				inputs[j] = outputs[name]
+			}
+			wg.Add(1)
+			go func(i int, step *Step) {
+				defer wg.Done()
+				start := time.Now()
+				defer func() {
+					if r := recover(); r != nil {
+						errs[i] = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+					}
+					if observe != nil {
+						observe(step, results[i], time.Since(start), errs[i])
+					}
+				}()
+				results[i], errs[i] = exec(ctx, step, inputs)
+			}(i, step)
+		}
+		wg.Wait()
+
+		for i, step := range level {
+			if errs[i] != nil {
+				return nil, fmt.Errorf("step %s failed: %w", step.Name, errs[i])
+			}
+			outputs[step.Name] = results[i]
+		}
+	}
+	return outputs[d.load.Name], nil
+}
+
+// runStep runs an extract, join or transform step. Extract steps without an
+// extractor read from source.
+func runStep(extractCtx context.Context, step *Step, inputs []*Batch, source api.Extractor, transformer *transform.Transformer) (*Batch, error) {
+	switch step.Type {
+	case StepExtract:
+		extractor := step.Extractor
+		if extractor == nil {
+			extractor = source
+		}
+		records, err := extractor.FetchData(extractCtx)
+		if errors.Is(err, api.ErrPartial) && len(records) > 0 {
+			return &Batch{Records: records, Partial: true}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Batch{Records: records}, nil
+	case StepJoin:
+		return join(step.JoinKey, step.JoinType, inputs), nil
+	case StepTransform:
+		transformed, err := transformer.Transform(inputs[0].Records)
+		if err != nil {
+			return nil, err
+		}
+		return &Batch{Records: inputs[0].Records, Transformed: transformed, Partial: inputs[0].Partial}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s step", step.Type)
+}
+
+// join merges the records of later inputs into those of the first with the same
+// key value. Fields a record already has are kept. An inner join drops records
+// without a match in every other input, a left join keeps them.
+func join(key, joinType string, inputs []*Batch) *Batch {
+	out := &Batch{Partial: inputs[0].Partial}
+	indexes := make([]map[string]map[string]interface{}, 0, len(inputs)-1)
+	for _, input := range inputs[1:] {
+		index := make(map[string]map[string]interface{}, len(input.Records))
+		for _, record := range input.Records {
+			if value, ok := record[key]; ok && value != nil {
+				// The first record of a key wins
+				if _, dup := index[fmt.Sprint(value)]; !dup {
+					index[fmt.Sprint(value)] = record
+				}
+			}
+		}
+		indexes = append(indexes, index)
+		out.Partial = out.Partial || input.Partial
+	}
+
+	for _, record := range inputs[0].Records {
+		joined := maps.Clone(record)
+		value, hasKey := record[key]
+		hasKey = hasKey && value != nil
+		matchedAll := hasKey
+		for _, index := range indexes {
+			match, found := index[fmt.Sprint(value)]
+			if !hasKey || !found {
+				matchedAll = false
+				continue
+			}
+			for field, v := range match {
+				if _, exists := joined[field]; !exists {
+					joined[field] = v
+				}
+			}
+		}
+		if matchedAll || joinType == JoinLeft {
+			out.Records = append(out.Records, joined)
+		}
+	}
+	return out
+}
+
+// SetDAG runs scheduled cycles through the steps of dag instead of the fixed
+// extract, transform and load sequence
+func (e *ETLService) SetDAG(dag *DAG) {
+	e.dag = dag
+}
+
+// runDAG runs the steps of a cycle, binding extract steps to extractCtx, and
+// reports whether extraction was cut short
+func (e *ETLService) runDAG(ctx, extractCtx context.Context, r *run) (bool, error) {
+	batch, err := e.dag.run(ctx, func(ctx context.Context, step *Step, inputs []*Batch) (output *Batch, err error) {
+		ctx, span := tracing.Start(ctx, "etl.step", attribute.String("etl.step", step.Name), attribute.String("etl.step_type", step.Type))
+		defer func() { tracing.End(span, err) }()
+		if step.Type == StepLoad {
+			return inputs[0], e.loadStep(ctx, r, inputs[0])
+		}
+		// Extract steps keep the deadline of extractCtx under the span of the step
+		return runStep(trace.ContextWithSpan(extractCtx, span), step, inputs, e.apiClient, e.transformer.Load())
+	}, func(step *Step, output *Batch, duration time.Duration, err error) {
+		metrics.ObserveWithTrace(ctx, e.metrics.StepDuration.WithLabelValues(step.Name), duration.Seconds())
+		if err != nil {
+			e.metrics.StepFailuresTotal.WithLabelValues(step.Name).Inc()
+			r.logger.Error(fmt.Sprintf("Step %s failed after %.2fs: %v", step.Name, duration.Seconds(), err))
+			return
+		}
+		e.metrics.StepRecordsTotal.WithLabelValues(step.Name).Add(float64(output.size()))
+		r.logger.Info(fmt.Sprintf("Step %s completed in %.2fs: %d records", step.Name, duration.Seconds(), output.size()))
+	})
+	if err != nil {
+		return false, err
+	}
+	if batch.Partial {
+		r.logger.Warn(fmt.Sprintf("Extraction stopped by the cycle budget, loaded %d records fetched so far", len(batch.Records)))
+	}
+	return batch.Partial, nil
+}
+
+// loadStep stores the raw records of a transformed batch and loads its processed
+// records, as a cycle extracting from a single source does
+func (e *ETLService) loadStep(ctx context.Context, r *run, batch *Batch) error {
+	r.RecordsExtracted = len(batch.Records)
+	onDurable := e.commitExtraction
+	if e.checkpoints && e.beginCheckpoint(r, batch.Records) {
+		e.commitExtraction()
+		onDurable = nil
+	}
+	e.countTransformed(r, len(batch.Records), batch.Transformed)
+	hashes := rawHashes(batch.Records, nil)
+	if e.transactional {
+		e.traceLineage(batch.Transformed.Records, hashes, nil)
+		return e.storeAtomic(ctx, r, batch.Records, nil, batch.Transformed, onDurable)
+	}
+
+	var pending storage.PendingBatch
+	ids, onDurable, err := e.storeRaw(ctx, r, batch.Records, nil, batch.Transformed, onDurable, &pending)
+	if err != nil {
+		return err
+	}
+	e.traceLineage(batch.Transformed.Records, hashes, ids)
+	e.loadTransformed(ctx, r, batch.Transformed, &pending, onDurable)
+	return nil
+}
+
+// DryRunDAG runs the steps of dag up to the load step and summarizes what it would
+// write. Extract steps without an extractor read from source.
+func DryRunDAG(ctx context.Context, dag *DAG, source api.Extractor, transformer *transform.Transformer, rawTargets, processedTargets []string) (*DryRunSummary, error) {
+	batch, err := dag.run(ctx, func(ctx context.Context, step *Step, inputs []*Batch) (*Batch, error) {
+		if step.Type == StepLoad {
+			return inputs[0], nil
+		}
+		return runStep(ctx, step, inputs, source, transformer)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return summarize(batch.Records, batch.Transformed, batch.Partial, rawTargets, processedTargets), nil
+}
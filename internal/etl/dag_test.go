@@ -0,0 +1,129 @@
+package etl
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+func TestNewDAG(t *testing.T) {
+	posts := staticExtractor{}
+	users := staticExtractor{}
+	dag, err := NewDAG([]Step{
+		{Name: "load", Type: StepLoad, DependsOn: []string{"transform"}},
+		{Name: "posts", Type: StepExtract, Extractor: posts},
+		{Name: "users", Type: StepExtract, Extractor: users},
+		{Name: "joined", Type: StepJoin, DependsOn: []string{"posts", "users"}, JoinKey: "userId"},
+		{Name: "transform", Type: StepTransform, DependsOn: []string{"joined"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := dag.String(); got != "posts, users -> joined -> transform -> load" {
+		t.Errorf("Unexpected order: %s", got)
+	}
+
+	tests := []struct {
+		name  string
+		steps []Step
+		want  string
+	}{
+		{"no load", []Step{
+			{Name: "posts", Type: StepExtract, Extractor: posts},
+			{Name: "transform", Type: StepTransform, DependsOn: []string{"posts"}},
+		}, "no load step"},
+		{"unknown dependency", []Step{
+			{Name: "transform", Type: StepTransform, DependsOn: []string{"posts"}},
+			{Name: "load", Type: StepLoad, DependsOn: []string{"transform"}},
+		}, "unknown step posts"},
+		{"load without transform", []Step{
+			{Name: "posts", Type: StepExtract, Extractor: posts},
+			{Name: "load", Type: StepLoad, DependsOn: []string{"posts"}},
+		}, "cannot depend on extract step posts"},
+		{"unused step", []Step{
+			{Name: "posts", Type: StepExtract, Extractor: posts},
+			{Name: "users", Type: StepExtract, Extractor: users},
+			{Name: "transform", Type: StepTransform, DependsOn: []string{"posts"}},
+			{Name: "load", Type: StepLoad, DependsOn: []string{"transform"}},
+		}, "step users is not used"},
+		{"cycle", []Step{
+			{Name: "posts", Type: StepExtract, Extractor: posts},
+			{Name: "a", Type: StepJoin, DependsOn: []string{"posts", "b"}, JoinKey: "id"},
+			{Name: "b", Type: StepJoin, DependsOn: []string{"posts", "a"}, JoinKey: "id"},
+			{Name: "transform", Type: StepTransform, DependsOn: []string{"b"}},
+			{Name: "load", Type: StepLoad, DependsOn: []string{"transform"}},
+		}, "cycle"},
+		{"two source steps", []Step{
+			{Name: "posts", Type: StepExtract},
+			{Name: "users", Type: StepExtract},
+			{Name: "joined", Type: StepJoin, DependsOn: []string{"posts", "users"}, JoinKey: "userId"},
+			{Name: "transform", Type: StepTransform, DependsOn: []string{"joined"}},
+			{Name: "load", Type: StepLoad, DependsOn: []string{"transform"}},
+		}, "at most one may"},
+	}
+	for _, tt := range tests {
+		if _, err := NewDAG(tt.steps); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	posts := &Batch{Records: []map[string]interface{}{
+		{"id": float64(1), "userId": float64(1), "title": "First"},
+		{"id": float64(2), "userId": float64(2), "title": "Second"},
+		{"id": float64(3), "title": "No user"},
+	}}
+	users := &Batch{Records: []map[string]interface{}{
+		{"userId": float64(1), "name": "Ada", "title": "Countess"},
+	}, Partial: true}
+
+	inner := join("userId", JoinInner, []*Batch{posts, users})
+	if len(inner.Records) != 1 || inner.Records[0]["name"] != "Ada" || inner.Records[0]["title"] != "First" {
+		t.Errorf("Unexpected inner join: %v", inner.Records)
+	}
+	if !inner.Partial {
+		t.Error("Expected a join of a partial input to be partial")
+	}
+	left := join("userId", JoinLeft, []*Batch{posts, users})
+	if len(left.Records) != 3 || left.Records[1]["name"] != nil {
+		t.Errorf("Unexpected left join: %v", left.Records)
+	}
+	if _, ok := posts.Records[0]["name"]; ok {
+		t.Error("Expected the join to leave its input records unchanged")
+	}
+}
+
+func TestDryRunDAG(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+	transformer := transform.NewTransformer(logger, metrics.NewMetrics())
+
+	posts := staticExtractor{
+		{"id": float64(1), "userId": float64(1), "title": "First", "body": "Body"},
+		{"id": float64(2), "userId": float64(2), "title": "Second", "body": "Body"},
+	}
+	users := staticExtractor{{"userId": float64(1), "name": "Ada"}}
+	dag, err := NewDAG([]Step{
+		{Name: "posts", Type: StepExtract},
+		{Name: "users", Type: StepExtract, Extractor: users},
+		{Name: "joined", Type: StepJoin, DependsOn: []string{"posts", "users"}, JoinKey: "userId"},
+		{Name: "transform", Type: StepTransform, DependsOn: []string{"joined"}},
+		{Name: "load", Type: StepLoad, DependsOn: []string{"transform"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	summary, err := DryRunDAG(context.Background(), dag, posts, transformer, []string{"raw_data table"}, []string{"kafka sink"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if summary.Extracted != 1 || summary.Transformed != 1 || summary.Sample[0].Title != "First" {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+}
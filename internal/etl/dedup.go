@@ -0,0 +1,111 @@
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/cache"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// SetDedup skips processed records whose source record was loaded with the same
+// fields within ttl, which must be positive. The dedup key set in store holds a
+// hash of the fields of each loaded source record by its source id, each key
+// expiring ttl after the record was last loaded.
+func (e *ETLService) SetDedup(store cache.Cache, ttl time.Duration) {
+	e.dedup = store
+	e.dedupTTL = ttl
+}
+
+// skipDuplicates removes from a transformed batch the records loaded unchanged
+// before and the repeats of a record within it, counting them in the run, and
+// returns the dedup keys of the records kept, to be set once they are loaded.
+// Records without a source id are kept, and replays and reprocessing, which
+// rebuild processed data, load every record. A failed lookup is counted and the
+// batch loaded whole.
+func (e *ETLService) skipDuplicates(ctx context.Context, r *run, transformedData *transform.TransformedData) map[string]string {
+	if e.dedup == nil || r.Trigger == triggerReplay || r.Trigger == triggerReprocess {
+		return nil
+	}
+	var sourceIDs []string
+	for _, record := range transformedData.Records {
+		if id := recordSourceID(record); id != "" {
+			sourceIDs = append(sourceIDs, id)
+		}
+	}
+	if len(sourceIDs) == 0 {
+		return nil
+	}
+	loaded, err := e.dedup.Get(ctx, sourceIDs...)
+	if err != nil {
+		r.logger.Warn(fmt.Sprintf("Failed to look up the dedup key set, loading the whole batch: %v", err))
+		r.ErrorCount++
+		loaded = make(map[string]string)
+	}
+
+	keys := make(map[string]string, len(sourceIDs))
+	kept := make([]database.ProcessedRecord, 0, len(transformedData.Records))
+	for _, record := range transformedData.Records {
+		id := recordSourceID(record)
+		if id == "" {
+			kept = append(kept, record)
+			continue
+		}
+		hash := fieldsHash(record)
+		if loaded[id] == hash {
+			continue
+		}
+		loaded[id] = hash
+		keys[id] = hash
+		kept = append(kept, record)
+	}
+	if skipped := len(transformedData.Records) - len(kept); skipped > 0 {
+		e.metrics.DuplicatesSkippedTotal.Add(float64(skipped))
+		r.duplicates += skipped
+		r.logger.Info(fmt.Sprintf("Skipped %d of %d processed records loaded unchanged within %v", skipped, len(transformedData.Records), e.dedupTTL))
+		transformedData.Records = kept
+	}
+	return keys
+}
+
+// markLoaded adds the dedup keys of loaded records to the key set. A failure is
+// counted, not fatal; the records are loaded again next time they are extracted.
+func (e *ETLService) markLoaded(ctx context.Context, r *run, keys map[string]string) {
+	if len(keys) == 0 {
+		return
+	}
+	if err := e.dedup.Set(ctx, keys, e.dedupTTL); err != nil {
+		r.logger.Warn(fmt.Sprintf("Failed to update the dedup key set: %v", err))
+		r.ErrorCount++
+	}
+}
+
+// forgetDeleted removes the source records deleted from the dedup key set, so they
+// are loaded again if the source brings them back. A failure is counted, not fatal.
+func (e *ETLService) forgetDeleted(ctx context.Context, r *run, deleted []string) {
+	if e.dedup == nil || len(deleted) == 0 {
+		return
+	}
+	if err := e.dedup.Delete(ctx, deleted...); err != nil {
+		r.logger.Warn(fmt.Sprintf("Failed to remove deleted records from the dedup key set: %v", err))
+		r.ErrorCount++
+	}
+}
+
+// recordSourceID returns the source id of a processed record, empty if unknown
+func recordSourceID(record database.ProcessedRecord) string {
+	if record.Lineage == nil {
+		return ""
+	}
+	return record.Lineage.SourceID
+}
+
+// fieldsHash returns a hash of the fields of a processed record, which change
+// events compare too
+func fieldsHash(record database.ProcessedRecord) string {
+	image, _ := json.Marshal(changeImage(record))
+	return database.PayloadHash(image)
+}
@@ -0,0 +1,87 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/cache"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// failingCache is a cache whose server is down
+type failingCache struct{ *cache.Memory }
+
+func (failingCache) Get(ctx context.Context, keys ...string) (map[string]string, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestSkipDuplicates(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+	e := NewETLService(nil, nil, nil, nil, nil, logger, metrics.NewMetrics(), nil)
+	store := cache.NewMemory()
+	e.SetDedup(store, time.Hour)
+	r := &run{PipelineRun: database.PipelineRun{Trigger: triggerSchedule}, logger: logger}
+
+	record := func(id, title string) database.ProcessedRecord {
+		return database.ProcessedRecord{UserID: 1, Title: title, Lineage: &database.Lineage{SourceID: id}}
+	}
+	batch := func() *transform.TransformedData {
+		return &transform.TransformedData{Records: []database.ProcessedRecord{
+			record("1", "same"),
+			record("2", "changed"),
+			record("3", "first"),
+			record("3", "first"),
+			{UserID: 1, Title: "no source id"},
+		}}
+	}
+	store.Set(context.Background(), map[string]string{
+		"1": fieldsHash(record("1", "same")),
+		"2": fieldsHash(record("2", "old")),
+	}, time.Hour)
+
+	data := batch()
+	keys := e.skipDuplicates(context.Background(), r, data)
+	var titles []string
+	for _, kept := range data.Records {
+		titles = append(titles, kept.Title)
+	}
+	if len(titles) != 3 || titles[0] != "changed" || titles[1] != "first" || titles[2] != "no source id" {
+		t.Fatalf("Expected the unchanged record and the repeat to be skipped, got %v", titles)
+	}
+	if len(keys) != 2 || keys["2"] != fieldsHash(record("2", "changed")) || keys["3"] != fieldsHash(record("3", "first")) {
+		t.Errorf("Expected the keys of the records kept, got %v", keys)
+	}
+
+	if r.duplicates != 2 {
+		t.Errorf("Expected the run to count 2 skipped records, got %d", r.duplicates)
+	}
+
+	// The keys are set once the records are loaded, and deletes forget them
+	e.markLoaded(context.Background(), r, keys)
+	e.forgetDeleted(context.Background(), r, []string{"1"})
+	data = batch()
+	e.skipDuplicates(context.Background(), r, data)
+	if len(data.Records) != 2 || data.Records[0].Title != "same" {
+		t.Errorf("Expected the loaded records to be skipped and the deleted one loaded, got %+v", data.Records)
+	}
+
+	// Replays load every record
+	data = batch()
+	replay := &run{PipelineRun: database.PipelineRun{Trigger: triggerReplay}, logger: logger}
+	if keys := e.skipDuplicates(context.Background(), replay, data); keys != nil || len(data.Records) != 5 {
+		t.Errorf("Expected a replay to load every record, got %d", len(data.Records))
+	}
+
+	// A failed lookup loads the batch but its repeats
+	e.SetDedup(failingCache{cache.NewMemory()}, time.Hour)
+	data = batch()
+	if e.skipDuplicates(context.Background(), r, data); len(data.Records) != 4 || r.ErrorCount != 1 {
+		t.Errorf("Expected the batch to be loaded after a failed lookup, got %d records and %d errors", len(data.Records), r.ErrorCount)
+	}
+}
@@ -0,0 +1,42 @@
+package etl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+// SetDeleteMode sets how the processed records of source records the delete rule
+// of the transformer marks as deleted are removed, one of database.DeleteModes;
+// soft-delete by default
+func (e *ETLService) SetDeleteMode(mode string) error {
+	if !slices.Contains(database.DeleteModes, mode) {
+		return fmt.Errorf("unknown delete mode %q", mode)
+	}
+	e.deleteMode = mode
+	return nil
+}
+
+// applyDeletes removes the processed records of the source records with the given
+// ids from processed_data. A failure is counted, not fatal: the records are
+// deleted once the source reports them again. It returns the failure, if any.
+func (e *ETLService) applyDeletes(ctx context.Context, r *run, sourceIDs []string) error {
+	if len(sourceIDs) == 0 {
+		return nil
+	}
+	ctx, endStore := e.beginStage(ctx, r.logger, stageStore, e.stageTimeouts.Store)
+	defer endStore()
+
+	rows, err := e.db.DeleteProcessed(ctx, r.RunID, e.deleteMode, sourceIDs)
+	if err != nil {
+		e.metrics.DatabaseWriteErrorsTotal.WithLabelValues(database.ErrorReason(err)).Inc()
+		r.logger.Error(fmt.Sprintf("Failed to remove %d records deleted by the source: %v", len(sourceIDs), err))
+		r.ErrorCount++
+		return err
+	}
+	e.metrics.SourceDeletesTotal.WithLabelValues(e.deleteMode).Add(float64(rows))
+	r.logger.Info(fmt.Sprintf("Removed %d records deleted by the source (%s): %d processed rows", len(sourceIDs), e.deleteMode, rows))
+	return nil
+}
@@ -0,0 +1,45 @@
+package etl
+
+import (
+	"fmt"
+	"time"
+)
+
+// SetDrainTimeout sets how long shutdown waits for a running cycle to finish before
+// cancelling it; zero cancels it right away
+func (e *ETLService) SetDrainTimeout(timeout time.Duration) {
+	e.drainTimeout = timeout
+}
+
+// drain lets a cycle running at shutdown finish within the drain timeout, then
+// cancels it. A cancelled run keeps its checkpoint, if it saved one, and is
+// resumed by the next start. It returns the result of the cycle and whether it
+// finished rather than being cut off.
+func (e *ETLService) drain(running *cycle) (cycleResult, bool) {
+	if e.drainTimeout > 0 {
+		e.logger.Info(fmt.Sprintf("Shutting down, waiting up to %v for the running cycle to finish", e.drainTimeout))
+		timer := time.NewTimer(e.drainTimeout)
+		defer timer.Stop()
+		select {
+		case result := <-running.done:
+			running.finish(result)
+			e.logger.Info("Running cycle finished, nothing left to drain")
+			return result, true
+		case <-timer.C:
+		}
+	}
+
+	e.logger.Warn("Shutting down, cancelling the running cycle")
+	running.cancel()
+	e.metrics.CyclesCancelledTotal.WithLabelValues("shutdown").Inc()
+	result := running.wait()
+	if result.err == nil {
+		return result, true
+	}
+	if e.checkpoints {
+		e.logger.Warn("Cancelled cycle will be resumed from its checkpoint on the next start")
+	} else {
+		e.logger.Warn("Cancelled cycle did not commit its extraction progress, its batch will be fetched again on the next start")
+	}
+	return result, false
+}
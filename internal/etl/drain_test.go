@@ -0,0 +1,42 @@
+package etl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestDrain(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	e := NewETLService(nil, nil, nil, nil, nil, logger, metrics.NewMetrics(), nil)
+	e.SetDrainTimeout(time.Second)
+
+	// A cycle finishing within the timeout is not cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	running := &cycle{cancel: cancel, done: make(chan cycleResult, 1)}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		running.done <- cycleResult{}
+	}()
+	e.drain(running)
+	if ctx.Err() == nil {
+		t.Error("Expected the drained cycle to be released")
+	}
+
+	// A cycle still running after the timeout is cancelled
+	e.SetDrainTimeout(10 * time.Millisecond)
+	ctx, cancel = context.WithCancel(context.Background())
+	running = &cycle{cancel: cancel, done: make(chan cycleResult, 1)}
+	go func() {
+		<-ctx.Done()
+		running.done <- cycleResult{err: ctx.Err()}
+	}()
+	start := time.Now()
+	e.drain(running)
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Expected the cycle to be cancelled after the drain timeout, cancelled after %v", elapsed)
+	}
+}
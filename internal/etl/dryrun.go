@@ -0,0 +1,153 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/api"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// dryRunSample is the number of processed records shown in a dry-run summary
+const dryRunSample = 5
+
+// ErrDryRun is returned by operations that would write while the service is in dry-run mode
+var ErrDryRun = errors.New("dry-run mode, writes are disabled")
+
+// DryRunWrite is a write a dry run skipped: the records a table, file or sink
+// would have received
+type DryRunWrite struct {
+	Target  string `json:"target"`
+	Records int    `json:"records"`
+}
+
+// DryRunSummary describes what a cycle would have written
+type DryRunSummary struct {
+	Extracted   int `json:"extracted"`
+	Transformed int `json:"transformed"`
+	Rejected    int `json:"rejected"`
+	// Deleted counts the records the source marks as deleted
+	Deleted int  `json:"deleted"`
+	Audits  int  `json:"audits"`
+	Partial bool `json:"partial"`
+	// Writes lists the skipped writes in the order the pipeline would make them
+	Writes []DryRunWrite `json:"writes"`
+	// Sample holds the first processed records
+	Sample []database.ProcessedRecord `json:"sample"`
+}
+
+// String formats the summary for logs and the terminal
+func (s *DryRunSummary) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dry run: extracted %d records, transformed %d, rejected %d, %d audited changes", s.Extracted, s.Transformed, s.Rejected, s.Audits)
+	if s.Deleted > 0 {
+		fmt.Fprintf(&b, ", %d marked as deleted", s.Deleted)
+	}
+	if s.Partial {
+		b.WriteString(" (extraction incomplete)")
+	}
+	for _, write := range s.Writes {
+		fmt.Fprintf(&b, "\n  would write %d records to %s", write.Records, write.Target)
+	}
+	return b.String()
+}
+
+// DryRun extracts and transforms one batch without writing anything. targets name
+// the destinations of raw and processed records, which are listed in the summary.
+// Extraction progress is not committed, so the batch is fetched again by a real cycle.
+func DryRun(ctx context.Context, extractor api.Extractor, transformer *transform.Transformer, rawTargets, processedTargets []string) (*DryRunSummary, error) {
+	partial := false
+	rawData, err := extractor.FetchData(ctx)
+	switch {
+	case errors.Is(err, api.ErrPartial) && len(rawData) > 0:
+		partial = true
+	case err != nil:
+		return nil, fmt.Errorf("extraction failed: %w", err)
+	}
+
+	transformed, err := transformer.Transform(rawData)
+	if err != nil {
+		return nil, fmt.Errorf("transformation failed: %w", err)
+	}
+	return summarize(rawData, transformed, partial, rawTargets, processedTargets), nil
+}
+
+// summarize describes the writes a cycle would make for a transformed batch
+func summarize(rawData []map[string]interface{}, transformed *transform.TransformedData, partial bool, rawTargets, processedTargets []string) *DryRunSummary {
+	summary := &DryRunSummary{
+		Extracted:   len(rawData),
+		Transformed: len(transformed.Records),
+		Rejected:    len(rawData) - len(transformed.Records) - len(transformed.Deleted),
+		Deleted:     len(transformed.Deleted),
+		Audits:      len(transformed.Audits),
+		Partial:     partial,
+		Sample:      transformed.Records[:min(dryRunSample, len(transformed.Records))],
+	}
+	for _, target := range rawTargets {
+		summary.Writes = append(summary.Writes, DryRunWrite{Target: target, Records: len(rawData)})
+	}
+	if summary.Audits > 0 {
+		summary.Writes = append(summary.Writes, DryRunWrite{Target: "transform_audit table", Records: summary.Audits})
+	}
+	for _, target := range processedTargets {
+		summary.Writes = append(summary.Writes, DryRunWrite{Target: target, Records: summary.Transformed})
+	}
+	if summary.Deleted > 0 {
+		summary.Writes = append(summary.Writes, DryRunWrite{Target: "processed_data deletions", Records: summary.Deleted})
+	}
+	return summary
+}
+
+// SetDryRun makes scheduled cycles dry runs and rejects ingests and backfills
+func (e *ETLService) SetDryRun(dryRun bool) {
+	e.dryRun = dryRun
+}
+
+// DryRunMode reports whether the service is in dry-run mode
+func (e *ETLService) DryRunMode() bool {
+	return e.dryRun
+}
+
+// DryRun extracts and transforms one batch as a cycle would, without writing it
+func (e *ETLService) DryRun(ctx context.Context) (*DryRunSummary, error) {
+	// Extractors tracking progress keep it until the next commit, which a dry
+	// run must not slip in before
+	e.extractMu.Lock()
+	defer e.extractMu.Unlock()
+
+	rawTargets := []string{"raw_data table", "raw snapshot"}
+	var processedTargets []string
+	if e.transactional {
+		processedTargets = append(processedTargets, "processed_data table")
+	}
+	for _, name := range e.loader.Sinks() {
+		processedTargets = append(processedTargets, name+" sink")
+	}
+	processedTargets = append(processedTargets, "processed snapshot")
+
+	var summary *DryRunSummary
+	var err error
+	if e.dag != nil {
+		summary, err = DryRunDAG(ctx, e.dag, e.apiClient, e.transformer.Load(), rawTargets, processedTargets)
+	} else {
+		summary, err = DryRun(ctx, e.apiClient, e.transformer.Load(), rawTargets, processedTargets)
+	}
+	if err != nil {
+		return nil, err
+	}
+	e.metrics.DryRunsTotal.Inc()
+	return summary, nil
+}
+
+// dryRunCycle runs a scheduled cycle as a dry run and logs its summary
+func (e *ETLService) dryRunCycle(ctx context.Context) {
+	summary, err := e.DryRun(ctx)
+	if err != nil {
+		e.logger.Error(fmt.Sprintf("Dry run failed: %v", err))
+		return
+	}
+	e.logger.Info(summary.String())
+}
@@ -0,0 +1,46 @@
+package etl
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+type staticExtractor []map[string]interface{}
+
+func (s staticExtractor) FetchData(ctx context.Context) ([]map[string]interface{}, error) {
+	return s, nil
+}
+
+func TestDryRun(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+	transformer := transform.NewTransformer(logger, metrics.NewMetrics())
+
+	extractor := staticExtractor{
+		{"userId": float64(1), "title": "First", "body": "Body"},
+		{"userId": float64(2), "title": "Second", "body": "Body"},
+		{"title": "No user", "body": "Body"},
+	}
+	summary, err := DryRun(context.Background(), extractor, transformer, []string{"raw_data table"}, []string{"kafka sink"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if summary.Extracted != 3 || summary.Transformed != 2 || summary.Rejected != 1 {
+		t.Errorf("Unexpected counts: %+v", summary)
+	}
+	if len(summary.Sample) != 2 || summary.Sample[0].Title != "First" {
+		t.Errorf("Unexpected sample: %+v", summary.Sample)
+	}
+	want := []DryRunWrite{{Target: "raw_data table", Records: 3}, {Target: "kafka sink", Records: 2}}
+	if len(summary.Writes) != len(want) || summary.Writes[0] != want[0] || summary.Writes[1] != want[1] {
+		t.Errorf("Expected writes %+v, got %+v", want, summary.Writes)
+	}
+	if !strings.Contains(summary.String(), "would write 2 records to kafka sink") {
+		t.Errorf("Unexpected summary: %s", summary)
+	}
+}
@@ -0,0 +1,159 @@
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/cache"
+)
+
+// EnrichConfig adds fields of reference records to raw records before they are
+// transformed, e.g. the name of a post's author looked up by its userId
+type EnrichConfig struct {
+	// URL is the lookup URL of a reference record, with {key} replaced by the value
+	// of the raw key Key, e.g. https://jsonplaceholder.typicode.com/users/{key}
+	URL string
+	Key string
+	// Fields maps fields of the reference record to the raw keys they are copied
+	// to, e.g. name to authorName, which TRANSFORM_FIELD_SOURCES can then read
+	Fields map[string]string
+	// TTL is how long the fields of a reference record are cached, which must be
+	// positive
+	TTL time.Duration
+}
+
+// Lookuper fetches a reference record, e.g. *api.Client; found is false when
+// there is none
+type Lookuper interface {
+	Lookup(ctx context.Context, url string) (record map[string]interface{}, found bool, err error)
+}
+
+// enricher looks up the reference records of raw records through a cache
+type enricher struct {
+	cfg     EnrichConfig
+	lookups Lookuper
+	cache   cache.Cache
+}
+
+// SetEnrichment enriches the raw records of every batch before they are
+// transformed, looking reference records up with lookups and caching the fields
+// copied from them in store. Raw records are still stored as received.
+func (e *ETLService) SetEnrichment(cfg EnrichConfig, lookups Lookuper, store cache.Cache) {
+	e.enricher = &enricher{cfg: cfg, lookups: lookups, cache: store}
+}
+
+// enrich returns the raw records with the fields of their reference record added,
+// copying the records it changes so those received are left as they are. Each
+// distinct key is looked up once per batch, from the cache if it has it; keys
+// without a reference record are cached too. A failed lookup fails the batch,
+// which would otherwise be transformed without its reference data; a failed
+// cache is logged and looked past.
+func (e *ETLService) enrich(ctx context.Context, rawData []map[string]interface{}) ([]map[string]interface{}, error) {
+	if e.enricher == nil {
+		return rawData, nil
+	}
+	cfg := e.enricher.cfg
+	var keys []string
+	seen := make(map[string]bool)
+	for _, record := range rawData {
+		if key, ok := lookupKey(record[cfg.Key]); ok && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return rawData, nil
+	}
+
+	logger := e.logger.ForContext(ctx)
+	cached, err := e.enricher.cache.Get(ctx, keys...)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to read cached enrichment lookups, looking them all up: %v", err))
+		cached = make(map[string]string)
+	}
+	e.metrics.EnrichLookupsTotal.WithLabelValues("cached").Add(float64(len(cached)))
+	fetched := make(map[string]string)
+	for _, key := range keys {
+		if _, ok := cached[key]; ok {
+			continue
+		}
+		reference, found, err := e.enricher.lookups.Lookup(ctx, strings.ReplaceAll(cfg.URL, "{key}", url.PathEscape(key)))
+		if err != nil {
+			e.metrics.EnrichLookupsTotal.WithLabelValues("failed").Inc()
+			return nil, fmt.Errorf("enrichment lookup of %s %s failed: %w", cfg.Key, key, err)
+		}
+		// A key without a reference record is cached as null, so it is not looked up
+		// again for every batch
+		value := "null"
+		if found {
+			fields := make(map[string]interface{}, len(cfg.Fields))
+			for field := range cfg.Fields {
+				if v, ok := reference[field]; ok {
+					fields[field] = v
+				}
+			}
+			encoded, err := json.Marshal(fields)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode the reference record of %s %s: %w", cfg.Key, key, err)
+			}
+			value = string(encoded)
+			e.metrics.EnrichLookupsTotal.WithLabelValues("fetched").Inc()
+		} else {
+			e.metrics.EnrichLookupsTotal.WithLabelValues("not_found").Inc()
+		}
+		fetched[key] = value
+		cached[key] = value
+	}
+	if len(fetched) > 0 {
+		if err := e.enricher.cache.Set(ctx, fetched, cfg.TTL); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to cache enrichment lookups: %v", err))
+		}
+	}
+
+	references := make(map[string]map[string]interface{}, len(cached))
+	for key, value := range cached {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(value), &fields); err != nil {
+			logger.Warn(fmt.Sprintf("Ignoring the unreadable cached lookup of %s %s: %v", cfg.Key, key, err))
+			continue
+		}
+		references[key] = fields
+	}
+	enriched := make([]map[string]interface{}, len(rawData))
+	for i, record := range rawData {
+		key, _ := lookupKey(record[cfg.Key])
+		fields := references[key]
+		if len(fields) == 0 {
+			enriched[i] = record
+			continue
+		}
+		copied := make(map[string]interface{}, len(record)+len(fields))
+		for k, v := range record {
+			copied[k] = v
+		}
+		for field, v := range fields {
+			copied[cfg.Fields[field]] = v
+		}
+		enriched[i] = copied
+	}
+	return enriched, nil
+}
+
+// lookupKey returns the value of a raw key reference records are looked up by, as
+// text; ok is false for missing, empty and non-scalar values
+func lookupKey(value interface{}) (key string, ok bool) {
+	switch v := value.(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case json.Number:
+		return v.String(), true
+	}
+	return "", false
+}
@@ -0,0 +1,84 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/cache"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// fakeLookups serves reference records by URL, counting the lookups
+type fakeLookups struct {
+	records map[string]map[string]interface{}
+	calls   []string
+	err     error
+}
+
+func (f *fakeLookups) Lookup(ctx context.Context, url string) (map[string]interface{}, bool, error) {
+	f.calls = append(f.calls, url)
+	if f.err != nil {
+		return nil, false, f.err
+	}
+	record, ok := f.records[url]
+	return record, ok, nil
+}
+
+func TestEnrich(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+	e := NewETLService(nil, nil, nil, nil, nil, logger, metrics.NewMetrics(), nil)
+	lookups := &fakeLookups{records: map[string]map[string]interface{}{
+		"https://api.test/users/1": {"name": "Leanne", "email": "leanne@example.com"},
+	}}
+	e.SetEnrichment(EnrichConfig{
+		URL:    "https://api.test/users/{key}",
+		Key:    "userId",
+		Fields: map[string]string{"name": "authorName"},
+		TTL:    time.Hour,
+	}, lookups, cache.NewMemory())
+
+	batch := []map[string]interface{}{
+		{"id": float64(1), "userId": float64(1)},
+		{"id": float64(2), "userId": float64(1)},
+		{"id": float64(3), "userId": float64(2)},
+		{"id": float64(4)},
+	}
+	enriched, err := e.enrich(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("Enrichment failed: %v", err)
+	}
+	if len(lookups.calls) != 2 {
+		t.Errorf("Expected each distinct key looked up once, got %v", lookups.calls)
+	}
+	if enriched[0]["authorName"] != "Leanne" || enriched[1]["authorName"] != "Leanne" {
+		t.Errorf("Expected the author name added, got %v", enriched)
+	}
+	if _, ok := enriched[0]["email"]; ok {
+		t.Error("Expected only the configured fields copied")
+	}
+	if _, ok := batch[0]["authorName"]; ok {
+		t.Error("Expected the records as received left untouched")
+	}
+	if _, ok := enriched[2]["authorName"]; ok || len(enriched[3]) != 1 {
+		t.Errorf("Expected records without a reference record left as they are, got %v", enriched[2:])
+	}
+
+	// Found and missing reference records are both served from the cache
+	lookups.calls = nil
+	if enriched, err = e.enrich(context.Background(), batch); err != nil || enriched[0]["authorName"] != "Leanne" {
+		t.Fatalf("Expected the cached lookup used, got %v, %v", enriched, err)
+	}
+	if len(lookups.calls) != 0 {
+		t.Errorf("Expected no lookups with every key cached, got %v", lookups.calls)
+	}
+
+	// A failed lookup fails the batch
+	lookups.err = errors.New("connection refused")
+	if _, err := e.enrich(context.Background(), []map[string]interface{}{{"userId": "3"}}); err == nil {
+		t.Error("Expected a failed lookup to fail enrichment")
+	}
+}
@@ -0,0 +1,41 @@
+package etl
+
+import (
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+// freshTriggers are the triggers of runs loading new data from the source;
+// backfills and replays load older data, which does not make it fresher
+var freshTriggers = map[string]bool{
+	triggerSchedule: true,
+	triggerRetry:    true,
+	triggerOnce:     true,
+	triggerIngest:   true,
+}
+
+// markFresh records when a finished run brought the processed data up to date
+// with the source: it loaded its batch, or found nothing new to load
+func (e *ETLService) markFresh(r *run) {
+	if e.dryRun || !freshTriggers[r.Trigger] || r.Status == database.RunFailed {
+		return
+	}
+	// Records skipped as loaded unchanged before are up to date too
+	if r.RecordsLoaded == 0 && r.duplicates == 0 && r.RecordsExtracted > 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if r.FinishedAt.After(e.lastLoaded) {
+		e.lastLoaded = *r.FinishedAt
+	}
+}
+
+// LastLoaded returns when a run last brought the processed data up to date, zero
+// if none did since the service started
+func (e *ETLService) LastLoaded() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lastLoaded
+}
@@ -0,0 +1,48 @@
+package etl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestMarkFresh(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	e := NewETLService(nil, nil, nil, nil, nil, logger, metrics.NewMetrics(), nil)
+
+	finished := func(trigger, status string, extracted, loaded int) *run {
+		finishedAt := time.Now()
+		return &run{PipelineRun: database.PipelineRun{
+			Trigger:          trigger,
+			Status:           status,
+			FinishedAt:       &finishedAt,
+			RecordsExtracted: extracted,
+			RecordsLoaded:    loaded,
+		}}
+	}
+	for _, r := range []*run{
+		finished(triggerSchedule, database.RunFailed, 10, 0),
+		finished(triggerSchedule, database.RunPartial, 10, 0),
+		finished(triggerBackfill, database.RunSucceeded, 10, 10),
+		finished(triggerReplay, database.RunSucceeded, 10, 10),
+	} {
+		e.markFresh(r)
+		if !e.LastLoaded().IsZero() {
+			t.Fatalf("Expected a %s %s run not to make the data fresh", r.Status, r.Trigger)
+		}
+	}
+
+	// A cycle finding nothing new brings the data up to date too
+	for _, r := range []*run{
+		finished(triggerSchedule, database.RunSucceeded, 0, 0),
+		finished(triggerIngest, database.RunPartial, 10, 10),
+	} {
+		e.markFresh(r)
+		if !e.LastLoaded().Equal(*r.FinishedAt) {
+			t.Errorf("Expected a %s %s run to make the data fresh", r.Status, r.Trigger)
+		}
+	}
+}
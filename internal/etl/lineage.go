@@ -0,0 +1,57 @@
+package etl
+
+import (
+	"encoding/json"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+// SetSourceName names the source processed records are traced back to in their
+// lineage, e.g. the source environment
+func (e *ETLService) SetSourceName(name string) {
+	e.source = name
+}
+
+// rawHashes returns the PayloadHash of each raw record, hashing payloads when they
+// were kept and the JSON encoding of the records otherwise, as raw_data stores them
+func rawHashes(rawData []map[string]interface{}, payloads []json.RawMessage) []string {
+	hashes := make([]string, len(rawData))
+	for i, record := range rawData {
+		if payloads != nil {
+			hashes[i] = database.PayloadHash(payloads[i])
+			continue
+		}
+		if payload, err := json.Marshal(record); err == nil {
+			hashes[i] = database.PayloadHash(payload)
+		}
+	}
+	return hashes
+}
+
+// traceLineage completes the lineage of processed records with the source, the
+// hash of the raw record at their Line and its raw_data id, when ids are known
+func (e *ETLService) traceLineage(records []database.ProcessedRecord, hashes []string, ids []int64) {
+	for _, record := range records {
+		lineage := record.Lineage
+		if lineage == nil {
+			continue
+		}
+		lineage.Source = e.source
+		if lineage.Line < len(hashes) {
+			lineage.SourceHash = hashes[lineage.Line]
+		}
+		if lineage.Line < len(ids) {
+			lineage.RawDataID = ids[lineage.Line]
+		}
+	}
+}
+
+// rebaseLineage moves the lines of processed records by offset, when their raw
+// batch is appended to offset records
+func rebaseLineage(records []database.ProcessedRecord, offset int) {
+	for _, record := range records {
+		if record.Lineage != nil {
+			record.Lineage.Line += offset
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package etl
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+func TestTraceLineage(t *testing.T) {
+	e := &ETLService{}
+	e.SetSourceName("sandbox")
+
+	raw := []map[string]interface{}{{"id": 1.0}, {"id": 2.0}}
+	payloads := []json.RawMessage{json.RawMessage(`{"id": 1}`), json.RawMessage(`{"id": 2}`)}
+	hashes := rawHashes(raw, payloads)
+	if hashes[0] != database.PayloadHash(payloads[0]) || hashes[0] == hashes[1] {
+		t.Fatalf("Expected payloads hashed as received, got %v", hashes)
+	}
+	if encoded := rawHashes(raw, nil); encoded[1] != database.PayloadHash([]byte(`{"id":2}`)) {
+		t.Errorf("Expected records without payloads hashed as encoded, got %v", encoded)
+	}
+
+	// The second page of a streamed batch continues the lines of the first
+	records := []database.ProcessedRecord{{UserID: 2, Lineage: &database.Lineage{Line: 0}}, {UserID: 3}}
+	rebaseLineage(records, 1)
+	e.traceLineage(records, hashes, []int64{41, 42})
+	lineage := records[0].Lineage
+	if lineage.Line != 1 || lineage.Source != "sandbox" || lineage.SourceHash != hashes[1] || lineage.RawDataID != 42 {
+		t.Errorf("Unexpected lineage: %+v", lineage)
+	}
+	if records[1].Lineage != nil {
+		t.Error("Expected a record without lineage to be left alone")
+	}
+}
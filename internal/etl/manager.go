@@ -0,0 +1,109 @@
+package etl
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+// Restart backoff of pipelines stopped by a panic
+const (
+	restartBackoff    = time.Second
+	maxRestartBackoff = 5 * time.Minute
+)
+
+// Pipeline is one named ETL service run by a Manager on its own schedule
+type Pipeline struct {
+	Name     string
+	Service  *ETLService
+	Schedule Schedule
+}
+
+// Manager runs several independent pipelines in one process and supervises them,
+// restarting a pipeline whose service panicked
+type Manager struct {
+	pipelines []*Pipeline
+	byName    map[string]*Pipeline
+	logger    *logging.Logger
+}
+
+// NewManager creates a manager of no pipelines
+func NewManager(logger *logging.Logger) *Manager {
+	return &Manager{byName: make(map[string]*Pipeline), logger: logger}
+}
+
+// Add registers a pipeline; names must be unique
+func (m *Manager) Add(name string, service *ETLService, schedule Schedule) error {
+	if _, ok := m.byName[name]; ok {
+		return fmt.Errorf("pipeline %s is already registered", name)
+	}
+	p := &Pipeline{Name: name, Service: service, Schedule: schedule}
+	m.pipelines = append(m.pipelines, p)
+	m.byName[name] = p
+	return nil
+}
+
+// Pipeline returns the pipeline of a name
+func (m *Manager) Pipeline(name string) (*Pipeline, bool) {
+	p, ok := m.byName[name]
+	return p, ok
+}
+
+// Pipelines returns the registered pipelines in the order they were added
+func (m *Manager) Pipelines() []*Pipeline {
+	return m.pipelines
+}
+
+// Start runs every pipeline until ctx is cancelled and returns once all of them stopped
+func (m *Manager) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, p := range m.pipelines {
+		wg.Add(1)
+		go func(p *Pipeline) {
+			defer wg.Done()
+			m.supervise(ctx, p)
+		}(p)
+	}
+	wg.Wait()
+}
+
+// supervise runs a pipeline, restarting it with an exponential backoff whenever
+// it panics. The backoff is reset once a restarted pipeline ran for longer than
+// the maximum backoff.
+func (m *Manager) supervise(ctx context.Context, p *Pipeline) {
+	backoff := restartBackoff
+	for {
+		started := time.Now()
+		if !m.run(ctx, p) {
+			return
+		}
+		if time.Since(started) > maxRestartBackoff {
+			backoff = restartBackoff
+		}
+
+		p.Service.metrics.PipelineRestartsTotal.Inc()
+		m.logger.Warn(fmt.Sprintf("Restarting pipeline %s in %v", p.Name, backoff))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRestartBackoff)
+	}
+}
+
+// run runs a pipeline until ctx is cancelled and reports whether it panicked instead
+func (m *Manager) run(ctx context.Context, p *Pipeline) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			m.logger.Error(fmt.Sprintf("Pipeline %s panicked: %v\n%s", p.Name, r, debug.Stack()))
+			panicked = true
+		}
+	}()
+	p.Service.Start(ctx, p.Schedule)
+	return false
+}
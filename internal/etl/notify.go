@@ -0,0 +1,56 @@
+package etl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+// CycleNotifier is told about the finished run of every cycle
+type CycleNotifier interface {
+	NotifyCycle(ctx context.Context, run database.PipelineRun)
+}
+
+// MetricsPusher sends the metrics somewhere, e.g. to a Pushgateway
+type MetricsPusher interface {
+	Push(ctx context.Context) error
+}
+
+// SetMetricsPusher pushes the metrics through p after every cycle, once the cycle
+// metrics are up to date
+func (e *ETLService) SetMetricsPusher(p MetricsPusher) {
+	e.pusher = p
+}
+
+// pushMetrics pushes the metrics, even when ctx is cancelled by a shutdown
+func (e *ETLService) pushMetrics(ctx context.Context) {
+	if e.pusher == nil {
+		return
+	}
+	if err := e.pusher.Push(context.WithoutCancel(ctx)); err != nil {
+		e.logger.Error(fmt.Sprintf("Failed to push metrics: %v", err))
+	}
+}
+
+// AddNotifier reports the outcome of every cycle, scheduled or retried, to n
+func (e *ETLService) AddNotifier(n CycleNotifier) {
+	e.notifiers = append(e.notifiers, n)
+}
+
+// notifyCycle hands the finished run of a cycle to the notifiers in the background,
+// so slow receivers never delay the next cycle
+func (e *ETLService) notifyCycle(ctx context.Context, r *run) {
+	if len(e.notifiers) == 0 {
+		return
+	}
+	run := r.PipelineRun
+	ctx = context.WithoutCancel(ctx)
+	e.notifying.Add(1)
+	go func() {
+		defer e.notifying.Done()
+		for _, n := range e.notifiers {
+			n.NotifyCycle(ctx, run)
+		}
+	}()
+}
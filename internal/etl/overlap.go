@@ -0,0 +1,102 @@
+package etl
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// Overlap policies, deciding what happens to a tick due while a cycle is still running
+const (
+	// OverlapSkip drops the tick
+	OverlapSkip = "skip"
+	// OverlapQueue runs one cycle right after the running one; further ticks are dropped
+	OverlapQueue = "queue"
+	// OverlapCancelPrevious cancels the running cycle and starts a new one
+	OverlapCancelPrevious = "cancel-previous"
+)
+
+// SetOverlapPolicy sets how ticks due while a cycle is still running are handled
+func (e *ETLService) SetOverlapPolicy(policy string) error {
+	switch policy {
+	case OverlapSkip, OverlapQueue, OverlapCancelPrevious:
+		e.overlapPolicy = policy
+		return nil
+	}
+	return fmt.Errorf("unknown overlap policy %q, expected %s, %s or %s", policy, OverlapSkip, OverlapQueue, OverlapCancelPrevious)
+}
+
+// SetCycleTimeout cancels cycles running longer than timeout; zero disables it
+func (e *ETLService) SetCycleTimeout(timeout time.Duration) {
+	e.cycleTimeout = timeout
+}
+
+// cycle is a scheduled cycle running in its own goroutine
+type cycle struct {
+	cancel context.CancelFunc
+	done   chan cycleResult
+}
+
+// cycleResult is the outcome of a cycle: whether it left a continuation, the status
+// of its run, the error that failed it, or the panic that stopped it
+type cycleResult struct {
+	continuation bool
+	status       string
+	err          error
+	panic        interface{}
+}
+
+// startCycle runs a cycle in the background
+func (e *ETLService) startCycle(ctx context.Context, trigger string) *cycle {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &cycle{cancel: cancel, done: make(chan cycleResult, 1)}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				c.done <- cycleResult{panic: fmt.Sprintf("%v\n%s", r, debug.Stack())}
+			}
+		}()
+		continuation, status, err := e.runCycle(ctx, trigger)
+		e.pushMetrics(ctx)
+		c.done <- cycleResult{continuation: continuation, status: status, err: err}
+	}()
+	return c
+}
+
+// finish releases a cycle once its result was received. A panic of the cycle is
+// raised again in the scheduling goroutine, so supervisors see it.
+func (c *cycle) finish(result cycleResult) {
+	c.cancel()
+	if result.panic != nil {
+		panic(result.panic)
+	}
+}
+
+// wait blocks until the cycle ended and returns its result
+func (c *cycle) wait() cycleResult {
+	result := <-c.done
+	c.finish(result)
+	return result
+}
+
+// overlap applies the overlap policy to a tick due while running is still in
+// progress and returns whether a cycle is queued
+func (e *ETLService) overlap(running *cycle, queued bool) bool {
+	switch e.overlapPolicy {
+	case OverlapQueue:
+		if !queued {
+			e.logger.Info("Cycle still running, the next one is queued")
+			return true
+		}
+	case OverlapCancelPrevious:
+		e.logger.Warn("Cycle still running, cancelling it to start the next one")
+		running.cancel()
+		e.metrics.CyclesCancelledTotal.WithLabelValues("overlap").Inc()
+		// The cancelled cycle's result arrives in Start, which then runs the queued one
+		return true
+	}
+	e.logger.Warn("Cycle still running, skipping the tick")
+	e.metrics.CyclesSkippedTotal.Inc()
+	return queued
+}
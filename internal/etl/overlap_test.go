@@ -0,0 +1,54 @@
+package etl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestOverlap(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	e := NewETLService(nil, nil, nil, nil, nil, logger, metrics.NewMetrics(), nil)
+	if err := e.SetOverlapPolicy("wait"); err == nil {
+		t.Error("Expected an unknown overlap policy to be rejected")
+	}
+
+	tests := []struct {
+		policy    string
+		queued    bool
+		want      bool
+		cancelled bool
+	}{
+		{OverlapSkip, false, false, false},
+		{OverlapQueue, false, true, false},
+		{OverlapQueue, true, true, false},
+		{OverlapCancelPrevious, false, true, true},
+	}
+	for _, tt := range tests {
+		if err := e.SetOverlapPolicy(tt.policy); err != nil {
+			t.Fatalf("SetOverlapPolicy(%q) failed: %v", tt.policy, err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		running := &cycle{cancel: cancel, done: make(chan cycleResult, 1)}
+		if got := e.overlap(running, tt.queued); got != tt.want {
+			t.Errorf("%s with queued=%v: expected queued=%v, got %v", tt.policy, tt.queued, tt.want, got)
+		}
+		if cancelled := ctx.Err() != nil; cancelled != tt.cancelled {
+			t.Errorf("%s: expected the running cycle cancelled=%v, got %v", tt.policy, tt.cancelled, cancelled)
+		}
+		cancel()
+	}
+}
+
+func TestCyclePanic(t *testing.T) {
+	running := &cycle{cancel: func() {}, done: make(chan cycleResult, 1)}
+	running.done <- cycleResult{panic: "boom"}
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected the panic of a cycle to be raised again when it is waited for")
+		}
+	}()
+	running.wait()
+}
@@ -0,0 +1,51 @@
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/api"
+)
+
+// SetRawPassthrough stores the raw records of cycles in raw_data and JSON and NDJSON
+// snapshots as the source sent them, instead of encoding the decoded records again.
+// The decoded records are only transformed. It applies to extractors keeping the
+// payloads of records; DAG cycles, backfills, replays and ingests encode them as before.
+func (e *ETLService) SetRawPassthrough(enabled bool) {
+	e.rawPassthrough = enabled
+}
+
+// payloadExtractor returns the extractor keeping record payloads, if raw passthrough
+// is enabled and the extractor supports it
+func (e *ETLService) payloadExtractor() (api.PayloadExtractor, bool) {
+	if !e.rawPassthrough {
+		return nil, false
+	}
+	extractor, ok := e.apiClient.(api.PayloadExtractor)
+	return extractor, ok
+}
+
+// fetchBatch fetches a whole batch, with the payload of each record when they are
+// kept and the batches to acknowledge when the extractor hands out any
+func (e *ETLService) fetchBatch(ctx context.Context) ([]map[string]interface{}, []json.RawMessage, []*api.Batch, error) {
+	if extractor, ok := e.batchExtractor(); ok {
+		return fetchBatches(ctx, extractor, e.rawPassthrough)
+	}
+	extractor, ok := e.payloadExtractor()
+	if !ok {
+		data, err := e.apiClient.FetchData(ctx)
+		return data, nil, nil, err
+	}
+	var data []map[string]interface{}
+	var payloads []json.RawMessage
+	err := extractor.FetchPayloads(ctx, func(page []map[string]interface{}, pagePayloads []json.RawMessage) error {
+		data = append(data, page...)
+		payloads = append(payloads, pagePayloads...)
+		return nil
+	})
+	if err != nil && !errors.Is(err, api.ErrPartial) {
+		return nil, nil, nil, err
+	}
+	return data, payloads, nil, err
+}
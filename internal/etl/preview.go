@@ -0,0 +1,86 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/api"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// MaxPreviewRecords bounds the raw records transformed by one preview
+const MaxPreviewRecords = 100
+
+// PreviewRequest is a sample of raw records to transform without writing the
+// result: the records themselves, or the first Fetch records of a source batch
+type PreviewRequest struct {
+	Records []map[string]interface{} `json:"records"`
+	Fetch   int                      `json:"fetch"`
+	// FieldSources overrides the raw keys fields are read from for this preview
+	// only, as TRANSFORM_FIELD_SOURCES would
+	FieldSources map[string]string `json:"field_sources"`
+}
+
+// Validate checks that the request holds a bounded sample, or asks for one, and
+// a valid field mapping
+func (req PreviewRequest) Validate() error {
+	switch {
+	case len(req.Records) > 0 && req.Fetch > 0:
+		return fmt.Errorf("records and fetch are mutually exclusive")
+	case len(req.Records) == 0 && req.Fetch <= 0:
+		return fmt.Errorf("a preview needs records or a positive fetch")
+	case len(req.Records) > MaxPreviewRecords || req.Fetch > MaxPreviewRecords:
+		return fmt.Errorf("a preview is limited to %d records", MaxPreviewRecords)
+	}
+	if err := transform.ValidateFieldSources(req.FieldSources); err != nil {
+		return fmt.Errorf("invalid field_sources: %w", err)
+	}
+	return nil
+}
+
+// PreviewTransform enriches and transforms a sample of raw records with the
+// pipeline's field mapping, or the one of req, without writing or counting
+// anything but the enrichment lookups, which are cached as a run's are. Fetched
+// records come from the next batch of the source; extraction progress is not
+// committed.
+func (e *ETLService) PreviewTransform(ctx context.Context, req PreviewRequest) (*transform.Preview, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	transformer := e.transformer.Load()
+	if len(req.FieldSources) > 0 {
+		var err error
+		if transformer, err = transformer.WithFieldSources(req.FieldSources); err != nil {
+			return nil, err
+		}
+	}
+
+	rawData := req.Records
+	if req.Fetch > 0 {
+		var err error
+		if rawData, err = e.fetchSample(ctx, req.Fetch); err != nil {
+			return nil, err
+		}
+	}
+	rawData, err := e.enrich(ctx, rawData)
+	if err != nil {
+		return nil, err
+	}
+	return transformer.Preview(rawData), nil
+}
+
+// fetchSample extracts a batch from the source as a dry run does and returns its
+// first n records
+func (e *ETLService) fetchSample(ctx context.Context, n int) ([]map[string]interface{}, error) {
+	// Extractors tracking progress keep it until the next commit, which a preview
+	// must not slip in before
+	e.extractMu.Lock()
+	defer e.extractMu.Unlock()
+
+	rawData, err := e.apiClient.FetchData(ctx)
+	if err != nil && !(errors.Is(err, api.ErrPartial) && len(rawData) > 0) {
+		return nil, fmt.Errorf("extraction failed: %w", err)
+	}
+	return rawData[:min(n, len(rawData))], nil
+}
@@ -0,0 +1,57 @@
+package etl
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+func TestPreviewRequestValidate(t *testing.T) {
+	record := map[string]interface{}{"userId": float64(1), "title": "Post"}
+	tests := []struct {
+		name string
+		req  PreviewRequest
+		want string
+	}{
+		{"empty", PreviewRequest{}, "needs records"},
+		{"both", PreviewRequest{Records: []map[string]interface{}{record}, Fetch: 1}, "mutually exclusive"},
+		{"too many", PreviewRequest{Fetch: MaxPreviewRecords + 1}, "limited to"},
+		{"unknown field", PreviewRequest{Fetch: 1, FieldSources: map[string]string{"subtitle": "x"}}, "invalid field_sources"},
+		{"records", PreviewRequest{Records: []map[string]interface{}{record}}, ""},
+		{"fetch", PreviewRequest{Fetch: 10, FieldSources: map[string]string{"title": "headline"}}, ""},
+	}
+	for _, tt := range tests {
+		err := tt.req.Validate()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestPreviewTransform(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	metricsCollector := metrics.NewMetrics()
+	transformer := transform.NewTransformer(logger, metricsCollector)
+	e := NewETLService(nil, nil, nil, nil, transformer, logger, metricsCollector, nil)
+
+	preview, err := e.PreviewTransform(context.Background(), PreviewRequest{
+		Records:      []map[string]interface{}{{"userId": float64(1), "headline": "Post"}},
+		FieldSources: map[string]string{"title": "headline"},
+	})
+	if err != nil {
+		t.Fatalf("Preview failed: %v", err)
+	}
+	if preview.Transformed != 1 || preview.Records[0].Record.Title != "Post" {
+		t.Errorf("Expected the record transformed with the overridden mapping, got %+v", preview)
+	}
+	if e.transformer.Load() != transformer || transformer.Version() == preview.Version {
+		t.Error("Expected the pipeline's transformer left unchanged")
+	}
+}
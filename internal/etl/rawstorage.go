@@ -0,0 +1,135 @@
+package etl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// Raw storage modes, deciding which raw records are stored in raw_data, raw
+// snapshots and raw blobs
+const (
+	// RawStorageAll stores every raw record
+	RawStorageAll = "all"
+	// RawStorageSample stores a random sample of the raw records of each batch
+	RawStorageSample = "sample"
+	// RawStorageErrors stores the raw records of the batches with records the
+	// transformer rejected
+	RawStorageErrors = "errors"
+	// RawStorageNone stores no raw records
+	RawStorageNone = "none"
+)
+
+// RawStorage decides which raw records of the batches are stored
+type RawStorage struct {
+	Mode string
+	// SampleRate is the fraction of raw records RawStorageSample stores
+	SampleRate float64
+}
+
+// SetRawStorage sets which raw records are stored; all by default. Without their
+// raw records, batches are durable once their processed records are loaded, so
+// extraction progress is committed only then, and processed records are not
+// linked to a raw_data row.
+func (e *ETLService) SetRawStorage(policy RawStorage) error {
+	switch policy.Mode {
+	case RawStorageAll, RawStorageSample, RawStorageErrors, RawStorageNone:
+	default:
+		return fmt.Errorf("unknown raw storage mode %q", policy.Mode)
+	}
+	if policy.SampleRate < 0 || policy.SampleRate > 1 {
+		return fmt.Errorf("raw sample rate %v is not a fraction between 0 and 1", policy.SampleRate)
+	}
+	e.rawStorage = policy
+	return nil
+}
+
+// keptRaw returns the lines of the raw records of a transformed batch of n records
+// to store, or nil to store all of them
+func (e *ETLService) keptRaw(n int, transformed *transform.TransformedData) []int {
+	switch e.rawStorage.Mode {
+	case RawStorageNone:
+		return []int{}
+	case RawStorageErrors:
+		if transformed != nil && n-len(transformed.Records)-len(transformed.Deleted) > 0 {
+			return nil
+		}
+		return []int{}
+	case RawStorageSample:
+		lines := []int{}
+		for line := 0; line < n; line++ {
+			if rand.Float64() < e.rawStorage.SampleRate {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+	return nil
+}
+
+// rawLines returns the raw records at lines and their payloads, if kept
+func rawLines(rawData []map[string]interface{}, payloads []json.RawMessage, lines []int) ([]map[string]interface{}, []json.RawMessage) {
+	raw := make([]map[string]interface{}, len(lines))
+	var kept []json.RawMessage
+	if payloads != nil {
+		kept = make([]json.RawMessage, len(lines))
+	}
+	for i, line := range lines {
+		raw[i] = rawData[line]
+		if payloads != nil {
+			kept[i] = payloads[line]
+		}
+	}
+	return raw, kept
+}
+
+// spreadIDs returns the raw_data ids of the raw records at lines by line of their
+// batch of n records, zero for the records not stored
+func spreadIDs(ids []int64, lines []int, n int) []int64 {
+	if ids == nil {
+		return nil
+	}
+	spread := make([]int64, n)
+	for i, line := range lines {
+		spread[line] = ids[i]
+	}
+	return spread
+}
+
+// relinkLineage returns copies of records whose lineage Line is the index of their
+// raw record among the raw records at lines, for storing them together; records of
+// raw records not stored point past them and stay unlinked
+func relinkLineage(records []database.ProcessedRecord, lines []int) []database.ProcessedRecord {
+	index := make(map[int]int, len(lines))
+	for i, line := range lines {
+		index[line] = i
+	}
+	relinked := make([]database.ProcessedRecord, len(records))
+	for i, record := range records {
+		relinked[i] = record
+		if record.Lineage == nil {
+			continue
+		}
+		lineage := *record.Lineage
+		if kept, ok := index[lineage.Line]; ok {
+			lineage.Line = kept
+		} else {
+			lineage.Line = len(lines)
+		}
+		relinked[i].Lineage = &lineage
+	}
+	return relinked
+}
+
+// copyRawDataIDs sets the raw_data ids resolved for the relinked copies of records
+// on records
+func copyRawDataIDs(records, relinked []database.ProcessedRecord) {
+	for i, record := range records {
+		if record.Lineage != nil {
+			record.Lineage.RawDataID = relinked[i].Lineage.RawDataID
+		}
+	}
+}
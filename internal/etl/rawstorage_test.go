@@ -0,0 +1,85 @@
+package etl
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+func TestKeptRaw(t *testing.T) {
+	clean := &transform.TransformedData{Records: make([]database.ProcessedRecord, 3)}
+	rejected := &transform.TransformedData{Records: make([]database.ProcessedRecord, 2)}
+	deleted := &transform.TransformedData{Records: make([]database.ProcessedRecord, 2), Deleted: []string{"7"}}
+
+	tests := []struct {
+		name        string
+		policy      RawStorage
+		transformed *transform.TransformedData
+		lines       []int
+	}{
+		{"all", RawStorage{Mode: RawStorageAll}, rejected, nil},
+		{"none", RawStorage{Mode: RawStorageNone}, rejected, []int{}},
+		{"errors with a rejected record", RawStorage{Mode: RawStorageErrors}, rejected, nil},
+		{"errors with a deleted record", RawStorage{Mode: RawStorageErrors}, deleted, []int{}},
+		{"errors without rejected records", RawStorage{Mode: RawStorageErrors}, clean, []int{}},
+		{"sample of none", RawStorage{Mode: RawStorageSample}, clean, []int{}},
+		{"sample of all", RawStorage{Mode: RawStorageSample, SampleRate: 1}, clean, []int{0, 1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &ETLService{}
+			if err := e.SetRawStorage(tt.policy); err != nil {
+				t.Fatalf("SetRawStorage: %v", err)
+			}
+			lines := e.keptRaw(3, tt.transformed)
+			if (lines == nil) != (tt.lines == nil) || !slices.Equal(lines, tt.lines) {
+				t.Errorf("keptRaw() = %#v, want %#v", lines, tt.lines)
+			}
+		})
+	}
+
+	e := &ETLService{}
+	if err := e.SetRawStorage(RawStorage{Mode: "some"}); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+	if err := e.SetRawStorage(RawStorage{Mode: RawStorageSample, SampleRate: 1.5}); err == nil {
+		t.Error("Expected a sample rate above 1 to be rejected")
+	}
+}
+
+func TestRawLines(t *testing.T) {
+	raw := []map[string]interface{}{{"id": 1.0}, {"id": 2.0}, {"id": 3.0}}
+	payloads := []json.RawMessage{json.RawMessage(`{"id": 1}`), json.RawMessage(`{"id": 2}`), json.RawMessage(`{"id": 3}`)}
+	lines := []int{0, 2}
+
+	kept, keptPayloads := rawLines(raw, payloads, lines)
+	if len(kept) != 2 || kept[1]["id"] != 3.0 || string(keptPayloads[1]) != `{"id": 3}` {
+		t.Errorf("Unexpected raw records kept: %v %s", kept, keptPayloads)
+	}
+	if _, keptPayloads := rawLines(raw, nil, lines); keptPayloads != nil {
+		t.Error("Expected no payloads when none were kept")
+	}
+	if ids := spreadIDs([]int64{41, 43}, lines, 3); !slices.Equal(ids, []int64{41, 0, 43}) {
+		t.Errorf("spreadIDs() = %v", ids)
+	}
+
+	// Processed records of the stored raw records are linked to them; the others
+	// point past them and are left unlinked
+	records := []database.ProcessedRecord{{Lineage: &database.Lineage{Line: 1}}, {Lineage: &database.Lineage{Line: 2}}, {}}
+	relinked := relinkLineage(records, lines)
+	if relinked[0].Lineage.Line != 2 || relinked[1].Lineage.Line != 1 || relinked[2].Lineage != nil {
+		t.Errorf("Unexpected relinked lineage: %+v %+v", relinked[0].Lineage, relinked[1].Lineage)
+	}
+	if records[0].Lineage.Line != 1 {
+		t.Error("Expected the lineage of the records to be left alone")
+	}
+	relinked[1].Lineage.RawDataID = 43
+	copyRawDataIDs(records, relinked)
+	if records[1].Lineage.RawDataID != 43 || records[0].Lineage.RawDataID != 0 {
+		t.Errorf("Unexpected raw_data ids: %d, %d", records[0].Lineage.RawDataID, records[1].Lineage.RawDataID)
+	}
+}
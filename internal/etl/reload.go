@@ -0,0 +1,29 @@
+package etl
+
+import "github.com/mohammedhassan/etl-pipeline/internal/transform"
+
+// SetSchedule replaces the schedule of a started pipeline, e.g. on a configuration
+// reload, and of its later restarts. A running cycle is left to finish; interval
+// schedules count from now.
+func (e *ETLService) SetSchedule(schedule Schedule) {
+	e.mu.Lock()
+	e.schedule, e.scheduleChanged = schedule, true
+	e.mu.Unlock()
+	e.notifyStateChanged()
+}
+
+// takeSchedule returns the schedule set by SetSchedule, if any, and whether it
+// changed since it was last taken
+func (e *ETLService) takeSchedule() (Schedule, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	changed := e.scheduleChanged
+	e.scheduleChanged = false
+	return e.schedule, changed
+}
+
+// SetTransformer replaces the transformer of the pipeline, e.g. with changed field
+// mappings. Batches already being transformed finish with the previous one.
+func (e *ETLService) SetTransformer(transformer *transform.Transformer) {
+	e.transformer.Store(transformer)
+}
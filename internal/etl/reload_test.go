@@ -0,0 +1,59 @@
+package etl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// notifyingSchedule is due in an hour and reports every time it is asked
+type notifyingSchedule chan struct{}
+
+func (s notifyingSchedule) Next(t time.Time) time.Time {
+	select {
+	case s <- struct{}{}:
+	default:
+	}
+	return t.Add(time.Hour)
+}
+
+func TestSetSchedule(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	e := NewETLService(nil, nil, nil, nil, nil, logger, metrics.NewMetrics(), nil)
+	start := func(schedule Schedule) (stop func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			e.Start(ctx, schedule)
+			close(stopped)
+		}()
+		return func() {
+			cancel()
+			<-stopped
+		}
+	}
+	expect := func(schedule notifyingSchedule, message string) {
+		t.Helper()
+		select {
+		case <-schedule:
+		case <-time.After(time.Second):
+			t.Fatal(message)
+		}
+	}
+
+	initial := make(notifyingSchedule, 1)
+	stop := start(initial)
+	expect(initial, "Expected the initial schedule to be used")
+	reloaded := make(notifyingSchedule, 1)
+	e.SetSchedule(reloaded)
+	expect(reloaded, "Expected the new schedule to replace the initial one")
+	stop()
+
+	// A restarted pipeline keeps the new schedule
+	stop = start(initial)
+	defer stop()
+	expect(reloaded, "Expected the new schedule to survive a restart")
+}
@@ -0,0 +1,57 @@
+package etl
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+func TestReplayRequestValidate(t *testing.T) {
+	day := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		filter database.RawDataFilter
+		want   string
+	}{
+		{"unbounded", database.RawDataFilter{}, "needs an ID range"},
+		{"id range", database.RawDataFilter{FromID: 10, ToID: 5}, "below from_id"},
+		{"time range", database.RawDataFilter{From: day, To: day}, "from must be before to"},
+		{"valid ids", database.RawDataFilter{FromID: 5}, ""},
+		{"valid run", database.RawDataFilter{RunID: "3f2a9c0e"}, ""},
+		{"valid time range", database.RawDataFilter{From: day, To: day.AddDate(0, 0, 1)}, ""},
+	}
+	for _, tt := range tests {
+		err := ReplayRequest{RawDataFilter: tt.filter}.Validate()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestReprocessRequestValidate(t *testing.T) {
+	if err := (ReprocessRequest{}).Validate(); err != nil {
+		t.Errorf("Expected a reprocess of every record to be valid, got %v", err)
+	}
+	if err := (ReprocessRequest{RawDataFilter: database.RawDataFilter{FromID: 10, ToID: 5}}).Validate(); err == nil {
+		t.Error("Expected an error for an inverted ID range")
+	}
+	if err := (ReprocessRequest{BatchSize: -1}).Validate(); err == nil {
+		t.Error("Expected an error for a negative batch size")
+	}
+}
+
+func TestRawDataFilterStaleFor(t *testing.T) {
+	filter := database.RawDataFilter{FromID: 5, StaleFor: "b2c3d4e5f6a7"}
+	if got := filter.String(); !strings.Contains(got, "transformed before version b2c3d4e5f6a7") {
+		t.Errorf("Unexpected description %q", got)
+	}
+	filter.FromVersion = "a1b2c3d4e5f6"
+	if got := filter.String(); !strings.Contains(got, "transformed with version a1b2c3d4e5f6 instead of b2c3d4e5f6a7") {
+		t.Errorf("Unexpected description %q", got)
+	}
+}
@@ -0,0 +1,118 @@
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+)
+
+// triggerReprocess marks the runs transforming stored raw records again with a new
+// transform version
+const triggerReprocess = "reprocess"
+
+// ReprocessRequest selects stored raw records whose processed rows were transformed
+// with an earlier transform version, to transform them with the current one. The
+// filter's StaleFor is set to the current version.
+type ReprocessRequest struct {
+	// ID is the run ID of the reprocess; a new one is generated when empty
+	ID string
+	database.RawDataFilter
+	// BatchSize is the number of records read and loaded at once
+	BatchSize int
+	// Progress, if set, is called after every batch with the number of raw records
+	// reprocessed so far and in total
+	Progress func(done, total int64)
+}
+
+// Validate checks the ranges and batch size of the request. Unlike a replay, a
+// reprocess may select every stored record.
+func (req ReprocessRequest) Validate() error {
+	return validateSelection(req.RawDataFilter, req.BatchSize)
+}
+
+// RecordTransformVersion records the version of the pipeline's transformer with the
+// field mapping it stands for, and points at reprocessing when it is new
+func (e *ETLService) RecordTransformVersion(ctx context.Context) error {
+	transformer := e.transformer.Load()
+	fields, err := json.Marshal(transformer.Fields())
+	if err != nil {
+		return fmt.Errorf("failed to encode transform fields: %w", err)
+	}
+	added, err := e.db.RecordTransformVersion(ctx, e.name, transformer.Version(), fields)
+	if err != nil {
+		return err
+	}
+	if added {
+		e.logger.Info(fmt.Sprintf("Transform version %s recorded; rows processed with earlier versions are re-transformed by the reprocess command", transformer.Version()))
+	}
+	return nil
+}
+
+// TransformVersions returns the transform versions recorded for the pipeline, oldest
+// first, and the current one
+func (e *ETLService) TransformVersions(ctx context.Context) ([]database.TransformVersion, string, error) {
+	versions, err := e.db.TransformVersions(ctx, e.name)
+	return versions, e.transformer.Load().Version(), err
+}
+
+// Reprocess transforms the stored raw records selected by req again with the
+// current transform version and loads the result, as one run with trigger
+// reprocess. Processed rows of earlier versions are kept, so they stay queryable
+// by transform_version.
+func (e *ETLService) Reprocess(ctx context.Context, req ReprocessRequest) (*database.PipelineRun, error) {
+	if e.dryRun {
+		return nil, ErrDryRun
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	batchSize := req.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultReplayBatch
+	}
+	if err := e.RecordTransformVersion(ctx); err != nil {
+		return nil, err
+	}
+	filter := req.RawDataFilter
+	filter.StaleFor = e.transformer.Load().Version()
+	total, err := e.db.CountRawData(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ID == "" {
+		req.ID = runid.New()
+	}
+	ctx, r := e.beginRun(ctx, database.PipelineRun{
+		RunID:     req.ID,
+		Trigger:   triggerReprocess,
+		StartedAt: time.Now().UTC(),
+	})
+	r.logger.Info(fmt.Sprintf("Reprocessing %d stored raw records: %s", total, filter))
+
+	err = e.replay(ctx, r, filter, batchSize, func(lastID int64) {
+		done := int64(r.RecordsExtracted)
+		r.logger.Info(fmt.Sprintf("Reprocessed %d of %d raw records (%.0f%%) up to raw_data id %d", done, total, percent(done, total), lastID))
+		if req.Progress != nil {
+			req.Progress(done, total)
+		}
+	})
+	e.finishRun(r, err)
+	if err != nil {
+		return &r.PipelineRun, err
+	}
+	r.logger.Info(fmt.Sprintf("Reprocess completed: %d records read, %d transformed, %d loaded with version %s", r.RecordsExtracted, r.RecordsTransformed, r.RecordsLoaded, filter.StaleFor))
+	return &r.PipelineRun, nil
+}
+
+// percent returns done as a percentage of total, 100 when there is nothing to do
+func percent(done, total int64) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(done) * 100 / float64(total)
+}
@@ -0,0 +1,32 @@
+package etl
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/backoff"
+)
+
+// SetRetryPolicy retries failed cycles according to policy before the next
+// scheduled one
+func (e *ETLService) SetRetryPolicy(policy backoff.Policy) {
+	e.retry = policy
+}
+
+// retryAt returns when to retry a cycle that ended with err after retries retries,
+// or the zero time when it succeeded or has no attempts left
+func (e *ETLService) retryAt(err error, retries int) time.Time {
+	if err == nil {
+		return time.Time{}
+	}
+	if retries+1 >= e.retry.MaxAttempts() {
+		if retries > 0 {
+			e.metrics.CycleRetriesExhaustedTotal.Inc()
+			e.logger.Error(fmt.Sprintf("Cycle failed after %d attempts, waiting for the next scheduled cycle: %v", retries+1, err))
+		}
+		return time.Time{}
+	}
+	delay := e.retry.Delay(retries + 1)
+	e.logger.Warn(fmt.Sprintf("Cycle failed, retrying in %v (attempt %d of %d): %v", delay, retries+2, e.retry.Attempts, err))
+	return time.Now().Add(delay)
+}
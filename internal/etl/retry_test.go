@@ -0,0 +1,35 @@
+package etl
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/backoff"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestRetryAt(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	e := NewETLService(nil, nil, nil, nil, nil, logger, metrics.NewMetrics(), nil)
+	failure := errors.New("api unavailable")
+
+	if !e.retryAt(failure, 0).IsZero() {
+		t.Error("Expected no retry with the default single attempt")
+	}
+
+	e.SetRetryPolicy(backoff.Policy{Attempts: 4, Backoff: time.Minute, MaxBackoff: 3 * time.Minute})
+	if !e.retryAt(nil, 0).IsZero() {
+		t.Error("Expected no retry after a successful cycle")
+	}
+	if at := e.retryAt(failure, 1); time.Until(at) < time.Minute || time.Until(at) > 2*time.Minute {
+		t.Errorf("Expected the second retry in 2m, got %v", time.Until(at))
+	}
+	if at := e.retryAt(failure, 2); time.Until(at) < 2*time.Minute || time.Until(at) > 3*time.Minute {
+		t.Errorf("Expected the third retry capped at 3m, got %v", time.Until(at))
+	}
+	if !e.retryAt(failure, 3).IsZero() {
+		t.Error("Expected no retry once all attempts failed")
+	}
+}
@@ -0,0 +1,170 @@
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+	"github.com/mohammedhassan/etl-pipeline/internal/storage"
+	"github.com/mohammedhassan/etl-pipeline/internal/tracing"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// Run triggers
+const (
+	triggerSchedule = "schedule"
+	triggerIngest   = "ingest"
+	triggerRetry    = "retry"
+	triggerOnce     = "once"
+)
+
+// run is one pass of the pipeline over a batch: a scheduled cycle or an ingested batch
+type run struct {
+	database.PipelineRun
+	// logger prefixes every message with the run ID
+	logger *logging.Logger
+	// checkpoint is the run's saved progress, nil when checkpoints are disabled
+	checkpoint *storage.Checkpoint
+	// snapshots are the batch snapshots written by the run, listed in its manifest entry
+	snapshots []storage.Snapshot
+	// span is the root span of the run's trace, ended by finishRun
+	span trace.Span
+	// duplicates counts the processed records skipped as loaded unchanged before
+	duplicates int
+	// quality counts the records of the run failing each quality check
+	quality transform.QualityCounts
+}
+
+// startRun records the start of a run and returns a context carrying its ID, which
+// sinks use to tag the records they write
+func (e *ETLService) startRun(ctx context.Context, trigger string) (context.Context, *run) {
+	return e.beginRun(ctx, database.PipelineRun{
+		RunID:     runid.New(),
+		Trigger:   trigger,
+		StartedAt: time.Now().UTC(),
+	})
+}
+
+// resumeRun restarts the run of an interrupted checkpoint under its original ID
+func (e *ETLService) resumeRun(ctx context.Context, checkpoint storage.Checkpoint) (context.Context, *run) {
+	ctx, r := e.beginRun(ctx, database.PipelineRun{
+		RunID:     checkpoint.RunID,
+		Trigger:   checkpoint.Trigger,
+		StartedAt: checkpoint.StartedAt,
+	})
+	r.checkpoint = &checkpoint
+	return ctx, r
+}
+
+func (e *ETLService) beginRun(ctx context.Context, pipelineRun database.PipelineRun) (context.Context, *run) {
+	pipelineRun.Pipeline = e.name
+	pipelineRun.Status = database.RunRunning
+	ctx = runid.WithID(ctx, pipelineRun.RunID)
+	ctx, span := tracing.Start(ctx, "etl.run",
+		attribute.String("etl.run_id", pipelineRun.RunID),
+		attribute.String("etl.trigger", pipelineRun.Trigger))
+	r := &run{
+		PipelineRun: pipelineRun,
+		logger:      e.logger.ForContext(ctx),
+		span:        span,
+	}
+	if err := e.db.StartRun(r.PipelineRun); err != nil {
+		r.logger.Warn(fmt.Sprintf("Failed to record run start: %v", err))
+	}
+	return ctx, r
+}
+
+// bind returns ctx carrying the ID and span of the run, for work of the run bound
+// to a context of its own such as extraction within the cycle budget
+func (r *run) bind(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(runid.WithID(ctx, r.RunID), r.span)
+}
+
+// validateRun sets the data-quality validation result of the records the run
+// transformed, if any, on the run record
+func (e *ETLService) validateRun(r *run) {
+	if r.quality.Checked == 0 {
+		return
+	}
+	result := e.transformer.Load().Validate("etl-pipeline."+e.name, r.RunID, r.StartedAt, r.quality)
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		r.logger.Warn(fmt.Sprintf("Failed to encode expectation results: %v", err))
+		return
+	}
+	r.Expectations = encoded
+	if !result.Success {
+		r.logger.Warn(fmt.Sprintf("%d of %d data-quality expectations failed", result.Statistics.UnsuccessfulExpectations, result.Statistics.EvaluatedExpectations))
+	}
+}
+
+// finishRun records the outcome of a run and its manifest entry; err is the error
+// that stopped it, if any
+func (e *ETLService) finishRun(r *run, err error) {
+	finishedAt := time.Now().UTC()
+	r.FinishedAt = &finishedAt
+	switch {
+	case err != nil:
+		r.Status = database.RunFailed
+		r.Error = err.Error()
+		r.ErrorCount++
+	case r.ErrorCount > 0:
+		r.Status = database.RunPartial
+	default:
+		r.Status = database.RunSucceeded
+	}
+
+	e.metrics.PipelineRunsTotal.WithLabelValues(r.Status).Inc()
+	e.markFresh(r)
+	r.span.SetAttributes(
+		attribute.String("etl.status", r.Status),
+		attribute.Int("etl.records_extracted", r.RecordsExtracted),
+		attribute.Int("etl.records_loaded", r.RecordsLoaded),
+		attribute.Int("etl.records_skipped", r.duplicates),
+		attribute.Int("etl.error_count", r.ErrorCount))
+	tracing.End(r.span, err)
+	e.validateRun(r)
+	if err := e.db.FinishRun(r.PipelineRun); err != nil {
+		r.logger.Warn(fmt.Sprintf("Failed to record run outcome: %v", err))
+	}
+	if err := e.storage.AppendManifest(storage.ManifestEntry{
+		RunID:      r.RunID,
+		Trigger:    r.Trigger,
+		Status:     r.Status,
+		StartedAt:  r.StartedAt,
+		FinishedAt: finishedAt,
+		Snapshots:  r.snapshots,
+	}); err != nil {
+		r.logger.Warn(fmt.Sprintf("Failed to append run to manifest: %v", err))
+	}
+
+	// The run manifest goes last, next to the batch files, marking the drop complete
+	location, err := e.snapshots.SaveRunManifest(storage.RunManifest{
+		RunID:         r.RunID,
+		Trigger:       r.Trigger,
+		Status:        r.Status,
+		StartedAt:     r.StartedAt,
+		FinishedAt:    finishedAt,
+		SchemaVersion: transform.SchemaVersion(),
+		Records: storage.RecordCounts{
+			Extracted:   r.RecordsExtracted,
+			Transformed: r.RecordsTransformed,
+			Rejected:    r.RecordsRejected,
+			Loaded:      r.RecordsLoaded,
+			Skipped:     r.duplicates,
+		},
+		Files: r.snapshots,
+	})
+	if err != nil {
+		r.logger.Warn(fmt.Sprintf("Failed to write run manifest: %v", err))
+		return
+	}
+	r.logger.Info(fmt.Sprintf("Run manifest written: %s (%d files)", location, len(r.snapshots)))
+}
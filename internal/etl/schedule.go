@@ -0,0 +1,68 @@
+package etl
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule decides when scheduled cycles run
+type Schedule interface {
+	// Next returns the first time after t a cycle is due
+	Next(t time.Time) time.Time
+}
+
+// intervalSchedule runs cycles at a fixed rate from its start, skipping the
+// ticks missed while a cycle overran, like a ticker
+type intervalSchedule struct {
+	interval time.Duration
+	start    time.Time
+}
+
+// Every returns a schedule running a cycle now and then every interval
+func Every(interval time.Duration) Schedule {
+	return &intervalSchedule{interval: interval, start: time.Now()}
+}
+
+func (s *intervalSchedule) Next(t time.Time) time.Time {
+	if t.Before(s.start) {
+		return s.start
+	}
+	return s.start.Add((t.Sub(s.start)/s.interval + 1) * s.interval)
+}
+
+// String describes the schedule in log messages
+func (s *intervalSchedule) String() string {
+	return fmt.Sprintf("every %v", s.interval)
+}
+
+// cronSchedule runs cycles at the times matched by a cron expression
+type cronSchedule struct {
+	cron.Schedule
+	expr     string
+	location *time.Location
+}
+
+// ParseCron parses a standard five-field cron expression, or a descriptor such as
+// @daily or @hourly, evaluated in the named time zone ("" or "Local" for the
+// system zone, e.g. "Europe/Berlin")
+func ParseCron(expr, timezone string) (Schedule, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule time zone %q: %w", timezone, err)
+	}
+	parsed, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	if spec, ok := parsed.(*cron.SpecSchedule); ok {
+		spec.Location = location
+	}
+	return &cronSchedule{Schedule: parsed, expr: expr, location: location}, nil
+}
+
+// String describes the schedule in log messages
+func (s *cronSchedule) String() string {
+	return fmt.Sprintf("cron %q (%s)", s.expr, s.location)
+}
@@ -0,0 +1,40 @@
+package etl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntervalSchedule(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	schedule := &intervalSchedule{interval: time.Minute, start: start}
+
+	// Ticks stay aligned to the start and the ones missed by a long cycle are skipped
+	if next := schedule.Next(start.Add(10 * time.Second)); !next.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected next tick at 12:01, got %v", next)
+	}
+	if next := schedule.Next(start.Add(150 * time.Second)); !next.Equal(start.Add(3 * time.Minute)) {
+		t.Errorf("Expected next tick at 12:03, got %v", next)
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	schedule, err := ParseCron("0 2,14 * * 1-5", "Europe/Berlin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	// Friday 15:00 in Berlin: the next run is Monday 02:00 Berlin time
+	next := schedule.Next(time.Date(2024, 5, 3, 15, 0, 0, 0, berlin))
+	if want := time.Date(2024, 5, 6, 2, 0, 0, 0, berlin); !next.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, next)
+	}
+
+	if _, err := ParseCron("0 25 * * *", "UTC"); err == nil {
+		t.Error("Expected invalid hour to be rejected")
+	}
+	if _, err := ParseCron("@daily", "Mars/Olympus"); err == nil {
+		t.Error("Expected unknown time zone to be rejected")
+	}
+}
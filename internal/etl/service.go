@@ -2,120 +2,1014 @@ package etl
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/mohammedhassan/etl-pipeline/internal/api"
+	"github.com/mohammedhassan/etl-pipeline/internal/backoff"
+	"github.com/mohammedhassan/etl-pipeline/internal/cache"
 	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/envelope"
 	"github.com/mohammedhassan/etl-pipeline/internal/logging"
 	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/sink"
 	"github.com/mohammedhassan/etl-pipeline/internal/storage"
+	"github.com/mohammedhassan/etl-pipeline/internal/tracing"
 	"github.com/mohammedhassan/etl-pipeline/internal/transform"
 )
 
 // ETLService orchestrates the ETL pipeline
 type ETLService struct {
-	apiClient   *api.Client
-	db          *database.PostgresDB
-	storage     *storage.FileStorage
-	transformer *transform.Transformer
+	apiClient api.Extractor
+	db        *database.PostgresDB
+	storage   *storage.FileStorage
+	// snapshots receives raw and processed batch snapshots, on local files or in an object store
+	snapshots storage.Storage
+	// transformer is replaced when the configuration is reloaded
+	transformer atomic.Pointer[transform.Transformer]
 	logger      *logging.Logger
 	metrics     *metrics.Metrics
+	loader      *sink.FanOut
+	// fileFallback keeps cycles running on local files while the database is down
+	fileFallback bool
+	// transactional stores raw and processed records of a batch atomically; the
+	// loader then holds only the other sinks
+	transactional bool
+	// checkpoints saves the progress of scheduled runs so they resume after a crash
+	checkpoints bool
+	// cycleBudget bounds the time spent extracting per cycle; zero means unbounded
+	cycleBudget time.Duration
+	// dag runs cycles through named steps instead of the fixed sequence, if set
+	dag *DAG
+	// cycleTimeout cancels a cycle running longer; zero means unbounded
+	cycleTimeout time.Duration
+	// overlapPolicy handles ticks due while a cycle is still running
+	overlapPolicy string
+	// retry re-runs failed cycles before the next scheduled one
+	retry backoff.Policy
+	// drainTimeout is how long shutdown waits for a running cycle before cancelling it
+	drainTimeout time.Duration
+	// stageTimeouts bound the store and load stages of runs
+	stageTimeouts StageTimeouts
+	// stream runs cycles through concurrent transform workers, if it has any
+	stream StreamConfig
+	// rawPassthrough stores raw records as the source sent them, when the extractor
+	// keeps their payloads
+	rawPassthrough bool
+	// rawBlobs keeps raw records in content-addressed blobs referenced from raw_data
+	rawBlobs bool
+	// enricher adds reference data to raw records before they are transformed, if set
+	enricher *enricher
+	// dedup holds the dedup key set of loaded records, if set, each key kept for dedupTTL
+	dedup    cache.Cache
+	dedupTTL time.Duration
+	// rawStorage decides which raw records are stored
+	rawStorage RawStorage
+	// deleteMode is how the processed records of source records marked as deleted
+	// are removed
+	deleteMode string
+	// changes receives the change events of loaded batches, if set
+	changes ChangePublisher
+	// notifiers are told about every finished cycle; notifying tracks deliveries
+	// still in progress
+	notifiers []CycleNotifier
+	notifying sync.WaitGroup
+	// pusher sends the metrics after every cycle, if set
+	pusher MetricsPusher
+
+	// name is the pipeline name runs are recorded under
+	name string
+	// source names the source in the lineage of processed records
+	source string
+	// cyclesRunning counts the cycles in progress
+	cyclesRunning atomic.Int32
+
+	// dryRun runs scheduled cycles without writing and rejects ingests and backfills
+	dryRun bool
+	// extractMu serializes cycles and dry runs, which share the extractor's progress
+	extractMu sync.Mutex
+
+	// backfillChunk and backfillParallelism are the defaults of backfill requests
+	backfillChunk       time.Duration
+	backfillParallelism int
+
+	// paused holds scheduled cycles until Resume; stateChanged wakes Start when it,
+	// or the schedule, changes
+	mu           sync.Mutex
+	paused       bool
+	stateChanged chan struct{}
+	// schedule replaces the schedule Start runs on, if set; scheduleChanged until
+	// Start picked it up
+	schedule        Schedule
+	scheduleChanged bool
+	// started is the schedule Start runs on and nextRun when its next cycle is due
+	started Schedule
+	nextRun time.Time
+	// backfills holds the IDs of running backfills
+	backfills map[string]bool
+	// lastLoaded is when a run last brought the processed data up to date
+	lastLoaded time.Time
+	// state is the scheduler state saved in stateStore, if set; stateMu serializes saves
+	state      database.SchedulerState
+	stateStore StateStore
+	stateMu    sync.Mutex
 }
 
 // NewETLService creates a new ETL service
 func NewETLService(
-	apiClient *api.Client,
+	apiClient api.Extractor,
 	db *database.PostgresDB,
 	storage *storage.FileStorage,
+	snapshots storage.Storage,
 	transformer *transform.Transformer,
 	logger *logging.Logger,
 	metrics *metrics.Metrics,
+	loader *sink.FanOut,
 ) *ETLService {
-	return &ETLService{
-		apiClient:   apiClient,
-		db:          db,
-		storage:     storage,
-		transformer: transformer,
-		logger:      logger,
-		metrics:     metrics,
+	e := &ETLService{
+		apiClient:           apiClient,
+		db:                  db,
+		storage:             storage,
+		snapshots:           snapshots,
+		logger:              logger,
+		metrics:             metrics,
+		loader:              loader,
+		name:                "default",
+		overlapPolicy:       OverlapSkip,
+		deleteMode:          database.DeleteModeSoft,
+		retry:               backoff.Policy{Attempts: 1},
+		backfillChunk:       24 * time.Hour,
+		backfillParallelism: 1,
+		stateChanged:        make(chan struct{}, 1),
+		backfills:           make(map[string]bool),
 	}
+	e.transformer.Store(transformer)
+	return e
 }
 
-// Start begins the ETL pipeline with the specified interval
-func (e *ETLService) Start(ctx context.Context, interval time.Duration) {
-	e.logger.Info(fmt.Sprintf("ETL pipeline started with interval: %v", interval))
+// SetFileFallback keeps cycles running on local files while the database is down
+func (e *ETLService) SetFileFallback(enabled bool) {
+	e.fileFallback = enabled
+}
 
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// SetTransactional stores the raw and processed records of a batch in one
+// database transaction, leaving the loader only the other sinks
+func (e *ETLService) SetTransactional(enabled bool) {
+	e.transactional = enabled
+}
+
+// SetCheckpoints saves the progress of scheduled runs so they resume after a crash
+func (e *ETLService) SetCheckpoints(enabled bool) {
+	e.checkpoints = enabled
+}
+
+// SetCycleBudget bounds the time spent extracting per cycle; zero means unbounded
+func (e *ETLService) SetCycleBudget(budget time.Duration) {
+	e.cycleBudget = budget
+}
+
+// Start runs the pipeline on schedule, or the one set by SetSchedule, until ctx is
+// cancelled. Interval schedules also run a cycle immediately, cron schedules wait
+// for their first match. A tick due while a cycle is still running is handled by
+// the overlap policy. Once ctx is cancelled no cycle is started, and a running one
+// is drained and its notifications delivered before Start returns.
+func (e *ETLService) Start(ctx context.Context, schedule Schedule) {
+	if reloaded, _ := e.takeSchedule(); reloaded != nil {
+		schedule = reloaded
+	}
+	e.logger.Info(fmt.Sprintf("ETL pipeline started, running %v", schedule))
 
-	// Run immediately on start
-	e.runPipeline()
+	// Cycles outlive ctx so shutdown can let them finish; drain cancels them
+	cycleCtx := context.WithoutCancel(ctx)
 
+	_, interval := schedule.(*intervalSchedule)
+	// runNow is set for the first cycle of interval schedules and for continuations
+	// picking up the remainder of a cut-short cycle without waiting for the next run;
+	// queued for a tick held back by the queue policy
+	runNow, queued := interval, false
+	var running *cycle
+	var lastNext time.Time
+	// retryAt is when the last, failed cycle is retried, zero if it is not; retries
+	// counts the retries since the last scheduled cycle
+	var retryAt time.Time
+	retries := 0
+	schedule, runNow, retryAt, retries = e.restoreState(schedule, runNow)
 	for {
+		paused := e.Paused()
+		if running == nil && !paused {
+			switch {
+			case runNow || queued:
+				runNow, queued = false, false
+				retryAt, retries = time.Time{}, 0
+				e.saveState(func(state *database.SchedulerState) {
+					*state = database.SchedulerState{LastTick: time.Now(), Running: true}
+				})
+				running = e.startCycle(cycleCtx, triggerSchedule)
+				continue
+			case !retryAt.IsZero() && !time.Now().Before(retryAt):
+				retryAt = time.Time{}
+				retries++
+				e.metrics.CycleRetriesTotal.Inc()
+				e.saveState(func(state *database.SchedulerState) {
+					state.Running, state.RetryAt, state.Retries = true, time.Time{}, retries
+				})
+				running = e.startCycle(cycleCtx, triggerRetry)
+				continue
+			}
+		}
+
+		// No ticks are due while paused; a running cycle is left to finish
+		var tick <-chan time.Time
+		var timer *time.Timer
+		if paused {
+			e.setNextRun(schedule, time.Time{})
+		} else {
+			next := schedule.Next(time.Now())
+			e.metrics.NextCycleTimestamp.Set(float64(next.Unix()))
+			e.setNextRun(schedule, next)
+			if !interval && !next.Equal(lastNext) {
+				e.logger.Info(fmt.Sprintf("Next cycle at %s", next.Format(time.RFC3339)))
+			}
+			lastNext = next
+			timer = time.NewTimer(time.Until(next))
+			tick = timer.C
+		}
+
+		var retry <-chan time.Time
+		var retryTimer *time.Timer
+		if !paused && running == nil && !retryAt.IsZero() {
+			retryTimer = time.NewTimer(time.Until(retryAt))
+			retry = retryTimer.C
+		}
+
+		var done <-chan cycleResult
+		if running != nil {
+			done = running.done
+		}
 		select {
 		case <-ctx.Done():
+			if running != nil {
+				if result, finished := e.drain(running); finished {
+					// A cancelled cycle is left running in the saved state, so the
+					// next start runs it again
+					e.saveState(func(state *database.SchedulerState) {
+						state.Running, state.Continuation = false, result.continuation
+					})
+				}
+			}
+			e.notifying.Wait()
+			e.setNextRun(nil, time.Time{})
 			e.logger.Info("ETL pipeline stopped")
 			return
-		case <-ticker.C:
-			e.runPipeline()
+		case <-e.stateChanged:
+			if next, changed := e.takeSchedule(); changed {
+				schedule = next
+				_, interval = schedule.(*intervalSchedule)
+				e.logger.Info(fmt.Sprintf("Schedule changed, running %v", schedule))
+			}
+			if s, ok := schedule.(*intervalSchedule); ok && paused && !e.Paused() {
+				// Restart the ticker, running a cycle on resume
+				schedule = Every(s.interval)
+				runNow = true
+			}
+		case result := <-done:
+			running.finish(result)
+			running = nil
+			runNow = runNow || result.continuation
+			retryAt = e.retryAt(result.err, retries)
+			e.saveState(func(state *database.SchedulerState) {
+				state.Running, state.Continuation = false, result.continuation
+				state.RetryAt, state.Retries = retryAt, retries
+			})
+		case <-retry:
+		case <-tick:
+			if running == nil {
+				runNow = true
+			} else {
+				queued = e.overlap(running, queued)
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if retryTimer != nil {
+			retryTimer.Stop()
+		}
+	}
+}
+
+// RunOnce runs a single cycle, for running the pipeline from cron or as a batch
+// job instead of on a schedule. A cycle cut short by its budget is continued and a
+// failed one retried by the retry policy; notifications are delivered before it
+// returns the status of the last run, empty for dry runs, and its error.
+func (e *ETLService) RunOnce(ctx context.Context) (string, error) {
+	defer e.notifying.Wait()
+	trigger, retries := triggerOnce, 0
+	for {
+		result := e.startCycle(ctx, trigger).wait()
+		if result.continuation && ctx.Err() == nil {
+			retries = 0
+			continue
 		}
+		retryAt := e.retryAt(result.err, retries)
+		if retryAt.IsZero() {
+			return result.status, result.err
+		}
+		select {
+		case <-ctx.Done():
+			return result.status, result.err
+		case <-time.After(time.Until(retryAt)):
+		}
+		trigger, retries = triggerRetry, retries+1
+		e.metrics.CycleRetriesTotal.Inc()
+	}
+}
+
+// Pause holds scheduled cycles until Resume, letting a running cycle finish. It
+// reports whether the pipeline was running.
+func (e *ETLService) Pause() bool {
+	if !e.setPaused(true) {
+		return false
+	}
+	e.saveState(nil)
+	e.logger.Info("ETL pipeline paused")
+	return true
+}
+
+// Resume restarts scheduled cycles of a paused pipeline; interval schedules run a
+// cycle right away. It reports whether the pipeline was paused.
+func (e *ETLService) Resume() bool {
+	if !e.setPaused(false) {
+		return false
+	}
+	e.saveState(nil)
+	e.logger.Info("ETL pipeline resumed")
+	return true
+}
+
+// Paused reports whether scheduled cycles are paused
+func (e *ETLService) Paused() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.paused
+}
+
+// setPaused changes the paused state and reports whether it changed
+func (e *ETLService) setPaused(paused bool) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.paused == paused {
+		return false
+	}
+	e.paused = paused
+	if paused {
+		e.metrics.PipelinePaused.Set(1)
+	} else {
+		e.metrics.PipelinePaused.Set(0)
+	}
+	e.notifyStateChanged()
+	return true
+}
+
+// notifyStateChanged wakes Start to look at the paused state and schedule
+func (e *ETLService) notifyStateChanged() {
+	select {
+	case e.stateChanged <- struct{}{}:
+	default:
+	}
+}
+
+// runCycle runs one pipeline iteration within the cycle budget and timeout. It
+// reports whether extraction was cut short, leaving a continuation for the next
+// cycle, the status of its run, empty for dry runs, and the error that failed the
+// cycle, if any.
+func (e *ETLService) runCycle(ctx context.Context, trigger string) (bool, string, error) {
+	e.metrics.CycleInProgress.Inc()
+	defer e.metrics.CycleInProgress.Dec()
+	e.cyclesRunning.Add(1)
+	defer e.cyclesRunning.Add(-1)
+	if e.cycleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.cycleTimeout)
+		defer cancel()
+		defer func() {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				e.metrics.CyclesCancelledTotal.WithLabelValues("timeout").Inc()
+				e.logger.Warn(fmt.Sprintf("Cycle cancelled after reaching its %v timeout", e.cycleTimeout))
+			}
+		}()
 	}
+	if e.dryRun {
+		e.dryRunCycle(ctx)
+		return false, "", nil
+	}
+	start := time.Now()
+	extractCtx := ctx
+	if e.cycleBudget > 0 {
+		var cancel context.CancelFunc
+		extractCtx, cancel = context.WithDeadline(ctx, start.Add(e.cycleBudget))
+		defer cancel()
+	}
+
+	continuation, r, err := e.runPipeline(ctx, extractCtx, trigger)
+	if err != nil {
+		e.metrics.LastCycleSuccess.Set(0)
+	} else {
+		e.metrics.LastCycleSuccess.Set(1)
+		e.metrics.LastSuccessfulRunTimestamp.SetToCurrentTime()
+	}
+
+	duration := time.Since(start)
+	metrics.ObserveWithTrace(r.bind(ctx), e.metrics.CycleDuration, duration.Seconds())
+	if e.cycleBudget > 0 && (continuation || duration > e.cycleBudget) {
+		e.metrics.CycleBudgetOverrunsTotal.Inc()
+		e.logger.Warn(fmt.Sprintf("Cycle exceeded its %v budget (%.2fs)", e.cycleBudget, duration.Seconds()))
+	}
+	if continuation {
+		e.metrics.CycleContinuationsTotal.Inc()
+	}
+	return continuation, r.Status, err
 }
 
-// runPipeline executes one iteration of the ETL pipeline
-func (e *ETLService) runPipeline() {
-	e.logger.Info("========== Starting ETL Pipeline Cycle ==========")
+// runPipeline executes one iteration of the ETL pipeline. Extraction is bound to
+// extractCtx; records fetched before it expires are still loaded and committed, and
+// true is returned so the remainder is fetched by a continuation cycle, along with
+// the run.
+func (e *ETLService) runPipeline(ctx, extractCtx context.Context, trigger string) (bool, *run, error) {
+	e.extractMu.Lock()
+	defer e.extractMu.Unlock()
+
+	ctx, r := e.startRun(ctx, trigger)
+	// Extraction has its own deadline but belongs to the run all the same
+	extractCtx = r.bind(extractCtx)
+	r.logger.Info("========== Starting ETL Pipeline Cycle ==========")
 	startTime := time.Now()
 
+	// Load batches stored during a database outage and finish interrupted runs
+	// before adding new ones
+	e.loadPendingBatches(ctx)
+	if e.checkpoints {
+		e.resumeRuns(ctx)
+	}
+
+	var partial bool
+	var err error
+	if e.dag != nil {
+		partial, err = e.runDAG(ctx, extractCtx, r)
+	} else {
+		partial, err = e.runSource(ctx, extractCtx, r)
+	}
+	if err != nil {
+		e.finishRun(r, err)
+		e.notifyCycle(ctx, r)
+		if r.checkpoint != nil {
+			r.logger.Warn("Run failed, it will be resumed from its checkpoint next cycle")
+		}
+		return false, r, err
+	}
+	e.endCheckpoint(r)
+	e.finishRun(r, nil)
+	e.notifyCycle(ctx, r)
+
+	duration := time.Since(startTime)
+	r.logger.Info(fmt.Sprintf("========== ETL Pipeline Cycle Completed in %.2fs ==========", duration.Seconds()))
+	return partial, r, nil
+}
+
+// runSource extracts a batch from the pipeline's source and processes it,
+// reporting whether extraction was cut short
+func (e *ETLService) runSource(ctx, extractCtx context.Context, r *run) (bool, error) {
+	if e.stream.Workers > 0 && !e.checkpoints {
+		return e.runStream(ctx, extractCtx, r)
+	}
+
 	// 1. Extract: Fetch data from API
-	rawData, err := e.apiClient.FetchData()
+	partial := false
+	extractCtx, span := tracing.Start(extractCtx, "etl.extract")
+	rawData, payloads, batches, err := e.fetchBatch(extractCtx)
+	span.SetAttributes(attribute.Int("etl.records", len(rawData)))
+	switch {
+	case errors.Is(err, api.ErrPartial) && len(rawData) > 0:
+		partial = true
+		span.SetAttributes(attribute.Bool("etl.partial", true))
+		span.End()
+		r.logger.Warn(fmt.Sprintf("Extraction stopped by the cycle budget, loading %d records fetched so far: %v", len(rawData), err))
+	case err != nil:
+		tracing.End(span, err)
+		r.logger.Error(fmt.Sprintf("Extraction failed: %v", err))
+		e.nackBatches(r, batches, err)
+		return false, err
+	default:
+		span.End()
+	}
+	r.RecordsExtracted = len(rawData)
+
+	onDurable := e.commitExtraction
+	if batches != nil {
+		onDurable = func() {
+			e.commitExtraction()
+			e.ackBatches(r, batches)
+		}
+	}
+	if e.checkpoints && e.beginCheckpoint(r, rawData) {
+		// The batch survives a crash in its checkpoint, so progress can be committed now
+		onDurable()
+		onDurable = nil
+	}
+	err = e.processBatch(ctx, r, rawData, payloads, onDurable)
+	e.nackBatches(r, batches, err)
+	return partial, err
+}
+
+// Ingest loads a batch handed off by another instance or tool, as if it had been
+// extracted by this one. Processed batches skip straight to the sinks.
+func (e *ETLService) Ingest(ctx context.Context, batch *envelope.Envelope) error {
+	if e.dryRun {
+		return ErrDryRun
+	}
+	ctx, r := e.startRun(ctx, triggerIngest)
+	r.logger.Info(fmt.Sprintf("Ingesting %s batch %s from %s: %d records", batch.Kind, batch.BatchID, batch.Producer, batch.RecordCount))
+	r.RecordsExtracted = batch.RecordCount
+
+	err := e.ingest(ctx, r, batch)
+	e.finishRun(r, err)
+	return err
+}
+
+func (e *ETLService) ingest(ctx context.Context, r *run, batch *envelope.Envelope) error {
+	switch batch.Kind {
+	case envelope.KindRaw:
+		records, err := batch.RawRecords()
+		if err != nil {
+			return err
+		}
+		return e.processBatch(ctx, r, records, nil, nil)
+	case envelope.KindProcessed:
+		records, err := batch.ProcessedRecords()
+		if err != nil {
+			return err
+		}
+		var pending storage.PendingBatch
+		if e.transactional {
+			storeCtx, endStore := e.beginStage(ctx, r.logger, stageStore, e.stageTimeouts.Store)
+			err = e.insertBatch(storeCtx, r, nil, nil, nil, records, nil)
+			endStore()
+			if err != nil {
+				if !e.fileFallback {
+					return err
+				}
+				r.ErrorCount++
+				pending.Processed = records
+			}
+		}
+		e.loadProcessed(ctx, r, records, &pending)
+		if pending.Processed != nil {
+			e.savePendingBatch(ctx, r, pending, nil)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported batch kind %q", batch.Kind)
+}
+
+// processBatch stores, transforms and loads a batch of raw records. payloads hold
+// the JSON of each record as received, if kept. onDurable is called once the raw
+// records are stored, in the database or a pending batch.
+func (e *ETLService) processBatch(ctx context.Context, r *run, rawData []map[string]interface{}, payloads []json.RawMessage, onDurable func()) error {
+	if e.transactional {
+		return e.processBatchAtomic(ctx, r, rawData, payloads, onDurable)
+	}
+
+	// 2. Transform: Process the data
+	transformedData, err := e.transformBatch(ctx, rawData)
 	if err != nil {
-		e.logger.Error(fmt.Sprintf("Extraction failed: %v", err))
-		return
+		r.logger.Error(fmt.Sprintf("Transformation failed: %v", err))
+		return err
+	}
+	e.countTransformed(r, len(rawData), transformedData)
+
+	// 3-4. Store raw data in database and snapshot storage, unless a resumed run did
+	var pending storage.PendingBatch
+	var ids []int64
+	if r.checkpoint == nil || r.checkpoint.Stage == storage.StageExtracted {
+		if ids, onDurable, err = e.storeRaw(ctx, r, rawData, payloads, transformedData, onDurable, &pending); err != nil {
+			return err
+		}
+	}
+	e.traceLineage(transformedData.Records, rawHashes(rawData, payloads), ids)
+	e.loadTransformed(ctx, r, transformedData, &pending, onDurable)
+	return nil
+}
+
+// loadTransformed stores the audit trail of a transformed batch and loads its
+// records but those loaded unchanged before, keeping whatever the database missed
+// in a pending batch
+func (e *ETLService) loadTransformed(ctx context.Context, r *run, transformedData *transform.TransformedData, pending *storage.PendingBatch, onDurable func()) {
+	keys := e.skipDuplicates(ctx, r, transformedData)
+	events := e.detectChanges(ctx, r, transformedData)
+	if len(transformedData.Audits) > 0 {
+		storeCtx, endStore := e.beginStage(ctx, r.logger, stageStore, e.stageTimeouts.Store)
+		if err := e.db.InsertTransformAudits(storeCtx, r.RunID, transformedData.Audits); err != nil {
+			r.logger.Warn(fmt.Sprintf("Failed to store transformation audit trail: %v", err))
+			r.ErrorCount++
+		}
+		endStore()
+	}
+
+	// 5-6. Load processed data into all sinks and save a snapshot of it, then
+	// remove the records the source deleted and publish the changes
+	loaded := e.loadProcessed(ctx, r, transformedData.Records, pending)
+	deleteErr := e.applyDeletes(ctx, r, transformedData.Deleted)
+	e.publishChanges(ctx, r, events, pending.Processed == nil, deleteErr == nil)
+	if loaded {
+		e.markLoaded(ctx, r, keys)
+	}
+	if deleteErr == nil {
+		e.forgetDeleted(ctx, r, transformedData.Deleted)
 	}
 
-	// 2. Store raw data in database
+	// 7. Keep whatever the database missed until it recovers. A batch whose raw
+	// records were not all stored is durable once loaded.
+	if pending.Raw != nil || pending.Processed != nil {
+		e.savePendingBatch(ctx, r, *pending, onDurable)
+	} else if loaded && onDurable != nil {
+		onDurable()
+	}
+}
+
+// storeRaw inserts the raw records of a transformed batch the raw storage keeps
+// into the database and saves them to the file system, adding them to pending when
+// the database is down. Records with payloads are stored as received; with raw
+// blobs the rows reference the blob instead. It returns the raw_data id of each
+// record, if they were inserted, and onDurable unless it was called, because the
+// whole batch is durable now.
+func (e *ETLService) storeRaw(ctx context.Context, r *run, rawData []map[string]interface{}, payloads []json.RawMessage, transformed *transform.TransformedData, onDurable func(), pending *storage.PendingBatch) ([]int64, func(), error) {
+	ctx, endStore := e.beginStage(ctx, r.logger, stageStore, e.stageTimeouts.Store)
+	defer endStore()
+
+	n := len(rawData)
+	lines := e.keptRaw(n, transformed)
+	if lines != nil {
+		if skipped := n - len(lines); skipped > 0 {
+			e.metrics.RawRecordsSkippedTotal.Add(float64(skipped))
+			r.logger.Info(fmt.Sprintf("Storing %d of %d raw records, raw storage is %s", len(lines), n, e.rawStorage.Mode))
+		}
+		rawData, payloads = rawLines(rawData, payloads, lines)
+		if len(rawData) == 0 {
+			e.advanceCheckpoint(r, storage.StageStored)
+			return nil, onDurable, nil
+		}
+	}
+
+	blob, err := e.saveRawBlob(r, rawData, payloads)
+	if err != nil {
+		r.logger.Error(fmt.Sprintf("Failed to save raw blob: %v", err))
+		return nil, onDurable, err
+	}
 	e.metrics.DatabaseWritesTotal.Inc()
-	if err := e.db.InsertRawData(rawData); err != nil {
-		e.metrics.DatabaseWriteErrorsTotal.Inc()
-		e.logger.Error(fmt.Sprintf("Failed to insert raw data into database: %v", err))
-		return
+	var ids []int64
+	switch {
+	case blob != nil:
+		ids, err = e.db.InsertRawBlob(ctx, r.RunID, *blob)
+	case payloads != nil:
+		ids, err = e.db.InsertRawPayloads(ctx, r.RunID, payloads)
+	default:
+		ids, err = e.db.InsertRawData(ctx, r.RunID, rawData)
+	}
+	if err != nil {
+		e.metrics.DatabaseWriteErrorsTotal.WithLabelValues(database.ErrorReason(err)).Inc()
+		if !e.fileFallback {
+			r.logger.Error(fmt.Sprintf("Failed to insert raw data into database: %v", err))
+			return nil, onDurable, err
+		}
+		r.logger.Warn(fmt.Sprintf("Database unavailable, continuing in file-only mode: %v", err))
+		r.ErrorCount++
+		pending.Raw = rawData
+	} else {
+		r.logger.Info(fmt.Sprintf("Raw data inserted into database: %d records", len(rawData)))
+		// Raw data is durable now, so extraction progress can be committed
+		if onDurable != nil && len(rawData) == n {
+			onDurable()
+			onDurable = nil
+		}
+	}
+
+	if blob == nil {
+		e.saveRawSnapshot(ctx, r, rawData, payloads)
+	}
+
+	if pending.Raw == nil {
+		e.advanceCheckpoint(r, storage.StageStored)
+	}
+	if lines != nil {
+		ids = spreadIDs(ids, lines, n)
 	}
-	e.logger.Info(fmt.Sprintf("Raw data inserted into database: %d records", len(rawData)))
+	return ids, onDurable, nil
+}
 
-	// 3. Save raw data to file system
-	if err := e.storage.SaveRawData(rawData); err != nil {
-		e.logger.Error(fmt.Sprintf("Failed to save raw data to file: %v", err))
-		// Continue even if file save fails
+// processBatchAtomic transforms a batch of raw records before storing them, then
+// inserts raw and processed records in one transaction. When the transaction fails
+// nothing is stored and, without file fallback, the batch is fetched again next cycle.
+func (e *ETLService) processBatchAtomic(ctx context.Context, r *run, rawData []map[string]interface{}, payloads []json.RawMessage, onDurable func()) error {
+	// 2. Transform: Process the data
+	transformedData, err := e.transformBatch(ctx, rawData)
+	if err != nil {
+		r.logger.Error(fmt.Sprintf("Transformation failed: %v", err))
+		return err
+	}
+	e.countTransformed(r, len(rawData), transformedData)
+	e.traceLineage(transformedData.Records, rawHashes(rawData, payloads), nil)
+	return e.storeAtomic(ctx, r, rawData, payloads, transformedData, onDurable)
+}
+
+// storeAtomic inserts the raw records of a transformed batch the raw storage keeps
+// and its processed records in one transaction and loads the processed records
+// into the other sinks
+func (e *ETLService) storeAtomic(ctx context.Context, r *run, rawData []map[string]interface{}, payloads []json.RawMessage, transformedData *transform.TransformedData, onDurable func()) error {
+	// 3. Store raw and processed data in one transaction, unless a resumed run did
+	storeCtx, endStore := e.beginStage(ctx, r.logger, stageStore, e.stageTimeouts.Store)
+	var pending storage.PendingBatch
+	// The raw records kept are chosen before duplicates leave the batch, which
+	// would otherwise count as rejected
+	lines := e.keptRaw(len(rawData), transformedData)
+	keys := e.skipDuplicates(storeCtx, r, transformedData)
+	processed := transformedData.Records
+	if lines != nil {
+		if skipped := len(rawData) - len(lines); skipped > 0 {
+			e.metrics.RawRecordsSkippedTotal.Add(float64(skipped))
+			r.logger.Info(fmt.Sprintf("Storing %d of %d raw records, raw storage is %s", len(lines), len(rawData), e.rawStorage.Mode))
+		}
+		rawData, payloads = rawLines(rawData, payloads, lines)
+		processed = relinkLineage(processed, lines)
+	}
+	var blob *database.RawBlob
+	var err error
+	if lines == nil || len(lines) > 0 {
+		blob, err = e.saveRawBlob(r, rawData, payloads)
+	}
+	if err != nil {
+		endStore()
+		r.logger.Error(fmt.Sprintf("Failed to save raw blob, the batch will be retried: %v", err))
+		return err
+	}
+	events := e.detectChanges(storeCtx, r, transformedData)
+	if r.checkpoint != nil && r.checkpoint.Stage == storage.StageStored {
+		r.logger.Info("Batch already inserted into database before the run was interrupted")
+	} else if err := e.insertBatch(storeCtx, r, rawData, payloads, blob, processed, transformedData.Audits); err != nil {
+		if !e.fileFallback {
+			endStore()
+			r.logger.Error(fmt.Sprintf("Failed to insert batch into database, it will be retried: %v", err))
+			return err
+		}
+		r.logger.Warn(fmt.Sprintf("Database unavailable, continuing in file-only mode: %v", err))
+		r.ErrorCount++
+		pending.Raw = rawData
+		pending.Processed = transformedData.Records
 	} else {
-		e.metrics.DataSavedTotal.Inc()
+		r.logger.Info(fmt.Sprintf("Batch inserted into database: %d raw and %d processed records", len(rawData), len(transformedData.Records)))
+		if lines != nil {
+			copyRawDataIDs(transformedData.Records, processed)
+		}
+		if onDurable != nil {
+			onDurable()
+		}
+		e.advanceCheckpoint(r, storage.StageStored)
+	}
+
+	// 4. Save a snapshot of the raw data, unless the blob holds it
+	if blob == nil && (lines == nil || len(lines) > 0) {
+		e.saveRawSnapshot(storeCtx, r, rawData, payloads)
+	}
+	endStore()
+
+	// 5-6. Load processed data into the other sinks and save a snapshot of it, then
+	// remove the records the source deleted and publish the changes
+	loaded := e.loadProcessed(ctx, r, transformedData.Records, &pending)
+	deleteErr := e.applyDeletes(ctx, r, transformedData.Deleted)
+	e.publishChanges(ctx, r, events, pending.Raw == nil, deleteErr == nil)
+	if loaded {
+		e.markLoaded(ctx, r, keys)
+	}
+	if deleteErr == nil {
+		e.forgetDeleted(ctx, r, transformedData.Deleted)
 	}
 
-	// 4. Transform: Process the data
-	transformedData, err := e.transformer.Transform(rawData)
+	// 7. Keep the batch until the database recovers
+	if pending.Raw != nil {
+		e.savePendingBatch(ctx, r, pending, onDurable)
+	}
+	return nil
+}
+
+// countTransformed records the transformation outcome of a batch in its run
+func (e *ETLService) countTransformed(r *run, raw int, transformed *transform.TransformedData) {
+	r.RecordsTransformed += len(transformed.Records)
+	r.RecordsRejected += raw - len(transformed.Records) - len(transformed.Deleted)
+	r.quality.Add(transformed.Quality)
+}
+
+// saveRawSnapshot saves a snapshot of raw records, as received when their payloads
+// were kept, and adds it to the run. A failed snapshot is counted, not fatal.
+func (e *ETLService) saveRawSnapshot(ctx context.Context, r *run, rawData []map[string]interface{}, payloads []json.RawMessage) {
+	var snapshot storage.Snapshot
+	var err error
+	if payloads != nil {
+		snapshot, err = e.snapshots.SaveRawPayloads(ctx, rawData, payloads)
+	} else {
+		snapshot, err = e.snapshots.SaveRawData(ctx, rawData)
+	}
 	if err != nil {
-		e.logger.Error(fmt.Sprintf("Transformation failed: %v", err))
+		r.logger.Error(fmt.Sprintf("Failed to save raw data snapshot: %v", err))
+		r.ErrorCount++
+		// Continue even if the snapshot fails
 		return
 	}
+	r.snapshots = append(r.snapshots, snapshot)
+	e.metrics.DataSavedTotal.Inc()
+}
 
-	// 5. Store processed data in database
+// insertBatch stores records of a run in one transaction, recording database and
+// postgres sink metrics. Raw records with payloads are stored as received, and
+// raw records kept in blob as references to it.
+func (e *ETLService) insertBatch(ctx context.Context, r *run, raw []map[string]interface{}, payloads []json.RawMessage, blob *database.RawBlob, processed []database.ProcessedRecord, audits []database.RecordAudit) error {
+	ctx, span := tracing.Start(ctx, "db.insert_batch",
+		attribute.Int("etl.raw_records", len(raw)),
+		attribute.Int("etl.processed_records", len(processed)))
 	e.metrics.DatabaseWritesTotal.Inc()
-	if err := e.db.InsertProcessedData(transformedData.Records); err != nil {
-		e.metrics.DatabaseWriteErrorsTotal.Inc()
-		e.logger.Error(fmt.Sprintf("Failed to insert processed data into database: %v", err))
-		return
+	var err error
+	switch {
+	case blob != nil:
+		err = e.db.InsertBatchBlob(ctx, r.RunID, *blob, processed, audits)
+	case payloads != nil:
+		err = e.db.InsertBatchPayloads(ctx, r.RunID, payloads, processed, audits)
+	default:
+		err = e.db.InsertBatch(ctx, r.RunID, raw, processed, audits)
 	}
-	e.logger.Info(fmt.Sprintf("Processed data inserted into database: %d records", len(transformedData.Records)))
+	if err != nil {
+		tracing.End(span, err)
+		e.metrics.DatabaseWriteErrorsTotal.WithLabelValues(database.ErrorReason(err)).Inc()
+		e.metrics.SinkWriteErrorsTotal.WithLabelValues(sink.PostgresSinkName).Add(float64(len(processed)))
+		return err
+	}
+	span.End()
+	e.metrics.SinkRecordsWrittenTotal.WithLabelValues(sink.PostgresSinkName).Add(float64(len(processed)))
+	return nil
+}
+
+// loadProcessed writes processed records to all sinks and the file system, adding
+// them to pending when the database sink missed them. Records count as loaded by
+// the run once every sink and the database have them; it reports whether they were.
+func (e *ETLService) loadProcessed(ctx context.Context, r *run, records []database.ProcessedRecord, pending *storage.PendingBatch) bool {
+	ctx, endLoad := e.beginStage(ctx, r.logger, stageLoad, e.stageTimeouts.Load)
+	defer endLoad()
 
-	// 6. Save processed data to file system
-	if err := e.storage.SaveProcessedData(transformedData); err != nil {
-		e.logger.Error(fmt.Sprintf("Failed to save processed data to file: %v", err))
-		// Continue even if file save fails
+	failed := 0
+	var loaded []string
+	for _, result := range e.loader.WriteExcept(ctx, records, r.loadedSinks()) {
+		if result.Err != nil {
+			r.logger.Error(fmt.Sprintf("Failed to load processed data into %s after %d attempts: %v", result.Sink, result.Attempts, result.Err))
+			failed++
+			if e.fileFallback && result.Sink == sink.PostgresSinkName {
+				pending.Processed = records
+				var partial *sink.PartialWriteError
+				if errors.As(result.Err, &partial) {
+					// Only the partitions not written are replayed
+					pending.Processed = partial.Remaining
+				}
+			}
+			continue
+		}
+		r.logger.Info(fmt.Sprintf("Processed data loaded into %s: %d records in %.2fs", result.Sink, len(records), result.Duration.Seconds()))
+		loaded = append(loaded, result.Sink)
+	}
+	if len(loaded) > 0 && r.checkpoint != nil {
+		e.advanceCheckpoint(r, r.checkpoint.Stage, loaded...)
+	}
+	r.ErrorCount += failed
+	complete := failed == 0 && pending.Processed == nil
+	if complete {
+		r.RecordsLoaded += len(records)
+	}
+
+	if snapshot, err := e.snapshots.SaveProcessedData(ctx, records); err != nil {
+		r.logger.Error(fmt.Sprintf("Failed to save processed data snapshot: %v", err))
+		r.ErrorCount++
+		// Continue even if the snapshot fails
 	} else {
+		r.snapshots = append(r.snapshots, snapshot)
 		e.metrics.DataSavedTotal.Inc()
 	}
+	return complete
+}
 
-	duration := time.Since(startTime)
-	e.logger.Info(fmt.Sprintf("========== ETL Pipeline Cycle Completed in %.2fs ==========", duration.Seconds()))
+// commitExtraction commits extraction progress if the extractor tracks it
+func (e *ETLService) commitExtraction() {
+	if committer, ok := e.apiClient.(api.Committer); ok {
+		if err := committer.Commit(); err != nil {
+			e.logger.Error(fmt.Sprintf("Failed to commit extraction progress: %v", err))
+		}
+	}
+}
+
+// savePendingBatch stores a batch of a run the database missed, calling onDurable
+// once the batch is durable on disk
+func (e *ETLService) savePendingBatch(ctx context.Context, r *run, batch storage.PendingBatch, onDurable func()) {
+	batch.CreatedAt = time.Now().UTC()
+	batch.RunID = r.RunID
+	batch.Batch = database.LoadBatch(ctx)
+	if _, err := e.storage.SavePendingBatch(batch); err != nil {
+		r.logger.Error(fmt.Sprintf("Failed to save pending batch, data will be fetched again: %v", err))
+		return
+	}
+	e.metrics.PendingBatches.Inc()
+	if onDurable != nil {
+		onDurable()
+	}
+}
+
+// loadPendingBatches bulk-loads the batches stored during a database outage, oldest
+// first; each batch is bounded by the store timeout
+func (e *ETLService) loadPendingBatches(ctx context.Context) {
+	files, err := e.storage.PendingBatches()
+	if err != nil {
+		e.logger.Error(fmt.Sprintf("Failed to list pending batches: %v", err))
+		return
+	}
+	e.metrics.PendingBatches.Set(float64(len(files)))
+	if len(files) == 0 {
+		return
+	}
+	if err := e.db.HealthCheck(); err != nil {
+		e.logger.Warn(fmt.Sprintf("Database still unavailable, %d batches pending", len(files)))
+		return
+	}
+
+	loaded := 0
+	for _, file := range files {
+		batch, err := e.storage.LoadPendingBatch(file)
+		if err != nil {
+			// Leave unreadable batches in place for inspection
+			e.logger.Error(fmt.Sprintf("Skipping pending batch: %v", err))
+			continue
+		}
+
+		if !e.loadPendingBatch(ctx, file, batch) {
+			break
+		}
+
+		if err := e.storage.RemovePendingBatch(file); err != nil {
+			e.logger.Error(err.Error())
+			break
+		}
+		loaded++
+		e.metrics.PendingBatches.Dec()
+	}
+
+	if loaded > 0 {
+		e.logger.Info(fmt.Sprintf("Loaded %d of %d pending batches into the database", loaded, len(files)))
+	}
+}
+
+// loadPendingBatch inserts the records of a pending batch the database is still
+// missing and reports whether it succeeded
+func (e *ETLService) loadPendingBatch(ctx context.Context, file string, batch *storage.PendingBatch) bool {
+	ctx, endStore := e.beginStage(database.WithLoadBatch(ctx, batch.Batch), e.logger, stageStore, e.stageTimeouts.Store)
+	defer endStore()
+
+	if e.transactional {
+		if err := e.db.InsertBatch(ctx, batch.RunID, batch.Raw, batch.Processed, nil); err != nil {
+			e.logger.Error(fmt.Sprintf("Failed to load pending batch %s: %v", file, err))
+			return false
+		}
+		batch.Raw, batch.Processed = nil, nil
+	}
+
+	if len(batch.Raw) > 0 {
+		ids, err := e.db.InsertRawData(ctx, batch.RunID, batch.Raw)
+		if err != nil {
+			e.logger.Error(fmt.Sprintf("Failed to load pending raw data from %s: %v", file, err))
+			return false
+		}
+		e.traceLineage(batch.Processed, nil, ids)
+		// Record progress so a failure below does not insert the raw data twice
+		batch.Raw = nil
+		if len(batch.Processed) > 0 {
+			if err := e.storage.UpdatePendingBatch(file, *batch); err != nil {
+				e.logger.Error(fmt.Sprintf("Failed to update pending batch %s: %v", file, err))
+				return false
+			}
+		}
+	}
+	if len(batch.Processed) > 0 {
+		if err := e.db.InsertProcessedData(ctx, batch.RunID, batch.Processed); err != nil {
+			e.logger.Error(fmt.Sprintf("Failed to load pending processed data from %s: %v", file, err))
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,106 @@
+package etl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/sink"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+func TestPauseResume(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	e := NewETLService(nil, nil, nil, nil, nil, logger, metrics.NewMetrics(), nil)
+
+	if !e.Pause() || !e.Paused() {
+		t.Fatal("Expected a running pipeline to pause")
+	}
+	if e.Pause() {
+		t.Error("Expected pausing a paused pipeline to report no change")
+	}
+
+	// A paused pipeline runs no cycles and still stops with its context
+	ctx, cancel := context.WithCancel(context.Background())
+	schedule, _ := ParseCron("0 0 1 1 *", "UTC")
+	done := make(chan struct{})
+	go func() {
+		e.Start(ctx, schedule)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if !e.Resume() || e.Paused() {
+		t.Error("Expected a paused pipeline to resume")
+	}
+	if e.Resume() {
+		t.Error("Expected resuming a running pipeline to report no change")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Start to return once the context is cancelled")
+	}
+}
+
+type countingExtractor struct{ calls int }
+
+func (c *countingExtractor) FetchData(ctx context.Context) ([]map[string]interface{}, error) {
+	c.calls++
+	return []map[string]interface{}{{"userId": float64(1), "title": "First", "body": "Body"}}, nil
+}
+
+func TestRunOnce(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	metricsCollector := metrics.NewMetrics()
+	extractor := &countingExtractor{}
+	transformer := transform.NewTransformer(logger, metricsCollector)
+	loader := sink.NewFanOut(nil, logger, metricsCollector)
+	e := NewETLService(extractor, nil, nil, nil, transformer, logger, metricsCollector, loader)
+	// Dry runs extract without writing, which needs no database or storage
+	e.SetDryRun(true)
+
+	if _, err := e.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if extractor.calls != 1 {
+		t.Errorf("Expected a single cycle, got %d extractions", extractor.calls)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	e := NewETLService(nil, nil, nil, nil, nil, logger, metrics.NewMetrics(), nil)
+	if status := e.Status(); status.Schedule != "" || status.NextRun != nil {
+		t.Errorf("Expected no schedule before Start, got %+v", status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	schedule, _ := ParseCron("0 0 1 1 *", "UTC")
+	done := make(chan struct{})
+	go func() {
+		e.Start(ctx, schedule)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	status := e.Status()
+	if status.Schedule != `cron "0 0 1 1 *" (UTC)` {
+		t.Errorf("Expected the schedule of the started pipeline, got %+v", status)
+	}
+	if status.NextRun == nil || status.NextRun.Month() != time.January || status.Running {
+		t.Errorf("Expected the next run on January 1st and no cycle running, got %+v", status)
+	}
+
+	e.Pause()
+	time.Sleep(10 * time.Millisecond)
+	if status := e.Status(); !status.Paused || status.NextRun != nil {
+		t.Errorf("Expected no next run while paused, got %+v", status)
+	}
+	cancel()
+	<-done
+	if status := e.Status(); status.Schedule != "" || status.NextRun != nil {
+		t.Errorf("Expected no schedule once stopped, got %+v", status)
+	}
+}
@@ -0,0 +1,72 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/tracing"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// Run stages bounded by a timeout
+const (
+	stageStore = "store"
+	stageLoad  = "load"
+)
+
+// StageTimeouts bound the stages of a run writing to the database, the sinks and
+// snapshot storage, so a hung statement or upload fails the stage instead of
+// stalling the cycle; zero leaves a stage unbounded. Extraction is bounded by the
+// extractor's request timeout and the cycle budget.
+type StageTimeouts struct {
+	// Store bounds the database inserts of a batch and its raw snapshot
+	Store time.Duration
+	// Load bounds loading processed records into the sinks and their snapshot
+	Load time.Duration
+}
+
+// SetStageTimeouts sets the timeouts of the store and load stages of runs
+func (e *ETLService) SetStageTimeouts(timeouts StageTimeouts) {
+	e.stageTimeouts = timeouts
+}
+
+// beginStage traces a stage of a run and bounds it by timeout. The returned
+// function ends the stage, recording whether the timeout cut it off.
+func (e *ETLService) beginStage(ctx context.Context, logger *logging.Logger, stage string, timeout time.Duration) (context.Context, func()) {
+	ctx, span := tracing.Start(ctx, "etl."+stage)
+	if timeout <= 0 {
+		return ctx, func() { span.End() }
+	}
+	stageCtx, cancel := context.WithTimeout(ctx, timeout)
+	return stageCtx, func() {
+		var err error
+		if errors.Is(stageCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			e.metrics.StageTimeoutsTotal.WithLabelValues(stage).Inc()
+			logger.Warn(fmt.Sprintf("The %s stage reached its %v timeout", stage, timeout))
+			err = fmt.Errorf("%s stage timed out after %v", stage, timeout)
+		}
+		tracing.End(span, err)
+		cancel()
+	}
+}
+
+// transformBatch enriches and transforms a batch of raw records of a run
+func (e *ETLService) transformBatch(ctx context.Context, rawData []map[string]interface{}) (*transform.TransformedData, error) {
+	ctx, span := tracing.Start(ctx, "etl.transform", attribute.Int("etl.records", len(rawData)))
+	rawData, err := e.enrich(ctx, rawData)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+	transformed, err := e.transformer.Load().Transform(rawData)
+	if err == nil {
+		span.SetAttributes(attribute.Int("etl.records_transformed", len(transformed.Records)))
+	}
+	tracing.End(span, err)
+	return transformed, err
+}
@@ -0,0 +1,39 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestBeginStage(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	e := NewETLService(nil, nil, nil, nil, nil, logger, metrics.NewMetrics(), nil)
+
+	ctx := context.Background()
+	stageCtx, end := e.beginStage(ctx, logger, stageStore, 0)
+	if _, ok := stageCtx.Deadline(); ok {
+		t.Error("Expected a stage without timeout to be unbounded")
+	}
+	end()
+
+	stageCtx, end = e.beginStage(ctx, logger, stageLoad, 10*time.Millisecond)
+	<-stageCtx.Done()
+	if !errors.Is(stageCtx.Err(), context.DeadlineExceeded) {
+		t.Errorf("Expected the stage to reach its timeout, got %v", stageCtx.Err())
+	}
+	end()
+
+	// Cancelling the run ends its stages too
+	runCtx, cancel := context.WithCancel(ctx)
+	stageCtx, end = e.beginStage(runCtx, logger, stageStore, time.Minute)
+	cancel()
+	if !errors.Is(stageCtx.Err(), context.Canceled) {
+		t.Errorf("Expected the stage to be cancelled with its run, got %v", stageCtx.Err())
+	}
+	end()
+}
@@ -0,0 +1,97 @@
+package etl
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+// StateStore persists the scheduler state of pipelines across restarts
+type StateStore interface {
+	LoadSchedulerState(ctx context.Context, pipeline string) (*database.SchedulerState, error)
+	SaveSchedulerState(ctx context.Context, state database.SchedulerState) error
+}
+
+// SetStateStore saves the scheduler state of the pipeline in store as cycles start
+// and finish and the pipeline is paused or resumed. Start then resumes from the
+// saved state: a paused pipeline stays paused, a pending retry stays due at its
+// time, a cycle interrupted by the restart or cut short by its budget runs right
+// away, and interval schedules wait out the interval since the last cycle instead
+// of running one on start.
+func (e *ETLService) SetStateStore(store StateStore) {
+	e.stateStore = store
+}
+
+// restoreState applies the scheduler state saved before a restart to the schedule
+// Start runs on, returning the schedule, whether a cycle is due right away and the
+// pending retry, if any
+func (e *ETLService) restoreState(schedule Schedule, runNow bool) (Schedule, bool, time.Time, int) {
+	if e.stateStore == nil || e.dryRun {
+		return schedule, runNow, time.Time{}, 0
+	}
+	state, err := e.stateStore.LoadSchedulerState(context.Background(), e.name)
+	if err != nil {
+		e.logger.Warn(fmt.Sprintf("Failed to load the scheduler state, starting afresh: %v", err))
+		return schedule, runNow, time.Time{}, 0
+	}
+	if state == nil {
+		return schedule, runNow, time.Time{}, 0
+	}
+
+	e.mu.Lock()
+	e.state = *state
+	if state.Paused {
+		e.paused = true
+		e.metrics.PipelinePaused.Set(1)
+	}
+	e.mu.Unlock()
+	if state.Paused {
+		e.logger.Info("ETL pipeline paused before the restart, it stays paused until resumed")
+	}
+
+	if s, ok := schedule.(*intervalSchedule); ok && !state.LastTick.IsZero() {
+		if next := state.LastTick.Add(s.interval); time.Now().Before(next) {
+			schedule, runNow = &intervalSchedule{interval: s.interval, start: next}, false
+			e.logger.Info(fmt.Sprintf("Last cycle started at %s, resuming the schedule with the next one at %s",
+				state.LastTick.Format(time.RFC3339), next.Format(time.RFC3339)))
+		}
+	}
+	switch {
+	case state.Running:
+		e.logger.Warn("A cycle was interrupted by the restart, running it again")
+		return schedule, true, time.Time{}, 0
+	case state.Continuation:
+		e.logger.Info("The last cycle was cut short by its budget, continuing it")
+		return schedule, true, time.Time{}, 0
+	case !state.RetryAt.IsZero():
+		e.logger.Info(fmt.Sprintf("Resuming the retry of the last failed cycle at %s", state.RetryAt.Format(time.RFC3339)))
+		return schedule, runNow, state.RetryAt, state.Retries
+	}
+	return schedule, runNow, time.Time{}, 0
+}
+
+// saveState applies update to the scheduler state, if given, and saves it. A
+// failed save is logged; the pipeline keeps running on its state in memory.
+func (e *ETLService) saveState(update func(state *database.SchedulerState)) {
+	if e.stateStore == nil || e.dryRun {
+		return
+	}
+	// Saves are serialized so an older state never overwrites a newer one
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+
+	e.mu.Lock()
+	if update != nil {
+		update(&e.state)
+	}
+	e.state.Pipeline = e.name
+	e.state.Paused = e.paused
+	state := e.state
+	e.mu.Unlock()
+
+	if err := e.stateStore.SaveSchedulerState(context.Background(), state); err != nil {
+		e.logger.Warn(fmt.Sprintf("Failed to save the scheduler state: %v", err))
+	}
+}
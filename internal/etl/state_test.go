@@ -0,0 +1,86 @@
+package etl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// memoryStateStore keeps scheduler states in memory
+type memoryStateStore struct {
+	states map[string]database.SchedulerState
+}
+
+func (m *memoryStateStore) LoadSchedulerState(ctx context.Context, pipeline string) (*database.SchedulerState, error) {
+	state, ok := m.states[pipeline]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (m *memoryStateStore) SaveSchedulerState(ctx context.Context, state database.SchedulerState) error {
+	m.states[state.Pipeline] = state
+	return nil
+}
+
+func newStateService(store StateStore) *ETLService {
+	logger, _ := logging.NewLogger("test.log")
+	e := NewETLService(nil, nil, nil, nil, nil, logger, metrics.NewMetrics(), nil)
+	e.SetStateStore(store)
+	return e
+}
+
+func TestRestoreStateResumesIntervalSchedule(t *testing.T) {
+	lastTick := time.Now().Add(-time.Minute)
+	store := &memoryStateStore{states: map[string]database.SchedulerState{
+		"default": {Pipeline: "default", LastTick: lastTick, Paused: true},
+	}}
+	e := newStateService(store)
+
+	schedule, runNow, retryAt, _ := e.restoreState(Every(5*time.Minute), true)
+	if runNow || !retryAt.IsZero() {
+		t.Errorf("Expected no cycle due before the interval passed, got runNow %v and retry at %v", runNow, retryAt)
+	}
+	if next := schedule.Next(time.Now()); !next.Equal(lastTick.Add(5 * time.Minute)) {
+		t.Errorf("Expected the next cycle an interval after the last one, got %v", next)
+	}
+	if !e.Paused() {
+		t.Error("Expected the pipeline to stay paused")
+	}
+
+	e.Resume()
+	if store.states["default"].Paused || !store.states["default"].LastTick.Equal(lastTick) {
+		t.Errorf("Expected resuming to save the state, got %+v", store.states["default"])
+	}
+}
+
+func TestRestoreStateRunsInterruptedCycle(t *testing.T) {
+	retryAt := time.Now().Add(time.Minute)
+	store := &memoryStateStore{states: map[string]database.SchedulerState{
+		"default": {Pipeline: "default", LastTick: time.Now(), Running: true},
+		"orders":  {Pipeline: "orders", LastTick: time.Now(), RetryAt: retryAt, Retries: 2},
+	}}
+
+	e := newStateService(store)
+	if _, runNow, _, _ := e.restoreState(Every(time.Hour), true); !runNow {
+		t.Error("Expected the interrupted cycle to run right away")
+	}
+
+	e = newStateService(store)
+	e.SetPipelineName("orders")
+	_, runNow, restoredAt, retries := e.restoreState(Every(time.Hour), true)
+	if runNow || !restoredAt.Equal(retryAt) || retries != 2 {
+		t.Errorf("Expected the pending retry at %v after 2 retries, got runNow %v, retry at %v after %d", retryAt, runNow, restoredAt, retries)
+	}
+
+	e = newStateService(store)
+	e.SetPipelineName("new")
+	if _, runNow, _, _ := e.restoreState(Every(time.Hour), true); !runNow {
+		t.Error("Expected a pipeline without saved state to start as before")
+	}
+}
@@ -0,0 +1,49 @@
+package etl
+
+import (
+	"fmt"
+	"time"
+)
+
+// PipelineStatus is the state of a pipeline as reported by the status API
+type PipelineStatus struct {
+	// Schedule is when scheduled cycles run, empty while the pipeline is not started
+	Schedule string `json:"schedule,omitempty"`
+	Paused   bool   `json:"paused"`
+	DryRun   bool   `json:"dry_run"`
+	// Running is set while a cycle runs
+	Running bool `json:"running"`
+	// NextRun is when the next scheduled cycle is due, unset while paused or stopped
+	NextRun *time.Time `json:"next_run,omitempty"`
+}
+
+// SetPipelineName sets the name the runs of the pipeline are recorded under
+func (e *ETLService) SetPipelineName(name string) {
+	e.name = name
+}
+
+// Status returns the schedule of the pipeline and whether a cycle is running
+func (e *ETLService) Status() PipelineStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	status := PipelineStatus{
+		Paused:  e.paused,
+		DryRun:  e.dryRun,
+		Running: e.cyclesRunning.Load() > 0,
+	}
+	if e.started != nil {
+		status.Schedule = fmt.Sprint(e.started)
+	}
+	if !e.nextRun.IsZero() {
+		nextRun := e.nextRun
+		status.NextRun = &nextRun
+	}
+	return status
+}
+
+// setNextRun records the schedule Start runs on and when its next cycle is due
+func (e *ETLService) setNextRun(schedule Schedule, next time.Time) {
+	e.mu.Lock()
+	e.started, e.nextRun = schedule, next
+	e.mu.Unlock()
+}
@@ -0,0 +1,377 @@
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/api"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/storage"
+	"github.com/mohammedhassan/etl-pipeline/internal/tracing"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// Queues between the stages of streaming cycles, the labels of etl_stream_queue_depth
+const (
+	queueExtracted   = "extracted"
+	queueTransformed = "transformed"
+)
+
+// Reasons a streaming cycle flushes a batch, the reason label of etl_load_flushes_total
+const (
+	// flushSize is a batch of BatchSize records
+	flushSize = "size"
+	// flushBytes is a batch whose estimated size reached MaxBatchBytes
+	flushBytes = "bytes"
+	// flushTimer is a batch whose first records waited FlushInterval
+	flushTimer = "timer"
+	// flushBackpressure is a batch flushed early as extraction waits for the budget
+	flushBackpressure = "backpressure"
+	// flushShutdown is the last batch, once extraction finished and the stages shut down
+	flushShutdown = "shutdown"
+)
+
+// StreamConfig sets how cycles stream records from the extractor through transform
+// workers to the loader, instead of passing whole batches from stage to stage
+type StreamConfig struct {
+	// Workers is the number of concurrent transform workers; zero runs the stages
+	// one after the other on the whole batch
+	Workers int
+	// Buffer is the number of pages queued between stages, bounding the records
+	// held in memory while a slower stage catches up
+	Buffer int
+	// BatchSize is the most records of a page and of a batch stored and loaded at once
+	BatchSize int
+	// FlushInterval stores and loads a smaller batch once its first records waited
+	// that long
+	FlushInterval time.Duration
+	// MaxInFlight is the most records extracted but not loaded yet; extraction waits
+	// for the loader once it is reached. Zero is unbounded.
+	MaxInFlight int
+	// MaxBatchBytes stores and loads a batch once its estimated size reaches it,
+	// before BatchSize records; zero only bounds batches by records
+	MaxBatchBytes int64
+}
+
+// SetStreaming streams the records of cycles through cfg.Workers transform workers.
+// Cycles are processed whole while checkpoints are enabled, as are DAG cycles,
+// backfills and ingested batches.
+func (e *ETLService) SetStreaming(cfg StreamConfig) {
+	cfg.Buffer = max(cfg.Buffer, 1)
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	e.stream = cfg
+}
+
+// extractedPage is a page of raw records with their estimated size in bytes, and
+// their payloads when raw passthrough keeps them
+type extractedPage struct {
+	raw      []map[string]interface{}
+	payloads []json.RawMessage
+	bytes    int64
+	// ack acks the batch the page was cut from, if the extractor hands out batches
+	ack *batchAck
+}
+
+// transformedPage is a page of raw records with their transformation
+type transformedPage struct {
+	extractedPage
+	data *transform.TransformedData
+}
+
+// runStream extracts pages into a bounded queue, transforms them with concurrent
+// workers and stores and loads them in batches of up to BatchSize records, or
+// whatever arrived within FlushInterval. Extraction progress is committed once
+// every batch is durable; when a stage fails the others stop and the records not
+// loaded yet are fetched again next cycle. Extraction waits while MaxInFlight
+// records are on their way, so a slow loader throttles the source. Extracted
+// batches are acked once all their records are durable and nacked at the end
+// otherwise.
+func (e *ETLService) runStream(ctx, extractCtx context.Context, r *run) (partial bool, err error) {
+	streamCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	budget := newInFlightBudget(e.stream.MaxInFlight, e.metrics)
+	var extracted extractedBatches
+	defer func() {
+		e.nackBatches(r, extracted.all(), err)
+	}()
+
+	// 1. Extract: pages are queued as they are fetched
+	pages := make(chan extractedPage, e.stream.Buffer)
+	var extractErr error
+	go func() {
+		defer close(pages)
+		extractErr = e.extractStream(extractCtx, streamCtx, pages, budget, &extracted)
+		if extractErr != nil && !errors.Is(extractErr, api.ErrPartial) {
+			stop()
+		}
+	}()
+
+	// 2. Transform: workers take pages off the queue concurrently
+	transformed := make(chan transformedPage, e.stream.Buffer)
+	var workers sync.WaitGroup
+	var transformErr error
+	var failOnce sync.Once
+	for i := 0; i < e.stream.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for page := range pages {
+				if streamCtx.Err() != nil {
+					continue
+				}
+				data, err := e.transformBatch(ctx, page.raw)
+				if err != nil {
+					failOnce.Do(func() { transformErr = err })
+					stop()
+					continue
+				}
+				select {
+				case transformed <- transformedPage{extractedPage: page, data: data}:
+				case <-streamCtx.Done():
+				}
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(transformed)
+	}()
+
+	// 3. Load: batches are stored and loaded by size or age
+	loadErr := e.loadStream(ctx, streamCtx, r, pages, transformed, budget, stop)
+	for range transformed {
+		// Drain the workers still finishing after a failure
+	}
+	e.metrics.StreamQueueDepth.WithLabelValues(queueExtracted).Set(0)
+	e.metrics.StreamQueueDepth.WithLabelValues(queueTransformed).Set(0)
+	e.metrics.StreamInFlightRecords.Set(0)
+	e.metrics.StreamInFlightBytes.Set(0)
+
+	switch {
+	case loadErr != nil:
+		return false, loadErr
+	case transformErr != nil:
+		r.logger.Error(fmt.Sprintf("Transformation failed: %v", transformErr))
+		return false, transformErr
+	case extractErr != nil && (!errors.Is(extractErr, api.ErrPartial) || r.RecordsExtracted == 0):
+		// An extraction cut short before fetching anything fails like any other
+		r.logger.Error(fmt.Sprintf("Extraction failed: %v", extractErr))
+		return false, extractErr
+	case ctx.Err() != nil:
+		return false, ctx.Err()
+	case extractErr != nil:
+		r.logger.Warn(fmt.Sprintf("Extraction stopped by the cycle budget, loaded %d records fetched so far: %v", r.RecordsExtracted, extractErr))
+		return true, nil
+	}
+	return false, nil
+}
+
+// extractStream queues the pages of the extractor, split into pages of at most
+// BatchSize records, each once it fits the in-flight budget. Extractors that cannot
+// stream are fetched whole first. Batches handed out by the extractor are added to
+// extracted.
+func (e *ETLService) extractStream(extractCtx, streamCtx context.Context, pages chan<- extractedPage, budget *inFlightBudget, extracted *extractedBatches) (err error) {
+	extractCtx, span := tracing.Start(extractCtx, "etl.extract")
+	records := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("etl.records", records))
+		if errors.Is(err, api.ErrPartial) {
+			span.SetAttributes(attribute.Bool("etl.partial", true))
+			span.End()
+			return
+		}
+		tracing.End(span, err)
+	}()
+
+	emit := func(page []map[string]interface{}, payloads []json.RawMessage, ack *batchAck) error {
+		if ack != nil {
+			ack.chunks.Store(int32((len(page) + e.stream.BatchSize - 1) / e.stream.BatchSize))
+		}
+		for start := 0; start < len(page); start += e.stream.BatchSize {
+			end := min(start+e.stream.BatchSize, len(page))
+			chunk := extractedPage{raw: page[start:end], ack: ack}
+			if payloads != nil {
+				chunk.payloads = payloads[start:end]
+				for _, payload := range chunk.payloads {
+					chunk.bytes += int64(len(payload))
+				}
+			} else {
+				chunk.bytes = approxSize(chunk.raw)
+			}
+			if err := budget.acquire(streamCtx, len(chunk.raw), chunk.bytes); err != nil {
+				return err
+			}
+			select {
+			case pages <- chunk:
+			case <-streamCtx.Done():
+				return streamCtx.Err()
+			}
+		}
+		return nil
+	}
+	if extractor, ok := e.batchExtractor(); ok {
+		var mu sync.Mutex
+		return extractor.FetchBatches(extractCtx, func(batch *api.Batch) error {
+			extracted.add(batch)
+			mu.Lock()
+			records += len(batch.Records)
+			mu.Unlock()
+			payloads, err := payloadsOf(batch, e.rawPassthrough)
+			if err != nil {
+				return err
+			}
+			return emit(batch.Records, payloads, &batchAck{batch: batch})
+		})
+	}
+	if extractor, ok := e.payloadExtractor(); ok {
+		var mu sync.Mutex
+		return extractor.FetchPayloads(extractCtx, func(page []map[string]interface{}, payloads []json.RawMessage) error {
+			mu.Lock()
+			records += len(page)
+			mu.Unlock()
+			return emit(page, payloads, nil)
+		})
+	}
+	if streamer, ok := e.apiClient.(api.StreamExtractor); ok {
+		var mu sync.Mutex
+		return streamer.FetchStream(extractCtx, func(page []map[string]interface{}) error {
+			mu.Lock()
+			records += len(page)
+			mu.Unlock()
+			return emit(page, nil, nil)
+		})
+	}
+	rawData, err := e.apiClient.FetchData(extractCtx)
+	records = len(rawData)
+	if err != nil && !errors.Is(err, api.ErrPartial) {
+		return err
+	}
+	if emitErr := emit(rawData, nil, nil); emitErr != nil {
+		return emitErr
+	}
+	return err
+}
+
+// loadStream stores and loads the transformed pages in batches until the workers
+// are done, calling stop when a batch fails. Batches are flushed early when
+// extraction waits for the in-flight budget. Extraction progress is committed once
+// every batch is durable and the extraction succeeded.
+func (e *ETLService) loadStream(ctx, streamCtx context.Context, r *run, pages chan extractedPage, transformed <-chan transformedPage, budget *inFlightBudget, stop func()) error {
+	var raw []map[string]interface{}
+	var payloads []json.RawMessage
+	var size int64
+	data := &transform.TransformedData{}
+	batches, durable := 0, 0
+	var acks []*batchAck
+	markDurable := func(acks []*batchAck) func() {
+		return func() {
+			durable++
+			for _, ack := range acks {
+				e.chunkDurable(r, ack)
+			}
+		}
+	}
+
+	flush := func(reason string) error {
+		if len(raw) == 0 {
+			return nil
+		}
+		batches++
+		e.metrics.LoadBatchRecords.Observe(float64(len(raw)))
+		e.metrics.LoadFlushesTotal.WithLabelValues(reason).Inc()
+		r.RecordsExtracted += len(raw)
+		e.countTransformed(r, len(raw), data)
+		hashes := rawHashes(raw, payloads)
+		// The batches of the run are numbered so each is claimed on its own
+		batchCtx := database.WithLoadBatch(ctx, batches)
+		var err error
+		if e.transactional {
+			e.traceLineage(data.Records, hashes, nil)
+			err = e.storeAtomic(batchCtx, r, raw, payloads, data, markDurable(acks))
+		} else {
+			var pending storage.PendingBatch
+			var ids []int64
+			var onDurable func()
+			if ids, onDurable, err = e.storeRaw(batchCtx, r, raw, payloads, data, markDurable(acks), &pending); err == nil {
+				e.traceLineage(data.Records, hashes, ids)
+				e.loadTransformed(batchCtx, r, data, &pending, onDurable)
+			}
+		}
+		budget.release(len(raw), size)
+		raw, payloads, size, data, acks = nil, nil, 0, &transform.TransformedData{}, nil
+		return err
+	}
+
+	var due <-chan time.Time
+	for {
+		var reason string
+		select {
+		case page, ok := <-transformed:
+			if !ok {
+				if streamCtx.Err() != nil {
+					// A stage failed or the cycle was cancelled; the records not
+					// loaded are fetched again next cycle
+					return nil
+				}
+				if err := flush(flushShutdown); err != nil {
+					return err
+				}
+				if batches == durable {
+					e.commitExtraction()
+				}
+				return nil
+			}
+			e.metrics.StreamQueueDepth.WithLabelValues(queueExtracted).Set(float64(len(pages)))
+			e.metrics.StreamQueueDepth.WithLabelValues(queueTransformed).Set(float64(len(transformed)))
+			if len(raw) == 0 {
+				due = time.After(e.stream.FlushInterval)
+			}
+			// Lines of the page continue those of the batch
+			rebaseLineage(page.data.Records, len(raw))
+			raw = append(raw, page.raw...)
+			payloads = append(payloads, page.payloads...)
+			size += page.bytes
+			if page.ack != nil {
+				acks = append(acks, page.ack)
+			}
+			data.Records = append(data.Records, page.data.Records...)
+			data.Audits = append(data.Audits, page.data.Audits...)
+			data.Deleted = append(data.Deleted, page.data.Deleted...)
+			data.Quality.Add(page.data.Quality)
+			switch {
+			case len(raw) >= e.stream.BatchSize:
+				reason = flushSize
+			case e.stream.MaxBatchBytes > 0 && size >= e.stream.MaxBatchBytes:
+				reason = flushBytes
+			case budget.isStarved():
+				reason = flushBackpressure
+			default:
+				continue
+			}
+		case <-due:
+			reason = flushTimer
+		case <-budget.starved:
+			if !budget.isStarved() {
+				// Extraction got records released before the loader woke up
+				continue
+			}
+			reason = flushBackpressure
+		}
+		due = nil
+		if err := flush(reason); err != nil {
+			stop()
+			return err
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// pagedExtractor streams pages of records, then fails if err is set
+type pagedExtractor struct {
+	pages   int
+	err     error
+	emitted int
+}
+
+func (p *pagedExtractor) FetchData(ctx context.Context) ([]map[string]interface{}, error) {
+	return nil, errors.New("not streamed")
+}
+
+func (p *pagedExtractor) FetchStream(ctx context.Context, emit func(page []map[string]interface{}) error) error {
+	for i := 0; i < p.pages; i++ {
+		if err := emit([]map[string]interface{}{{"userId": float64(i + 1), "title": "Title", "body": "Body"}}); err != nil {
+			return err
+		}
+		p.emitted++
+	}
+	return p.err
+}
+
+func TestStreamStopsOnExtractionFailure(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	metricsCollector := metrics.NewMetrics()
+	extractor := &pagedExtractor{pages: 20, err: errors.New("source unavailable")}
+	e := NewETLService(extractor, nil, nil, nil, transform.NewTransformer(logger, metricsCollector), logger, metricsCollector, nil)
+	// Batches are never full nor due, so nothing reaches the database before the failure
+	e.SetStreaming(StreamConfig{Workers: 4, Buffer: 2, BatchSize: 1000, FlushInterval: time.Hour})
+
+	r := &run{logger: logger}
+	partial, err := e.runStream(context.Background(), context.Background(), r)
+	if err == nil || err.Error() != "source unavailable" {
+		t.Fatalf("Expected the extraction error, got %v", err)
+	}
+	if partial {
+		t.Error("Expected a failed stream not to be reported as partial")
+	}
+	if extractor.emitted != 20 {
+		t.Errorf("Expected every page to pass through the bounded queues, got %d", extractor.emitted)
+	}
+	if r.RecordsExtracted != 0 || r.RecordsLoaded != 0 {
+		t.Errorf("Expected nothing loaded from a failed extraction, got %d extracted and %d loaded", r.RecordsExtracted, r.RecordsLoaded)
+	}
+}
@@ -0,0 +1,216 @@
+package httpauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// Roles of the callers of the HTTP API
+const (
+	// RoleRead may call the read-only endpoints, those answering GET and HEAD
+	RoleRead = "read"
+	// RoleControl may also change the pipelines: pause, resume, backfill, replay,
+	// ingest, retention enforcement and reloads
+	RoleControl = "control"
+)
+
+// Reasons requests are rejected, the labels of etl_http_auth_failures_total
+const (
+	failureMissing   = "missing"
+	failureInvalid   = "invalid"
+	failureForbidden = "forbidden"
+)
+
+// Config sets who may call the HTTP API
+type Config struct {
+	// ReadTokens and ControlTokens are static bearer tokens granting their role
+	ReadTokens    []string
+	ControlTokens []string
+	// ReadUsers and ControlUsers are the passwords of basic auth users by name
+	ReadUsers    map[string]string
+	ControlUsers map[string]string
+	// OIDC verifies bearer tokens issued by an OpenID Connect provider, if set
+	OIDC *OIDCConfig
+	// PublicPaths are served to anyone, e.g. /health for probes
+	PublicPaths []string
+}
+
+// Identity is an authenticated caller
+type Identity struct {
+	// Subject names the caller: the user, the subject of a JWT or the kind of token
+	Subject string
+	Role    string
+}
+
+type credential struct {
+	subject string
+	// digest is the SHA-256 of the secret, compared in constant time
+	digest [sha256.Size]byte
+	role   string
+}
+
+// Authenticator checks the credentials of requests against their method: control
+// requests, all but GET and HEAD, need the control role
+type Authenticator struct {
+	tokens  []credential
+	users   map[string]credential
+	oidc    *oidcVerifier
+	public  map[string]bool
+	logger  *logging.Logger
+	metrics *metrics.Metrics
+}
+
+// New creates an authenticator; it returns nil when no credentials are configured,
+// leaving the API open
+func New(cfg Config, logger *logging.Logger, metrics *metrics.Metrics) (*Authenticator, error) {
+	a := &Authenticator{
+		users:   make(map[string]credential),
+		public:  make(map[string]bool),
+		logger:  logger,
+		metrics: metrics,
+	}
+	for _, role := range []struct {
+		name   string
+		tokens []string
+		users  map[string]string
+	}{
+		{RoleRead, cfg.ReadTokens, cfg.ReadUsers},
+		{RoleControl, cfg.ControlTokens, cfg.ControlUsers},
+	} {
+		for _, token := range role.tokens {
+			a.tokens = append(a.tokens, credential{subject: role.name + " token", digest: sha256.Sum256([]byte(token)), role: role.name})
+		}
+		for user, password := range role.users {
+			if _, ok := a.users[user]; ok {
+				return nil, fmt.Errorf("user %s is configured twice", user)
+			}
+			if user == "" || password == "" {
+				return nil, errors.New("basic auth users need a name and a password")
+			}
+			a.users[user] = credential{subject: user, digest: sha256.Sum256([]byte(password)), role: role.name}
+		}
+	}
+	if cfg.OIDC != nil {
+		verifier, err := newOIDCVerifier(*cfg.OIDC)
+		if err != nil {
+			return nil, err
+		}
+		a.oidc = verifier
+	}
+	if len(a.tokens) == 0 && len(a.users) == 0 && a.oidc == nil {
+		return nil, nil
+	}
+	for _, path := range cfg.PublicPaths {
+		a.public[path] = true
+	}
+	return a, nil
+}
+
+// Middleware rejects requests to next without the credentials of the role their
+// method needs, with 401 Unauthorized or 403 Forbidden. Control requests are logged
+// with their caller.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.public[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		identity, err := a.Authenticate(r)
+		if err != nil {
+			reason := failureInvalid
+			if errors.Is(err, errNoCredentials) {
+				reason = failureMissing
+			}
+			a.metrics.HTTPAuthFailuresTotal.WithLabelValues(reason).Inc()
+			a.challenge(w)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		required := requiredRole(r)
+		if required == RoleControl && identity.Role != RoleControl {
+			a.metrics.HTTPAuthFailuresTotal.WithLabelValues(failureForbidden).Inc()
+			a.logger.Warn(fmt.Sprintf("Denied %s %s to %s: the control role is required", r.Method, r.URL.Path, identity.Subject))
+			http.Error(w, "the control role is required", http.StatusForbidden)
+			return
+		}
+		if required == RoleControl {
+			a.logger.Info(fmt.Sprintf("%s %s by %s", r.Method, r.URL.Path, identity.Subject))
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+var errNoCredentials = errors.New("authentication required")
+
+// Authenticate returns the caller of a request from its bearer token or basic
+// auth credentials
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	if user, password, ok := r.BasicAuth(); ok {
+		cred, known := a.users[user]
+		digest := sha256.Sum256([]byte(password))
+		if !known || subtle.ConstantTimeCompare(digest[:], cred.digest[:]) != 1 {
+			return Identity{}, errors.New("invalid user or password")
+		}
+		return Identity{Subject: cred.subject, Role: cred.role}, nil
+	}
+
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return Identity{}, errNoCredentials
+	}
+	digest := sha256.Sum256([]byte(token))
+	for _, cred := range a.tokens {
+		if subtle.ConstantTimeCompare(digest[:], cred.digest[:]) == 1 {
+			return Identity{Subject: cred.subject, Role: cred.role}, nil
+		}
+	}
+	if a.oidc != nil && strings.Count(token, ".") == 2 {
+		identity, err := a.oidc.verify(r.Context(), token)
+		if err != nil {
+			return Identity{}, fmt.Errorf("invalid token: %w", err)
+		}
+		return identity, nil
+	}
+	return Identity{}, errors.New("invalid token")
+}
+
+// challenge tells the client the authentication schemes accepted
+func (a *Authenticator) challenge(w http.ResponseWriter) {
+	if len(a.tokens) > 0 || a.oidc != nil {
+		w.Header().Add("WWW-Authenticate", `Bearer realm="etl-pipeline"`)
+	}
+	if len(a.users) > 0 {
+		w.Header().Add("WWW-Authenticate", `Basic realm="etl-pipeline"`)
+	}
+}
+
+// requiredRole returns the role a request needs; requests changing the pipelines
+// need the control role
+func requiredRole(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return RoleRead
+	}
+	return RoleControl
+}
+
+type identityKey struct{}
+
+// WithIdentity returns ctx carrying the caller of a request
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFrom returns the caller of a request, if it was authenticated
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
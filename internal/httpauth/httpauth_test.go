@@ -0,0 +1,275 @@
+package httpauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func serve(t *testing.T, auth *Authenticator, method, path string, setup func(r *http.Request)) int {
+	t.Helper()
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(method, path, nil)
+	if setup != nil {
+		setup(req)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func bearer(token string) func(r *http.Request) {
+	return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+}
+
+func TestNewWithoutCredentials(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	auth, err := New(Config{PublicPaths: []string{"/health"}}, logger, metrics.NewMetrics())
+	if err != nil || auth != nil {
+		t.Errorf("New() = %v, %v, want no authenticator without credentials", auth, err)
+	}
+}
+
+func TestStaticCredentials(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	auth, err := New(Config{
+		ReadTokens:    []string{"read-token"},
+		ControlTokens: []string{"control-token"},
+		ReadUsers:     map[string]string{"grafana": "viewer-password"},
+		ControlUsers:  map[string]string{"ops": "ops-password"},
+		PublicPaths:   []string{"/health"},
+	}, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	basic := func(user, password string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(user, password) }
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		setup  func(r *http.Request)
+		want   int
+	}{
+		{"public path", http.MethodGet, "/health", nil, http.StatusOK},
+		{"no credentials", http.MethodGet, "/pipelines", nil, http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "/pipelines", bearer("guess"), http.StatusUnauthorized},
+		{"read token reads", http.MethodGet, "/pipelines", bearer("read-token"), http.StatusOK},
+		{"read token cannot control", http.MethodPost, "/pipelines/default/pause", bearer("read-token"), http.StatusForbidden},
+		{"control token controls", http.MethodPost, "/pipelines/default/pause", bearer("control-token"), http.StatusOK},
+		{"control token reads", http.MethodGet, "/metrics", bearer("control-token"), http.StatusOK},
+		{"read user reads", http.MethodGet, "/runs", basic("grafana", "viewer-password"), http.StatusOK},
+		{"read user cannot control", http.MethodPost, "/admin/reload", basic("grafana", "viewer-password"), http.StatusForbidden},
+		{"control user controls", http.MethodPost, "/admin/reload", basic("ops", "ops-password"), http.StatusOK},
+		{"wrong password", http.MethodGet, "/runs", basic("ops", "viewer-password"), http.StatusUnauthorized},
+		{"unknown user", http.MethodGet, "/runs", basic("root", "ops-password"), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := serve(t, auth, tt.method, tt.path, tt.setup); got != tt.want {
+			t.Errorf("%s: %s %s = %d, want %d", tt.name, tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+// provider is an OpenID Connect provider signing tokens with an RSA and an EC key
+type provider struct {
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func newProvider(t *testing.T) *provider {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &provider{rsaKey: rsaKey, ecKey: ecKey}
+	encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": p.server.URL, "jwks_uri": p.server.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecKey.X), "y": encode(ecKey.Y)},
+		}})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// token signs claims with the key of kid
+func (p *provider) token(t *testing.T, kid string, claims map[string]interface{}) string {
+	alg := "RS256"
+	if kid == "ec" {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	if kid == "ec" {
+		r, s, err := ecdsa.Sign(rand.Reader, p.ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	} else {
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, p.rsaKey, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDC(t *testing.T) {
+	p := newProvider(t)
+	logger, _ := logging.NewLogger("test.log")
+	auth, err := New(Config{
+		ControlTokens: []string{"control-token"},
+		OIDC: &OIDCConfig{
+			Issuer:      p.server.URL,
+			Audience:    "etl-pipeline",
+			RolesClaim:  "realm_access.roles",
+			ReadRole:    "etl-read",
+			ControlRole: "etl-control",
+		},
+	}, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	claims := func(roles ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"iss":          p.server.URL,
+			"aud":          []string{"etl-pipeline", "other"},
+			"sub":          "alice",
+			"exp":          time.Now().Add(time.Hour).Unix(),
+			"realm_access": map[string]interface{}{"roles": roles},
+		}
+	}
+	with := func(key string, value interface{}, roles ...string) map[string]interface{} {
+		c := claims(roles...)
+		c[key] = value
+		return c
+	}
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		want   int
+	}{
+		{"reader reads", http.MethodGet, p.token(t, "rsa", claims("etl-read")), http.StatusOK},
+		{"reader cannot control", http.MethodPost, p.token(t, "rsa", claims("etl-read")), http.StatusForbidden},
+		{"controller controls with an EC key", http.MethodPost, p.token(t, "ec", claims("etl-control")), http.StatusOK},
+		{"no role", http.MethodGet, p.token(t, "rsa", claims("billing")), http.StatusUnauthorized},
+		{"expired", http.MethodGet, p.token(t, "rsa", with("exp", time.Now().Add(-time.Hour).Unix(), "etl-read")), http.StatusUnauthorized},
+		{"other audience", http.MethodGet, p.token(t, "rsa", with("aud", "other", "etl-read")), http.StatusUnauthorized},
+		{"other issuer", http.MethodGet, p.token(t, "rsa", with("iss", "https://evil.example.com", "etl-read")), http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "eyJhbGciOiJSUzI1NiIsImtpZCI6Im90aGVyIn0.e30.c2ln", http.StatusUnauthorized},
+		{"static tokens still work", http.MethodPost, "control-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := serve(t, auth, tt.method, "/pipelines/default/pause", bearer(tt.token)); got != tt.want {
+			t.Errorf("%s: %s = %d, want %d", tt.name, tt.method, got, tt.want)
+		}
+	}
+
+	// Tokens with none or shared secret signatures are rejected
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"rsa"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"`+p.server.URL+`","aud":"etl-pipeline","exp":9999999999,"realm_access":{"roles":["etl-control"]}}`)) + "."
+	if got := serve(t, auth, http.MethodPost, "/admin/reload", bearer(forged)); got != http.StatusUnauthorized {
+		t.Errorf("Unsigned token = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestOIDCKeyFetchIsShared(t *testing.T) {
+	p := newProvider(t)
+	// The keys are served through a proxy that holds them back until released,
+	// counting the fetches
+	release := make(chan struct{})
+	var mu sync.Mutex
+	fetches := 0
+	var proxy *httptest.Server
+	proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.well-known/openid-configuration" {
+			json.NewEncoder(w).Encode(map[string]string{"jwks_uri": proxy.URL + "/keys"})
+			return
+		}
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		<-release
+		p.server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	v, err := newOIDCVerifier(OIDCConfig{Issuer: proxy.URL, Audience: "etl-pipeline", ControlRole: "etl-control"})
+	if err != nil {
+		t.Fatalf("newOIDCVerifier() error = %v", err)
+	}
+	v.keys["ec"] = &p.ecKey.PublicKey
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := v.key(context.Background(), "rsa")
+			errs <- err
+		}()
+	}
+
+	// A known key is returned while the fetch is in flight
+	for {
+		mu.Lock()
+		started := fetches > 0
+		mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := v.key(context.Background(), "ec"); err != nil {
+		t.Errorf("key(ec) error = %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("key(rsa) error = %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Expected one fetch of the keys, got %d", fetches)
+	}
+}
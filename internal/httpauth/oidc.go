@@ -0,0 +1,383 @@
+package httpauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Bounds of the verification of JWTs
+const (
+	// clockSkew is the leeway granted to the expiry and not-before times of tokens
+	clockSkew = time.Minute
+	// keysRefreshInterval is how often the signing keys are fetched again at most,
+	// when a token is signed by an unknown key
+	keysRefreshInterval = time.Minute
+	oidcTimeout         = 10 * time.Second
+)
+
+// OIDCConfig verifies bearer tokens as JWTs issued by an OpenID Connect provider
+type OIDCConfig struct {
+	// Issuer is the issuer URL; its signing keys are discovered from
+	// <Issuer>/.well-known/openid-configuration
+	Issuer string
+	// Audience must be an audience of the tokens
+	Audience string
+	// RolesClaim holds the roles of the caller, a list or a space-separated string;
+	// nested claims are separated by dots, e.g. realm_access.roles
+	RolesClaim string
+	// ReadRole and ControlRole are the roles granting read and control access. An
+	// empty ReadRole grants read access to every valid token.
+	ReadRole    string
+	ControlRole string
+}
+
+// oidcVerifier verifies JWTs with the keys of an OpenID Connect provider, fetched
+// when a token is signed by a key not seen before
+type oidcVerifier struct {
+	cfg        OIDCConfig
+	httpClient *http.Client
+	// fetches shares a fetch of the keys between the tokens signed by unknown keys
+	// that arrive while it is in flight
+	fetches singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func newOIDCVerifier(cfg OIDCConfig) (*oidcVerifier, error) {
+	if cfg.Issuer == "" || cfg.Audience == "" {
+		return nil, errors.New("OIDC verification needs an issuer and an audience")
+	}
+	if cfg.ControlRole == "" {
+		return nil, errors.New("OIDC verification needs the role granting control access")
+	}
+	if cfg.RolesClaim == "" {
+		cfg.RolesClaim = "roles"
+	}
+	return &oidcVerifier{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: oidcTimeout},
+		keys:       make(map[string]crypto.PublicKey),
+	}, nil
+}
+
+// verify checks the signature, issuer, audience and lifetime of a JWT and returns
+// the caller with the role granted by its roles claim
+func (v *oidcVerifier) verify(ctx context.Context, token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Identity{}, fmt.Errorf("malformed header: %w", err)
+	}
+	hash, ok := signatureHashes[header.Alg]
+	if !ok {
+		return Identity{}, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, fmt.Errorf("malformed signature: %w", err)
+	}
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return Identity{}, err
+	}
+	digest := hash.New()
+	digest.Write([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(key, header.Alg, hash, digest.Sum(nil), signature); err != nil {
+		return Identity{}, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, fmt.Errorf("malformed claims: %w", err)
+	}
+	if issuer, _ := claims["iss"].(string); issuer != v.cfg.Issuer {
+		return Identity{}, fmt.Errorf("issued by %q", issuer)
+	}
+	if !slices.Contains(stringsClaim(claims["aud"]), v.cfg.Audience) {
+		return Identity{}, errors.New("not issued for this audience")
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return Identity{}, errors.New("expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return Identity{}, errors.New("not valid yet")
+	}
+
+	identity := Identity{Subject: "unknown subject"}
+	if subject, _ := claims["sub"].(string); subject != "" {
+		identity.Subject = subject
+	}
+	var roles interface{} = claims
+	for _, part := range strings.Split(v.cfg.RolesClaim, ".") {
+		object, _ := roles.(map[string]interface{})
+		roles = object[part]
+	}
+	switch granted := stringsClaim(roles); {
+	case slices.Contains(granted, v.cfg.ControlRole):
+		identity.Role = RoleControl
+	case v.cfg.ReadRole == "" || slices.Contains(granted, v.cfg.ReadRole):
+		identity.Role = RoleRead
+	default:
+		return Identity{}, fmt.Errorf("%s has no role granting access", identity.Subject)
+	}
+	return identity, nil
+}
+
+// stringsClaim returns a claim holding a string or a list of strings; strings
+// holding several values are separated by spaces, like the scope claim
+func stringsClaim(claim interface{}) []string {
+	switch claim := claim.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []interface{}:
+		values := make([]string, 0, len(claim))
+		for _, value := range claim {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// signatureHashes are the hashes of the supported JWT signature algorithms; tokens
+// signed with none or a shared secret are rejected
+var signatureHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"PS256": crypto.SHA256,
+	"PS384": crypto.SHA384,
+	"PS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+func verifySignature(key crypto.PublicKey, alg string, hash crypto.Hash, digest, signature []byte) error {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		switch alg[:2] {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(key, hash, digest, signature)
+		case "PS":
+			err = rsa.VerifyPSS(key, hash, digest, signature, nil)
+		default:
+			err = fmt.Errorf("algorithm %s does not match the RSA key", alg)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid signature: %w", err)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(signature) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return errors.New("unsupported key type")
+}
+
+// key returns the signing key of an ID, fetching the keys of the provider when it
+// is not known and they were not fetched within keysRefreshInterval. The lock is
+// not held while fetching, so tokens signed by known keys are verified meanwhile;
+// concurrent callers share one fetch, which the cancellation of the caller that
+// started it does not abort.
+func (v *oidcVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	key, ok := v.keys[kid]
+	v.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	fetched := v.fetches.DoChan("keys", func() (interface{}, error) {
+		v.mu.Lock()
+		if time.Since(v.fetchedAt) < keysRefreshInterval {
+			v.mu.Unlock()
+			return nil, nil
+		}
+		v.fetchedAt = time.Now()
+		v.mu.Unlock()
+
+		keys, err := v.fetchKeys(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the signing keys of %s: %w", v.cfg.Issuer, err)
+		}
+		v.mu.Lock()
+		v.keys = keys
+		v.mu.Unlock()
+		return nil, nil
+	})
+	select {
+	case result := <-fetched:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	v.mu.Lock()
+	key, ok = v.keys[kid]
+	v.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// jsonWebKey is a key of a JWK set; keys of other types and uses are skipped
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchKeys discovers the JWK set of the issuer and returns its signing keys by ID
+func (v *oidcVerifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := v.get(ctx, strings.TrimRight(v.cfg.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("the discovery document has no jwks_uri")
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.get(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(value string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(data) == 0 {
+			return nil, errors.New("malformed key parameter")
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, nil
+}
+
+func (v *oidcVerifier) get(ctx context.Context, url string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", url, err)
+	}
+	return nil
+}
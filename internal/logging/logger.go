@@ -1,23 +1,53 @@
 package logging
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+)
+
+// Levels of log messages, from the most to the least verbose
+const (
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
 )
 
+// Levels lists the levels in order of severity
+var Levels = []string{LevelInfo, LevelWarn, LevelError}
+
 // Logger handles application logging
 type Logger struct {
 	infoLogger  *log.Logger
 	errorLogger *log.Logger
 	warnLogger  *log.Logger
-	file        *os.File
+	file        *rotatingFile
+	// prefix is prepended to every message, e.g. the run a message belongs to
+	prefix string
+	// level is the index in Levels of the least severe messages logged
+	level int
+	// quiet stops echoing messages to stdout
+	quiet bool
+	// remotes receive every message logged as well
+	remotes []*Remote
 }
 
 // NewLogger creates a new logger instance
 func NewLogger(logPath string) (*Logger, error) {
+	return NewRotatingLogger(logPath, RotationConfig{})
+}
+
+// NewRotatingLogger creates a logger whose file is rotated and its backups pruned
+// as set by rotation
+func NewRotatingLogger(logPath string, rotation RotationConfig) (*Logger, error) {
 	// Create logs directory if it doesn't exist
 	dir := filepath.Dir(logPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -25,9 +55,9 @@ func NewLogger(logPath string) (*Logger, error) {
 	}
 
 	// Open log file
-	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	file, err := openRotatingFile(logPath, rotation)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open log file: %w", err)
+		return nil, err
 	}
 
 	return &Logger{
@@ -38,22 +68,94 @@ func NewLogger(logPath string) (*Logger, error) {
 	}, nil
 }
 
+// SetLevel drops messages less severe than level, one of Levels; info by default.
+// Loggers derived from l afterwards inherit it.
+func (l *Logger) SetLevel(level string) error {
+	i := slices.Index(Levels, level)
+	if i < 0 {
+		return fmt.Errorf("unknown log level %q, expected one of %s", level, strings.Join(Levels, ", "))
+	}
+	l.level = i
+	return nil
+}
+
+// SetStdout sets whether messages are echoed to stdout, as they are by default.
+// Loggers derived from l afterwards inherit it.
+func (l *Logger) SetStdout(enabled bool) {
+	l.quiet = !enabled
+}
+
+// NewStdoutLogger creates a logger writing to stdout and its remote outputs only,
+// for containers whose runtime collects stdout
+func NewStdoutLogger() *Logger {
+	return &Logger{
+		infoLogger:  log.New(io.Discard, "", 0),
+		errorLogger: log.New(io.Discard, "", 0),
+		warnLogger:  log.New(io.Discard, "", 0),
+	}
+}
+
+// AddRemote sends every message logged to remote as well. Loggers derived from l
+// afterwards inherit it; closing l does not close remote.
+func (l *Logger) AddRemote(remote *Remote) {
+	l.remotes = append(l.remotes, remote)
+}
+
+// WithPrefix returns a logger writing to the same log with prefix prepended to every
+// message. Closing it does not close the shared log file.
+func (l *Logger) WithPrefix(prefix string) *Logger {
+	return &Logger{
+		infoLogger:  l.infoLogger,
+		errorLogger: l.errorLogger,
+		warnLogger:  l.warnLogger,
+		prefix:      l.prefix + prefix + " ",
+		level:       l.level,
+		quiet:       l.quiet,
+		remotes:     l.remotes,
+	}
+}
+
+// ForContext returns a logger prefixing every message with the run ID carried by
+// ctx, or l itself outside of a run
+func (l *Logger) ForContext(ctx context.Context) *Logger {
+	id := runid.FromContext(ctx)
+	if id == "" {
+		return l
+	}
+	return l.WithPrefix("[run " + id + "]")
+}
+
 // Info logs an informational message
 func (l *Logger) Info(message string) {
-	l.infoLogger.Output(2, message)
-	fmt.Printf("[%s] INFO: %s\n", time.Now().Format("2006-01-02 15:04:05"), message)
+	l.output(0, l.infoLogger, "INFO", message)
 }
 
 // Error logs an error message
 func (l *Logger) Error(message string) {
-	l.errorLogger.Output(2, message)
-	fmt.Printf("[%s] ERROR: %s\n", time.Now().Format("2006-01-02 15:04:05"), message)
+	l.output(2, l.errorLogger, "ERROR", message)
 }
 
 // Warn logs a warning message
 func (l *Logger) Warn(message string) {
-	l.warnLogger.Output(2, message)
-	fmt.Printf("[%s] WARN: %s\n", time.Now().Format("2006-01-02 15:04:05"), message)
+	l.output(1, l.warnLogger, "WARN", message)
+}
+
+// output writes a message of the level at index level of Levels to the log file
+// and stdout, unless the logger drops it
+func (l *Logger) output(level int, logger *log.Logger, label, message string) {
+	if level < l.level {
+		return
+	}
+	message = l.prefix + message
+	// Skip output and the logging method to report the caller's line
+	logger.Output(3, message)
+	now := time.Now()
+	if !l.quiet {
+		fmt.Printf("[%s] %s: %s\n", now.Format("2006-01-02 15:04:05"), label, message)
+	}
+	for _, remote := range l.remotes {
+		remote.send(entry{level: Levels[level], message: message, at: now})
+	}
 }
 
 // Close closes the log file
@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoggerLevel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.log")
+	logger, err := NewLogger(path)
+	if err != nil {
+		t.Fatalf("NewLogger failed: %v", err)
+	}
+	if err := logger.SetLevel("debug"); err == nil {
+		t.Error("Expected an unknown level refused")
+	}
+	if err := logger.SetLevel(LevelWarn); err != nil {
+		t.Fatalf("SetLevel failed: %v", err)
+	}
+	logger.SetStdout(false)
+	derived := logger.WithPrefix("[orders]")
+	derived.Info("dropped")
+	derived.Warn("kept warning")
+	derived.Error("kept error")
+	logger.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	log := string(data)
+	if strings.Contains(log, "dropped") {
+		t.Errorf("Expected info messages dropped at level warn, got %q", log)
+	}
+	if !strings.Contains(log, "WARN: ") || !strings.Contains(log, "[orders] kept warning") || !strings.Contains(log, "[orders] kept error") {
+		t.Errorf("Expected warnings and errors with the prefix logged, got %q", log)
+	}
+	if !strings.Contains(log, "logger_test.go") {
+		t.Errorf("Expected the caller's file reported, got %q", log)
+	}
+}
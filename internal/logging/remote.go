@@ -0,0 +1,174 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// remoteBuffer is the number of messages waiting for a remote output before new
+// ones are dropped
+const remoteBuffer = 1024
+
+// remoteDialTimeout bounds connecting to a remote output
+const remoteDialTimeout = 5 * time.Second
+
+// entry is a message sent to remote outputs
+type entry struct {
+	level   string
+	message string
+	at      time.Time
+}
+
+// Remote ships log messages to a syslog server or a log collector such as
+// Logstash or Vector. Messages are sent in the background, so logging never waits
+// for the network; they are dropped while the buffer is full.
+type Remote struct {
+	network string
+	address string
+	format  func(entry) []byte
+	// frame delimits the messages of a TCP stream
+	frame   func([]byte) []byte
+	entries chan entry
+	done    chan struct{}
+	// closeOnce guards closing entries
+	closeOnce sync.Once
+}
+
+// NewSyslog creates an output sending messages to the syslog server at address,
+// e.g. udp://syslog:514 or tcp://syslog:601, as RFC 5424 messages of the user
+// facility from appName. TCP messages are framed by octet counting (RFC 6587).
+func NewSyslog(address, appName string) (*Remote, error) {
+	hostname, _ := os.Hostname()
+	return newRemote(address, func(e entry) []byte {
+		return syslogMessage(e, hostname, appName)
+	}, func(message []byte) []byte {
+		return append([]byte(strconv.Itoa(len(message))+" "), message...)
+	})
+}
+
+// NewShipper creates an output sending messages to a log collector at address,
+// e.g. tcp://vector:9000, as JSON, one object per line over TCP and per datagram
+// over UDP
+func NewShipper(address, appName string) (*Remote, error) {
+	hostname, _ := os.Hostname()
+	return newRemote(address, func(e entry) []byte {
+		return shipperMessage(e, hostname, appName)
+	}, func(message []byte) []byte {
+		return append(message, '\n')
+	})
+}
+
+func newRemote(address string, format func(entry) []byte, frame func([]byte) []byte) (*Remote, error) {
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "tcp" && u.Scheme != "udp") || u.Host == "" {
+		return nil, fmt.Errorf("invalid log output address %q, expected tcp://host:port or udp://host:port", address)
+	}
+	r := &Remote{
+		network: u.Scheme,
+		address: u.Host,
+		format:  format,
+		frame:   frame,
+		entries: make(chan entry, remoteBuffer),
+		done:    make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// send queues a message, dropping it when the buffer is full
+func (r *Remote) send(e entry) {
+	defer func() {
+		// The output was closed while a logger still used it
+		recover()
+	}()
+	select {
+	case r.entries <- e:
+	default:
+	}
+}
+
+// run writes queued messages, connecting again after a failed write. A message
+// that cannot be written once reconnected is dropped.
+func (r *Remote) run() {
+	defer close(r.done)
+	var conn net.Conn
+	failing := false
+	for e := range r.entries {
+		message := r.format(e)
+		if r.network == "tcp" {
+			message = r.frame(message)
+		}
+		var err error
+		for attempt := 0; attempt < 2; attempt++ {
+			if conn == nil {
+				if conn, err = net.DialTimeout(r.network, r.address, remoteDialTimeout); err != nil {
+					conn = nil
+					break
+				}
+			}
+			conn.SetWriteDeadline(time.Now().Add(remoteDialTimeout))
+			if _, err = conn.Write(message); err == nil {
+				break
+			}
+			conn.Close()
+			conn = nil
+		}
+		// Report the first failure of a streak only, on stderr as the log may be down
+		if err != nil && !failing {
+			fmt.Fprintf(os.Stderr, "Failed to send log messages to %s://%s: %v\n", r.network, r.address, err)
+		}
+		failing = err != nil
+	}
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// Close sends the queued messages and closes the connection
+func (r *Remote) Close() error {
+	r.closeOnce.Do(func() { close(r.entries) })
+	<-r.done
+	return nil
+}
+
+// syslogSeverities are the RFC 5424 severities of the log levels
+var syslogSeverities = map[string]int{LevelInfo: 6, LevelWarn: 4, LevelError: 3}
+
+// syslogFacilityUser is the RFC 5424 facility of user-level messages
+const syslogFacilityUser = 1
+
+// syslogMessage formats an RFC 5424 message, e.g.
+// <11>1 2025-10-01T13:00:00.000000Z host etl-pipeline 42 - - message
+func syslogMessage(e entry, hostname, appName string) []byte {
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		syslogFacilityUser*8+syslogSeverities[e.level],
+		e.at.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogField(hostname), syslogField(appName), os.Getpid(), e.message))
+}
+
+// syslogField returns a header field of a syslog message, "-" when it is empty
+func syslogField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// shipperMessage formats a message as a JSON object
+func shipperMessage(e entry, hostname, appName string) []byte {
+	message, _ := json.Marshal(map[string]string{
+		"@timestamp": e.at.UTC().Format(time.RFC3339Nano),
+		"level":      e.level,
+		"message":    e.message,
+		"host":       hostname,
+		"service":    appName,
+		"pid":        strconv.Itoa(os.Getpid()),
+	})
+	return message
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogOverUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Cannot listen on UDP: %v", err)
+	}
+	defer conn.Close()
+	remote, err := NewSyslog("udp://"+conn.LocalAddr().String(), "etl-pipeline")
+	if err != nil {
+		t.Fatalf("NewSyslog failed: %v", err)
+	}
+	logger := NewStdoutLogger()
+	logger.SetStdout(false)
+	logger.AddRemote(remote)
+	logger.WithPrefix("[orders]").Warn("Slow source")
+	remote.Close()
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("No syslog message received: %v", err)
+	}
+	// user facility (1) * 8 + warning severity (4)
+	pattern := regexp.MustCompile(`^<12>1 \d{4}-\d\d-\d\dT[\d:.]+Z \S+ etl-pipeline \d+ - - \[orders\] Slow source$`)
+	if got := string(buf[:n]); !pattern.MatchString(got) {
+		t.Errorf("Unexpected RFC 5424 message %q", got)
+	}
+}
+
+func TestShipperOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Cannot listen on TCP: %v", err)
+	}
+	defer listener.Close()
+	remote, err := NewShipper("tcp://"+listener.Addr().String(), "etl-pipeline")
+	if err != nil {
+		t.Fatalf("NewShipper failed: %v", err)
+	}
+	if _, err := NewShipper("http://vector:9000", "etl-pipeline"); err == nil {
+		t.Error("Expected an address without tcp or udp refused")
+	}
+	logger := NewStdoutLogger()
+	logger.SetStdout(false)
+	logger.AddRemote(remote)
+	logger.Info("first")
+	logger.Error("second")
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	lines := bufio.NewScanner(conn)
+	for _, want := range []struct{ level, message string }{{LevelInfo, "first"}, {LevelError, "second"}} {
+		if !lines.Scan() {
+			t.Fatalf("Expected a line for %q: %v", want.message, lines.Err())
+		}
+		var got map[string]string
+		if err := json.Unmarshal(lines.Bytes(), &got); err != nil {
+			t.Fatalf("Expected a JSON line, got %q", lines.Text())
+		}
+		if got["level"] != want.level || got["message"] != want.message || got["service"] != "etl-pipeline" || !strings.HasSuffix(got["@timestamp"], "Z") {
+			t.Errorf("Unexpected message %v", got)
+		}
+	}
+	remote.Close()
+}
@@ -0,0 +1,216 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat stamps rotated log files, e.g. etl-20240102T150405.000.log
+const backupTimeFormat = "20060102T150405.000"
+
+// RotationConfig bounds the size of a log file and the backups kept of it
+type RotationConfig struct {
+	// MaxSize rotates the file before a write grows it past this many bytes; zero
+	// never rotates
+	MaxSize int64
+	// MaxAge removes backups older than this; zero keeps them regardless of age
+	MaxAge time.Duration
+	// MaxBackups is the number of backups kept; zero keeps all of them
+	MaxBackups int
+	// Compress gzips backups
+	Compress bool
+}
+
+// rotatingFile is a log file renamed to a timestamped backup once it reaches its
+// maximum size, with old backups compressed and removed in the background
+type rotatingFile struct {
+	path string
+	cfg  RotationConfig
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+
+	// cleanMu serializes the cleanups of backups; cleaning tracks those running
+	cleanMu  sync.Mutex
+	cleaning sync.WaitGroup
+}
+
+func openRotatingFile(path string, cfg RotationConfig) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, cfg: cfg}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	// Backups left by earlier processes may be uncompressed or out of bounds
+	f.cleanup()
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p would grow it past MaxSize.
+// A failed rotation keeps writing to the current file.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.cfg.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.cfg.MaxSize {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rotate %s: %v\n", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file to a backup and reopens it. Callers hold f.mu.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	ext := filepath.Ext(f.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.path, ext), time.Now().UTC().Format(backupTimeFormat), ext)
+	renameErr := os.Rename(f.path, backup)
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return fmt.Errorf("failed to rename log file: %w", renameErr)
+	}
+	f.cleanup()
+	return nil
+}
+
+// cleanup compresses and prunes the backups in the background
+func (f *rotatingFile) cleanup() {
+	if !f.cfg.Compress && f.cfg.MaxAge == 0 && f.cfg.MaxBackups == 0 {
+		return
+	}
+	f.cleaning.Add(1)
+	go func() {
+		defer f.cleaning.Done()
+		f.cleanMu.Lock()
+		defer f.cleanMu.Unlock()
+		if err := f.cleanBackups(time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to clean up backups of %s: %v\n", f.path, err)
+		}
+	}()
+}
+
+// backup is a rotated log file
+type backup struct {
+	path      string
+	rotatedAt time.Time
+}
+
+// backups lists the backups of the file, newest first
+func (f *rotatingFile) backups() ([]backup, error) {
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(filepath.Base(f.path), ext) + "-"
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return nil, err
+	}
+	var backups []backup
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".gz")
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		rotatedAt, err := time.Parse(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+		if err != nil {
+			// Another file sharing the prefix, e.g. the log of another pipeline
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(filepath.Dir(f.path), entry.Name()), rotatedAt: rotatedAt})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].rotatedAt.After(backups[j].rotatedAt) })
+	return backups, nil
+}
+
+// cleanBackups removes the backups beyond MaxBackups or older than MaxAge at now
+// and compresses the others
+func (f *rotatingFile) cleanBackups(now time.Time) error {
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	for i, b := range backups {
+		if (f.cfg.MaxBackups > 0 && i >= f.cfg.MaxBackups) || (f.cfg.MaxAge > 0 && now.Sub(b.rotatedAt) > f.cfg.MaxAge) {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if f.cfg.Compress && !strings.HasSuffix(b.path, ".gz") {
+			if err := compressFile(b.path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compressFile replaces path with a gzipped copy at path.gz
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+	return os.Remove(path)
+}
+
+// Close closes the file once the cleanups in progress are done
+func (f *rotatingFile) Close() error {
+	f.cleaning.Wait()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "etl.log")
+	f, err := openRotatingFile(path, RotationConfig{MaxSize: 10, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("openRotatingFile failed: %v", err)
+	}
+	// The log of another pipeline sharing the prefix is left alone
+	other := filepath.Join(dir, "etl-orders.log")
+	os.WriteFile(other, []byte("orders\n"), 0644)
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		// Rotations within the same millisecond would share a backup name
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "fourth\n" {
+		t.Errorf("Expected the current file to hold the last line, got %q", data)
+	}
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups to be kept, got %+v", backups)
+	}
+	if !strings.HasSuffix(backups[0].path, ".log.gz") {
+		t.Fatalf("Expected backups to be compressed, got %s", backups[0].path)
+	}
+	gzFile, _ := os.Open(backups[0].path)
+	defer gzFile.Close()
+	gz, err := gzip.NewReader(gzFile)
+	if err != nil {
+		t.Fatalf("Failed to open compressed backup: %v", err)
+	}
+	if data, _ := io.ReadAll(gz); string(data) != "third\n" {
+		t.Errorf("Expected the newest backup to hold the third line, got %q", data)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("Expected the other log to be kept: %v", err)
+	}
+}
+
+func TestCleanBackupsMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	f := &rotatingFile{path: filepath.Join(dir, "etl.log"), cfg: RotationConfig{MaxAge: 24 * time.Hour}}
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	old := filepath.Join(dir, "etl-"+now.Add(-48*time.Hour).Format(backupTimeFormat)+".log.gz")
+	recent := filepath.Join(dir, "etl-"+now.Add(-time.Hour).Format(backupTimeFormat)+".log")
+	os.WriteFile(old, nil, 0644)
+	os.WriteFile(recent, nil, 0644)
+
+	if err := f.cleanBackups(now); err != nil {
+		t.Fatalf("cleanBackups failed: %v", err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("Expected the backup past MaxAge to be removed")
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("Expected the recent backup to be kept uncompressed: %v", err)
+	}
+}
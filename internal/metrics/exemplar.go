@@ -0,0 +1,19 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ObserveWithTrace observes value, attaching the trace ID of the span in ctx as
+// an exemplar when the trace is sampled, so a latency spike links to its trace
+func ObserveWithTrace(ctx context.Context, observer prometheus.Observer, value float64) {
+	span := trace.SpanContextFromContext(ctx)
+	if exemplars, ok := observer.(prometheus.ExemplarObserver); ok && span.IsSampled() {
+		exemplars.ObserveWithExemplar(value, prometheus.Labels{"trace_id": span.TraceID().String()})
+		return
+	}
+	observer.Observe(value)
+}
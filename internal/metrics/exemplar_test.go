@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestObserveWithTrace(t *testing.T) {
+	m := NewMetrics()
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	span := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+
+	ObserveWithTrace(context.Background(), m.APIRequestDuration, 0.2)
+	ObserveWithTrace(trace.ContextWithSpanContext(context.Background(), span), m.APIRequestDuration, 0.3)
+
+	families, err := m.registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "etl_api_request_duration_seconds" {
+			continue
+		}
+		histogram := family.GetMetric()[0].GetHistogram()
+		if histogram.GetSampleCount() != 2 {
+			t.Errorf("Expected both observations counted, got %d", histogram.GetSampleCount())
+		}
+		var exemplars []string
+		for _, bucket := range histogram.GetBucket() {
+			if exemplar := bucket.GetExemplar(); exemplar != nil {
+				exemplars = append(exemplars, exemplar.GetLabel()[0].GetValue())
+			}
+		}
+		if len(exemplars) != 1 || exemplars[0] != traceID.String() {
+			t.Errorf("Expected one exemplar of the sampled trace, got %v", exemplars)
+		}
+		return
+	}
+	t.Fatal("Histogram etl_api_request_duration_seconds not registered")
+}
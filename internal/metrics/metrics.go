@@ -1,57 +1,498 @@
 package metrics
 
 import (
+	"net/http"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/version"
 )
 
 // Metrics holds all Prometheus metrics for the ETL pipeline
 type Metrics struct {
-	APIRequestsTotal         prometheus.Counter
-	APIRequestsFailedTotal   prometheus.Counter
-	APIRequestDuration       prometheus.Histogram
-	RecordsProcessedTotal    prometheus.Counter
-	TransformationErrorTotal prometheus.Counter
-	DataSavedTotal           prometheus.Counter
-	DatabaseWritesTotal      prometheus.Counter
-	DatabaseWriteErrorsTotal prometheus.Counter
+	registry *prometheus.Registry
+
+	APIRequestsTotal            prometheus.Counter
+	APIRequestsFailedTotal      *prometheus.CounterVec
+	APIRequestDuration          prometheus.Histogram
+	APIRequestSize              prometheus.Histogram
+	APIResponseSize             prometheus.Histogram
+	QuarantinedPayloadsTotal    *prometheus.CounterVec
+	RecordsProcessedTotal       prometheus.Counter
+	SourceDeletesTotal          *prometheus.CounterVec
+	ChangeEventsTotal           *prometheus.CounterVec
+	TransformationErrorTotal    *prometheus.CounterVec
+	DataSavedTotal              prometheus.Counter
+	DatabaseWritesTotal         prometheus.Counter
+	DatabaseWriteErrorsTotal    *prometheus.CounterVec
+	SinkRecordsWrittenTotal     *prometheus.CounterVec
+	SinkWriteErrorsTotal        *prometheus.CounterVec
+	SinkWriteDuration           *prometheus.HistogramVec
+	SinkBatchesTotal            *prometheus.CounterVec
+	SinkRetriesTotal            *prometheus.CounterVec
+	SinkLastSuccessTimestamp    *prometheus.GaugeVec
+	ShardWatermark              *prometheus.GaugeVec
+	SQSMessagesTotal            *prometheus.CounterVec
+	KinesisRecordsTotal         *prometheus.CounterVec
+	KinesisMillisBehind         *prometheus.GaugeVec
+	RemoteWriteSamplesTotal     *prometheus.CounterVec
+	MongoDocumentsTotal         *prometheus.CounterVec
+	EndpointFetchesTotal        *prometheus.CounterVec
+	EndpointRecords             *prometheus.GaugeVec
+	PendingBatches              prometheus.Gauge
+	RetentionItemsPruned        *prometheus.CounterVec
+	RetentionBytesPruned        *prometheus.CounterVec
+	RetentionRunsTotal          *prometheus.CounterVec
+	RetentionLastRun            prometheus.Gauge
+	SourceComparisonsTotal      *prometheus.CounterVec
+	SourceComparisonDifferences *prometheus.CounterVec
+	CycleDuration               prometheus.Histogram
+	CycleBudgetOverrunsTotal    prometheus.Counter
+	CycleContinuationsTotal     prometheus.Counter
+	NextCycleTimestamp          prometheus.Gauge
+	PartitionsCreatedTotal      *prometheus.CounterVec
+	TableMaintenanceTotal       *prometheus.CounterVec
+	TransformAuditsTotal        *prometheus.CounterVec
+	DatabaseRetriesTotal        *prometheus.CounterVec
+	DatabaseStatementDuration   *prometheus.HistogramVec
+	DatabaseSlowStatementsTotal *prometheus.CounterVec
+	PipelineRunsTotal           *prometheus.CounterVec
+	DuplicateLoadsSkippedTotal  prometheus.Counter
+	PipelineRestartsTotal       prometheus.Counter
+	PipelinePaused              prometheus.Gauge
+	BackfillChunksTotal         *prometheus.CounterVec
+	DryRunsTotal                prometheus.Counter
+	CyclesSkippedTotal          prometheus.Counter
+	CyclesCancelledTotal        *prometheus.CounterVec
+	StepDuration                *prometheus.HistogramVec
+	StepRecordsTotal            *prometheus.CounterVec
+	StepFailuresTotal           *prometheus.CounterVec
+	ShardsClaimed               prometheus.Gauge
+	CycleRetriesTotal           prometheus.Counter
+	CycleRetriesExhaustedTotal  prometheus.Counter
+	LastCycleSuccess            prometheus.Gauge
+	CycleInProgress             prometheus.Gauge
+	LastSuccessfulRunTimestamp  prometheus.Gauge
+	ReplayedRecordsTotal        prometheus.Counter
+	RawRecordsSkippedTotal      prometheus.Counter
+	SourceBatchesTotal          *prometheus.CounterVec
+	StageTimeoutsTotal          *prometheus.CounterVec
+	StreamQueueDepth            *prometheus.GaugeVec
+	StreamInFlightRecords       prometheus.Gauge
+	StreamInFlightBytes         prometheus.Gauge
+	StreamThrottledSeconds      prometheus.Counter
+	LoadBatchRecords            prometheus.Histogram
+	LoadFlushesTotal            *prometheus.CounterVec
+	WebhookDeliveriesTotal      *prometheus.CounterVec
+	AlertsSentTotal             *prometheus.CounterVec
+	AlertsSuppressedTotal       *prometheus.CounterVec
+	DataFreshness               prometheus.Gauge
+	FreshnessSLOBreached        prometheus.Gauge
+	ConfigReloadsTotal          *prometheus.CounterVec
+	HTTPAuthFailuresTotal       *prometheus.CounterVec
+	HTTPRateLimitedTotal        prometheus.Counter
+	HTTPPanicsTotal             prometheus.Counter
+	EnrichLookupsTotal          *prometheus.CounterVec
+	DuplicatesSkippedTotal      prometheus.Counter
 }
 
-// NewMetrics creates and registers all metrics
+// NewMetrics creates and registers all metrics on a dedicated registry
 func NewMetrics() *Metrics {
+	return newMetrics(newRegistry(), nil)
+}
+
+// NewPipelineMetrics creates the process-wide metrics of a process running several
+// pipelines. They carry an empty pipeline label, which Prometheus drops, and
+// ForPipeline returns the metrics of each pipeline on the same registry.
+func NewPipelineMetrics() *Metrics {
+	return newMetrics(newRegistry(), prometheus.Labels{PipelineLabel: ""})
+}
+
+// PipelineLabel names the pipeline of metrics returned by ForPipeline
+const PipelineLabel = "pipeline"
+
+// ForPipeline registers the metrics of one pipeline, labelled with its name, on
+// the registry of metrics created by NewPipelineMetrics
+func (m *Metrics) ForPipeline(name string) *Metrics {
+	return newMetrics(m.registry, prometheus.Labels{PipelineLabel: name})
+}
+
+func newRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	// The build of the process, once per process rather than per pipeline
+	build := version.Get()
+	promauto.With(registry).NewGauge(prometheus.GaugeOpts{
+		Name: "etl_build_info",
+		Help: "Build of the running binary, always 1",
+		ConstLabels: prometheus.Labels{
+			"version":    build.Version,
+			"commit":     build.Commit,
+			"build_date": build.BuildDate,
+			"go_version": build.GoVersion,
+		},
+	}).Set(1)
+	return registry
+}
+
+// newMetrics registers all metrics on registry, with labels added to each of them
+func newMetrics(registry *prometheus.Registry, labels prometheus.Labels) *Metrics {
+	var registerer prometheus.Registerer = registry
+	if labels != nil {
+		registerer = prometheus.WrapRegistererWith(labels, registry)
+	}
+	factory := promauto.With(registerer)
+
 	return &Metrics{
-		APIRequestsTotal: promauto.NewCounter(prometheus.CounterOpts{
+		registry: registry,
+		APIRequestsTotal: factory.NewCounter(prometheus.CounterOpts{
 			Name: "etl_api_requests_total",
 			Help: "Total number of API requests made",
 		}),
-		APIRequestsFailedTotal: promauto.NewCounter(prometheus.CounterOpts{
+		APIRequestsFailedTotal: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "etl_api_requests_failed_total",
-			Help: "Total number of failed API requests",
-		}),
-		APIRequestDuration: promauto.NewHistogram(prometheus.HistogramOpts{
+			Help: "Total number of failed API requests by reason",
+		}, []string{"reason"}),
+		APIRequestDuration: factory.NewHistogram(prometheus.HistogramOpts{
 			Name:    "etl_api_request_duration_seconds",
 			Help:    "Duration of API requests in seconds",
 			Buckets: prometheus.DefBuckets,
 		}),
-		RecordsProcessedTotal: promauto.NewCounter(prometheus.CounterOpts{
+		APIRequestSize: factory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "etl_api_request_size_bytes",
+			Help:    "Size of API request bodies in bytes",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+		}),
+		APIResponseSize: factory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "etl_api_response_size_bytes",
+			Help:    "Size of API response bodies read in bytes",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+		}),
+		QuarantinedPayloadsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_quarantined_payloads_total",
+			Help: "Total number of API response bodies quarantined as unparseable by reason",
+		}, []string{"reason"}),
+		RecordsProcessedTotal: factory.NewCounter(prometheus.CounterOpts{
 			Name: "etl_records_processed_total",
 			Help: "Total number of records processed",
 		}),
-		TransformationErrorTotal: promauto.NewCounter(prometheus.CounterOpts{
+		SourceDeletesTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_source_deletes_total",
+			Help: "Total number of processed rows deleted, soft-deleted or tombstoned for records the source marks as deleted, by mode",
+		}, []string{"mode"}),
+		ChangeEventsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_change_events_total",
+			Help: "Total number of change events published by op, insert, update or delete",
+		}, []string{"op"}),
+		TransformationErrorTotal: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "etl_transformation_errors_total",
-			Help: "Total number of transformation errors",
-		}),
-		DataSavedTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Help: "Total number of records failing transformation by reason",
+		}, []string{"reason"}),
+		DataSavedTotal: factory.NewCounter(prometheus.CounterOpts{
 			Name: "etl_data_saved_total",
 			Help: "Total number of successful data saves",
 		}),
-		DatabaseWritesTotal: promauto.NewCounter(prometheus.CounterOpts{
+		DatabaseWritesTotal: factory.NewCounter(prometheus.CounterOpts{
 			Name: "etl_database_writes_total",
 			Help: "Total number of database write operations",
 		}),
-		DatabaseWriteErrorsTotal: promauto.NewCounter(prometheus.CounterOpts{
+		DatabaseWriteErrorsTotal: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "etl_database_write_errors_total",
-			Help: "Total number of database write errors",
+			Help: "Total number of database write errors by reason",
+		}, []string{"reason"}),
+		SinkRecordsWrittenTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_sink_records_written_total",
+			Help: "Total number of records written to each sink",
+		}, []string{"sink"}),
+		SinkWriteErrorsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_sink_write_errors_total",
+			Help: "Total number of records rejected by each sink",
+		}, []string{"sink"}),
+		SinkWriteDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "etl_sink_write_duration_seconds",
+			Help:    "Duration of sink writes until delivery is confirmed",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"sink"}),
+		SinkBatchesTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_sink_batches_total",
+			Help: "Total number of batches loaded per sink by final status",
+		}, []string{"sink", "status"}),
+		SinkRetriesTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_sink_retries_total",
+			Help: "Total number of sink write retries",
+		}, []string{"sink"}),
+		SinkLastSuccessTimestamp: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "etl_sink_last_success_timestamp_seconds",
+			Help: "Unix time of the last batch successfully loaded per sink",
+		}, []string{"sink"}),
+		ShardWatermark: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "etl_extraction_shard_watermark",
+			Help: "Highest id committed per extraction shard",
+		}, []string{"shard"}),
+		SQSMessagesTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_sqs_messages_total",
+			Help: "Total number of SQS messages by outcome (received, deleted, released, extended, dead_lettered)",
+		}, []string{"outcome"}),
+		KinesisRecordsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_kinesis_records_total",
+			Help: "Total number of Kinesis records by outcome (received, skipped)",
+		}, []string{"outcome"}),
+		KinesisMillisBehind: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "etl_kinesis_millis_behind_latest",
+			Help: "How far each Kinesis shard was behind the tip of the stream when last read, in milliseconds",
+		}, []string{"shard"}),
+		RemoteWriteSamplesTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_remote_write_samples_total",
+			Help: "Total number of samples of the Prometheus remote-write sink by outcome (sent, rejected, skipped)",
+		}, []string{"outcome"}),
+		MongoDocumentsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_mongo_documents_total",
+			Help: "Total number of documents upserted by the MongoDB sink by outcome (upserted, matched, rejected)",
+		}, []string{"outcome"}),
+		EndpointFetchesTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_endpoint_fetches_total",
+			Help: "Total number of fetches of each configured API endpoint by outcome, success, failed or unfinished",
+		}, []string{"endpoint", "status"}),
+		EndpointRecords: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "etl_endpoint_records",
+			Help: "Records fetched from each configured API endpoint by the last cycle",
+		}, []string{"endpoint"}),
+		PendingBatches: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_pending_batches",
+			Help: "Number of batches stored on disk waiting to be loaded into the database",
+		}),
+		RetentionItemsPruned: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_retention_items_pruned_total",
+			Help: "Total number of rows, files or objects deleted by retention",
+		}, []string{"dataset", "target"}),
+		RetentionBytesPruned: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_retention_bytes_pruned_total",
+			Help: "Total number of bytes of files and objects deleted by retention",
+		}, []string{"dataset", "target"}),
+		RetentionRunsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_retention_runs_total",
+			Help: "Total number of retention runs by status",
+		}, []string{"status"}),
+		RetentionLastRun: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_retention_last_run_timestamp_seconds",
+			Help: "Unix time of the last enforced retention run",
+		}),
+		SourceComparisonsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_source_comparisons_total",
+			Help: "Total number of source environment comparisons by result",
+		}, []string{"result"}),
+		SourceComparisonDifferences: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_source_comparison_differences_total",
+			Help: "Total number of records differing between source environments by kind",
+		}, []string{"kind"}),
+		CycleDuration: factory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "etl_cycle_duration_seconds",
+			Help:    "Duration of pipeline cycles in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 10),
+		}),
+		CycleBudgetOverrunsTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_cycle_budget_overruns_total",
+			Help: "Total number of cycles that exceeded the cycle latency budget",
+		}),
+		CycleContinuationsTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_cycle_continuations_total",
+			Help: "Total number of cycles cut short whose remainder was left to a continuation cycle",
+		}),
+		NextCycleTimestamp: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_next_cycle_timestamp_seconds",
+			Help: "Unix time the next scheduled cycle is due",
+		}),
+		PartitionsCreatedTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_partitions_created_total",
+			Help: "Total number of table partitions created ahead of time",
+		}, []string{"table"}),
+		TableMaintenanceTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_table_maintenance_total",
+			Help: "Total number of scheduled table maintenance runs by table and outcome: done, skipped or failed",
+		}, []string{"table", "status"}),
+		TransformAuditsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_transform_audits_total",
+			Help: "Total number of field changes recorded in the transformation audit trail",
+		}, []string{"stage"}),
+		DatabaseRetriesTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_database_retries_total",
+			Help: "Total number of database transactions retried after a transient error",
+		}, []string{"reason"}),
+		DatabaseStatementDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "etl_database_statement_duration_seconds",
+			Help:    "Duration of database statements in seconds, by command and table, e.g. INSERT raw_data",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+		}, []string{"statement"}),
+		DatabaseSlowStatementsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_database_slow_statements_total",
+			Help: "Total number of database statements slower than the slow query threshold, by command and table",
+		}, []string{"statement"}),
+		PipelineRunsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_pipeline_runs_total",
+			Help: "Total number of pipeline runs by final status",
+		}, []string{"status"}),
+		DuplicateLoadsSkippedTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_duplicate_loads_skipped_total",
+			Help: "Total number of processed batches skipped because their run was already loaded",
+		}),
+		PipelineRestartsTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_pipeline_restarts_total",
+			Help: "Total number of times a supervised pipeline was restarted after a panic",
+		}),
+		PipelinePaused: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_pipeline_paused",
+			Help: "Whether scheduled cycles of the pipeline are paused (1) or running (0)",
+		}),
+		BackfillChunksTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_backfill_chunks_total",
+			Help: "Total number of backfill chunks extracted and loaded by outcome",
+		}, []string{"status"}),
+		DryRunsTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_dry_runs_total",
+			Help: "Total number of dry runs that extracted and transformed a batch without writing it",
+		}),
+		CyclesSkippedTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_cycles_skipped_total",
+			Help: "Total number of scheduled cycles skipped because the previous cycle was still running",
+		}),
+		CyclesCancelledTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_cycles_cancelled_total",
+			Help: "Total number of cycles cancelled by reason, timeout, overlap or shutdown",
+		}, []string{"reason"}),
+		StepDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "etl_step_duration_seconds",
+			Help:    "Duration of the steps of DAG pipelines in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+		}, []string{"step"}),
+		StepRecordsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_step_records_total",
+			Help: "Total number of records output by the steps of DAG pipelines",
+		}, []string{"step"}),
+		StepFailuresTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_step_failures_total",
+			Help: "Total number of failed steps of DAG pipelines",
+		}, []string{"step"}),
+		ShardsClaimed: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_shards_claimed",
+			Help: "Number of id-range shards this instance holds a lease on",
+		}),
+		CycleRetriesTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_cycle_retries_total",
+			Help: "Total number of retries of failed cycles",
+		}),
+		CycleRetriesExhaustedTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_cycle_retries_exhausted_total",
+			Help: "Total number of cycles that still failed after all retry attempts",
+		}),
+		LastCycleSuccess: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_last_cycle_success",
+			Help: "Whether the last cycle succeeded (1) or failed (0)",
+		}),
+		CycleInProgress: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_cycle_in_progress",
+			Help: "Whether a cycle is running (1) or not (0)",
+		}),
+		LastSuccessfulRunTimestamp: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_last_successful_run_timestamp",
+			Help: "Unix time the last successful cycle finished",
+		}),
+		ReplayedRecordsTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_replayed_records_total",
+			Help: "Total number of stored raw records read again by replays",
+		}),
+		RawRecordsSkippedTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_raw_records_skipped_total",
+			Help: "Total number of raw records not stored because of the raw storage mode",
+		}),
+		SourceBatchesTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_source_batches_total",
+			Help: "Total number of extracted batches settled with their source, by outcome (acked, nacked, failed)",
+		}, []string{"outcome"}),
+		StageTimeoutsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_stage_timeouts_total",
+			Help: "Total number of run stages cut off by their timeout, by stage",
+		}, []string{"stage"}),
+		StreamQueueDepth: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "etl_stream_queue_depth",
+			Help: "Pages of records waiting between the stages of streaming cycles, by queue",
+		}, []string{"queue"}),
+		StreamInFlightRecords: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_stream_inflight_records",
+			Help: "Records of streaming cycles extracted but not loaded yet",
+		}),
+		StreamInFlightBytes: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_stream_inflight_bytes",
+			Help: "Estimated size in bytes of the records of streaming cycles extracted but not loaded yet",
+		}),
+		StreamThrottledSeconds: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_stream_throttled_seconds_total",
+			Help: "Total time extraction of streaming cycles waited for the in-flight record budget",
+		}),
+		LoadBatchRecords: factory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "etl_load_batch_records",
+			Help:    "Records of the batches stored and loaded by streaming cycles",
+			Buckets: prometheus.ExponentialBuckets(10, 2, 12),
+		}),
+		LoadFlushesTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_load_flushes_total",
+			Help: "Total number of batches stored and loaded by streaming cycles, by the reason they were flushed",
+		}, []string{"reason"}),
+		WebhookDeliveriesTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_webhook_deliveries_total",
+			Help: "Total number of cycle webhook deliveries by outcome, delivered or failed",
+		}, []string{"status"}),
+		AlertsSentTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_alerts_sent_total",
+			Help: "Total number of alerts sent by channel and outcome, sent or failed",
+		}, []string{"channel", "status"}),
+		AlertsSuppressedTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_alerts_suppressed_total",
+			Help: "Total number of repeated alerts held back by deduplication, by alert",
+		}, []string{"alert"}),
+		DataFreshness: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_data_freshness_seconds",
+			Help: "Age of the processed data, since a run last brought it up to date with the source",
+		}),
+		FreshnessSLOBreached: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "etl_freshness_slo_breached",
+			Help: "Whether the processed data is older than its freshness objective (1) or not (0)",
+		}),
+		ConfigReloadsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_config_reloads_total",
+			Help: "Total number of configuration reloads by outcome, success or failure",
+		}, []string{"status"}),
+		HTTPAuthFailuresTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_http_auth_failures_total",
+			Help: "Total number of HTTP requests rejected by reason: missing or invalid credentials, or forbidden",
+		}, []string{"reason"}),
+		HTTPRateLimitedTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_http_rate_limited_total",
+			Help: "Total number of HTTP control requests rejected by the per-client rate limit",
+		}),
+		HTTPPanicsTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_http_panics_total",
+			Help: "Total number of HTTP requests that panicked and were answered with 500",
+		}),
+		EnrichLookupsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "etl_enrich_lookups_total",
+			Help: "Total number of enrichment lookups by outcome, cached, fetched, not_found or failed",
+		}, []string{"outcome"}),
+		DuplicatesSkippedTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "etl_duplicate_records_skipped_total",
+			Help: "Total number of processed records not loaded because they were loaded unchanged within the dedup TTL",
 		}),
 	}
 }
+
+// Handler returns an HTTP handler exposing the registered metrics, in the
+// OpenMetrics format with exemplars to scrapers asking for it
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
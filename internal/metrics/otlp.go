@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// Metrics exporters selectable next to the /metrics endpoint
+const (
+	ExporterPrometheus = "prometheus"
+	ExporterOTLP       = "otlp"
+)
+
+// OTLPConfig holds the settings of the OTLP metrics export
+type OTLPConfig struct {
+	// Endpoint is the base URL of the OTLP/HTTP collector, e.g.
+	// http://localhost:4318; metrics are posted to its /v1/metrics
+	Endpoint    string
+	ServiceName string
+	// Interval is the time between two exports
+	Interval time.Duration
+}
+
+// ExportOTLP pushes every metric of the registry to an OTLP collector each
+// cfg.Interval, as counters, gauges and histograms mirroring the Prometheus ones.
+// /metrics keeps serving them. The returned function exports the metrics a last
+// time and stops the export.
+func (m *Metrics) ExportOTLP(ctx context.Context, cfg OTLPConfig) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("an OTLP endpoint is required")
+	}
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("export interval must be positive")
+	}
+	exporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(strings.TrimSuffix(cfg.Endpoint, "/")+"/v1/metrics"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(cfg.Interval),
+		sdkmetric.WithProducer(newProducer(m.registry)),
+	)
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+	)
+	return provider.Shutdown, nil
+}
+
+// producer converts the metrics gathered from a Prometheus registry to OTel
+// metric data
+type producer struct {
+	gatherer prometheus.Gatherer
+	// start is reported as the start of every cumulative series
+	start time.Time
+}
+
+func newProducer(gatherer prometheus.Gatherer) *producer {
+	return &producer{gatherer: gatherer, start: time.Now()}
+}
+
+// Produce gathers the registry. Summaries and untyped metrics are exported too;
+// metrics of other types are skipped.
+func (p *producer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	families, err := p.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return nil, fmt.Errorf("failed to gather metrics: %w", err)
+	}
+	now := time.Now()
+	scope := metricdata.ScopeMetrics{
+		Scope: instrumentation.Scope{Name: "github.com/mohammedhassan/etl-pipeline"},
+	}
+	for _, family := range families {
+		data := p.convert(family, now)
+		if data == nil {
+			continue
+		}
+		scope.Metrics = append(scope.Metrics, metricdata.Metrics{
+			Name:        family.GetName(),
+			Description: family.GetHelp(),
+			Data:        data,
+		})
+	}
+	// A partial gather still exports the metrics it collected
+	return []metricdata.ScopeMetrics{scope}, err
+}
+
+// convert returns the OTel aggregation of a metric family, nil for unknown types
+func (p *producer) convert(family *dto.MetricFamily, now time.Time) metricdata.Aggregation {
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		sum := metricdata.Sum[float64]{Temporality: metricdata.CumulativeTemporality, IsMonotonic: true}
+		for _, m := range family.GetMetric() {
+			sum.DataPoints = append(sum.DataPoints, metricdata.DataPoint[float64]{
+				Attributes: attributes(m), StartTime: p.start, Time: now, Value: m.GetCounter().GetValue(),
+			})
+		}
+		return sum
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		var gauge metricdata.Gauge[float64]
+		for _, m := range family.GetMetric() {
+			value := m.GetGauge().GetValue()
+			if family.GetType() == dto.MetricType_UNTYPED {
+				value = m.GetUntyped().GetValue()
+			}
+			gauge.DataPoints = append(gauge.DataPoints, metricdata.DataPoint[float64]{
+				Attributes: attributes(m), Time: now, Value: value,
+			})
+		}
+		return gauge
+	case dto.MetricType_HISTOGRAM:
+		histogram := metricdata.Histogram[float64]{Temporality: metricdata.CumulativeTemporality}
+		for _, m := range family.GetMetric() {
+			histogram.DataPoints = append(histogram.DataPoints, p.histogramPoint(m, now))
+		}
+		return histogram
+	case dto.MetricType_SUMMARY:
+		var summary metricdata.Summary
+		for _, m := range family.GetMetric() {
+			point := metricdata.SummaryDataPoint{
+				Attributes: attributes(m), StartTime: p.start, Time: now,
+				Count: m.GetSummary().GetSampleCount(), Sum: m.GetSummary().GetSampleSum(),
+			}
+			for _, q := range m.GetSummary().GetQuantile() {
+				point.QuantileValues = append(point.QuantileValues, metricdata.QuantileValue{Quantile: q.GetQuantile(), Value: q.GetValue()})
+			}
+			summary.DataPoints = append(summary.DataPoints, point)
+		}
+		return summary
+	}
+	return nil
+}
+
+// histogramPoint converts the cumulative buckets of a Prometheus histogram to the
+// per-bucket counts of OTel, whose last bucket counts the values above every bound
+func (p *producer) histogramPoint(m *dto.Metric, now time.Time) metricdata.HistogramDataPoint[float64] {
+	h := m.GetHistogram()
+	point := metricdata.HistogramDataPoint[float64]{
+		Attributes: attributes(m), StartTime: p.start, Time: now,
+		Count: h.GetSampleCount(), Sum: h.GetSampleSum(),
+	}
+	var below uint64
+	for _, bucket := range h.GetBucket() {
+		if math.IsInf(bucket.GetUpperBound(), 1) {
+			continue
+		}
+		point.Bounds = append(point.Bounds, bucket.GetUpperBound())
+		point.BucketCounts = append(point.BucketCounts, bucket.GetCumulativeCount()-below)
+		below = bucket.GetCumulativeCount()
+	}
+	point.BucketCounts = append(point.BucketCounts, h.GetSampleCount()-below)
+	return point
+}
+
+// attributes returns the labels of a metric as attributes. Empty labels are
+// dropped, as Prometheus does.
+func attributes(m *dto.Metric) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(m.GetLabel()))
+	for _, label := range m.GetLabel() {
+		if label.GetValue() != "" {
+			kvs = append(kvs, attribute.String(label.GetName(), label.GetValue()))
+		}
+	}
+	return attribute.NewSet(kvs...)
+}
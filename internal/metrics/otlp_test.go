@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// produce returns the metric data produced from the registry of m by name
+func produce(t *testing.T, m *Metrics) map[string]metricdata.Aggregation {
+	t.Helper()
+	scopes, err := newProducer(m.registry).Produce(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(scopes) != 1 {
+		t.Fatalf("expected 1 scope, got %d", len(scopes))
+	}
+	byName := make(map[string]metricdata.Aggregation)
+	for _, metric := range scopes[0].Metrics {
+		byName[metric.Name] = metric.Data
+	}
+	return byName
+}
+
+func TestProducer(t *testing.T) {
+	m := NewMetrics()
+	m.APIRequestsTotal.Add(3)
+	m.SinkBatchesTotal.WithLabelValues("kafka", "success").Inc()
+	m.DataFreshness.Set(42)
+	for _, v := range []float64{0.05, 0.3, 0.3, 100} {
+		m.APIRequestDuration.Observe(v)
+	}
+
+	byName := produce(t, m)
+
+	requests, ok := byName["etl_api_requests_total"].(metricdata.Sum[float64])
+	if !ok || !requests.IsMonotonic || requests.Temporality != metricdata.CumulativeTemporality {
+		t.Fatalf("expected a cumulative monotonic sum, got %#v", byName["etl_api_requests_total"])
+	}
+	if len(requests.DataPoints) != 1 || requests.DataPoints[0].Value != 3 {
+		t.Errorf("expected 3 requests, got %+v", requests.DataPoints)
+	}
+
+	batches := byName["etl_sink_batches_total"].(metricdata.Sum[float64])
+	want := attribute.NewSet(attribute.String("sink", "kafka"), attribute.String("status", "success"))
+	if len(batches.DataPoints) != 1 || !batches.DataPoints[0].Attributes.Equals(&want) {
+		t.Errorf("expected the labels as attributes, got %+v", batches.DataPoints)
+	}
+
+	freshness, ok := byName["etl_data_freshness_seconds"].(metricdata.Gauge[float64])
+	if !ok || len(freshness.DataPoints) != 1 || freshness.DataPoints[0].Value != 42 {
+		t.Errorf("expected a gauge of 42, got %#v", byName["etl_data_freshness_seconds"])
+	}
+
+	duration, ok := byName["etl_api_request_duration_seconds"].(metricdata.Histogram[float64])
+	if !ok || len(duration.DataPoints) != 1 {
+		t.Fatalf("expected a histogram, got %#v", byName["etl_api_request_duration_seconds"])
+	}
+	point := duration.DataPoints[0]
+	if point.Count != 4 || point.Sum != 100.65 {
+		t.Errorf("expected 4 values summing to 100.65, got %d and %v", point.Count, point.Sum)
+	}
+	if len(point.BucketCounts) != len(point.Bounds)+1 {
+		t.Fatalf("expected one bucket per bound and an overflow bucket, got %d for %d bounds", len(point.BucketCounts), len(point.Bounds))
+	}
+	// Each value lands in exactly one bucket, 100 above every bound
+	var total uint64
+	for _, count := range point.BucketCounts {
+		total += count
+	}
+	if total != 4 || point.BucketCounts[len(point.BucketCounts)-1] != 1 {
+		t.Errorf("unexpected bucket counts %v for bounds %v", point.BucketCounts, point.Bounds)
+	}
+	i := slices.Index(point.Bounds, 0.5)
+	if i < 0 || point.BucketCounts[i] != 2 {
+		t.Errorf("expected both 0.3 values in the bucket up to 0.5, got %v for bounds %v", point.BucketCounts, point.Bounds)
+	}
+}
+
+func TestProducerPipelineLabel(t *testing.T) {
+	m := NewPipelineMetrics()
+	m.ForPipeline("orders").APIRequestsTotal.Inc()
+
+	requests := produce(t, m)["etl_api_requests_total"].(metricdata.Sum[float64])
+	if len(requests.DataPoints) != 2 {
+		t.Fatalf("expected the process-wide and the pipeline series, got %+v", requests.DataPoints)
+	}
+	for _, point := range requests.DataPoints {
+		pipeline, ok := point.Attributes.Value(PipelineLabel)
+		switch {
+		case !ok && point.Value != 0:
+			t.Errorf("expected no process-wide requests, got %v", point.Value)
+		case ok && (pipeline.AsString() != "orders" || point.Value != 1):
+			t.Errorf("expected 1 request of orders, got %v of %q", point.Value, pipeline.AsString())
+		}
+	}
+}
+
+func TestExportOTLPValidation(t *testing.T) {
+	m := NewMetrics()
+	if _, err := m.ExportOTLP(context.Background(), OTLPConfig{Interval: 1}); err == nil {
+		t.Error("expected an error without an endpoint")
+	}
+	if _, err := m.ExportOTLP(context.Background(), OTLPConfig{Endpoint: "http://localhost:4318"}); err == nil {
+		t.Error("expected an error without an interval")
+	}
+}
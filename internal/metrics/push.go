@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// statsdPacketSize bounds the UDP packets sent to StatsD, below common MTUs
+const statsdPacketSize = 1432
+
+// PushConfig holds the settings of pushing metrics, for deployments too short-lived
+// to be scraped
+type PushConfig struct {
+	// PushgatewayURL is the Prometheus Pushgateway the registry is pushed to, under
+	// Job and an instance label of Instance; empty disables it
+	PushgatewayURL string
+	Job            string
+	Instance       string
+	// StatsDAddr is the host:port of the StatsD server metrics are sent to over UDP;
+	// empty disables it
+	StatsDAddr   string
+	StatsDPrefix string
+	// Timeout bounds each push
+	Timeout time.Duration
+}
+
+// Pusher pushes the metrics of a registry to a Pushgateway and a StatsD server
+type Pusher struct {
+	cfg      PushConfig
+	gatherer prometheus.Gatherer
+	gateway  *push.Pusher
+
+	mu sync.Mutex
+	// sent holds the counter values last sent to StatsD, which takes increments
+	sent map[string]float64
+}
+
+// NewPusher creates a pusher of the registry of m
+func (m *Metrics) NewPusher(cfg PushConfig) (*Pusher, error) {
+	if cfg.PushgatewayURL == "" && cfg.StatsDAddr == "" {
+		return nil, errors.New("a pushgateway URL or a StatsD address is required")
+	}
+	p := &Pusher{cfg: cfg, gatherer: m.registry, sent: make(map[string]float64)}
+	if cfg.PushgatewayURL != "" {
+		if cfg.Job == "" {
+			return nil, errors.New("a pushgateway job name is required")
+		}
+		p.gateway = push.New(cfg.PushgatewayURL, cfg.Job).
+			Gatherer(m.registry).
+			Client(&http.Client{Timeout: cfg.Timeout})
+		if cfg.Instance != "" {
+			p.gateway = p.gateway.Grouping("instance", cfg.Instance)
+		}
+	}
+	if cfg.StatsDAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.StatsDAddr); err != nil {
+			return nil, fmt.Errorf("invalid StatsD address %q: %w", cfg.StatsDAddr, err)
+		}
+	}
+	return p, nil
+}
+
+// Push sends the current metrics to every configured target. The Pushgateway
+// group is replaced as a whole; StatsD receives gauges as they are and the
+// increments of counters, histogram and summary counts and sums since the last push.
+func (p *Pusher) Push(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	if p.gateway != nil {
+		if err := p.gateway.PushContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to push to pushgateway: %w", err))
+		}
+	}
+	if p.cfg.StatsDAddr != "" {
+		if err := p.pushStatsD(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send to StatsD: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pushStatsD sends the gathered metrics as DogStatsD lines, tagged with their labels
+func (p *Pusher) pushStatsD(ctx context.Context) error {
+	families, err := p.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return err
+	}
+	dialer := net.Dialer{Timeout: p.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "udp", p.cfg.StatsDAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var packet strings.Builder
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write([]byte(packet.String()))
+		packet.Reset()
+		return err
+	}
+	for _, line := range p.statsdLines(families) {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return flush()
+}
+
+// statsdLines renders metric families as StatsD lines, recording the counter
+// values sent. Counters that did not change since the last push are left out.
+func (p *Pusher) statsdLines(families []*dto.MetricFamily) []string {
+	var lines []string
+	for _, family := range families {
+		name := p.cfg.StatsDPrefix + family.GetName()
+		for _, m := range family.GetMetric() {
+			tags := statsdTags(m)
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				lines = append(lines, statsdLine(name, m.GetGauge().GetValue(), "g", tags))
+			case dto.MetricType_UNTYPED:
+				lines = append(lines, statsdLine(name, m.GetUntyped().GetValue(), "g", tags))
+			case dto.MetricType_COUNTER:
+				lines = p.appendIncrement(lines, name, m.GetCounter().GetValue(), tags)
+			case dto.MetricType_HISTOGRAM:
+				lines = p.appendIncrement(lines, name+"_count", float64(m.GetHistogram().GetSampleCount()), tags)
+				lines = p.appendIncrement(lines, name+"_sum", m.GetHistogram().GetSampleSum(), tags)
+			case dto.MetricType_SUMMARY:
+				lines = p.appendIncrement(lines, name+"_count", float64(m.GetSummary().GetSampleCount()), tags)
+				lines = p.appendIncrement(lines, name+"_sum", m.GetSummary().GetSampleSum(), tags)
+			}
+		}
+	}
+	return lines
+}
+
+// appendIncrement appends the counter line of the increase of a cumulative value
+// since it was last sent, if any
+func (p *Pusher) appendIncrement(lines []string, name string, value float64, tags string) []string {
+	key := name + tags
+	delta := value - p.sent[key]
+	p.sent[key] = value
+	if delta <= 0 {
+		// Unchanged, or reset by a restart of the process
+		return lines
+	}
+	return append(lines, statsdLine(name, delta, "c", tags))
+}
+
+func statsdLine(name string, value float64, kind, tags string) string {
+	line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind
+	if tags != "" {
+		line += "|#" + tags
+	}
+	return line
+}
+
+// statsdTags renders the non-empty labels of a metric as sorted DogStatsD tags
+func statsdTags(m *dto.Metric) string {
+	var tags []string
+	for _, label := range m.GetLabel() {
+		if label.GetValue() != "" {
+			tags = append(tags, label.GetName()+":"+statsdEscaper.Replace(label.GetValue()))
+		}
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, ",")
+}
+
+// statsdEscaper replaces the characters delimiting StatsD lines and tags
+var statsdEscaper = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_")
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushgateway(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	m := NewMetrics()
+	m.APIRequestsTotal.Add(2)
+	pusher, err := m.NewPusher(PushConfig{PushgatewayURL: server.URL, Job: "etl", Instance: "worker-1", Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pusher.Push(context.Background()); err != nil {
+		t.Fatalf("unexpected push error: %v", err)
+	}
+	if method != http.MethodPut || path != "/metrics/job/etl/instance/worker-1" {
+		t.Errorf("expected a PUT of the job group, got %s %s", method, path)
+	}
+	if !strings.Contains(body, "etl_api_requests_total") {
+		t.Error("expected the registry to be pushed")
+	}
+}
+
+func TestStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+	receive := func() []string {
+		t.Helper()
+		var lines []string
+		buf := make([]byte, 65536)
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return lines
+			}
+			lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+		}
+	}
+
+	m := NewPipelineMetrics().ForPipeline("orders")
+	m.APIRequestsTotal.Add(2)
+	m.SinkBatchesTotal.WithLabelValues("kafka", "success").Inc()
+	m.DataFreshness.Set(30)
+	pusher, err := m.NewPusher(PushConfig{StatsDAddr: conn.LocalAddr().String(), StatsDPrefix: "prod.", Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := pusher.Push(context.Background()); err != nil {
+		t.Fatalf("unexpected push error: %v", err)
+	}
+	lines := receive()
+	for _, want := range []string{
+		"prod.etl_api_requests_total:2|c|#pipeline:orders",
+		"prod.etl_sink_batches_total:1|c|#pipeline:orders,sink:kafka,status:success",
+		"prod.etl_data_freshness_seconds:30|g|#pipeline:orders",
+	} {
+		if !slices.Contains(lines, want) {
+			t.Errorf("expected %q to be sent", want)
+		}
+	}
+
+	// Counters are sent as increments since the last push
+	m.APIRequestsTotal.Inc()
+	if err := pusher.Push(context.Background()); err != nil {
+		t.Fatalf("unexpected push error: %v", err)
+	}
+	lines = receive()
+	if !slices.Contains(lines, "prod.etl_api_requests_total:1|c|#pipeline:orders") {
+		t.Error("expected the increment of the counter")
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "prod.etl_sink_batches_total:") {
+			t.Errorf("expected unchanged counters to be left out, got %q", line)
+		}
+	}
+}
+
+func TestNewPusherValidation(t *testing.T) {
+	m := NewMetrics()
+	if _, err := m.NewPusher(PushConfig{}); err == nil {
+		t.Error("expected an error without targets")
+	}
+	if _, err := m.NewPusher(PushConfig{PushgatewayURL: "http://localhost:9091"}); err == nil {
+		t.Error("expected an error without a job")
+	}
+	if _, err := m.NewPusher(PushConfig{StatsDAddr: "localhost"}); err == nil {
+		t.Error("expected an error for an address without a port")
+	}
+}
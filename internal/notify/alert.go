@@ -0,0 +1,225 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/slo"
+)
+
+// Alert kinds, which are also the keys alerts are deduplicated by
+const (
+	AlertCycleFailed = "cycle_failed"
+	AlertErrorRate   = "error_rate"
+	AlertSLA         = "sla"
+	AlertFreshness   = "freshness"
+)
+
+// Alert is a message about a pipeline needing attention, or no longer needing it
+type Alert struct {
+	Kind     string
+	Pipeline string
+	// Resolved marks the notice that the condition of an earlier alert cleared
+	Resolved bool
+	Summary  string
+	Details  []string
+}
+
+// Subject is a one-line description of the alert, e.g. for email subjects
+func (a Alert) Subject() string {
+	pipeline := "ETL pipeline"
+	if a.Pipeline != "" {
+		pipeline = "ETL pipeline " + a.Pipeline
+	}
+	if a.Resolved {
+		return fmt.Sprintf("[RESOLVED] %s: %s", pipeline, a.Summary)
+	}
+	return fmt.Sprintf("[ALERT] %s: %s", pipeline, a.Summary)
+}
+
+// Text renders the subject and details of the alert
+func (a Alert) Text() string {
+	return strings.Join(append([]string{a.Subject()}, a.Details...), "\n")
+}
+
+// AlertSender delivers alerts over one channel, such as Slack or email
+type AlertSender interface {
+	// Name identifies the channel in logs and metric labels
+	Name() string
+	Send(ctx context.Context, alert Alert) error
+}
+
+// AlertRules decide when the alerter fires
+type AlertRules struct {
+	// ErrorRate alerts when the share of failed or partial cycles among the last
+	// ErrorRateWindow cycles exceeds it; zero disables the rule
+	ErrorRate       float64
+	ErrorRateWindow int
+	// SLA alerts when no cycle succeeded for longer; zero disables the rule
+	SLA time.Duration
+	// RepeatInterval is how long an alert still firing stays silent before it is sent again
+	RepeatInterval time.Duration
+}
+
+// Alerter watches the cycles of a pipeline and sends alerts through its senders
+// when a cycle fails, cycles fail too often or no cycle succeeds within the SLA.
+// An alert is sent once and repeated every RepeatInterval while it keeps firing,
+// and a resolved notice follows when its condition clears.
+type Alerter struct {
+	pipeline string
+	rules    AlertRules
+	senders  []AlertSender
+	logger   *logging.Logger
+	metrics  *metrics.Metrics
+
+	mu sync.Mutex
+	// outcomes holds whether each of the last ErrorRateWindow cycles had errors
+	outcomes    []bool
+	lastSuccess time.Time
+	// firing holds when each firing alert was last sent
+	firing map[string]time.Time
+}
+
+// NewAlerter creates an alerter for pipeline, which may be empty for the only
+// pipeline of the process
+func NewAlerter(pipeline string, rules AlertRules, senders []AlertSender, logger *logging.Logger, metrics *metrics.Metrics) *Alerter {
+	if rules.ErrorRateWindow < 1 {
+		rules.ErrorRateWindow = 10
+	}
+	return &Alerter{
+		pipeline:    pipeline,
+		rules:       rules,
+		senders:     senders,
+		logger:      logger,
+		metrics:     metrics,
+		lastSuccess: time.Now(),
+		firing:      make(map[string]time.Time),
+	}
+}
+
+// NotifyCycle checks the failure and error rate rules against a finished cycle
+func (a *Alerter) NotifyCycle(ctx context.Context, run database.PipelineRun) {
+	details := []string{
+		fmt.Sprintf("Run: %s (%s)", run.RunID, run.Trigger),
+		fmt.Sprintf("Records: %d extracted, %d transformed, %d rejected, %d loaded", run.RecordsExtracted, run.RecordsTransformed, run.RecordsRejected, run.RecordsLoaded),
+	}
+	if run.Error != "" {
+		details = append(details, "Error: "+run.Error)
+	}
+
+	a.mu.Lock()
+	now := time.Now()
+	if run.Status == database.RunSucceeded {
+		a.lastSuccess = now
+	}
+	a.outcomes = append(a.outcomes, run.Status != database.RunSucceeded)
+	if len(a.outcomes) > a.rules.ErrorRateWindow {
+		a.outcomes = a.outcomes[1:]
+	}
+	failed := 0
+	for _, hadErrors := range a.outcomes {
+		if hadErrors {
+			failed++
+		}
+	}
+	rate := float64(failed) / float64(len(a.outcomes))
+
+	var alerts []Alert
+	alerts = append(alerts, a.evaluate(now, AlertCycleFailed, run.Status == database.RunFailed, "cycle failed", "cycles complete again", details)...)
+	if a.rules.ErrorRate > 0 {
+		rateDetails := append([]string{fmt.Sprintf("%d of the last %d cycles failed or were partial (threshold %.0f%%)", failed, len(a.outcomes), a.rules.ErrorRate*100)}, details...)
+		alerts = append(alerts, a.evaluate(now, AlertErrorRate, rate > a.rules.ErrorRate, fmt.Sprintf("%.0f%% of recent cycles had errors", rate*100), "cycle error rate back below threshold", rateDetails)...)
+	}
+	if a.rules.SLA > 0 && run.Status == database.RunSucceeded {
+		alerts = append(alerts, a.evaluate(now, AlertSLA, false, "", "a cycle succeeded again", details)...)
+	}
+	a.mu.Unlock()
+
+	a.send(ctx, alerts)
+}
+
+// Watch checks the SLA rule until ctx is cancelled, so an alert fires even when
+// cycles stop finishing altogether
+func (a *Alerter) Watch(ctx context.Context) {
+	if a.rules.SLA <= 0 {
+		return
+	}
+	ticker := time.NewTicker(max(min(a.rules.SLA/4, time.Minute), time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.send(ctx, a.checkSLA(time.Now()))
+		}
+	}
+}
+
+// NotifyFreshness alerts when the processed data breaches its freshness objective
+func (a *Alerter) NotifyFreshness(ctx context.Context, status slo.Status) {
+	details := []string{fmt.Sprintf("Freshness objective: %v", status.Objective)}
+	if status.LastLoadedAt != nil {
+		details = append(details, fmt.Sprintf("Last loaded: %s", status.LastLoadedAt.UTC().Format(time.RFC3339)))
+	} else {
+		details = append(details, "Last loaded: not since the pipeline started")
+	}
+
+	a.mu.Lock()
+	alerts := a.evaluate(time.Now(), AlertFreshness, status.Breached(), fmt.Sprintf("processed data is %v old", status.Age.Round(time.Second)), "processed data is fresh again", details)
+	a.mu.Unlock()
+
+	a.send(ctx, alerts)
+}
+
+// checkSLA evaluates the SLA rule at now
+func (a *Alerter) checkSLA(now time.Time) []Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	since := now.Sub(a.lastSuccess)
+	if since <= a.rules.SLA {
+		return nil
+	}
+	details := []string{fmt.Sprintf("Last successful cycle: %s (SLA %v)", a.lastSuccess.UTC().Format(time.RFC3339), a.rules.SLA)}
+	return a.evaluate(now, AlertSLA, true, fmt.Sprintf("no successful cycle for %v", since.Round(time.Second)), "", details)
+}
+
+// evaluate returns the alert of kind to send given whether its condition holds:
+// the alert when it starts firing or is due for a repeat, the resolved notice when
+// it stops, nothing otherwise. Callers hold a.mu.
+func (a *Alerter) evaluate(now time.Time, kind string, firing bool, summary, resolved string, details []string) []Alert {
+	sentAt, wasFiring := a.firing[kind]
+	switch {
+	case firing && wasFiring && now.Sub(sentAt) < a.rules.RepeatInterval:
+		a.metrics.AlertsSuppressedTotal.WithLabelValues(kind).Inc()
+		return nil
+	case firing:
+		a.firing[kind] = now
+		return []Alert{{Kind: kind, Pipeline: a.pipeline, Summary: summary, Details: details}}
+	case wasFiring:
+		delete(a.firing, kind)
+		return []Alert{{Kind: kind, Pipeline: a.pipeline, Resolved: true, Summary: resolved, Details: details}}
+	}
+	return nil
+}
+
+// send delivers alerts through every sender; failures are logged and counted
+func (a *Alerter) send(ctx context.Context, alerts []Alert) {
+	for _, alert := range alerts {
+		a.logger.Warn(fmt.Sprintf("Sending alert: %s", alert.Subject()))
+		for _, sender := range a.senders {
+			if err := sender.Send(ctx, alert); err != nil {
+				a.metrics.AlertsSentTotal.WithLabelValues(sender.Name(), "failed").Inc()
+				a.logger.Error(fmt.Sprintf("Failed to send alert through %s: %v", sender.Name(), err))
+				continue
+			}
+			a.metrics.AlertsSentTotal.WithLabelValues(sender.Name(), "sent").Inc()
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/slo"
+)
+
+type fakeSender struct {
+	alerts []Alert
+}
+
+func (s *fakeSender) Name() string { return "fake" }
+
+func (s *fakeSender) Send(ctx context.Context, alert Alert) error {
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
+
+func TestAlerterCycleFailures(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	sender := &fakeSender{}
+	alerter := NewAlerter("orders", AlertRules{
+		ErrorRate:       0.5,
+		ErrorRateWindow: 4,
+		RepeatInterval:  time.Hour,
+	}, []AlertSender{sender}, logger, metrics.NewMetrics())
+
+	ctx := context.Background()
+	alerter.NotifyCycle(ctx, database.PipelineRun{RunID: "run-1", Status: database.RunSucceeded})
+	alerter.NotifyCycle(ctx, database.PipelineRun{RunID: "run-2", Status: database.RunFailed, Error: "source unavailable"})
+	if len(sender.alerts) != 1 || sender.alerts[0].Kind != AlertCycleFailed || sender.alerts[0].Resolved {
+		t.Fatalf("Expected one cycle failure alert, got %+v", sender.alerts)
+	}
+
+	// A second failure within the repeat interval is suppressed, but pushes the
+	// error rate over the threshold
+	alerter.NotifyCycle(ctx, database.PipelineRun{RunID: "run-3", Status: database.RunFailed})
+	if len(sender.alerts) != 2 || sender.alerts[1].Kind != AlertErrorRate {
+		t.Fatalf("Expected only an error rate alert, got %+v", sender.alerts[1:])
+	}
+
+	alerter.NotifyCycle(ctx, database.PipelineRun{RunID: "run-4", Status: database.RunSucceeded})
+	alerter.NotifyCycle(ctx, database.PipelineRun{RunID: "run-5", Status: database.RunSucceeded})
+	resolved := map[string]bool{}
+	for _, alert := range sender.alerts[2:] {
+		if !alert.Resolved {
+			t.Errorf("Expected only resolved notices, got %+v", alert)
+		}
+		resolved[alert.Kind] = true
+	}
+	if len(sender.alerts) != 4 || !resolved[AlertCycleFailed] || !resolved[AlertErrorRate] {
+		t.Errorf("Expected both alerts to resolve, got %+v", sender.alerts[2:])
+	}
+}
+
+func TestAlerterSLA(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	sender := &fakeSender{}
+	alerter := NewAlerter("", AlertRules{SLA: time.Hour, RepeatInterval: time.Hour}, []AlertSender{sender}, logger, metrics.NewMetrics())
+
+	now := time.Now()
+	if alerts := alerter.checkSLA(now.Add(30 * time.Minute)); len(alerts) != 0 {
+		t.Errorf("Expected no alert within the SLA, got %+v", alerts)
+	}
+	if alerts := alerter.checkSLA(now.Add(2 * time.Hour)); len(alerts) != 1 || alerts[0].Kind != AlertSLA {
+		t.Errorf("Expected an SLA alert, got %+v", alerts)
+	}
+	if alerts := alerter.checkSLA(now.Add(150 * time.Minute)); len(alerts) != 0 {
+		t.Errorf("Expected the repeated SLA alert to be suppressed, got %+v", alerts)
+	}
+
+	alerter.NotifyCycle(context.Background(), database.PipelineRun{RunID: "run-1", Status: database.RunSucceeded})
+	if len(sender.alerts) != 1 || sender.alerts[0].Kind != AlertSLA || !sender.alerts[0].Resolved {
+		t.Errorf("Expected the SLA alert to resolve, got %+v", sender.alerts)
+	}
+}
+
+func TestAlerterFreshness(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	sender := &fakeSender{}
+	alerter := NewAlerter("orders", AlertRules{RepeatInterval: time.Hour}, []AlertSender{sender}, logger, metrics.NewMetrics())
+
+	ctx := context.Background()
+	breached := slo.Status{Pipeline: "orders", Objective: 15 * time.Minute, Age: 20 * time.Minute, State: slo.StateBreached}
+	alerter.NotifyFreshness(ctx, breached)
+	alerter.NotifyFreshness(ctx, breached)
+	alerter.NotifyFreshness(ctx, slo.Status{Pipeline: "orders", Objective: 15 * time.Minute, State: slo.StateMet})
+	if len(sender.alerts) != 2 || sender.alerts[0].Kind != AlertFreshness || sender.alerts[0].Resolved || !sender.alerts[1].Resolved {
+		t.Errorf("Expected a freshness alert and its resolved notice, got %+v", sender.alerts)
+	}
+}
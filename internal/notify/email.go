@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig holds the settings of the email sender
+type SMTPConfig struct {
+	Host string
+	Port int
+	// Username and Password authenticate with PLAIN auth when Username is set
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// EmailSender sends alerts by email through an SMTP server
+type EmailSender struct {
+	cfg SMTPConfig
+}
+
+// NewEmailSender creates a sender mailing alerts to cfg.To
+func NewEmailSender(cfg SMTPConfig) (*EmailSender, error) {
+	if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("smtp host, sender and recipients are required")
+	}
+	return &EmailSender{cfg: cfg}, nil
+}
+
+// Name returns "email"
+func (s *EmailSender) Name() string {
+	return "email"
+}
+
+// Send mails the alert, its subject as the email subject. The SMTP exchange does
+// not take a context, only a cancelled ctx stops it from starting.
+func (s *EmailSender) Send(ctx context.Context, alert Alert) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	if err := smtp.SendMail(addr, auth, s.cfg.From, s.cfg.To, s.message(alert)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// message renders the alert as a plain text email
+func (s *EmailSender) message(alert Alert) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", alert.Subject())
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	for _, line := range alert.Details {
+		b.WriteString(line + "\r\n")
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// SlackSender posts alerts to a Slack incoming webhook
+type SlackSender struct {
+	webhookURL string
+	httpClient *http.Client
+}
+
+// NewSlackSender creates a sender posting to the incoming webhook webhookURL
+func NewSlackSender(webhookURL string) *SlackSender {
+	return &SlackSender{
+		webhookURL: webhookURL,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name returns "slack"
+func (s *SlackSender) Name() string {
+	return "slack"
+}
+
+// Send posts the alert as a message
+func (s *SlackSender) Send(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(map[string]string{"text": alert.Text()})
+	if err != nil {
+		return fmt.Errorf("failed to encode slack message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post slack message: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack returned status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/backoff"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// Webhook events
+const (
+	EventCycleCompleted = "cycle.completed"
+	EventCycleFailed    = "cycle.failed"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the timestamp, a dot and the
+// request body, keyed with the webhook secret, as "sha256=<digest>"
+const SignatureHeader = "X-ETL-Signature"
+
+// TimestampHeader carries the Unix time in seconds a delivery attempt was signed
+// at, so receivers can reject replays of old deliveries
+const TimestampHeader = "X-ETL-Timestamp"
+
+// CycleSummary is the JSON body posted to webhooks after a cycle
+type CycleSummary struct {
+	Event    string `json:"event"`
+	Pipeline string `json:"pipeline,omitempty"`
+	RunID    string `json:"run_id"`
+	Trigger  string `json:"trigger"`
+	Status   string `json:"status"`
+	// Error is the error that failed the cycle, if any
+	Error              string    `json:"error,omitempty"`
+	StartedAt          time.Time `json:"started_at"`
+	FinishedAt         time.Time `json:"finished_at"`
+	DurationSeconds    float64   `json:"duration_seconds"`
+	RecordsExtracted   int       `json:"records_extracted"`
+	RecordsTransformed int       `json:"records_transformed"`
+	RecordsRejected    int       `json:"records_rejected"`
+	RecordsLoaded      int       `json:"records_loaded"`
+	ErrorCount         int       `json:"error_count"`
+}
+
+// NewCycleSummary summarizes the finished run of a cycle of pipeline
+func NewCycleSummary(pipeline string, run database.PipelineRun) CycleSummary {
+	summary := CycleSummary{
+		Event:              EventCycleCompleted,
+		Pipeline:           pipeline,
+		RunID:              run.RunID,
+		Trigger:            run.Trigger,
+		Status:             run.Status,
+		Error:              run.Error,
+		StartedAt:          run.StartedAt,
+		RecordsExtracted:   run.RecordsExtracted,
+		RecordsTransformed: run.RecordsTransformed,
+		RecordsRejected:    run.RecordsRejected,
+		RecordsLoaded:      run.RecordsLoaded,
+		ErrorCount:         run.ErrorCount,
+	}
+	if run.Status == database.RunFailed {
+		summary.Event = EventCycleFailed
+	}
+	if run.FinishedAt != nil {
+		summary.FinishedAt = *run.FinishedAt
+		summary.DurationSeconds = run.FinishedAt.Sub(run.StartedAt).Seconds()
+	}
+	return summary
+}
+
+// WebhookConfig holds the settings of cycle webhooks
+type WebhookConfig struct {
+	URLs []string
+	// Secret signs the timestamp and body of each request in SignatureHeader; empty
+	// sends unsigned requests
+	Secret string
+	// Retry is how often and when a failed delivery to a URL is tried again
+	Retry backoff.Policy
+	// Timeout bounds each delivery attempt
+	Timeout time.Duration
+}
+
+// Webhooks posts a summary of every cycle to one or more URLs
+type Webhooks struct {
+	pipeline   string
+	cfg        WebhookConfig
+	httpClient *http.Client
+	logger     *logging.Logger
+	metrics    *metrics.Metrics
+}
+
+// NewWebhooks creates webhooks reporting the cycles of pipeline, which may be
+// empty for the only pipeline of the process
+func NewWebhooks(pipeline string, cfg WebhookConfig, logger *logging.Logger, metrics *metrics.Metrics) (*Webhooks, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("no webhook URLs configured")
+	}
+	for _, u := range cfg.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid webhook URL %q", u)
+		}
+	}
+	return &Webhooks{
+		pipeline:   pipeline,
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		logger:     logger,
+		metrics:    metrics,
+	}, nil
+}
+
+// NotifyCycle posts the summary of a finished cycle to every URL concurrently,
+// retrying failed deliveries, so a slow or failing URL does not hold up the
+// others. It returns once every delivery is done. Failures are logged and
+// counted, they never fail the cycle.
+func (w *Webhooks) NotifyCycle(ctx context.Context, run database.PipelineRun) {
+	body, err := json.Marshal(NewCycleSummary(w.pipeline, run))
+	if err != nil {
+		w.logger.Error(fmt.Sprintf("Failed to encode webhook payload: %v", err))
+		return
+	}
+	var wg sync.WaitGroup
+	for _, target := range w.cfg.URLs {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			if err := w.deliver(ctx, target, body); err != nil {
+				w.metrics.WebhookDeliveriesTotal.WithLabelValues("failed").Inc()
+				w.logger.Error(fmt.Sprintf("Webhook delivery of run %s to %s failed after %d attempts: %v", run.RunID, target, w.cfg.Retry.MaxAttempts(), err))
+				return
+			}
+			w.metrics.WebhookDeliveriesTotal.WithLabelValues("delivered").Inc()
+		}(target)
+	}
+	wg.Wait()
+}
+
+// deliver posts body to target until it is accepted or the attempts are used up
+func (w *Webhooks) deliver(ctx context.Context, target string, body []byte) error {
+	attempts := w.cfg.Retry.MaxAttempts()
+	for attempt := 1; ; attempt++ {
+		err := w.post(ctx, target, body)
+		if err == nil || attempt == attempts {
+			return err
+		}
+		w.logger.Warn(fmt.Sprintf("Webhook delivery to %s attempt %d/%d failed, retrying in %v: %v", target, attempt, attempts, w.cfg.Retry.Delay(attempt), err))
+		if waitErr := w.cfg.Retry.Wait(ctx, attempt); waitErr != nil {
+			return fmt.Errorf("%w (retry aborted: %v)", err, waitErr)
+		}
+	}
+}
+
+// post sends one delivery, signed with the time of the attempt; any status other
+// than 2xx is an error
+func (w *Webhooks) post(ctx context.Context, target string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.cfg.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.cfg.Secret, timestamp, body))
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of timestamp, a dot and body keyed with
+// secret, which receivers compare to SignatureHeader
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/backoff"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestWebhooksNotifyCycle(t *testing.T) {
+	attempts := 0
+	var summary CycleSummary
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(TimestampHeader)
+		if sent, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+			t.Errorf("Expected the time of the attempt in %s, got %q", TimestampHeader, timestamp)
+		}
+		if got, want := r.Header.Get(SignatureHeader), "sha256="+Sign("secret", timestamp, body); got != want {
+			t.Errorf("Expected signature %s, got %s", want, got)
+		}
+		if err := json.Unmarshal(body, &summary); err != nil {
+			t.Errorf("Failed to decode webhook payload: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	logger, _ := logging.NewLogger("test.log")
+	webhooks, err := NewWebhooks("orders", WebhookConfig{
+		URLs:    []string{server.URL},
+		Secret:  "secret",
+		Retry:   backoff.Policy{Attempts: 2, Backoff: time.Millisecond},
+		Timeout: time.Second,
+	}, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewWebhooks failed: %v", err)
+	}
+
+	started := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	finished := started.Add(90 * time.Second)
+	webhooks.NotifyCycle(context.Background(), database.PipelineRun{
+		RunID:            "run-1",
+		Trigger:          "schedule",
+		Status:           database.RunFailed,
+		Error:            "source unavailable",
+		StartedAt:        started,
+		FinishedAt:       &finished,
+		RecordsExtracted: 3,
+	})
+
+	if attempts != 2 {
+		t.Errorf("Expected the failed delivery to be retried once, got %d attempts", attempts)
+	}
+	if summary.Event != EventCycleFailed || summary.Pipeline != "orders" || summary.RunID != "run-1" || summary.DurationSeconds != 90 || summary.RecordsExtracted != 3 {
+		t.Errorf("Unexpected webhook payload: %+v", summary)
+	}
+}
+
+func TestWebhooksNotifyCycleDeliversConcurrently(t *testing.T) {
+	// The first URL only answers once the second was delivered to
+	delivered := make(chan struct{})
+	concurrent := false
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-delivered:
+			concurrent = true
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(delivered)
+	}))
+	defer fast.Close()
+
+	logger, _ := logging.NewLogger("test.log")
+	webhooks, err := NewWebhooks("", WebhookConfig{
+		URLs:    []string{slow.URL, fast.URL},
+		Retry:   backoff.Policy{Attempts: 1},
+		Timeout: 5 * time.Second,
+	}, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewWebhooks failed: %v", err)
+	}
+
+	webhooks.NotifyCycle(context.Background(), database.PipelineRun{RunID: "run-1", Status: database.RunSucceeded})
+	if !concurrent {
+		t.Error("Expected the second URL delivered to while the first was still answering")
+	}
+}
+
+func TestNewWebhooksRejectsInvalidURLs(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	for _, urls := range [][]string{nil, {"ftp://example.com"}, {"example.com/hook"}} {
+		if _, err := NewWebhooks("", WebhookConfig{URLs: urls}, logger, metrics.NewMetrics()); err == nil {
+			t.Errorf("Expected webhook URLs %v to be rejected", urls)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package objectstore
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAzurePutObjectBlocks(t *testing.T) {
+	var blocks []string
+	var blockList string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey account:") {
+			t.Errorf("Expected a Shared Key authorization, got %q", r.Header.Get("Authorization"))
+		}
+		if r.URL.Path != "/container/raw/batch.json" {
+			t.Errorf("Unexpected blob path %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Query().Get("comp") {
+		case "block":
+			blocks = append(blocks, r.URL.Query().Get("blockid"))
+		case "blocklist":
+			blockList = string(body)
+			if r.Header.Get("X-Ms-Meta-Codec") != "none" {
+				t.Errorf("Expected metadata on the committed blob, got %v", r.Header)
+			}
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client, err := NewAzureClient(AzureConfig{
+		Account:   "account",
+		Container: "container",
+		Key:       base64.StdEncoding.EncodeToString([]byte("key")),
+		Endpoint:  server.URL,
+		BlockSize: 4,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	if err := client.PutObject(context.Background(), "raw/batch.json", []byte("0123456789"), "application/json", map[string]string{"codec": "none"}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("Expected 3 blocks, got %d", len(blocks))
+	}
+	for _, id := range blocks {
+		if !strings.Contains(blockList, "<Latest>"+id+"</Latest>") {
+			t.Errorf("Expected block %s in the committed list %s", id, blockList)
+		}
+	}
+}
+
+func TestAzurePing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/container" || r.URL.Query().Get("restype") != "container" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := NewAzureClient(AzureConfig{
+		Account:   "account",
+		Container: "container",
+		Key:       base64.StdEncoding.EncodeToString([]byte("key")),
+		Endpoint:  server.URL,
+		BlockSize: 4,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("Ping failed: %v", err)
+	}
+}
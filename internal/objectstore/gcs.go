@@ -0,0 +1,41 @@
+package objectstore
+
+import (
+	"fmt"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+)
+
+// GCSEndpoint is the XML API of Google Cloud Storage, which accepts S3 requests
+// signed with HMAC keys, including multipart uploads
+const GCSEndpoint = "https://storage.googleapis.com"
+
+// GCSConfig holds the settings for a Google Cloud Storage bucket
+type GCSConfig struct {
+	Bucket string
+	// AccessID and Secret are an HMAC key of a service account
+	AccessID string
+	Secret   string
+	PartSize int
+}
+
+// NewGCSClient creates a client for a GCS bucket through its S3-compatible XML API
+func NewGCSClient(cfg GCSConfig) (*S3Client, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("gcs bucket is required")
+	}
+	if cfg.AccessID == "" || cfg.Secret == "" {
+		return nil, fmt.Errorf("gcs HMAC key is required")
+	}
+	return NewS3Client(S3Config{
+		Bucket:    cfg.Bucket,
+		Region:    "auto",
+		Endpoint:  GCSEndpoint,
+		PathStyle: true,
+		Credentials: awsauth.Credentials{
+			AccessKeyID:     cfg.AccessID,
+			SecretAccessKey: cfg.Secret,
+		},
+		PartSize: cfg.PartSize,
+	})
+}
@@ -0,0 +1,140 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+)
+
+// DefaultPartSize is the part size of multipart uploads when none is configured
+const DefaultPartSize = 16 << 20
+
+// MinPartSize is the smallest part S3 accepts, except for the last one
+const MinPartSize = 5 << 20
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// putMultipart uploads body in parts, aborting the upload when a part or the
+// completion fails so no orphaned parts are left behind
+func (c *S3Client) putMultipart(ctx context.Context, key string, body []byte, contentType string, metadata map[string]string) error {
+	uploadID, err := c.createMultipartUpload(ctx, key, contentType, metadata)
+	if err != nil {
+		return err
+	}
+
+	var parts []completedPart
+	for number, offset := 1, 0; offset < len(body); number++ {
+		end := min(offset+c.cfg.PartSize, len(body))
+		etag, err := c.uploadPart(ctx, key, uploadID, number, body[offset:end])
+		if err != nil {
+			c.abortMultipartUpload(key, uploadID)
+			return err
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+		offset = end
+	}
+
+	if err := c.completeMultipartUpload(ctx, key, uploadID, parts); err != nil {
+		c.abortMultipartUpload(key, uploadID)
+		return err
+	}
+	return nil
+}
+
+func (c *S3Client) createMultipartUpload(ctx context.Context, key, contentType string, metadata map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.objectURL(key)+"?uploads", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create s3 request: %w", err)
+	}
+	setObjectHeaders(req, contentType, metadata)
+
+	resp, err := c.do(req, awsauth.EmptyPayloadHash)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode s3 multipart upload: %w", err)
+	}
+	return result.UploadID, nil
+}
+
+func (c *S3Client) uploadPart(ctx context.Context, key, uploadID string, number int, part []byte) (string, error) {
+	query := url.Values{}
+	query.Set("partNumber", strconv.Itoa(number))
+	query.Set("uploadId", uploadID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(key)+"?"+query.Encode(), bytes.NewReader(part))
+	if err != nil {
+		return "", fmt.Errorf("failed to create s3 request: %w", err)
+	}
+
+	resp, err := c.do(req, awsauth.PayloadHash(part))
+	if err != nil {
+		return "", fmt.Errorf("failed to upload part %d: %w", number, err)
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+func (c *S3Client) completeMultipartUpload(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return fmt.Errorf("failed to marshal s3 parts: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.objectURL(key)+"?uploadId="+url.QueryEscape(uploadID), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create s3 request: %w", err)
+	}
+
+	resp, err := c.do(req, awsauth.PayloadHash(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// S3 may report a failed completion in the body of a 200 response
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read s3 multipart completion: %w", err)
+	}
+	if err := xml.Unmarshal(data, &result); err == nil && result.XMLName.Local == "Error" {
+		return fmt.Errorf("s3 multipart completion failed: %s: %s", result.Code, result.Message)
+	}
+	return nil
+}
+
+// abortMultipartUpload discards the uploaded parts; it runs detached from the
+// request context, which may be what cancelled the upload
+func (c *S3Client) abortMultipartUpload(key, uploadID string) {
+	req, err := http.NewRequest(http.MethodDelete, c.objectURL(key)+"?uploadId="+url.QueryEscape(uploadID), nil)
+	if err != nil {
+		return
+	}
+	if resp, err := c.do(req, awsauth.EmptyPayloadHash); err == nil {
+		resp.Body.Close()
+	}
+}
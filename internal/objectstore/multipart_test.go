@@ -0,0 +1,100 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+)
+
+func TestPutObjectMultipart(t *testing.T) {
+	var mu sync.Mutex
+	parts := make(map[string][]byte)
+	var completion string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			if r.Header.Get("X-Amz-Meta-Codec") != "gzip" {
+				t.Errorf("Expected metadata on the upload, got %v", r.Header)
+			}
+			io.WriteString(w, `<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut && query.Get("uploadId") == "upload-1":
+			parts[query.Get("partNumber")] = body
+			w.Header().Set("ETag", `"etag-`+query.Get("partNumber")+`"`)
+		case r.Method == http.MethodPost && query.Get("uploadId") == "upload-1":
+			completion = string(body)
+			io.WriteString(w, `<CompleteMultipartUploadResult><Key>batch</Key></CompleteMultipartUploadResult>`)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewS3Client(S3Config{
+		Bucket:      "bucket",
+		Endpoint:    server.URL,
+		PathStyle:   true,
+		Credentials: awsauth.Credentials{AccessKeyID: "id", SecretAccessKey: "secret"},
+		PartSize:    MinPartSize,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	body := bytes.Repeat([]byte("x"), MinPartSize+10)
+	if err := client.PutObject(context.Background(), "raw/batch.json.gz", body, "application/json", map[string]string{"codec": "gzip"}); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	if len(parts) != 2 || len(parts["1"]) != MinPartSize || len(parts["2"]) != 10 {
+		t.Errorf("Expected parts of %d and 10 bytes, got %d parts", MinPartSize, len(parts))
+	}
+	for _, want := range []string{`<PartNumber>1</PartNumber><ETag>&#34;etag-1&#34;</ETag>`, `<PartNumber>2</PartNumber>`} {
+		if !strings.Contains(completion, want) {
+			t.Errorf("Expected completion to contain %s, got %s", want, completion)
+		}
+	}
+}
+
+func TestPutObjectMultipartAbort(t *testing.T) {
+	aborted := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			io.WriteString(w, `<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut:
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Method == http.MethodDelete && query.Get("uploadId") == "upload-1":
+			aborted = true
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewS3Client(S3Config{
+		Bucket:      "bucket",
+		Endpoint:    server.URL,
+		PathStyle:   true,
+		Credentials: awsauth.Credentials{AccessKeyID: "id", SecretAccessKey: "secret"},
+		PartSize:    MinPartSize,
+	})
+	if err := client.PutObject(context.Background(), "batch", make([]byte, MinPartSize+1), "", nil); err == nil {
+		t.Fatal("Expected a failed part to fail the upload")
+	}
+	if !aborted {
+		t.Error("Expected the multipart upload to be aborted")
+	}
+}
@@ -0,0 +1,222 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+)
+
+// S3Config holds the settings for an S3 (or S3-compatible) bucket
+type S3Config struct {
+	Bucket string
+	Region string
+	// Endpoint overrides the AWS endpoint, e.g. for MinIO
+	Endpoint string
+	// PathStyle addresses the bucket as a path segment instead of a subdomain
+	PathStyle   bool
+	Credentials awsauth.Credentials
+	// PartSize is the size of the parts of multipart uploads, used for bodies
+	// larger than one part; zero means DefaultPartSize
+	PartSize int
+}
+
+// S3Client is a minimal S3 client for writing objects
+type S3Client struct {
+	cfg        S3Config
+	httpClient *http.Client
+}
+
+// NewS3Client creates an S3 client
+func NewS3Client(cfg S3Config) (*S3Client, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Credentials.AccessKeyID == "" || cfg.Credentials.SecretAccessKey == "" {
+		return nil, fmt.Errorf("s3 credentials are required")
+	}
+	if cfg.PartSize == 0 {
+		cfg.PartSize = DefaultPartSize
+	}
+	if cfg.PartSize < MinPartSize {
+		return nil, fmt.Errorf("s3 part size must be at least %d bytes", MinPartSize)
+	}
+
+	return &S3Client{
+		cfg: cfg,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Minute,
+		},
+	}, nil
+}
+
+// Bucket returns the bucket name
+func (c *S3Client) Bucket() string {
+	return c.cfg.Bucket
+}
+
+// PutObject uploads body under key, storing metadata as x-amz-meta-* headers.
+// Bodies larger than the part size are uploaded in parts.
+func (c *S3Client) PutObject(ctx context.Context, key string, body []byte, contentType string, metadata map[string]string) error {
+	if len(body) > c.cfg.PartSize {
+		return c.putMultipart(ctx, key, body, contentType, metadata)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create s3 request: %w", err)
+	}
+	setObjectHeaders(req, contentType, metadata)
+
+	resp, err := c.do(req, awsauth.PayloadHash(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// setObjectHeaders sets the content type and metadata of an object being created
+func setObjectHeaders(req *http.Request, contentType string, metadata map[string]string) {
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for name, value := range metadata {
+		req.Header.Set("X-Amz-Meta-"+name, value)
+	}
+}
+
+// do signs and sends a request, returning an error for non-2xx responses
+func (c *S3Client) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	awsauth.Sign(req, c.cfg.Credentials, c.cfg.Region, "s3", payloadHash, time.Now())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 request failed: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s returned status %d: %s", req.Method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// bucketURL builds the virtual-hosted or path-style URL of the bucket
+func (c *S3Client) bucketURL() string {
+	endpoint := c.cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", c.cfg.Region)
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+
+	if c.cfg.PathStyle {
+		return endpoint + "/" + c.cfg.Bucket
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint + "/" + c.cfg.Bucket
+	}
+	u.Host = c.cfg.Bucket + "." + u.Host
+	return u.String()
+}
+
+// objectURL builds the URL of an object
+func (c *S3Client) objectURL(key string) string {
+	return c.bucketURL() + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+// Object is an entry returned by ListObjects
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ListObjects returns all objects under prefix
+func (c *S3Client) ListObjects(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	continuation := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if continuation != "" {
+			query.Set("continuation-token", continuation)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.bucketURL()+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create s3 request: %w", err)
+		}
+
+		resp, err := c.do(req, awsauth.EmptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode s3 listing: %w", err)
+		}
+
+		for _, content := range result.Contents {
+			objects = append(objects, Object{Key: content.Key, Size: content.Size, LastModified: content.LastModified})
+		}
+		if !result.IsTruncated {
+			return objects, nil
+		}
+		continuation = result.NextContinuationToken
+	}
+}
+
+// Ping checks that the bucket exists and the credentials may access it
+func (c *S3Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.bucketURL(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create s3 request: %w", err)
+	}
+	resp, err := c.do(req, awsauth.EmptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// DeleteObject removes the object stored under key
+func (c *S3Client) DeleteObject(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.objectURL(key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create s3 request: %w", err)
+	}
+
+	resp, err := c.do(req, awsauth.EmptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,199 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// Report describes the outcome of applying the policy to every registered store
+type Report struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	DryRun      bool            `json:"dry_run"`
+	Datasets    []DatasetReport `json:"datasets"`
+}
+
+// DatasetReport is the outcome of one rule
+type DatasetReport struct {
+	Rule   Rule      `json:"rule"`
+	Cutoff time.Time `json:"cutoff"`
+	Held   bool      `json:"held"`
+	// ExceptTenants are the tenants a dataset-wide rule leaves alone, those held or
+	// with rules of their own
+	ExceptTenants []string       `json:"except_tenants,omitempty"`
+	Targets       []TargetReport `json:"targets"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// TargetReport is the outcome of one rule on one store
+type TargetReport struct {
+	Target string `json:"target"`
+	Outcome
+	Skipped string `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Engine enforces a retention policy consistently across all stores of each dataset
+type Engine struct {
+	policy  *Policy
+	targets map[string][]Target
+	logger  *logging.Logger
+	metrics *metrics.Metrics
+	mu      sync.Mutex
+}
+
+// NewEngine creates a retention engine for the policy
+func NewEngine(policy *Policy, logger *logging.Logger, metrics *metrics.Metrics) *Engine {
+	return &Engine{
+		policy:  policy,
+		targets: make(map[string][]Target),
+		logger:  logger,
+		metrics: metrics,
+	}
+}
+
+// Start enforces the policy every interval until ctx is cancelled
+func (e *Engine) Start(ctx context.Context, interval time.Duration) {
+	e.logger.Info(fmt.Sprintf("Retention job started with interval: %v", interval))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.logger.Info("Retention job stopped")
+			return
+		case <-ticker.C:
+			e.Run(ctx, false)
+		}
+	}
+}
+
+// Register adds a store holding data of the named dataset
+func (e *Engine) Register(dataset string, target Target) {
+	e.targets[dataset] = append(e.targets[dataset], target)
+}
+
+// datasetScope is how the rules of a dataset bear on each other
+type datasetScope struct {
+	// held is set when a dataset-wide rule is under legal hold
+	held bool
+	// heldTenants are the tenants under legal hold
+	heldTenants map[string]bool
+	// exceptTenants are the tenants dataset-wide rules leave alone, those held and
+	// those with rules of their own, sorted
+	exceptTenants []string
+}
+
+// scopes gathers the holds and tenant rules of every dataset
+func (e *Engine) scopes() map[string]*datasetScope {
+	scopes := make(map[string]*datasetScope)
+	for _, rule := range e.policy.Rules {
+		scope, ok := scopes[rule.Dataset]
+		if !ok {
+			scope = &datasetScope{heldTenants: make(map[string]bool)}
+			scopes[rule.Dataset] = scope
+		}
+		if rule.Tenant == "" {
+			scope.held = scope.held || rule.LegalHold
+			continue
+		}
+		if !slices.Contains(scope.exceptTenants, rule.Tenant) {
+			scope.exceptTenants = append(scope.exceptTenants, rule.Tenant)
+		}
+		if rule.LegalHold {
+			scope.heldTenants[rule.Tenant] = true
+		}
+	}
+	for _, scope := range scopes {
+		slices.Sort(scope.exceptTenants)
+	}
+	return scopes
+}
+
+// Run applies every rule to the stores of its dataset. With dryRun set nothing is
+// deleted and the report lists what would be. The rules of a dataset are applied
+// together: a dataset-wide hold suspends all of them, and dataset-wide rules
+// leave the tenants under a hold or with rules of their own alone. Stores that
+// cannot filter by tenant are skipped while any tenant of their dataset is held.
+func (e *Engine) Run(ctx context.Context, dryRun bool) *Report {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now().UTC()
+	report := &Report{GeneratedAt: now, DryRun: dryRun}
+	failed := false
+	scopes := e.scopes()
+
+	for _, rule := range e.policy.Rules {
+		scope := scopes[rule.Dataset]
+		datasetReport := DatasetReport{Rule: rule, Held: rule.LegalHold || scope.held}
+		if rule.Tenant == "" {
+			datasetReport.ExceptTenants = scope.exceptTenants
+		}
+		if rule.MaxAge > 0 {
+			// Without a max age only the size budget removes data
+			datasetReport.Cutoff = now.Add(-time.Duration(rule.MaxAge))
+		}
+
+		targets := e.targets[rule.Dataset]
+		if len(targets) == 0 {
+			datasetReport.Error = "no stores hold this dataset"
+		}
+
+		for _, target := range targets {
+			targetReport := TargetReport{Target: target.Name()}
+
+			switch {
+			case datasetReport.Held:
+				targetReport.Skipped = "legal hold"
+			case rule.Tenant != "" && scope.heldTenants[rule.Tenant]:
+				targetReport.Skipped = "tenant legal hold"
+			case rule.Tenant != "" && !target.SupportsTenant():
+				targetReport.Skipped = "store cannot filter by tenant"
+			case len(scope.heldTenants) > 0 && !target.SupportsTenant():
+				targetReport.Skipped = "store cannot keep the held tenants"
+			case rule.MaxAge == 0 && !target.SupportsSizeBudget():
+				targetReport.Skipped = "store has no size budget"
+			default:
+				var exceptTenants []string
+				if target.SupportsTenant() {
+					exceptTenants = datasetReport.ExceptTenants
+				}
+				outcome, err := target.Apply(ctx, rule, datasetReport.Cutoff, exceptTenants, dryRun)
+				targetReport.Outcome = outcome
+				if !dryRun {
+					e.metrics.RetentionItemsPruned.WithLabelValues(rule.Dataset, target.Name()).Add(float64(outcome.Items))
+					e.metrics.RetentionBytesPruned.WithLabelValues(rule.Dataset, target.Name()).Add(float64(outcome.Bytes))
+				}
+				if err != nil {
+					failed = true
+					targetReport.Error = err.Error()
+					e.logger.Error(fmt.Sprintf("Retention of %s on %s failed: %v", rule.Dataset, target.Name(), err))
+				} else if !dryRun && outcome.Items > 0 {
+					e.logger.Info(fmt.Sprintf("Retention removed %d items (%d bytes) of %s from %s", outcome.Items, outcome.Bytes, rule.Dataset, target.Name()))
+				}
+			}
+
+			datasetReport.Targets = append(datasetReport.Targets, targetReport)
+		}
+
+		report.Datasets = append(report.Datasets, datasetReport)
+	}
+
+	if !dryRun {
+		status := "success"
+		if failed {
+			status = "error"
+		}
+		e.metrics.RetentionRunsTotal.WithLabelValues(status).Inc()
+		e.metrics.RetentionLastRun.SetToCurrentTime()
+	}
+	return report
+}
@@ -0,0 +1,206 @@
+package retention
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func writeAgedFile(t *testing.T, path string, age time.Duration) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to age %s: %v", path, err)
+	}
+}
+
+func TestEngineRun(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	rawDir := t.TempDir()
+	heldDir := t.TempDir()
+	writeAgedFile(t, filepath.Join(rawDir, "old.json"), 48*time.Hour)
+	writeAgedFile(t, filepath.Join(rawDir, "new.json"), time.Hour)
+	writeAgedFile(t, filepath.Join(heldDir, "old.json"), 48*time.Hour)
+
+	engine := NewEngine(&Policy{Rules: []Rule{
+		{Dataset: "raw", MaxAge: Duration(24 * time.Hour)},
+		{Dataset: "held", MaxAge: Duration(24 * time.Hour), LegalHold: true},
+		{Dataset: "raw", MaxAge: Duration(24 * time.Hour), Tenant: "acme"},
+	}}, logger, metrics.NewMetrics())
+	engine.Register("raw", NewFileTarget(rawDir))
+	engine.Register("held", NewFileTarget(heldDir))
+
+	report := engine.Run(context.Background(), true)
+	if got := report.Datasets[0].Targets[0].Items; got != 1 {
+		t.Errorf("Expected dry run to report 1 expired file, got %d", got)
+	}
+	if _, err := os.Stat(filepath.Join(rawDir, "old.json")); err != nil {
+		t.Errorf("Expected dry run to keep files, got %v", err)
+	}
+
+	report = engine.Run(context.Background(), false)
+	if _, err := os.Stat(filepath.Join(rawDir, "old.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected expired file to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rawDir, "new.json")); err != nil {
+		t.Errorf("Expected recent file to be kept, got %v", err)
+	}
+	if skipped := report.Datasets[1].Targets[0].Skipped; skipped != "legal hold" {
+		t.Errorf("Expected held dataset to be skipped, got %q", skipped)
+	}
+	if _, err := os.Stat(filepath.Join(heldDir, "old.json")); err != nil {
+		t.Errorf("Expected held file to be kept, got %v", err)
+	}
+	if skipped := report.Datasets[2].Targets[0].Skipped; skipped == "" {
+		t.Error("Expected tenant rule to be skipped on a file store")
+	}
+}
+
+// tenantTable is a store holding one row per tenant, created at the given time
+type tenantTable struct {
+	rows map[string]time.Time
+}
+
+func (t *tenantTable) Name() string             { return "tenants" }
+func (t *tenantTable) SupportsTenant() bool     { return true }
+func (t *tenantTable) SupportsSizeBudget() bool { return false }
+
+func (t *tenantTable) Apply(ctx context.Context, rule Rule, cutoff time.Time, exceptTenants []string, dryRun bool) (Outcome, error) {
+	var outcome Outcome
+	for tenant, created := range t.rows {
+		if created.Before(cutoff) && (rule.Tenant == "" || rule.Tenant == tenant) && !slices.Contains(exceptTenants, tenant) {
+			outcome.Items++
+			if !dryRun {
+				delete(t.rows, tenant)
+			}
+		}
+	}
+	return outcome, nil
+}
+
+func TestEngineRunKeepsHeldTenants(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	created := time.Now().Add(-48 * time.Hour)
+	table := &tenantTable{rows: map[string]time.Time{"acme": created, "globex": created, "initech": created}}
+	rawDir := t.TempDir()
+	writeAgedFile(t, filepath.Join(rawDir, "old.json"), 48*time.Hour)
+
+	engine := NewEngine(&Policy{Rules: []Rule{
+		{Dataset: "raw", MaxAge: Duration(24 * time.Hour)},
+		{Dataset: "raw", Tenant: "acme", LegalHold: true},
+		{Dataset: "raw", Tenant: "initech", MaxAge: Duration(720 * time.Hour)},
+	}}, logger, metrics.NewMetrics())
+	engine.Register("raw", table)
+	engine.Register("raw", NewFileTarget(rawDir))
+
+	report := engine.Run(context.Background(), false)
+
+	// The dataset-wide TTL only expires the tenants without a rule of their own
+	if _, ok := table.rows["globex"]; ok {
+		t.Error("Expected the dataset-wide TTL to expire globex")
+	}
+	if _, ok := table.rows["acme"]; !ok {
+		t.Error("Expected the held tenant to survive the dataset-wide TTL")
+	}
+	if _, ok := table.rows["initech"]; !ok {
+		t.Error("Expected the tenant rule to override the dataset-wide TTL")
+	}
+	if got := report.Datasets[0].ExceptTenants; !slices.Equal(got, []string{"acme", "initech"}) {
+		t.Errorf("Expected the dataset-wide rule to leave acme and initech alone, got %v", got)
+	}
+
+	// Files cannot tell the held tenant's data apart, so they are kept
+	if skipped := report.Datasets[0].Targets[1].Skipped; skipped == "" {
+		t.Error("Expected the file store to be skipped while a tenant is held")
+	}
+	if _, err := os.Stat(filepath.Join(rawDir, "old.json")); err != nil {
+		t.Errorf("Expected the file to be kept while a tenant is held, got %v", err)
+	}
+}
+
+func TestFileTargetRemovesEmptyPartitions(t *testing.T) {
+	rawDir := t.TempDir()
+	oldPartition := filepath.Join(rawDir, "dt=2024-05-01", "hour=13")
+	newPartition := filepath.Join(rawDir, "dt=2024-05-02", "hour=09")
+	for _, dir := range []string{oldPartition, newPartition} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	writeAgedFile(t, filepath.Join(oldPartition, "old.json"), 48*time.Hour)
+	writeAgedFile(t, filepath.Join(newPartition, "new.json"), time.Hour)
+
+	outcome, err := NewFileTarget(rawDir).Apply(context.Background(), Rule{}, time.Now().Add(-24*time.Hour), nil, false)
+	if err != nil || outcome.Items != 1 {
+		t.Fatalf("Expected 1 expired file, got %d (%v)", outcome.Items, err)
+	}
+	if _, err := os.Stat(filepath.Join(rawDir, "dt=2024-05-01")); !os.IsNotExist(err) {
+		t.Errorf("Expected emptied partition to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(newPartition, "new.json")); err != nil {
+		t.Errorf("Expected recent partition to be kept, got %v", err)
+	}
+	if _, err := os.Stat(rawDir); err != nil {
+		t.Errorf("Expected the target directory to be kept, got %v", err)
+	}
+}
+
+func TestFileTargetSizeBudgetAndArchive(t *testing.T) {
+	rawDir := t.TempDir()
+	archiveDir := filepath.Join(t.TempDir(), "raw")
+	partition := filepath.Join(rawDir, "dt=2024-05-01")
+	if err := os.MkdirAll(partition, 0755); err != nil {
+		t.Fatalf("Failed to create partition: %v", err)
+	}
+	// Four files of 4 bytes, oldest first
+	for i, name := range []string{"a.json", "b.json", "c.json", "d.json"} {
+		writeAgedFile(t, filepath.Join(partition, name), time.Duration(4-i)*time.Hour)
+	}
+
+	target := NewFileTarget(rawDir).ArchiveTo(archiveDir)
+	rule := Rule{Dataset: "raw", MaxSize: 10}
+
+	outcome, err := target.Apply(context.Background(), rule, time.Time{}, nil, true)
+	if err != nil || outcome.Items != 2 || outcome.Bytes != 8 {
+		t.Fatalf("Expected dry run to report the 2 oldest files, got %+v (%v)", outcome, err)
+	}
+
+	if _, err := target.Apply(context.Background(), rule, time.Time{}, nil, false); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	for _, name := range []string{"a.json", "b.json"} {
+		if _, err := os.Stat(filepath.Join(archiveDir, "dt=2024-05-01", name)); err != nil {
+			t.Errorf("Expected %s to be archived, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"c.json", "d.json"} {
+		if _, err := os.Stat(filepath.Join(partition, name)); err != nil {
+			t.Errorf("Expected %s to fit in the budget, got %v", name, err)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{"512": 512, "1KB": 1 << 10, "10 gb": 10 << 30, "2TB": 2 << 40}
+	for value, want := range tests {
+		if got, err := ParseByteSize(value); err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %d, %v; want %d", value, got, err, want)
+		}
+	}
+	if _, err := ParseByteSize("ten"); err == nil {
+		t.Error("Expected an error for an invalid size")
+	}
+}
@@ -0,0 +1,156 @@
+package retention
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule is the retention rule of one dataset
+type Rule struct {
+	Dataset string `json:"dataset"`
+	// MaxAge is how long data is kept, e.g. "720h"
+	MaxAge Duration `json:"max_age"`
+	// MaxSize is the size budget of stores that track it, e.g. "10GB"; the oldest
+	// data beyond it is removed
+	MaxSize ByteSize `json:"max_size,omitempty"`
+	// Tenant limits the rule to one tenant on stores that can filter by tenant
+	Tenant string `json:"tenant,omitempty"`
+	// LegalHold suspends all deletion for the dataset
+	LegalHold bool `json:"legal_hold,omitempty"`
+}
+
+// Policy is the set of retention rules, declared once for all stores
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// AddDefault adds a rule keeping dataset for maxAge unless the policy already has one for it
+func (p *Policy) AddDefault(dataset string, maxAge time.Duration) {
+	for _, rule := range p.Rules {
+		if rule.Dataset == dataset && rule.Tenant == "" {
+			return
+		}
+	}
+	p.Rules = append(p.Rules, Rule{Dataset: dataset, MaxAge: Duration(maxAge)})
+}
+
+// AddSizeBudget limits dataset to maxSize bytes unless the policy already has a
+// budget for it, adding the budget to the dataset's rule if there is one
+func (p *Policy) AddSizeBudget(dataset string, maxSize int64) {
+	for i, rule := range p.Rules {
+		if rule.Dataset == dataset && rule.Tenant == "" {
+			if rule.MaxSize == 0 {
+				p.Rules[i].MaxSize = ByteSize(maxSize)
+			}
+			return
+		}
+	}
+	p.Rules = append(p.Rules, Rule{Dataset: dataset, MaxSize: ByteSize(maxSize)})
+}
+
+// Duration is a time.Duration that (un)marshals as a Go duration string
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string such as "720h"
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON formats the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ByteSize is a number of bytes that (un)marshals as a size string such as "10GB"
+type ByteSize int64
+
+// byteUnits are the size suffixes, in powers of 1024
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// ParseByteSize parses a size such as "512MB" or "10GB", in powers of 1024, or a plain number of bytes
+func ParseByteSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// UnmarshalJSON parses a size string such as "10GB" or a number of bytes
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case float64:
+		*b = ByteSize(v)
+		return nil
+	case string:
+		size, err := ParseByteSize(v)
+		if err != nil {
+			return err
+		}
+		*b = ByteSize(size)
+		return nil
+	}
+	return fmt.Errorf("size must be a string or a number")
+}
+
+// MarshalJSON formats the size in the largest unit dividing it
+func (b ByteSize) MarshalJSON() ([]byte, error) {
+	for _, unit := range byteUnits {
+		if b != 0 && int64(b)%unit.size == 0 {
+			return json.Marshal(fmt.Sprintf("%d%s", int64(b)/unit.size, unit.suffix))
+		}
+	}
+	return json.Marshal(fmt.Sprintf("%dB", int64(b)))
+}
+
+// LoadPolicy reads and validates a JSON retention policy file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retention policy: %w", err)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse retention policy: %w", err)
+	}
+
+	for i, rule := range policy.Rules {
+		if rule.Dataset == "" {
+			return nil, fmt.Errorf("retention rule %d: dataset is required", i)
+		}
+		if rule.MaxAge < 0 || rule.MaxSize < 0 || (rule.MaxAge == 0 && rule.MaxSize == 0 && !rule.LegalHold) {
+			return nil, fmt.Errorf("retention rule %d (%s): max_age or max_size must be positive", i, rule.Dataset)
+		}
+	}
+	return &policy, nil
+}
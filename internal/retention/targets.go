@@ -0,0 +1,313 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/objectstore"
+	"github.com/mohammedhassan/etl-pipeline/internal/storage"
+)
+
+// maxExamples bounds the number of example items listed per target in a report
+const maxExamples = 10
+
+// Outcome is what a target deleted, or would delete in a dry run
+type Outcome struct {
+	Items    int64    `json:"items"`
+	Bytes    int64    `json:"bytes,omitempty"`
+	Examples []string `json:"examples,omitempty"`
+}
+
+// Target is a store holding data of a dataset
+type Target interface {
+	Name() string
+	// SupportsTenant reports whether rules can be limited to one tenant
+	SupportsTenant() bool
+	// SupportsSizeBudget reports whether the store enforces Rule.MaxSize
+	SupportsSizeBudget() bool
+	// Apply deletes data older than cutoff, and the oldest data beyond the size
+	// budget where supported, or only reports it when dryRun is set. The data of
+	// exceptTenants is kept; it is only set for stores supporting tenants.
+	Apply(ctx context.Context, rule Rule, cutoff time.Time, exceptTenants []string, dryRun bool) (Outcome, error)
+}
+
+// TableTarget expires rows of a PostgreSQL table
+type TableTarget struct {
+	db         *database.PostgresDB
+	table      string
+	timeColumn string
+	tenantExpr string
+	archive    *storage.FileStorage
+}
+
+// NewTableTarget creates a target for table, aged by timeColumn. tenantExpr is
+// the SQL expression yielding a row's tenant, or empty if the table has none.
+// When archive is set, rows are written to it before they are deleted.
+func NewTableTarget(db *database.PostgresDB, table, timeColumn, tenantExpr string, archive *storage.FileStorage) *TableTarget {
+	return &TableTarget{db: db, table: table, timeColumn: timeColumn, tenantExpr: tenantExpr, archive: archive}
+}
+
+// Name returns the target name
+func (t *TableTarget) Name() string {
+	return "postgres:" + t.table
+}
+
+// SupportsTenant reports whether the table has a tenant expression
+func (t *TableTarget) SupportsTenant() bool {
+	return t.tenantExpr != ""
+}
+
+// SupportsSizeBudget is false since rows are only expired by age
+func (t *TableTarget) SupportsSizeBudget() bool {
+	return false
+}
+
+// Apply counts or deletes expired rows
+func (t *TableTarget) Apply(ctx context.Context, rule Rule, cutoff time.Time, exceptTenants []string, dryRun bool) (Outcome, error) {
+	filter := database.ExpiryFilter{Table: t.table, TimeColumn: t.timeColumn, TenantExpr: t.tenantExpr, Tenant: rule.Tenant, ExceptTenants: exceptTenants}
+
+	var outcome Outcome
+	// Whole expired partitions are dropped instead of deleted row by row, unless
+	// rows have to be archived first or the rows of some tenants are kept
+	if !dryRun && t.archive == nil && rule.Tenant == "" && len(exceptTenants) == 0 {
+		if _, partitioned := database.PartitionedTables[t.table]; partitioned {
+			dropped, count, err := t.db.DropPartitionsBefore(ctx, t.table, cutoff)
+			outcome.Items = count
+			for _, name := range dropped {
+				if len(outcome.Examples) < maxExamples {
+					outcome.Examples = append(outcome.Examples, "partition "+name)
+				}
+			}
+			if err != nil {
+				return outcome, err
+			}
+		}
+	}
+
+	var count int64
+	var err error
+	if dryRun {
+		count, err = t.db.CountExpired(ctx, filter, cutoff)
+	} else {
+		var archive func(rows []json.RawMessage) error
+		if t.archive != nil {
+			archive = func(rows []json.RawMessage) error {
+				return t.archive.SaveArchive(t.table, rows)
+			}
+		}
+		count, err = t.db.DeleteExpired(ctx, filter, cutoff, archive)
+	}
+	outcome.Items += count
+	return outcome, err
+}
+
+// item is a file or object considered for expiry
+type item struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// expired returns the items last modified before cutoff, then the oldest of the
+// others until the remaining ones fit in maxSize, when it is set
+func expired(items []item, cutoff time.Time, maxSize int64) []item {
+	sort.Slice(items, func(i, j int) bool { return items[i].modTime.Before(items[j].modTime) })
+
+	var total int64
+	for _, it := range items {
+		total += it.size
+	}
+	var result []item
+	for _, it := range items {
+		if it.modTime.Before(cutoff) || (maxSize > 0 && total > maxSize) {
+			result = append(result, it)
+			total -= it.size
+		}
+	}
+	return result
+}
+
+// FileTarget expires files under a local directory by modification time and size budget
+type FileTarget struct {
+	dir     string
+	exclude map[string]bool
+	// archiveDir receives expired files instead of deleting them, when set
+	archiveDir string
+}
+
+// NewFileTarget creates a target for the files below dir, never touching the excluded paths
+func NewFileTarget(dir string, exclude ...string) *FileTarget {
+	excluded := make(map[string]bool, len(exclude))
+	for _, path := range exclude {
+		excluded[filepath.Clean(path)] = true
+	}
+	return &FileTarget{dir: dir, exclude: excluded}
+}
+
+// ArchiveTo moves expired files below archiveDir, keeping their path relative to
+// the target directory, instead of deleting them
+func (t *FileTarget) ArchiveTo(archiveDir string) *FileTarget {
+	t.archiveDir = archiveDir
+	return t
+}
+
+// Name returns the target name
+func (t *FileTarget) Name() string {
+	return "files:" + t.dir
+}
+
+// SupportsTenant is false since files are not partitioned by tenant
+func (t *FileTarget) SupportsTenant() bool {
+	return false
+}
+
+// SupportsSizeBudget is true since the directory size is known
+func (t *FileTarget) SupportsSizeBudget() bool {
+	return true
+}
+
+// Apply removes, archives or lists expired files, then removes the
+// subdirectories, such as date partitions, left empty
+func (t *FileTarget) Apply(ctx context.Context, rule Rule, cutoff time.Time, _ []string, dryRun bool) (Outcome, error) {
+	var outcome Outcome
+	var files []item
+	var dirs []string
+
+	err := filepath.WalkDir(t.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry.IsDir() {
+			if path != t.dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if t.exclude[filepath.Clean(path)] {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, item{name: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return outcome, err
+	}
+
+	for _, file := range expired(files, cutoff, int64(rule.MaxSize)) {
+		if !dryRun {
+			if err := t.expire(file.name); err != nil {
+				return outcome, err
+			}
+		}
+		outcome.Items++
+		outcome.Bytes += file.size
+		if len(outcome.Examples) < maxExamples {
+			outcome.Examples = append(outcome.Examples, file.name)
+		}
+	}
+
+	if !dryRun {
+		// Deepest first, so parents emptied by their children go too; removing a
+		// directory that still holds files fails and is ignored
+		for i := len(dirs) - 1; i >= 0; i-- {
+			os.Remove(dirs[i])
+		}
+	}
+	return outcome, nil
+}
+
+// expire deletes a file, or moves it below the archive directory
+func (t *FileTarget) expire(path string) error {
+	if t.archiveDir == "" {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		return nil
+	}
+
+	rel, err := filepath.Rel(t.dir, path)
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(t.archiveDir, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	if err := os.Rename(path, dest); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", path, err)
+	}
+	return nil
+}
+
+// ObjectTarget expires objects under an S3 prefix by last-modified time and size budget
+type ObjectTarget struct {
+	client *objectstore.S3Client
+	prefix string
+}
+
+// NewObjectTarget creates a target for the objects under prefix
+func NewObjectTarget(client *objectstore.S3Client, prefix string) *ObjectTarget {
+	return &ObjectTarget{client: client, prefix: strings.TrimSuffix(prefix, "/") + "/"}
+}
+
+// Name returns the target name
+func (t *ObjectTarget) Name() string {
+	return fmt.Sprintf("s3://%s/%s", t.client.Bucket(), t.prefix)
+}
+
+// SupportsTenant is false since batches are not partitioned by tenant
+func (t *ObjectTarget) SupportsTenant() bool {
+	return false
+}
+
+// SupportsSizeBudget is true since listings carry object sizes
+func (t *ObjectTarget) SupportsSizeBudget() bool {
+	return true
+}
+
+// Apply deletes or lists expired objects
+func (t *ObjectTarget) Apply(ctx context.Context, rule Rule, cutoff time.Time, _ []string, dryRun bool) (Outcome, error) {
+	var outcome Outcome
+
+	objects, err := t.client.ListObjects(ctx, t.prefix)
+	if err != nil {
+		return outcome, err
+	}
+	items := make([]item, len(objects))
+	for i, object := range objects {
+		items[i] = item{name: object.Key, size: object.Size, modTime: object.LastModified}
+	}
+
+	for _, object := range expired(items, cutoff, int64(rule.MaxSize)) {
+		if !dryRun {
+			if err := t.client.DeleteObject(ctx, object.name); err != nil {
+				return outcome, err
+			}
+		}
+		outcome.Items++
+		outcome.Bytes += object.size
+		if len(outcome.Examples) < maxExamples {
+			outcome.Examples = append(outcome.Examples, object.name)
+		}
+	}
+	return outcome, nil
+}
@@ -0,0 +1,30 @@
+package runid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// HTTPHeader carries the run ID of requests made by a run, e.g. to the source API
+const HTTPHeader = "X-Correlation-ID"
+
+type contextKey struct{}
+
+// New returns a random run ID
+func New() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// WithID returns a context carrying the ID of the run it belongs to
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the run ID carried by ctx, or "" outside of a run
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,20 @@
+package runid
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	if id := FromContext(context.Background()); id != "" {
+		t.Errorf("Expected no run ID outside of a run, got %q", id)
+	}
+
+	id := New()
+	if len(id) != 16 || id == New() {
+		t.Errorf("Expected a random 16 character run ID, got %q", id)
+	}
+	if got := FromContext(WithID(context.Background(), id)); got != id {
+		t.Errorf("Expected run ID %q from context, got %q", id, got)
+	}
+}
@@ -0,0 +1,45 @@
+package schemaregistry
+
+import (
+	"encoding/json"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// JSONSchema returns the JSON Schema of records with the given processed fields.
+// Optional fields may also be null; other properties are allowed, so that fields
+// can be added without breaking consumers validating older records.
+func JSONSchema(title string, fields []transform.Field) ([]byte, error) {
+	properties := make(map[string]interface{}, len(fields))
+	required := make([]string, 0, len(fields))
+	for _, field := range fields {
+		var jsonType interface{} = jsonType(field.Type)
+		if field.Required {
+			required = append(required, field.Name)
+		} else {
+			jsonType = []string{jsonType.(string), "null"}
+		}
+		property := map[string]interface{}{"type": jsonType}
+		if field.Description != "" {
+			property["description"] = field.Description
+		}
+		properties[field.Name] = property
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"title":      title,
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	})
+}
+
+func jsonType(fieldType string) string {
+	switch fieldType {
+	case transform.FieldTypeInteger:
+		return "integer"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,167 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Schema types of the registry
+const (
+	TypeAvro = "AVRO"
+	TypeJSON = "JSON"
+)
+
+// errSubjectNotFound is the registry error code of a subject without versions
+const errSubjectNotFound = 40401
+
+// contentType is the media type of registry requests
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// Schema is a schema definition of a registry type
+type Schema struct {
+	Type       string
+	Definition []byte
+}
+
+// Config holds the settings of a schema registry speaking the Confluent REST API,
+// which Apicurio serves under /apis/ccompat/v7
+type Config struct {
+	URL string
+	// Username and Password authenticate with HTTP basic auth, if set
+	Username string
+	Password string
+}
+
+// Client registers schemas with a schema registry and checks their compatibility
+// with the versions registered before
+type Client struct {
+	cfg        Config
+	httpClient *http.Client
+}
+
+// IncompatibleError is a schema the registry refuses as incompatible with the
+// versions of its subject, under the subject's compatibility level
+type IncompatibleError struct {
+	Subject  string
+	Messages []string
+}
+
+func (e *IncompatibleError) Error() string {
+	if len(e.Messages) == 0 {
+		return fmt.Sprintf("schema is incompatible with subject %s", e.Subject)
+	}
+	return fmt.Sprintf("schema is incompatible with subject %s: %s", e.Subject, strings.Join(e.Messages, "; "))
+}
+
+// NewClient creates a schema registry client
+func NewClient(cfg Config) (*Client, error) {
+	if _, err := url.ParseRequestURI(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid schema registry URL: %w", err)
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	return &Client{cfg: cfg, httpClient: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// Register checks schema against the latest version of subject and registers it,
+// returning its ID. Registering an unchanged schema returns the ID it already has.
+func (c *Client) Register(ctx context.Context, subject string, schema Schema) (int, error) {
+	if err := c.CheckCompatibility(ctx, subject, schema); err != nil {
+		return 0, err
+	}
+	var registered struct {
+		ID int `json:"id"`
+	}
+	if err := c.post(ctx, subject, "/subjects/"+url.PathEscape(subject)+"/versions", schema, &registered); err != nil {
+		return 0, fmt.Errorf("failed to register schema of subject %s: %w", subject, err)
+	}
+	return registered.ID, nil
+}
+
+// CheckCompatibility checks that schema can evolve the latest version of subject,
+// returning an IncompatibleError when it cannot. A new subject accepts any schema.
+func (c *Client) CheckCompatibility(ctx context.Context, subject string, schema Schema) error {
+	var result struct {
+		IsCompatible bool     `json:"is_compatible"`
+		Messages     []string `json:"messages"`
+	}
+	path := "/compatibility/subjects/" + url.PathEscape(subject) + "/versions/latest?verbose=true"
+	err := c.post(ctx, subject, path, schema, &result)
+	var registryErr *registryError
+	switch {
+	case errors.As(err, &registryErr) && registryErr.Code == errSubjectNotFound:
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to check schema compatibility of subject %s: %w", subject, err)
+	case !result.IsCompatible:
+		return &IncompatibleError{Subject: subject, Messages: result.Messages}
+	}
+	return nil
+}
+
+// registryError is an error response of the registry
+type registryError struct {
+	Status  int
+	Code    int    `json:"error_code"`
+	Message string `json:"message"`
+}
+
+func (e *registryError) Error() string {
+	return fmt.Sprintf("schema registry returned status code %d: %s (error code %d)", e.Status, e.Message, e.Code)
+}
+
+// post sends schema to path and decodes the response into result
+func (c *Client) post(ctx context.Context, subject, path string, schema Schema, result interface{}) error {
+	body, err := json.Marshal(map[string]string{"schema": string(schema.Definition), "schemaType": schema.Type})
+	if err != nil {
+		return fmt.Errorf("failed to encode schema: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType)
+	if c.cfg.Username != "" {
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		registryErr := &registryError{Status: resp.StatusCode}
+		json.Unmarshal(content, registryErr)
+		if resp.StatusCode == http.StatusConflict {
+			// Raised by the registry when the schema breaks its compatibility level
+			return &IncompatibleError{Subject: subject, Messages: []string{registryErr.Message}}
+		}
+		return registryErr
+	}
+	if err := json.Unmarshal(content, result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// Frame prefixes an encoded payload with the schema ID as registry serializers
+// expect: a zero magic byte and the ID as a big-endian 32-bit integer
+func Frame(id int, payload []byte) []byte {
+	framed := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(framed[1:], uint32(id))
+	return append(framed, payload...)
+}
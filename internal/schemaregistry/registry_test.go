@@ -0,0 +1,95 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// fakeRegistry serves the compatibility and registration endpoints of one subject
+type fakeRegistry struct {
+	versions   []string
+	compatible bool
+	messages   []string
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, _ := r.BasicAuth(); user != "key" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 40101, "message": "unauthorized"})
+		return
+	}
+	var body struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	switch r.URL.Path {
+	case "/compatibility/subjects/orders-value/versions/latest":
+		if len(f.versions) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 40401, "message": "Subject 'orders-value' not found."})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"is_compatible": f.compatible, "messages": f.messages})
+	case "/subjects/orders-value/versions":
+		f.versions = append(f.versions, body.Schema)
+		json.NewEncoder(w).Encode(map[string]int{"id": 100 + len(f.versions)})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	registry := &fakeRegistry{}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	client, err := NewClient(Config{URL: server.URL + "/", Username: "key", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx := context.Background()
+
+	definition, err := JSONSchema("ProcessedRecord", transform.Fields)
+	if err != nil {
+		t.Fatalf("Failed to build json schema: %v", err)
+	}
+	schema := Schema{Type: TypeJSON, Definition: definition}
+	id, err := client.Register(ctx, "orders-value", schema)
+	if err != nil || id != 101 {
+		t.Fatalf("Expected the schema of a new subject registered as 101, got %d, %v", id, err)
+	}
+
+	registry.compatible = true
+	if id, err := client.Register(ctx, "orders-value", schema); err != nil || id != 102 {
+		t.Errorf("Expected a compatible schema registered, got %d, %v", id, err)
+	}
+
+	registry.compatible = false
+	registry.messages = []string{"property user_id removed"}
+	_, err = client.Register(ctx, "orders-value", schema)
+	var incompatible *IncompatibleError
+	if !errors.As(err, &incompatible) || incompatible.Messages[0] != "property user_id removed" {
+		t.Errorf("Expected an incompatible schema refused, got %v", err)
+	}
+	if len(registry.versions) != 2 {
+		t.Errorf("Expected the incompatible schema not registered, got %d versions", len(registry.versions))
+	}
+
+	unauthorized, _ := NewClient(Config{URL: server.URL})
+	if _, err := unauthorized.Register(ctx, "orders-value", schema); err == nil || errors.As(err, &incompatible) {
+		t.Errorf("Expected an authentication failure, got %v", err)
+	}
+}
+
+func TestFrame(t *testing.T) {
+	framed := Frame(258, []byte("{}"))
+	if string(framed) != "\x00\x00\x00\x01\x02{}" {
+		t.Errorf("Unexpected framing %q", framed)
+	}
+}
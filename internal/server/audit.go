@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+// maxAuditEntries bounds the audit records returned by /audit
+const maxAuditEntries = 100
+
+// auditHandler returns the recorded transformation changes of a source record,
+// newest first, e.g. GET /audit?source_id=42&limit=10
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sourceID := r.URL.Query().Get("source_id")
+	if sourceID == "" {
+		http.Error(w, "source_id is required", http.StatusBadRequest)
+		return
+	}
+	limit := maxAuditEntries
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxAuditEntries)
+	}
+
+	audits, err := s.db.TransformAudits(r.Context(), sourceID, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to query transformation audit trail: %v", err))
+		http.Error(w, "failed to query audit trail", http.StatusInternalServerError)
+		return
+	}
+	if audits == nil {
+		audits = []database.RecordAudit{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"source_id": sourceID,
+		"audits":    audits,
+	})
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/etl"
+)
+
+// backfillHandler starts a backfill of a pipeline with POST, e.g.
+// POST /pipelines/default/backfill?from=2023-01-01&to=2023-06-30&chunk=168h&parallelism=4,
+// and reports the progress of one with GET /pipelines/default/backfill?id=3f2a9c0e7b1d4e6f
+func (s *Server) backfillHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	pipeline, ok := s.pipelines[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("pipeline %s not found", name), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		s.startBackfill(w, r, name, pipeline)
+	case http.MethodGet:
+		s.backfillProgress(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) startBackfill(w http.ResponseWriter, r *http.Request, name string, pipeline PipelineController) {
+	query := r.URL.Query()
+	req := etl.BackfillRequest{ID: query.Get("id")}
+	var err error
+	if req.From, err = etl.ParseBound(query.Get("from"), false); err != nil {
+		http.Error(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.To, err = etl.ParseBound(query.Get("to"), true); err != nil {
+		http.Error(w, fmt.Sprintf("invalid to: %v", err), http.StatusBadRequest)
+		return
+	}
+	if value := query.Get("chunk"); value != "" {
+		if req.Chunk, err = time.ParseDuration(value); err != nil || req.Chunk <= 0 {
+			http.Error(w, "chunk must be a positive duration, e.g. 24h", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("parallelism"); value != "" {
+		if req.Parallelism, err = strconv.Atoi(value); err != nil || req.Parallelism < 1 {
+			http.Error(w, "parallelism must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	backfill, err := pipeline.PlanBackfill(r.Context(), req)
+	if errors.Is(err, etl.ErrDryRun) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// The backfill outlives the request and stops with the server
+	go func() {
+		if err := pipeline.RunBackfill(s.background, backfill); err != nil {
+			s.logger.Error(fmt.Sprintf("Backfill %s of pipeline %s incomplete: %v", backfill.ID, name, err))
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backfill_id": backfill.ID,
+		"from":        backfill.From,
+		"to":          backfill.To,
+		"chunks":      backfill.Chunks,
+		"pending":     len(backfill.Pending),
+		"parallelism": backfill.Parallelism,
+	})
+}
+
+// backfillProgress reports the runs of a backfill and the number of chunks by the
+// status of their latest run
+func (s *Server) backfillProgress(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	runs, err := s.db.BackfillRuns(r.Context(), id)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to query backfill runs: %v", err))
+		http.Error(w, "failed to query backfill runs", http.StatusInternalServerError)
+		return
+	}
+	if len(runs) == 0 {
+		http.Error(w, "backfill not found", http.StatusNotFound)
+		return
+	}
+
+	// Runs are ordered by range, retries of a range last
+	latest := make(map[int64]database.PipelineRun)
+	for _, run := range runs {
+		if run.RangeFrom != nil {
+			latest[run.RangeFrom.UnixNano()] = run
+		}
+	}
+	chunks := make(map[string]int)
+	for _, run := range latest {
+		chunks[run.Status]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backfill_id": id,
+		"chunks":      chunks,
+		"runs":        runs,
+	})
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/envelope"
+	"github.com/mohammedhassan/etl-pipeline/internal/etl"
+)
+
+// maxIngestBytes bounds the size of a batch accepted by /ingest, before and after decompression
+const maxIngestBytes = 64 << 20
+
+// Ingester loads batches handed off by other instances or tools
+type Ingester interface {
+	Ingest(ctx context.Context, batch *envelope.Envelope) error
+}
+
+// ingestHandler accepts a batch envelope and loads it through the pipeline
+func (s *Server) ingestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.ingester == nil {
+		http.Error(w, "ingest not configured", http.StatusNotFound)
+		return
+	}
+
+	// Compressed batches name their codec in Content-Encoding
+	encoding := r.Header.Get("Content-Encoding")
+	if encoding == "identity" {
+		encoding = ""
+	}
+	compression, err := codec.Get(encoding)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := compression.NewReader(http.MaxBytesReader(w, r.Body, maxIngestBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	batch, err := envelope.Decode(io.LimitReader(body, maxIngestBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.ingester.Ingest(r.Context(), batch)
+	if errors.Is(err, etl.ErrDryRun) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to ingest batch %s: %v", batch.BatchID, err))
+		http.Error(w, "failed to ingest batch", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"batch_id": batch.BatchID,
+		"kind":     batch.Kind,
+		"records":  batch.RecordCount,
+	})
+}
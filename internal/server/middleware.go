@@ -0,0 +1,248 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/httpauth"
+)
+
+// MiddlewareConfig configures the middleware wrapping every endpoint
+type MiddlewareConfig struct {
+	// AccessLog logs every request with its status, size and latency
+	AccessLog bool
+	// RateLimit is the number of control requests per second allowed per client,
+	// with bursts of RateLimitBurst; zero disables the limit
+	RateLimit      float64
+	RateLimitBurst int
+	// ClientIPHeader names the header holding the client address set by a proxy,
+	// e.g. X-Forwarded-For; the remote address is used when empty
+	ClientIPHeader string
+	// CORSOrigins are the origins allowed to call the API from a browser, * for any
+	CORSOrigins []string
+}
+
+// SetMiddleware sets the access log, rate limit and CORS policy of the server
+func (s *Server) SetMiddleware(cfg MiddlewareConfig) {
+	s.middleware = cfg
+}
+
+// handler wraps the endpoints in the middleware: panic recovery, access logs,
+// CORS, authentication and the rate limit of control requests, outermost first
+func (s *Server) handler(mux http.Handler) http.Handler {
+	handler := mux
+	if s.middleware.RateLimit > 0 {
+		handler = s.rateLimit(handler, newRateLimiter(s.middleware.RateLimit, s.middleware.RateLimitBurst))
+	}
+	if s.auth != nil {
+		handler = s.auth.Middleware(handler)
+	}
+	if len(s.middleware.CORSOrigins) > 0 {
+		handler = s.cors(handler)
+	}
+	if s.middleware.AccessLog {
+		handler = s.accessLog(handler)
+	}
+	return s.recoverPanics(handler)
+}
+
+// statusRecorder records the status and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// recoverPanics turns a panicking request into 500 Internal Server Error, logging
+// the panic with its stack instead of dropping the connection
+func (s *Server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				s.metrics.HTTPPanicsTotal.Inc()
+				s.logger.Error(fmt.Sprintf("Panic serving %s %s: %v\n%s", r.Method, r.URL.Path, p, debug.Stack()))
+				if recorder.status == 0 {
+					http.Error(recorder, "internal server error", http.StatusInternalServerError)
+				}
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// quietPaths are polled by probes and scrapers; only their failures are logged
+var quietPaths = map[string]bool{"/health": true, "/ready": true, "/metrics": true}
+
+// accessLog logs each request as key=value pairs once it was served
+func (s *Server) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			status := recorder.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if quietPaths[r.URL.Path] && status < http.StatusBadRequest {
+				return
+			}
+			s.logger.Info(fmt.Sprintf("HTTP method=%s path=%q status=%d bytes=%d duration=%s client=%s user_agent=%q",
+				r.Method, r.URL.Path, status, recorder.bytes, time.Since(start).Round(time.Microsecond), s.clientIP(r), r.UserAgent()))
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// cors adds the CORS headers for allowed origins and answers their preflight requests
+func (s *Server) cors(next http.Handler) http.Handler {
+	anyOrigin := slices.Contains(s.middleware.CORSOrigins, "*")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !anyOrigin && !slices.Contains(s.middleware.CORSOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Content-Encoding")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit rejects control requests, all but GET and HEAD, of clients exceeding
+// their rate with 429 Too Many Requests. Clients are told apart by their identity
+// when authenticated, otherwise by their address.
+func (s *Server) rateLimit(next http.Handler, limiter *rateLimiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := s.clientIP(r)
+		if identity, ok := httpauth.IdentityFrom(r.Context()); ok {
+			client = identity.Subject
+		}
+		if wait := limiter.allow(client, time.Now()); wait > 0 {
+			s.metrics.HTTPRateLimitedTotal.Inc()
+			s.logger.Warn(fmt.Sprintf("Rate limited %s %s from %s", r.Method, r.URL.Path, client))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address of the client of a request, from ClientIPHeader if
+// set and present
+func (s *Server) clientIP(r *http.Request) string {
+	if header := s.middleware.ClientIPHeader; header != "" {
+		// X-Forwarded-For lists the client first, followed by the proxies
+		if value, _, _ := strings.Cut(r.Header.Get(header), ","); strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// idleBucketsSweep is how often buckets refilled completely are dropped
+const idleBucketsSweep = time.Minute
+
+// rateLimiter is a token bucket per client
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(max(burst, 1)), buckets: make(map[string]*bucket)}
+}
+
+// allow takes a token of the client's bucket, returning zero, or how long until
+// one is available when the bucket is empty
+func (l *rateLimiter) allow(client string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > idleBucketsSweep {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// sweep drops the buckets that refilled completely, of clients gone quiet
+func (l *rateLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/httpauth"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestAuthentication(t *testing.T) {
+	pipeline := &fakePipeline{}
+	s := newTestServer(t, &fakeStore{}, pipeline)
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+	auth, err := httpauth.New(httpauth.Config{
+		ReadTokens:    []string{"read-token"},
+		ControlTokens: []string{"control-token"},
+		PublicPaths:   []string{"/health"},
+	}, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("httpauth.New() error = %v", err)
+	}
+	s.SetAuthenticator(auth)
+
+	bearer := func(token string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + token}
+	}
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header map[string]string
+		want   int
+	}{
+		{"public path", http.MethodGet, "/health", nil, http.StatusOK},
+		{"no credentials", http.MethodGet, "/runs", nil, http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "/runs", bearer("guess"), http.StatusUnauthorized},
+		{"read token reads", http.MethodGet, "/runs", bearer("read-token"), http.StatusOK},
+		{"read token cannot pause", http.MethodPost, "/pipelines/default/pause", bearer("read-token"), http.StatusForbidden},
+		{"read token cannot preview", http.MethodPost, "/transform/preview", bearer("read-token"), http.StatusForbidden},
+		{"control token reads", http.MethodGet, "/pipelines/default/runs", bearer("control-token"), http.StatusOK},
+		{"control token pauses", http.MethodPost, "/pipelines/default/pause", bearer("control-token"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := serve(s, tt.method, tt.target, "", tt.header)
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, rec.Code)
+		}
+		if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate challenge", tt.name)
+		}
+	}
+	if !pipeline.paused {
+		t.Errorf("Expected the control token to pause the pipeline")
+	}
+}
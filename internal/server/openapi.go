@@ -0,0 +1,88 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+	"github.com/mohammedhassan/etl-pipeline/internal/version"
+)
+
+// openAPISpec is the OpenAPI 3 document of the endpoints; the API version and the
+// processed record schema are filled in when it is first served
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIDocument returns the OpenAPI document with the version of the running
+// binary and the processed record schema of transform.Fields
+var openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	doc["info"].(map[string]interface{})["version"] = version.Get().Version
+
+	properties := make(map[string]interface{}, len(transform.Fields))
+	var required []string
+	for _, field := range transform.Fields {
+		properties[field.Name] = map[string]string{"type": field.Type, "description": field.Description}
+		if field.Required {
+			required = append(required, field.Name)
+		}
+	}
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	record := schemas["ProcessedRecord"].(map[string]interface{})
+	record["properties"] = properties
+	record["required"] = required
+	return json.MarshalIndent(doc, "", "  ")
+})
+
+// openAPIHandler serves the OpenAPI document of the API, e.g. GET /openapi.json
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	doc, err := openAPIDocument()
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to render the OpenAPI document: %v", err))
+		http.Error(w, "failed to render the OpenAPI document", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(doc)
+}
+
+// docsPage renders /openapi.json with Swagger UI, loaded from a CDN
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ETL Pipeline API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+<script>
+window.onload = function () {
+  window.ui = SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" });
+};
+</script>
+</body>
+</html>
+`
+
+// docsHandler serves Swagger UI for the API, e.g. GET /docs
+func (s *Server) docsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, docsPage)
+}
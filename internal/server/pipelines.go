@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/etl"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// PipelineController pauses and resumes the scheduled cycles of a pipeline,
+// backfills historical date ranges, replays stored raw records and previews a
+// cycle with a dry run or the transformation of a sample
+type PipelineController interface {
+	Pause() bool
+	Resume() bool
+	Paused() bool
+	Status() etl.PipelineStatus
+	PlanBackfill(ctx context.Context, req etl.BackfillRequest) (*etl.Backfill, error)
+	RunBackfill(ctx context.Context, backfill *etl.Backfill) error
+	DryRun(ctx context.Context) (*etl.DryRunSummary, error)
+	DryRunMode() bool
+	Replay(ctx context.Context, req etl.ReplayRequest) (*database.PipelineRun, error)
+	PreviewTransform(ctx context.Context, req etl.PreviewRequest) (*transform.Preview, error)
+}
+
+// SetPipelines enables the pipeline control endpoints for the pipelines by name
+func (s *Server) SetPipelines(pipelines map[string]PipelineController) {
+	s.pipelines = pipelines
+}
+
+// pipelineStates returns the state of each pipeline, "running" or "paused"
+func (s *Server) pipelineStates() map[string]string {
+	states := make(map[string]string, len(s.pipelines))
+	for name, pipeline := range s.pipelines {
+		states[name] = "running"
+		if pipeline.Paused() {
+			states[name] = "paused"
+		}
+	}
+	return states
+}
+
+// pipelineSummary is the status of a pipeline listed by /pipelines
+type pipelineSummary struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	etl.PipelineStatus
+	*database.RunSummary
+}
+
+// pipelinesHandler lists the pipelines with their state, schedule and next run,
+// and the runs of the last 24 hours by status with the last run and failure,
+// e.g. GET /pipelines
+func (s *Server) pipelinesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	states := s.pipelineStates()
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	summaries, err := s.db.RunSummaries(r.Context(), time.Now().Add(-24*time.Hour))
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to query pipeline runs: %v", err))
+		http.Error(w, "failed to query pipeline runs", http.StatusInternalServerError)
+		return
+	}
+	pipelines := make([]pipelineSummary, 0, len(names))
+	for _, name := range names {
+		summary := pipelineSummary{
+			Name:           name,
+			State:          states[name],
+			PipelineStatus: s.pipelines[name].Status(),
+			RunSummary:     summaries[name],
+		}
+		if summary.RunSummary == nil {
+			summary.RunSummary = &database.RunSummary{Runs: map[string]int{}}
+		}
+		pipelines = append(pipelines, summary)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pipelines": pipelines,
+	})
+}
+
+// pipelineControlHandler pauses or resumes a pipeline, e.g. POST /pipelines/orders/pause.
+// Pausing lets a running cycle finish; batches posted to /ingest are still loaded.
+func (s *Server) pipelineControlHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.PathValue("name")
+	pipeline, ok := s.pipelines[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("pipeline %s not found", name), http.StatusNotFound)
+		return
+	}
+
+	var changed bool
+	switch action := r.PathValue("action"); action {
+	case "pause":
+		changed = pipeline.Pause()
+	case "resume":
+		changed = pipeline.Resume()
+	default:
+		http.Error(w, fmt.Sprintf("unknown action %s, expected pause or resume", action), http.StatusNotFound)
+		return
+	}
+	if changed {
+		s.logger.Info(fmt.Sprintf("Pipeline %s %sd via API", name, r.PathValue("action")))
+	}
+
+	state := "running"
+	if pipeline.Paused() {
+		state = "paused"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pipeline": name,
+		"state":    state,
+		"changed":  changed,
+	})
+}
+
+// dryRunHandler extracts and transforms a batch without writing it and returns
+// what the cycle would have written, e.g. POST /pipelines/default/dry-run
+func (s *Server) dryRunHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.PathValue("name")
+	pipeline, ok := s.pipelines[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("pipeline %s not found", name), http.StatusNotFound)
+		return
+	}
+
+	summary, err := pipeline.DryRun(r.Context())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Dry run of pipeline %s failed: %v", name, err))
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
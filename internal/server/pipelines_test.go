@@ -0,0 +1,116 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+func TestPipelineControl(t *testing.T) {
+	pipeline := &fakePipeline{}
+	s := newTestServer(t, &fakeStore{}, pipeline)
+
+	for _, step := range []struct {
+		action  string
+		state   string
+		changed bool
+	}{
+		{"pause", "paused", true},
+		{"pause", "paused", false},
+		{"resume", "running", true},
+		{"resume", "running", false},
+	} {
+		rec := serve(s, http.MethodPost, "/pipelines/default/"+step.action, "", nil)
+		body := decode(t, rec)
+		if rec.Code != http.StatusOK || body["pipeline"] != "default" || body["state"] != step.state || body["changed"] != step.changed {
+			t.Errorf("%s: expected state %s and changed %v, got %d %v", step.action, step.state, step.changed, rec.Code, body)
+		}
+	}
+
+	for target, want := range map[string]int{
+		"/pipelines/missing/pause": http.StatusNotFound,
+		"/pipelines/default/stop":  http.StatusNotFound,
+	} {
+		if rec := serve(s, http.MethodPost, target, "", nil); rec.Code != want {
+			t.Errorf("POST %s: expected %d, got %d", target, want, rec.Code)
+		}
+	}
+	if rec := serve(s, http.MethodGet, "/pipelines/default/pause", "", nil); rec.Code != http.StatusMethodNotAllowed || pipeline.paused {
+		t.Errorf("Expected GET not to pause the pipeline, got %d", rec.Code)
+	}
+}
+
+func TestPipelines(t *testing.T) {
+	store := &fakeStore{}
+	s := newTestServer(t, store, &fakePipeline{paused: true})
+
+	rec := serve(s, http.MethodGet, "/pipelines", "", nil)
+	pipelines, _ := decode(t, rec)["pipelines"].([]interface{})
+	if rec.Code != http.StatusOK || len(pipelines) != 1 {
+		t.Fatalf("Expected one pipeline, got %d %v", rec.Code, pipelines)
+	}
+	if pipeline := pipelines[0].(map[string]interface{}); pipeline["name"] != "default" || pipeline["state"] != "paused" {
+		t.Errorf("Expected the paused default pipeline, got %v", pipeline)
+	}
+
+	store.err = errors.New("connection refused")
+	if rec := serve(s, http.MethodGet, "/pipelines", "", nil); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 when the runs cannot be queried, got %d", rec.Code)
+	}
+}
+
+func TestRuns(t *testing.T) {
+	store := &fakeStore{runs: []database.PipelineRun{
+		{RunID: "b2", Pipeline: "default", Status: database.RunFailed},
+		{RunID: "a1", Pipeline: "default", Status: database.RunSucceeded},
+	}}
+	s := newTestServer(t, store, &fakePipeline{})
+
+	rec := serve(s, http.MethodGet, "/runs", "", nil)
+	if runs, _ := decode(t, rec)["runs"].([]interface{}); rec.Code != http.StatusOK || len(runs) != 2 || store.limit != 20 {
+		t.Errorf("Expected the last 20 runs, got %d %v with limit %d", rec.Code, runs, store.limit)
+	}
+	serve(s, http.MethodGet, "/runs?limit=500", "", nil)
+	if store.limit != maxRuns {
+		t.Errorf("Expected the limit capped at %d, got %d", maxRuns, store.limit)
+	}
+
+	rec = serve(s, http.MethodGet, "/runs?run_id=a1", "", nil)
+	if runs, _ := decode(t, rec)["runs"].([]interface{}); rec.Code != http.StatusOK || len(runs) != 1 || store.runID != "a1" {
+		t.Errorf("Expected the run of run_id, got %d %v", rec.Code, runs)
+	}
+	rec = serve(s, http.MethodGet, "/runs/b2", "", nil)
+	if body := decode(t, rec); rec.Code != http.StatusOK || body["run_id"] != "b2" {
+		t.Errorf("Expected the run by its path, got %d %v", rec.Code, body)
+	}
+
+	rec = serve(s, http.MethodGet, "/pipelines/default/runs?status=failed&limit=5", "", nil)
+	if body := decode(t, rec); rec.Code != http.StatusOK || body["pipeline"] != "default" || store.pipeline != "default" || store.status != database.RunFailed || store.limit != 5 {
+		t.Errorf("Expected the failed runs of the pipeline, got %d %v", rec.Code, body)
+	}
+
+	for target, want := range map[string]int{
+		"/runs?limit=0":                     http.StatusBadRequest,
+		"/runs?limit=ten":                   http.StatusBadRequest,
+		"/runs?run_id=missing":              http.StatusNotFound,
+		"/runs/missing":                     http.StatusNotFound,
+		"/pipelines/default/runs?status=ok": http.StatusBadRequest,
+		"/pipelines/missing/runs":           http.StatusNotFound,
+	} {
+		if rec := serve(s, http.MethodGet, target, "", nil); rec.Code != want {
+			t.Errorf("GET %s: expected %d, got %d", target, want, rec.Code)
+		}
+	}
+	if rec := serve(s, http.MethodPost, "/runs", "", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected POST /runs to be rejected, got %d", rec.Code)
+	}
+
+	store.err = errors.New("connection refused")
+	for _, target := range []string{"/runs", "/runs/a1", "/pipelines/default/runs"} {
+		if rec := serve(s, http.MethodGet, target, "", nil); rec.Code != http.StatusInternalServerError {
+			t.Errorf("GET %s: expected 500 when the runs cannot be queried, got %d", target, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/etl"
+)
+
+// maxPreviewBytes bounds the body of a transform preview
+const maxPreviewBytes = 1 << 20
+
+// transformPreviewHandler transforms a sample of raw records with the field mapping
+// of a pipeline and returns every processed record, change and rejection without
+// writing anything, e.g. POST /transform/preview?pipeline=orders with
+// {"records": [...]} or {"fetch": 10}, and "field_sources" to try another mapping
+func (s *Server) transformPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("pipeline")
+	if name == "" {
+		name = "default"
+	}
+	pipeline, ok := s.pipelines[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("pipeline %s not found", name), http.StatusNotFound)
+		return
+	}
+
+	var req etl.PreviewRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPreviewBytes)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid preview request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	preview, err := pipeline.PreviewTransform(r.Context(), req)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Transform preview of pipeline %s failed: %v", name, err))
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
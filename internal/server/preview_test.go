@@ -0,0 +1,46 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+func TestTransformPreview(t *testing.T) {
+	pipeline := &fakePipeline{preview: &transform.Preview{Transformed: 1, Records: []transform.PreviewRecord{{Index: 0}}}}
+	s := newTestServer(t, &fakeStore{}, pipeline)
+
+	rec := serve(s, http.MethodPost, "/transform/preview", `{"records": [{"userId": 1, "title": "a"}], "field_sources": {"title": "name"}}`, nil)
+	if body := decode(t, rec); rec.Code != http.StatusOK || body["transformed"] != float64(1) {
+		t.Errorf("Expected the preview of the sample, got %d %v", rec.Code, body)
+	}
+	if len(pipeline.previewReq.Records) != 1 || pipeline.previewReq.FieldSources["title"] != "name" {
+		t.Errorf("Expected the sample and mapping to be passed to the pipeline, got %+v", pipeline.previewReq)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"GET", http.MethodGet, "/transform/preview", "", http.StatusMethodNotAllowed},
+		{"unknown pipeline", http.MethodPost, "/transform/preview?pipeline=orders", `{"fetch": 5}`, http.StatusNotFound},
+		{"invalid JSON", http.MethodPost, "/transform/preview", `{"records": `, http.StatusBadRequest},
+		{"no sample", http.MethodPost, "/transform/preview", `{}`, http.StatusBadRequest},
+		{"records and fetch", http.MethodPost, "/transform/preview", `{"records": [{"userId": 1}], "fetch": 5}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := serve(s, tt.method, tt.target, tt.body, nil); rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, rec.Code)
+		}
+	}
+
+	pipeline.previewErr = errors.New("source unavailable")
+	if rec := serve(s, http.MethodPost, "/transform/preview", `{"fetch": 5}`, nil); rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 when the sample cannot be fetched, got %d", rec.Code)
+	}
+}
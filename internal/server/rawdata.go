@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/etl"
+)
+
+// maxRawDataMatches bounds the raw records returned by /data/raw
+const maxRawDataMatches = 100
+
+// rawDataHandler searches the stored raw records by their payload, newest first,
+// e.g. GET /data/raw?query=data->>'userId'=1&from=2025-10-01. Records are further
+// selected by from/to and run_id, and paged through with before_id.
+func (s *Server) rawDataHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("query") == "" {
+		http.Error(w, "query is required", http.StatusBadRequest)
+		return
+	}
+	path, err := database.ParseRawQuery(query.Get("query"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid query: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	filter := database.RawDataFilter{RunID: query.Get("run_id")}
+	if value := query.Get("from"); value != "" {
+		if filter.From, err = etl.ParseBound(value, false); err != nil {
+			http.Error(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if filter.To, err = etl.ParseBound(value, true); err != nil {
+			http.Error(w, fmt.Sprintf("invalid to: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	var beforeID int64
+	if value := query.Get("before_id"); value != "" {
+		if beforeID, err = strconv.ParseInt(value, 10, 64); err != nil || beforeID < 1 {
+			http.Error(w, "before_id must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := maxRawDataMatches
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxRawDataMatches)
+	}
+
+	matches, err := s.db.SearchRawData(r.Context(), path, filter, beforeID, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to search raw data: %v", err))
+		http.Error(w, "failed to search raw data", http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"query":     query.Get("query"),
+		"json_path": path,
+		"records":   matches,
+	}
+	if matches == nil {
+		response["records"] = []database.RawDataMatch{}
+	}
+	// A full page may be followed by older matches
+	if len(matches) == limit {
+		response["next_before_id"] = matches[len(matches)-1].ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
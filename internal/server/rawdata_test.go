@@ -0,0 +1,58 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+func TestRawData(t *testing.T) {
+	store := &fakeStore{matches: []database.RawDataMatch{{ID: 42}, {ID: 17}}}
+	s := newTestServer(t, store, &fakePipeline{})
+	query := "/data/raw?query=" + url.QueryEscape("data->>'userId'=1")
+
+	rec := serve(s, http.MethodGet, query+"&run_id=a1&from=2025-10-01&before_id=50", "", nil)
+	body := decode(t, rec)
+	if records, _ := body["records"].([]interface{}); rec.Code != http.StatusOK || len(records) != 2 {
+		t.Fatalf("Expected the matching records, got %d %v", rec.Code, body)
+	}
+	if store.path != `$."userId" == 1` || store.filter.RunID != "a1" || store.filter.From.IsZero() || store.beforeID != 50 || store.limit != maxRawDataMatches {
+		t.Errorf("Expected the parsed query and filter to be searched, got %q %+v before %d limit %d", store.path, store.filter, store.beforeID, store.limit)
+	}
+	if _, ok := body["next_before_id"]; ok {
+		t.Errorf("Expected no next page after a partial page, got %v", body["next_before_id"])
+	}
+
+	rec = serve(s, http.MethodGet, query+"&limit=2", "", nil)
+	if body := decode(t, rec); body["next_before_id"] != float64(17) {
+		t.Errorf("Expected the next page to start below the last match, got %v", body["next_before_id"])
+	}
+	serve(s, http.MethodGet, query+"&limit=500", "", nil)
+	if store.limit != maxRawDataMatches {
+		t.Errorf("Expected the limit capped at %d, got %d", maxRawDataMatches, store.limit)
+	}
+
+	for name, target := range map[string]string{
+		"missing query":     "/data/raw",
+		"invalid query":     "/data/raw?query=" + url.QueryEscape("userId; DROP TABLE raw_data"),
+		"invalid from":      query + "&from=yesterday",
+		"invalid to":        query + "&to=2025-13-01",
+		"invalid before_id": query + "&before_id=0",
+		"invalid limit":     query + "&limit=-1",
+	} {
+		if rec := serve(s, http.MethodGet, target, "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rec.Code)
+		}
+	}
+	if rec := serve(s, http.MethodPost, query, "", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected POST to be rejected, got %d", rec.Code)
+	}
+
+	store.err = errors.New("connection refused")
+	if rec := serve(s, http.MethodGet, query, "", nil); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 when the search fails, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Reloader re-reads and validates the configuration and applies it to the running
+// pipelines, leaving them unchanged when it is invalid
+type Reloader interface {
+	Reload() (*ReloadResult, error)
+}
+
+// ReloadResult describes what a configuration reload changed
+type ReloadResult struct {
+	// Applied lists the changes applied to running pipelines
+	Applied []string `json:"applied"`
+	// RestartRequired lists changed settings that only take effect after a restart
+	RestartRequired []string `json:"restart_required,omitempty"`
+}
+
+// SetReloader enables POST /admin/reload
+func (s *Server) SetReloader(reloader Reloader) {
+	s.reloader = reloader
+}
+
+// reloadHandler reloads the configuration, e.g. POST /admin/reload. An invalid
+// configuration is rejected with 422 and the running one kept.
+func (s *Server) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.reloader == nil {
+		http.Error(w, "configuration reload not enabled", http.StatusNotFound)
+		return
+	}
+	result, err := s.reloader.Reload()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("configuration not reloaded: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	s.logger.Info("Configuration reloaded via API")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
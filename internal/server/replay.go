@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/etl"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+)
+
+// replayHandler runs stored raw records through the transformer and sinks of a
+// pipeline again, e.g. POST /pipelines/default/replay?from=2023-01-01&to=2023-01-31.
+// Records are selected by from_id/to_id, from/to and run_id; the replay runs in the
+// background and its run is reported by GET /runs?run_id=<run_id>.
+func (s *Server) replayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.PathValue("name")
+	pipeline, ok := s.pipelines[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("pipeline %s not found", name), http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	req := etl.ReplayRequest{ID: runid.New()}
+	req.RunID = query.Get("run_id")
+	var err error
+	for param, target := range map[string]*int64{"from_id": &req.FromID, "to_id": &req.ToID} {
+		if value := query.Get(param); value != "" {
+			if *target, err = strconv.ParseInt(value, 10, 64); err != nil || *target < 1 {
+				http.Error(w, fmt.Sprintf("%s must be a positive integer", param), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if value := query.Get("from"); value != "" {
+		if req.From, err = etl.ParseBound(value, false); err != nil {
+			http.Error(w, fmt.Sprintf("invalid from: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if req.To, err = etl.ParseBound(value, true); err != nil {
+			http.Error(w, fmt.Sprintf("invalid to: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("batch_size"); value != "" {
+		if req.BatchSize, err = strconv.Atoi(value); err != nil || req.BatchSize < 1 {
+			http.Error(w, "batch_size must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if pipeline.DryRunMode() {
+		http.Error(w, etl.ErrDryRun.Error(), http.StatusConflict)
+		return
+	}
+
+	// The replay outlives the request and stops with the server
+	go func() {
+		if _, err := pipeline.Replay(s.background, req); err != nil {
+			s.logger.Error(fmt.Sprintf("Replay %s of pipeline %s failed: %v", req.ID, name, err))
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"run_id": req.ID,
+		"filter": req.RawDataFilter.String(),
+	})
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// retentionReportHandler returns a dry-run report of what the retention policy would delete
+func (s *Server) retentionReportHandler(w http.ResponseWriter, r *http.Request) {
+	if s.retention == nil {
+		http.Error(w, "retention policy not configured", http.StatusNotFound)
+		return
+	}
+
+	report := s.retention.Run(r.Context(), true)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// retentionEnforceHandler applies the retention policy and returns what was deleted
+func (s *Server) retentionEnforceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.retention == nil {
+		http.Error(w, "retention policy not configured", http.StatusNotFound)
+		return
+	}
+
+	s.logger.Info("Retention enforcement requested via API")
+	report := s.retention.Run(r.Context(), false)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
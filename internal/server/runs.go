@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+// maxRuns bounds the runs returned by /runs and /pipelines/{name}/runs
+const maxRuns = 100
+
+// runsHandler returns the most recent pipeline runs, newest first, e.g.
+// GET /runs?limit=10, or a single run with GET /runs?run_id=3f2a9c0e7b1d4e6f
+func (s *Server) runsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit, ok := runsLimit(w, r)
+	if !ok {
+		return
+	}
+	runID := r.URL.Query().Get("run_id")
+
+	runs, err := s.db.PipelineRuns(r.Context(), runID, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to query pipeline runs: %v", err))
+		http.Error(w, "failed to query pipeline runs", http.StatusInternalServerError)
+		return
+	}
+	if runID != "" && len(runs) == 0 {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	if runs == nil {
+		runs = []database.PipelineRun{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"runs": runs,
+	})
+}
+
+// pipelineRunsHandler returns the most recent runs of a pipeline, newest first,
+// e.g. GET /pipelines/orders/runs?limit=10&status=failed
+func (s *Server) pipelineRunsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.PathValue("name")
+	if _, ok := s.pipelines[name]; !ok {
+		http.Error(w, fmt.Sprintf("pipeline %s not found", name), http.StatusNotFound)
+		return
+	}
+	limit, ok := runsLimit(w, r)
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", database.RunRunning, database.RunSucceeded, database.RunPartial, database.RunFailed:
+	default:
+		http.Error(w, fmt.Sprintf("unknown status %s", status), http.StatusBadRequest)
+		return
+	}
+
+	runs, err := s.db.PipelineRunsOf(r.Context(), name, status, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to query runs of pipeline %s: %v", name, err))
+		http.Error(w, "failed to query pipeline runs", http.StatusInternalServerError)
+		return
+	}
+	if runs == nil {
+		runs = []database.PipelineRun{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pipeline": name,
+		"runs":     runs,
+	})
+}
+
+// runHandler returns a single run, e.g. GET /runs/3f2a9c0e7b1d4e6f
+func (s *Server) runHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	runs, err := s.db.PipelineRuns(r.Context(), r.PathValue("id"), 1)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to query pipeline runs: %v", err))
+		http.Error(w, "failed to query pipeline runs", http.StatusInternalServerError)
+		return
+	}
+	if len(runs) == 0 {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs[0])
+}
+
+// runExpectationsHandler downloads the data-quality expectation results of a run as
+// a Great Expectations validation result, e.g. GET /runs/3f2a9c0e7b1d4e6f/expectations
+func (s *Server) runExpectationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	runID := r.PathValue("id")
+	result, found, err := s.db.RunExpectations(r.Context(), runID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to query expectation results: %v", err))
+		http.Error(w, "failed to query expectation results", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	if result == nil {
+		http.Error(w, "run has no expectation results", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runID+"-expectations.json"))
+	w.Write(result)
+}
+
+// runsLimit parses the limit parameter of run listings, writing the error response
+// if it is invalid
+func runsLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return 0, false
+		}
+		limit = min(n, maxRuns)
+	}
+	return limit, true
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// schemaDocument describes the processed schema contract served at /schema
+type schemaDocument struct {
+	Table       string            `json:"table"`
+	Version     string            `json:"version"`
+	Fields      []transform.Field `json:"fields"`
+	Rules       []transform.Rule  `json:"rules"`
+	GeneratedAt string            `json:"generated_at"`
+}
+
+var schemaTemplate = template.Must(template.New("schema").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Table}} schema</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: left; }
+th { background: #f0f0f0; }
+</style>
+</head>
+<body>
+<h1>{{.Table}}</h1>
+<p>Schema version {{.Version}}, generated at {{.GeneratedAt}}</p>
+<h2>Fields</h2>
+<table>
+<tr><th>Column</th><th>Source field</th><th>Type</th><th>Required</th><th>Trimmed</th><th>Description</th></tr>
+{{range .Fields}}<tr><td>{{.Name}}</td><td>{{.Source}}</td><td>{{.Type}}</td><td>{{.Required}}</td><td>{{.Trim}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>
+<h2>Quality rules</h2>
+<table>
+<tr><th>Column</th><th>Rule</th></tr>
+{{range .Rules}}<tr><td>{{.Field}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// schemaHandler serves the live processed schema as JSON, or HTML for browsers
+func (s *Server) schemaHandler(w http.ResponseWriter, r *http.Request) {
+	doc := schemaDocument{
+		Table:       "processed_data",
+		Version:     transform.SchemaVersion(),
+		Fields:      transform.Fields,
+		Rules:       transform.Rules(),
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		format = "html"
+	}
+
+	if format == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		schemaTemplate.Execute(w, doc)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
@@ -5,34 +5,96 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/httpauth"
 	"github.com/mohammedhassan/etl-pipeline/internal/logging"
 	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/mohammedhassan/etl-pipeline/internal/retention"
+	"github.com/mohammedhassan/etl-pipeline/internal/version"
 )
 
+// Store is the database the server checks and queries, a *database.PostgresDB
+type Store interface {
+	HealthCheck() error
+	HasReplica() bool
+	ReplicaHealthCheck() error
+	PipelineRuns(ctx context.Context, runID string, limit int) ([]database.PipelineRun, error)
+	PipelineRunsOf(ctx context.Context, pipeline, status string, limit int) ([]database.PipelineRun, error)
+	RunSummaries(ctx context.Context, since time.Time) (map[string]*database.RunSummary, error)
+	RunExpectations(ctx context.Context, runID string) (json.RawMessage, bool, error)
+	BackfillRuns(ctx context.Context, backfillID string) ([]database.PipelineRun, error)
+	SearchRawData(ctx context.Context, path string, filter database.RawDataFilter, beforeID int64, limit int) ([]database.RawDataMatch, error)
+	TransformAudits(ctx context.Context, sourceID string, limit int) ([]database.RecordAudit, error)
+}
+
 // Server represents the HTTP server
 type Server struct {
-	port    string
-	db      *database.PostgresDB
-	logger  *logging.Logger
-	metrics *metrics.Metrics
-	server  *http.Server
+	port      string
+	db        Store
+	logger    *logging.Logger
+	metrics   *metrics.Metrics
+	retention *retention.Engine
+	ingester  Ingester
+	pipelines map[string]PipelineController
+	freshness map[string]FreshnessReporter
+	reloader  Reloader
+	// caches are the Redis servers of the pipelines, by pipeline name
+	caches map[string]Pinger
+	// auth guards the endpoints, if set
+	auth       *httpauth.Authenticator
+	middleware MiddlewareConfig
+	server     *http.Server
+	// background bounds work started by requests that outlives them, e.g. backfills
+	background       context.Context
+	cancelBackground context.CancelFunc
 }
 
 // NewServer creates a new HTTP server
-func NewServer(port string, db *database.PostgresDB, logger *logging.Logger, metrics *metrics.Metrics) *Server {
+func NewServer(port string, db Store, logger *logging.Logger, metrics *metrics.Metrics, retention *retention.Engine, ingester Ingester) *Server {
+	background, cancelBackground := context.WithCancel(context.Background())
 	return &Server{
-		port:    port,
-		db:      db,
-		logger:  logger,
-		metrics: metrics,
+		port:             port,
+		db:               db,
+		logger:           logger,
+		metrics:          metrics,
+		retention:        retention,
+		ingester:         ingester,
+		background:       background,
+		cancelBackground: cancelBackground,
 	}
 }
 
+// Pinger is a service whose health the server reports
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// SetCaches reports the health of the Redis server of each pipeline using one, by
+// pipeline name
+func (s *Server) SetCaches(caches map[string]Pinger) {
+	s.caches = caches
+}
+
+// SetAuthenticator requires the credentials of the read-only role for GET requests
+// and of the control role for the others
+func (s *Server) SetAuthenticator(auth *httpauth.Authenticator) {
+	s.auth = auth
+}
+
 // Start starts the HTTP server
 func (s *Server) Start() error {
+	s.server = &http.Server{
+		Addr:    ":" + s.port,
+		Handler: s.routes(),
+	}
+
+	return s.server.ListenAndServe()
+}
+
+// routes returns the endpoints wrapped in the middleware
+func (s *Server) routes() http.Handler {
 	mux := http.NewServeMux()
 
 	// Health check endpoint
@@ -41,19 +103,60 @@ func (s *Server) Start() error {
 	// Readiness check endpoint
 	mux.HandleFunc("/ready", s.readyHandler)
 
-	// Metrics endpoint (Prometheus)
-	mux.Handle("/metrics", promhttp.Handler())
+	// Build of the running binary
+	mux.HandleFunc("/version", s.versionHandler)
 
-	s.server = &http.Server{
-		Addr:    ":" + s.port,
-		Handler: mux,
-	}
+	// Processed schema documentation
+	mux.HandleFunc("/schema", s.schemaHandler)
 
-	return s.server.ListenAndServe()
+	// OpenAPI document of the API and Swagger UI
+	mux.HandleFunc("/openapi.json", s.openAPIHandler)
+	mux.HandleFunc("/docs", s.docsHandler)
+
+	// Retention policy report and enforcement
+	mux.HandleFunc("/retention/report", s.retentionReportHandler)
+	mux.HandleFunc("/retention/enforce", s.retentionEnforceHandler)
+
+	// Pipeline run history
+	mux.HandleFunc("/runs", s.runsHandler)
+	mux.HandleFunc("/runs/{id}", s.runHandler)
+	mux.HandleFunc("/runs/{id}/expectations", s.runExpectationsHandler)
+
+	// Transformation audit trail of a source record
+	mux.HandleFunc("/audit", s.auditHandler)
+
+	// Search of the stored raw records by their payload
+	mux.HandleFunc("/data/raw", s.rawDataHandler)
+
+	// Batch handoff from other instances or tools
+	mux.HandleFunc("/ingest", s.ingestHandler)
+
+	// Pipeline status, run history and pause/resume control
+	mux.HandleFunc("/pipelines", s.pipelinesHandler)
+	mux.HandleFunc("/pipelines/{name}/{action}", s.pipelineControlHandler)
+	mux.HandleFunc("/pipelines/{name}/backfill", s.backfillHandler)
+	mux.HandleFunc("/pipelines/{name}/dry-run", s.dryRunHandler)
+	mux.HandleFunc("/pipelines/{name}/replay", s.replayHandler)
+	mux.HandleFunc("/pipelines/{name}/runs", s.pipelineRunsHandler)
+
+	// Transformation of a sample, e.g. to try a field mapping
+	mux.HandleFunc("/transform/preview", s.transformPreviewHandler)
+
+	// Freshness of each pipeline's data against its objective
+	mux.HandleFunc("/slo", s.sloHandler)
+
+	// Configuration reload without a restart
+	mux.HandleFunc("/admin/reload", s.reloadHandler)
+
+	// Metrics endpoint (Prometheus)
+	mux.Handle("/metrics", s.metrics.Handler())
+
+	return s.handler(mux)
 }
 
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.cancelBackground()
 	return s.server.Shutdown(ctx)
 }
 
@@ -74,6 +177,31 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 		response["database"] = "healthy"
 		w.WriteHeader(http.StatusOK)
 	}
+	// The pipelines do not use the replica, so it only degrades the query API
+	if s.db.HasReplica() {
+		response["database_replica"] = "healthy"
+		if err := s.db.ReplicaHealthCheck(); err != nil {
+			s.logger.Error(fmt.Sprintf("Health check failed: read replica unhealthy: %v", err))
+			response["database_replica"] = "unhealthy"
+		}
+	}
+	// Without its cache a pipeline looks everything up and loads every record, so
+	// an unhealthy cache is reported but does not make the service unhealthy
+	if len(s.caches) > 0 {
+		caches := make(map[string]string, len(s.caches))
+		for name, cache := range s.caches {
+			caches[name] = "healthy"
+			if err := cache.Ping(r.Context()); err != nil {
+				s.logger.Error(fmt.Sprintf("Health check failed: cache of pipeline %s unhealthy: %v", name, err))
+				caches[name] = "unhealthy"
+			}
+		}
+		response["caches"] = caches
+	}
+	// Paused pipelines are reported but do not make the service unhealthy
+	if len(s.pipelines) > 0 {
+		response["pipelines"] = s.pipelineStates()
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -97,3 +225,13 @@ func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// versionHandler returns the build of the running binary, e.g. GET /version
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.Get())
+}
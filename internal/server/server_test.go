@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/etl"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// fakeStore answers the queries of the server from runs and matches, or fails them
+// with err, recording the arguments of the last query
+type fakeStore struct {
+	err       error
+	healthErr error
+	runs      []database.PipelineRun
+	matches   []database.RawDataMatch
+
+	runID    string
+	pipeline string
+	status   string
+	limit    int
+	path     string
+	filter   database.RawDataFilter
+	beforeID int64
+}
+
+func (f *fakeStore) HealthCheck() error        { return f.healthErr }
+func (f *fakeStore) HasReplica() bool          { return false }
+func (f *fakeStore) ReplicaHealthCheck() error { return nil }
+
+func (f *fakeStore) PipelineRuns(ctx context.Context, runID string, limit int) ([]database.PipelineRun, error) {
+	f.runID, f.limit = runID, limit
+	if runID != "" {
+		for _, run := range f.runs {
+			if run.RunID == runID {
+				return []database.PipelineRun{run}, f.err
+			}
+		}
+		return nil, f.err
+	}
+	return f.runs, f.err
+}
+
+func (f *fakeStore) PipelineRunsOf(ctx context.Context, pipeline, status string, limit int) ([]database.PipelineRun, error) {
+	f.pipeline, f.status, f.limit = pipeline, status, limit
+	return f.runs, f.err
+}
+
+func (f *fakeStore) RunSummaries(ctx context.Context, since time.Time) (map[string]*database.RunSummary, error) {
+	return nil, f.err
+}
+
+func (f *fakeStore) RunExpectations(ctx context.Context, runID string) (json.RawMessage, bool, error) {
+	return nil, false, f.err
+}
+
+func (f *fakeStore) BackfillRuns(ctx context.Context, backfillID string) ([]database.PipelineRun, error) {
+	return nil, f.err
+}
+
+func (f *fakeStore) SearchRawData(ctx context.Context, path string, filter database.RawDataFilter, beforeID int64, limit int) ([]database.RawDataMatch, error) {
+	f.path, f.filter, f.beforeID, f.limit = path, filter, beforeID, limit
+	return f.matches, f.err
+}
+
+func (f *fakeStore) TransformAudits(ctx context.Context, sourceID string, limit int) ([]database.RecordAudit, error) {
+	return nil, f.err
+}
+
+// fakePipeline is a pipeline that is paused and resumed in memory and previews
+// transformations with preview, or fails them with previewErr
+type fakePipeline struct {
+	paused     bool
+	preview    *transform.Preview
+	previewErr error
+	previewReq etl.PreviewRequest
+}
+
+func (p *fakePipeline) Pause() bool {
+	changed := !p.paused
+	p.paused = true
+	return changed
+}
+
+func (p *fakePipeline) Resume() bool {
+	changed := p.paused
+	p.paused = false
+	return changed
+}
+
+func (p *fakePipeline) Paused() bool { return p.paused }
+
+func (p *fakePipeline) Status() etl.PipelineStatus { return etl.PipelineStatus{Paused: p.paused} }
+
+func (p *fakePipeline) PlanBackfill(ctx context.Context, req etl.BackfillRequest) (*etl.Backfill, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *fakePipeline) RunBackfill(ctx context.Context, backfill *etl.Backfill) error { return nil }
+
+func (p *fakePipeline) DryRun(ctx context.Context) (*etl.DryRunSummary, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *fakePipeline) DryRunMode() bool { return false }
+
+func (p *fakePipeline) Replay(ctx context.Context, req etl.ReplayRequest) (*database.PipelineRun, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *fakePipeline) PreviewTransform(ctx context.Context, req etl.PreviewRequest) (*transform.Preview, error) {
+	p.previewReq = req
+	return p.preview, p.previewErr
+}
+
+// newTestServer creates a server on store with a single pipeline, default
+func newTestServer(t *testing.T, store *fakeStore, pipeline *fakePipeline) *Server {
+	logger, _ := logging.NewLogger("test.log")
+	t.Cleanup(func() { logger.Close() })
+	s := NewServer("0", store, logger, metrics.NewMetrics(), nil, nil)
+	s.SetPipelines(map[string]PipelineController{"default": pipeline})
+	return s
+}
+
+// serve sends a request to the endpoints of s, with the headers in header
+func serve(s *Server, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+// decode decodes the JSON body of a response
+func decode(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected a JSON response, got %q: %v", rec.Body.String(), err)
+	}
+	return body
+}
+
+// failingCache is a cache whose server is down
+type failingCache struct{}
+
+func (failingCache) Ping(ctx context.Context) error { return errors.New("connection refused") }
+
+func TestHealth(t *testing.T) {
+	store := &fakeStore{}
+	s := newTestServer(t, store, &fakePipeline{paused: true})
+	s.SetCaches(map[string]Pinger{"default": failingCache{}})
+
+	rec := serve(s, http.MethodGet, "/health", "", nil)
+	body := decode(t, rec)
+	if rec.Code != http.StatusOK || body["status"] != "healthy" || body["database"] != "healthy" {
+		t.Errorf("Expected a healthy service, got %d %v", rec.Code, body)
+	}
+	if pipelines, _ := body["pipelines"].(map[string]interface{}); pipelines["default"] != "paused" {
+		t.Errorf("Expected the paused pipeline to be reported, got %v", body["pipelines"])
+	}
+	if caches, _ := body["caches"].(map[string]interface{}); caches["default"] != "unhealthy" {
+		t.Errorf("Expected the unhealthy cache to be reported, got %v", body["caches"])
+	}
+
+	store.healthErr = errors.New("connection refused")
+	rec = serve(s, http.MethodGet, "/health", "", nil)
+	if body := decode(t, rec); rec.Code != http.StatusServiceUnavailable || body["database"] != "unhealthy" {
+		t.Errorf("Expected 503 without the database, got %d %v", rec.Code, body)
+	}
+	rec = serve(s, http.MethodGet, "/ready", "", nil)
+	if body := decode(t, rec); rec.Code != http.StatusServiceUnavailable || body["status"] != "not ready" {
+		t.Errorf("Expected the service not to be ready without the database, got %d %v", rec.Code, body)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	s := newTestServer(t, &fakeStore{}, &fakePipeline{})
+
+	rec := serve(s, http.MethodGet, "/schema", "", nil)
+	body := decode(t, rec)
+	fields, _ := body["fields"].([]interface{})
+	if rec.Code != http.StatusOK || body["table"] != "processed_data" || body["version"] != transform.SchemaVersion() || len(fields) != len(transform.Fields) {
+		t.Errorf("Expected the processed schema as JSON, got %d %v", rec.Code, body)
+	}
+
+	for _, header := range []map[string]string{{"Accept": "text/html,application/xhtml+xml"}, nil} {
+		target := "/schema"
+		if header == nil {
+			target = "/schema?format=html"
+		}
+		rec = serve(s, http.MethodGet, target, "", header)
+		if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") || !strings.Contains(rec.Body.String(), "<h1>processed_data</h1>") {
+			t.Errorf("%s: expected the schema as HTML, got %q", target, rec.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/slo"
+)
+
+// FreshnessReporter reports the freshness of a pipeline's processed data
+type FreshnessReporter interface {
+	Status() slo.Status
+}
+
+// SetFreshness enables /slo for the pipelines by name
+func (s *Server) SetFreshness(freshness map[string]FreshnessReporter) {
+	s.freshness = freshness
+}
+
+// sloHandler returns the freshness of each pipeline against its objective, e.g.
+// GET /slo. The status is breached when any pipeline breaches its objective.
+func (s *Server) sloHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	names := make([]string, 0, len(s.freshness))
+	for name := range s.freshness {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	overall := slo.StateMet
+	pipelines := make([]slo.Status, 0, len(names))
+	for _, name := range names {
+		status := s.freshness[name].Status()
+		status.Pipeline = name
+		if status.Breached() {
+			overall = slo.StateBreached
+		}
+		pipelines = append(pipelines, status)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    overall,
+		"pipelines": pipelines,
+	})
+}
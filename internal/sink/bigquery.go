@@ -0,0 +1,475 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/oauth"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+const (
+	bigQueryEndpoint      = "https://bigquery.googleapis.com/bigquery/v2"
+	bigQueryWriteEndpoint = "bigquerystorage.googleapis.com:443"
+	bigQueryScope         = "https://www.googleapis.com/auth/bigquery"
+
+	// bigQueryMaxRows bounds the rows of one append, keeping requests well under
+	// the 10MB limit of the Storage Write API
+	bigQueryMaxRows = 500
+
+	// bigQueryStreamTTL is how long the write stream of a batch not fully written
+	// is kept for a retry
+	bigQueryStreamTTL = time.Hour
+)
+
+// BigQueryConfig holds the settings for the BigQuery sink
+type BigQueryConfig struct {
+	ProjectID       string
+	Dataset         string
+	Table           string
+	CredentialsFile string
+	// ColumnMap renames processed fields to BigQuery columns (field name -> column name)
+	ColumnMap map[string]string
+}
+
+// BigQuerySink streams processed records into a BigQuery table with the Storage
+// Write API
+type BigQuerySink struct {
+	cfg BigQueryConfig
+	// endpoint and httpClient serve the REST API, which creates the table
+	endpoint   string
+	httpClient *http.Client
+	// conn serves the Storage Write API, which appends the rows
+	conn    *grpc.ClientConn
+	logger  *logging.Logger
+	metrics *metrics.Metrics
+
+	// tableMu guards tableReady, so concurrent batches create the table once
+	tableMu    sync.Mutex
+	tableReady bool
+
+	// streamsMu guards streams, the write streams of the batches not fully
+	// written yet by run and batch number
+	streamsMu sync.Mutex
+	streams   map[string]*writeStream
+}
+
+// writeStream is the committed write stream of one batch. Rows are appended at
+// their offset in the stream, so an append sent again after its response was
+// lost is answered as already written instead of duplicating its rows.
+type writeStream struct {
+	mu      sync.Mutex
+	name    string
+	created time.Time
+	// offset is the number of rows appended
+	offset int64
+	// unacked is the number of rows of an append whose response was lost; a retry
+	// sends them again first, as one append at the same offset
+	unacked int
+}
+
+// RowError describes a single row rejected by BigQuery as invalid
+type RowError struct {
+	Index   int
+	Message string
+}
+
+// RowErrors is returned, wrapped in a PartialWriteError, when rows of a batch
+// were rejected as invalid. The other rows are written; retrying sends the
+// invalid ones again, so they fail the batch rather than being dropped.
+type RowErrors struct {
+	Errors []RowError
+	Total  int
+}
+
+func (e *RowErrors) Error() string {
+	return fmt.Sprintf("bigquery rejected %d of %d rows as invalid, the first at row %d: %s",
+		len(e.Errors), e.Total, e.Errors[0].Index, e.Errors[0].Message)
+}
+
+// NewBigQuerySink creates a BigQuery sink authenticated with the configured
+// credentials file or Application Default Credentials
+func NewBigQuerySink(ctx context.Context, cfg BigQueryConfig, logger *logging.Logger, metrics *metrics.Metrics) (*BigQuerySink, error) {
+	if cfg.ProjectID == "" || cfg.Dataset == "" || cfg.Table == "" {
+		return nil, fmt.Errorf("bigquery project, dataset and table are required")
+	}
+
+	var creds *google.Credentials
+	if cfg.CredentialsFile != "" {
+		keyJSON, err := os.ReadFile(cfg.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bigquery credentials: %w", err)
+		}
+		creds, err = google.CredentialsFromJSON(ctx, keyJSON, bigQueryScope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse bigquery credentials: %w", err)
+		}
+	} else {
+		var err error
+		creds, err = google.FindDefaultCredentials(ctx, bigQueryScope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find default credentials: %w", err)
+		}
+	}
+
+	conn, err := grpc.NewClient(bigQueryWriteEndpoint,
+		grpc.WithTransportCredentials(credentials.NewTLS(nil)),
+		grpc.WithPerRPCCredentials(oauth.TokenSource{TokenSource: creds.TokenSource}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bigquery storage client: %w", err)
+	}
+
+	return &BigQuerySink{
+		cfg:        cfg,
+		endpoint:   bigQueryEndpoint,
+		httpClient: oauth2.NewClient(ctx, creds.TokenSource),
+		conn:       conn,
+		logger:     logger,
+		metrics:    metrics,
+		streams:    make(map[string]*writeStream),
+	}, nil
+}
+
+// Name returns the sink name
+func (b *BigQuerySink) Name() string {
+	return "bigquery"
+}
+
+// Close closes the connection to the Storage Write API
+func (b *BigQuerySink) Close() error {
+	return b.conn.Close()
+}
+
+// Schema returns the BigQuery table schema derived from the processed field config
+func (b *BigQuerySink) Schema() []map[string]string {
+	schema := make([]map[string]string, 0, len(transform.Fields))
+	for _, field := range transform.Fields {
+		mode := "NULLABLE"
+		if field.Required {
+			mode = "REQUIRED"
+		}
+		schema = append(schema, map[string]string{
+			"name":        b.column(field.Name),
+			"type":        bigQueryType(field.Type),
+			"mode":        mode,
+			"description": field.Description,
+		})
+	}
+	return schema
+}
+
+// Write appends the records to the configured table through a committed write
+// stream of their batch, identified by the run and the batch number, at most
+// bigQueryMaxRows per append. Each row is appended at its offset in the stream,
+// so rows a retry sends again are not written twice. An append with invalid rows
+// writes none of its rows, so it is sent again without the invalid ones, which
+// are returned in a PartialWriteError with RowErrors; the rows of a failed append and those
+// after it are returned in a PartialWriteError too, so only they are retried.
+func (b *BigQuerySink) Write(ctx context.Context, records []database.ProcessedRecord) error {
+	logger := b.logger.ForContext(ctx)
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := b.ensureTable(ctx); err != nil {
+		return err
+	}
+
+	started := time.Now()
+	defer func() {
+		b.metrics.SinkWriteDuration.WithLabelValues(b.Name()).Observe(time.Since(started).Seconds())
+	}()
+
+	key := fmt.Sprintf("%s/%d", runid.FromContext(ctx), database.LoadBatch(ctx))
+	stream, err := b.writeStream(ctx, key)
+	if err != nil {
+		b.metrics.SinkWriteErrorsTotal.WithLabelValues(b.Name()).Add(float64(len(records)))
+		return err
+	}
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	schema, err := b.rowSchema()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-goog-request-params", "write_stream="+url.QueryEscape(stream.name))
+	appender, err := b.conn.NewStream(ctx, &grpc.StreamDesc{StreamName: "AppendRows", ServerStreams: true, ClientStreams: true},
+		bigQueryWriteService+"AppendRows", grpc.ForceCodec(wireCodec{}))
+	if err != nil {
+		b.metrics.SinkWriteErrorsTotal.WithLabelValues(b.Name()).Add(float64(len(records)))
+		return fmt.Errorf("failed to open bigquery append stream: %w", err)
+	}
+	defer appender.CloseSend()
+
+	written := 0
+	var invalid []database.ProcessedRecord
+	var rowErrors []RowError
+	for start := 0; start < len(records); {
+		size := bigQueryMaxRows
+		if stream.unacked > 0 {
+			size = stream.unacked
+		}
+		end := min(start+size, len(records))
+		pending := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			pending = append(pending, i)
+		}
+		for len(pending) > 0 {
+			rejected, err := b.append(appender, stream, schema, records, pending)
+			if err != nil {
+				// The appends before were written; the rest is sent again, starting with
+				// the rows of this one
+				remaining := make([]database.ProcessedRecord, 0, len(records)-written)
+				for _, i := range pending {
+					remaining = append(remaining, records[i])
+				}
+				remaining = append(remaining, records[end:]...)
+				remaining = append(remaining, invalid...)
+				b.metrics.SinkRecordsWrittenTotal.WithLabelValues(b.Name()).Add(float64(written))
+				b.metrics.SinkWriteErrorsTotal.WithLabelValues(b.Name()).Add(float64(len(remaining)))
+				return &PartialWriteError{Remaining: remaining, Err: err}
+			}
+			if len(rejected) == 0 {
+				written += len(pending)
+				break
+			}
+			valid := make([]int, 0, len(pending)-len(rejected))
+			for j, i := range pending {
+				if message, ok := rejected[j]; ok {
+					logger.Error(fmt.Sprintf("BigQuery rejected row %d as invalid: %s", i, message))
+					rowErrors = append(rowErrors, RowError{Index: i, Message: message})
+					invalid = append(invalid, records[i])
+					continue
+				}
+				valid = append(valid, i)
+			}
+			pending = valid
+		}
+		start = end
+	}
+
+	b.metrics.SinkRecordsWrittenTotal.WithLabelValues(b.Name()).Add(float64(written))
+	if len(invalid) > 0 {
+		b.metrics.SinkWriteErrorsTotal.WithLabelValues(b.Name()).Add(float64(len(invalid)))
+		return &PartialWriteError{Remaining: invalid, Err: &RowErrors{Errors: rowErrors, Total: len(records)}}
+	}
+
+	b.streamsMu.Lock()
+	delete(b.streams, key)
+	b.streamsMu.Unlock()
+	logger.Info(fmt.Sprintf("BigQuery load successful: %d rows into %s.%s", written, b.cfg.Dataset, b.cfg.Table))
+	return nil
+}
+
+// append sends the records at indexes as one append at the offset of the stream
+// and returns the rows rejected as invalid by their position in the append, in
+// which case none was written
+func (b *BigQuerySink) append(appender grpc.ClientStream, stream *writeStream, schema []byte, records []database.ProcessedRecord, indexes []int) (map[int]string, error) {
+	rows := make([][]byte, len(indexes))
+	for j, i := range indexes {
+		rows[j] = encodeRow(records[i])
+	}
+	request := encodeAppendRows(stream.name, stream.offset, schema, rows)
+
+	// Until the response arrives, the rows may or may not have been written
+	stream.unacked = len(rows)
+	if err := appender.SendMsg(&request); err != nil {
+		return nil, fmt.Errorf("bigquery append failed: %w", err)
+	}
+	var response wireMessage
+	if err := appender.RecvMsg(&response); err != nil {
+		return nil, fmt.Errorf("bigquery append failed: %w", err)
+	}
+	result, err := decodeAppendRows(response)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case result.code == codes.OK:
+	case result.code == codes.AlreadyExists:
+		// The rows were written by an earlier append whose response was lost
+	case len(result.rowErrors) > 0:
+		stream.unacked = 0
+		for j := range result.rowErrors {
+			if j < 0 || j >= len(rows) {
+				return nil, fmt.Errorf("bigquery reported an error of unknown row %d", j)
+			}
+		}
+		return result.rowErrors, nil
+	default:
+		stream.unacked = 0
+		return nil, fmt.Errorf("bigquery append failed with %s: %s", result.code, result.message)
+	}
+	stream.offset += int64(len(rows))
+	stream.unacked = 0
+	return nil, nil
+}
+
+// writeStream returns the write stream of a batch, creating one for its first
+// write. Streams of batches given up on are dropped after bigQueryStreamTTL.
+func (b *BigQuerySink) writeStream(ctx context.Context, key string) (*writeStream, error) {
+	b.streamsMu.Lock()
+	stream, ok := b.streams[key]
+	b.streamsMu.Unlock()
+	if ok {
+		return stream, nil
+	}
+
+	name, err := b.createStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b.streamsMu.Lock()
+	defer b.streamsMu.Unlock()
+	if b.streams == nil {
+		b.streams = make(map[string]*writeStream)
+	}
+	for k, stream := range b.streams {
+		if time.Since(stream.created) > bigQueryStreamTTL {
+			delete(b.streams, k)
+		}
+	}
+	// A concurrent write of the batch may have created one first
+	if stream, ok := b.streams[key]; ok {
+		return stream, nil
+	}
+	stream = &writeStream{name: name, created: time.Now()}
+	b.streams[key] = stream
+	return stream, nil
+}
+
+// createStream creates a committed write stream on the table
+func (b *BigQuerySink) createStream(ctx context.Context) (string, error) {
+	table := fmt.Sprintf("projects/%s/datasets/%s/tables/%s", b.cfg.ProjectID, b.cfg.Dataset, b.cfg.Table)
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-goog-request-params", "parent="+url.QueryEscape(table))
+	request := encodeCreateWriteStream(table)
+	var response wireMessage
+	if err := b.conn.Invoke(ctx, bigQueryWriteService+"CreateWriteStream", &request, &response, grpc.ForceCodec(wireCodec{})); err != nil {
+		return "", fmt.Errorf("failed to create bigquery write stream: %w", err)
+	}
+	return decodeWriteStream(response)
+}
+
+// ensureTable creates the destination table from the field config if it is
+// missing, once; a failure is tried again by the next write
+func (b *BigQuerySink) ensureTable(ctx context.Context) error {
+	b.tableMu.Lock()
+	defer b.tableMu.Unlock()
+	if b.tableReady {
+		return nil
+	}
+
+	payload := map[string]interface{}{
+		"tableReference": map[string]string{
+			"projectId": b.cfg.ProjectID,
+			"datasetId": b.cfg.Dataset,
+			"tableId":   b.cfg.Table,
+		},
+		"schema": map[string]interface{}{
+			"fields": b.Schema(),
+		},
+	}
+
+	url := fmt.Sprintf("%s/projects/%s/datasets/%s/tables", b.endpoint, b.cfg.ProjectID, b.cfg.Dataset)
+	err := b.do(ctx, url, payload, nil)
+	var statusErr *bigQueryStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict {
+		b.tableReady = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create bigquery table: %w", err)
+	}
+
+	b.tableReady = true
+	b.logger.Info(fmt.Sprintf("Created BigQuery table %s.%s", b.cfg.Dataset, b.cfg.Table))
+	return nil
+}
+
+// do POSTs a JSON payload and decodes a successful response into out
+func (b *BigQuerySink) do(ctx context.Context, url string, payload, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bigquery request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create bigquery request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("bigquery request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read bigquery response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &bigQueryStatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to unmarshal bigquery response: %w", err)
+		}
+	}
+	return nil
+}
+
+// bigQueryStatusError is returned for non-200 responses from the BigQuery API
+type bigQueryStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *bigQueryStatusError) Error() string {
+	return fmt.Sprintf("bigquery returned status code %d: %s", e.StatusCode, e.Body)
+}
+
+func (b *BigQuerySink) column(field string) string {
+	if column, ok := b.cfg.ColumnMap[field]; ok {
+		return column
+	}
+	return field
+}
+
+func bigQueryType(fieldType string) string {
+	switch fieldType {
+	case transform.FieldTypeInteger:
+		return "INT64"
+	default:
+		return "STRING"
+	}
+}
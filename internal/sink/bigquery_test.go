@@ -0,0 +1,266 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+)
+
+// fakeBigQueryWrite serves the Storage Write API for committed streams, keeping
+// the rows appended to each. Rows without a title are invalid.
+type fakeBigQueryWrite struct {
+	mu      sync.Mutex
+	streams map[string][]map[protowire.Number]interface{}
+	columns []string
+	appends int
+	// fail and lostAck are the numbers of the append that fails unwritten and of
+	// the one that is written but whose response is lost
+	fail    int
+	lostAck int
+}
+
+func (f *fakeBigQueryWrite) handle(_ interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	switch path.Base(method) {
+	case "CreateWriteStream":
+		var request wireMessage
+		if err := stream.RecvMsg(&request); err != nil {
+			return err
+		}
+		f.mu.Lock()
+		name := fmt.Sprintf("projects/project/datasets/dataset/tables/table/streams/%d", len(f.streams))
+		f.streams[name] = nil
+		f.mu.Unlock()
+		var response wireMessage
+		response = protowire.AppendTag(response, 1, protowire.BytesType)
+		response = protowire.AppendString(response, name)
+		return stream.SendMsg(&response)
+	case "AppendRows":
+		for {
+			var request wireMessage
+			if err := stream.RecvMsg(&request); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			response, err := f.append(request)
+			if err != nil {
+				return err
+			}
+			if err := stream.SendMsg(&response); err != nil {
+				return err
+			}
+		}
+	}
+	return status.Error(codes.Unimplemented, method)
+}
+
+func (f *fakeBigQueryWrite) append(request wireMessage) (wireMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.appends++
+	if f.appends == f.fail {
+		return nil, status.Error(codes.Unavailable, "backend unavailable")
+	}
+
+	var name string
+	var offset int
+	var rows []map[protowire.Number]interface{}
+	consumeFields(request, func(num protowire.Number, value []byte, _ uint64) {
+		switch num {
+		case 1:
+			name = string(value)
+		case 2:
+			consumeFields(value, func(_ protowire.Number, _ []byte, number uint64) { offset = int(number) })
+		case 4:
+			consumeFields(value, func(num protowire.Number, value []byte, _ uint64) {
+				if num == 1 {
+					consumeFields(value, func(_ protowire.Number, descriptor []byte, _ uint64) {
+						var schema descriptorpb.DescriptorProto
+						proto.Unmarshal(descriptor, &schema)
+						f.columns = nil
+						for _, field := range schema.Field {
+							f.columns = append(f.columns, field.GetName())
+						}
+					})
+					return
+				}
+				consumeFields(value, func(_ protowire.Number, encoded []byte, _ uint64) {
+					row := make(map[protowire.Number]interface{})
+					consumeFields(encoded, func(num protowire.Number, value []byte, number uint64) {
+						if value != nil {
+							row[num] = string(value)
+						} else {
+							row[num] = int(number)
+						}
+					})
+					rows = append(rows, row)
+				})
+			})
+		}
+	})
+
+	var response wireMessage
+	var rowErrors wireMessage
+	for i, row := range rows {
+		if row[2] == "" || row[2] == nil {
+			var rowError []byte
+			rowError = protowire.AppendTag(rowError, 1, protowire.VarintType)
+			rowError = protowire.AppendVarint(rowError, uint64(i))
+			rowError = protowire.AppendTag(rowError, 3, protowire.BytesType)
+			rowError = protowire.AppendString(rowError, "missing required field title")
+			rowErrors = protowire.AppendTag(rowErrors, 4, protowire.BytesType)
+			rowErrors = protowire.AppendBytes(rowErrors, rowError)
+		}
+	}
+	code := codes.OK
+	switch {
+	case len(rowErrors) > 0:
+		code = codes.InvalidArgument
+		response = append(response, rowErrors...)
+	case offset < len(f.streams[name]):
+		code = codes.AlreadyExists
+	case offset > len(f.streams[name]):
+		code = codes.OutOfRange
+	default:
+		f.streams[name] = append(f.streams[name], rows...)
+		if f.appends == f.lostAck {
+			return nil, status.Error(codes.Unavailable, "connection reset")
+		}
+	}
+	if code != codes.OK {
+		var rpcStatus []byte
+		rpcStatus = protowire.AppendTag(rpcStatus, 1, protowire.VarintType)
+		rpcStatus = protowire.AppendVarint(rpcStatus, uint64(code))
+		response = protowire.AppendTag(response, 2, protowire.BytesType)
+		response = protowire.AppendBytes(response, rpcStatus)
+	}
+	return response, nil
+}
+
+// newFakeBigQuerySink returns a sink appending to a fake Storage Write API
+func newFakeBigQuerySink(t *testing.T, server *fakeBigQueryWrite, columnMap map[string]string) *BigQuerySink {
+	logger, _ := logging.NewLogger("test.log")
+	t.Cleanup(func() { logger.Close() })
+
+	server.streams = make(map[string][]map[protowire.Number]interface{})
+	grpcServer := grpc.NewServer(grpc.ForceServerCodec(wireCodec{}), grpc.UnknownServiceHandler(server.handle))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &BigQuerySink{
+		cfg: BigQueryConfig{
+			ProjectID: "project",
+			Dataset:   "dataset",
+			Table:     "table",
+			ColumnMap: columnMap,
+		},
+		conn:       conn,
+		logger:     logger,
+		metrics:    metrics.NewMetrics(),
+		tableReady: true,
+	}
+}
+
+func TestBigQuerySinkWrite(t *testing.T) {
+	server := &fakeBigQueryWrite{}
+	bigQuerySink := newFakeBigQuerySink(t, server, map[string]string{"title": "post_title"})
+
+	records := []database.ProcessedRecord{
+		{UserID: 1, Title: "First", Body: "Body"},
+		{UserID: 2, Body: "Body"},
+		{UserID: 3, Title: "Third"},
+	}
+
+	// The valid rows are written; the invalid one fails the write
+	err := bigQuerySink.Write(context.Background(), records)
+	var partial *PartialWriteError
+	var rowErrors *RowErrors
+	if !errors.As(err, &partial) || !errors.As(err, &rowErrors) {
+		t.Fatalf("Expected the invalid row to fail the write, got %v", err)
+	}
+	if len(partial.Remaining) != 1 || partial.Remaining[0].UserID != 2 || rowErrors.Errors[0].Index != 1 {
+		t.Errorf("Expected only row 1 to be returned, got %v and %v", partial.Remaining, rowErrors.Errors)
+	}
+
+	var rows []map[protowire.Number]interface{}
+	for _, streamRows := range server.streams {
+		rows = append(rows, streamRows...)
+	}
+	if len(rows) != 2 || rows[0][1] != 1 || rows[0][2] != "First" || rows[1][1] != 3 {
+		t.Fatalf("Expected rows 0 and 2 written, got %v", rows)
+	}
+	if server.columns[1] != "post_title" {
+		t.Errorf("Expected column map to rename title, got %v", server.columns)
+	}
+}
+
+func TestBigQuerySinkRetriesOnlyUnsentRows(t *testing.T) {
+	// The second append is written but its response lost; the first retry fails
+	server := &fakeBigQueryWrite{lostAck: 2, fail: 3}
+	bigQuerySink := newFakeBigQuerySink(t, server, nil)
+
+	records := make([]database.ProcessedRecord, bigQueryMaxRows+100)
+	for i := range records {
+		records[i] = database.ProcessedRecord{UserID: i, Title: "Title"}
+	}
+	ctx := database.WithLoadBatch(runid.WithID(context.Background(), "run-1"), 1)
+
+	err := bigQuerySink.Write(ctx, records)
+	var partial *PartialWriteError
+	if !errors.As(err, &partial) || len(partial.Remaining) != 100 || partial.Remaining[0].UserID != bigQueryMaxRows {
+		t.Fatalf("Expected rows %d onwards to be retried, got %v", bigQueryMaxRows, err)
+	}
+	if err := bigQuerySink.Write(ctx, partial.Remaining); err == nil {
+		t.Fatal("Expected the failed append to fail the retry")
+	}
+
+	// The rows are sent again at the same offset and found written
+	if err := bigQuerySink.Write(ctx, partial.Remaining); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(server.streams) != 1 {
+		t.Errorf("Expected the retries to append to the stream of the batch, got %d streams", len(server.streams))
+	}
+	for _, rows := range server.streams {
+		if len(rows) != len(records) {
+			t.Errorf("Expected %d rows written once, got %d", len(records), len(rows))
+		}
+	}
+
+	// The next batch gets a stream of its own
+	if err := bigQuerySink.Write(database.WithLoadBatch(ctx, 2), records[:1]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(server.streams) != 2 {
+		t.Errorf("Expected a stream per batch, got %d", len(server.streams))
+	}
+}
@@ -0,0 +1,248 @@
+package sink
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// The messages of the BigQuery Storage Write API (google.cloud.bigquery.storage.v1)
+// are encoded by hand in the protobuf wire format, like the write requests of the
+// remote-write sink, so the sink needs no generated client
+
+const (
+	bigQueryWriteService = "/google.cloud.bigquery.storage.v1.BigQueryWrite/"
+
+	// writeStreamCommitted is the type of write streams whose rows are visible as
+	// soon as they are appended
+	writeStreamCommitted = 1
+)
+
+// wireMessage is a message encoded in the protobuf wire format
+type wireMessage []byte
+
+// wireCodec sends and receives wireMessages as they are
+type wireCodec struct{}
+
+func (wireCodec) Marshal(v interface{}) ([]byte, error) {
+	message, ok := v.(*wireMessage)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T", v)
+	}
+	return *message, nil
+}
+
+func (wireCodec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(*wireMessage)
+	if !ok {
+		return fmt.Errorf("cannot decode into %T", v)
+	}
+	*message = append((*message)[:0], data...)
+	return nil
+}
+
+func (wireCodec) Name() string {
+	return "proto"
+}
+
+// appendResult is the response to an append: rows are appended when code is OK;
+// otherwise none are, and rowErrors holds the rows rejected as invalid by their
+// index in the append
+type appendResult struct {
+	code      codes.Code
+	message   string
+	rowErrors map[int]string
+}
+
+// encodeCreateWriteStream encodes a CreateWriteStreamRequest for a committed
+// stream of table
+func encodeCreateWriteStream(table string) wireMessage {
+	var stream []byte
+	stream = protowire.AppendTag(stream, 3, protowire.VarintType)
+	stream = protowire.AppendVarint(stream, writeStreamCommitted)
+
+	var request []byte
+	request = protowire.AppendTag(request, 1, protowire.BytesType)
+	request = protowire.AppendString(request, table)
+	request = protowire.AppendTag(request, 2, protowire.BytesType)
+	request = protowire.AppendBytes(request, stream)
+	return request
+}
+
+// decodeWriteStream returns the name of an encoded WriteStream
+func decodeWriteStream(message []byte) (string, error) {
+	var name string
+	err := consumeFields(message, func(num protowire.Number, value []byte, _ uint64) {
+		if num == 1 {
+			name = string(value)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", fmt.Errorf("bigquery returned a write stream without a name")
+	}
+	return name, nil
+}
+
+// encodeAppendRows encodes an AppendRowsRequest appending rows, described by the
+// encoded DescriptorProto schema, to stream at offset
+func encodeAppendRows(stream string, offset int64, schema []byte, rows [][]byte) wireMessage {
+	var protoSchema []byte
+	protoSchema = protowire.AppendTag(protoSchema, 1, protowire.BytesType)
+	protoSchema = protowire.AppendBytes(protoSchema, schema)
+
+	var protoRows []byte
+	for _, row := range rows {
+		protoRows = protowire.AppendTag(protoRows, 1, protowire.BytesType)
+		protoRows = protowire.AppendBytes(protoRows, row)
+	}
+
+	var data []byte
+	data = protowire.AppendTag(data, 1, protowire.BytesType)
+	data = protowire.AppendBytes(data, protoSchema)
+	data = protowire.AppendTag(data, 2, protowire.BytesType)
+	data = protowire.AppendBytes(data, protoRows)
+
+	var offsetValue []byte
+	offsetValue = protowire.AppendTag(offsetValue, 1, protowire.VarintType)
+	offsetValue = protowire.AppendVarint(offsetValue, uint64(offset))
+
+	var request []byte
+	request = protowire.AppendTag(request, 1, protowire.BytesType)
+	request = protowire.AppendString(request, stream)
+	request = protowire.AppendTag(request, 2, protowire.BytesType)
+	request = protowire.AppendBytes(request, offsetValue)
+	request = protowire.AppendTag(request, 4, protowire.BytesType)
+	request = protowire.AppendBytes(request, data)
+	return request
+}
+
+// decodeAppendRows decodes an AppendRowsResponse
+func decodeAppendRows(message []byte) (appendResult, error) {
+	result := appendResult{code: codes.OK}
+	var inner error
+	err := consumeFields(message, func(num protowire.Number, value []byte, _ uint64) {
+		switch num {
+		case 2: // error, a google.rpc.Status
+			inner = consumeFields(value, func(num protowire.Number, value []byte, number uint64) {
+				switch num {
+				case 1:
+					result.code = codes.Code(number)
+				case 2:
+					result.message = string(value)
+				}
+			})
+		case 4: // row_errors
+			index, message := -1, ""
+			inner = consumeFields(value, func(num protowire.Number, value []byte, number uint64) {
+				switch num {
+				case 1:
+					index = int(number)
+				case 3:
+					message = string(value)
+				}
+			})
+			if result.rowErrors == nil {
+				result.rowErrors = make(map[int]string)
+			}
+			result.rowErrors[index] = message
+		}
+	})
+	if err == nil {
+		err = inner
+	}
+	if err != nil {
+		return appendResult{}, fmt.Errorf("failed to decode bigquery append response: %w", err)
+	}
+	if len(result.rowErrors) > 0 && result.code == codes.OK {
+		result.code = codes.InvalidArgument
+	}
+	return result, nil
+}
+
+// consumeFields calls field for every field of an encoded message, with the
+// value of length-delimited fields and the value of varints
+func consumeFields(message []byte, field func(num protowire.Number, value []byte, number uint64)) error {
+	for len(message) > 0 {
+		num, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		message = message[n:]
+		switch typ {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(message)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			field(num, value, 0)
+			message = message[n:]
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(message)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			field(num, nil, value)
+			message = message[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, message)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			message = message[n:]
+		}
+	}
+	return nil
+}
+
+// rowSchema returns the encoded DescriptorProto of the rows: a field per
+// processed field, numbered in config order and named after its column
+func (b *BigQuerySink) rowSchema() ([]byte, error) {
+	descriptor := &descriptorpb.DescriptorProto{Name: proto.String("ProcessedRecord")}
+	for i, field := range transform.Fields {
+		fieldType := descriptorpb.FieldDescriptorProto_TYPE_STRING
+		if field.Type == transform.FieldTypeInteger {
+			fieldType = descriptorpb.FieldDescriptorProto_TYPE_INT64
+		}
+		descriptor.Field = append(descriptor.Field, &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(b.column(field.Name)),
+			Number: proto.Int32(int32(i + 1)),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   fieldType.Enum(),
+		})
+	}
+	schema, err := proto.Marshal(descriptor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bigquery row schema: %w", err)
+	}
+	return schema, nil
+}
+
+// encodeRow encodes a processed record as a message of rowSchema
+func encodeRow(record database.ProcessedRecord) []byte {
+	values := transform.Row(record)
+	var row []byte
+	for i, field := range transform.Fields {
+		num := protowire.Number(i + 1)
+		switch value := values[field.Name].(type) {
+		case int:
+			row = protowire.AppendTag(row, num, protowire.VarintType)
+			row = protowire.AppendVarint(row, uint64(value))
+		case int64:
+			row = protowire.AppendTag(row, num, protowire.VarintType)
+			row = protowire.AppendVarint(row, uint64(value))
+		case string:
+			row = protowire.AppendTag(row, num, protowire.BytesType)
+			row = protowire.AppendString(row, value)
+		}
+	}
+	return row
+}
@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+)
+
+// Targets change events are published to
+const (
+	ChangeTargetTable = "table"
+	ChangeTargetKafka = "kafka"
+)
+
+// ChangeTable appends change events to the changes table
+type ChangeTable struct {
+	db *database.PostgresDB
+}
+
+// NewChangeTable creates a publisher of change events to the changes table
+func NewChangeTable(db *database.PostgresDB) *ChangeTable {
+	return &ChangeTable{db: db}
+}
+
+// PublishChanges inserts the events into the changes table
+func (c *ChangeTable) PublishChanges(ctx context.Context, events []database.ChangeEvent) error {
+	return c.db.InsertChanges(ctx, events)
+}
+
+// KafkaChangePublisher publishes change events to a Kafka topic as JSON messages
+// keyed by source id, so the events of a record stay in order
+type KafkaChangePublisher struct {
+	topic  string
+	writer *kafka.Writer
+	logger *logging.Logger
+}
+
+// NewKafkaChangePublisher creates a publisher of change events to the topic of cfg.
+// Only the brokers, topic, acks and compression of cfg are used.
+func NewKafkaChangePublisher(cfg KafkaConfig, logger *logging.Logger) (*KafkaChangePublisher, error) {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		return nil, fmt.Errorf("kafka brokers and topic are required")
+	}
+	acks, err := requiredAcks(cfg.RequiredAcks)
+	if err != nil {
+		return nil, err
+	}
+	compression, err := kafkaCompression(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaChangePublisher{
+		topic: cfg.Topic,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: acks,
+			Compression:  compression,
+			BatchTimeout: 10 * time.Millisecond,
+		},
+		logger: logger,
+	}, nil
+}
+
+// PublishChanges publishes one message per event and waits for delivery confirmation
+func (k *KafkaChangePublisher) PublishChanges(ctx context.Context, events []database.ChangeEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	messages := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal change event: %w", err)
+		}
+		message := kafka.Message{
+			Key:   []byte(event.SourceID),
+			Value: value,
+			Headers: []kafka.Header{
+				{Key: "content-type", Value: []byte("application/json")},
+				{Key: "op", Value: []byte(event.Op)},
+			},
+		}
+		if id := runid.FromContext(ctx); id != "" {
+			message.Headers = append(message.Headers, kafka.Header{Key: "run-id", Value: []byte(id)})
+		}
+		messages = append(messages, message)
+	}
+	if err := k.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("kafka delivery of change events failed: %w", err)
+	}
+	k.logger.ForContext(ctx).Info(fmt.Sprintf("Kafka delivery confirmed: %d change events to topic %s", len(messages), k.topic))
+	return nil
+}
+
+// Close flushes and closes the underlying writer
+func (k *KafkaChangePublisher) Close() error {
+	return k.writer.Close()
+}
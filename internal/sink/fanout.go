@@ -0,0 +1,135 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/backoff"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/tracing"
+)
+
+// Target is a sink together with its retry policy
+type Target struct {
+	Sink  Sink
+	Retry backoff.Policy
+}
+
+// Result is the outcome of writing one batch to one sink
+type Result struct {
+	Sink     string
+	Attempts int
+	Duration time.Duration
+	Err      error
+}
+
+// FanOut writes each batch to all targets concurrently, so a failing or slow
+// sink does not block the others
+type FanOut struct {
+	targets []Target
+	logger  *logging.Logger
+	metrics *metrics.Metrics
+}
+
+// NewFanOut creates a fan-out loader over the given targets
+func NewFanOut(targets []Target, logger *logging.Logger, metrics *metrics.Metrics) *FanOut {
+	return &FanOut{
+		targets: targets,
+		logger:  logger,
+		metrics: metrics,
+	}
+}
+
+// Sinks returns the names of the configured sinks
+func (f *FanOut) Sinks() []string {
+	names := make([]string, 0, len(f.targets))
+	for _, target := range f.targets {
+		names = append(names, target.Sink.Name())
+	}
+	return names
+}
+
+// Write loads the records into every sink and returns one result per sink, in target order
+func (f *FanOut) Write(ctx context.Context, records []database.ProcessedRecord) []Result {
+	return f.WriteExcept(ctx, records, nil)
+}
+
+// WriteExcept loads the records into every sink not named in skip, e.g. the sinks
+// that already hold them, and returns one result per sink written, in target order
+func (f *FanOut) WriteExcept(ctx context.Context, records []database.ProcessedRecord, skip []string) []Result {
+	var targets []Target
+	for _, target := range f.targets {
+		if !slices.Contains(skip, target.Sink.Name()) {
+			targets = append(targets, target)
+		}
+	}
+	results := make([]Result, len(targets))
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer wg.Done()
+			results[i] = f.writeWithRetry(ctx, target, records)
+		}(i, target)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// writeWithRetry writes to a single sink, retrying according to its policy. After
+// a partial write only the records not loaded yet are retried.
+func (f *FanOut) writeWithRetry(ctx context.Context, target Target, records []database.ProcessedRecord) Result {
+	name := target.Sink.Name()
+	ctx, span := tracing.Start(ctx, "sink.write", attribute.String("etl.sink", name), attribute.Int("etl.records", len(records)))
+	logger := f.logger.ForContext(ctx)
+	result := Result{Sink: name}
+	start := time.Now()
+
+	maxAttempts := target.Retry.MaxAttempts()
+
+retry:
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		result.Attempts = attempt
+		result.Err = target.Sink.Write(ctx, records)
+		if result.Err == nil {
+			break
+		}
+		var partial *PartialWriteError
+		if errors.As(result.Err, &partial) {
+			// The records already loaded are not written again
+			records = partial.Remaining
+		}
+		if attempt == maxAttempts {
+			break
+		}
+
+		logger.Warn(fmt.Sprintf("Sink %s write attempt %d/%d failed, retrying in %v: %v", name, attempt, maxAttempts, target.Retry.Delay(attempt), result.Err))
+		f.metrics.SinkRetriesTotal.WithLabelValues(name).Inc()
+
+		if err := target.Retry.Wait(ctx, attempt); err != nil {
+			result.Err = fmt.Errorf("%w (retry aborted: %v)", result.Err, err)
+			break retry
+		}
+	}
+
+	result.Duration = time.Since(start)
+	span.SetAttributes(attribute.Int("etl.attempts", result.Attempts))
+	tracing.End(span, result.Err)
+	if result.Err != nil {
+		f.metrics.SinkBatchesTotal.WithLabelValues(name, "failure").Inc()
+	} else {
+		f.metrics.SinkBatchesTotal.WithLabelValues(name, "success").Inc()
+		f.metrics.SinkLastSuccessTimestamp.WithLabelValues(name).SetToCurrentTime()
+	}
+	return result
+}
@@ -0,0 +1,114 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/backoff"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+type flakySink struct {
+	name     string
+	failures int
+	calls    int
+}
+
+func (f *flakySink) Name() string { return f.name }
+
+func (f *flakySink) Write(ctx context.Context, records []database.ProcessedRecord) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("temporary failure")
+	}
+	return nil
+}
+
+func TestFanOutWrite(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	healthy := &flakySink{name: "healthy"}
+	recovering := &flakySink{name: "recovering", failures: 2}
+	broken := &flakySink{name: "broken", failures: 10}
+
+	fanOut := NewFanOut([]Target{
+		{Sink: healthy, Retry: backoff.Policy{Attempts: 1}},
+		{Sink: recovering, Retry: backoff.Policy{Attempts: 3, Backoff: time.Millisecond}},
+		{Sink: broken, Retry: backoff.Policy{Attempts: 2, Backoff: time.Millisecond}},
+	}, logger, metrics.NewMetrics())
+
+	results := fanOut.Write(context.Background(), []database.ProcessedRecord{{UserID: 1, Title: "Title"}})
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[0].Err != nil || results[0].Attempts != 1 {
+		t.Errorf("Expected healthy sink to succeed on first attempt, got %+v", results[0])
+	}
+	if results[1].Err != nil || results[1].Attempts != 3 {
+		t.Errorf("Expected recovering sink to succeed on third attempt, got %+v", results[1])
+	}
+	if results[2].Err == nil || results[2].Attempts != 2 {
+		t.Errorf("Expected broken sink to fail after 2 attempts, got %+v", results[2])
+	}
+}
+
+func TestFanOutWriteExcept(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	loaded := &flakySink{name: "loaded"}
+	missing := &flakySink{name: "missing"}
+
+	fanOut := NewFanOut([]Target{
+		{Sink: loaded, Retry: backoff.Policy{Attempts: 1}},
+		{Sink: missing, Retry: backoff.Policy{Attempts: 1}},
+	}, logger, metrics.NewMetrics())
+
+	results := fanOut.WriteExcept(context.Background(), []database.ProcessedRecord{{UserID: 1, Title: "Title"}}, []string{"loaded"})
+
+	if len(results) != 1 || results[0].Sink != "missing" || results[0].Err != nil {
+		t.Fatalf("Expected a single successful write to the missing sink, got %+v", results)
+	}
+	if loaded.calls != 0 {
+		t.Errorf("Expected skipped sink not to be written, got %d calls", loaded.calls)
+	}
+}
+
+// partialSink loads the first record of each write only once, failing the rest
+type partialSink struct {
+	writes [][]database.ProcessedRecord
+}
+
+func (p *partialSink) Name() string { return "partial" }
+
+func (p *partialSink) Write(ctx context.Context, records []database.ProcessedRecord) error {
+	p.writes = append(p.writes, records)
+	if len(p.writes) > 1 {
+		return nil
+	}
+	return &PartialWriteError{Remaining: records[1:], Err: errors.New("partition failed")}
+}
+
+func TestFanOutRetriesRemainingRecords(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	partial := &partialSink{}
+	fanOut := NewFanOut([]Target{
+		{Sink: partial, Retry: backoff.Policy{Attempts: 2, Backoff: time.Millisecond}},
+	}, logger, metrics.NewMetrics())
+
+	results := fanOut.Write(context.Background(), []database.ProcessedRecord{{UserID: 1}, {UserID: 2}, {UserID: 3}})
+	if results[0].Err != nil || results[0].Attempts != 2 {
+		t.Fatalf("Expected the sink to succeed on the second attempt, got %+v", results[0])
+	}
+	if len(partial.writes) != 2 || len(partial.writes[1]) != 2 || partial.writes[1][0].UserID != 2 {
+		t.Errorf("Expected the retry to write only the 2 remaining records, got %v", partial.writes)
+	}
+}
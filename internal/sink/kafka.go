@@ -0,0 +1,247 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/avro"
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+	"github.com/mohammedhassan/etl-pipeline/internal/schemaregistry"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// Supported Kafka message serializations
+const (
+	SerializationJSON = "json"
+	SerializationAvro = "avro"
+)
+
+// KafkaConfig holds the settings for the Kafka sink
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+	// KeyField is the processed field used as message key; empty distributes round-robin
+	KeyField      string
+	Serialization string
+	// RequiredAcks is one of "all", "one" or "none"
+	RequiredAcks string
+	// Compression is the codec name of message batches; Kafka consumers decompress them transparently
+	Compression string
+}
+
+// KafkaSink publishes processed records to a Kafka topic
+type KafkaSink struct {
+	cfg        KafkaConfig
+	writer     *kafka.Writer
+	avroSchema []byte
+	// schemaID is the registry ID of the value schema messages are framed with,
+	// once registered
+	schemaID int
+	logger   *logging.Logger
+	metrics  *metrics.Metrics
+}
+
+// NewKafkaSink creates a Kafka sink with a synchronous writer
+func NewKafkaSink(cfg KafkaConfig, logger *logging.Logger, metrics *metrics.Metrics) (*KafkaSink, error) {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		return nil, fmt.Errorf("kafka brokers and topic are required")
+	}
+
+	acks, err := requiredAcks(cfg.RequiredAcks)
+	if err != nil {
+		return nil, err
+	}
+	compression, err := kafkaCompression(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &KafkaSink{
+		cfg:     cfg,
+		logger:  logger,
+		metrics: metrics,
+	}
+
+	switch cfg.Serialization {
+	case SerializationJSON:
+	case SerializationAvro:
+		schema, err := avro.Schema("ProcessedRecord", transform.Fields)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build avro schema: %w", err)
+		}
+		k.avroSchema = schema
+	default:
+		return nil, fmt.Errorf("unsupported kafka serialization: %q", cfg.Serialization)
+	}
+
+	var balancer kafka.Balancer = &kafka.RoundRobin{}
+	if cfg.KeyField != "" {
+		balancer = &kafka.Hash{}
+	}
+
+	k.writer = &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.Topic,
+		Balancer:     balancer,
+		RequiredAcks: acks,
+		Compression:  compression,
+		BatchTimeout: 10 * time.Millisecond,
+	}
+	return k, nil
+}
+
+// SetSchemaRegistry registers the schema of message values under the topic's
+// "<topic>-value" subject, failing when it is incompatible with the registered
+// versions. Messages are then framed with the schema ID, as registry
+// deserializers expect.
+func (k *KafkaSink) SetSchemaRegistry(ctx context.Context, registry *schemaregistry.Client) error {
+	schema := schemaregistry.Schema{Type: schemaregistry.TypeAvro, Definition: k.avroSchema}
+	if k.cfg.Serialization == SerializationJSON {
+		definition, err := schemaregistry.JSONSchema("ProcessedRecord", transform.Fields)
+		if err != nil {
+			return fmt.Errorf("failed to build json schema: %w", err)
+		}
+		schema = schemaregistry.Schema{Type: schemaregistry.TypeJSON, Definition: definition}
+	}
+	subject := k.cfg.Topic + "-value"
+	id, err := registry.Register(ctx, subject, schema)
+	if err != nil {
+		return err
+	}
+	k.schemaID = id
+	k.logger.Info(fmt.Sprintf("Kafka value schema registered as subject %s, ID %d", subject, id))
+	return nil
+}
+
+// Name returns the sink name
+func (k *KafkaSink) Name() string {
+	return "kafka"
+}
+
+// Write publishes one message per record and waits for delivery confirmation
+func (k *KafkaSink) Write(ctx context.Context, records []database.ProcessedRecord) error {
+	logger := k.logger.ForContext(ctx)
+	if len(records) == 0 {
+		return nil
+	}
+
+	runID := runid.FromContext(ctx)
+	messages := make([]kafka.Message, 0, len(records))
+	for _, record := range records {
+		message, err := k.message(record)
+		if err != nil {
+			k.metrics.SinkWriteErrorsTotal.WithLabelValues(k.Name()).Add(float64(len(records)))
+			return err
+		}
+		if runID != "" {
+			message.Headers = append(message.Headers, kafka.Header{Key: "run-id", Value: []byte(runID)})
+		}
+		messages = append(messages, message)
+	}
+
+	start := time.Now()
+	err := k.writer.WriteMessages(ctx, messages...)
+	k.metrics.SinkWriteDuration.WithLabelValues(k.Name()).Observe(time.Since(start).Seconds())
+
+	if err == nil {
+		k.metrics.SinkRecordsWrittenTotal.WithLabelValues(k.Name()).Add(float64(len(messages)))
+		logger.Info(fmt.Sprintf("Kafka delivery confirmed: %d messages to topic %s", len(messages), k.cfg.Topic))
+		return nil
+	}
+
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) {
+		failed := writeErrors.Count()
+		k.metrics.SinkRecordsWrittenTotal.WithLabelValues(k.Name()).Add(float64(len(messages) - failed))
+		k.metrics.SinkWriteErrorsTotal.WithLabelValues(k.Name()).Add(float64(failed))
+		return fmt.Errorf("kafka delivery failed for %d of %d messages: %w", failed, len(messages), err)
+	}
+
+	k.metrics.SinkWriteErrorsTotal.WithLabelValues(k.Name()).Add(float64(len(messages)))
+	return fmt.Errorf("kafka delivery failed: %w", err)
+}
+
+// Close flushes and closes the underlying writer
+func (k *KafkaSink) Close() error {
+	return k.writer.Close()
+}
+
+// message serializes a record into a Kafka message
+func (k *KafkaSink) message(record database.ProcessedRecord) (kafka.Message, error) {
+	row := transform.Row(record)
+
+	var message kafka.Message
+	if k.cfg.KeyField != "" {
+		key, ok := row[k.cfg.KeyField]
+		if !ok {
+			return message, fmt.Errorf("kafka key field %q is not a processed field", k.cfg.KeyField)
+		}
+		message.Key = []byte(fmt.Sprint(key))
+	}
+
+	switch k.cfg.Serialization {
+	case SerializationAvro:
+		value, err := avro.Encode(transform.Fields, row)
+		if err != nil {
+			return message, fmt.Errorf("failed to encode avro message: %w", err)
+		}
+		message.Value = value
+		message.Headers = []kafka.Header{
+			{Key: "content-type", Value: []byte("avro/binary")},
+			{Key: "avro.schema", Value: k.avroSchema},
+		}
+	default:
+		value, err := json.Marshal(row)
+		if err != nil {
+			return message, fmt.Errorf("failed to marshal json message: %w", err)
+		}
+		message.Value = value
+		message.Headers = []kafka.Header{
+			{Key: "content-type", Value: []byte("application/json")},
+		}
+	}
+	if k.schemaID != 0 {
+		message.Value = schemaregistry.Frame(k.schemaID, message.Value)
+	}
+	return message, nil
+}
+
+func requiredAcks(value string) (kafka.RequiredAcks, error) {
+	switch value {
+	case "", "all":
+		return kafka.RequireAll, nil
+	case "one":
+		return kafka.RequireOne, nil
+	case "none":
+		return kafka.RequireNone, nil
+	default:
+		return 0, fmt.Errorf("unsupported kafka required acks: %q", value)
+	}
+}
+
+// kafkaCompression maps a codec name to the Kafka protocol compression codec
+func kafkaCompression(name string) (kafka.Compression, error) {
+	switch name {
+	case "", codec.None:
+		return 0, nil
+	case codec.Gzip:
+		return kafka.Gzip, nil
+	case codec.Snappy:
+		return kafka.Snappy, nil
+	case codec.LZ4:
+		return kafka.Lz4, nil
+	case codec.Zstd:
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unsupported kafka compression: %q", name)
+	}
+}
@@ -0,0 +1,329 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+const (
+	// mongoBatchSize bounds the upserts of one bulk write
+	mongoBatchSize = 1000
+	// mongoDuplicateKey is reported when concurrent upserts of a key race to
+	// insert it; retrying updates the document the other one inserted
+	mongoDuplicateKey = 11000
+)
+
+// MongoConfig holds the settings for the MongoDB sink
+type MongoConfig struct {
+	URI string
+	// Database defaults to the database of URI
+	Database   string
+	Collection string
+	// Keys are the processed fields identifying a document, which records are
+	// upserted by
+	Keys []string
+	// WriteConcern is "majority", a number of members or a tag set name; empty
+	// uses the default of the deployment
+	WriteConcern string
+	Journal      bool
+	WriteTimeout time.Duration
+	Timeout      time.Duration
+}
+
+// mongoCollection is the part of a MongoDB collection the sink writes through
+type mongoCollection interface {
+	createIndex(ctx context.Context, index mongo.IndexModel) error
+	bulkWrite(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error)
+}
+
+// driverCollection is a mongoCollection of the MongoDB driver
+type driverCollection struct {
+	*mongo.Collection
+}
+
+func (c driverCollection) createIndex(ctx context.Context, index mongo.IndexModel) error {
+	_, err := c.Indexes().CreateOne(ctx, index)
+	return err
+}
+
+func (c driverCollection) bulkWrite(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	return c.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+}
+
+// MongoSink upserts processed records into a MongoDB collection by their business
+// key, so records loaded again replace their documents rather than duplicating
+// them. Documents the server rejects for good, e.g. failing validation, are
+// dropped and logged; transient failures are retried for the affected records.
+type MongoSink struct {
+	cfg        MongoConfig
+	client     *mongo.Client
+	collection mongoCollection
+	logger     *logging.Logger
+	metrics    *metrics.Metrics
+	indexReady bool
+}
+
+// NewMongoSink creates a sink upserting into the collection of cfg
+func NewMongoSink(cfg MongoConfig, logger *logging.Logger, metrics *metrics.Metrics) (*MongoSink, error) {
+	uri, err := connstring.ParseAndValidate(cfg.URI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mongo uri: %w", err)
+	}
+	if cfg.Database == "" {
+		cfg.Database = uri.Database
+	}
+	if err := validateMongoConfig(&cfg); err != nil {
+		return nil, err
+	}
+
+	clientOptions := options.Client().ApplyURI(cfg.URI)
+	if cfg.Timeout > 0 {
+		clientOptions.SetConnectTimeout(cfg.Timeout).SetServerSelectionTimeout(cfg.Timeout)
+	}
+	client, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mongo client: %w", err)
+	}
+	collection := client.Database(cfg.Database).Collection(cfg.Collection, options.Collection().SetWriteConcern(mongoWriteConcern(cfg)))
+	return &MongoSink{
+		cfg:        cfg,
+		client:     client,
+		collection: driverCollection{collection},
+		logger:     logger,
+		metrics:    metrics,
+	}, nil
+}
+
+// validateMongoConfig checks the names of cfg, defaulting the collection
+func validateMongoConfig(cfg *MongoConfig) error {
+	if cfg.Database == "" || strings.ContainsAny(cfg.Database, `/\. "$`) {
+		return fmt.Errorf("invalid mongo database %q", cfg.Database)
+	}
+	if cfg.Collection == "" {
+		cfg.Collection = "processed_data"
+	}
+	if strings.HasPrefix(cfg.Collection, "system.") || strings.Contains(cfg.Collection, "$") {
+		return fmt.Errorf("invalid mongo collection %q", cfg.Collection)
+	}
+	if len(cfg.Keys) == 0 {
+		return fmt.Errorf("mongo sink requires at least one key field")
+	}
+	for _, key := range cfg.Keys {
+		if !isField(key) {
+			return fmt.Errorf("mongo key %q is not a processed field", key)
+		}
+	}
+	return nil
+}
+
+// mongoWriteConcern returns the write concern of cfg, or nil for the default of
+// the deployment
+func mongoWriteConcern(cfg MongoConfig) *writeconcern.WriteConcern {
+	if cfg.WriteConcern == "" && !cfg.Journal && cfg.WriteTimeout == 0 {
+		return nil
+	}
+	writeConcern := &writeconcern.WriteConcern{WTimeout: cfg.WriteTimeout}
+	if w, err := strconv.Atoi(cfg.WriteConcern); err == nil {
+		writeConcern.W = w
+	} else if cfg.WriteConcern != "" {
+		writeConcern.W = cfg.WriteConcern
+	}
+	if cfg.Journal {
+		journal := true
+		writeConcern.Journal = &journal
+	}
+	return writeConcern
+}
+
+// Name returns the sink name
+func (m *MongoSink) Name() string {
+	return "mongodb"
+}
+
+// Ping checks the primary of the deployment can be reached
+func (m *MongoSink) Ping(ctx context.Context) error {
+	return m.client.Ping(ctx, readpref.Primary())
+}
+
+// Close closes the connections to MongoDB
+func (m *MongoSink) Close() error {
+	return m.client.Disconnect(context.Background())
+}
+
+// Write upserts the records in unordered bulk writes. Records whose upsert failed
+// transiently are returned in a PartialWriteError so only they are retried.
+func (m *MongoSink) Write(ctx context.Context, records []database.ProcessedRecord) error {
+	logger := m.logger.ForContext(ctx)
+	if len(records) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	defer func() {
+		m.metrics.SinkWriteDuration.WithLabelValues(m.Name()).Observe(time.Since(start).Seconds())
+	}()
+	if !m.indexReady {
+		if err := m.createIndex(ctx); err != nil {
+			m.metrics.SinkWriteErrorsTotal.WithLabelValues(m.Name()).Add(float64(len(records)))
+			return err
+		}
+		m.indexReady = true
+	}
+
+	// The last record of a key wins, as upserts of an unordered batch may apply
+	// in any order
+	records = lastByKey(records, m.cfg.Keys)
+	var retry []database.ProcessedRecord
+	var retryErr error
+	written, rejected := 0, 0
+	for offset := 0; offset < len(records); offset += mongoBatchSize {
+		chunk := records[offset:min(offset+mongoBatchSize, len(records))]
+		commandCtx, cancel := m.commandContext(ctx)
+		result, err := m.collection.bulkWrite(commandCtx, m.upserts(chunk))
+		cancel()
+		var bulkErr mongo.BulkWriteException
+		if err != nil && !errors.As(err, &bulkErr) {
+			retry = append(retry, records[offset:]...)
+			retryErr = err
+			break
+		}
+		if result != nil {
+			m.metrics.MongoDocumentsTotal.WithLabelValues("upserted").Add(float64(result.UpsertedCount))
+			m.metrics.MongoDocumentsTotal.WithLabelValues("matched").Add(float64(result.MatchedCount))
+		}
+
+		failed := make(map[int]bool, len(bulkErr.WriteErrors))
+		for _, writeErr := range bulkErr.WriteErrors {
+			failed[writeErr.Index] = true
+			if mongoRetryable(writeErr.Code) {
+				retry = append(retry, chunk[writeErr.Index])
+				retryErr = writeErr
+				continue
+			}
+			rejected++
+			logger.Error(fmt.Sprintf("MongoDB rejected the document of %s, dropping it: %v", m.describe(chunk[writeErr.Index]), writeErr))
+		}
+		if bulkErr.WriteConcernError != nil {
+			// The other upserts were applied but not acknowledged as configured;
+			// repeating them is harmless
+			for i, record := range chunk {
+				if !failed[i] {
+					retry = append(retry, record)
+				}
+			}
+			retryErr = bulkErr.WriteConcernError
+			continue
+		}
+		written += len(chunk) - len(failed)
+	}
+
+	if rejected > 0 {
+		m.metrics.MongoDocumentsTotal.WithLabelValues("rejected").Add(float64(rejected))
+	}
+	m.metrics.SinkRecordsWrittenTotal.WithLabelValues(m.Name()).Add(float64(written))
+	if len(retry) > 0 {
+		m.metrics.SinkWriteErrorsTotal.WithLabelValues(m.Name()).Add(float64(len(retry)))
+		return &PartialWriteError{Remaining: retry, Err: retryErr}
+	}
+	logger.Info(fmt.Sprintf("MongoDB upsert successful: %d documents into %s.%s", written, m.cfg.Database, m.cfg.Collection))
+	return nil
+}
+
+// mongoRetryable reports whether retrying an upsert that failed with code may
+// succeed: a duplicate key from a concurrent upsert of the key, or a failover or
+// timeout of the server
+func mongoRetryable(code int) bool {
+	switch code {
+	case mongoDuplicateKey:
+		return true
+	case 6, 7, 89, 9001: // HostUnreachable, HostNotFound, NetworkTimeout, SocketException
+		return true
+	case 91, 11600, 11602: // ShutdownInProgress, InterruptedAtShutdown, InterruptedDueToReplStateChange
+		return true
+	case 189, 10107, 13435, 13436: // PrimarySteppedDown, NotWritablePrimary, NotPrimaryNoSecondaryOk, NotPrimaryOrSecondary
+		return true
+	case 50, 64, 262: // MaxTimeMSExpired, WriteConcernFailed, ExceededTimeLimit
+		return true
+	}
+	return false
+}
+
+// createIndex creates the unique index of the keys, which makes upserts by them
+// fast and prevents concurrent upserts from inserting a key twice
+func (m *MongoSink) createIndex(ctx context.Context) error {
+	keys := make(bson.D, 0, len(m.cfg.Keys))
+	for _, key := range m.cfg.Keys {
+		keys = append(keys, bson.E{Key: key, Value: 1})
+	}
+	commandCtx, cancel := m.commandContext(ctx)
+	defer cancel()
+	err := m.collection.createIndex(commandCtx, mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetName("etl_" + strings.Join(m.cfg.Keys, "_")).SetUnique(true),
+	})
+	var commandErr mongo.CommandError
+	// 85 and 86 are an index of the keys existing under another name or options
+	if errors.As(err, &commandErr) && (commandErr.Code == 85 || commandErr.Code == 86) {
+		m.logger.ForContext(ctx).Warn(fmt.Sprintf("Using the existing MongoDB index of %s: %v", strings.Join(m.cfg.Keys, ", "), err))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create mongo index: %w", err)
+	}
+	return nil
+}
+
+// commandContext bounds a command by the configured timeout
+func (m *MongoSink) commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.cfg.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, m.cfg.Timeout)
+}
+
+// upserts returns the upsert of each record by its key
+func (m *MongoSink) upserts(records []database.ProcessedRecord) []mongo.WriteModel {
+	models := make([]mongo.WriteModel, len(records))
+	for i, record := range records {
+		row := transform.Row(record)
+		filter := make(bson.D, 0, len(m.cfg.Keys))
+		for _, key := range m.cfg.Keys {
+			filter = append(filter, bson.E{Key: key, Value: row[key]})
+		}
+		fields := make(bson.D, 0, len(transform.Fields))
+		for _, field := range transform.Fields {
+			fields = append(fields, bson.E{Key: field.Name, Value: row[field.Name]})
+		}
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(bson.D{{Key: "$set", Value: fields}}).
+			SetUpsert(true)
+	}
+	return models
+}
+
+// describe names a record by its key for logs
+func (m *MongoSink) describe(record database.ProcessedRecord) string {
+	row := transform.Row(record)
+	parts := make([]string, len(m.cfg.Keys))
+	for i, key := range m.cfg.Keys {
+		parts[i] = fmt.Sprintf("%s=%v", key, row[key])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,156 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// fakeCollection records the index and bulk writes of a sink, answering bulk
+// writes with reply
+type fakeCollection struct {
+	indexes []mongo.IndexModel
+	writes  [][]mongo.WriteModel
+	reply   func(models []mongo.WriteModel) (*mongo.BulkWriteResult, error)
+}
+
+func (f *fakeCollection) createIndex(ctx context.Context, index mongo.IndexModel) error {
+	f.indexes = append(f.indexes, index)
+	return nil
+}
+
+func (f *fakeCollection) bulkWrite(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	f.writes = append(f.writes, models)
+	return f.reply(models)
+}
+
+func newTestMongoSink(t *testing.T, keys []string, collection *fakeCollection) *MongoSink {
+	logger, _ := logging.NewLogger("test.log")
+	t.Cleanup(func() { logger.Close() })
+	mongoSink, err := NewMongoSink(MongoConfig{
+		URI:        "mongodb://127.0.0.1:27017/analytics",
+		Collection: "posts",
+		Keys:       keys,
+		Timeout:    time.Second,
+	}, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewMongoSink: %v", err)
+	}
+	t.Cleanup(func() { mongoSink.Close() })
+	mongoSink.collection = collection
+	return mongoSink
+}
+
+func TestMongoSinkWrite(t *testing.T) {
+	collection := &fakeCollection{reply: func(models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+		return &mongo.BulkWriteResult{MatchedCount: 1, UpsertedCount: 1}, nil
+	}}
+	mongoSink := newTestMongoSink(t, []string{"user_id", "title"}, collection)
+	if mongoSink.cfg.Database != "analytics" {
+		t.Errorf("Expected the database of the URI, got %q", mongoSink.cfg.Database)
+	}
+
+	records := []database.ProcessedRecord{
+		{UserID: 1, Title: "First", Body: "old"},
+		{UserID: 2, Title: "Second"},
+		{UserID: 1, Title: "First", Body: "new"},
+	}
+	if err := mongoSink.Write(context.Background(), records); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if len(collection.indexes) != 1 || *collection.indexes[0].Options.Name != "etl_user_id_title" || !*collection.indexes[0].Options.Unique {
+		t.Fatalf("Expected the unique key index to be created before the upserts, got %v", collection.indexes)
+	}
+	if len(collection.writes) != 1 || len(collection.writes[0]) != 2 {
+		t.Fatalf("Expected one upsert per key, got %v", collection.writes)
+	}
+	first := collection.writes[0][0].(*mongo.UpdateOneModel)
+	filter := first.Filter.(bson.D)
+	set := first.Update.(bson.D)[0].Value.(bson.D)
+	if filter.Map()["user_id"] != 1 || filter.Map()["title"] != "First" || set.Map()["body"] != "new" || !*first.Upsert {
+		t.Errorf("Expected the last record of the key upserted by it, got %+v", first)
+	}
+
+	// The index is created once
+	if err := mongoSink.Write(context.Background(), records[:1]); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(collection.indexes) != 1 {
+		t.Errorf("Expected the index to be created once, got %d", len(collection.indexes))
+	}
+}
+
+func TestMongoSinkClassifiesErrors(t *testing.T) {
+	var reply error
+	collection := &fakeCollection{reply: func(models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+		return &mongo.BulkWriteResult{}, reply
+	}}
+	mongoSink := newTestMongoSink(t, []string{"user_id"}, collection)
+	records := []database.ProcessedRecord{{UserID: 1, Title: "Invalid"}, {UserID: 2, Title: "Raced"}, {UserID: 3, Title: "Written"}}
+	writeErrors := []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 0, Code: 121, Message: "Document failed validation"}},
+		{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "E11000 duplicate key error"}},
+	}
+
+	// The invalid document is dropped, the raced one retried
+	reply = mongo.BulkWriteException{WriteErrors: writeErrors}
+	err := mongoSink.Write(context.Background(), records)
+	var partial *PartialWriteError
+	if !errors.As(err, &partial) || len(partial.Remaining) != 1 || partial.Remaining[0].UserID != 2 {
+		t.Fatalf("Expected only the raced record to be retried, got %v", err)
+	}
+
+	// Without the write concern, the applied upserts are repeated too, each once,
+	// and the invalid document is still dropped
+	reply = mongo.BulkWriteException{WriteErrors: writeErrors, WriteConcernError: &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"}}
+	err = mongoSink.Write(context.Background(), records)
+	if !errors.As(err, &partial) || len(partial.Remaining) != 2 || partial.Remaining[0].UserID != 2 || partial.Remaining[1].UserID != 3 {
+		t.Fatalf("Expected the raced and the applied record to be retried, got %v", err)
+	}
+
+	reply = mongo.CommandError{Code: 10107, Name: "NotWritablePrimary", Labels: []string{"RetryableWriteError"}}
+	err = mongoSink.Write(context.Background(), records)
+	var commandErr mongo.CommandError
+	if !errors.As(err, &partial) || len(partial.Remaining) != 3 || !errors.As(err, &commandErr) || !commandErr.HasErrorLabel("RetryableWriteError") {
+		t.Errorf("Expected the batch to be retried after a failover, got %v", err)
+	}
+}
+
+func TestNewMongoSinkValidates(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	for name, cfg := range map[string]MongoConfig{
+		"unknown key":   {URI: "mongodb://127.0.0.1/analytics", Keys: []string{"missing"}},
+		"no database":   {URI: "mongodb://127.0.0.1", Keys: []string{"user_id"}},
+		"system":        {URI: "mongodb://127.0.0.1/analytics", Collection: "system.users", Keys: []string{"user_id"}},
+		"invalid uri":   {URI: "postgres://127.0.0.1/analytics", Keys: []string{"user_id"}},
+		"no key fields": {URI: "mongodb://127.0.0.1/analytics"},
+	} {
+		if _, err := NewMongoSink(cfg, logger, metrics.NewMetrics()); err == nil {
+			t.Errorf("%s: expected the config to be rejected", name)
+		}
+	}
+}
+
+func TestMongoWriteConcern(t *testing.T) {
+	if wc := mongoWriteConcern(MongoConfig{}); wc != nil {
+		t.Errorf("Expected the default write concern, got %+v", wc)
+	}
+	wc := mongoWriteConcern(MongoConfig{WriteConcern: "majority", Journal: true, WriteTimeout: 5 * time.Second})
+	if wc.W != "majority" || wc.Journal == nil || !*wc.Journal || wc.WTimeout != 5*time.Second {
+		t.Errorf("Expected the configured write concern, got %+v", wc)
+	}
+	if wc := mongoWriteConcern(MongoConfig{WriteConcern: "2"}); wc.W != 2 {
+		t.Errorf("Expected a number of members, got %+v", wc)
+	}
+}
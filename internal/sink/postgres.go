@@ -0,0 +1,153 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// PostgresSinkName is the name of the PostgreSQL sink
+const PostgresSinkName = "postgres"
+
+// PostgresSink loads processed records into the processed_data table
+type PostgresSink struct {
+	db      *database.PostgresDB
+	metrics *metrics.Metrics
+	workers int
+	// partitionKey is the processed field records are partitioned by; empty
+	// partitions them by source id
+	partitionKey string
+}
+
+// NewPostgresSink creates a sink backed by the PostgreSQL database
+func NewPostgresSink(db *database.PostgresDB, metrics *metrics.Metrics) *PostgresSink {
+	return &PostgresSink{
+		db:      db,
+		metrics: metrics,
+		workers: 1,
+	}
+}
+
+// SetWorkers writes each batch with up to workers concurrent transactions. Records
+// are partitioned by their key, the source id unless SetPartitionKey names a
+// field, so the records of a key are always written by the same transaction in
+// batch order.
+func (p *PostgresSink) SetWorkers(workers int) {
+	p.workers = max(workers, 1)
+}
+
+// SetPartitionKey partitions records by the processed field named field instead
+// of their source id, e.g. user_id to keep the records of a user in order
+func (p *PostgresSink) SetPartitionKey(field string) error {
+	for _, f := range transform.Fields {
+		if f.Name == field {
+			p.partitionKey = field
+			return nil
+		}
+	}
+	return fmt.Errorf("postgres partition key %q is not a processed field", field)
+}
+
+// Name returns the sink name
+func (p *PostgresSink) Name() string {
+	return PostgresSinkName
+}
+
+// Write inserts the records into processed_data, tagged with the run carried by ctx.
+// With several workers a failure returns a PartialWriteError holding the records
+// of the partitions that were not written.
+func (p *PostgresSink) Write(ctx context.Context, records []database.ProcessedRecord) error {
+	partitions := partitionByKey(records, p.workers, p.recordKey)
+	if len(partitions) <= 1 {
+		return p.write(ctx, records)
+	}
+
+	errs := make([]error, len(partitions))
+	var wg sync.WaitGroup
+	for i, partition := range partitions {
+		wg.Add(1)
+		go func(i int, partition []database.ProcessedRecord) {
+			defer wg.Done()
+			errs[i] = p.write(ctx, partition)
+		}(i, partition)
+	}
+	wg.Wait()
+
+	var remaining []database.ProcessedRecord
+	var firstErr error
+	failed := 0
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		remaining = append(remaining, partitions[i]...)
+		if firstErr == nil {
+			firstErr = err
+		}
+		failed++
+	}
+	if firstErr == nil {
+		return nil
+	}
+	return &PartialWriteError{
+		Remaining: remaining,
+		Err:       fmt.Errorf("%d of %d partitions failed: %w", failed, len(partitions), firstErr),
+	}
+}
+
+// write inserts records in a single transaction
+func (p *PostgresSink) write(ctx context.Context, records []database.ProcessedRecord) error {
+	p.metrics.DatabaseWritesTotal.Inc()
+	if err := p.db.InsertProcessedData(ctx, runid.FromContext(ctx), records); err != nil {
+		p.metrics.DatabaseWriteErrorsTotal.WithLabelValues(database.ErrorReason(err)).Inc()
+		p.metrics.SinkWriteErrorsTotal.WithLabelValues(p.Name()).Add(float64(len(records)))
+		return err
+	}
+	p.metrics.SinkRecordsWrittenTotal.WithLabelValues(p.Name()).Add(float64(len(records)))
+	return nil
+}
+
+// recordKey returns the partition key of a record: the value of the partition key
+// field, or else its source id. Records without a source id fall back to the hash
+// of their source payload, so repeats of a payload stay together.
+func (p *PostgresSink) recordKey(record database.ProcessedRecord) string {
+	if p.partitionKey != "" {
+		return fmt.Sprint(transform.Row(record)[p.partitionKey])
+	}
+	if record.Lineage == nil {
+		return ""
+	}
+	if record.Lineage.SourceID != "" {
+		return record.Lineage.SourceID
+	}
+	return record.Lineage.SourceHash
+}
+
+// partitionByKey splits records into at most n partitions by the key returned by
+// key, keeping the batch order within each partition. Empty partitions are left
+// out.
+func partitionByKey(records []database.ProcessedRecord, n int, key func(database.ProcessedRecord) string) [][]database.ProcessedRecord {
+	if n <= 1 || len(records) <= 1 {
+		return [][]database.ProcessedRecord{records}
+	}
+	buckets := make([][]database.ProcessedRecord, n)
+	for _, record := range records {
+		hash := fnv.New32a()
+		hash.Write([]byte(key(record)))
+		bucket := hash.Sum32() % uint32(n)
+		buckets[bucket] = append(buckets[bucket], record)
+	}
+	partitions := buckets[:0]
+	for _, bucket := range buckets {
+		if len(bucket) > 0 {
+			partitions = append(partitions, bucket)
+		}
+	}
+	return partitions
+}
@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+func TestPartitionByKey(t *testing.T) {
+	var records []database.ProcessedRecord
+	for i := 0; i < 200; i++ {
+		records = append(records, database.ProcessedRecord{UserID: i % 20, Title: string(rune('a' + i%26))})
+	}
+
+	postgresSink := &PostgresSink{}
+	if err := postgresSink.SetPartitionKey("user_id"); err != nil {
+		t.Fatalf("SetPartitionKey failed: %v", err)
+	}
+	partitions := partitionByKey(records, 4, postgresSink.recordKey)
+	if len(partitions) < 2 || len(partitions) > 4 {
+		t.Fatalf("Expected 2 to 4 partitions, got %d", len(partitions))
+	}
+	owner := make(map[int]int)
+	positions := make(map[database.ProcessedRecord][]int)
+	for i, record := range records {
+		positions[record] = append(positions[record], i)
+	}
+	total := 0
+	for p, partition := range partitions {
+		total += len(partition)
+		last := -1
+		for _, record := range partition {
+			if other, ok := owner[record.UserID]; ok && other != p {
+				t.Fatalf("Expected user %d in a single partition, found in %d and %d", record.UserID, other, p)
+			}
+			owner[record.UserID] = p
+			position := positions[record][0]
+			positions[record] = positions[record][1:]
+			if position < last {
+				t.Fatalf("Expected partition %d to keep the batch order", p)
+			}
+			last = position
+		}
+	}
+	if total != len(records) {
+		t.Errorf("Expected %d records across partitions, got %d", len(records), total)
+	}
+
+	if single := partitionByKey(records, 1, postgresSink.recordKey); len(single) != 1 || len(single[0]) != len(records) {
+		t.Errorf("Expected a single partition with one worker, got %d", len(single))
+	}
+	if err := postgresSink.SetPartitionKey("author"); err == nil {
+		t.Error("Expected a partition key that is not a processed field to be rejected")
+	}
+}
+
+func TestPartitionBySourceID(t *testing.T) {
+	postgresSink := &PostgresSink{}
+	var records []database.ProcessedRecord
+	for i := 0; i < 100; i++ {
+		// Records of a source id have different users
+		records = append(records, database.ProcessedRecord{
+			UserID:  i,
+			Lineage: &database.Lineage{SourceID: string(rune('a' + i%10))},
+		})
+	}
+
+	partitions := partitionByKey(records, 4, postgresSink.recordKey)
+	if len(partitions) < 2 {
+		t.Fatalf("Expected several partitions, got %d", len(partitions))
+	}
+	owner := make(map[string]int)
+	for p, partition := range partitions {
+		for _, record := range partition {
+			id := record.Lineage.SourceID
+			if other, ok := owner[id]; ok && other != p {
+				t.Fatalf("Expected source id %s in a single partition, found in %d and %d", id, other, p)
+			}
+			owner[id] = p
+		}
+	}
+}
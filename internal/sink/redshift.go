@@ -0,0 +1,452 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+var (
+	redshiftIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+	iamRoleARN         = regexp.MustCompile(`^arn:aws[a-z-]*:iam::[0-9]{12}:role/[A-Za-z0-9+=,.@_/-]+$`)
+)
+
+const (
+	// redshiftPollInterval spaces the polls of statements still running
+	redshiftPollInterval = time.Second
+	// redshiftLoadErrorLimit bounds the load errors reported for a failed COPY
+	redshiftLoadErrorLimit = 10
+)
+
+// RedshiftConfig holds the settings for the Redshift sink
+type RedshiftConfig struct {
+	// ClusterIdentifier names a provisioned cluster, WorkgroupName a serverless
+	// workgroup; exactly one is set
+	ClusterIdentifier string
+	WorkgroupName     string
+	Database          string
+	// DbUser connects to a cluster with temporary credentials; SecretARN holds
+	// the credentials in Secrets Manager instead
+	DbUser    string
+	SecretARN string
+	Schema    string
+	Table     string
+	// IAMRole is the role Redshift assumes to read the staged files
+	IAMRole string
+	// StageBucket and StagePrefix locate the staged files of the uploader
+	StageBucket string
+	StagePrefix string
+	// Endpoint defaults to the Redshift Data API endpoint of Region
+	Endpoint    string
+	Region      string
+	Credentials awsauth.Credentials
+}
+
+// RedshiftSink loads processed batches into a Redshift table by staging them as
+// files in S3 and copying them in with COPY, through the Redshift Data API. Each
+// batch is described by a manifest, so COPY loads exactly the file of the batch.
+type RedshiftSink struct {
+	cfg        RedshiftConfig
+	stage      StageUploader
+	httpClient *http.Client
+	logger     *logging.Logger
+	metrics    *metrics.Metrics
+	tableReady bool
+
+	mu sync.Mutex
+	// copies are the COPY statements submitted by manifest, so a retried batch
+	// waits for its earlier COPY rather than loading the file twice
+	copies map[string]string
+}
+
+// RedshiftLoadError is a row rejected by COPY, as recorded in sys_load_error_detail
+type RedshiftLoadError struct {
+	File    string
+	Line    int64
+	Column  string
+	Code    int64
+	Message string
+}
+
+// RedshiftStatementError is a statement that failed or was aborted, with the
+// rows rejected by a COPY
+type RedshiftStatementError struct {
+	Status     string
+	Message    string
+	LoadErrors []RedshiftLoadError
+}
+
+func (e *RedshiftStatementError) Error() string {
+	message := fmt.Sprintf("redshift statement %s: %s", strings.ToLower(e.Status), e.Message)
+	for _, loadErr := range e.LoadErrors {
+		message += fmt.Sprintf("; line %d column %s: %d %s", loadErr.Line, loadErr.Column, loadErr.Code, loadErr.Message)
+	}
+	return message
+}
+
+// NewRedshiftSink creates a sink staging batches with stage and loading them into
+// the table of cfg
+func NewRedshiftSink(cfg RedshiftConfig, stage StageUploader, logger *logging.Logger, metrics *metrics.Metrics) (*RedshiftSink, error) {
+	if (cfg.ClusterIdentifier == "") == (cfg.WorkgroupName == "") {
+		return nil, fmt.Errorf("redshift requires either a cluster identifier or a workgroup name")
+	}
+	if cfg.ClusterIdentifier != "" && cfg.DbUser == "" && cfg.SecretARN == "" {
+		return nil, fmt.Errorf("redshift cluster requires a database user or a secret ARN")
+	}
+	if cfg.Database == "" || cfg.StageBucket == "" {
+		return nil, fmt.Errorf("redshift database and stage bucket are required")
+	}
+	if !iamRoleARN.MatchString(cfg.IAMRole) {
+		return nil, fmt.Errorf("invalid redshift IAM role %q", cfg.IAMRole)
+	}
+	if cfg.Schema == "" {
+		cfg.Schema = "public"
+	}
+	if cfg.Table == "" {
+		cfg.Table = "processed_data"
+	}
+	for _, identifier := range []string{cfg.Schema, cfg.Table} {
+		if !redshiftIdentifier.MatchString(identifier) {
+			return nil, fmt.Errorf("invalid redshift identifier %q", identifier)
+		}
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://redshift-data." + cfg.Region + ".amazonaws.com"
+	}
+	if endpoint, err := url.Parse(cfg.Endpoint); err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid redshift endpoint %q", cfg.Endpoint)
+	}
+	return &RedshiftSink{
+		cfg:        cfg,
+		stage:      stage,
+		httpClient: &http.Client{Timeout: time.Minute},
+		logger:     logger,
+		metrics:    metrics,
+		copies:     make(map[string]string),
+	}, nil
+}
+
+// Name returns the sink name
+func (r *RedshiftSink) Name() string {
+	return "redshift"
+}
+
+// Write stages the batch as a gzipped NDJSON file with its manifest and copies it
+// into the table
+func (r *RedshiftSink) Write(ctx context.Context, records []database.ProcessedRecord) error {
+	logger := r.logger.ForContext(ctx)
+	if len(records) == 0 {
+		return nil
+	}
+
+	started := time.Now()
+	defer func() {
+		r.metrics.SinkWriteDuration.WithLabelValues(r.Name()).Observe(time.Since(started).Seconds())
+	}()
+	if err := r.load(ctx, records); err != nil {
+		r.metrics.SinkWriteErrorsTotal.WithLabelValues(r.Name()).Add(float64(len(records)))
+		var statementErr *RedshiftStatementError
+		if errors.As(err, &statementErr) {
+			for _, loadErr := range statementErr.LoadErrors {
+				logger.Error(fmt.Sprintf("Redshift rejected line %d of %s, column %s: %d %s", loadErr.Line, loadErr.File, loadErr.Column, loadErr.Code, loadErr.Message))
+			}
+		}
+		return err
+	}
+	r.metrics.SinkRecordsWrittenTotal.WithLabelValues(r.Name()).Add(float64(len(records)))
+	logger.Info(fmt.Sprintf("Redshift load successful: %d rows into %s", len(records), r.table()))
+	return nil
+}
+
+func (r *RedshiftSink) load(ctx context.Context, records []database.ProcessedRecord) error {
+	if !r.tableReady {
+		if err := r.execute(ctx, r.createTable()); err != nil {
+			return fmt.Errorf("failed to create redshift table: %w", err)
+		}
+		r.tableReady = true
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, record := range records {
+		if err := encoder.Encode(transform.Row(record)); err != nil {
+			return fmt.Errorf("failed to marshal record: %w", err)
+		}
+	}
+	gzipCodec, _ := codec.Get(codec.Gzip)
+	data, err := codec.Compress(gzipCodec, body.Bytes())
+	if err != nil {
+		return err
+	}
+	// Files are named by their run and content so a retried batch is the same file
+	digest := sha256.Sum256(body.Bytes())
+	name := "processed_" + hex.EncodeToString(digest[:12])
+	if runID := runid.FromContext(ctx); runID != "" {
+		name = "processed_" + runID + "_" + hex.EncodeToString(digest[:12])
+	}
+	prefix := path.Join(r.cfg.StagePrefix, time.Now().UTC().Format("2006/01/02"))
+	fileKey := path.Join(prefix, name+".ndjson.gz")
+	manifestKey := path.Join(prefix, name+".manifest")
+	if err := r.stage.PutObject(ctx, fileKey, data, "application/x-ndjson", nil); err != nil {
+		return fmt.Errorf("failed to stage redshift file: %w", err)
+	}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"entries": []map[string]interface{}{{"url": r.s3URL(fileKey), "mandatory": true}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal redshift manifest: %w", err)
+	}
+	if err := r.stage.PutObject(ctx, manifestKey, manifest, "application/json", nil); err != nil {
+		return fmt.Errorf("failed to stage redshift manifest: %w", err)
+	}
+
+	if err := r.copy(ctx, manifestKey); err != nil {
+		var statementErr *RedshiftStatementError
+		if errors.As(err, &statementErr) && statementErr.Status == "FAILED" {
+			loadErrors, queryErr := r.loadErrors(ctx, r.s3URL(fileKey))
+			if queryErr != nil {
+				r.logger.ForContext(ctx).Warn(fmt.Sprintf("Failed to read Redshift load errors of %s: %v", fileKey, queryErr))
+			}
+			statementErr.LoadErrors = loadErrors
+		}
+		return err
+	}
+	return nil
+}
+
+// copy runs the COPY of a manifest, or waits for the one already submitted for it
+// if it did not fail
+func (r *RedshiftSink) copy(ctx context.Context, manifestKey string) error {
+	r.mu.Lock()
+	id, submitted := r.copies[manifestKey]
+	r.mu.Unlock()
+	var statementErr *RedshiftStatementError
+	if submitted {
+		err := r.wait(ctx, id)
+		if err == nil {
+			r.forget(manifestKey)
+		}
+		if !errors.As(err, &statementErr) {
+			return err
+		}
+	}
+
+	statement := fmt.Sprintf("COPY %s FROM '%s' IAM_ROLE '%s' FORMAT AS JSON 'auto' GZIP MANIFEST REGION '%s'",
+		r.table(), sqlString(r.s3URL(manifestKey)), r.cfg.IAMRole, sqlString(r.cfg.Region))
+	id, err := r.submit(ctx, statement)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.copies[manifestKey] = id
+	r.mu.Unlock()
+
+	// Only a COPY whose outcome is unknown is waited for again
+	err = r.wait(ctx, id)
+	if err == nil || errors.As(err, &statementErr) {
+		r.forget(manifestKey)
+	}
+	return err
+}
+
+func (r *RedshiftSink) forget(manifestKey string) {
+	r.mu.Lock()
+	delete(r.copies, manifestKey)
+	r.mu.Unlock()
+}
+
+// loadErrors returns the rows of a staged file rejected by COPY
+func (r *RedshiftSink) loadErrors(ctx context.Context, file string) ([]RedshiftLoadError, error) {
+	statement := fmt.Sprintf("SELECT TRIM(file_name), line_number, TRIM(column_name), error_code, TRIM(error_message) FROM sys_load_error_detail WHERE TRIM(file_name) = '%s' ORDER BY start_time DESC, line_number LIMIT %d",
+		sqlString(file), redshiftLoadErrorLimit)
+	id, err := r.submit(ctx, statement)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.wait(ctx, id); err != nil {
+		return nil, err
+	}
+	var result struct {
+		Records [][]redshiftField
+	}
+	if err := r.call(ctx, "GetStatementResult", map[string]string{"Id": id}, &result); err != nil {
+		return nil, err
+	}
+	loadErrors := make([]RedshiftLoadError, 0, len(result.Records))
+	for _, row := range result.Records {
+		if len(row) != 5 {
+			continue
+		}
+		loadErrors = append(loadErrors, RedshiftLoadError{
+			File:    row[0].StringValue,
+			Line:    row[1].LongValue,
+			Column:  row[2].StringValue,
+			Code:    row[3].LongValue,
+			Message: row[4].StringValue,
+		})
+	}
+	return loadErrors, nil
+}
+
+// redshiftField is a value of a result row of the Data API
+type redshiftField struct {
+	StringValue string `json:"stringValue"`
+	LongValue   int64  `json:"longValue"`
+	IsNull      bool   `json:"isNull"`
+}
+
+// table returns the qualified name of the table
+func (r *RedshiftSink) table() string {
+	return r.cfg.Schema + "." + r.cfg.Table
+}
+
+// createTable returns the statement creating the table from the processed fields
+func (r *RedshiftSink) createTable() string {
+	columns := make([]string, 0, len(transform.Fields))
+	for _, field := range transform.Fields {
+		column := field.Name + " " + redshiftType(field.Type)
+		if field.Required {
+			column += " NOT NULL"
+		}
+		columns = append(columns, column)
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", r.table(), strings.Join(columns, ", "))
+}
+
+func redshiftType(fieldType string) string {
+	switch fieldType {
+	case transform.FieldTypeInteger:
+		return "BIGINT"
+	default:
+		return "VARCHAR(65535)"
+	}
+}
+
+// s3URL returns the URL of a staged object
+func (r *RedshiftSink) s3URL(key string) string {
+	return "s3://" + r.cfg.StageBucket + "/" + key
+}
+
+// sqlString escapes s for a single quoted SQL literal
+func sqlString(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+// execute runs a statement and waits for it to finish
+func (r *RedshiftSink) execute(ctx context.Context, statement string) error {
+	id, err := r.submit(ctx, statement)
+	if err != nil {
+		return err
+	}
+	return r.wait(ctx, id)
+}
+
+// submit starts a statement, returning its ID
+func (r *RedshiftSink) submit(ctx context.Context, statement string) (string, error) {
+	request := map[string]string{
+		"Database":      r.cfg.Database,
+		"Sql":           statement,
+		"StatementName": "etl-pipeline",
+	}
+	if r.cfg.ClusterIdentifier != "" {
+		request["ClusterIdentifier"] = r.cfg.ClusterIdentifier
+	} else {
+		request["WorkgroupName"] = r.cfg.WorkgroupName
+	}
+	if r.cfg.SecretARN != "" {
+		request["SecretArn"] = r.cfg.SecretARN
+	} else if r.cfg.DbUser != "" {
+		request["DbUser"] = r.cfg.DbUser
+	}
+	var response struct {
+		ID string `json:"Id"`
+	}
+	if err := r.call(ctx, "ExecuteStatement", request, &response); err != nil {
+		return "", err
+	}
+	return response.ID, nil
+}
+
+// wait polls a statement until it finishes, returning a RedshiftStatementError
+// if it failed or was aborted
+func (r *RedshiftSink) wait(ctx context.Context, id string) error {
+	for {
+		var status struct {
+			Status string
+			Error  string
+		}
+		if err := r.call(ctx, "DescribeStatement", map[string]string{"Id": id}, &status); err != nil {
+			return err
+		}
+		switch status.Status {
+		case "FINISHED":
+			return nil
+		case "FAILED", "ABORTED":
+			return &RedshiftStatementError{Status: status.Status, Message: status.Error}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(redshiftPollInterval):
+		}
+	}
+}
+
+// call sends a signed request of the Data API and decodes its response
+func (r *RedshiftSink) call(ctx context.Context, action string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode redshift %s request: %w", action, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create redshift request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "RedshiftData."+action)
+	awsauth.Sign(req, r.cfg.Credentials, r.cfg.Region, "redshift-data", awsauth.PayloadHash(body), time.Now())
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("redshift %s request failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		content, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(content, &failure) == nil && failure.Type != "" {
+			return fmt.Errorf("redshift %s returned %s: %s", action, failure.Type[strings.LastIndex(failure.Type, "#")+1:], failure.Message)
+		}
+		return fmt.Errorf("redshift %s returned status %d: %s", action, resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode redshift %s response: %w", action, err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// fakeRedshiftData serves the Redshift Data API, running statements instantly and
+// failing the COPY statements while failCopy is set
+type fakeRedshiftData struct {
+	statements []string
+	failCopy   bool
+}
+
+func (f *fakeRedshiftData) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") || !strings.Contains(r.Header.Get("Authorization"), "/redshift-data/aws4_request") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var request struct {
+		ID                string `json:"Id"`
+		Sql               string
+		ClusterIdentifier string
+		DbUser            string
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "RedshiftData.") {
+	case "ExecuteStatement":
+		if request.ClusterIdentifier != "analytics" || request.DbUser != "etl" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type": "ValidationException", "message": "cluster and user are required"}`))
+			return
+		}
+		f.statements = append(f.statements, request.Sql)
+		json.NewEncoder(w).Encode(map[string]string{"Id": fmt.Sprint(len(f.statements) - 1)})
+	case "DescribeStatement":
+		var index int
+		fmt.Sscan(request.ID, &index)
+		if f.failCopy && strings.HasPrefix(f.statements[index], "COPY") {
+			json.NewEncoder(w).Encode(map[string]string{"Status": "FAILED", "Error": "Load into table 'processed_data' failed. Check 'sys_load_error_detail' system table for details."})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"Status": "FINISHED"})
+	case "GetStatementResult":
+		w.Write([]byte(`{"Records": [[{"stringValue": "s3://etl-redshift/batch.ndjson.gz"}, {"longValue": 2}, {"stringValue": "title"}, {"longValue": 1204}, {"stringValue": "String length exceeds DDL length"}]]}`))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestRedshiftSinkWrite(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	data := &fakeRedshiftData{}
+	server := httptest.NewServer(data)
+	defer server.Close()
+	stage := &memoryStage{files: map[string][]byte{}}
+	redshiftSink, err := NewRedshiftSink(RedshiftConfig{
+		ClusterIdentifier: "analytics",
+		Database:          "dev",
+		DbUser:            "etl",
+		IAMRole:           "arn:aws:iam::123456789012:role/redshift-copy",
+		StageBucket:       "etl-redshift",
+		StagePrefix:       "batches",
+		Endpoint:          server.URL,
+	}, stage, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewRedshiftSink: %v", err)
+	}
+
+	records := []database.ProcessedRecord{{UserID: 1, Title: "First"}, {UserID: 2, Title: "Second"}}
+	if err := redshiftSink.Write(context.Background(), records); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var file, manifest string
+	for key := range stage.files {
+		switch {
+		case strings.HasSuffix(key, ".ndjson.gz"):
+			file = key
+		case strings.HasSuffix(key, ".manifest"):
+			manifest = key
+		}
+	}
+	if !strings.HasPrefix(file, "batches/") || manifest == "" {
+		t.Fatalf("Expected the batch and its manifest under the stage prefix, got %v", stage.files)
+	}
+	var entries struct {
+		Entries []struct {
+			URL       string
+			Mandatory bool
+		}
+	}
+	if err := json.Unmarshal(stage.files[manifest], &entries); err != nil || len(entries.Entries) != 1 || entries.Entries[0].URL != "s3://etl-redshift/"+file || !entries.Entries[0].Mandatory {
+		t.Errorf("Expected the manifest to list the batch, got %s: %v", stage.files[manifest], err)
+	}
+
+	if len(data.statements) != 2 || !strings.HasPrefix(data.statements[0], "CREATE TABLE IF NOT EXISTS public.processed_data") {
+		t.Fatalf("Expected the table to be created, then the batch copied, got %q", data.statements)
+	}
+	want := fmt.Sprintf("COPY public.processed_data FROM 's3://etl-redshift/%s' IAM_ROLE 'arn:aws:iam::123456789012:role/redshift-copy' FORMAT AS JSON 'auto' GZIP MANIFEST", manifest)
+	if !strings.HasPrefix(data.statements[1], want) {
+		t.Errorf("Expected %s, got %s", want, data.statements[1])
+	}
+}
+
+func TestRedshiftSinkReportsLoadErrors(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	data := &fakeRedshiftData{failCopy: true}
+	server := httptest.NewServer(data)
+	defer server.Close()
+	redshiftSink, err := NewRedshiftSink(RedshiftConfig{
+		ClusterIdentifier: "analytics",
+		Database:          "dev",
+		DbUser:            "etl",
+		IAMRole:           "arn:aws:iam::123456789012:role/redshift-copy",
+		StageBucket:       "etl-redshift",
+		Endpoint:          server.URL,
+	}, &memoryStage{files: map[string][]byte{}}, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewRedshiftSink: %v", err)
+	}
+
+	err = redshiftSink.Write(context.Background(), []database.ProcessedRecord{{UserID: 1, Title: "First"}})
+	var statementErr *RedshiftStatementError
+	if !errors.As(err, &statementErr) || len(statementErr.LoadErrors) != 1 {
+		t.Fatalf("Expected the load errors of the COPY, got %v", err)
+	}
+	if loadErr := statementErr.LoadErrors[0]; loadErr.Line != 2 || loadErr.Column != "title" || loadErr.Code != 1204 {
+		t.Errorf("Expected line 2 of the title column rejected, got %+v", loadErr)
+	}
+	if last := data.statements[len(data.statements)-1]; !strings.Contains(last, "FROM sys_load_error_detail") {
+		t.Errorf("Expected the load errors to be read from sys_load_error_detail, got %s", last)
+	}
+
+	for _, cfg := range []RedshiftConfig{
+		{ClusterIdentifier: "analytics", Database: "dev", DbUser: "etl", StageBucket: "b", IAMRole: "arn:aws:iam::123456789012:role/x' CREDENTIALS '"},
+		{ClusterIdentifier: "analytics", WorkgroupName: "etl", Database: "dev", StageBucket: "b", IAMRole: "arn:aws:iam::123456789012:role/x"},
+		{ClusterIdentifier: "analytics", Database: "dev", StageBucket: "b", IAMRole: "arn:aws:iam::123456789012:role/x"},
+	} {
+		if _, err := NewRedshiftSink(cfg, nil, logger, metrics.NewMetrics()); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+var (
+	metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNamePattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// RemoteWriteConfig holds the settings for the Prometheus remote-write sink
+type RemoteWriteConfig struct {
+	URL string
+	// Metrics maps metric names to the numeric processed field sampled into them
+	Metrics map[string]string
+	// Labels maps label names to the processed field labelling every sample
+	Labels map[string]string
+	// BearerToken, or Username and Password, authenticate the requests
+	BearerToken string
+	Username    string
+	Password    string
+	Timeout     time.Duration
+}
+
+// RemoteWriteSink sends numeric fields of processed records to a Prometheus
+// remote-write endpoint, one sample per configured metric and record, labelled
+// with the configured fields. Samples are timestamped with the source time of
+// their record, or the time they are written without one.
+type RemoteWriteSink struct {
+	cfg        RemoteWriteConfig
+	httpClient *http.Client
+	logger     *logging.Logger
+	metrics    *metrics.Metrics
+	// metricNames are the configured metrics in a stable order
+	metricNames []string
+}
+
+// RemoteWriteStatusError is returned for responses other than 2xx. Samples
+// rejected with a 4xx other than 429 cannot be written by retrying.
+type RemoteWriteStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *RemoteWriteStatusError) Error() string {
+	return fmt.Sprintf("remote write returned status code %d: %s", e.StatusCode, e.Body)
+}
+
+// NewRemoteWriteSink creates a sink writing the fields of cfg to its endpoint
+func NewRemoteWriteSink(cfg RemoteWriteConfig, logger *logging.Logger, metrics *metrics.Metrics) (*RemoteWriteSink, error) {
+	endpoint, err := url.Parse(cfg.URL)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid remote write URL %q", cfg.URL)
+	}
+	if len(cfg.Metrics) == 0 {
+		return nil, fmt.Errorf("remote write requires at least one metric")
+	}
+	metricNames := make([]string, 0, len(cfg.Metrics))
+	for name, field := range cfg.Metrics {
+		if !metricNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid metric name %q", name)
+		}
+		if !isField(field) {
+			return nil, fmt.Errorf("metric %s samples unknown field %q", name, field)
+		}
+		metricNames = append(metricNames, name)
+	}
+	sort.Strings(metricNames)
+	for name, field := range cfg.Labels {
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+		if !isField(field) {
+			return nil, fmt.Errorf("label %s reads unknown field %q", name, field)
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return &RemoteWriteSink{
+		cfg:         cfg,
+		httpClient:  &http.Client{Timeout: cfg.Timeout},
+		logger:      logger,
+		metrics:     metrics,
+		metricNames: metricNames,
+	}, nil
+}
+
+// isField reports whether name is a field of the processed schema
+func isField(name string) bool {
+	for _, field := range transform.Fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the sink name
+func (r *RemoteWriteSink) Name() string {
+	return "prometheus"
+}
+
+// remoteSeries is a time series of a write request: its labels sorted by name,
+// and its samples by time
+type remoteSeries struct {
+	labels  []remoteLabel
+	samples []remoteSample
+}
+
+type remoteLabel struct {
+	name, value string
+}
+
+type remoteSample struct {
+	value     float64
+	timestamp int64
+}
+
+// Write sends the samples of the records in one write request. Fields that are
+// not numeric are skipped. Samples the endpoint rejects as invalid, e.g. out of
+// order, are dropped and logged, as retrying cannot write them.
+func (r *RemoteWriteSink) Write(ctx context.Context, records []database.ProcessedRecord) error {
+	logger := r.logger.ForContext(ctx)
+	if len(records) == 0 {
+		return nil
+	}
+
+	series, samples, skipped := r.series(records, time.Now())
+	if skipped > 0 {
+		r.metrics.RemoteWriteSamplesTotal.WithLabelValues("skipped").Add(float64(skipped))
+		logger.Warn(fmt.Sprintf("Skipped %d remote write samples whose field is not numeric", skipped))
+	}
+	if samples == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	err := r.send(ctx, encodeWriteRequest(series))
+	r.metrics.SinkWriteDuration.WithLabelValues(r.Name()).Observe(time.Since(start).Seconds())
+	var statusErr *RemoteWriteStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 && statusErr.StatusCode != http.StatusTooManyRequests {
+		r.metrics.RemoteWriteSamplesTotal.WithLabelValues("rejected").Add(float64(samples))
+		logger.Error(fmt.Sprintf("Remote write rejected %d samples of %d records, dropping them: %v", samples, len(records), err))
+		return nil
+	}
+	if err != nil {
+		r.metrics.SinkWriteErrorsTotal.WithLabelValues(r.Name()).Add(float64(len(records)))
+		return err
+	}
+
+	r.metrics.RemoteWriteSamplesTotal.WithLabelValues("sent").Add(float64(samples))
+	r.metrics.SinkRecordsWrittenTotal.WithLabelValues(r.Name()).Add(float64(len(records)))
+	logger.Info(fmt.Sprintf("Remote write successful: %d samples in %d series from %d records", samples, len(series), len(records)))
+	return nil
+}
+
+// series groups the samples of the records by label set, timestamping records
+// without a source time with now, and returns them with the number of samples
+// written and skipped
+func (r *RemoteWriteSink) series(records []database.ProcessedRecord, now time.Time) ([]*remoteSeries, int, int) {
+	bySeries := make(map[string]*remoteSeries)
+	var ordered []*remoteSeries
+	samples, skipped := 0, 0
+	for _, record := range records {
+		row := transform.Row(record)
+		timestamp := now
+		if record.SourceTime != nil {
+			timestamp = *record.SourceTime
+		}
+		var labels []remoteLabel
+		for name, field := range r.cfg.Labels {
+			// Prometheus treats empty labels as missing
+			if value := fmt.Sprint(row[field]); value != "" {
+				labels = append(labels, remoteLabel{name: name, value: value})
+			}
+		}
+		for _, name := range r.metricNames {
+			value, ok := numeric(row[r.cfg.Metrics[name]])
+			if !ok {
+				skipped++
+				continue
+			}
+			seriesLabels := append([]remoteLabel{{name: "__name__", value: name}}, labels...)
+			sort.Slice(seriesLabels, func(i, j int) bool { return seriesLabels[i].name < seriesLabels[j].name })
+
+			var key strings.Builder
+			for _, label := range seriesLabels {
+				fmt.Fprintf(&key, "%s=%q,", label.name, label.value)
+			}
+			s, ok := bySeries[key.String()]
+			if !ok {
+				s = &remoteSeries{labels: seriesLabels}
+				bySeries[key.String()] = s
+				ordered = append(ordered, s)
+			}
+			s.samples = append(s.samples, remoteSample{value: value, timestamp: timestamp.UnixMilli()})
+			samples++
+		}
+	}
+	for _, s := range ordered {
+		sort.SliceStable(s.samples, func(i, j int) bool { return s.samples[i].timestamp < s.samples[j].timestamp })
+	}
+	return ordered, samples, skipped
+}
+
+// numeric returns the value of a field as a sample value, if it is a number or a
+// string holding one
+func numeric(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return parsed, err == nil && !math.IsNaN(parsed)
+	}
+	return 0, false
+}
+
+// encodeWriteRequest encodes the series as a prometheus.WriteRequest message:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []*remoteSeries) []byte {
+	var request []byte
+	for _, s := range series {
+		var timeSeries []byte
+		for _, label := range s.labels {
+			var message []byte
+			message = protowire.AppendTag(message, 1, protowire.BytesType)
+			message = protowire.AppendString(message, label.name)
+			message = protowire.AppendTag(message, 2, protowire.BytesType)
+			message = protowire.AppendString(message, label.value)
+			timeSeries = protowire.AppendTag(timeSeries, 1, protowire.BytesType)
+			timeSeries = protowire.AppendBytes(timeSeries, message)
+		}
+		for _, sample := range s.samples {
+			var message []byte
+			message = protowire.AppendTag(message, 1, protowire.Fixed64Type)
+			message = protowire.AppendFixed64(message, math.Float64bits(sample.value))
+			message = protowire.AppendTag(message, 2, protowire.VarintType)
+			message = protowire.AppendVarint(message, uint64(sample.timestamp))
+			timeSeries = protowire.AppendTag(timeSeries, 2, protowire.BytesType)
+			timeSeries = protowire.AppendBytes(timeSeries, message)
+		}
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, timeSeries)
+	}
+	return request
+}
+
+// send posts a snappy compressed write request
+func (r *RemoteWriteSink) send(ctx context.Context, request []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.URL, bytes.NewReader(snappy.Encode(nil, request)))
+	if err != nil {
+		return fmt.Errorf("failed to create remote write request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	switch {
+	case r.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+r.cfg.BearerToken)
+	case r.cfg.Username != "":
+		req.SetBasicAuth(r.cfg.Username, r.cfg.Password)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("remote write request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &RemoteWriteStatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	return nil
+}
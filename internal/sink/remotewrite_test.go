@@ -0,0 +1,168 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// decodeWriteRequest renders the series of a write request as name{labels} followed
+// by their value@timestamp samples
+func decodeWriteRequest(t *testing.T, request []byte) []string {
+	t.Helper()
+	fields := func(message []byte, field func(num protowire.Number, value []byte, number uint64)) {
+		for len(message) > 0 {
+			num, typ, n := protowire.ConsumeTag(message)
+			message = message[n:]
+			switch typ {
+			case protowire.BytesType:
+				value, n := protowire.ConsumeBytes(message)
+				field(num, value, 0)
+				message = message[n:]
+			case protowire.Fixed64Type:
+				value, n := protowire.ConsumeFixed64(message)
+				field(num, nil, value)
+				message = message[n:]
+			case protowire.VarintType:
+				value, n := protowire.ConsumeVarint(message)
+				field(num, nil, value)
+				message = message[n:]
+			default:
+				t.Fatalf("Unexpected wire type %v", typ)
+			}
+		}
+	}
+
+	var series []string
+	fields(request, func(_ protowire.Number, timeSeries []byte, _ uint64) {
+		var labels, samples []string
+		fields(timeSeries, func(num protowire.Number, message []byte, _ uint64) {
+			if num == 1 {
+				var name, value string
+				fields(message, func(num protowire.Number, field []byte, _ uint64) {
+					if num == 1 {
+						name = string(field)
+					} else {
+						value = string(field)
+					}
+				})
+				labels = append(labels, fmt.Sprintf("%s=%q", name, value))
+				return
+			}
+			var value float64
+			var timestamp int64
+			fields(message, func(num protowire.Number, _ []byte, number uint64) {
+				if num == 1 {
+					value = math.Float64frombits(number)
+				} else {
+					timestamp = int64(number)
+				}
+			})
+			samples = append(samples, fmt.Sprintf("%g@%d", value, timestamp))
+		})
+		series = append(series, fmt.Sprintf("{%s} %s", strings.Join(labels, ","), strings.Join(samples, " ")))
+	})
+	return series
+}
+
+func TestRemoteWriteSinkWrite(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	var series []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		request, err := snappy.Decode(nil, body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		series = decodeWriteRequest(t, request)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	remoteWriteSink, err := NewRemoteWriteSink(RemoteWriteConfig{
+		URL:         server.URL,
+		Metrics:     map[string]string{"post_user": "user_id", "post_score": "title"},
+		Labels:      map[string]string{"author": "user_id", "Body": "body"},
+		BearerToken: "token",
+	}, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewRemoteWriteSink: %v", err)
+	}
+
+	later, earlier := time.UnixMilli(2000), time.UnixMilli(1000)
+	records := []database.ProcessedRecord{
+		{UserID: 7, Title: "2.5", SourceTime: &later},
+		{UserID: 7, Title: "not a number", SourceTime: &earlier},
+	}
+	if err := remoteWriteSink.Write(context.Background(), records); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	// Labels are sorted by name, the empty body is left out and the samples of a
+	// series are sorted by time
+	want := []string{
+		`{__name__="post_score",author="7"} 2.5@2000`,
+		`{__name__="post_user",author="7"} 7@1000 7@2000`,
+	}
+	if fmt.Sprint(series) != fmt.Sprint(want) {
+		t.Errorf("Expected series %v, got %v", want, series)
+	}
+}
+
+func TestRemoteWriteSinkClassifiesErrors(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("out of order sample"))
+	}))
+	defer server.Close()
+
+	remoteWriteSink, err := NewRemoteWriteSink(RemoteWriteConfig{
+		URL:     server.URL,
+		Metrics: map[string]string{"post_user": "user_id"},
+	}, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewRemoteWriteSink: %v", err)
+	}
+	records := []database.ProcessedRecord{{UserID: 1, Title: "First"}}
+
+	// Rejected samples cannot be written by retrying and are dropped
+	if err := remoteWriteSink.Write(context.Background(), records); err != nil {
+		t.Errorf("Expected rejected samples to be dropped, got %v", err)
+	}
+	for _, status = range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		if err := remoteWriteSink.Write(context.Background(), records); err == nil {
+			t.Errorf("Expected status %d to fail the write so it is retried", status)
+		}
+	}
+
+	if _, err := NewRemoteWriteSink(RemoteWriteConfig{URL: server.URL, Metrics: map[string]string{"post-user": "user_id"}}, logger, metrics.NewMetrics()); err == nil {
+		t.Error("Expected an invalid metric name to be rejected")
+	}
+	if _, err := NewRemoteWriteSink(RemoteWriteConfig{URL: server.URL, Metrics: map[string]string{"post_user": "missing"}}, logger, metrics.NewMetrics()); err == nil {
+		t.Error("Expected an unknown field to be rejected")
+	}
+}
@@ -0,0 +1,90 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/objectstore"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// S3Sink writes each processed batch to S3 as a newline-delimited JSON object
+type S3Sink struct {
+	client  *objectstore.S3Client
+	prefix  string
+	codec   codec.Codec
+	logger  *logging.Logger
+	metrics *metrics.Metrics
+}
+
+// NewS3Sink creates a sink writing batches under prefix in the client's bucket,
+// compressed with compression
+func NewS3Sink(client *objectstore.S3Client, prefix string, compression codec.Codec, logger *logging.Logger, metrics *metrics.Metrics) *S3Sink {
+	return &S3Sink{
+		client:  client,
+		prefix:  prefix,
+		codec:   compression,
+		logger:  logger,
+		metrics: metrics,
+	}
+}
+
+// Name returns the sink name
+func (s *S3Sink) Name() string {
+	return "s3"
+}
+
+// Write uploads the batch as one object keyed by date and by run and batch
+// number, or by timestamp outside of a run
+func (s *S3Sink) Write(ctx context.Context, records []database.ProcessedRecord) error {
+	logger := s.logger.ForContext(ctx)
+	if len(records) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, record := range records {
+		if err := encoder.Encode(transform.Row(record)); err != nil {
+			return fmt.Errorf("failed to marshal record: %w", err)
+		}
+	}
+
+	data, err := codec.Compress(s.codec, body.Bytes())
+	if err != nil {
+		s.metrics.SinkWriteErrorsTotal.WithLabelValues(s.Name()).Add(float64(len(records)))
+		return err
+	}
+
+	// A batch of a run is keyed by the run and its number, so a retry overwrites
+	// the object of the failed attempt instead of adding a second copy
+	now := time.Now().UTC()
+	name := fmt.Sprintf("processed_data_%s_%09d", now.Format("20060102_150405"), now.Nanosecond())
+	metadata := map[string]string{"codec": s.codec.Name()}
+	if runID := runid.FromContext(ctx); runID != "" {
+		name = fmt.Sprintf("processed_data_%s_%d", runID, database.LoadBatch(ctx))
+		metadata["run-id"] = runID
+	}
+	key := path.Join(s.prefix, now.Format("2006/01/02"), name+".ndjson"+s.codec.Extension())
+
+	start := time.Now()
+	err = s.client.PutObject(ctx, key, data, "application/x-ndjson", metadata)
+	s.metrics.SinkWriteDuration.WithLabelValues(s.Name()).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.metrics.SinkWriteErrorsTotal.WithLabelValues(s.Name()).Add(float64(len(records)))
+		return err
+	}
+
+	s.metrics.SinkRecordsWrittenTotal.WithLabelValues(s.Name()).Add(float64(len(records)))
+	logger.Info(fmt.Sprintf("Processed batch uploaded to s3://%s/%s", s.client.Bucket(), key))
+	return nil
+}
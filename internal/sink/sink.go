@@ -0,0 +1,31 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+// Sink is a destination that processed records are loaded into
+type Sink interface {
+	// Name identifies the sink in logs and metric labels
+	Name() string
+	// Write loads a batch of processed records
+	Write(ctx context.Context, records []database.ProcessedRecord) error
+}
+
+// PartialWriteError reports a write that loaded some of the records; retrying
+// writes only Remaining, so the records already loaded are not duplicated
+type PartialWriteError struct {
+	Remaining []database.ProcessedRecord
+	Err       error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("partial write, %d records not loaded: %v", len(e.Remaining), e.Err)
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,424 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/runid"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// snowflakeIdentifier matches the unquoted identifiers the sink accepts, optionally
+// qualified with dots for stages
+var snowflakeIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)*$`)
+
+const (
+	// snowflakePollInterval spaces the polls of statements still running
+	snowflakePollInterval = time.Second
+	// snowflakeStatementTimeout bounds each statement on the Snowflake side
+	snowflakeStatementTimeout = 10 * time.Minute
+)
+
+// StageUploader puts files into the bucket of an external stage
+type StageUploader interface {
+	PutObject(ctx context.Context, key string, body []byte, contentType string, metadata map[string]string) error
+}
+
+// SnowflakeConfig holds the settings for the Snowflake sink
+type SnowflakeConfig struct {
+	// Account is the account identifier, e.g. myorg-myaccount
+	Account string
+	// Endpoint defaults to https://<Account>.snowflakecomputing.com
+	Endpoint  string
+	User      string
+	Role      string
+	Warehouse string
+	Database  string
+	Schema    string
+	Table     string
+	// PrivateKeyFile holds the PEM RSA key of User for key-pair authentication;
+	// Token is an OAuth token used instead
+	PrivateKeyFile string
+	Token          string
+	// Stage is the external stage whose location is StagePrefix in the bucket of
+	// the uploader
+	Stage       string
+	StagePrefix string
+	// MergeKeys are the processed fields identifying a row; with them batches are
+	// merged into the table instead of appended
+	MergeKeys []string
+}
+
+// SnowflakeSink loads processed batches into a Snowflake table by staging them as
+// files in an external stage and copying them in with COPY INTO, through the
+// Snowflake SQL API. Files are named by their run and content, and COPY INTO skips
+// files it already loaded, so retrying a batch does not load it twice.
+type SnowflakeSink struct {
+	cfg        SnowflakeConfig
+	stage      StageUploader
+	key        *rsa.PrivateKey
+	httpClient *http.Client
+	logger     *logging.Logger
+	metrics    *metrics.Metrics
+	tableReady bool
+}
+
+// SnowflakeError is an error of a statement reported by Snowflake
+type SnowflakeError struct {
+	StatusCode int
+	Code       string
+	SQLState   string
+	Message    string
+}
+
+func (e *SnowflakeError) Error() string {
+	return fmt.Sprintf("snowflake returned status code %d: %s (%s): %s", e.StatusCode, e.Code, e.SQLState, e.Message)
+}
+
+// NewSnowflakeSink creates a sink staging batches with stage and loading them into
+// the table of cfg
+func NewSnowflakeSink(cfg SnowflakeConfig, stage StageUploader, logger *logging.Logger, metrics *metrics.Metrics) (*SnowflakeSink, error) {
+	if cfg.Account == "" || cfg.User == "" || cfg.Warehouse == "" || cfg.Database == "" || cfg.Stage == "" {
+		return nil, fmt.Errorf("snowflake account, user, warehouse, database and stage are required")
+	}
+	if cfg.Schema == "" {
+		cfg.Schema = "PUBLIC"
+	}
+	if cfg.Table == "" {
+		cfg.Table = "processed_data"
+	}
+	for _, identifier := range []string{cfg.Warehouse, cfg.Database, cfg.Schema, cfg.Table, cfg.Stage, cfg.Role} {
+		if identifier != "" && !snowflakeIdentifier.MatchString(identifier) {
+			return nil, fmt.Errorf("invalid snowflake identifier %q", identifier)
+		}
+	}
+	for _, key := range cfg.MergeKeys {
+		if !isField(key) {
+			return nil, fmt.Errorf("snowflake merge key %q is not a processed field", key)
+		}
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://" + cfg.Account + ".snowflakecomputing.com"
+	}
+
+	sink := &SnowflakeSink{
+		cfg:        cfg,
+		stage:      stage,
+		httpClient: &http.Client{Timeout: time.Minute},
+		logger:     logger,
+		metrics:    metrics,
+	}
+	switch {
+	case cfg.PrivateKeyFile != "":
+		key, err := readSnowflakeKey(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		sink.key = key
+	case cfg.Token == "":
+		return nil, fmt.Errorf("snowflake requires a private key file or an OAuth token")
+	}
+	return sink, nil
+}
+
+// readSnowflakeKey reads an unencrypted PKCS#8 or PKCS#1 RSA private key
+func readSnowflakeKey(file string) (*rsa.PrivateKey, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snowflake private key: %w", err)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("snowflake private key %s is not PEM encoded", file)
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse snowflake private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("snowflake private key %s is not an RSA key", file)
+	}
+	return rsaKey, nil
+}
+
+// Name returns the sink name
+func (s *SnowflakeSink) Name() string {
+	return "snowflake"
+}
+
+// Write stages the batch as a gzipped NDJSON file and copies it into the table,
+// merging it by MergeKeys if configured
+func (s *SnowflakeSink) Write(ctx context.Context, records []database.ProcessedRecord) error {
+	logger := s.logger.ForContext(ctx)
+	if len(records) == 0 {
+		return nil
+	}
+
+	started := time.Now()
+	defer func() {
+		s.metrics.SinkWriteDuration.WithLabelValues(s.Name()).Observe(time.Since(started).Seconds())
+	}()
+	if err := s.load(ctx, records); err != nil {
+		s.metrics.SinkWriteErrorsTotal.WithLabelValues(s.Name()).Add(float64(len(records)))
+		return err
+	}
+	s.metrics.SinkRecordsWrittenTotal.WithLabelValues(s.Name()).Add(float64(len(records)))
+	logger.Info(fmt.Sprintf("Snowflake load successful: %d rows into %s", len(records), s.table()))
+	return nil
+}
+
+func (s *SnowflakeSink) load(ctx context.Context, records []database.ProcessedRecord) error {
+	if !s.tableReady {
+		if _, err := s.execute(ctx, []string{s.createTable()}); err != nil {
+			return fmt.Errorf("failed to create snowflake table: %w", err)
+		}
+		s.tableReady = true
+	}
+
+	if len(s.cfg.MergeKeys) > 0 {
+		records = lastByKey(records, s.cfg.MergeKeys)
+	}
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, record := range records {
+		if err := encoder.Encode(transform.Row(record)); err != nil {
+			return fmt.Errorf("failed to marshal record: %w", err)
+		}
+	}
+	gzipCodec, _ := codec.Get(codec.Gzip)
+	data, err := codec.Compress(gzipCodec, body.Bytes())
+	if err != nil {
+		return err
+	}
+	// Files are named by their run and content so a retried batch is the same file
+	digest := sha256.Sum256(body.Bytes())
+	name := "processed_" + hex.EncodeToString(digest[:12]) + ".ndjson.gz"
+	if runID := runid.FromContext(ctx); runID != "" {
+		name = "processed_" + runID + "_" + hex.EncodeToString(digest[:12]) + ".ndjson.gz"
+	}
+	file := path.Join(time.Now().UTC().Format("2006/01/02"), name)
+	if err := s.stage.PutObject(ctx, path.Join(s.cfg.StagePrefix, file), data, "application/x-ndjson", nil); err != nil {
+		return fmt.Errorf("failed to stage snowflake file: %w", err)
+	}
+
+	statements := []string{s.copyInto(s.table(), file)}
+	if len(s.cfg.MergeKeys) > 0 {
+		// The MERGE is atomic on its own; DDL would commit an explicit transaction
+		statements = []string{
+			fmt.Sprintf("CREATE TEMPORARY TABLE etl_staging LIKE %s", s.table()),
+			s.copyInto("etl_staging", file),
+			s.merge("etl_staging"),
+		}
+	}
+	if _, err := s.execute(ctx, statements); err != nil {
+		return fmt.Errorf("failed to load snowflake file %s: %w", file, err)
+	}
+	return nil
+}
+
+// table returns the qualified name of the table
+func (s *SnowflakeSink) table() string {
+	return s.cfg.Database + "." + s.cfg.Schema + "." + s.cfg.Table
+}
+
+// createTable returns the statement creating the table from the processed fields
+func (s *SnowflakeSink) createTable() string {
+	columns := make([]string, 0, len(transform.Fields))
+	for _, field := range transform.Fields {
+		column := field.Name + " " + snowflakeType(field.Type)
+		if field.Required {
+			column += " NOT NULL"
+		}
+		columns = append(columns, column)
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", s.table(), strings.Join(columns, ", "))
+}
+
+// copyInto returns the statement copying a staged file into table
+func (s *SnowflakeSink) copyInto(table, file string) string {
+	return fmt.Sprintf("COPY INTO %s FROM @%s FILES = ('%s') FILE_FORMAT = (TYPE = JSON) MATCH_BY_COLUMN_NAME = CASE_INSENSITIVE", table, s.cfg.Stage, file)
+}
+
+// merge returns the statement upserting the rows of staging into the table by
+// the merge keys
+func (s *SnowflakeSink) merge(staging string) string {
+	var on, set, columns, values []string
+	for _, key := range s.cfg.MergeKeys {
+		on = append(on, fmt.Sprintf("t.%s = s.%s", key, key))
+	}
+	for _, field := range transform.Fields {
+		set = append(set, fmt.Sprintf("%s = s.%s", field.Name, field.Name))
+		columns = append(columns, field.Name)
+		values = append(values, "s."+field.Name)
+	}
+	return fmt.Sprintf("MERGE INTO %s t USING %s s ON %s WHEN MATCHED THEN UPDATE SET %s WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)",
+		s.table(), staging, strings.Join(on, " AND "), strings.Join(set, ", "), strings.Join(columns, ", "), strings.Join(values, ", "))
+}
+
+// lastByKey keeps the last record of each key, as MERGE fails on a key matched
+// by several rows
+func lastByKey(records []database.ProcessedRecord, keys []string) []database.ProcessedRecord {
+	index := make(map[string]int, len(records))
+	var kept []database.ProcessedRecord
+	for _, record := range records {
+		row := transform.Row(record)
+		var key strings.Builder
+		for _, name := range keys {
+			fmt.Fprintf(&key, "%q,", fmt.Sprint(row[name]))
+		}
+		if i, ok := index[key.String()]; ok {
+			kept[i] = record
+			continue
+		}
+		index[key.String()] = len(kept)
+		kept = append(kept, record)
+	}
+	return kept
+}
+
+func snowflakeType(fieldType string) string {
+	switch fieldType {
+	case transform.FieldTypeInteger:
+		return "NUMBER"
+	default:
+		return "VARCHAR"
+	}
+}
+
+// snowflakeResponse is the result of a statement of the SQL API
+type snowflakeResponse struct {
+	Code               string          `json:"code"`
+	SQLState           string          `json:"sqlState"`
+	Message            string          `json:"message"`
+	StatementHandle    string          `json:"statementHandle"`
+	StatementStatusURL string          `json:"statementStatusUrl"`
+	Data               [][]interface{} `json:"data"`
+}
+
+// execute runs the statements in one request, and so one session, waiting for
+// them to finish
+func (s *SnowflakeSink) execute(ctx context.Context, statements []string) (*snowflakeResponse, error) {
+	request := map[string]interface{}{
+		"statement": strings.Join(statements, ";\n"),
+		"timeout":   int(snowflakeStatementTimeout.Seconds()),
+		"warehouse": s.cfg.Warehouse,
+		"database":  s.cfg.Database,
+		"schema":    s.cfg.Schema,
+		"parameters": map[string]string{
+			"MULTI_STATEMENT_COUNT": fmt.Sprint(len(statements)),
+		},
+	}
+	if s.cfg.Role != "" {
+		request["role"] = s.cfg.Role
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal snowflake request: %w", err)
+	}
+	response, err := s.do(ctx, http.MethodPost, s.cfg.Endpoint+"/api/v2/statements", body)
+	// 333334 means the statements are still running
+	for err == nil && response.Code == "333334" {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(snowflakePollInterval):
+		}
+		response, err = s.do(ctx, http.MethodGet, s.cfg.Endpoint+response.StatementStatusURL, nil)
+	}
+	return response, err
+}
+
+// do sends an authenticated request of the SQL API and decodes its response
+func (s *SnowflakeSink) do(ctx context.Context, method, url string, body []byte) (*snowflakeResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snowflake request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if s.key != nil {
+		token, err := s.jwt(time.Now())
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-Snowflake-Authorization-Token-Type", "KEYPAIR_JWT")
+	} else {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+		req.Header.Set("X-Snowflake-Authorization-Token-Type", "OAUTH")
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("snowflake request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snowflake response: %w", err)
+	}
+	var response snowflakeResponse
+	decodeErr := json.Unmarshal(content, &response)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		if decodeErr != nil || response.Message == "" {
+			response.Message = strings.TrimSpace(string(content))
+		}
+		return nil, &SnowflakeError{StatusCode: resp.StatusCode, Code: response.Code, SQLState: response.SQLState, Message: response.Message}
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to unmarshal snowflake response: %w", decodeErr)
+	}
+	return &response, nil
+}
+
+// jwt returns the key-pair token of User, valid for an hour
+func (s *SnowflakeSink) jwt(now time.Time) (string, error) {
+	publicKey, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode snowflake public key: %w", err)
+	}
+	fingerprint := sha256.Sum256(publicKey)
+	// The account of the token excludes the region and cloud of a locator
+	account, _, _ := strings.Cut(strings.ToUpper(s.cfg.Account), ".")
+	user := account + "." + strings.ToUpper(s.cfg.User)
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": user + ".SHA256:" + base64.StdEncoding.EncodeToString(fingerprint[:]),
+		"sub": user,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign snowflake token: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
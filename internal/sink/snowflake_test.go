@@ -0,0 +1,166 @@
+package sink
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// memoryStage keeps the files staged by a sink
+type memoryStage struct {
+	files map[string][]byte
+}
+
+func (m *memoryStage) PutObject(_ context.Context, key string, body []byte, _ string, _ map[string]string) error {
+	m.files[key] = body
+	return nil
+}
+
+func TestSnowflakeSinkWrite(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "snowflake.p8")
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	var statements []string
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The key-pair token is signed with the key of the user
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(token, ".")
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[len(parts)-1])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if r.Header.Get("X-Snowflake-Authorization-Token-Type") != "KEYPAIR_JWT" || rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodGet {
+			polls++
+			w.Write([]byte(`{"code": "090001", "message": "Statement executed successfully.", "data": [["1"]]}`))
+			return
+		}
+		var request struct {
+			Statement string `json:"statement"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		statements = append(statements, request.Statement)
+		if strings.Contains(request.Statement, "MERGE") {
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"code": "333334", "statementHandle": "h1", "statementStatusUrl": "/api/v2/statements/h1"}`))
+			return
+		}
+		w.Write([]byte(`{"code": "090001", "message": "Statement executed successfully.", "data": [["1"]]}`))
+	}))
+	defer server.Close()
+
+	stage := &memoryStage{files: map[string][]byte{}}
+	snowflakeSink, err := NewSnowflakeSink(SnowflakeConfig{
+		Account:        "myorg-account",
+		Endpoint:       server.URL,
+		User:           "etl",
+		Warehouse:      "etl_wh",
+		Database:       "analytics",
+		Stage:          "analytics.public.etl_stage",
+		StagePrefix:    "snowflake",
+		PrivateKeyFile: keyFile,
+		MergeKeys:      []string{"user_id", "title"},
+	}, stage, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewSnowflakeSink: %v", err)
+	}
+
+	records := []database.ProcessedRecord{
+		{UserID: 1, Title: "First", Body: "old"},
+		{UserID: 1, Title: "First", Body: "new"},
+		{UserID: 2, Title: "Second"},
+	}
+	if err := snowflakeSink.Write(context.Background(), records); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if len(stage.files) != 1 {
+		t.Fatalf("Expected one staged file, got %d", len(stage.files))
+	}
+	for key := range stage.files {
+		if !strings.HasPrefix(key, "snowflake/") || !strings.HasSuffix(key, ".ndjson.gz") {
+			t.Errorf("Expected the file under the stage prefix, got %s", key)
+		}
+	}
+	if len(statements) != 2 || !strings.HasPrefix(statements[0], "CREATE TABLE IF NOT EXISTS analytics.PUBLIC.processed_data") {
+		t.Fatalf("Expected the table to be created, then the batch merged, got %q", statements)
+	}
+	merge := statements[1]
+	for _, want := range []string{
+		"CREATE TEMPORARY TABLE etl_staging LIKE analytics.PUBLIC.processed_data",
+		"COPY INTO etl_staging FROM @analytics.public.etl_stage FILES = ('",
+		"ON t.user_id = s.user_id AND t.title = s.title",
+	} {
+		if !strings.Contains(merge, want) {
+			t.Errorf("Expected the statements to contain %q, got %s", want, merge)
+		}
+	}
+	if polls != 1 {
+		t.Errorf("Expected the running statements to be polled until done, got %d polls", polls)
+	}
+
+	// The records of a key are merged as the last of them
+	kept := lastByKey(records, []string{"user_id", "title"})
+	if len(kept) != 2 || kept[0].Body != "new" {
+		t.Errorf("Expected the last record of each key, got %+v", kept)
+	}
+}
+
+func TestSnowflakeSinkReportsStatementErrors(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"code": "002003", "sqlState": "02000", "message": "Stage 'ETL_STAGE' does not exist or not authorized."}`))
+	}))
+	defer server.Close()
+
+	snowflakeSink, err := NewSnowflakeSink(SnowflakeConfig{
+		Account:   "myorg-account",
+		Endpoint:  server.URL,
+		User:      "etl",
+		Warehouse: "etl_wh",
+		Database:  "analytics",
+		Stage:     "etl_stage",
+		Token:     "oauth",
+	}, &memoryStage{files: map[string][]byte{}}, logger, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("NewSnowflakeSink: %v", err)
+	}
+
+	err = snowflakeSink.Write(context.Background(), []database.ProcessedRecord{{UserID: 1, Title: "First"}})
+	if err == nil || !strings.Contains(err.Error(), "002003 (02000): Stage 'ETL_STAGE' does not exist") {
+		t.Errorf("Expected the statement error of Snowflake, got %v", err)
+	}
+
+	if _, err := NewSnowflakeSink(SnowflakeConfig{Account: "a", User: "u", Warehouse: "w", Database: "d", Stage: "s; DROP TABLE x", Token: "t"}, nil, logger, metrics.NewMetrics()); err == nil {
+		t.Error("Expected an invalid identifier to be rejected")
+	}
+}
@@ -0,0 +1,183 @@
+package slo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+// checkInterval is how often Watch checks freshness and updates its gauges
+const checkInterval = 15 * time.Second
+
+// Freshness states reported by Status
+const (
+	StateMet      = "met"
+	StateBreached = "breached"
+	// StateNone marks pipelines without a freshness objective
+	StateNone = "none"
+)
+
+// LoadTracker reports when a pipeline last brought its processed data up to date
+type LoadTracker interface {
+	LastLoaded() time.Time
+}
+
+// BreachNotifier is told the freshness status of a pipeline on every check, so it
+// can alert when the objective is breached and when it is met again
+type BreachNotifier interface {
+	NotifyFreshness(ctx context.Context, status Status)
+}
+
+// Status is the freshness of a pipeline's processed data against its objective
+type Status struct {
+	Pipeline string `json:"pipeline"`
+	// Objective is the maximum age of the processed data, zero if the pipeline has none
+	Objective time.Duration `json:"-"`
+	// LastLoadedAt is when the data was last brought up to date, nil if it was not
+	// since the process started
+	LastLoadedAt *time.Time `json:"last_loaded_at"`
+	// Age is how old the data is, counted from process start until a first load
+	Age   time.Duration `json:"-"`
+	State string        `json:"state"`
+	// BreachedSince is when the objective was first found breached, while it is
+	BreachedSince *time.Time `json:"breached_since,omitempty"`
+}
+
+// MarshalJSON renders the objective as a duration such as "15m0s" and the age in seconds
+func (s Status) MarshalJSON() ([]byte, error) {
+	type status Status
+	var objective string
+	if s.Objective > 0 {
+		objective = s.Objective.String()
+	}
+	return json.Marshal(struct {
+		status
+		Objective  string  `json:"objective,omitempty"`
+		AgeSeconds float64 `json:"age_seconds"`
+	}{status(s), objective, s.Age.Seconds()})
+}
+
+// Breached reports whether the data is older than the objective
+func (s Status) Breached() bool {
+	return s.State == StateBreached
+}
+
+// Monitor tracks the freshness of one pipeline's processed data, exposes it as
+// gauges and reports it to notifiers
+type Monitor struct {
+	pipeline  string
+	objective time.Duration
+	tracker   LoadTracker
+	logger    *logging.Logger
+	metrics   *metrics.Metrics
+	notifiers []BreachNotifier
+	// started stands in for the last load until the first one
+	started time.Time
+
+	mu            sync.Mutex
+	breachedSince time.Time
+}
+
+// NewMonitor creates a monitor for pipeline, which may be empty for the only
+// pipeline of the process; objective is the maximum age of its processed data,
+// zero for none
+func NewMonitor(pipeline string, objective time.Duration, tracker LoadTracker, logger *logging.Logger, metrics *metrics.Metrics) *Monitor {
+	return &Monitor{
+		pipeline:  pipeline,
+		objective: objective,
+		tracker:   tracker,
+		logger:    logger,
+		metrics:   metrics,
+		started:   time.Now(),
+	}
+}
+
+// AddNotifier reports the status of every check to n
+func (m *Monitor) AddNotifier(n BreachNotifier) {
+	m.notifiers = append(m.notifiers, n)
+}
+
+// Objective returns the maximum age of the processed data, zero for none
+func (m *Monitor) Objective() time.Duration {
+	return m.objective
+}
+
+// Watch checks freshness until ctx is cancelled
+func (m *Monitor) Watch(ctx context.Context) {
+	m.check(ctx, time.Now())
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.check(ctx, time.Now())
+		}
+	}
+}
+
+// Status returns the current freshness of the processed data
+func (m *Monitor) Status() Status {
+	return m.status(time.Now())
+}
+
+// check updates the gauges and notifiers with the status at now, logging when the
+// objective starts or stops being breached
+func (m *Monitor) check(ctx context.Context, now time.Time) Status {
+	status := m.status(now)
+	m.metrics.DataFreshness.Set(status.Age.Seconds())
+	breached := 0.0
+	if status.Breached() {
+		breached = 1
+	}
+	m.metrics.FreshnessSLOBreached.Set(breached)
+
+	m.mu.Lock()
+	switch {
+	case status.Breached() && m.breachedSince.IsZero():
+		m.breachedSince = now
+		status.BreachedSince = &now
+		m.logger.Warn(fmt.Sprintf("Freshness SLO breached: processed data is %v old, objective %v", status.Age.Round(time.Second), m.objective))
+	case !status.Breached() && !m.breachedSince.IsZero():
+		m.breachedSince = time.Time{}
+		m.logger.Info(fmt.Sprintf("Freshness SLO met again: processed data is %v old", status.Age.Round(time.Second)))
+	}
+	m.mu.Unlock()
+
+	for _, n := range m.notifiers {
+		n.NotifyFreshness(ctx, status)
+	}
+	return status
+}
+
+// status computes the freshness at now
+func (m *Monitor) status(now time.Time) Status {
+	status := Status{Pipeline: m.pipeline, Objective: m.objective, State: StateNone}
+	loaded := m.tracker.LastLoaded()
+	if loaded.IsZero() {
+		status.Age = now.Sub(m.started)
+	} else {
+		status.LastLoadedAt = &loaded
+		status.Age = now.Sub(loaded)
+	}
+	if m.objective > 0 {
+		status.State = StateMet
+		if status.Age > m.objective {
+			status.State = StateBreached
+		}
+	}
+
+	m.mu.Lock()
+	if !m.breachedSince.IsZero() && status.Breached() {
+		since := m.breachedSince
+		status.BreachedSince = &since
+	}
+	m.mu.Unlock()
+	return status
+}
@@ -0,0 +1,77 @@
+package slo
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+type fakeTracker struct {
+	lastLoaded time.Time
+}
+
+func (t *fakeTracker) LastLoaded() time.Time { return t.lastLoaded }
+
+type fakeNotifier struct {
+	statuses []Status
+}
+
+func (n *fakeNotifier) NotifyFreshness(ctx context.Context, status Status) {
+	n.statuses = append(n.statuses, status)
+}
+
+func TestMonitorCheck(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	tracker := &fakeTracker{}
+	notifier := &fakeNotifier{}
+	monitor := NewMonitor("orders", 15*time.Minute, tracker, logger, metrics.NewMetrics())
+	monitor.AddNotifier(notifier)
+
+	// Until a first load, the age counts from the start of the monitor
+	now := monitor.started.Add(10 * time.Minute)
+	if status := monitor.check(context.Background(), now); status.State != StateMet || status.LastLoadedAt != nil || status.Age != 10*time.Minute {
+		t.Errorf("Expected the objective to be met before the first load, got %+v", status)
+	}
+
+	tracker.lastLoaded = now
+	now = now.Add(20 * time.Minute)
+	status := monitor.check(context.Background(), now)
+	if !status.Breached() || status.BreachedSince == nil || !status.BreachedSince.Equal(now) {
+		t.Errorf("Expected the objective to be breached, got %+v", status)
+	}
+	if later := monitor.status(now.Add(time.Minute)); later.BreachedSince == nil || !later.BreachedSince.Equal(now) {
+		t.Errorf("Expected the breach to keep its start, got %+v", later)
+	}
+
+	tracker.lastLoaded = now
+	if status := monitor.check(context.Background(), now.Add(time.Minute)); status.State != StateMet || status.BreachedSince != nil {
+		t.Errorf("Expected the objective to be met again, got %+v", status)
+	}
+	if len(notifier.statuses) != 3 || !notifier.statuses[1].Breached() {
+		t.Errorf("Expected every check to be notified, got %+v", notifier.statuses)
+	}
+}
+
+func TestStatusJSON(t *testing.T) {
+	loaded := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	body, err := json.Marshal(Status{Pipeline: "orders", Objective: 15 * time.Minute, LastLoadedAt: &loaded, Age: 90 * time.Second, State: StateMet})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(body, &decoded)
+	if decoded["objective"] != "15m0s" || decoded["age_seconds"] != 90.0 || decoded["state"] != StateMet || decoded["last_loaded_at"] != "2023-01-01T12:00:00Z" {
+		t.Errorf("Unexpected JSON: %s", body)
+	}
+
+	body, _ = json.Marshal(Status{Pipeline: "orders", State: StateNone})
+	decoded = nil
+	json.Unmarshal(body, &decoded)
+	if _, ok := decoded["objective"]; ok {
+		t.Errorf("Expected no objective for a pipeline without one: %s", body)
+	}
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+)
+
+// SaveArchive writes rows removed from a table as newline-delimited JSON under
+// archive/<table>, compressed with the storage codec and encrypted when enabled
+func (fs *FileStorage) SaveArchive(table string, rows []json.RawMessage) error {
+	archivePath := filepath.Join(fs.basePath, "archive", table)
+	if err := os.MkdirAll(archivePath, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	filename := filepath.Join(archivePath, fs.encryptedName(fmt.Sprintf("%s_%s_%09d.ndjson%s", table, now.Format("20060102_150405"), now.Nanosecond(), fs.codec.Extension())))
+
+	var buf bytes.Buffer
+	for _, row := range rows {
+		buf.Write(row)
+		buf.WriteByte('\n')
+	}
+	content, err := codec.Compress(fs.codec, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if content, err = fs.seal(content); err != nil {
+		return fmt.Errorf("failed to encrypt archive: %w", err)
+	}
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open archive file: %w", err)
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	// Rows are deleted once this returns, so make sure they reached the disk
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync archive: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close archive: %w", err)
+	}
+
+	fs.logger.Info(fmt.Sprintf("Archived %d rows of %s: %s", len(rows), table, filename))
+	return nil
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/avro"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// Record names of the Avro schemas of raw and processed batches
+const (
+	RawRecordSchema       = "RawRecord"
+	ProcessedRecordSchema = "ProcessedRecord"
+)
+
+// rawFields holds raw records, which have no fixed schema, as their JSON document
+var rawFields = []transform.Field{
+	{Name: "record", Type: transform.FieldTypeString, Required: true, Description: "Fetched record as JSON"},
+}
+
+// avroFormat holds the block codec and schemas of the FormatAvro format
+type avroFormat struct {
+	codec     string
+	raw       []byte
+	processed []byte
+}
+
+// UseAvro makes the storage write raw and processed batches as Avro object
+// container files, compressing blocks with the storage codec
+func (f *batchFormat) UseAvro() error {
+	blockCodec, err := avro.ContainerCodec(f.codec.Name())
+	if err != nil {
+		return err
+	}
+	raw, err := avro.Schema(RawRecordSchema, rawFields)
+	if err != nil {
+		return err
+	}
+	processed, err := avro.Schema(ProcessedRecordSchema, transform.Fields)
+	if err != nil {
+		return err
+	}
+	f.format = FormatAvro
+	f.avro = &avroFormat{codec: blockCodec, raw: raw, processed: processed}
+	return nil
+}
+
+// UseAvro makes the storage write Avro container files once the processed schema
+// is checked against the one registered under schemas/ by earlier runs
+func (fs *FileStorage) UseAvro() error {
+	if err := fs.batchFormat.UseAvro(); err != nil {
+		return err
+	}
+	return fs.registerSchema(ProcessedRecordSchema, fs.avro.processed)
+}
+
+// registerSchema stores schema as schemas/<name>.avsc unless it is unchanged,
+// refusing schemas that cannot read the files written with the registered one
+func (fs *FileStorage) registerSchema(name string, schema []byte) error {
+	filename := filepath.Join(fs.basePath, "schemas", name+".avsc")
+	registered, err := os.ReadFile(filename)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read registered %s schema: %w", name, err)
+	case jsonEqual(registered, schema):
+		return nil
+	default:
+		if err := avro.CheckEvolution(registered, schema); err != nil {
+			return fmt.Errorf("incompatible %s schema: %w", name, err)
+		}
+		fs.logger.Info(fmt.Sprintf("%s schema evolved, registering it in %s", name, filename))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return writeFileAtomic(filename, schema)
+}
+
+// jsonEqual reports whether two JSON documents hold the same value
+func jsonEqual(a, b []byte) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	xs, _ := json.Marshal(x)
+	ys, _ := json.Marshal(y)
+	return string(xs) == string(ys)
+}
+
+// writeRaw writes raw records as a container of RawRecord rows
+func (a *avroFormat) writeRaw(w io.Writer, records []map[string]interface{}) error {
+	rows := make([][]byte, len(records))
+	for i, record := range records {
+		document, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if rows[i], err = avro.Encode(rawFields, map[string]interface{}{"record": string(document)}); err != nil {
+			return err
+		}
+	}
+	return avro.WriteContainer(w, a.raw, a.codec, rows)
+}
+
+// writeProcessed writes processed records as a container of ProcessedRecord rows
+func (a *avroFormat) writeProcessed(w io.Writer, records []database.ProcessedRecord) error {
+	rows := make([][]byte, len(records))
+	for i, record := range records {
+		var err error
+		if rows[i], err = avro.Encode(transform.Fields, transform.Row(record)); err != nil {
+			return err
+		}
+	}
+	return avro.WriteContainer(w, a.processed, a.codec, rows)
+}
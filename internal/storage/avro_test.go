@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+func TestSaveAvro(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	dir := t.TempDir()
+	gz, _ := codec.Get(codec.Gzip)
+	fs := NewFileStorage(dir, gz, logger)
+	if err := fs.UseAvro(); err != nil {
+		t.Fatalf("Failed to enable Avro: %v", err)
+	}
+
+	if _, err := fs.SaveProcessedData(context.Background(), []database.ProcessedRecord{{UserID: 1, Title: "Hello", Body: "World"}}); err != nil {
+		t.Fatalf("Failed to save processed data: %v", err)
+	}
+	// Blocks are deflated inside the container, the file itself is not gzipped
+	content := readSingleFile(t, filepath.Join(dir, "processed", "*.avro"))
+	if !strings.HasPrefix(content, "Obj\x01") || !strings.Contains(content, `"name":"ProcessedRecord"`) || !strings.Contains(content, "deflate") {
+		t.Errorf("Expected a deflate container with the processed schema, got %q", content)
+	}
+
+	registered, err := os.ReadFile(filepath.Join(dir, "schemas", "ProcessedRecord.avsc"))
+	if err != nil || !bytes.Equal(registered, fs.avro.processed) {
+		t.Errorf("Expected the processed schema to be registered, got %s (%v)", registered, err)
+	}
+}
+
+func TestRegisterSchema(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	none, _ := codec.Get(codec.None)
+	fs := NewFileStorage(t.TempDir(), none, logger)
+	v1 := []byte(`{"type":"record","name":"R","fields":[{"name":"id","type":"long"}]}`)
+	v2 := []byte(`{"type":"record","name":"R","fields":[{"name":"id","type":"long"},{"name":"tag","type":["null","string"],"default":null}]}`)
+	v3 := []byte(`{"type":"record","name":"R","fields":[{"name":"id","type":"long"},{"name":"tag","type":["null","string"],"default":null},{"name":"n","type":"long"}]}`)
+
+	if err := fs.registerSchema("R", v1); err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+	if err := fs.registerSchema("R", v2); err != nil {
+		t.Errorf("Expected a field with a default to be added, got %v", err)
+	}
+	if err := fs.registerSchema("R", v3); err == nil {
+		t.Error("Expected a field without a default to be refused")
+	}
+	registered, _ := os.ReadFile(filepath.Join(fs.basePath, "schemas", "R.avsc"))
+	if !bytes.Equal(registered, v2) {
+		t.Errorf("Expected the last compatible schema to stay registered, got %s", registered)
+	}
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+)
+
+// BlobKind is the snapshot kind of content-addressed raw blobs
+const BlobKind = "blob"
+
+// SaveRawBlob writes raw records as a content-addressed blob under blobs/, one JSON
+// record per line, payloads as received. The blob is named by the SHA-256 digest of
+// its uncompressed content and compressed and encrypted like archive files; a blob
+// already stored is not written again. raw_data rows reference the blob by the base
+// name of the snapshot's Path.
+func (fs *FileStorage) SaveRawBlob(data []map[string]interface{}, payloads []json.RawMessage) (Snapshot, error) {
+	var buf bytes.Buffer
+	if payloads != nil {
+		for _, payload := range payloads {
+			if err := json.Compact(&buf, payload); err != nil {
+				return Snapshot{}, fmt.Errorf("failed to encode raw payload: %w", err)
+			}
+			buf.WriteByte('\n')
+		}
+	} else if err := writeNDJSON(&buf, len(data), func(i int) interface{} { return data[i] }); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to encode raw record: %w", err)
+	}
+	records := len(data)
+	if payloads != nil {
+		records = len(payloads)
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	digest := hex.EncodeToString(sum[:])
+	name := fs.encryptedName(digest + ".ndjson" + fs.codec.Extension())
+	filename := fs.blobPath(name)
+	if stored, err := os.ReadFile(filename); err == nil {
+		fs.logger.Info(fmt.Sprintf("Raw blob already stored: %s", filename))
+		return newSnapshot(filename, BlobKind, records, stored), nil
+	}
+
+	content, err := codec.Compress(fs.codec, buf.Bytes())
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if content, err = fs.seal(content); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to encrypt blob: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := writeFileAtomic(filename, content); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to write blob: %w", err)
+	}
+	fs.logger.Info(fmt.Sprintf("Raw blob saved successfully: %s", filename))
+	return newSnapshot(filename, BlobKind, records, content), nil
+}
+
+// LoadBlob reads a blob written by SaveRawBlob, decrypting and decompressing it,
+// and checks its content against the digest it is named by
+func (fs *FileStorage) LoadBlob(name string) ([]byte, error) {
+	digest, _, _ := strings.Cut(name, ".")
+	if len(digest) != sha256.Size*2 || filepath.Base(name) != name {
+		return nil, fmt.Errorf("invalid blob name %q", name)
+	}
+	data, err := os.ReadFile(fs.blobPath(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob: %w", err)
+	}
+	if data, err = fs.open(data); err != nil {
+		return nil, fmt.Errorf("failed to decrypt blob: %w", err)
+	}
+	compression := codec.ForFile(TrimEncryptedExtension(name))
+	reader, err := compression.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s blob: %w", compression.Name(), err)
+	}
+	defer reader.Close()
+	var content bytes.Buffer
+	if _, err := content.ReadFrom(reader); err != nil {
+		return nil, fmt.Errorf("failed to decompress blob: %w", err)
+	}
+	if sum := sha256.Sum256(content.Bytes()); hex.EncodeToString(sum[:]) != digest {
+		return nil, errors.New("blob content does not match its digest")
+	}
+	return content.Bytes(), nil
+}
+
+// blobPath returns the file a blob is stored in, under a directory named by the
+// first two characters of its digest to keep directories small
+func (fs *FileStorage) blobPath(name string) string {
+	return filepath.Join(fs.basePath, "blobs", name[:2], name)
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+func TestSaveRawBlob(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	gzip, _ := codec.Get(codec.Gzip)
+	fs := NewFileStorage(t.TempDir(), gzip, logger)
+
+	payloads := []json.RawMessage{json.RawMessage(`{"id": 12345678901234567890, "b": 1, "a": 2}`), json.RawMessage(`{"id":2}`)}
+	data := []map[string]interface{}{{"id": 1.0}, {"id": 2.0}}
+	snapshot, err := fs.SaveRawBlob(data, payloads)
+	if err != nil {
+		t.Fatalf("Failed to save blob: %v", err)
+	}
+	name := filepath.Base(snapshot.Path)
+	if snapshot.Kind != BlobKind || snapshot.Records != 2 || !strings.HasSuffix(name, ".ndjson.gz") {
+		t.Errorf("Unexpected blob snapshot: %+v", snapshot)
+	}
+
+	again, err := fs.SaveRawBlob(data, payloads)
+	if err != nil || again.Path != snapshot.Path || again.SHA256 != snapshot.SHA256 {
+		t.Errorf("Expected the same content to reuse the blob, got %+v, %v", again, err)
+	}
+
+	content, err := fs.LoadBlob(name)
+	if err != nil {
+		t.Fatalf("Failed to load blob: %v", err)
+	}
+	if want := "{\"id\":12345678901234567890,\"b\":1,\"a\":2}\n{\"id\":2}\n"; string(content) != want {
+		t.Errorf("Expected the payloads as received, got %q", content)
+	}
+
+	// A blob no longer matching its digest is rejected
+	tampered, _ := codec.Compress(gzip, []byte("{\"id\":3}\n"))
+	if err := os.WriteFile(snapshot.Path, tampered, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.LoadBlob(name); err == nil {
+		t.Error("Expected a tampered blob to be rejected")
+	}
+	if _, err := fs.LoadBlob("../raw/" + name); err == nil {
+		t.Error("Expected a blob name with a path to be rejected")
+	}
+}
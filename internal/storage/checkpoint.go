@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Checkpoint stages, in order
+const (
+	// StageExtracted checkpoints hold a fetched batch that has not been stored yet
+	StageExtracted = "extracted"
+	// StageStored checkpoints hold a batch whose raw records are in the database,
+	// along with its processed records when writes are transactional
+	StageStored = "stored"
+)
+
+// Checkpoint records the progress of an interrupted run so it can be resumed
+// instead of fetching its batch again
+type Checkpoint struct {
+	RunID     string    `json:"run_id"`
+	Trigger   string    `json:"trigger"`
+	StartedAt time.Time `json:"started_at"`
+	Stage     string    `json:"stage"`
+	// LoadedSinks lists the sinks that already hold the batch's processed records
+	LoadedSinks []string                 `json:"loaded_sinks,omitempty"`
+	Raw         []map[string]interface{} `json:"raw"`
+}
+
+// SaveCheckpoint creates or replaces the checkpoint of a run
+func (fs *FileStorage) SaveCheckpoint(checkpoint Checkpoint) error {
+	checkpointPath := filepath.Join(fs.basePath, "checkpoints")
+	if err := os.MkdirAll(checkpointPath, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	jsonData, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	if jsonData, err = fs.seal(jsonData); err != nil {
+		return fmt.Errorf("failed to encrypt checkpoint: %w", err)
+	}
+	if err := writeFileAtomic(fs.checkpointFile(checkpoint.RunID), jsonData); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Checkpoints returns the checkpoints of incomplete runs, oldest first
+func (fs *FileStorage) Checkpoints() ([]Checkpoint, error) {
+	files, err := filepath.Glob(filepath.Join(fs.basePath, "checkpoints", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints := make([]Checkpoint, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+		}
+		if data, err = fs.open(data); err != nil {
+			return nil, fmt.Errorf("failed to decrypt checkpoint %s: %w", file, err)
+		}
+		var checkpoint Checkpoint
+		if err := json.Unmarshal(data, &checkpoint); err != nil {
+			return nil, fmt.Errorf("failed to parse checkpoint %s: %w", file, err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].StartedAt.Before(checkpoints[j].StartedAt)
+	})
+	return checkpoints, nil
+}
+
+// RemoveCheckpoint deletes the checkpoint of a completed run
+func (fs *FileStorage) RemoveCheckpoint(runID string) error {
+	if err := os.Remove(fs.checkpointFile(runID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (fs *FileStorage) checkpointFile(runID string) string {
+	return filepath.Join(fs.basePath, "checkpoints", runID+".json")
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+func TestCheckpoints(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	none, _ := codec.Get(codec.None)
+	fs := NewFileStorage(t.TempDir(), none, logger)
+
+	now := time.Now().UTC()
+	newer := Checkpoint{RunID: "b", StartedAt: now, Stage: StageExtracted, Raw: []map[string]interface{}{{"id": float64(2)}}}
+	older := Checkpoint{RunID: "a", StartedAt: now.Add(-time.Minute), Stage: StageExtracted, Raw: []map[string]interface{}{{"id": float64(1)}}}
+	for _, checkpoint := range []Checkpoint{newer, older} {
+		if err := fs.SaveCheckpoint(checkpoint); err != nil {
+			t.Fatalf("Failed to save checkpoint: %v", err)
+		}
+	}
+
+	older.Stage = StageStored
+	older.LoadedSinks = []string{"kafka"}
+	if err := fs.SaveCheckpoint(older); err != nil {
+		t.Fatalf("Failed to update checkpoint: %v", err)
+	}
+
+	checkpoints, err := fs.Checkpoints()
+	if err != nil {
+		t.Fatalf("Failed to list checkpoints: %v", err)
+	}
+	if len(checkpoints) != 2 || checkpoints[0].RunID != "a" || checkpoints[1].RunID != "b" {
+		t.Fatalf("Expected checkpoints a and b oldest first, got %+v", checkpoints)
+	}
+	if checkpoints[0].Stage != StageStored || len(checkpoints[0].LoadedSinks) != 1 || len(checkpoints[0].Raw) != 1 {
+		t.Errorf("Expected updated checkpoint, got %+v", checkpoints[0])
+	}
+
+	if err := fs.RemoveCheckpoint("a"); err != nil {
+		t.Fatalf("Failed to remove checkpoint: %v", err)
+	}
+	if checkpoints, _ = fs.Checkpoints(); len(checkpoints) != 1 {
+		t.Errorf("Expected 1 checkpoint after removal, got %d", len(checkpoints))
+	}
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// CSV quoting modes
+const (
+	// QuoteMinimal quotes only values containing the delimiter, quotes or line breaks
+	QuoteMinimal = "minimal"
+	// QuoteAll quotes every value
+	QuoteAll = "all"
+)
+
+// CSVOptions controls how batches are written as CSV
+type CSVOptions struct {
+	Delimiter rune
+	Header    bool
+	Quoting   string
+}
+
+// Validate checks the delimiter and quoting mode
+func (o CSVOptions) Validate() error {
+	switch o.Delimiter {
+	case 0, '"', '\r', '\n':
+		return fmt.Errorf("invalid CSV delimiter %q", o.Delimiter)
+	}
+	if o.Quoting != QuoteMinimal && o.Quoting != QuoteAll {
+		return fmt.Errorf("unknown CSV quoting %q, expected %s or %s", o.Quoting, QuoteMinimal, QuoteAll)
+	}
+	return nil
+}
+
+// UseCSV makes the storage write raw and processed batches as CSV instead of envelopes
+func (f *batchFormat) UseCSV(options CSVOptions) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	f.format = FormatCSV
+	f.csv = &options
+	return nil
+}
+
+// writeRawCSV writes raw records with one column per key seen in the batch, in
+// alphabetical order; nested values are written as JSON
+func (o CSVOptions) writeRawCSV(w io.Writer, records []map[string]interface{}) error {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, record := range records {
+		for key := range record {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return o.writeCSV(w, columns, records)
+}
+
+// writeProcessedCSV writes processed records with one column per processed field
+func (o CSVOptions) writeProcessedCSV(w io.Writer, records []database.ProcessedRecord) error {
+	columns := make([]string, len(transform.Fields))
+	for i, field := range transform.Fields {
+		columns[i] = field.Name
+	}
+	rows := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		rows[i] = transform.Row(record)
+	}
+	return o.writeCSV(w, columns, rows)
+}
+
+func (o CSVOptions) writeCSV(w io.Writer, columns []string, rows []map[string]interface{}) error {
+	out := bufio.NewWriter(w)
+	if o.Header {
+		o.writeLine(out, columns)
+	}
+	line := make([]string, len(columns))
+	for _, row := range rows {
+		for i, column := range columns {
+			value, err := csvValue(row[column])
+			if err != nil {
+				return fmt.Errorf("failed to format column %s: %w", column, err)
+			}
+			line[i] = value
+		}
+		o.writeLine(out, line)
+	}
+	return out.Flush()
+}
+
+func (o CSVOptions) writeLine(out *bufio.Writer, values []string) {
+	for i, value := range values {
+		if i > 0 {
+			out.WriteRune(o.Delimiter)
+		}
+		if o.Quoting == QuoteAll || o.needsQuotes(value) {
+			out.WriteByte('"')
+			out.WriteString(strings.ReplaceAll(value, `"`, `""`))
+			out.WriteByte('"')
+		} else {
+			out.WriteString(value)
+		}
+	}
+	out.WriteString("\r\n")
+}
+
+// needsQuotes reports whether a value would be misread without quotes
+func (o CSVOptions) needsQuotes(value string) bool {
+	if value == "" {
+		return false
+	}
+	return strings.ContainsRune(value, o.Delimiter) || strings.ContainsAny(value, "\"\r\n") ||
+		value[0] == ' ' || value[len(value)-1] == ' '
+}
+
+// csvValue formats a record value as a CSV field
+func csvValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
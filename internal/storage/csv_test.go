@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+func TestSaveCSV(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	tests := []struct {
+		name      string
+		options   CSVOptions
+		processed string
+		raw       string
+	}{
+		{
+			name:      "minimal quoting with header",
+			options:   CSVOptions{Delimiter: ',', Header: true, Quoting: QuoteMinimal},
+			processed: "user_id,title,body\r\n1,\"Hello, world\",\"She said \"\"hi\"\"\"\r\n",
+			raw:       "id,tags,title\r\n7,\"[\"\"a\"\",\"\"b\"\"]\",Hello\r\n",
+		},
+		{
+			name:      "quote all without header",
+			options:   CSVOptions{Delimiter: ';', Quoting: QuoteAll},
+			processed: "\"1\";\"Hello, world\";\"She said \"\"hi\"\"\"\r\n",
+			raw:       "\"7\";\"[\"\"a\"\",\"\"b\"\"]\";\"Hello\"\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			none, _ := codec.Get(codec.None)
+			fs := NewFileStorage(dir, none, logger)
+			if err := fs.UseCSV(tt.options); err != nil {
+				t.Fatalf("Failed to enable CSV: %v", err)
+			}
+
+			if _, err := fs.SaveProcessedData(context.Background(), []database.ProcessedRecord{{UserID: 1, Title: "Hello, world", Body: `She said "hi"`}}); err != nil {
+				t.Fatalf("Failed to save processed data: %v", err)
+			}
+			if _, err := fs.SaveRawData(context.Background(), []map[string]interface{}{{"id": float64(7), "title": "Hello", "tags": []interface{}{"a", "b"}}}); err != nil {
+				t.Fatalf("Failed to save raw data: %v", err)
+			}
+
+			if got := readSingleFile(t, filepath.Join(dir, "processed", "*.csv")); got != tt.processed {
+				t.Errorf("Unexpected processed CSV:\n%q\nwant\n%q", got, tt.processed)
+			}
+			if got := readSingleFile(t, filepath.Join(dir, "raw", "*.csv")); got != tt.raw {
+				t.Errorf("Unexpected raw CSV:\n%q\nwant\n%q", got, tt.raw)
+			}
+		})
+	}
+}
+
+func TestCSVOptionsValidate(t *testing.T) {
+	if err := (CSVOptions{Delimiter: '\t', Quoting: QuoteAll}).Validate(); err != nil {
+		t.Errorf("Expected tab delimiter to be valid, got %v", err)
+	}
+	if err := (CSVOptions{Delimiter: '"', Quoting: QuoteMinimal}).Validate(); err == nil {
+		t.Error("Expected quote delimiter to be rejected")
+	}
+	if err := (CSVOptions{Delimiter: ',', Quoting: "never"}).Validate(); err == nil {
+		t.Error("Expected unknown quoting to be rejected")
+	}
+}
+
+func readSingleFile(t *testing.T, pattern string) string {
+	t.Helper()
+	files, err := filepath.Glob(pattern)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one file matching %s, got %v (%v)", pattern, files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", files[0], err)
+	}
+	return string(data)
+}
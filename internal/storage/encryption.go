@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/encryption"
+)
+
+// EncryptedExtension is appended to the names of encrypted batch and archive files
+const EncryptedExtension = ".enc"
+
+// SetEncryption encrypts batch, archive, pending batch and checkpoint files with
+// the primary key of keyring; files written before are still read unencrypted
+func (fs *FileStorage) SetEncryption(keyring *encryption.Keyring) {
+	fs.keyring = keyring
+}
+
+// seal encrypts file content when encryption is enabled
+func (fs *FileStorage) seal(data []byte) ([]byte, error) {
+	if fs.keyring == nil {
+		return data, nil
+	}
+	return fs.keyring.Encrypt(data)
+}
+
+// open decrypts file content written by seal, passing unencrypted content through
+func (fs *FileStorage) open(data []byte) ([]byte, error) {
+	if !encryption.IsEncrypted(data) {
+		return data, nil
+	}
+	if fs.keyring == nil {
+		return nil, errors.New("file is encrypted but no encryption keys are configured")
+	}
+	return fs.keyring.Decrypt(data)
+}
+
+// encryptedName returns the name of a batch or archive file as stored
+func (fs *FileStorage) encryptedName(name string) string {
+	if fs.keyring == nil {
+		return name
+	}
+	return name + EncryptedExtension
+}
+
+// TrimEncryptedExtension returns a file name without its encryption extension,
+// ending with the extension of its codec
+func TrimEncryptedExtension(filename string) string {
+	return strings.TrimSuffix(filename, EncryptedExtension)
+}
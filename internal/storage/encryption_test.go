@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/encryption"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+func TestEncryptedStorage(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	dir := t.TempDir()
+	gz, _ := codec.Get(codec.Gzip)
+	fs := NewFileStorage(dir, gz, logger)
+
+	// A batch written before encryption was enabled stays readable
+	plain, err := fs.SaveProcessedData(context.Background(), []database.ProcessedRecord{{UserID: 1, Title: "Before"}})
+	if err != nil {
+		t.Fatalf("Failed to save processed data: %v", err)
+	}
+
+	keyring, _ := encryption.NewKeyring(map[string][]byte{"k1": bytes.Repeat([]byte{7}, encryption.KeySize)}, "k1")
+	fs.SetEncryption(keyring)
+
+	snapshot, err := fs.SaveProcessedData(context.Background(), []database.ProcessedRecord{{UserID: 2, Title: "Secret title"}})
+	if err != nil {
+		t.Fatalf("Failed to save processed data: %v", err)
+	}
+	if !strings.HasSuffix(snapshot.Path, ".json.gz.enc") {
+		t.Errorf("Expected an encrypted file name, got %s", snapshot.Path)
+	}
+	content, _ := os.ReadFile(snapshot.Path)
+	if !encryption.IsEncrypted(content) {
+		t.Error("Expected the batch file to be encrypted")
+	}
+
+	for _, path := range []string{plain.Path, snapshot.Path} {
+		if _, err := fs.LoadBatch(path); err != nil {
+			t.Errorf("Failed to load %s: %v", filepath.Base(path), err)
+		}
+	}
+
+	filename, err := fs.SavePendingBatch(PendingBatch{Processed: []database.ProcessedRecord{{UserID: 3, Title: "Pending"}}})
+	if err != nil {
+		t.Fatalf("Failed to save pending batch: %v", err)
+	}
+	if content, _ := os.ReadFile(filename); bytes.Contains(content, []byte("Pending")) {
+		t.Error("Expected the pending batch to be encrypted")
+	}
+	batch, err := fs.LoadPendingBatch(filename)
+	if err != nil || batch.Processed[0].Title != "Pending" {
+		t.Errorf("Expected pending batch to round-trip, got %+v (%v)", batch, err)
+	}
+
+	// Without keys encrypted files cannot be read
+	if _, err := NewFileStorage(dir, gz, logger).LoadPendingBatch(filename); err == nil {
+		t.Error("Expected an error reading an encrypted file without keys")
+	}
+}
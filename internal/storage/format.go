@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/envelope"
+)
+
+// Output formats of batch files
+const (
+	// FormatJSON writes batch envelopes, which can be posted to /ingest
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+	// FormatAvro writes object container files, compressed per block
+	FormatAvro = "avro"
+)
+
+// Storage persists snapshots of raw and processed batches, and the manifest of
+// each run listing them
+type Storage interface {
+	SaveRawData(ctx context.Context, data []map[string]interface{}) (Snapshot, error)
+	// SaveRawPayloads saves raw records with the JSON each was received as, which
+	// JSON and NDJSON batches hold as is
+	SaveRawPayloads(ctx context.Context, data []map[string]interface{}, payloads []json.RawMessage) (Snapshot, error)
+	SaveProcessedData(ctx context.Context, records []database.ProcessedRecord) (Snapshot, error)
+	// SaveRunManifest returns the path or key the manifest was written to
+	SaveRunManifest(manifest RunManifest) (string, error)
+}
+
+// Snapshot describes a batch snapshot written by a Storage
+type Snapshot struct {
+	// Path is the file path, or the object key of object stores
+	Path    string `json:"path"`
+	Kind    string `json:"kind"`
+	Records int    `json:"records"`
+	Bytes   int    `json:"bytes"`
+	// SHA256 is the hex digest of the stored, possibly compressed, content
+	SHA256 string `json:"sha256"`
+}
+
+// newSnapshot describes encoded batch content stored under path
+func newSnapshot(path, kind string, records int, content []byte) Snapshot {
+	sum := sha256.Sum256(content)
+	return Snapshot{Path: path, Kind: kind, Records: records, Bytes: len(content), SHA256: hex.EncodeToString(sum[:])}
+}
+
+// batchFormat encodes batches as compressed envelopes, or as NDJSON, CSV or Avro
+// records once UseNDJSON, UseCSV or UseAvro is called
+type batchFormat struct {
+	codec codec.Codec
+	// format is FormatJSON (envelopes) when empty, FormatNDJSON, FormatCSV or FormatAvro
+	format string
+	// csv holds the CSV options of the FormatCSV format
+	csv *CSVOptions
+	// avro holds the schemas of the FormatAvro format
+	avro *avroFormat
+	// layout is the partition directory template of batches; empty keeps them flat
+	layout string
+}
+
+// UseNDJSON makes the storage write raw and processed batches as one JSON record per line
+func (f *batchFormat) UseNDJSON() {
+	f.format = FormatNDJSON
+}
+
+// partitionPlaceholders are the fields of a partition layout, filled from the
+// batch creation time in UTC
+var partitionPlaceholders = []string{"{date}", "{year}", "{month}", "{day}", "{hour}"}
+
+// SetPartitionLayout places batches under partition directories rendered from
+// layout, e.g. "dt={date}/hour={hour}"; an empty layout keeps batches flat
+func (f *batchFormat) SetPartitionLayout(layout string) error {
+	layout = strings.Trim(layout, "/")
+	rest := layout
+	for _, placeholder := range partitionPlaceholders {
+		rest = strings.ReplaceAll(rest, placeholder, "")
+	}
+	if strings.ContainsAny(rest, "{}\\") {
+		return fmt.Errorf("invalid partition layout %q, placeholders are %s", layout, strings.Join(partitionPlaceholders, ", "))
+	}
+	for _, segment := range strings.Split(layout, "/") {
+		if layout != "" && (segment == "" || segment == "." || segment == "..") {
+			return fmt.Errorf("invalid partition layout %q, empty or relative path segment", layout)
+		}
+	}
+	f.layout = layout
+	return nil
+}
+
+// partition renders the partition directory of a batch created at t
+func (f *batchFormat) partition(t time.Time) string {
+	if f.layout == "" {
+		return ""
+	}
+	t = t.UTC()
+	return strings.NewReplacer(
+		"{date}", t.Format("2006-01-02"),
+		"{year}", t.Format("2006"),
+		"{month}", t.Format("01"),
+		"{day}", t.Format("02"),
+		"{hour}", t.Format("15"),
+	).Replace(f.layout)
+}
+
+// encodeRaw returns the name and content of a raw batch file
+func (f *batchFormat) encodeRaw(data []map[string]interface{}) (string, []byte, error) {
+	env, err := envelope.NewRaw(data)
+	if err != nil {
+		return "", nil, err
+	}
+	return f.encode("raw_data", env, func(w io.Writer) error {
+		switch f.format {
+		case FormatCSV:
+			return f.csv.writeRawCSV(w, data)
+		case FormatAvro:
+			return f.avro.writeRaw(w, data)
+		}
+		return writeNDJSON(w, len(data), func(i int) interface{} { return data[i] })
+	})
+}
+
+// encodeRawPayloads returns the name and content of a raw batch file, writing the
+// payloads of the records as is in the JSON and NDJSON formats
+func (f *batchFormat) encodeRawPayloads(data []map[string]interface{}, payloads []json.RawMessage) (string, []byte, error) {
+	if f.format == FormatCSV || f.format == FormatAvro {
+		return f.encodeRaw(data)
+	}
+	env, err := envelope.NewRawPayloads(payloads)
+	if err != nil {
+		return "", nil, err
+	}
+	return f.encode("raw_data", env, func(w io.Writer) error {
+		return writeNDJSON(w, len(payloads), func(i int) interface{} { return payloads[i] })
+	})
+}
+
+// encodeProcessed returns the name and content of a processed batch file
+func (f *batchFormat) encodeProcessed(records []database.ProcessedRecord) (string, []byte, error) {
+	env, err := envelope.NewProcessed(records)
+	if err != nil {
+		return "", nil, err
+	}
+	return f.encode("processed_data", env, func(w io.Writer) error {
+		switch f.format {
+		case FormatCSV:
+			return f.csv.writeProcessedCSV(w, records)
+		case FormatAvro:
+			return f.avro.writeProcessed(w, records)
+		}
+		return writeNDJSON(w, len(records), func(i int) interface{} { return records[i] })
+	})
+}
+
+// encode names a batch after its envelope, below its partition directory, and
+// renders the envelope, or its records with writeRecords in the other formats
+func (f *batchFormat) encode(prefix string, env *envelope.Envelope, writeRecords func(w io.Writer) error) (string, []byte, error) {
+	format := f.format
+	if format == "" {
+		format = FormatJSON
+	}
+	compression := f.compression()
+	timestamp := env.CreatedAt.Format("20060102_150405")
+	name := path.Join(f.partition(env.CreatedAt), fmt.Sprintf("%s_%s_%s.%s%s", prefix, timestamp, env.BatchID[:8], format, compression.Extension()))
+
+	var data []byte
+	var err error
+	if format == FormatJSON {
+		data, err = json.MarshalIndent(env, "", "  ")
+	} else {
+		var buf bytes.Buffer
+		err = writeRecords(&buf)
+		data = buf.Bytes()
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal data: %w", err)
+	}
+	if data, err = codec.Compress(compression, data); err != nil {
+		return "", nil, err
+	}
+	return name, data, nil
+}
+
+// compression returns the codec of whole batch files; Avro files compress their
+// blocks instead, so they stay readable without decompressing them first
+func (f *batchFormat) compression() codec.Codec {
+	if f.format == FormatAvro {
+		none, _ := codec.Get(codec.None)
+		return none
+	}
+	return f.codec
+}
+
+// writeNDJSON writes count records, one JSON document per line, so files can be
+// concatenated and parsed as a stream
+func writeNDJSON(w io.Writer, count int, record func(i int) interface{}) error {
+	encoder := json.NewEncoder(w)
+	for i := 0; i < count; i++ {
+		if err := encoder.Encode(record(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentType returns the media type of encoded batches
+func (f *batchFormat) contentType() string {
+	switch f.format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatAvro:
+		return "application/avro"
+	}
+	return "application/json"
+}
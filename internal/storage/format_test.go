@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+func TestSaveNDJSON(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	dir := t.TempDir()
+	none, _ := codec.Get(codec.None)
+	fs := NewFileStorage(dir, none, logger)
+	fs.UseNDJSON()
+
+	records := []database.ProcessedRecord{{UserID: 1, Title: "First"}, {UserID: 2, Title: "Second\nline"}}
+	snapshot, err := fs.SaveProcessedData(context.Background(), records)
+	if err != nil {
+		t.Fatalf("Failed to save processed data: %v", err)
+	}
+	if filepath.Ext(snapshot.Path) != ".ndjson" {
+		t.Errorf("Expected an .ndjson file, got %s", snapshot.Path)
+	}
+
+	file, err := os.Open(snapshot.Path)
+	if err != nil {
+		t.Fatalf("Failed to open snapshot: %v", err)
+	}
+	defer file.Close()
+	var decoded []database.ProcessedRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record database.ProcessedRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Line %q is not a JSON record: %v", scanner.Text(), err)
+		}
+		decoded = append(decoded, record)
+	}
+	if len(decoded) != 2 || decoded[1] != records[1] {
+		t.Errorf("Expected one line per record, got %+v", decoded)
+	}
+}
+
+func TestSaveRawPayloads(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	none, _ := codec.Get(codec.None)
+	fs := NewFileStorage(t.TempDir(), none, logger)
+	fs.UseNDJSON()
+
+	// Payloads are written as received, compacted to one line each
+	payloads := []json.RawMessage{json.RawMessage(`{"z": 1, "id": 12345678901234567890}`), json.RawMessage("{\n  \"id\": 2\n}")}
+	data := []map[string]interface{}{{"id": float64(1)}, {"id": float64(2)}}
+	snapshot, err := fs.SaveRawPayloads(context.Background(), data, payloads)
+	if err != nil {
+		t.Fatalf("Failed to save raw payloads: %v", err)
+	}
+	content, err := os.ReadFile(snapshot.Path)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+	if want := "{\"z\":1,\"id\":12345678901234567890}\n{\"id\":2}\n"; string(content) != want {
+		t.Errorf("Expected the payloads as received, got %q", content)
+	}
+	if snapshot.Records != 2 {
+		t.Errorf("Expected 2 records, got %d", snapshot.Records)
+	}
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// RunManifestVersion is the format version of run manifests written by this build
+const RunManifestVersion = 1
+
+// RunManifest lists everything a run wrote. It is written after the run's batch
+// files, so downstream loaders can verify a drop is complete before consuming it.
+type RunManifest struct {
+	Version    int       `json:"version"`
+	RunID      string    `json:"run_id"`
+	Trigger    string    `json:"trigger"`
+	Status     string    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// SchemaVersion identifies the processed schema of the run's processed files
+	SchemaVersion string       `json:"schema_version"`
+	Records       RecordCounts `json:"records"`
+	Files         []Snapshot   `json:"files"`
+}
+
+// RecordCounts are the record totals of a run
+type RecordCounts struct {
+	Extracted   int `json:"extracted"`
+	Transformed int `json:"transformed"`
+	Rejected    int `json:"rejected"`
+	Loaded      int `json:"loaded"`
+	// Skipped counts the processed records not loaded as unchanged since last loaded
+	Skipped int `json:"skipped,omitempty"`
+}
+
+// encodeRunManifest returns the name and content of a run manifest, placed in the
+// partition of the run's finish time
+func (f *batchFormat) encodeRunManifest(manifest RunManifest) (string, []byte, error) {
+	manifest.Version = RunManifestVersion
+	if manifest.Files == nil {
+		manifest.Files = []Snapshot{}
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal run manifest: %w", err)
+	}
+	name := fmt.Sprintf("run_%s_%s.json", manifest.FinishedAt.UTC().Format("20060102_150405"), manifest.RunID)
+	return path.Join(f.partition(manifest.FinishedAt), name), data, nil
+}
+
+// SaveRunManifest atomically writes the manifest of a run under manifests/
+func (fs *FileStorage) SaveRunManifest(manifest RunManifest) (string, error) {
+	name, content, err := fs.encodeRunManifest(manifest)
+	if err != nil {
+		return "", err
+	}
+	filename := filepath.Join(fs.basePath, "manifests", filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := writeFileAtomic(filename, content); err != nil {
+		return "", fmt.Errorf("failed to write run manifest: %w", err)
+	}
+	return filename, nil
+}
+
+// ManifestEntry records the outcome of one run and the snapshots it wrote
+type ManifestEntry struct {
+	RunID      string     `json:"run_id"`
+	Trigger    string     `json:"trigger"`
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt time.Time  `json:"finished_at"`
+	Snapshots  []Snapshot `json:"snapshots"`
+}
+
+// AppendManifest appends an entry as one JSON line to the manifest of the day
+// the run finished, manifests/manifest_<date>.jsonl
+func (fs *FileStorage) AppendManifest(entry ManifestEntry) error {
+	manifestPath := filepath.Join(fs.basePath, "manifests")
+	if err := os.MkdirAll(manifestPath, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if entry.Snapshots == nil {
+		entry.Snapshots = []Snapshot{}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest entry: %w", err)
+	}
+	filename := filepath.Join(manifestPath, fmt.Sprintf("manifest_%s.jsonl", entry.FinishedAt.UTC().Format("20060102")))
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open manifest: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return file.Close()
+}
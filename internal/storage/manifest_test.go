@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+func TestSaveBatchChecksumAndManifest(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	dir := t.TempDir()
+	gzip, _ := codec.Get(codec.Gzip)
+	fs := NewFileStorage(dir, gzip, logger)
+
+	snapshot, err := fs.SaveRawData(context.Background(), []map[string]interface{}{{"id": float64(1)}})
+	if err != nil {
+		t.Fatalf("Failed to save raw data: %v", err)
+	}
+
+	content, err := os.ReadFile(snapshot.Path)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+	sum := sha256.Sum256(content)
+	if snapshot.SHA256 != hex.EncodeToString(sum[:]) || snapshot.Bytes != len(content) || snapshot.Records != 1 {
+		t.Errorf("Snapshot does not describe the written file: %+v", snapshot)
+	}
+	sidecar, err := os.ReadFile(snapshot.Path + ".sha256")
+	if err != nil {
+		t.Fatalf("Failed to read checksum sidecar: %v", err)
+	}
+	if want := snapshot.SHA256 + "  " + filepath.Base(snapshot.Path) + "\n"; string(sidecar) != want {
+		t.Errorf("Unexpected sidecar %q, want %q", sidecar, want)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "raw", "*.tmp")); len(leftovers) != 0 {
+		t.Errorf("Expected no temporary files, got %v", leftovers)
+	}
+
+	finishedAt := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	for _, runID := range []string{"a", "b"} {
+		entry := ManifestEntry{RunID: runID, Status: "succeeded", FinishedAt: finishedAt, Snapshots: []Snapshot{snapshot}}
+		if err := fs.AppendManifest(entry); err != nil {
+			t.Fatalf("Failed to append manifest: %v", err)
+		}
+	}
+
+	file, err := os.Open(filepath.Join(dir, "manifests", "manifest_20240501.jsonl"))
+	if err != nil {
+		t.Fatalf("Failed to open manifest: %v", err)
+	}
+	defer file.Close()
+	var runIDs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry ManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid manifest line %q: %v", scanner.Text(), err)
+		}
+		if len(entry.Snapshots) != 1 || entry.Snapshots[0].SHA256 != snapshot.SHA256 {
+			t.Errorf("Unexpected manifest snapshots %+v", entry.Snapshots)
+		}
+		runIDs = append(runIDs, entry.RunID)
+	}
+	if strings.Join(runIDs, ",") != "a,b" {
+		t.Errorf("Expected one manifest line per run, got %v", runIDs)
+	}
+}
+
+func TestSaveRunManifest(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	none, _ := codec.Get(codec.None)
+	dir := t.TempDir()
+	fs := NewFileStorage(dir, none, logger)
+	if err := fs.SetPartitionLayout("dt={date}"); err != nil {
+		t.Fatalf("Failed to set partition layout: %v", err)
+	}
+	snapshot, err := fs.SaveProcessedData(context.Background(), []database.ProcessedRecord{{UserID: 1, Title: "Title"}})
+	if err != nil {
+		t.Fatalf("Failed to save processed data: %v", err)
+	}
+
+	manifest := RunManifest{
+		RunID:         "run1",
+		Status:        "succeeded",
+		FinishedAt:    time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC),
+		SchemaVersion: "abc",
+		Records:       RecordCounts{Extracted: 2, Transformed: 1, Rejected: 1, Loaded: 1},
+		Files:         []Snapshot{snapshot},
+	}
+	filename, err := fs.SaveRunManifest(manifest)
+	if err != nil {
+		t.Fatalf("Failed to save run manifest: %v", err)
+	}
+	if want := filepath.Join(dir, "manifests", "dt=2024-05-01", "run_20240501_130000_run1.json"); filename != want {
+		t.Errorf("Expected manifest at %s, got %s", want, filename)
+	}
+
+	data, _ := os.ReadFile(filename)
+	var written RunManifest
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatalf("Invalid run manifest: %v", err)
+	}
+	if written.Version != RunManifestVersion || written.Records != manifest.Records || len(written.Files) != 1 || written.Files[0].SHA256 != snapshot.SHA256 {
+		t.Errorf("Unexpected run manifest %+v", written)
+	}
+
+	// Runs that wrote nothing still get a manifest, with an empty file list
+	store := &memoryStore{}
+	key, err := NewObjectStorage(store, "lake", none, logger).SaveRunManifest(RunManifest{RunID: "run2", FinishedAt: manifest.FinishedAt})
+	if err != nil || key != "lake/manifests/run_20240501_130000_run2.json" {
+		t.Errorf("Unexpected run manifest key %s (%v)", key, err)
+	}
+}
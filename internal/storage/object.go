@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+// ObjectStore uploads objects to a bucket or container
+type ObjectStore interface {
+	PutObject(ctx context.Context, key string, body []byte, contentType string, metadata map[string]string) error
+}
+
+// ObjectStorage writes batch snapshots to an object store, laid out like the
+// data directory under a key prefix
+type ObjectStorage struct {
+	store  ObjectStore
+	prefix string
+	batchFormat
+	logger *logging.Logger
+}
+
+// NewObjectStorage creates a storage writing objects compressed with compression under prefix
+func NewObjectStorage(store ObjectStore, prefix string, compression codec.Codec, logger *logging.Logger) *ObjectStorage {
+	return &ObjectStorage{
+		store:       store,
+		prefix:      prefix,
+		batchFormat: batchFormat{codec: compression},
+		logger:      logger,
+	}
+}
+
+// SaveRawData uploads raw data as a batch object
+func (s *ObjectStorage) SaveRawData(ctx context.Context, data []map[string]interface{}) (Snapshot, error) {
+	logger := s.logger.ForContext(ctx)
+	name, content, err := s.encodeRaw(data)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to encode raw data: %v", err))
+		return Snapshot{}, err
+	}
+	return s.saveBatch(ctx, "raw", name, len(data), content)
+}
+
+// SaveRawPayloads uploads raw records, keeping the payloads of JSON and NDJSON batches as received
+func (s *ObjectStorage) SaveRawPayloads(ctx context.Context, data []map[string]interface{}, payloads []json.RawMessage) (Snapshot, error) {
+	logger := s.logger.ForContext(ctx)
+	name, content, err := s.encodeRawPayloads(data, payloads)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to encode raw data: %v", err))
+		return Snapshot{}, err
+	}
+	return s.saveBatch(ctx, "raw", name, len(payloads), content)
+}
+
+// SaveProcessedData uploads processed records as a batch object
+func (s *ObjectStorage) SaveProcessedData(ctx context.Context, records []database.ProcessedRecord) (Snapshot, error) {
+	logger := s.logger.ForContext(ctx)
+	name, content, err := s.encodeProcessed(records)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to encode processed data: %v", err))
+		return Snapshot{}, err
+	}
+	return s.saveBatch(ctx, "processed", name, len(records), content)
+}
+
+// saveBatch uploads an encoded batch, recording its checksum in the object
+// metadata; a failed upload never leaves a partial object behind
+func (s *ObjectStorage) saveBatch(ctx context.Context, dir, name string, records int, content []byte) (Snapshot, error) {
+	logger := s.logger.ForContext(ctx)
+	key := path.Join(s.prefix, dir, name)
+	snapshot := newSnapshot(key, dir, records, content)
+	metadata := map[string]string{"codec": s.compression().Name(), "sha256": snapshot.SHA256}
+	if err := s.store.PutObject(ctx, key, content, s.contentType(), metadata); err != nil {
+		logger.Error(fmt.Sprintf("Failed to upload %s data: %v", dir, err))
+		return Snapshot{}, fmt.Errorf("failed to upload data: %w", err)
+	}
+
+	logger.Info(fmt.Sprintf("%s data uploaded successfully: %s (%d bytes)", strings.ToUpper(dir[:1])+dir[1:], key, len(content)))
+	return snapshot, nil
+}
+
+// SaveRunManifest uploads the manifest of a run under the manifests/ prefix
+func (s *ObjectStorage) SaveRunManifest(manifest RunManifest) (string, error) {
+	name, content, err := s.encodeRunManifest(manifest)
+	if err != nil {
+		return "", err
+	}
+	key := path.Join(s.prefix, "manifests", name)
+	if err := s.store.PutObject(context.Background(), key, content, "application/json", map[string]string{"run-id": manifest.RunID}); err != nil {
+		return "", fmt.Errorf("failed to upload run manifest: %w", err)
+	}
+	return key, nil
+}
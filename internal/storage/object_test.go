@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+type memoryStore struct {
+	keys         []string
+	contentTypes []string
+	metadata     []map[string]string
+}
+
+func (m *memoryStore) PutObject(ctx context.Context, key string, body []byte, contentType string, metadata map[string]string) error {
+	m.keys = append(m.keys, key)
+	m.contentTypes = append(m.contentTypes, contentType)
+	m.metadata = append(m.metadata, metadata)
+	return nil
+}
+
+func TestObjectStorage(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	store := &memoryStore{}
+	zstd, _ := codec.Get(codec.Zstd)
+	var snapshots Storage = NewObjectStorage(store, "lake/etl", zstd, logger)
+
+	if _, err := snapshots.SaveRawData(context.Background(), []map[string]interface{}{{"id": float64(1)}}); err != nil {
+		t.Fatalf("Failed to save raw data: %v", err)
+	}
+	if _, err := snapshots.SaveProcessedData(context.Background(), []database.ProcessedRecord{{UserID: 1, Title: "Title"}}); err != nil {
+		t.Fatalf("Failed to save processed data: %v", err)
+	}
+
+	if len(store.keys) != 2 {
+		t.Fatalf("Expected 2 objects, got %v", store.keys)
+	}
+	if !strings.HasPrefix(store.keys[0], "lake/etl/raw/raw_data_") || !strings.HasSuffix(store.keys[0], ".json.zst") {
+		t.Errorf("Unexpected raw key %s", store.keys[0])
+	}
+	if !strings.HasPrefix(store.keys[1], "lake/etl/processed/processed_data_") {
+		t.Errorf("Unexpected processed key %s", store.keys[1])
+	}
+	if store.contentTypes[0] != "application/json" || store.metadata[0]["codec"] != codec.Zstd {
+		t.Errorf("Unexpected content type %q or metadata %v", store.contentTypes[0], store.metadata[0])
+	}
+}
+
+func TestPartitionLayout(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	store := &memoryStore{}
+	none, _ := codec.Get(codec.None)
+	snapshots := NewObjectStorage(store, "", none, logger)
+	if err := snapshots.SetPartitionLayout("dt={date}/hour={hour}"); err != nil {
+		t.Fatalf("Failed to set partition layout: %v", err)
+	}
+	if _, err := snapshots.SaveRawData(context.Background(), []map[string]interface{}{{"id": float64(1)}}); err != nil {
+		t.Fatalf("Failed to save raw data: %v", err)
+	}
+
+	now := time.Now().UTC()
+	if want := "raw/dt=" + now.Format("2006-01-02") + "/hour="; !strings.HasPrefix(store.keys[0], want) {
+		t.Errorf("Expected key under %s, got %s", want, store.keys[0])
+	}
+
+	for _, layout := range []string{"dt={week}", "{date}//{hour}", "../{date}"} {
+		if err := snapshots.SetPartitionLayout(layout); err == nil {
+			t.Errorf("Expected layout %q to be rejected", layout)
+		}
+	}
+}
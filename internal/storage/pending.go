@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+// PendingBatch is a batch that could not be written to the database and is
+// waiting on disk to be loaded once it recovers
+type PendingBatch struct {
+	CreatedAt time.Time `json:"created_at"`
+	// RunID is the run that produced the batch, so loaded rows are traced to it
+	RunID string `json:"run_id,omitempty"`
+	// Batch is the number of the batch within its run, see database.WithLoadBatch
+	Batch     int                        `json:"batch,omitempty"`
+	Raw       []map[string]interface{}   `json:"raw,omitempty"`
+	Processed []database.ProcessedRecord `json:"processed,omitempty"`
+}
+
+// SavePendingBatch stores a batch under the pending directory
+func (fs *FileStorage) SavePendingBatch(batch PendingBatch) (string, error) {
+	pendingPath := filepath.Join(fs.basePath, "pending")
+	if err := os.MkdirAll(pendingPath, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	filename := filepath.Join(pendingPath, fmt.Sprintf("pending_%s_%09d.json", now.Format("20060102_150405"), now.Nanosecond()))
+	if err := fs.UpdatePendingBatch(filename, batch); err != nil {
+		return "", err
+	}
+
+	fs.logger.Info(fmt.Sprintf("Pending batch saved: %s", filename))
+	return filename, nil
+}
+
+// UpdatePendingBatch atomically replaces the content of a pending batch file
+func (fs *FileStorage) UpdatePendingBatch(filename string, batch PendingBatch) error {
+	jsonData, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending batch: %w", err)
+	}
+	if jsonData, err = fs.seal(jsonData); err != nil {
+		return fmt.Errorf("failed to encrypt pending batch: %w", err)
+	}
+
+	if err := writeFileAtomic(filename, jsonData); err != nil {
+		return fmt.Errorf("failed to write pending batch: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes to a temporary file first, flushed to disk before it is
+// renamed into place, so a crash never leaves a truncated file
+func writeFileAtomic(filename string, data []byte) error {
+	tmp := filename + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(filename))
+}
+
+// syncDir flushes a directory so a rename into it survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// PendingBatches returns the pending batch files, oldest first
+func (fs *FileStorage) PendingBatches() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(fs.basePath, "pending", "pending_*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// LoadPendingBatch reads a pending batch file
+func (fs *FileStorage) LoadPendingBatch(filename string) (*PendingBatch, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending batch: %w", err)
+	}
+	if data, err = fs.open(data); err != nil {
+		return nil, fmt.Errorf("failed to decrypt pending batch %s: %w", filename, err)
+	}
+
+	var batch PendingBatch
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("failed to parse pending batch %s: %w", filename, err)
+	}
+	return &batch, nil
+}
+
+// RemovePendingBatch deletes a pending batch once it has been loaded
+func (fs *FileStorage) RemovePendingBatch(filename string) error {
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove pending batch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+)
+
+// SaveQuarantine writes a source payload that could not be parsed under quarantine/,
+// compressed and encrypted like archive files, next to a plain JSON file of its
+// metadata naming the payload file. It returns the path of the payload file.
+func (fs *FileStorage) SaveQuarantine(ctx context.Context, body []byte, metadata map[string]string) (string, error) {
+	logger := fs.logger.ForContext(ctx)
+	now := time.Now().UTC()
+	base := fmt.Sprintf("quarantine_%s_%09d", now.Format("20060102_150405"), now.Nanosecond())
+	dir := filepath.Join(fs.basePath, "quarantine")
+	filename := filepath.Join(dir, fs.encryptedName(base+".body"+fs.codec.Extension()))
+
+	content, err := codec.Compress(fs.codec, body)
+	if err != nil {
+		return "", err
+	}
+	if content, err = fs.seal(content); err != nil {
+		return "", fmt.Errorf("failed to encrypt quarantined payload: %w", err)
+	}
+	sidecar := make(map[string]string, len(metadata)+1)
+	for key, value := range metadata {
+		sidecar[key] = value
+	}
+	sidecar["body"] = filepath.Base(filename)
+	encoded, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode quarantine metadata: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := writeFileAtomic(filename, content); err != nil {
+		return "", fmt.Errorf("failed to write quarantined payload: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, base+".json"), encoded); err != nil {
+		return "", fmt.Errorf("failed to write quarantine metadata: %w", err)
+	}
+	logger.Info(fmt.Sprintf("Quarantined payload saved successfully: %s", filename))
+	return filename, nil
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+)
+
+func TestSaveQuarantine(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	gzip, _ := codec.Get(codec.Gzip)
+	dir := t.TempDir()
+	fs := NewFileStorage(dir, gzip, logger)
+
+	body := []byte(`[{"id": 1}, {"id": oops`)
+	filename, err := fs.SaveQuarantine(context.Background(), body, map[string]string{"url": "http://api/posts", "status": "200"})
+	if err != nil {
+		t.Fatalf("Failed to quarantine payload: %v", err)
+	}
+	if filepath.Dir(filename) != filepath.Join(dir, "quarantine") || !strings.HasSuffix(filename, ".body.gz") {
+		t.Errorf("Unexpected quarantine file: %s", filename)
+	}
+
+	stored, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read quarantined payload: %v", err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatalf("Failed to open quarantined payload: %v", err)
+	}
+	var content bytes.Buffer
+	content.ReadFrom(reader)
+	if !bytes.Equal(content.Bytes(), body) {
+		t.Errorf("Expected the payload as received, got %q", content.String())
+	}
+
+	sidecar, err := os.ReadFile(strings.TrimSuffix(filename, ".body.gz") + ".json")
+	if err != nil {
+		t.Fatalf("Failed to read quarantine metadata: %v", err)
+	}
+	var metadata map[string]string
+	if err := json.Unmarshal(sidecar, &metadata); err != nil {
+		t.Fatalf("Failed to decode quarantine metadata: %v", err)
+	}
+	if metadata["url"] != "http://api/posts" || metadata["status"] != "200" || metadata["body"] != filepath.Base(filename) {
+		t.Errorf("Unexpected quarantine metadata: %v", metadata)
+	}
+}
@@ -1,93 +1,138 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
-	"time"
+	"strings"
 
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/encryption"
+	"github.com/mohammedhassan/etl-pipeline/internal/envelope"
 	"github.com/mohammedhassan/etl-pipeline/internal/logging"
 )
 
 // FileStorage handles file-based storage operations
 type FileStorage struct {
 	basePath string
-	logger   *logging.Logger
+	// batchFormat holds the codec compressing batch and archive files (pending
+	// batches stay uncompressed) and the CSV options of batch files
+	batchFormat
+	// keyring encrypts data files when set
+	keyring *encryption.Keyring
+	logger  *logging.Logger
 }
 
-// NewFileStorage creates a new file storage instance
-func NewFileStorage(basePath string, logger *logging.Logger) *FileStorage {
+// NewFileStorage creates a new file storage instance writing files compressed with compression
+func NewFileStorage(basePath string, compression codec.Codec, logger *logging.Logger) *FileStorage {
 	return &FileStorage{
-		basePath: basePath,
-		logger:   logger,
+		basePath:    basePath,
+		batchFormat: batchFormat{codec: compression},
+		logger:      logger,
 	}
 }
 
-// SaveRawData saves raw data to the file system
-func (fs *FileStorage) SaveRawData(data []map[string]interface{}) error {
-	rawPath := filepath.Join(fs.basePath, "raw")
-	if err := os.MkdirAll(rawPath, 0755); err != nil {
-		fs.logger.Error(fmt.Sprintf("Failed to create raw data directory: %v", err))
-		return fmt.Errorf("failed to create directory: %w", err)
+// SaveRawData saves raw data to the file system as a batch envelope
+func (fs *FileStorage) SaveRawData(ctx context.Context, data []map[string]interface{}) (Snapshot, error) {
+	logger := fs.logger.ForContext(ctx)
+	name, content, err := fs.encodeRaw(data)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to encode raw data: %v", err))
+		return Snapshot{}, err
 	}
+	return fs.saveBatch(ctx, "raw", name, len(data), content)
+}
 
-	timestamp := time.Now().UTC().Format("20060102_150405")
-	filename := filepath.Join(rawPath, fmt.Sprintf("raw_data_%s.json", timestamp))
-
-	jsonData, err := json.MarshalIndent(data, "", "  ")
+// SaveRawPayloads saves raw records to the file system, keeping the payloads of JSON and NDJSON batches as received
+func (fs *FileStorage) SaveRawPayloads(ctx context.Context, data []map[string]interface{}, payloads []json.RawMessage) (Snapshot, error) {
+	logger := fs.logger.ForContext(ctx)
+	name, content, err := fs.encodeRawPayloads(data, payloads)
 	if err != nil {
-		fs.logger.Error(fmt.Sprintf("Failed to marshal raw data: %v", err))
-		return fmt.Errorf("failed to marshal data: %w", err)
+		logger.Error(fmt.Sprintf("Failed to encode raw data: %v", err))
+		return Snapshot{}, err
 	}
+	return fs.saveBatch(ctx, "raw", name, len(payloads), content)
+}
 
-	// Append to file
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+// SaveProcessedData saves processed records to the file system as a batch envelope
+func (fs *FileStorage) SaveProcessedData(ctx context.Context, records []database.ProcessedRecord) (Snapshot, error) {
+	logger := fs.logger.ForContext(ctx)
+	name, content, err := fs.encodeProcessed(records)
 	if err != nil {
-		fs.logger.Error(fmt.Sprintf("Failed to open raw data file: %v", err))
-		return fmt.Errorf("failed to open file: %w", err)
+		logger.Error(fmt.Sprintf("Failed to encode processed data: %v", err))
+		return Snapshot{}, err
 	}
-	defer file.Close()
+	return fs.saveBatch(ctx, "processed", name, len(records), content)
+}
 
-	if _, err := file.Write(jsonData); err != nil {
-		fs.logger.Error(fmt.Sprintf("Failed to write raw data: %v", err))
-		return fmt.Errorf("failed to write data: %w", err)
+// saveBatch atomically writes an encoded batch to its own file under dir, creating
+// its partition directory, next to a sha256sum compatible .sha256 sidecar. Nothing
+// is written once ctx is done.
+func (fs *FileStorage) saveBatch(ctx context.Context, dir, name string, records int, content []byte) (Snapshot, error) {
+	logger := fs.logger.ForContext(ctx)
+	if err := ctx.Err(); err != nil {
+		return Snapshot{}, err
+	}
+	filename := filepath.Join(fs.basePath, dir, filepath.FromSlash(fs.encryptedName(name)))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		logger.Error(fmt.Sprintf("Failed to create %s data directory: %v", dir, err))
+		return Snapshot{}, fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	fs.logger.Info(fmt.Sprintf("Raw data saved successfully: %s", filename))
-	return nil
-}
-
-// SaveProcessedData saves processed data to the file system
-func (fs *FileStorage) SaveProcessedData(data interface{}) error {
-	processedPath := filepath.Join(fs.basePath, "processed")
-	if err := os.MkdirAll(processedPath, 0755); err != nil {
-		fs.logger.Error(fmt.Sprintf("Failed to create processed data directory: %v", err))
-		return fmt.Errorf("failed to create directory: %w", err)
+	content, err := fs.seal(content)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to encrypt %s data: %v", dir, err))
+		return Snapshot{}, fmt.Errorf("failed to encrypt data: %w", err)
+	}
+	snapshot := newSnapshot(filename, dir, records, content)
+	if err := writeFileAtomic(filename, content); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write %s data: %v", dir, err))
+		return Snapshot{}, fmt.Errorf("failed to write data: %w", err)
+	}
+	sidecar := fmt.Sprintf("%s  %s\n", snapshot.SHA256, filepath.Base(filename))
+	if err := writeFileAtomic(filename+".sha256", []byte(sidecar)); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write %s data checksum: %v", dir, err))
+		return Snapshot{}, fmt.Errorf("failed to write checksum: %w", err)
 	}
 
-	timestamp := time.Now().UTC().Format("20060102_150405")
-	filename := filepath.Join(processedPath, fmt.Sprintf("processed_data_%s.json", timestamp))
+	logger.Info(fmt.Sprintf("%s data saved successfully: %s", strings.ToUpper(dir[:1])+dir[1:], filename))
+	return snapshot, nil
+}
 
-	jsonData, err := json.MarshalIndent(data, "", "  ")
+// LoadBatch reads a batch envelope written by this or another instance,
+// decrypting it and decompressing it according to its file extension
+func (fs *FileStorage) LoadBatch(filename string) (*envelope.Envelope, error) {
+	data, err := os.ReadFile(filename)
 	if err != nil {
-		fs.logger.Error(fmt.Sprintf("Failed to marshal processed data: %v", err))
-		return fmt.Errorf("failed to marshal data: %w", err)
+		return nil, fmt.Errorf("failed to open batch: %w", err)
+	}
+	if data, err = fs.open(data); err != nil {
+		return nil, fmt.Errorf("failed to decrypt batch: %w", err)
 	}
 
-	// Append to file
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	compression := codec.ForFile(TrimEncryptedExtension(filename))
+	reader, err := compression.NewReader(bytes.NewReader(data))
 	if err != nil {
-		fs.logger.Error(fmt.Sprintf("Failed to open processed data file: %v", err))
-		return fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("failed to open %s batch: %w", compression.Name(), err)
 	}
-	defer file.Close()
+	defer reader.Close()
+	return envelope.Decode(reader)
+}
 
-	if _, err := file.Write(jsonData); err != nil {
-		fs.logger.Error(fmt.Sprintf("Failed to write processed data: %v", err))
-		return fmt.Errorf("failed to write data: %w", err)
+// Ping checks that files can be written to the data directory, creating it if it
+// does not exist
+func (fs *FileStorage) Ping() error {
+	if err := os.MkdirAll(fs.basePath, 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
 	}
-
-	fs.logger.Info(fmt.Sprintf("Processed data saved successfully: %s", filename))
-	return nil
+	probe, err := os.CreateTemp(fs.basePath, ".ping-*")
+	if err != nil {
+		return fmt.Errorf("data directory not writable: %w", err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
 }
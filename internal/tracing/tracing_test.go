@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// record installs a tracer provider keeping spans in memory for the test
+func record(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return exporter
+}
+
+func TestSpans(t *testing.T) {
+	exporter := record(t)
+
+	ctx, root := Start(context.Background(), "etl.run")
+	_, child := Start(ctx, "etl.extract")
+	End(child, errors.New("source unavailable"))
+	End(root, nil)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	extract, run := spans[0], spans[1]
+	if extract.Name != "etl.extract" || run.Name != "etl.run" {
+		t.Fatalf("unexpected spans %q and %q", extract.Name, run.Name)
+	}
+	if extract.Parent.SpanID() != run.SpanContext.SpanID() || extract.SpanContext.TraceID() != run.SpanContext.TraceID() {
+		t.Error("expected the extract span to be a child of the run span")
+	}
+	if extract.Status.Code != codes.Error || extract.Status.Description != "source unavailable" {
+		t.Errorf("expected the extract span to fail, got %+v", extract.Status)
+	}
+	if run.Status.Code != codes.Unset {
+		t.Errorf("expected the run span to succeed, got %+v", run.Status)
+	}
+}
+
+func TestInject(t *testing.T) {
+	record(t)
+
+	header := http.Header{}
+	Inject(context.Background(), header)
+	if header.Get("traceparent") != "" {
+		t.Errorf("expected no traceparent without a span, got %q", header.Get("traceparent"))
+	}
+
+	ctx, span := Start(context.Background(), "api.fetch")
+	defer span.End()
+	Inject(ctx, header)
+	if header.Get("traceparent") == "" {
+		t.Error("expected a traceparent header")
+	}
+}
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("unexpected shutdown error: %v", err)
+	}
+
+	if _, err := Setup(context.Background(), Config{Endpoint: "http://localhost:4318", SampleRatio: 1.5}); err == nil {
+		t.Error("expected an error for a sample ratio above 1")
+	}
+}
@@ -0,0 +1,67 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeleteRule recognises the raw records a source marks as deleted
+type DeleteRule struct {
+	// Field is the raw key marking deleted records
+	Field string
+	// Value is the value of Field marking a deleted record, compared as text. When
+	// empty any value but null, false, 0 and "" marks one.
+	Value string
+}
+
+// ParseDeleteRule parses a rule written as field, e.g. deleted_at, or as
+// field=value, e.g. status=deleted
+func ParseDeleteRule(text string) (DeleteRule, error) {
+	field, value, _ := strings.Cut(text, "=")
+	rule := DeleteRule{Field: strings.TrimSpace(field), Value: strings.TrimSpace(value)}
+	if rule.Field == "" {
+		return DeleteRule{}, fmt.Errorf("invalid delete rule %q, expected field or field=value", text)
+	}
+	return rule, nil
+}
+
+// Matches reports whether the rule marks record as deleted
+func (r DeleteRule) Matches(record map[string]interface{}) bool {
+	value, ok := record[r.Field]
+	if !ok || value == nil {
+		return false
+	}
+	if r.Value != "" {
+		return fmt.Sprint(value) == r.Value
+	}
+	switch value := value.(type) {
+	case bool:
+		return value
+	case float64:
+		return value != 0
+	case string:
+		return value != ""
+	}
+	return true
+}
+
+// SetDeleteRule sets the rule recognising raw records the source marks as deleted.
+// Transform leaves such records out and lists their source ids in Deleted instead.
+func (t *Transformer) SetDeleteRule(rule DeleteRule) {
+	t.deleteRule = rule
+}
+
+// deleted reports whether the delete rule of t marks record as deleted
+func (t *Transformer) deleted(record map[string]interface{}) bool {
+	return t.deleteRule.Field != "" && t.deleteRule.Matches(record)
+}
+
+// deletedID returns the source id of a record marked as deleted, which its
+// processed records are found by
+func deletedID(record map[string]interface{}) (string, error) {
+	id := sourceID(record)
+	if id == "" {
+		return "", &RecordError{Field: "id", Reason: ReasonMissingField}
+	}
+	return id, nil
+}
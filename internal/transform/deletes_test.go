@@ -0,0 +1,60 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestDeleteRule(t *testing.T) {
+	if _, err := ParseDeleteRule("=deleted"); err == nil {
+		t.Error("Expected a rule without a field refused")
+	}
+	flag, _ := ParseDeleteRule("deleted_at")
+	status, _ := ParseDeleteRule("status = deleted")
+	tests := []struct {
+		rule   DeleteRule
+		record map[string]interface{}
+		want   bool
+	}{
+		{flag, map[string]interface{}{"deleted_at": "2024-01-15T10:30:00Z"}, true},
+		{flag, map[string]interface{}{"deleted_at": nil}, false},
+		{flag, map[string]interface{}{"deleted_at": false}, false},
+		{flag, map[string]interface{}{}, false},
+		{status, map[string]interface{}{"status": "deleted"}, true},
+		{status, map[string]interface{}{"status": "published"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.Matches(tt.record); got != tt.want {
+			t.Errorf("%+v matching %v: expected %t, got %t", tt.rule, tt.record, tt.want, got)
+		}
+	}
+}
+
+func TestTransformDeleted(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+	transformer := NewTransformer(logger, metrics.NewMetrics())
+	transformer.SetDeleteRule(DeleteRule{Field: "status", Value: "deleted"})
+
+	data, err := transformer.Transform([]map[string]interface{}{
+		{"id": float64(1), "userId": float64(1), "title": "Kept", "body": "Body"},
+		{"id": float64(2), "status": "deleted"},
+		{"status": "deleted"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(data.Records) != 1 || data.Records[0].Lineage.SourceID != "1" {
+		t.Errorf("Expected the live record transformed with its source id, got %+v", data.Records)
+	}
+	if len(data.Deleted) != 1 || data.Deleted[0] != "2" {
+		t.Errorf("Expected the deleted record listed by id, got %v", data.Deleted)
+	}
+
+	preview := transformer.Preview([]map[string]interface{}{{"id": float64(2), "status": "deleted"}, {"status": "deleted"}})
+	if preview.Deleted != 1 || preview.Rejected != 1 || !preview.Records[0].Deleted {
+		t.Errorf("Expected one deletion and one deleted record without id rejected, got %+v", preview)
+	}
+}
@@ -0,0 +1,58 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reasons a record fails transformation, the reason label of
+// etl_transformation_errors_total
+const (
+	// ReasonMissingField is a required field absent from the record
+	ReasonMissingField = "missing_field"
+	// ReasonTypeMismatch is a required field of the wrong type, e.g. a string id
+	ReasonTypeMismatch = "type_mismatch"
+	// ReasonEmptyValue is a required string field that is empty once trimmed
+	ReasonEmptyValue = "empty_value"
+	// ReasonSchemaViolation is any other record not matching Fields
+	ReasonSchemaViolation = "schema_violation"
+)
+
+// RecordError is why a record failed transformation
+type RecordError struct {
+	// Field is the source field at fault
+	Field  string
+	Reason string
+	// Value is the offending source value
+	Value interface{}
+}
+
+func (e *RecordError) Error() string {
+	switch e.Reason {
+	case ReasonMissingField:
+		return fmt.Sprintf("missing %s", e.Field)
+	case ReasonTypeMismatch:
+		return fmt.Sprintf("invalid %s: unexpected %T value %v", e.Field, e.Value, e.Value)
+	case ReasonEmptyValue:
+		return fmt.Sprintf("%s cannot be empty", e.Field)
+	}
+	return fmt.Sprintf("invalid %s", e.Field)
+}
+
+// ErrorReason returns the reason a record failed transformation with err
+func ErrorReason(err error) string {
+	var recordErr *RecordError
+	if errors.As(err, &recordErr) {
+		return recordErr.Reason
+	}
+	return ReasonSchemaViolation
+}
+
+// requiredError returns the error of a required field whose source value is
+// missing or of the wrong type
+func requiredError(field Field, source interface{}) *RecordError {
+	if source == nil {
+		return &RecordError{Field: field.Source, Reason: ReasonMissingField}
+	}
+	return &RecordError{Field: field.Source, Reason: ReasonTypeMismatch, Value: source}
+}
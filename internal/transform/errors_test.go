@@ -0,0 +1,42 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestErrorReason(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+	transformer := NewTransformer(logger, metrics.NewMetrics())
+
+	tests := []struct {
+		name   string
+		input  map[string]interface{}
+		reason string
+	}{
+		{"missing user id", map[string]interface{}{"title": "Post"}, ReasonMissingField},
+		{"string user id", map[string]interface{}{"userId": "1", "title": "Post"}, ReasonTypeMismatch},
+		{"missing title", map[string]interface{}{"userId": float64(1)}, ReasonMissingField},
+		{"numeric title", map[string]interface{}{"userId": float64(1), "title": float64(7)}, ReasonTypeMismatch},
+		{"blank title", map[string]interface{}{"userId": float64(1), "title": "   "}, ReasonEmptyValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := transformer.transformRecord(tt.input)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if reason := ErrorReason(err); reason != tt.reason {
+				t.Errorf("Expected reason %s, got %s (%v)", tt.reason, reason, err)
+			}
+		})
+	}
+
+	if reason := ErrorReason(errors.New("unexpected")); reason != ReasonSchemaViolation {
+		t.Errorf("Expected unclassified errors to be schema violations, got %s", reason)
+	}
+}
@@ -0,0 +1,190 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Expectation types of the quality checks of Transform, as Great Expectations
+// names them
+const (
+	ExpectNotNull   = "expect_column_values_to_not_be_null"
+	ExpectType      = "expect_column_values_to_be_of_type"
+	ExpectNotEmpty  = "expect_column_value_lengths_to_be_between"
+	ExpectParseable = "expect_column_values_to_be_dateutil_parseable"
+)
+
+// QualityCheck identifies a quality check of Transform by the source field it
+// checks and the reason records fail it
+type QualityCheck struct {
+	Field  string
+	Reason string
+}
+
+// QualityCounts counts the records Transform checked and the records failing each
+// quality check. A record counts against the first check it fails only.
+type QualityCounts struct {
+	Checked  int
+	Failures map[QualityCheck]int
+}
+
+// Add adds the counts of another batch
+func (c *QualityCounts) Add(other QualityCounts) {
+	c.Checked += other.Checked
+	for check, failures := range other.Failures {
+		c.fail(check, failures)
+	}
+}
+
+// fail counts records failing a check
+func (c *QualityCounts) fail(check QualityCheck, records int) {
+	if c.Failures == nil {
+		c.Failures = make(map[QualityCheck]int)
+	}
+	c.Failures[check] += records
+}
+
+// failed counts a record failing transformation with err against its check
+func (c *QualityCounts) failed(err error) {
+	var recordErr *RecordError
+	if errors.As(err, &recordErr) {
+		c.fail(QualityCheck{Field: recordErr.Field, Reason: recordErr.Reason}, 1)
+	}
+}
+
+// ExpectationConfig is an expectation of a suite in the format of Great Expectations
+type ExpectationConfig struct {
+	ExpectationType string                 `json:"expectation_type"`
+	Kwargs          map[string]interface{} `json:"kwargs"`
+	Meta            map[string]interface{} `json:"meta"`
+}
+
+// ExpectationResult is the outcome of one expectation over the records of a run
+type ExpectationResult struct {
+	Success           bool              `json:"success"`
+	ExpectationConfig ExpectationConfig `json:"expectation_config"`
+	Result            struct {
+		ElementCount      int     `json:"element_count"`
+		UnexpectedCount   int     `json:"unexpected_count"`
+		UnexpectedPercent float64 `json:"unexpected_percent"`
+	} `json:"result"`
+	ExceptionInfo struct {
+		RaisedException bool `json:"raised_exception"`
+	} `json:"exception_info"`
+}
+
+// ValidationStatistics sums up the results of a validation
+type ValidationStatistics struct {
+	EvaluatedExpectations    int     `json:"evaluated_expectations"`
+	SuccessfulExpectations   int     `json:"successful_expectations"`
+	UnsuccessfulExpectations int     `json:"unsuccessful_expectations"`
+	SuccessPercent           float64 `json:"success_percent"`
+}
+
+// ValidationResult is the outcome of the expectation suite of the transformer over
+// the records of a run, in the format of a Great Expectations suite validation result
+type ValidationResult struct {
+	Success    bool                 `json:"success"`
+	Statistics ValidationStatistics `json:"statistics"`
+	Results    []ExpectationResult  `json:"results"`
+	Meta       ValidationMeta       `json:"meta"`
+	// EvaluationParameters is always empty, as the suite has no parameters
+	EvaluationParameters map[string]interface{} `json:"evaluation_parameters"`
+}
+
+// ValidationMeta identifies the suite and the run a validation is of
+type ValidationMeta struct {
+	ExpectationSuiteName string `json:"expectation_suite_name"`
+	RunID                struct {
+		RunName string    `json:"run_name"`
+		RunTime time.Time `json:"run_time"`
+	} `json:"run_id"`
+	ValidationTime time.Time `json:"validation_time"`
+	// SchemaVersion and TransformVersion identify the checks the records passed
+	SchemaVersion    string `json:"schema_version"`
+	TransformVersion string `json:"transform_version"`
+}
+
+// expectation is an expectation of the suite of a transformer and the check it stands for
+type expectation struct {
+	check  QualityCheck
+	config ExpectationConfig
+}
+
+// expectations returns the suite of expectations the quality checks of t stand
+// for, in the order records are checked
+func (t *Transformer) expectations() []expectation {
+	var suite []expectation
+	add := func(field, reason, expectationType string, kwargs map[string]interface{}, description string) {
+		kwargs["column"] = field
+		suite = append(suite, expectation{
+			check: QualityCheck{Field: field, Reason: reason},
+			config: ExpectationConfig{
+				ExpectationType: expectationType,
+				Kwargs:          kwargs,
+				Meta:            map[string]interface{}{"reason": reason, "description": description},
+			},
+		})
+	}
+	if t.deleteRule.Field != "" {
+		add("id", ReasonMissingField, ExpectNotNull, map[string]interface{}{}, "records marked as deleted must have an id")
+	}
+	for _, field := range t.fields {
+		if !field.Required {
+			continue
+		}
+		add(field.Source, ReasonMissingField, ExpectNotNull, map[string]interface{}{}, fmt.Sprintf("%s must be present", field.Source))
+		goType := "float"
+		if field.Type == FieldTypeString {
+			goType = "str"
+		}
+		add(field.Source, ReasonTypeMismatch, ExpectType, map[string]interface{}{"type_": goType}, fmt.Sprintf("%s must be of type %s", field.Source, field.Type))
+		if field.Type == FieldTypeString {
+			add(field.Source, ReasonEmptyValue, ExpectNotEmpty, map[string]interface{}{"min_value": 1}, fmt.Sprintf("%s must not be empty once trimmed", field.Source))
+		}
+	}
+	if t.timestamp.Field != "" {
+		add(t.timestamp.Field, ReasonTypeMismatch, ExpectParseable, map[string]interface{}{"formats": t.timestamp.Formats}, fmt.Sprintf("%s must match a timestamp format when present", t.timestamp.Field))
+	}
+	return suite
+}
+
+// Validate returns the outcome of the expectation suite of t over the records of
+// a run counted by counts. An expectation succeeds when no record failed it.
+func (t *Transformer) Validate(suiteName, runID string, runTime time.Time, counts QualityCounts) ValidationResult {
+	result := ValidationResult{
+		Success:              true,
+		Results:              []ExpectationResult{},
+		EvaluationParameters: map[string]interface{}{},
+	}
+	for _, expectation := range t.expectations() {
+		var outcome ExpectationResult
+		outcome.ExpectationConfig = expectation.config
+		outcome.Result.ElementCount = counts.Checked
+		outcome.Result.UnexpectedCount = counts.Failures[expectation.check]
+		if counts.Checked > 0 {
+			outcome.Result.UnexpectedPercent = 100 * float64(outcome.Result.UnexpectedCount) / float64(counts.Checked)
+		}
+		outcome.Success = outcome.Result.UnexpectedCount == 0
+		result.Results = append(result.Results, outcome)
+
+		result.Statistics.EvaluatedExpectations++
+		if outcome.Success {
+			result.Statistics.SuccessfulExpectations++
+		} else {
+			result.Statistics.UnsuccessfulExpectations++
+			result.Success = false
+		}
+	}
+	if result.Statistics.EvaluatedExpectations > 0 {
+		result.Statistics.SuccessPercent = 100 * float64(result.Statistics.SuccessfulExpectations) / float64(result.Statistics.EvaluatedExpectations)
+	}
+	result.Meta.ExpectationSuiteName = suiteName
+	result.Meta.RunID.RunName = runID
+	result.Meta.RunID.RunTime = runTime
+	result.Meta.ValidationTime = time.Now().UTC()
+	result.Meta.SchemaVersion = SchemaVersion()
+	result.Meta.TransformVersion = t.version
+	return result
+}
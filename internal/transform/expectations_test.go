@@ -0,0 +1,56 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestValidate(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+	transformer := NewTransformer(logger, metrics.NewMetrics())
+
+	data, err := transformer.Transform([]map[string]interface{}{
+		{"userId": float64(1), "title": "Title"},
+		{"title": "No author"},
+		{"userId": "1", "title": "Text author"},
+		{"userId": float64(2), "title": "  "},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var counts QualityCounts
+	counts.Add(data.Quality)
+	counts.Add(QualityCounts{Checked: 1})
+
+	result := transformer.Validate("etl-pipeline.default", "run", time.Now(), counts)
+	if result.Success || result.Meta.RunID.RunName != "run" || result.Meta.TransformVersion != transformer.Version() {
+		t.Errorf("Unexpected validation: %+v", result)
+	}
+	// userId and title are required: not null and of type each, title also not empty
+	if got := result.Statistics; got.EvaluatedExpectations != 5 || got.UnsuccessfulExpectations != 3 || got.SuccessPercent != 40 {
+		t.Errorf("Unexpected statistics: %+v", got)
+	}
+	failed := map[string]int{}
+	for _, outcome := range result.Results {
+		if outcome.Result.ElementCount != 5 {
+			t.Errorf("Expected 5 records checked, got %d", outcome.Result.ElementCount)
+		}
+		if !outcome.Success {
+			failed[outcome.ExpectationConfig.ExpectationType+" "+outcome.ExpectationConfig.Kwargs["column"].(string)] = outcome.Result.UnexpectedCount
+		}
+	}
+	want := map[string]int{
+		ExpectNotNull + " userId": 1,
+		ExpectType + " userId":    1,
+		ExpectNotEmpty + " title": 1,
+	}
+	for expectation, count := range want {
+		if failed[expectation] != count {
+			t.Errorf("Expected %d records failing %s, got %v", count, expectation, failed)
+		}
+	}
+}
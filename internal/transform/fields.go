@@ -0,0 +1,77 @@
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+// Field types used in the processed schema
+const (
+	FieldTypeInteger = "integer"
+	FieldTypeString  = "string"
+)
+
+// Field describes one column of the processed schema and the raw key it is read from
+type Field struct {
+	Name        string `json:"name"`
+	Source      string `json:"source"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required"`
+	Trim        bool   `json:"trim"`
+	Description string `json:"description"`
+}
+
+// Fields is the processed schema produced by Transform, in column order
+var Fields = []Field{
+	{Name: "user_id", Source: "userId", Type: FieldTypeInteger, Required: true, Description: "Author of the post"},
+	{Name: "title", Source: "title", Type: FieldTypeString, Required: true, Trim: true, Description: "Post title"},
+	{Name: "body", Source: "body", Type: FieldTypeString, Trim: true, Description: "Post body"},
+}
+
+// SchemaVersion identifies the shape of processed records. It changes whenever a
+// field is added, removed, renamed, retyped or made optional, but not with
+// descriptions or normalization.
+func SchemaVersion() string {
+	hash := sha256.New()
+	for _, field := range Fields {
+		fmt.Fprintf(hash, "%s:%s:%t\n", field.Name, field.Type, field.Required)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// Row returns the values of a processed record keyed by field name
+func Row(record database.ProcessedRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"user_id": record.UserID,
+		"title":   record.Title,
+		"body":    record.Body,
+	}
+}
+
+// Rule describes a data quality check applied to a field during transformation
+type Rule struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// Rules returns the quality rules enforced by Transform, derived from Fields
+func Rules() []Rule {
+	var rules []Rule
+	for _, field := range Fields {
+		switch {
+		case field.Type == FieldTypeInteger && field.Required:
+			rules = append(rules, Rule{Field: field.Name, Description: fmt.Sprintf("%s must be present and numeric, otherwise the record is rejected", field.Source)})
+		case field.Type == FieldTypeString && field.Required:
+			rules = append(rules, Rule{Field: field.Name, Description: fmt.Sprintf("%s must be a non-empty string, otherwise the record is rejected", field.Source)})
+		case field.Type == FieldTypeString:
+			rules = append(rules, Rule{Field: field.Name, Description: fmt.Sprintf("%s defaults to an empty string when missing or not a string", field.Source)})
+		}
+		if field.Trim {
+			rules = append(rules, Rule{Field: field.Name, Description: "leading and trailing whitespace is removed"})
+		}
+	}
+	return rules
+}
@@ -0,0 +1,84 @@
+package transform
+
+import (
+	"errors"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+// Preview is the outcome of transforming a sample of raw records, record by record
+type Preview struct {
+	// Version is the transform version the sample was transformed with
+	Version     string          `json:"transform_version"`
+	Fields      []Field         `json:"fields"`
+	Transformed int             `json:"transformed"`
+	Rejected    int             `json:"rejected"`
+	Deleted     int             `json:"deleted"`
+	Records     []PreviewRecord `json:"records"`
+}
+
+// PreviewRecord is the outcome of transforming one raw record of a sample: the
+// processed record with the changes made to its values, or why it was rejected
+type PreviewRecord struct {
+	// Index is the position of the raw record in the sample
+	Index   int                       `json:"index"`
+	Record  *database.ProcessedRecord `json:"record,omitempty"`
+	Changes []database.FieldChange    `json:"changes,omitempty"`
+	// Deleted is set when the delete rule marks the raw record as deleted
+	Deleted bool          `json:"deleted,omitempty"`
+	Error   *PreviewError `json:"error,omitempty"`
+}
+
+// PreviewError is why a raw record of a sample was rejected
+type PreviewError struct {
+	// Field is the source field at fault, if known
+	Field   string `json:"field,omitempty"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// Preview transforms a sample of raw records as Transform would, reporting every
+// change, rejection and deletion instead of sampling audits, logging and counting
+// them
+func (t *Transformer) Preview(rawData []map[string]interface{}) *Preview {
+	preview := &Preview{Version: t.version, Fields: t.Fields(), Records: make([]PreviewRecord, 0, len(rawData))}
+	for i, record := range rawData {
+		result := PreviewRecord{Index: i}
+		var transformed database.ProcessedRecord
+		var changes []database.FieldChange
+		var err error
+		if t.deleted(record) {
+			result.Deleted = true
+			_, err = deletedID(record)
+		} else {
+			transformed, changes, err = t.applyFields(record, true)
+		}
+		switch {
+		case err != nil:
+			result.Error = &PreviewError{Reason: ErrorReason(err), Message: err.Error()}
+			var recordErr *RecordError
+			if errors.As(err, &recordErr) {
+				result.Error.Field = recordErr.Field
+			}
+			preview.Rejected++
+		case result.Deleted:
+			preview.Deleted++
+		default:
+			result.Record = &transformed
+			result.Changes = changes
+			preview.Transformed++
+		}
+		preview.Records = append(preview.Records, result)
+	}
+	return preview
+}
+
+// WithFieldSources returns a copy of the transformer reading the named fields from
+// other raw keys as SetFieldSources does, e.g. to preview a mapping before applying it
+func (t *Transformer) WithFieldSources(sources map[string]string) (*Transformer, error) {
+	clone := *t
+	if err := clone.SetFieldSources(sources); err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
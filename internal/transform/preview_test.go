@@ -0,0 +1,45 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestPreview(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+	transformer := NewTransformer(logger, metrics.NewMetrics())
+
+	sample := []map[string]interface{}{
+		{"userId": float64(1), "headline": " Renamed ", "title": "Old", "body": "Body"},
+		{"userId": float64(2), "body": "No title"},
+	}
+	preview := transformer.Preview(sample)
+	if preview.Transformed != 1 || preview.Rejected != 1 || len(preview.Records) != 2 {
+		t.Fatalf("Unexpected preview: %+v", preview)
+	}
+	if record := preview.Records[0].Record; record == nil || record.Title != "Old" {
+		t.Errorf("Expected the first record transformed, got %+v", preview.Records[0])
+	}
+	if err := preview.Records[1].Error; err == nil || err.Field != "title" || err.Reason != ReasonMissingField {
+		t.Errorf("Expected the second record rejected for its title, got %+v", preview.Records[1])
+	}
+
+	renamed, err := transformer.WithFieldSources(map[string]string{"title": "headline"})
+	if err != nil {
+		t.Fatalf("Failed to override field sources: %v", err)
+	}
+	preview = renamed.Preview(sample)
+	first := preview.Records[0]
+	if first.Record == nil || first.Record.Title != "Renamed" || len(first.Changes) != 1 || first.Changes[0].Stage != StageTrim {
+		t.Errorf("Expected the title read from headline and trimmed, got %+v", first)
+	}
+	if preview.Version == transformer.Version() || transformer.Fields()[1].Source != "title" {
+		t.Error("Expected the override to leave the original transformer unchanged")
+	}
+	if _, err := transformer.WithFieldSources(map[string]string{"subtitle": "x"}); err == nil {
+		t.Error("Expected an error for an unknown field")
+	}
+}
@@ -0,0 +1,141 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column types of normalized timestamps
+const (
+	// TimestampTypeInstant keeps the instant of the timestamp
+	TimestampTypeInstant = "timestamptz"
+	// TimestampTypeDate truncates the timestamp to midnight of its day in the target zone
+	TimestampTypeDate = "date"
+)
+
+// Named timestamp formats; any other format is a Go layout, e.g. 02/01/2006 15:04
+const (
+	// TimestampFormatUnix is seconds since the epoch, as a number or numeric string
+	TimestampFormatUnix = "unix"
+	// TimestampFormatUnixMillis is milliseconds since the epoch
+	TimestampFormatUnixMillis = "unix_ms"
+)
+
+// timestampLayouts are the named formats parsed with a layout
+var timestampLayouts = map[string]string{
+	"rfc3339":  time.RFC3339Nano,
+	"rfc1123":  time.RFC1123,
+	"rfc1123z": time.RFC1123Z,
+	"datetime": time.DateTime,
+	"date":     time.DateOnly,
+}
+
+// DefaultTimestampFormats are tried when a TimestampConfig lists none
+var DefaultTimestampFormats = []string{"rfc3339", TimestampFormatUnix}
+
+// TimestampConfig configures the normalization of a raw timestamp into the
+// source_time of processed records
+type TimestampConfig struct {
+	// Field is the raw key of the timestamp; normalization is off when empty
+	Field string
+	// Formats are tried in order until one parses the value, DefaultTimestampFormats
+	// when empty
+	Formats []string
+	// SourceZone is the zone of timestamps written without an offset, UTC when nil
+	SourceZone *time.Location
+	// TargetZone is the zone normalized timestamps are written in, UTC when nil
+	TargetZone *time.Location
+	// Type is TimestampTypeInstant, the default, or TimestampTypeDate
+	Type string
+}
+
+// SetTimestamp normalizes the raw timestamp of cfg into the source_time of every
+// processed record. Records without the timestamp get none; records whose
+// timestamp matches none of the formats are rejected.
+func (t *Transformer) SetTimestamp(cfg TimestampConfig) error {
+	if len(cfg.Formats) == 0 {
+		cfg.Formats = DefaultTimestampFormats
+	}
+	cfg.Formats = slices.Clone(cfg.Formats)
+	for i, format := range cfg.Formats {
+		if layout, ok := timestampLayouts[strings.ToLower(format)]; ok {
+			cfg.Formats[i] = layout
+		}
+	}
+	if cfg.SourceZone == nil {
+		cfg.SourceZone = time.UTC
+	}
+	if cfg.TargetZone == nil {
+		cfg.TargetZone = time.UTC
+	}
+	switch cfg.Type {
+	case "":
+		cfg.Type = TimestampTypeInstant
+	case TimestampTypeInstant, TimestampTypeDate:
+	default:
+		return fmt.Errorf("unknown timestamp type %q, expected %s or %s", cfg.Type, TimestampTypeInstant, TimestampTypeDate)
+	}
+	t.timestamp = cfg
+	t.version = transformVersion(t.fields, t.timestamp)
+	return nil
+}
+
+// normalizeTimestamp returns the normalized timestamp of a raw record, nil when it
+// has none
+func (t *Transformer) normalizeTimestamp(record map[string]interface{}) (*time.Time, error) {
+	cfg := t.timestamp
+	if cfg.Field == "" || record[cfg.Field] == nil {
+		return nil, nil
+	}
+	source := record[cfg.Field]
+	for _, format := range cfg.Formats {
+		parsed, ok := parseTimestamp(source, format, cfg.SourceZone)
+		if !ok {
+			continue
+		}
+		parsed = parsed.In(cfg.TargetZone)
+		if cfg.Type == TimestampTypeDate {
+			year, month, day := parsed.Date()
+			parsed = time.Date(year, month, day, 0, 0, 0, 0, cfg.TargetZone)
+		}
+		return &parsed, nil
+	}
+	return nil, &RecordError{Field: cfg.Field, Reason: ReasonTypeMismatch, Value: source}
+}
+
+// parseTimestamp parses a raw value with a format, reading times without an
+// offset in zone
+func parseTimestamp(value interface{}, format string, zone *time.Location) (time.Time, bool) {
+	switch format {
+	case TimestampFormatUnix, TimestampFormatUnixMillis:
+		var number float64
+		switch value := value.(type) {
+		case float64:
+			number = value
+		case string:
+			var err error
+			if number, err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+				return time.Time{}, false
+			}
+		default:
+			return time.Time{}, false
+		}
+		if format == TimestampFormatUnix {
+			number *= 1000
+		}
+		if math.IsNaN(number) || math.IsInf(number, 0) {
+			return time.Time{}, false
+		}
+		return time.UnixMilli(int64(number)), true
+	}
+	text, ok := value.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	parsed, err := time.ParseInLocation(format, strings.TrimSpace(text), zone)
+	return parsed, err == nil
+}
@@ -0,0 +1,61 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+)
+
+func TestNormalizeTimestamp(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("No time zone database: %v", err)
+	}
+	transformer := NewTransformer(logger, metrics.NewMetrics())
+	version := transformer.Version()
+	if err := transformer.SetTimestamp(TimestampConfig{Field: "createdAt", Type: "week"}); err == nil {
+		t.Error("Expected an unknown type refused")
+	}
+	if err := transformer.SetTimestamp(TimestampConfig{
+		Field:      "createdAt",
+		Formats:    []string{"rfc3339", "02/01/2006 15:04", "unix_ms"},
+		TargetZone: berlin,
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if transformer.Version() == version {
+		t.Error("Expected timestamp normalization to change the transform version")
+	}
+
+	want := time.Date(2025, 10, 1, 11, 0, 0, 0, time.UTC)
+	for _, value := range []interface{}{"2025-10-01T13:00:00+02:00", "01/10/2025 11:00", float64(want.UnixMilli()), "1759316400000"} {
+		record := map[string]interface{}{"userId": float64(1), "title": "Title", "createdAt": value}
+		transformed, err := transformer.transformRecord(record)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", value, err)
+			continue
+		}
+		if got := transformed.SourceTime; got == nil || !got.Equal(want) || got.Location() != berlin {
+			t.Errorf("%v: expected %v in Europe/Berlin, got %v", value, want, got)
+		}
+	}
+
+	transformed, err := transformer.transformRecord(map[string]interface{}{"userId": float64(1), "title": "Title"})
+	if err != nil || transformed.SourceTime != nil {
+		t.Errorf("Expected a record without timestamp to get none, got %v, %v", transformed.SourceTime, err)
+	}
+	_, err = transformer.transformRecord(map[string]interface{}{"userId": float64(1), "title": "Title", "createdAt": "yesterday"})
+	if ErrorReason(err) != ReasonTypeMismatch {
+		t.Errorf("Expected an unparseable timestamp rejected as a type mismatch, got %v", err)
+	}
+
+	transformer.SetTimestamp(TimestampConfig{Field: "createdAt", TargetZone: berlin, Type: TimestampTypeDate})
+	transformed, _ = transformer.transformRecord(map[string]interface{}{"userId": float64(1), "title": "Title", "createdAt": "2025-10-01T23:30:00Z"})
+	if day := time.Date(2025, 10, 2, 0, 0, 0, 0, berlin); transformed.SourceTime == nil || !transformed.SourceTime.Equal(day) {
+		t.Errorf("Expected the day in the target zone, got %v", transformed.SourceTime)
+	}
+}
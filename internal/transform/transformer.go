@@ -1,7 +1,12 @@
 package transform
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -10,26 +15,123 @@ import (
 	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
 )
 
+// Audit stages recorded when a transformation changes a field
+const (
+	// StageDefault replaces a missing or mistyped value with the field's default
+	StageDefault = "default"
+	// StageCoerce converts a value to the field's type, e.g. truncating 1.5 to 1
+	StageCoerce = "coerce"
+	// StageTrim removes leading and trailing whitespace
+	StageTrim = "trim"
+)
+
 // Transformer handles data transformation operations
 type Transformer struct {
 	logger  *logging.Logger
 	metrics *metrics.Metrics
+	// auditSampleRate is the fraction of records whose field changes are audited
+	auditSampleRate float64
+	// fields is the processed schema with the raw keys its fields are read from
+	fields []Field
+	// version identifies fields, recorded in the lineage of processed records
+	version string
+	// deleteRule recognises raw records marked as deleted, if its Field is set
+	deleteRule DeleteRule
+	// timestamp normalizes a raw timestamp into source_time, if its Field is set
+	timestamp TimestampConfig
 }
 
 // NewTransformer creates a new transformer instance
 func NewTransformer(logger *logging.Logger, metrics *metrics.Metrics) *Transformer {
+	return NewTransformerWithAudit(logger, metrics, 0)
+}
+
+// NewTransformerWithAudit creates a transformer recording which stages changed
+// which fields for a sampled fraction of records, between 0 (none) and 1 (all)
+func NewTransformerWithAudit(logger *logging.Logger, metrics *metrics.Metrics, auditSampleRate float64) *Transformer {
 	return &Transformer{
-		logger:  logger,
-		metrics: metrics,
+		logger:          logger,
+		metrics:         metrics,
+		auditSampleRate: auditSampleRate,
+		fields:          Fields,
+		version:         transformVersion(Fields, TimestampConfig{}),
+	}
+}
+
+// SetFieldSources reads the named fields of the processed schema from other raw
+// keys, e.g. title from headline, instead of their default Source
+func (t *Transformer) SetFieldSources(sources map[string]string) error {
+	fields, err := fieldsWithSources(sources)
+	if err != nil {
+		return err
+	}
+	t.fields = fields
+	t.version = transformVersion(fields, t.timestamp)
+	return nil
+}
+
+// ValidateFieldSources checks that sources names fields of the processed schema and
+// non-empty raw keys, as SetFieldSources requires
+func ValidateFieldSources(sources map[string]string) error {
+	_, err := fieldsWithSources(sources)
+	return err
+}
+
+// fieldsWithSources returns Fields with the named fields read from other raw keys
+func fieldsWithSources(sources map[string]string) ([]Field, error) {
+	fields := slices.Clone(Fields)
+	for name, source := range sources {
+		i := slices.IndexFunc(fields, func(field Field) bool { return field.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		if source == "" {
+			return nil, fmt.Errorf("empty source of field %s", name)
+		}
+		fields[i].Source = source
+	}
+	return fields, nil
+}
+
+// Version identifies how the transformer maps raw records to processed ones. Unlike
+// SchemaVersion it changes with the raw keys fields are read from and with
+// normalization.
+func (t *Transformer) Version() string {
+	return t.version
+}
+
+// Fields returns the processed schema with the raw keys the transformer reads its
+// fields from
+func (t *Transformer) Fields() []Field {
+	return slices.Clone(t.fields)
+}
+
+// transformVersion hashes everything about fields and timestamp normalization that
+// changes the processed records
+func transformVersion(fields []Field, timestamp TimestampConfig) string {
+	hash := sha256.New()
+	for _, field := range fields {
+		fmt.Fprintf(hash, "%s:%s:%s:%t:%t\n", field.Name, field.Source, field.Type, field.Required, field.Trim)
+	}
+	// Versions without timestamp normalization stay as they were
+	if timestamp.Field != "" {
+		fmt.Fprintf(hash, "timestamp:%s:%s:%s:%s:%s\n", timestamp.Field, strings.Join(timestamp.Formats, "|"), timestamp.SourceZone, timestamp.TargetZone, timestamp.Type)
 	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
 }
 
 // TransformedData represents the output of transformation
 type TransformedData struct {
-	Records       []database.ProcessedRecord `json:"records"`
-	ProcessedAt   string                     `json:"processed_at"`
-	TotalRecords  int                        `json:"total_records"`
-	ProcessedByUTC string                    `json:"processed_by_utc"`
+	Records        []database.ProcessedRecord `json:"records"`
+	ProcessedAt    string                     `json:"processed_at"`
+	TotalRecords   int                        `json:"total_records"`
+	ProcessedByUTC string                     `json:"processed_by_utc"`
+	// Audits lists the field changes of sampled records that a transformation modified
+	Audits []database.RecordAudit `json:"-"`
+	// Deleted lists the source ids of raw records the delete rule marks as deleted
+	Deleted []string `json:"-"`
+	// Quality counts the records failing each quality check
+	Quality QualityCounts `json:"-"`
 }
 
 // Transform processes raw data and returns structured data
@@ -37,21 +139,49 @@ func (t *Transformer) Transform(rawData []map[string]interface{}) (*TransformedD
 	t.logger.Info(fmt.Sprintf("Starting transformation of %d records", len(rawData)))
 
 	var processedRecords []database.ProcessedRecord
+	var audits []database.RecordAudit
+	var deleted []string
+	quality := QualityCounts{Checked: len(rawData)}
 	errorCount := 0
 
 	for i, record := range rawData {
-		transformed, err := t.transformRecord(record)
+		if t.deleted(record) {
+			id, err := deletedID(record)
+			if err != nil {
+				t.metrics.TransformationErrorTotal.WithLabelValues(ErrorReason(err)).Inc()
+				quality.failed(err)
+				t.logger.Warn(fmt.Sprintf("Failed to transform deleted record %d: %v", i, err))
+				errorCount++
+				continue
+			}
+			deleted = append(deleted, id)
+			continue
+		}
+		audit := t.auditSampleRate > 0 && rand.Float64() < t.auditSampleRate
+		transformed, changes, err := t.applyFields(record, audit)
 		if err != nil {
-			t.metrics.TransformationErrorTotal.Inc()
+			t.metrics.TransformationErrorTotal.WithLabelValues(ErrorReason(err)).Inc()
+			quality.failed(err)
 			t.logger.Warn(fmt.Sprintf("Failed to transform record %d: %v", i, err))
 			errorCount++
 			continue
 		}
 
+		transformed.Lineage = &database.Lineage{TransformVersion: t.version, Line: i, SourceID: sourceID(record)}
 		processedRecords = append(processedRecords, transformed)
 		t.metrics.RecordsProcessedTotal.Inc()
+
+		for _, change := range changes {
+			t.metrics.TransformAuditsTotal.WithLabelValues(change.Stage).Inc()
+		}
+		if len(changes) > 0 {
+			audits = append(audits, database.RecordAudit{SourceID: sourceID(record), Changes: changes})
+		}
 	}
 
+	if len(deleted) > 0 {
+		t.logger.Info(fmt.Sprintf("%d records marked as deleted by the source", len(deleted)))
+	}
 	if errorCount > 0 {
 		t.logger.Warn(fmt.Sprintf("Transformation completed with %d errors", errorCount))
 	} else {
@@ -63,39 +193,95 @@ func (t *Transformer) Transform(rawData []map[string]interface{}) (*TransformedD
 		ProcessedAt:    time.Now().UTC().Format(time.RFC3339),
 		TotalRecords:   len(processedRecords),
 		ProcessedByUTC: time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		Audits:         audits,
+		Deleted:        deleted,
+		Quality:        quality,
 	}, nil
 }
 
-// transformRecord transforms a single record
+// transformRecord transforms a single record according to the fields of t
 func (t *Transformer) transformRecord(record map[string]interface{}) (database.ProcessedRecord, error) {
-	// Extract fields with type checking
-	userID, ok := record["userId"].(float64)
-	if !ok {
-		return database.ProcessedRecord{}, fmt.Errorf("invalid or missing userId")
-	}
+	transformed, _, err := t.applyFields(record, false)
+	return transformed, err
+}
 
-	title, ok := record["title"].(string)
-	if !ok {
-		title = ""
+// applyFields transforms a record according to the fields of t. When audit is set it also
+// returns the changes each stage made to the source values.
+func (t *Transformer) applyFields(record map[string]interface{}, audit bool) (database.ProcessedRecord, []database.FieldChange, error) {
+	values := make(map[string]interface{}, len(t.fields))
+	var changes []database.FieldChange
+	change := func(field Field, stage string, before, after interface{}) {
+		if audit {
+			changes = append(changes, database.FieldChange{Field: field.Name, Stage: stage, Before: before, After: after})
+		}
 	}
 
-	body, ok := record["body"].(string)
-	if !ok {
-		body = ""
-	}
+	for _, field := range t.fields {
+		source := record[field.Source]
+
+		switch field.Type {
+		case FieldTypeInteger:
+			// Extract fields with type checking
+			number, ok := source.(float64)
+			if !ok {
+				if field.Required {
+					return database.ProcessedRecord{}, nil, requiredError(field, source)
+				}
+				number = 0
+				change(field, StageDefault, source, 0)
+			}
+			if number != float64(int(number)) {
+				change(field, StageCoerce, number, int(number))
+			}
+			values[field.Name] = int(number)
 
-	// Normalize data
-	title = strings.TrimSpace(title)
-	body = strings.TrimSpace(body)
+		case FieldTypeString:
+			text, ok := source.(string)
+			if !ok {
+				if field.Required {
+					return database.ProcessedRecord{}, nil, requiredError(field, source)
+				}
+				text = ""
+				change(field, StageDefault, source, text)
+			}
 
-	// Validate required fields
-	if title == "" {
-		return database.ProcessedRecord{}, fmt.Errorf("title cannot be empty")
+			// Normalize data
+			if field.Trim {
+				if trimmed := strings.TrimSpace(text); trimmed != text {
+					change(field, StageTrim, text, trimmed)
+					text = trimmed
+				}
+			}
+
+			// Validate required fields
+			if field.Required && text == "" {
+				return database.ProcessedRecord{}, nil, &RecordError{Field: field.Source, Reason: ReasonEmptyValue, Value: source}
+			}
+			values[field.Name] = text
+		}
 	}
 
+	sourceTime, err := t.normalizeTimestamp(record)
+	if err != nil {
+		return database.ProcessedRecord{}, nil, err
+	}
 	return database.ProcessedRecord{
-		UserID: int(userID),
-		Title:  title,
-		Body:   body,
-	}, nil
+		UserID:     values["user_id"].(int),
+		Title:      values["title"].(string),
+		Body:       values["body"].(string),
+		SourceTime: sourceTime,
+	}, changes, nil
+}
+
+// sourceID returns the id of a raw record, or "" when it has none
+func sourceID(record map[string]interface{}) string {
+	switch id := record["id"].(type) {
+	case nil:
+		return ""
+	case float64:
+		// JSON numbers decode as float64; avoid exponents for large ids
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	default:
+		return fmt.Sprint(id)
+	}
 }
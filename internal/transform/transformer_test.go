@@ -146,3 +146,100 @@ func TestTransformEmptyData(t *testing.T) {
 		t.Errorf("Expected 0 records, got %d", len(result.Records))
 	}
 }
+
+func TestTransformAudit(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	metricsCollector := metrics.NewMetrics()
+	transformer := NewTransformerWithAudit(logger, metricsCollector, 1)
+
+	rawData := []map[string]interface{}{
+		{"id": float64(1000000), "userId": float64(1), "title": "  Padded title  "},
+		{"id": float64(2), "userId": float64(2), "title": "Clean", "body": "Clean"},
+	}
+	result, err := transformer.Transform(rawData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(result.Audits) != 1 {
+		t.Fatalf("Expected 1 audited record, got %d", len(result.Audits))
+	}
+	audit := result.Audits[0]
+	if audit.SourceID != "1000000" {
+		t.Errorf("Expected source id 1000000, got %q", audit.SourceID)
+	}
+	if len(audit.Changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %+v", audit.Changes)
+	}
+	if c := audit.Changes[0]; c.Field != "title" || c.Stage != StageTrim || c.Before != "  Padded title  " || c.After != "Padded title" {
+		t.Errorf("Unexpected title change: %+v", c)
+	}
+	if c := audit.Changes[1]; c.Field != "body" || c.Stage != StageDefault || c.Before != nil || c.After != "" {
+		t.Errorf("Unexpected body change: %+v", c)
+	}
+}
+
+func TestSetFieldSources(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	transformer := NewTransformer(logger, metrics.NewMetrics())
+	if err := transformer.SetFieldSources(map[string]string{"title": "headline"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	record, err := transformer.transformRecord(map[string]interface{}{
+		"userId":   float64(1),
+		"headline": "Renamed",
+		"title":    "Ignored",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if record.Title != "Renamed" {
+		t.Errorf("Expected the title to be read from headline, got %q", record.Title)
+	}
+	if Fields[1].Source != "title" {
+		t.Error("Expected the default fields to be left unchanged")
+	}
+
+	if err := transformer.SetFieldSources(map[string]string{"author": "by"}); err == nil {
+		t.Error("Expected an error for an unknown field")
+	}
+}
+
+func TestTransformLineage(t *testing.T) {
+	logger, _ := logging.NewLogger("test.log")
+	defer logger.Close()
+
+	transformer := NewTransformer(logger, metrics.NewMetrics())
+	version := transformer.Version()
+	result, err := transformer.Transform([]map[string]interface{}{
+		{"userId": float64(1), "title": "First"},
+		{"userId": float64(2)},
+		{"userId": float64(3), "title": "Third"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(result.Records))
+	}
+	for i, line := range []int{0, 2} {
+		lineage := result.Records[i].Lineage
+		if lineage == nil || lineage.Line != line || lineage.TransformVersion != version {
+			t.Errorf("Expected record %d traced to line %d with version %s, got %+v", i, line, version, lineage)
+		}
+	}
+
+	if err := transformer.SetFieldSources(map[string]string{"title": "headline"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if transformer.Version() == version {
+		t.Error("Expected the version to change with the field sources")
+	}
+	if NewTransformer(logger, metrics.NewMetrics()).Version() != version {
+		t.Error("Expected the same fields to have the same version")
+	}
+}
@@ -0,0 +1,24 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	defer func(version, commit, buildDate string) {
+		Version, Commit, BuildDate = version, commit, buildDate
+	}(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "v1.2.0", "3f50059", "2025-10-01T12:00:00Z"
+
+	want := Info{Version: "v1.2.0", Commit: "3f50059", BuildDate: "2025-10-01T12:00:00Z", GoVersion: runtime.Version()}
+	if info := Get(); info != want {
+		t.Errorf("Get() = %+v, want %+v", info, want)
+	}
+
+	// Details not set at build time are never empty
+	Commit, BuildDate = "", ""
+	if info := Get(); info.Commit == "" || info.BuildDate == "" {
+		t.Errorf("Get() = %+v, want the commit and build date filled in", info)
+	}
+}
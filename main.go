@@ -2,72 +2,215 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/mohammedhassan/etl-pipeline/internal/api"
 	"github.com/mohammedhassan/etl-pipeline/internal/config"
-	"github.com/mohammedhassan/etl-pipeline/internal/database"
 	"github.com/mohammedhassan/etl-pipeline/internal/etl"
+	"github.com/mohammedhassan/etl-pipeline/internal/httpauth"
 	"github.com/mohammedhassan/etl-pipeline/internal/logging"
 	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/retention"
 	"github.com/mohammedhassan/etl-pipeline/internal/server"
 	"github.com/mohammedhassan/etl-pipeline/internal/storage"
-	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+	"github.com/mohammedhassan/etl-pipeline/internal/version"
 )
 
+// defaultPipeline names the pipeline of the environment configuration in the
+// pipeline control API
+const defaultPipeline = "default"
+
+// tenantFieldPattern restricts the tenant JSON key interpolated into retention queries
+var tenantFieldPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+const usage = `Usage: etl-pipeline [command] [flags]
+
+Commands:
+  serve             run the pipelines on their schedules and serve the HTTP API (default)
+  run-once          run one cycle of the pipelines and exit, e.g. from cron or as a job
+  backfill          extract the records of a historical date range and exit
+  replay            transform and load stored raw records again and exit
+  reprocess         re-transform raw records processed with an earlier transform version
+  migrate           apply or revert database schema migrations
+  validate-config   check the configuration and print the effective settings
+  dry-run           extract and transform one batch without writing anything
+  crypt             decrypt data files and count them per encryption key
+
+Run 'etl-pipeline <command> -h' for the flags of a command.
+`
+
+const serveUsage = `Usage: etl-pipeline [serve]
+
+Runs the pipelines on their schedules and serves the HTTP API until interrupted,
+reloading the configuration on SIGHUP.
+`
+
 func main() {
-	// Initialize logger
-	logger, err := logging.NewLogger("logs/etl.log")
-	if err != nil {
-		log.Fatalf("Failed to initialize logger: %v", err)
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
-	defer logger.Close()
+	switch command {
+	case "serve":
+		os.Exit(runServe(args))
+	case "run-once":
+		os.Exit(runOnce(args))
+	case "backfill":
+		os.Exit(runBackfill(args))
+	case "replay":
+		os.Exit(runReplay(args))
+	case "reprocess":
+		os.Exit(runReprocess(args))
+	case "migrate":
+		os.Exit(runMigrate(args))
+	case "validate-config", "validate":
+		os.Exit(runValidate(args))
+	case "dry-run":
+		os.Exit(runDryRun(args))
+	case "crypt":
+		os.Exit(runCrypt(args))
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
 
-	logger.Info("Starting ETL Pipeline Service...")
+// runServe implements the serve command and returns the process exit code
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, serveUsage) }
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
 
-	// Load configuration
-	cfg := config.LoadConfig()
-	logger.Info(fmt.Sprintf("Configuration loaded: API=%s, Interval=%ds", cfg.APIURL, cfg.FetchInterval))
+	// Context for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// Initialize metrics
-	metricsCollector := metrics.NewMetrics()
-	
-	// Initialize database
-	db, err := database.NewPostgresDB(cfg.DatabaseURL)
-	if err != nil {
-		logger.Error(fmt.Sprintf("Failed to connect to database: %v", err))
-		log.Fatalf("Database connection failed: %v", err)
+	a := newApp(ctx)
+	cfg, logger, metricsCollector, db, pipelines := a.cfg, a.logger, a.metrics, a.db, a.pipelines
+	if cfg.RunOnce {
+		// Run as a batch job, e.g. where the command of the image cannot be changed
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		defer a.shutdown()
+		logger.Info("RUN_ONCE set, running one cycle")
+		return runCycles(ctx, pipelines)
 	}
-	defer db.Close()
-	logger.Info("Connected to PostgreSQL database")
+	build := version.Get()
+	logger.Info(fmt.Sprintf("Starting ETL Pipeline Service %s (commit %s, built %s)...", build.Version, build.Commit, build.BuildDate))
 
-	// Initialize storage
-	fileStorage := storage.NewFileStorage("data", logger)
-
-	// Initialize API client
-	apiClient := api.NewClient(cfg.APIURL, logger, metricsCollector)
+	// Initialize retention policy
+	var retentionEngine *retention.Engine
+	if cfg.RetentionPolicyFile != "" || len(cfg.RetentionTTL) > 0 || len(cfg.RetentionMaxSize) > 0 {
+		policy := &retention.Policy{}
+		if cfg.RetentionPolicyFile != "" {
+			var err error
+			if policy, err = retention.LoadPolicy(cfg.RetentionPolicyFile); err != nil {
+				logger.Error(fmt.Sprintf("Failed to load retention policy: %v", err))
+				log.Fatalf("Retention policy initialization failed: %v", err)
+			}
+		}
+		datasets := make([]string, 0, len(cfg.RetentionTTL))
+		for dataset := range cfg.RetentionTTL {
+			datasets = append(datasets, dataset)
+		}
+		sort.Strings(datasets)
+		for _, dataset := range datasets {
+			policy.AddDefault(dataset, cfg.RetentionTTL[dataset])
+		}
+		datasets = datasets[:0]
+		for dataset := range cfg.RetentionMaxSize {
+			datasets = append(datasets, dataset)
+		}
+		sort.Strings(datasets)
+		for _, dataset := range datasets {
+			maxSize, err := retention.ParseByteSize(cfg.RetentionMaxSize[dataset])
+			if err != nil || maxSize == 0 {
+				log.Fatalf("Invalid RETENTION_MAX_SIZE entry for %s: %s", dataset, cfg.RetentionMaxSize[dataset])
+			}
+			policy.AddSizeBudget(dataset, maxSize)
+		}
 
-	// Initialize transformer
-	transformer := transform.NewTransformer(logger, metricsCollector)
+		tenantExpr := ""
+		if cfg.RetentionTenantField != "" {
+			if !tenantFieldPattern.MatchString(cfg.RetentionTenantField) {
+				log.Fatalf("Invalid RETENTION_TENANT_FIELD: %s", cfg.RetentionTenantField)
+			}
+			tenantExpr = fmt.Sprintf("data->>'%s'", cfg.RetentionTenantField)
+		}
+		var archive *storage.FileStorage
+		if cfg.RetentionArchive {
+			archive = a.archiveStorage
+		}
 
-	// Initialize ETL service
-	etlService := etl.NewETLService(
-		apiClient,
-		db,
-		fileStorage,
-		transformer,
-		logger,
-		metricsCollector,
-	)
+		retentionEngine = retention.NewEngine(policy, logger, metricsCollector)
+		retentionEngine.Register("raw", retention.NewTableTarget(db, "raw_data", "created_at", tenantExpr, archive))
+		retentionEngine.Register("processed", retention.NewTableTarget(db, "processed_data", "processed_at", "", archive))
+		retentionEngine.Register("processed", retention.NewTableTarget(db, "processed_data_staging", "staged_at", "", nil))
+		retentionEngine.Register("runs", retention.NewTableTarget(db, "pipeline_runs", "started_at", "", archive))
+		retentionEngine.Register("runs", retention.NewTableTarget(db, "processed_loads", "loaded_at", "", nil))
+		for _, p := range pipelines {
+			p.registerFileTargets(retentionEngine, cfg.RetentionArchive)
+		}
+		if cfg.PipelinesFile != "" {
+			retentionEngine.Register("archive", retention.NewFileTarget("data/archive"))
+		}
+		retentionEngine.Register("audit", retention.NewTableTarget(db, "transform_audit", "audited_at", "", archive))
+		activeLogs := []string{"logs/etl.log"}
+		for _, p := range pipelines {
+			if p.logFile != "" {
+				activeLogs = append(activeLogs, p.logFile)
+			}
+		}
+		retentionEngine.Register("logs", retention.NewFileTarget("logs", activeLogs...))
+		logger.Info(fmt.Sprintf("Retention policy loaded: %d rules", len(policy.Rules)))
+	}
 
-	// Start HTTP server for health and metrics
-	srv := server.NewServer(cfg.ServerPort, db, logger, metricsCollector)
+	// Start HTTP server for health and metrics; batches posted to /ingest are
+	// loaded by the first pipeline
+	srv := server.NewServer(cfg.ServerPort, db, logger, metricsCollector, retentionEngine, pipelines[0].service)
+	controllers := make(map[string]server.PipelineController, len(pipelines))
+	freshness := make(map[string]server.FreshnessReporter, len(pipelines))
+	caches := make(map[string]server.Pinger)
+	for _, p := range pipelines {
+		name := p.name
+		if name == "" {
+			name = defaultPipeline
+		}
+		controllers[name] = p.service
+		freshness[name] = p.freshness
+		if p.redis != nil {
+			caches[name] = p.redis
+		}
+	}
+	srv.SetPipelines(controllers)
+	srv.SetFreshness(freshness)
+	srv.SetCaches(caches)
+	reloads := newReloader(cfg, pipelines, db, logger, metricsCollector)
+	srv.SetReloader(reloads)
+	srv.SetMiddleware(server.MiddlewareConfig{
+		AccessLog:      cfg.HTTPAccessLog,
+		RateLimit:      cfg.HTTPRateLimit,
+		RateLimitBurst: cfg.HTTPRateLimitBurst,
+		ClientIPHeader: cfg.HTTPClientIPHeader,
+		CORSOrigins:    cfg.HTTPCORSOrigins,
+	})
+	if auth := newAuthenticator(cfg.HTTPAuth, logger, metricsCollector); auth != nil {
+		srv.SetAuthenticator(auth)
+		logger.Info("HTTP API authentication enabled")
+	}
 	go func() {
 		logger.Info(fmt.Sprintf("Starting HTTP server on port %s", cfg.ServerPort))
 		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
@@ -75,28 +218,123 @@ func main() {
 		}
 	}()
 
-	// Context for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Start the ETL pipeline, or supervise every pipeline of PIPELINES_FILE
+	stopped := make(chan struct{})
+	if cfg.PipelinesFile == "" {
+		go func() {
+			pipelines[0].service.Start(ctx, pipelines[0].schedule)
+			close(stopped)
+		}()
+	} else {
+		manager := etl.NewManager(logger)
+		for _, p := range pipelines {
+			if err := manager.Add(p.name, p.service, p.schedule); err != nil {
+				log.Fatalf("Invalid PIPELINES_FILE: %v", err)
+			}
+		}
+		go func() {
+			manager.Start(ctx)
+			close(stopped)
+		}()
+		logger.Info(fmt.Sprintf("Supervising %d pipelines from %s", len(pipelines), cfg.PipelinesFile))
+	}
+
+	// Watch the success SLA of pipelines with alerting and the freshness of their data
+	for _, p := range pipelines {
+		if p.alerter != nil {
+			go p.alerter.Watch(ctx)
+		}
+		go p.freshness.Watch(ctx)
+	}
+
+	// Reload schedules and transforms when the configuration files change
+	if cfg.ConfigWatchInterval > 0 {
+		var files []string
+		for _, file := range []string{cfg.ConfigFile, cfg.PipelinesFile} {
+			if file != "" {
+				files = append(files, file)
+			}
+		}
+		go reloads.Watch(ctx, cfg.ConfigWatchInterval, files...)
+		logger.Info(fmt.Sprintf("Watching %v for changes every %v", files, cfg.ConfigWatchInterval))
+	}
+
+	// Reload the configuration when its secrets are rotated
+	if len(cfg.SecretRefs) > 0 {
+		logger.Info(fmt.Sprintf("Resolved %d settings from secrets backends", len(cfg.SecretRefs)))
+		if cfg.SecretsRefresh > 0 {
+			go reloads.WatchSecrets(ctx, cfg.SecretsRefresh)
+			logger.Info(fmt.Sprintf("Checking secrets for rotation every %v", cfg.SecretsRefresh))
+		}
+	}
 
-	// Start ETL pipeline
-	go etlService.Start(ctx, time.Duration(cfg.FetchInterval)*time.Second)
+	// Start partition maintenance
+	if a.partitionManager != nil {
+		go a.partitionManager.Start(ctx, time.Hour)
+	}
+	if a.maintainer != nil {
+		go a.maintainer.Start(ctx, cfg.DBMaintenanceInterval)
+	}
+
+	// Start scheduled retention, which deletes data and so stays off in dry-run mode
+	if cfg.DryRun {
+		logger.Warn("Dry-run mode: cycles extract and transform without writing, ingests and backfills are rejected")
+	}
+	if retentionEngine != nil && cfg.RetentionInterval > 0 && !cfg.DryRun {
+		go retentionEngine.Start(ctx, cfg.RetentionInterval)
+	}
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal, reloading the configuration on SIGHUP
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := <-sigChan; sig == syscall.SIGHUP; sig = <-sigChan {
+		logger.Info("SIGHUP received, reloading configuration")
+		reloads.Reload()
+	}
 
 	logger.Info("Shutdown signal received, stopping ETL pipeline...")
 	cancel()
 
+	// Wait for running cycles to drain; they are cancelled after SHUTDOWN_DRAIN_TIMEOUT
+	<-stopped
+
 	// Graceful shutdown of HTTP server
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Error(fmt.Sprintf("Server shutdown error: %v", err))
 	}
-
 	logger.Info("ETL Pipeline Service stopped gracefully")
+	a.Close(shutdownCtx)
+	return 0
 }
 
+// newAuthenticator builds the authentication of the HTTP API; it returns nil when
+// no credentials are configured, leaving the API open
+func newAuthenticator(cfg config.HTTPAuthConfig, logger *logging.Logger, metricsCollector *metrics.Metrics) *httpauth.Authenticator {
+	authCfg := httpauth.Config{
+		ReadTokens:    cfg.ReadTokens,
+		ControlTokens: cfg.ControlTokens,
+		ReadUsers:     cfg.ReadUsers,
+		ControlUsers:  cfg.ControlUsers,
+	}
+	if cfg.OIDCIssuer != "" {
+		authCfg.OIDC = &httpauth.OIDCConfig{
+			Issuer:      cfg.OIDCIssuer,
+			Audience:    cfg.OIDCAudience,
+			RolesClaim:  cfg.OIDCRolesClaim,
+			ReadRole:    cfg.OIDCReadRole,
+			ControlRole: cfg.OIDCControlRole,
+		}
+	}
+	// The API documentation is public so Swagger UI can load before credentials are entered
+	authCfg.PublicPaths = []string{"/openapi.json", "/docs"}
+	if cfg.PublicProbes {
+		authCfg.PublicPaths = append(authCfg.PublicPaths, "/health", "/ready")
+	}
+	auth, err := httpauth.New(authCfg, logger, metricsCollector)
+	if err != nil {
+		log.Fatalf("Invalid HTTP_AUTH settings: %v", err)
+	}
+	return auth
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/config"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+const migrateUsage = `Usage: etl-pipeline migrate <command>
+
+Commands:
+  up                apply all pending migrations
+  down [-steps N]   revert the last N applied migrations (default 1)
+  status            list migrations and when they were applied
+`
+
+// runMigrate implements the migrate command and returns the process exit code
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	steps := flags.Int("steps", 1, "number of migrations to revert")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return 1
+	}
+	db, err := database.NewPostgresDB(cfg.DatabaseURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Database connection failed: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := db.Migrate(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+		for _, version := range applied {
+			fmt.Printf("Applied migration %d\n", version)
+		}
+	case "down":
+		reverted, err := db.Rollback(ctx, *steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Rollback failed: %v\n", err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No migrations to revert")
+		}
+		for _, version := range reverted {
+			fmt.Printf("Reverted migration %d\n", version)
+		}
+	case "status":
+		statuses, err := db.MigrationStatus(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read migration status: %v\n", err)
+			return 1
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s %s\n", status.Version, status.Name, applied)
+		}
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
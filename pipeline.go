@@ -0,0 +1,923 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/api"
+	"github.com/mohammedhassan/etl-pipeline/internal/avro"
+	"github.com/mohammedhassan/etl-pipeline/internal/awsauth"
+	"github.com/mohammedhassan/etl-pipeline/internal/boot"
+	"github.com/mohammedhassan/etl-pipeline/internal/cache"
+	"github.com/mohammedhassan/etl-pipeline/internal/codec"
+	"github.com/mohammedhassan/etl-pipeline/internal/config"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/encryption"
+	"github.com/mohammedhassan/etl-pipeline/internal/etl"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/notify"
+	"github.com/mohammedhassan/etl-pipeline/internal/objectstore"
+	"github.com/mohammedhassan/etl-pipeline/internal/retention"
+	"github.com/mohammedhassan/etl-pipeline/internal/schemaregistry"
+	"github.com/mohammedhassan/etl-pipeline/internal/sink"
+	"github.com/mohammedhassan/etl-pipeline/internal/slo"
+	"github.com/mohammedhassan/etl-pipeline/internal/storage"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// pipeline is an ETL service with the storage and sinks it was assembled from
+type pipeline struct {
+	name    string
+	cfg     *config.Config
+	dataDir string
+	// logFile is the log of a pipeline of PIPELINES_FILE, empty for the pipeline of
+	// the environment configuration, which logs to logs/etl.log
+	logFile  string
+	service  *etl.ETLService
+	schedule etl.Schedule
+	storage  *storage.FileStorage
+	// snapshotStore receives the snapshots when they are not kept in local files;
+	// snapshotS3 and s3Client are the S3 compatible snapshot store and S3 sink, if any
+	snapshotStore storage.ObjectStore
+	snapshotS3    *objectstore.S3Client
+	s3Client      *objectstore.S3Client
+	closers       []func() error
+	// sourceClient and shadowClient extract from the source environments, the
+	// latter only when comparing them; their tokens are replaced on reload
+	sourceClient *api.Client
+	shadowClient *api.Client
+	// endpointClients extract from the API_ENDPOINTS with the source token, if any
+	endpointClients []*api.Client
+	// queue and stream are the SQS queue or Kinesis stream records are received
+	// from instead, if SOURCE_TYPE selects one
+	queue  *api.SQSExtractor
+	stream *api.KinesisExtractor
+	// enrichClient looks up the reference records of ENRICH_URL with the source
+	// token, if set
+	enrichClient *api.Client
+	// redis caches the enrichment lookups and the dedup key set, if REDIS_URL is set
+	redis *cache.Redis
+	// alerter watches the cycles of the pipeline, if alerts are configured
+	alerter *notify.Alerter
+	// freshness tracks the age of the processed data against its objective
+	freshness *slo.Monitor
+	logger    *logging.Logger
+	metrics   *metrics.Metrics
+}
+
+// cache returns a key set of the pipeline, in its Redis server if it has one
+func (p *pipeline) cache(set string) cache.Cache {
+	if p.redis != nil {
+		return cache.Prefixed(p.redis, set+":")
+	}
+	return cache.NewMemory()
+}
+
+// Close releases the sinks of the pipeline
+func (p *pipeline) Close() {
+	for _, close := range p.closers {
+		close()
+	}
+}
+
+// dependencies returns the checks of the source API, the storage and the Redis
+// server the pipeline waits for at startup
+func (p *pipeline) dependencies() []boot.Dependency {
+	dependencies := []boot.Dependency{
+		{Name: "data directory " + p.dataDir, Check: func(context.Context) error { return p.storage.Ping() }},
+	}
+	if store, ok := p.snapshotStore.(interface{ Ping(context.Context) error }); ok {
+		dependencies = append(dependencies, boot.Dependency{Name: p.cfg.StorageBackend + " bucket " + p.cfg.StorageBucket, Check: store.Ping})
+	}
+	if p.queue != nil {
+		dependencies = append(dependencies, boot.Dependency{Name: "SQS queue", Check: p.queue.Ping})
+	} else if p.stream != nil {
+		dependencies = append(dependencies, boot.Dependency{Name: "Kinesis stream " + p.cfg.KinesisStream, Check: p.stream.Ping})
+	} else if p.sourceClient != nil {
+		dependencies = append(dependencies, boot.Dependency{Name: "source API", Check: p.sourceClient.Ping})
+	}
+	if p.redis != nil {
+		dependencies = append(dependencies, boot.Dependency{Name: "Redis", Check: p.redis.Ping})
+	}
+	return dependencies
+}
+
+// storageCodec returns the codec of batch and archive files configured by cfg
+func storageCodec(cfg *config.Config) codec.Codec {
+	storageCodec, err := codec.Get(cfg.StorageCodec)
+	if err != nil {
+		log.Fatalf("Invalid STORAGE_CODEC: %v", err)
+	}
+	if storageCodec, err = codec.WithLevel(storageCodec, cfg.StorageCodecLevel); err != nil {
+		log.Fatalf("Invalid STORAGE_CODEC_LEVEL: %v", err)
+	}
+	return storageCodec
+}
+
+// newFileStorage creates the local storage of dir with the codec, partition layout
+// and format of cfg, encrypting files with keyring unless it is nil
+func newFileStorage(cfg *config.Config, dir string, keyring *encryption.Keyring, logger *logging.Logger) *storage.FileStorage {
+	fileStorage := storage.NewFileStorage(dir, storageCodec(cfg), logger)
+	if keyring != nil {
+		fileStorage.SetEncryption(keyring)
+	}
+	if err := fileStorage.SetPartitionLayout(cfg.StoragePartitionLayout); err != nil {
+		log.Fatalf("Invalid STORAGE_PARTITION_LAYOUT: %v", err)
+	}
+
+	switch cfg.StorageFormat {
+	case storage.FormatJSON:
+	case storage.FormatNDJSON:
+		fileStorage.UseNDJSON()
+	case storage.FormatCSV:
+		if err := fileStorage.UseCSV(csvOptions(cfg)); err != nil {
+			log.Fatalf("Invalid CSV options: %v", err)
+		}
+	case storage.FormatAvro:
+		if err := fileStorage.UseAvro(); err != nil {
+			log.Fatalf("Avro output unavailable: %v", err)
+		}
+	default:
+		log.Fatalf("Invalid STORAGE_FORMAT: %s", cfg.StorageFormat)
+	}
+	return fileStorage
+}
+
+func csvOptions(cfg *config.Config) storage.CSVOptions {
+	return storage.CSVOptions{Delimiter: cfg.CSVDelimiter, Header: cfg.CSVHeader, Quoting: cfg.CSVQuoting}
+}
+
+// logRotation returns the rotation of the log files configured by cfg
+func logRotation(cfg *config.Config) logging.RotationConfig {
+	return logging.RotationConfig{
+		MaxSize:    int64(cfg.LogMaxSizeMB) << 20,
+		MaxAge:     cfg.LogMaxAge,
+		MaxBackups: cfg.LogMaxBackups,
+		Compress:   cfg.LogCompress,
+	}
+}
+
+// newPipeline assembles the storage, extractor, transformer, sinks and ETL service
+// of a pipeline keeping its local files in dataDir
+func newPipeline(ctx context.Context, name string, cfg *config.Config, dataDir string, keyring *encryption.Keyring, db *database.PostgresDB, logger *logging.Logger, metricsCollector *metrics.Metrics) *pipeline {
+	p := &pipeline{name: name, cfg: cfg, dataDir: dataDir, logger: logger, metrics: metricsCollector}
+	var err error
+
+	// Initialize storage
+	p.storage = newFileStorage(cfg, dataDir, keyring, logger)
+
+	// Raw and processed snapshots go to local files or an object store
+	var snapshotStore storage.ObjectStore
+	partSize := cfg.StoragePartSizeMB << 20
+	switch cfg.StorageBackend {
+	case "file":
+	case "s3":
+		p.snapshotS3, err = objectstore.NewS3Client(objectstore.S3Config{
+			Bucket:    cfg.StorageBucket,
+			Region:    cfg.AWSRegion,
+			Endpoint:  cfg.S3Endpoint,
+			PathStyle: cfg.S3PathStyle,
+			Credentials: awsauth.Credentials{
+				AccessKeyID:     cfg.AWSAccessKeyID,
+				SecretAccessKey: cfg.AWSSecretAccessKey,
+				SessionToken:    cfg.AWSSessionToken,
+			},
+			PartSize: partSize,
+		})
+		snapshotStore = p.snapshotS3
+	case "gcs":
+		p.snapshotS3, err = objectstore.NewGCSClient(objectstore.GCSConfig{
+			Bucket:   cfg.StorageBucket,
+			AccessID: cfg.GCSHMACAccessID,
+			Secret:   cfg.GCSHMACSecret,
+			PartSize: partSize,
+		})
+		snapshotStore = p.snapshotS3
+	case "azure":
+		snapshotStore, err = objectstore.NewAzureClient(objectstore.AzureConfig{
+			Account:   cfg.AzureStorageAccount,
+			Container: cfg.StorageBucket,
+			Key:       cfg.AzureStorageKey,
+			SASToken:  cfg.AzureStorageSASToken,
+			Endpoint:  cfg.AzureStorageEndpoint,
+			BlockSize: partSize,
+		})
+	default:
+		log.Fatalf("Invalid STORAGE_BACKEND: %s", cfg.StorageBackend)
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to initialize %s snapshot storage: %v", cfg.StorageBackend, err))
+		log.Fatalf("Snapshot storage initialization failed: %v", err)
+	}
+	p.snapshotStore = snapshotStore
+	var snapshots storage.Storage = p.storage
+	if snapshotStore != nil {
+		objectStorage := storage.NewObjectStorage(snapshotStore, cfg.StoragePrefix, storageCodec(cfg), logger)
+		objectStorage.SetPartitionLayout(cfg.StoragePartitionLayout)
+		switch cfg.StorageFormat {
+		case storage.FormatNDJSON:
+			objectStorage.UseNDJSON()
+		case storage.FormatCSV:
+			objectStorage.UseCSV(csvOptions(cfg))
+		case storage.FormatAvro:
+			objectStorage.UseAvro()
+		}
+		snapshots = objectStorage
+		logger.Info(fmt.Sprintf("Snapshots stored in %s bucket %s under %q", cfg.StorageBackend, cfg.StorageBucket, cfg.StoragePrefix))
+	}
+
+	// Initialize API client for the selected source environment
+	source, otherSource := cfg.Sources()
+	if cfg.SourceEnv != config.SourceEnvProduction && cfg.SourceEnv != config.SourceEnvSandbox {
+		log.Fatalf("Invalid SOURCE_ENV: %s", cfg.SourceEnv)
+	}
+	if source.URL == "" && cfg.SourceType == config.SourceTypeAPI {
+		log.Fatalf("No API URL configured for source environment %s", source.Name)
+	}
+	requestBody, err := apiRequestBody(cfg)
+	if err != nil {
+		log.Fatalf("Invalid API_REQUEST_BODY: %v", err)
+	}
+	// configure sets the request timeout, method and transport of a source client,
+	// and keeps its responses that cannot be parsed
+	transport := apiTransport(cfg, dataDir)
+	configure := func(client *api.Client) {
+		client.SetRequestTimeout(cfg.ExtractTimeout)
+		client.SetRequest(cfg.APIMethod, requestBody)
+		client.SetTransport(transport)
+		if cfg.QuarantineEnabled {
+			client.SetQuarantine(p.storage, cfg.QuarantineMaxBytes)
+		}
+	}
+	apiClient := api.NewClient(source.URL, source.Token, logger, metricsCollector)
+	configure(apiClient)
+	apiClient.SetRangeParams(api.RangeParams{From: cfg.BackfillFromParam, To: cfg.BackfillToParam, Layout: cfg.BackfillDateLayout})
+	p.sourceClient = apiClient
+	var extractor api.Extractor = apiClient
+	logger.Info(fmt.Sprintf("Extracting from %s source: %s", source.Name, source.URL))
+	if cfg.IDRangeShards > 0 {
+		shardedExtractor, err := api.NewShardedExtractor(apiClient, api.ShardConfig{
+			IDField:   cfg.IDRangeField,
+			MinID:     cfg.IDRangeMin,
+			MaxID:     cfg.IDRangeMax,
+			Shards:    cfg.IDRangeShards,
+			PageSize:  cfg.IDRangePageSize,
+			FromParam: cfg.IDRangeFromParam,
+			ToParam:   cfg.IDRangeToParam,
+		}, db, logger, metricsCollector)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize sharded extraction: %v", err))
+			log.Fatalf("Sharded extraction initialization failed: %v", err)
+		}
+		extractor = shardedExtractor
+		logger.Info(fmt.Sprintf("Sharded extraction enabled: %d shards over ids %d-%d", cfg.IDRangeShards, cfg.IDRangeMin, cfg.IDRangeMax))
+		if cfg.ShardCoordination {
+			if cfg.ShardLeaseTTL <= 0 {
+				log.Fatalf("SHARD_LEASE_TTL must be positive")
+			}
+			shardedExtractor.SetCoordinator(db, cfg.InstanceID, cfg.ShardLeaseTTL)
+			p.closers = append(p.closers, shardedExtractor.Release)
+			logger.Info(fmt.Sprintf("Shard coordination enabled: claiming shards as %s with %v leases", cfg.InstanceID, cfg.ShardLeaseTTL))
+		}
+	}
+	if cfg.ShardCoordination && cfg.IDRangeShards == 0 {
+		log.Fatalf("SHARD_COORDINATION requires sharded extraction, set ID_RANGE_SHARDS")
+	}
+	if cfg.SourceCompare {
+		if otherSource.URL == "" {
+			log.Fatalf("SOURCE_COMPARE requires an API URL for the %s environment", otherSource.Name)
+		}
+		if cfg.IDRangeShards > 0 {
+			log.Fatalf("SOURCE_COMPARE cannot be combined with sharded extraction")
+		}
+		shadowClient := api.NewClient(otherSource.URL, otherSource.Token, logger, metricsCollector)
+		configure(shadowClient)
+		p.shadowClient = shadowClient
+		extractor = api.NewCompareExtractor(source.Name, extractor, otherSource.Name, shadowClient, cfg.SourceCompareKey, logger, metricsCollector)
+		logger.Info(fmt.Sprintf("Source comparison enabled: diffing %s against %s by %s", otherSource.Name, source.Name, cfg.SourceCompareKey))
+	}
+	if len(cfg.APIEndpoints) > 0 {
+		if cfg.IDRangeShards > 0 || cfg.SourceCompare {
+			log.Fatalf("API_ENDPOINTS cannot be combined with sharded extraction or SOURCE_COMPARE")
+		}
+		names := make([]string, 0, len(cfg.APIEndpoints))
+		for name := range cfg.APIEndpoints {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		endpoints := make([]api.Endpoint, 0, len(names))
+		for _, name := range names {
+			client := api.NewClient(cfg.APIEndpoints[name], source.Token, logger, metricsCollector)
+			configure(client)
+			client.SetRangeParams(api.RangeParams{From: cfg.BackfillFromParam, To: cfg.BackfillToParam, Layout: cfg.BackfillDateLayout})
+			p.endpointClients = append(p.endpointClients, client)
+			endpoints = append(endpoints, api.Endpoint{Name: name, Extractor: client})
+		}
+		extractor = api.NewMultiExtractor(endpoints, cfg.APIEndpointParallelism, logger, metricsCollector)
+		logger.Info(fmt.Sprintf("Extracting from %d endpoints instead, %d at a time: %s", len(names), cfg.APIEndpointParallelism, strings.Join(names, ", ")))
+	}
+	if cfg.SourceType != config.SourceTypeAPI && (cfg.IDRangeShards > 0 || cfg.SourceCompare || len(cfg.APIEndpoints) > 0) {
+		log.Fatalf("SOURCE_TYPE=%s cannot be combined with sharded extraction, SOURCE_COMPARE or API_ENDPOINTS", cfg.SourceType)
+	}
+	switch cfg.SourceType {
+	case config.SourceTypeSQS:
+		p.queue, err = api.NewSQSExtractor(api.SQSConfig{
+			QueueURL:           cfg.SQSQueueURL,
+			DeadLetterQueueURL: cfg.SQSDeadLetterQueueURL,
+			Region:             cfg.AWSRegion,
+			Credentials: awsauth.Credentials{
+				AccessKeyID:     cfg.AWSAccessKeyID,
+				SecretAccessKey: cfg.AWSSecretAccessKey,
+				SessionToken:    cfg.AWSSessionToken,
+			},
+			MaxMessages:       cfg.SQSMaxMessages,
+			WaitTime:          cfg.SQSWaitTime,
+			VisibilityTimeout: cfg.SQSVisibilityTimeout,
+			MaxReceives:       cfg.SQSMaxReceives,
+		}, logger, metricsCollector)
+		if err != nil {
+			log.Fatalf("Invalid SQS source: %v", err)
+		}
+		extractor = p.queue
+		logger.Info(fmt.Sprintf("Receiving records from SQS queue %s, up to %d messages per cycle", cfg.SQSQueueURL, cfg.SQSMaxMessages))
+	case config.SourceTypeKinesis:
+		p.stream, err = api.NewKinesisExtractor(api.KinesisConfig{
+			Stream:   cfg.KinesisStream,
+			Endpoint: cfg.KinesisEndpoint,
+			Region:   cfg.AWSRegion,
+			Credentials: awsauth.Credentials{
+				AccessKeyID:     cfg.AWSAccessKeyID,
+				SecretAccessKey: cfg.AWSSecretAccessKey,
+				SessionToken:    cfg.AWSSessionToken,
+			},
+			StartPosition: cfg.KinesisStartPosition,
+			MaxRecords:    cfg.KinesisMaxRecords,
+			BatchSize:     cfg.KinesisBatchSize,
+		}, db, logger, metricsCollector)
+		if err != nil {
+			log.Fatalf("Invalid Kinesis source: %v", err)
+		}
+		extractor = p.stream
+		logger.Info(fmt.Sprintf("Reading records from Kinesis stream %s, up to %d per cycle", cfg.KinesisStream, cfg.KinesisMaxRecords))
+	}
+
+	// Initialize transformer
+	transformer, err := newTransformer(cfg, logger, metricsCollector)
+	if err != nil {
+		log.Fatalf("Invalid transform settings: %v", err)
+	}
+	if cfg.TransformAuditSampleRate > 0 {
+		logger.Info(fmt.Sprintf("Transformation audit trail enabled for %.0f%% of records", cfg.TransformAuditSampleRate*100))
+	}
+
+	// Register the schemas of snapshot files and Kafka messages, refusing to start
+	// with one consumers could not read
+	var registry *schemaregistry.Client
+	if cfg.SchemaRegistryURL != "" {
+		registry, err = schemaregistry.NewClient(schemaregistry.Config{
+			URL:      cfg.SchemaRegistryURL,
+			Username: cfg.SchemaRegistryUsername,
+			Password: cfg.SchemaRegistryPassword,
+		})
+		if err != nil {
+			log.Fatalf("Invalid SCHEMA_REGISTRY_URL: %v", err)
+		}
+		if err := registerFileSchema(ctx, registry, cfg, logger); err != nil {
+			logger.Error(fmt.Sprintf("Failed to register snapshot schema: %v", err))
+			log.Fatalf("Snapshot schema registration failed: %v", err)
+		}
+	}
+
+	// Initialize sinks
+	for name := range cfg.SinkCodecs {
+		if name != "s3" && name != "kafka" {
+			logger.Warn(fmt.Sprintf("SINK_CODECS entry for %s ignored, only the s3 and kafka sinks compress their output", name))
+		}
+	}
+	var sinks []sink.Sink
+	if cfg.TransactionalWrites {
+		// processed_data is written in the same transaction as raw_data instead
+		logger.Info("Transactional writes enabled: raw and processed records are stored atomically")
+	} else if cfg.PostgresSinkEnabled {
+		postgresSink := sink.NewPostgresSink(db, metricsCollector)
+		postgresSink.SetWorkers(cfg.PostgresSinkWorkers)
+		partitionKey := "source id"
+		if cfg.PostgresSinkPartitionKey != "" {
+			if err := postgresSink.SetPartitionKey(cfg.PostgresSinkPartitionKey); err != nil {
+				logger.Error(fmt.Sprintf("Failed to initialize PostgreSQL sink: %v", err))
+				log.Fatalf("PostgreSQL sink initialization failed: %v", err)
+			}
+			partitionKey = cfg.PostgresSinkPartitionKey
+		}
+		sinks = append(sinks, postgresSink)
+		if cfg.PostgresSinkWorkers > 1 {
+			logger.Info(fmt.Sprintf("PostgreSQL sink writes batches with %d workers partitioned by %s", cfg.PostgresSinkWorkers, partitionKey))
+		}
+	}
+	if cfg.KafkaTopic != "" {
+		kafkaSink, err := sink.NewKafkaSink(sink.KafkaConfig{
+			Brokers:       cfg.KafkaBrokers,
+			Topic:         cfg.KafkaTopic,
+			KeyField:      cfg.KafkaKeyField,
+			Serialization: cfg.KafkaSerialization,
+			RequiredAcks:  cfg.KafkaRequiredAcks,
+			Compression:   cfg.SinkCodecs["kafka"],
+		}, logger, metricsCollector)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize Kafka sink: %v", err))
+			log.Fatalf("Kafka sink initialization failed: %v", err)
+		}
+		if registry != nil {
+			if err := kafkaSink.SetSchemaRegistry(ctx, registry); err != nil {
+				logger.Error(fmt.Sprintf("Failed to register Kafka schema: %v", err))
+				log.Fatalf("Kafka schema registration failed: %v", err)
+			}
+		}
+		p.closers = append(p.closers, kafkaSink.Close)
+		sinks = append(sinks, kafkaSink)
+		logger.Info(fmt.Sprintf("Kafka sink enabled: topic %s (%s)", cfg.KafkaTopic, cfg.KafkaSerialization))
+	}
+	if cfg.BigQueryTable != "" {
+		bigQuerySink, err := sink.NewBigQuerySink(ctx, sink.BigQueryConfig{
+			ProjectID:       cfg.BigQueryProject,
+			Dataset:         cfg.BigQueryDataset,
+			Table:           cfg.BigQueryTable,
+			CredentialsFile: cfg.BigQueryCredentialsFile,
+			ColumnMap:       cfg.BigQueryColumnMap,
+		}, logger, metricsCollector)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize BigQuery sink: %v", err))
+			log.Fatalf("BigQuery sink initialization failed: %v", err)
+		}
+		p.closers = append(p.closers, bigQuerySink.Close)
+		sinks = append(sinks, bigQuerySink)
+		logger.Info(fmt.Sprintf("BigQuery sink enabled: %s.%s.%s", cfg.BigQueryProject, cfg.BigQueryDataset, cfg.BigQueryTable))
+	}
+	if cfg.RemoteWriteURL != "" {
+		remoteWriteSink, err := sink.NewRemoteWriteSink(sink.RemoteWriteConfig{
+			URL:         cfg.RemoteWriteURL,
+			Metrics:     cfg.RemoteWriteMetrics,
+			Labels:      cfg.RemoteWriteLabels,
+			BearerToken: cfg.RemoteWriteToken,
+			Username:    cfg.RemoteWriteUsername,
+			Password:    cfg.RemoteWritePassword,
+			Timeout:     cfg.RemoteWriteTimeout,
+		}, logger, metricsCollector)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize Prometheus remote-write sink: %v", err))
+			log.Fatalf("Prometheus remote-write sink initialization failed: %v", err)
+		}
+		sinks = append(sinks, remoteWriteSink)
+		logger.Info(fmt.Sprintf("Prometheus remote-write sink enabled: %d metrics to %s", len(cfg.RemoteWriteMetrics), cfg.RemoteWriteURL))
+	}
+
+	if cfg.SnowflakeAccount != "" {
+		stage, err := objectstore.NewS3Client(objectstore.S3Config{
+			Bucket:    cfg.SnowflakeStageBucket,
+			Region:    cfg.AWSRegion,
+			Endpoint:  cfg.S3Endpoint,
+			PathStyle: cfg.S3PathStyle,
+			Credentials: awsauth.Credentials{
+				AccessKeyID:     cfg.AWSAccessKeyID,
+				SecretAccessKey: cfg.AWSSecretAccessKey,
+				SessionToken:    cfg.AWSSessionToken,
+			},
+		})
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize Snowflake stage bucket: %v", err))
+			log.Fatalf("Snowflake sink initialization failed: %v", err)
+		}
+		snowflakeSink, err := sink.NewSnowflakeSink(sink.SnowflakeConfig{
+			Account:        cfg.SnowflakeAccount,
+			Endpoint:       cfg.SnowflakeEndpoint,
+			User:           cfg.SnowflakeUser,
+			Role:           cfg.SnowflakeRole,
+			Warehouse:      cfg.SnowflakeWarehouse,
+			Database:       cfg.SnowflakeDatabase,
+			Schema:         cfg.SnowflakeSchema,
+			Table:          cfg.SnowflakeTable,
+			PrivateKeyFile: cfg.SnowflakePrivateKeyFile,
+			Token:          cfg.SnowflakeToken,
+			Stage:          cfg.SnowflakeStage,
+			StagePrefix:    cfg.SnowflakeStagePrefix,
+			MergeKeys:      cfg.SnowflakeMergeKeys,
+		}, stage, logger, metricsCollector)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize Snowflake sink: %v", err))
+			log.Fatalf("Snowflake sink initialization failed: %v", err)
+		}
+		sinks = append(sinks, snowflakeSink)
+		logger.Info(fmt.Sprintf("Snowflake sink enabled: %s.%s.%s through @%s", cfg.SnowflakeDatabase, cfg.SnowflakeSchema, cfg.SnowflakeTable, cfg.SnowflakeStage))
+	}
+
+	if cfg.RedshiftCluster != "" || cfg.RedshiftWorkgroup != "" {
+		credentials := awsauth.Credentials{
+			AccessKeyID:     cfg.AWSAccessKeyID,
+			SecretAccessKey: cfg.AWSSecretAccessKey,
+			SessionToken:    cfg.AWSSessionToken,
+		}
+		stage, err := objectstore.NewS3Client(objectstore.S3Config{
+			Bucket:      cfg.RedshiftStageBucket,
+			Region:      cfg.AWSRegion,
+			Endpoint:    cfg.S3Endpoint,
+			PathStyle:   cfg.S3PathStyle,
+			Credentials: credentials,
+		})
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize Redshift stage bucket: %v", err))
+			log.Fatalf("Redshift sink initialization failed: %v", err)
+		}
+		redshiftSink, err := sink.NewRedshiftSink(sink.RedshiftConfig{
+			ClusterIdentifier: cfg.RedshiftCluster,
+			WorkgroupName:     cfg.RedshiftWorkgroup,
+			Database:          cfg.RedshiftDatabase,
+			DbUser:            cfg.RedshiftDBUser,
+			SecretARN:         cfg.RedshiftSecretARN,
+			Schema:            cfg.RedshiftSchema,
+			Table:             cfg.RedshiftTable,
+			IAMRole:           cfg.RedshiftIAMRole,
+			StageBucket:       cfg.RedshiftStageBucket,
+			StagePrefix:       cfg.RedshiftStagePrefix,
+			Endpoint:          cfg.RedshiftEndpoint,
+			Region:            cfg.AWSRegion,
+			Credentials:       credentials,
+		}, stage, logger, metricsCollector)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize Redshift sink: %v", err))
+			log.Fatalf("Redshift sink initialization failed: %v", err)
+		}
+		sinks = append(sinks, redshiftSink)
+		logger.Info(fmt.Sprintf("Redshift sink enabled: %s.%s.%s staged in s3://%s/%s", cfg.RedshiftDatabase, cfg.RedshiftSchema, cfg.RedshiftTable, cfg.RedshiftStageBucket, cfg.RedshiftStagePrefix))
+	}
+
+	if cfg.MongoURI != "" {
+		mongoSink, err := sink.NewMongoSink(sink.MongoConfig{
+			URI:          cfg.MongoURI,
+			Database:     cfg.MongoDatabase,
+			Collection:   cfg.MongoCollection,
+			Keys:         cfg.MongoKeys,
+			WriteConcern: cfg.MongoWriteConcern,
+			Journal:      cfg.MongoJournal,
+			WriteTimeout: cfg.MongoWriteTimeout,
+			Timeout:      cfg.MongoTimeout,
+		}, logger, metricsCollector)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize MongoDB sink: %v", err))
+			log.Fatalf("MongoDB sink initialization failed: %v", err)
+		}
+		sinks = append(sinks, mongoSink)
+		p.closers = append(p.closers, mongoSink.Close)
+		logger.Info(fmt.Sprintf("MongoDB sink enabled: upserting into %s by %s", cfg.MongoCollection, strings.Join(cfg.MongoKeys, ", ")))
+	}
+
+	if cfg.S3SinkBucket != "" {
+		p.s3Client, err = objectstore.NewS3Client(objectstore.S3Config{
+			Bucket:    cfg.S3SinkBucket,
+			Region:    cfg.AWSRegion,
+			Endpoint:  cfg.S3Endpoint,
+			PathStyle: cfg.S3PathStyle,
+			Credentials: awsauth.Credentials{
+				AccessKeyID:     cfg.AWSAccessKeyID,
+				SecretAccessKey: cfg.AWSSecretAccessKey,
+				SessionToken:    cfg.AWSSessionToken,
+			},
+		})
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize S3 sink: %v", err))
+			log.Fatalf("S3 sink initialization failed: %v", err)
+		}
+		s3Codec, err := codec.Get(cfg.SinkCodecs["s3"])
+		if err != nil {
+			log.Fatalf("Invalid SINK_CODECS entry for s3: %v", err)
+		}
+		sinks = append(sinks, sink.NewS3Sink(p.s3Client, cfg.S3SinkPrefix, s3Codec, logger, metricsCollector))
+		logger.Info(fmt.Sprintf("S3 sink enabled: s3://%s/%s", cfg.S3SinkBucket, cfg.S3SinkPrefix))
+	}
+
+	targets := make([]sink.Target, 0, len(sinks))
+	for _, s := range sinks {
+		targets = append(targets, sink.Target{Sink: s, Retry: cfg.SinkRetryPolicy(s.Name())})
+	}
+	loader := sink.NewFanOut(targets, logger, metricsCollector)
+
+	// Initialize ETL service
+	p.service = etl.NewETLService(
+		extractor,
+		db,
+		p.storage,
+		snapshots,
+		transformer,
+		logger,
+		metricsCollector,
+		loader,
+	)
+	p.service.SetPipelineName(displayName(name))
+	p.service.SetSourceName(source.Name)
+	p.service.SetFileFallback(cfg.FileFallbackEnabled)
+	p.service.SetTransactional(cfg.TransactionalWrites)
+	p.service.SetCheckpoints(cfg.CheckpointsEnabled)
+	p.service.SetCycleBudget(cfg.CycleBudget)
+	p.service.SetBackfillDefaults(cfg.BackfillChunk, cfg.BackfillParallelism)
+	p.service.SetDryRun(cfg.DryRun)
+	if err := p.service.SetOverlapPolicy(cfg.CycleOverlap); err != nil {
+		log.Fatalf("Invalid CYCLE_OVERLAP: %v", err)
+	}
+	p.service.SetCycleTimeout(cfg.CycleTimeout)
+	p.service.SetDrainTimeout(cfg.ShutdownDrainTimeout)
+	p.service.SetStageTimeouts(etl.StageTimeouts{Store: cfg.StoreTimeout, Load: cfg.LoadTimeout})
+	p.service.SetRawPassthrough(cfg.RawPassthrough)
+	p.service.SetRawBlobs(cfg.RawBlobsEnabled)
+	if cfg.RedisURL != "" {
+		redis, err := cache.NewRedis(cache.RedisConfig{
+			URL:     cfg.RedisURL,
+			Prefix:  cfg.RedisKeyPrefix + displayName(name) + ":",
+			Timeout: cfg.RedisTimeout,
+		})
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize Redis: %v", err))
+			log.Fatalf("Redis initialization failed: %v", err)
+		}
+		p.redis = redis
+		p.closers = append(p.closers, redis.Close)
+	}
+	if cfg.EnrichURL != "" {
+		if len(cfg.PipelineSteps) > 0 {
+			logger.Warn("ENRICH_URL does not apply to the steps of the pipeline, which transform their own batches")
+		}
+		client := api.NewClient(cfg.EnrichURL, source.Token, logger, metricsCollector)
+		configure(client)
+		p.enrichClient = client
+		p.service.SetEnrichment(etl.EnrichConfig{
+			URL:    cfg.EnrichURL,
+			Key:    cfg.EnrichKey,
+			Fields: cfg.EnrichFields,
+			TTL:    cfg.EnrichTTL,
+		}, client, p.cache("enrich"))
+		logger.Info(fmt.Sprintf("Enrichment enabled: %s looked up by %s, cached for %v", cfg.EnrichURL, cfg.EnrichKey, cfg.EnrichTTL))
+	}
+	if cfg.DedupTTL > 0 {
+		p.service.SetDedup(p.cache("dedup"), cfg.DedupTTL)
+		logger.Info(fmt.Sprintf("Dedup enabled: records loaded unchanged within %v are skipped", cfg.DedupTTL))
+	}
+	if err := p.service.SetRawStorage(etl.RawStorage{Mode: cfg.RawStorage, SampleRate: cfg.RawStorageSampleRate}); err != nil {
+		log.Fatalf("Invalid RAW_STORAGE: %v", err)
+	}
+	if err := p.service.SetDeleteMode(cfg.TransformDeleteMode); err != nil {
+		log.Fatalf("Invalid TRANSFORM_DELETE_MODE: %v", err)
+	}
+	switch cfg.ChangeEventsTarget {
+	case sink.ChangeTargetTable:
+		p.service.SetChangePublisher(sink.NewChangeTable(db))
+		logger.Info("Change events enabled: changes table")
+	case sink.ChangeTargetKafka:
+		publisher, err := sink.NewKafkaChangePublisher(sink.KafkaConfig{
+			Brokers:      cfg.KafkaBrokers,
+			Topic:        cfg.ChangeEventsTopic,
+			RequiredAcks: cfg.KafkaRequiredAcks,
+			Compression:  cfg.SinkCodecs["kafka"],
+		}, logger)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize change event publisher: %v", err))
+			log.Fatalf("Change event publisher initialization failed: %v", err)
+		}
+		p.closers = append(p.closers, publisher.Close)
+		p.service.SetChangePublisher(publisher)
+		logger.Info(fmt.Sprintf("Change events enabled: topic %s", cfg.ChangeEventsTopic))
+	}
+	p.service.SetStreaming(etl.StreamConfig{
+		Workers:       cfg.StreamWorkers,
+		Buffer:        cfg.StreamBuffer,
+		BatchSize:     cfg.StreamBatchSize,
+		FlushInterval: cfg.StreamFlushInterval,
+		MaxInFlight:   cfg.StreamMaxInFlight,
+		MaxBatchBytes: int64(cfg.StreamMaxBatchBytes),
+	})
+	if len(cfg.WebhookURLs) > 0 {
+		webhooks, err := notify.NewWebhooks(name, notify.WebhookConfig{
+			URLs:    cfg.WebhookURLs,
+			Secret:  cfg.WebhookSecret,
+			Retry:   cfg.WebhookRetry,
+			Timeout: cfg.WebhookTimeout,
+		}, logger, metricsCollector)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOK_URLS: %v", err)
+		}
+		p.service.AddNotifier(webhooks)
+		logger.Info(fmt.Sprintf("Cycle webhooks enabled: %d URLs", len(cfg.WebhookURLs)))
+	}
+	if senders := alertSenders(cfg); len(senders) > 0 {
+		if cfg.AlertErrorRate < 0 || cfg.AlertErrorRate >= 1 {
+			log.Fatalf("ALERT_ERROR_RATE must be between 0 and 1")
+		}
+		p.alerter = notify.NewAlerter(name, notify.AlertRules{
+			ErrorRate:       cfg.AlertErrorRate,
+			ErrorRateWindow: cfg.AlertErrorRateWindow,
+			SLA:             cfg.AlertSLA,
+			RepeatInterval:  cfg.AlertRepeatInterval,
+		}, senders, logger, metricsCollector)
+		p.service.AddNotifier(p.alerter)
+		logger.Info(fmt.Sprintf("Alerting enabled through %d channels", len(senders)))
+	}
+	if cfg.FreshnessSLO < 0 {
+		log.Fatalf("FRESHNESS_SLO must not be negative")
+	}
+	p.freshness = slo.NewMonitor(name, cfg.FreshnessSLO, p.service, logger, metricsCollector)
+	if cfg.FreshnessSLO > 0 {
+		if p.alerter != nil {
+			p.freshness.AddNotifier(p.alerter)
+		}
+		logger.Info(fmt.Sprintf("Freshness SLO: processed data at most %v old", cfg.FreshnessSLO))
+	}
+	p.service.SetRetryPolicy(cfg.CycleRetry)
+	if cfg.SchedulerStateEnabled {
+		p.service.SetStateStore(db)
+	}
+	if !cfg.DryRun {
+		if err := p.service.RecordTransformVersion(ctx); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to record transform version %s: %v", transformer.Version(), err))
+		}
+	}
+	if len(cfg.PipelineSteps) > 0 {
+		dag, err := newDAG(cfg.PipelineSteps, cfg.ExtractTimeout, transport, logger, metricsCollector)
+		if err != nil {
+			log.Fatalf("Invalid steps of pipeline %s: %v", name, err)
+		}
+		p.service.SetDAG(dag)
+		logger.Info(fmt.Sprintf("Running cycles through steps %v", dag))
+	}
+
+	if p.schedule, err = newSchedule(cfg); err != nil {
+		log.Fatalf("Invalid SCHEDULE: %v", err)
+	}
+	return p
+}
+
+// newSchedule returns the cron schedule of cfg, or its fetch interval
+func newSchedule(cfg *config.Config) (etl.Schedule, error) {
+	if cfg.Schedule != "" {
+		return etl.ParseCron(cfg.Schedule, cfg.ScheduleTimezone)
+	}
+	return etl.Every(time.Duration(cfg.FetchInterval) * time.Second), nil
+}
+
+// newTransformer returns a transformer with the audit sampling, field sources,
+// delete rule and timestamp normalization of cfg
+func newTransformer(cfg *config.Config, logger *logging.Logger, metricsCollector *metrics.Metrics) (*transform.Transformer, error) {
+	transformer := transform.NewTransformerWithAudit(logger, metricsCollector, cfg.TransformAuditSampleRate)
+	if len(cfg.TransformFieldSources) > 0 {
+		if err := transformer.SetFieldSources(cfg.TransformFieldSources); err != nil {
+			return nil, fmt.Errorf("invalid TRANSFORM_FIELD_SOURCES: %w", err)
+		}
+	}
+	if cfg.TransformDeleteRule != "" {
+		rule, err := transform.ParseDeleteRule(cfg.TransformDeleteRule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRANSFORM_DELETE_RULE: %w", err)
+		}
+		transformer.SetDeleteRule(rule)
+	}
+	if cfg.TransformTimestampField != "" {
+		if err := transformer.SetTimestamp(timestampConfig(cfg)); err != nil {
+			return nil, fmt.Errorf("invalid TRANSFORM_TIMESTAMP_TYPE: %w", err)
+		}
+	}
+	return transformer, nil
+}
+
+// timestampConfig returns the timestamp normalization of cfg. The zones were
+// checked by config validation; an unknown one falls back to UTC.
+func timestampConfig(cfg *config.Config) transform.TimestampConfig {
+	sourceZone, _ := time.LoadLocation(cfg.TransformTimestampSourceTZ)
+	targetZone, _ := time.LoadLocation(cfg.TransformTimestampTargetTZ)
+	return transform.TimestampConfig{
+		Field:      cfg.TransformTimestampField,
+		Formats:    cfg.TransformTimestampFormats,
+		SourceZone: sourceZone,
+		TargetZone: targetZone,
+		Type:       cfg.TransformTimestampType,
+	}
+}
+
+// registerFileSchema registers the schema of processed records in snapshot files
+// under SCHEMA_REGISTRY_FILE_SUBJECT, for the formats that have one
+func registerFileSchema(ctx context.Context, registry *schemaregistry.Client, cfg *config.Config, logger *logging.Logger) error {
+	var schema schemaregistry.Schema
+	switch cfg.StorageFormat {
+	case storage.FormatAvro:
+		definition, err := avro.Schema(storage.ProcessedRecordSchema, transform.Fields)
+		if err != nil {
+			return err
+		}
+		schema = schemaregistry.Schema{Type: schemaregistry.TypeAvro, Definition: definition}
+	case storage.FormatJSON, storage.FormatNDJSON:
+		definition, err := schemaregistry.JSONSchema(storage.ProcessedRecordSchema, transform.Fields)
+		if err != nil {
+			return err
+		}
+		schema = schemaregistry.Schema{Type: schemaregistry.TypeJSON, Definition: definition}
+	default:
+		logger.Warn(fmt.Sprintf("STORAGE_FORMAT %s has no registry schema, snapshot files are not registered", cfg.StorageFormat))
+		return nil
+	}
+	id, err := registry.Register(ctx, cfg.SchemaRegistryFileSubject, schema)
+	if err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Snapshot schema registered as subject %s, ID %d", cfg.SchemaRegistryFileSubject, id))
+	return nil
+}
+
+// alertSenders returns the alert channels configured by cfg
+func alertSenders(cfg *config.Config) []notify.AlertSender {
+	var senders []notify.AlertSender
+	if cfg.AlertSlackWebhookURL != "" {
+		senders = append(senders, notify.NewSlackSender(cfg.AlertSlackWebhookURL))
+	}
+	if cfg.AlertSMTPHost != "" {
+		email, err := notify.NewEmailSender(notify.SMTPConfig{
+			Host:     cfg.AlertSMTPHost,
+			Port:     cfg.AlertSMTPPort,
+			Username: cfg.AlertSMTPUsername,
+			Password: cfg.AlertSMTPPassword,
+			From:     cfg.AlertEmailFrom,
+			To:       cfg.AlertEmailTo,
+		})
+		if err != nil {
+			log.Fatalf("Invalid ALERT_SMTP settings: %v", err)
+		}
+		senders = append(senders, email)
+	}
+	return senders
+}
+
+// newDAG builds the DAG of a pipeline's steps, with an API client for each extract
+// step reading from its own source, bounding each request by requestTimeout
+func newDAG(definitions []config.StepDefinition, requestTimeout time.Duration, transport api.TransportConfig, logger *logging.Logger, metricsCollector *metrics.Metrics) (*etl.DAG, error) {
+	steps := make([]etl.Step, 0, len(definitions))
+	for _, def := range definitions {
+		step := etl.Step{
+			Name:      def.Name,
+			Type:      def.Type,
+			DependsOn: def.DependsOn,
+			JoinKey:   def.Key,
+			JoinType:  def.Join,
+		}
+		if def.Source.URL != "" {
+			client := api.NewClient(def.Source.URL, def.Source.Token, logger, metricsCollector)
+			client.SetRequestTimeout(requestTimeout)
+			client.SetTransport(transport)
+			step.Extractor = client
+		}
+		steps = append(steps, step)
+	}
+	return etl.NewDAG(steps)
+}
+
+// apiTransport returns the transport settings of source clients, dumping failed
+// requests under dataDir/debug/api when enabled and dataDir is set
+func apiTransport(cfg *config.Config, dataDir string) api.TransportConfig {
+	transport := api.TransportConfig{UserAgent: cfg.APIUserAgent, RequestIDHeader: cfg.APIRequestIDHeader}
+	if cfg.APIDumpFailures && dataDir != "" {
+		transport.DumpDir = filepath.Join(dataDir, "debug", "api")
+	}
+	return transport
+}
+
+// apiRequestBody parses the template of the body of source requests, if any
+func apiRequestBody(cfg *config.Config) (*template.Template, error) {
+	if cfg.APIRequestBody == "" {
+		return nil, nil
+	}
+	return api.ParseRequestBody(cfg.APIRequestBody)
+}
+
+// registerFileTargets registers the local files and snapshots of a pipeline
+// with the retention engine
+func (p *pipeline) registerFileTargets(engine *retention.Engine, archive bool) {
+	rawFiles := retention.NewFileTarget(filepath.Join(p.dataDir, "raw"))
+	processedFiles := retention.NewFileTarget(filepath.Join(p.dataDir, "processed"))
+	if archive {
+		rawFiles.ArchiveTo(filepath.Join(p.dataDir, "archive", "raw"))
+		processedFiles.ArchiveTo(filepath.Join(p.dataDir, "archive", "processed"))
+	}
+	engine.Register("raw", rawFiles)
+	engine.Register("processed", processedFiles)
+	if p.snapshotS3 != nil {
+		engine.Register("raw", retention.NewObjectTarget(p.snapshotS3, path.Join(p.cfg.StoragePrefix, "raw")))
+		engine.Register("processed", retention.NewObjectTarget(p.snapshotS3, path.Join(p.cfg.StoragePrefix, "processed")))
+	}
+	if p.s3Client != nil {
+		engine.Register("processed", retention.NewObjectTarget(p.s3Client, p.cfg.S3SinkPrefix))
+	}
+	engine.Register("runs", retention.NewFileTarget(filepath.Join(p.dataDir, "manifests")))
+	engine.Register("quarantine", retention.NewFileTarget(filepath.Join(p.dataDir, "quarantine")))
+	engine.Register("archive", retention.NewFileTarget(filepath.Join(p.dataDir, "archive")))
+}
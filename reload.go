@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/config"
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+	"github.com/mohammedhassan/etl-pipeline/internal/etl"
+	"github.com/mohammedhassan/etl-pipeline/internal/logging"
+	"github.com/mohammedhassan/etl-pipeline/internal/metrics"
+	"github.com/mohammedhassan/etl-pipeline/internal/server"
+	"github.com/mohammedhassan/etl-pipeline/internal/transform"
+)
+
+// reloadableSettings are the Config fields a reload applies to running pipelines;
+// changes to any other field take effect after a restart
+var reloadableSettings = []string{
+	"APIToken",
+	"SandboxAPIToken",
+	"DatabaseURL",
+	"DatabaseReadURL",
+	"FetchInterval",
+	"Schedule",
+	"ScheduleTimezone",
+	"TransformAuditSampleRate",
+	"TransformFieldSources",
+	"TransformDeleteRule",
+	"TransformTimestampField",
+	"TransformTimestampFormats",
+	"TransformTimestampSourceTZ",
+	"TransformTimestampTargetTZ",
+	"TransformTimestampType",
+}
+
+// ignoredSettings are the Config fields that change without affecting the pipelines
+var ignoredSettings = []string{"ConfigFile", "SecretRefs", "SecretsRefresh"}
+
+// reloader re-reads the environment, CONFIG_FILE and PIPELINES_FILE and applies
+// changed schedules, transforms and credentials to the running pipelines
+type reloader struct {
+	// pipelinesFile is the PIPELINES_FILE the pipelines were started from
+	pipelinesFile string
+	pipelines     map[string]*pipeline
+	// db is shared by the pipelines and connects to databaseURL
+	db          *database.PostgresDB
+	databaseURL string
+	// databaseReadURL is the read replica of db, if any
+	databaseReadURL string
+	// secretRefs are the secret references of the configuration, by environment variable
+	secretRefs map[string]string
+	logger     *logging.Logger
+	metrics    *metrics.Metrics
+
+	// mu serializes reloads
+	mu sync.Mutex
+}
+
+func newReloader(cfg *config.Config, pipelines []*pipeline, db *database.PostgresDB, logger *logging.Logger, metricsCollector *metrics.Metrics) *reloader {
+	r := &reloader{
+		pipelinesFile:   cfg.PipelinesFile,
+		pipelines:       make(map[string]*pipeline),
+		db:              db,
+		databaseURL:     cfg.DatabaseURL,
+		databaseReadURL: cfg.DatabaseReadURL,
+		secretRefs:      cfg.SecretRefs,
+		logger:          logger,
+		metrics:         metricsCollector,
+	}
+	for _, p := range pipelines {
+		r.pipelines[p.name] = p
+	}
+	return r
+}
+
+// pipelineUpdate is the validated configuration of a running pipeline, applied
+// once every pipeline's configuration was validated
+type pipelineUpdate struct {
+	pipeline    *pipeline
+	cfg         *config.Config
+	schedule    etl.Schedule
+	transformer *transform.Transformer
+	changed     []string
+}
+
+// changes reports whether any of the settings changed
+func (u pipelineUpdate) changes(settings ...string) bool {
+	for _, setting := range settings {
+		if slices.Contains(u.changed, setting) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload validates the current configuration and applies it. When any part of it
+// is invalid nothing is applied and the pipelines keep running as they are.
+func (r *reloader) Reload() (*server.ReloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, updates, result, err := r.plan()
+	if err == nil && cfg.DatabaseURL != r.databaseURL {
+		// Applied first as it is validated only when set
+		if err = r.db.SetConnectionString(cfg.DatabaseURL); err != nil {
+			err = fmt.Errorf("invalid DATABASE_URL: %w", err)
+		}
+	}
+	// Only the connection string of a replica is replaced; adding or removing one
+	// takes a restart
+	rotateReplica := cfg != nil && cfg.DatabaseReadURL != r.databaseReadURL && cfg.DatabaseReadURL != "" && r.databaseReadURL != ""
+	if err == nil && rotateReplica {
+		if err = r.db.SetReplicaConnectionString(cfg.DatabaseReadURL); err != nil {
+			err = fmt.Errorf("invalid DATABASE_READ_URL: %w", err)
+		}
+	}
+	if err != nil {
+		r.metrics.ConfigReloadsTotal.WithLabelValues("failure").Inc()
+		r.logger.Error(fmt.Sprintf("Configuration reload failed, keeping the running configuration: %v", err))
+		return nil, err
+	}
+	if cfg.DatabaseURL != r.databaseURL {
+		r.databaseURL = cfg.DatabaseURL
+		result.Applied = append(result.Applied, "database connection string")
+	}
+	if rotateReplica {
+		r.databaseReadURL = cfg.DatabaseReadURL
+		result.Applied = append(result.Applied, "read replica connection string")
+	} else if cfg.DatabaseReadURL != r.databaseReadURL {
+		result.RestartRequired = append(result.RestartRequired, "DATABASE_READ_URL")
+	}
+	r.secretRefs = cfg.SecretRefs
+	for _, update := range updates {
+		p := update.pipeline
+		if update.changes("APIToken", "SandboxAPIToken") {
+			source, other := update.cfg.Sources()
+			p.sourceClient.SetToken(source.Token)
+			for _, client := range p.endpointClients {
+				client.SetToken(source.Token)
+			}
+			if p.enrichClient != nil {
+				p.enrichClient.SetToken(source.Token)
+			}
+			if p.shadowClient != nil {
+				p.shadowClient.SetToken(other.Token)
+			}
+			result.Applied = append(result.Applied, fmt.Sprintf("pipeline %s: source tokens updated", displayName(p.name)))
+		}
+		if update.changes("FetchInterval", "Schedule", "ScheduleTimezone") {
+			p.schedule = update.schedule
+			p.service.SetSchedule(update.schedule)
+			result.Applied = append(result.Applied, fmt.Sprintf("pipeline %s: running %v", displayName(p.name), update.schedule))
+		}
+		if update.changes("TransformAuditSampleRate", "TransformFieldSources", "TransformDeleteRule", "TransformTimestampField", "TransformTimestampFormats", "TransformTimestampSourceTZ", "TransformTimestampTargetTZ", "TransformTimestampType") {
+			p.service.SetTransformer(update.transformer)
+			if err := p.service.RecordTransformVersion(context.Background()); err != nil {
+				r.logger.Warn(fmt.Sprintf("Failed to record transform version %s of pipeline %s: %v", update.transformer.Version(), displayName(p.name), err))
+			}
+			result.Applied = append(result.Applied, fmt.Sprintf("pipeline %s: transform updated", displayName(p.name)))
+		}
+		p.cfg = update.cfg
+	}
+
+	r.metrics.ConfigReloadsTotal.WithLabelValues("success").Inc()
+	r.logger.Info(fmt.Sprintf("Configuration reloaded: %d changes applied", len(result.Applied)))
+	for _, change := range result.Applied {
+		r.logger.Info(fmt.Sprintf("Reload applied to %s", change))
+	}
+	for _, setting := range result.RestartRequired {
+		r.logger.Warn(fmt.Sprintf("Reload cannot apply %s, it takes effect after a restart", setting))
+	}
+	return result, nil
+}
+
+// plan loads and validates the configuration of every running pipeline
+func (r *reloader) plan() (*config.Config, []pipelineUpdate, *server.ReloadResult, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	result := &server.ReloadResult{Applied: []string{}}
+	if cfg.PipelinesFile != r.pipelinesFile {
+		result.RestartRequired = append(result.RestartRequired, "PIPELINES_FILE")
+	}
+
+	configs := make(map[string]*config.Config)
+	if r.pipelinesFile == "" {
+		configs[""] = cfg
+	} else {
+		definitions, err := config.LoadPipelines(r.pipelinesFile)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid PIPELINES_FILE: %w", err)
+		}
+		for _, def := range definitions {
+			if _, ok := r.pipelines[def.Name]; !ok {
+				result.RestartRequired = append(result.RestartRequired, fmt.Sprintf("new pipeline %s", def.Name))
+				continue
+			}
+			configs[def.Name] = cfg.ForPipeline(def)
+		}
+	}
+
+	names := make([]string, 0, len(r.pipelines))
+	for name := range r.pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var updates []pipelineUpdate
+	for _, name := range names {
+		p := r.pipelines[name]
+		next, ok := configs[name]
+		if !ok {
+			result.RestartRequired = append(result.RestartRequired, fmt.Sprintf("removal of pipeline %s", name))
+			continue
+		}
+		update := pipelineUpdate{pipeline: p, cfg: next}
+		for _, setting := range changedSettings(p.cfg, next) {
+			if slices.Contains(reloadableSettings, setting) {
+				update.changed = append(update.changed, setting)
+			} else if !slices.Contains(ignoredSettings, setting) {
+				result.RestartRequired = append(result.RestartRequired, fmt.Sprintf("%s of pipeline %s", setting, displayName(name)))
+			}
+		}
+		if update.schedule, err = newSchedule(next); err != nil {
+			return nil, nil, nil, fmt.Errorf("pipeline %s: %w", displayName(name), err)
+		}
+		if next.TransformAuditSampleRate < 0 || next.TransformAuditSampleRate > 1 {
+			return nil, nil, nil, fmt.Errorf("pipeline %s: audit sample rate %v is not between 0 and 1", displayName(name), next.TransformAuditSampleRate)
+		}
+		if update.transformer, err = newTransformer(next, p.logger, p.metrics); err != nil {
+			return nil, nil, nil, fmt.Errorf("pipeline %s: %w", displayName(name), err)
+		}
+		updates = append(updates, update)
+	}
+	return cfg, updates, result, nil
+}
+
+// Watch reloads the configuration whenever one of files is modified, checking
+// every interval until ctx is cancelled
+func (r *reloader) Watch(ctx context.Context, interval time.Duration, files ...string) {
+	modified := modTimes(files)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := modTimes(files)
+			if maps.Equal(current, modified) {
+				continue
+			}
+			modified = current
+			r.logger.Info("Configuration files changed, reloading")
+			r.Reload()
+		}
+	}
+}
+
+// WatchSecrets resolves the secret references of the configuration every interval
+// until ctx is cancelled, and reloads the configuration when a secret was rotated
+func (r *reloader) WatchSecrets(ctx context.Context, interval time.Duration) {
+	previous := r.resolveSecrets(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := r.resolveSecrets(ctx)
+			if current == nil {
+				continue
+			}
+			for ref, value := range current {
+				if old, ok := previous[ref]; ok && old != value {
+					r.logger.Info(fmt.Sprintf("Secret %s was rotated, reloading", ref))
+					r.Reload()
+					break
+				}
+			}
+			previous = current
+		}
+	}
+}
+
+// resolveSecrets returns the values of the secret references of the configuration,
+// or nil when they cannot be resolved
+func (r *reloader) resolveSecrets(ctx context.Context) map[string]string {
+	r.mu.Lock()
+	refs := make([]string, 0, len(r.secretRefs))
+	for _, ref := range r.secretRefs {
+		refs = append(refs, ref)
+	}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	values, err := config.ResolveSecrets(ctx, refs)
+	if err != nil {
+		r.logger.Warn(fmt.Sprintf("Failed to check secrets for rotation: %v", err))
+		return nil
+	}
+	return values
+}
+
+// modTimes returns the modification time of each file that exists
+func modTimes(files []string) map[string]time.Time {
+	times := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			times[file] = info.ModTime()
+		}
+	}
+	return times
+}
+
+// changedSettings returns the names of the Config fields that differ between a and b
+func changedSettings(a, b *config.Config) []string {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	var changed []string
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, va.Type().Field(i).Name)
+		}
+	}
+	return changed
+}
+
+// displayName returns the name of a pipeline in the pipeline control API
+func displayName(name string) string {
+	if name == "" {
+		return defaultPipeline
+	}
+	return name
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/database"
+)
+
+const runOnceUsage = `Usage: etl-pipeline run-once [-pipeline NAME]
+
+Runs one cycle of the pipeline, or of every pipeline of PIPELINES_FILE one after
+the other, and exits, e.g. from cron, Airflow or as a Kubernetes Job. A cycle cut
+short by CYCLE_BUDGET is continued and a failed one retried as set by
+CYCLE_RETRY_ATTEMPTS. RUN_ONCE=true makes the default command behave the same.
+
+Exit codes:
+  0  every cycle succeeded
+  1  a cycle failed, the run was interrupted or the configuration is invalid
+  2  invalid flags or pipeline name
+  3  every cycle loaded its batch, but some records or sinks failed
+`
+
+// Exit codes of run-once
+const (
+	exitSucceeded = 0
+	exitFailed    = 1
+	exitUsage     = 2
+	exitPartial   = 3
+)
+
+// runOnce implements the run-once command and returns the process exit code
+func runOnce(args []string) int {
+	flags := flag.NewFlagSet("run-once", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, runOnceUsage) }
+	name := flags.String("pipeline", "", "pipeline of PIPELINES_FILE to run")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	a := newApp(ctx)
+	defer a.shutdown()
+	pipelines, err := a.pipelinesNamed(*name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	return runCycles(ctx, pipelines)
+}
+
+// runCycles runs one cycle of each pipeline and returns the exit code of run-once.
+// An interrupted cycle is cancelled and its run recorded as failed.
+func runCycles(ctx context.Context, pipelines []*pipeline) int {
+	code := exitSucceeded
+	for _, p := range pipelines {
+		if ctx.Err() != nil {
+			break
+		}
+		status, err := p.service.RunOnce(ctx)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Cycle of pipeline %s failed: %v\n", displayName(p.name), err)
+			code = exitFailed
+		case status == database.RunPartial:
+			fmt.Fprintf(os.Stderr, "Cycle of pipeline %s completed with errors\n", displayName(p.name))
+			if code == exitSucceeded {
+				code = exitPartial
+			}
+		default:
+			fmt.Printf("Cycle of pipeline %s succeeded\n", displayName(p.name))
+		}
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		return exitFailed
+	}
+	return code
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mohammedhassan/etl-pipeline/internal/config"
+)
+
+const validateUsage = `Usage: etl-pipeline validate [-json] [-quiet]
+
+Loads the configuration from the environment, CONFIG_FILE and PIPELINES_FILE,
+checks it and prints the effective value of every setting with where it came
+from. Exits with 1 when the configuration has problems.
+`
+
+// validateReport is the JSON output of the validate command
+type validateReport struct {
+	Valid    bool             `json:"valid"`
+	Problems []string         `json:"problems"`
+	Settings []config.Setting `json:"settings"`
+}
+
+// runValidate implements the validate command and returns the process exit code
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, validateUsage) }
+	asJSON := flags.Bool("json", false, "print the settings and problems as JSON")
+	quiet := flags.Bool("quiet", false, "print only the problems")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	_, settings, problems := config.Validate()
+	if *asJSON {
+		report := validateReport{Valid: len(problems) == 0, Problems: problems, Settings: settings}
+		if report.Problems == nil {
+			report.Problems = []string{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		if !*quiet {
+			width := 0
+			for _, setting := range settings {
+				width = max(width, len(setting.Name))
+			}
+			fmt.Println("Effective configuration:")
+			for _, setting := range settings {
+				fmt.Printf("  %-*s  %-7s  %s\n", width, setting.Name, setting.Origin, setting.Value)
+			}
+			fmt.Println()
+		}
+		if len(problems) == 0 {
+			fmt.Println("Configuration is valid")
+		}
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "Invalid configuration: %s\n", problem)
+		}
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}